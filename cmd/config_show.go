@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/macedot/openmodel/internal/config"
+)
+
+// newConfigShowFlagSet creates a FlagSet for the config show command.
+func newConfigShowFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("config show", flag.ContinueOnError)
+	fs.String("config", "", "Path to config file (default: ./openmodel.json merged over ~/.config/openmodel/openmodel.json)")
+	return fs
+}
+
+func printConfigShowUsage(fs *flag.FlagSet) {
+	fmt.Fprintf(os.Stderr, "Usage: %s config show [options]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\nPrint the effective config as JSON: included files merged, defaults filled in\n")
+	fmt.Fprintf(os.Stderr, "and env vars expanded, with API keys, tokens and URL passwords redacted.\n")
+	fmt.Fprintf(os.Stderr, "\nOptions:\n")
+	fs.PrintDefaults()
+}
+
+// executeConfigShow runs the config show command, printing the config to out, and
+// returns the exit code
+func executeConfigShow(args []string, out io.Writer) int {
+	fs := newConfigShowFlagSet()
+	fs.SetOutput(io.Discard)
+	fs.Usage = func() { printConfigShowUsage(fs) }
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			fs.Usage()
+			return 0
+		}
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		fs.Usage()
+		return 1
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "Error: unexpected argument: %s\n\n", fs.Arg(0))
+		fs.Usage()
+		return 1
+	}
+
+	cfg, err := config.Load(fs.Lookup("config").Value.String())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return 1
+	}
+	redacted, err := cfg.Redacted()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(redacted); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
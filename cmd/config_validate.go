@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/macedot/openmodel/internal/config"
+)
+
+// Check statuses of a validateReport
+const (
+	checkOK      = "ok"
+	checkFailed  = "failed"
+	checkSkipped = "skipped"
+)
+
+// validateReport is the result of `config validate`
+type validateReport struct {
+	Config string          `json:"config"`
+	Valid  bool            `json:"valid"`
+	Checks []validateCheck `json:"checks"`
+}
+
+// validateCheck is one check of a validateReport
+type validateCheck struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Status      string   `json:"status"`
+	Errors      []string `json:"errors,omitempty"`
+}
+
+// newConfigValidateFlagSet creates a FlagSet for the config validate command.
+func newConfigValidateFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("config validate", flag.ContinueOnError)
+	fs.String("config", "", "Path to config file (default: ./openmodel.json merged over ~/.config/openmodel/openmodel.json)")
+	fs.Bool("json", false, "Print the report as JSON")
+	return fs
+}
+
+func printConfigValidateUsage(fs *flag.FlagSet) {
+	fmt.Fprintf(os.Stderr, "Usage: %s config validate [options]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\nCheck the config without starting the server: it must match the schema,\n")
+	fmt.Fprintf(os.Stderr, "every environment variable it references must be set, and model chains must\n")
+	fmt.Fprintf(os.Stderr, "reference defined providers. Exits with 1 when a check fails.\n")
+	fmt.Fprintf(os.Stderr, "\nOptions:\n")
+	fs.PrintDefaults()
+}
+
+// executeConfigValidate runs the config validate command, printing the report to out,
+// and returns the exit code
+func executeConfigValidate(args []string, out io.Writer) int {
+	fs := newConfigValidateFlagSet()
+	fs.SetOutput(io.Discard)
+	fs.Usage = func() { printConfigValidateUsage(fs) }
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			fs.Usage()
+			return 0
+		}
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		fs.Usage()
+		return 1
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "Error: unexpected argument: %s\n\n", fs.Arg(0))
+		fs.Usage()
+		return 1
+	}
+
+	report := buildValidateReport(fs.Lookup("config").Value.String())
+	if fs.Lookup("json").Value.String() == "true" {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	} else {
+		printValidateReport(out, report)
+	}
+
+	if !report.Valid {
+		return 1
+	}
+	return 0
+}
+
+// buildValidateReport checks the config file at configPath, or the default config files
+// when it is empty
+func buildValidateReport(configPath string) validateReport {
+	paths := []string{configPath}
+	if configPath == "" {
+		currentDirPath, userConfigPath := config.GetConfigPaths()
+		paths = []string{userConfigPath, currentDirPath}
+	}
+
+	report := validateReport{Config: configPath}
+	check := func(name, description string, errs []string) {
+		status := checkOK
+		if len(errs) > 0 {
+			status = checkFailed
+		}
+		report.Checks = append(report.Checks, validateCheck{Name: name, Description: description, Status: status, Errors: errs})
+	}
+
+	cfg, err := config.Load(configPath)
+	if err == nil {
+		report.Config = cfg.GetConfigPath()
+		if _, statErr := os.Stat(report.Config); statErr != nil {
+			cfg, err = nil, fmt.Errorf("config file not found: %s", report.Config)
+		}
+	}
+	check("load", "The config parses, matches the schema and its model chains reference defined providers", errorLines(err))
+
+	unset, err := config.UnsetEnvVars(paths...)
+	if err != nil {
+		check("env", "Referenced environment variables are set", errorLines(err))
+	} else {
+		check("env", "Referenced environment variables are set", unset)
+	}
+
+	if cfg == nil {
+		report.Checks = append(report.Checks, validateCheck{
+			Name:        "settings",
+			Description: "Settings and the names they reference are consistent",
+			Status:      checkSkipped,
+		})
+	} else {
+		var errs []string
+		for _, err := range cfg.ValidateAll() {
+			errs = append(errs, errorLines(err)...)
+		}
+		check("settings", "Settings and the names they reference are consistent", errs)
+	}
+
+	report.Valid = true
+	for _, c := range report.Checks {
+		if c.Status != checkOK {
+			report.Valid = false
+		}
+	}
+	return report
+}
+
+// errorLines splits an error into its lines, dropping the indentation of validation
+// error details
+func errorLines(err error) []string {
+	if err == nil {
+		return nil
+	}
+	var lines []string
+	for _, line := range strings.Split(err.Error(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// printValidateReport prints a report in a human-readable form
+func printValidateReport(out io.Writer, report validateReport) {
+	if report.Config != "" {
+		fmt.Fprintln(out, report.Config)
+	}
+	for _, c := range report.Checks {
+		fmt.Fprintf(out, "  %-8s %-9s %s\n", c.Status, c.Name, c.Description)
+		for _, e := range c.Errors {
+			fmt.Fprintf(out, "      %s\n", e)
+		}
+	}
+	if report.Valid {
+		fmt.Fprintln(out, "config is valid")
+	} else {
+		fmt.Fprintln(out, "config is invalid")
+	}
+}
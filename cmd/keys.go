@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/keys"
+)
+
+// newKeysFlagSet creates a FlagSet for a keys command, with the flags of all of them.
+func newKeysFlagSet(command string) *flag.FlagSet {
+	fs := flag.NewFlagSet("keys "+command, flag.ContinueOnError)
+	fs.String("config", "", "Path to config file (default: ./openmodel.json merged over ~/.config/openmodel/openmodel.json)")
+	fs.Bool("json", false, "Print the result as JSON")
+	switch command {
+	case "create":
+		fs.String("name", "", "Application the key is issued to (required)")
+		fs.String("models", "", "Comma-separated model names the key may use, '*' patterns allowed (default all)")
+		fs.String("endpoints", "", "Comma-separated endpoint groups the key may use: openai, anthropic, ollama (default all)")
+		fs.Int("rpm", 0, "Requests per minute the key may make (default unlimited)")
+		fs.Int("tpm", 0, "Prompt and completion tokens per minute the key may use (default unlimited)")
+		fs.Int64("monthly-tokens", 0, "Tokens the key may use per calendar month (default unlimited)")
+		fs.Float64("monthly-budget", 0, "Cost the key may incur per calendar month, priced like provider budgets (default unlimited)")
+		fs.String("tenant", "", "Tenant the key's requests belong to, from the config's tenants")
+	case "list":
+		fs.Bool("all", false, "Include revoked keys")
+	}
+	return fs
+}
+
+func printKeysUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s keys [command] [options]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\nIssue and revoke client API keys in the key store (key_store.path). The server\n")
+	fmt.Fprintf(os.Stderr, "accepts them when key_store.enabled is set; changes apply without a restart.\n")
+	fmt.Fprintf(os.Stderr, "\nCommands:\n")
+	fmt.Fprintf(os.Stderr, "  create --name <name>  Issue a key, printed once\n")
+	fmt.Fprintf(os.Stderr, "  list                  List keys, without the keys themselves\n")
+	fmt.Fprintf(os.Stderr, "  revoke <id>           Revoke a key\n")
+	fmt.Fprintf(os.Stderr, "  rotate <id>           Replace a key by a new one with the same name and limits\n")
+	fmt.Fprintf(os.Stderr, "\nRun '%s keys <command> -h' for the options of a command.\n", os.Args[0])
+}
+
+// executeKeys runs a keys command, printing its result to out, and returns the exit code
+func executeKeys(args []string, out io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		printKeysUsage()
+		return 0
+	}
+	command := args[0]
+	if command != "create" && command != "list" && command != "revoke" && command != "rotate" {
+		fmt.Fprintf(os.Stderr, "Error: unknown keys command: %s\n\n", command)
+		printKeysUsage()
+		return 1
+	}
+
+	fs := newKeysFlagSet(command)
+	fs.SetOutput(io.Discard)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s keys %s [options]\n", os.Args[0], command)
+		fmt.Fprintf(os.Stderr, "\nOptions:\n")
+		fs.SetOutput(os.Stderr)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			fs.Usage()
+			return 0
+		}
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		fs.Usage()
+		return 1
+	}
+	wantArgs := 0
+	if command == "revoke" || command == "rotate" {
+		wantArgs = 1
+	}
+	if fs.NArg() != wantArgs {
+		fmt.Fprintf(os.Stderr, "Error: keys %s takes %d argument(s)\n\n", command, wantArgs)
+		fs.Usage()
+		return 1
+	}
+
+	cfg, err := config.Load(fs.Lookup("config").Value.String())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return 1
+	}
+	if !cfg.KeyStore.IsEnabled() {
+		fmt.Fprintf(os.Stderr, "Warning: key_store is not enabled, the server ignores these keys\n")
+	}
+	store, err := keys.Open(cfg.KeyStore.GetPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer store.Close()
+
+	asJSON := fs.Lookup("json").Value.String() == "true"
+	ctx := context.Background()
+	switch command {
+	case "create":
+		name := fs.Lookup("name").Value.String()
+		limits := keys.Limits{
+			Models:        splitList(fs.Lookup("models").Value.String()),
+			Endpoints:     splitList(fs.Lookup("endpoints").Value.String()),
+			RPM:           fs.Lookup("rpm").Value.(flag.Getter).Get().(int),
+			TPM:           fs.Lookup("tpm").Value.(flag.Getter).Get().(int),
+			MonthlyTokens: fs.Lookup("monthly-tokens").Value.(flag.Getter).Get().(int64),
+			MonthlyBudget: fs.Lookup("monthly-budget").Value.(flag.Getter).Get().(float64),
+			Tenant:        fs.Lookup("tenant").Value.String(),
+		}
+		if name == "" {
+			fmt.Fprintf(os.Stderr, "Error: --name is required\n\n")
+			fs.Usage()
+			return 1
+		}
+		key := config.APIKey{
+			Name:          name,
+			Models:        limits.Models,
+			Endpoints:     limits.Endpoints,
+			RPM:           limits.RPM,
+			TPM:           limits.TPM,
+			MonthlyTokens: limits.MonthlyTokens,
+			MonthlyBudget: limits.MonthlyBudget,
+		}
+		if errs := key.LimitErrors(); len(errs) > 0 {
+			fmt.Fprintf(os.Stderr, "Error: key has %s\n", strings.Join(errs, "; "))
+			return 1
+		}
+		if _, ok := cfg.LookupTenant(limits.Tenant); limits.Tenant != "" && !ok {
+			fmt.Fprintf(os.Stderr, "Error: unknown tenant %q\n", limits.Tenant)
+			return 1
+		}
+		k, secret, err := store.Create(ctx, name, limits)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		return printIssuedKey(out, k, secret, asJSON)
+	case "rotate":
+		k, secret, err := store.Rotate(ctx, fs.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		return printIssuedKey(out, k, secret, asJSON)
+	case "revoke":
+		k, err := store.Revoke(ctx, fs.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		if asJSON {
+			return printJSON(out, k)
+		}
+		fmt.Fprintf(out, "revoked %s (%s)\n", k.ID, k.Name)
+		return 0
+	default:
+		list, err := store.List(ctx, fs.Lookup("all").Value.String() == "true")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		if asJSON {
+			return printJSON(out, list)
+		}
+		printKeyList(out, list)
+		return 0
+	}
+}
+
+// printIssuedKey prints a key that was just created or rotated, the only time it is shown
+func printIssuedKey(out io.Writer, k keys.Key, secret string, asJSON bool) int {
+	if asJSON {
+		return printJSON(out, struct {
+			keys.Key
+			Secret string `json:"key"`
+		}{k, secret})
+	}
+	fmt.Fprintf(out, "id:   %s\nname: %s\nkey:  %s\n", k.ID, k.Name, secret)
+	fmt.Fprintln(out, "\nStore the key now: it cannot be shown again.")
+	return 0
+}
+
+// printKeyList prints keys one per line
+func printKeyList(out io.Writer, list []keys.Key) {
+	if len(list) == 0 {
+		fmt.Fprintln(out, "No keys issued")
+		return
+	}
+	fmt.Fprintf(out, "%-16s  %-20s  %-10s  %-20s  %s\n", "ID", "NAME", "PREFIX", "CREATED", "LIMITS")
+	for _, k := range list {
+		limits := "models: " + listOrAll(k.Models) + ", endpoints: " + listOrAll(k.Endpoints)
+		if k.RPM > 0 {
+			limits += fmt.Sprintf(", rpm: %d", k.RPM)
+		}
+		if k.TPM > 0 {
+			limits += fmt.Sprintf(", tpm: %d", k.TPM)
+		}
+		if k.MonthlyTokens > 0 {
+			limits += fmt.Sprintf(", monthly tokens: %d", k.MonthlyTokens)
+		}
+		if k.MonthlyBudget > 0 {
+			limits += fmt.Sprintf(", monthly budget: %g", k.MonthlyBudget)
+		}
+		if k.Tenant != "" {
+			limits += ", tenant: " + k.Tenant
+		}
+		if k.RevokedAt != nil {
+			limits = "revoked " + k.RevokedAt.Format(time.DateTime)
+		}
+		fmt.Fprintf(out, "%-16s  %-20s  %-10s  %-20s  %s\n", k.ID, k.Name, k.Prefix, k.CreatedAt.Format(time.DateTime), limits)
+	}
+}
+
+func printJSON(out io.Writer, v any) int {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// splitList splits a comma-separated flag value, nil when it is empty
+func splitList(value string) []string {
+	var list []string
+	for item := range strings.SplitSeq(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func listOrAll(list []string) string {
+	if len(list) == 0 {
+		return "all"
+	}
+	return strings.Join(list, ",")
+}
@@ -5,6 +5,7 @@
 //	openmodel serve     Start the OpenModel server (default)
 //	openmodel test      Test configured models
 //	openmodel bench     Benchmark models with prompts
+//	openmodel keys      Issue and revoke client API keys
 //	openmodel -h        Show help
 package main
 
@@ -44,8 +45,11 @@ func newBenchFlagSet() *flag.FlagSet {
 
 // newServeFlagSet creates a FlagSet for the serve command.
 func newServeFlagSet() *flag.FlagSet {
-	fs := flag.NewFlagSet("serve", flag.ExitOnError)
-	fs.String("config", "", "Path to config file (default: ~/.config/openmodel/config.json)")
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.String("config", "", "Path or URL (https://, s3://, gs://) of the config (default: ~/.config/openmodel/config.json)")
+	fs.String("host", "", "Listen host, overriding server.host")
+	fs.Int("port", 0, "Listen port, overriding server.port")
+	fs.String("log-level", "", "Log level (trace, debug, info, warn, error), overriding log_level and OPENMODEL_LOG_LEVEL")
 	fs.Bool("h", false, "Show help")
 	return fs
 }
@@ -89,6 +93,8 @@ func main() {
 		runConfigCmd(args)
 	case "bench":
 		runBenchCmd(args)
+	case "keys":
+		os.Exit(executeKeys(args, os.Stdout))
 	default:
 		fmt.Fprintf(os.Stderr, "Error: unknown command: %s\n\n", command)
 		printUsage()
@@ -103,11 +109,15 @@ func printUsage() {
 	fmt.Fprintf(os.Stderr, "  models   List available models\n")
 	fmt.Fprintf(os.Stderr, "  config   Find and validate config file\n")
 	fmt.Fprintf(os.Stderr, "  bench    Benchmark models with prompts\n")
+	fmt.Fprintf(os.Stderr, "  keys     Issue and revoke client API keys\n")
 	fmt.Fprintf(os.Stderr, "\nOptions:\n")
 	fmt.Fprintf(os.Stderr, "  -h, --help    Show help\n")
 	fmt.Fprintf(os.Stderr, "  -v, --version Show version\n")
 	fmt.Fprintf(os.Stderr, "\nServe options:\n")
-	fmt.Fprintf(os.Stderr, "  --config <path>   Path to config file (default: ~/.config/openmodel/config.json)\n")
+	fmt.Fprintf(os.Stderr, "  --config <path>     Path or URL (https://, s3://, gs://) of the config (default: ~/.config/openmodel/config.json)\n")
+	fmt.Fprintf(os.Stderr, "  --host <host>       Listen host, overriding server.host\n")
+	fmt.Fprintf(os.Stderr, "  --port <port>       Listen port, overriding server.port\n")
+	fmt.Fprintf(os.Stderr, "  --log-level <level> Log level, overriding log_level and OPENMODEL_LOG_LEVEL\n")
 	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for more information on a command.\n", os.Args[0])
 }
 
@@ -131,36 +141,51 @@ func printBenchUsage(fs *flag.FlagSet) {
 
 // runServeCmd handles the serve command
 func runServeCmd(args []string) {
-	cfg, exitCode := executeServeCmd(args)
+	cfg, overrides, exitCode := executeServeCmd(args)
 	if exitCode != 0 {
 		os.Exit(exitCode)
 	}
-	runServer(cfg)
+	if cfg == nil {
+		return // Help was shown
+	}
+	runServer(cfg, overrides)
 }
 
-func executeServeCmd(args []string) (*config.Config, int) {
+func executeServeCmd(args []string) (*config.Config, config.Overrides, int) {
 	fs := newServeFlagSet()
 	fs.SetOutput(io.Discard)
 	fs.Usage = func() { printServerUsage(fs) }
 
 	if err := fs.Parse(args); err != nil {
-		return nil, 1
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		fs.Usage()
+		return nil, config.Overrides{}, 1
 	}
 
 	showHelp := fs.Lookup("h").Value.(flag.Getter).Get().(bool)
 	if showHelp {
 		fs.Usage()
-		return nil, 0
+		return nil, config.Overrides{}, 0
+	}
+
+	overrides := config.Overrides{
+		Host:     fs.Lookup("host").Value.String(),
+		Port:     fs.Lookup("port").Value.(flag.Getter).Get().(int),
+		LogLevel: fs.Lookup("log-level").Value.String(),
+	}
+	if overrides.Port < 0 || overrides.Port > 65535 {
+		fmt.Fprintf(os.Stderr, "Error: invalid port %d\n", overrides.Port)
+		return nil, config.Overrides{}, 1
 	}
 
 	configPath := fs.Lookup("config").Value.String()
-	cfg, err := loadAndValidateConfig(configPath)
+	cfg, err := loadAndValidateConfig(configPath, overrides)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
-		return nil, 1
+		return nil, config.Overrides{}, 1
 	}
 
-	return cfg, 0
+	return cfg, overrides, 0
 }
 
 func printServerUsage(fs *flag.FlagSet) {
@@ -176,10 +201,13 @@ func printModelsUsage(fs *flag.FlagSet) {
 }
 
 func printConfigUsage() {
-	fmt.Fprintf(os.Stderr, "Usage: %s config\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage: %s config [command]\n", os.Args[0])
 	fmt.Fprintf(os.Stderr, "\nFind and validate config file.\n")
 	fmt.Fprintf(os.Stderr, "\nOutputs the config file path if valid.\n")
 	fmt.Fprintf(os.Stderr, "Only prints errors if validation fails.\n")
+	fmt.Fprintf(os.Stderr, "\nCommands:\n")
+	fmt.Fprintf(os.Stderr, "  validate  Check the config and print a report of each check (for CI)\n")
+	fmt.Fprintf(os.Stderr, "  show      Print the effective config with secrets redacted\n")
 }
 
 // runModelsCmd handles the models command
@@ -306,6 +334,18 @@ func runConfigCmd(args []string) {
 	if err := fs.Parse(args); err != nil {
 		os.Exit(1)
 	}
+	if fs.NArg() > 0 {
+		switch fs.Arg(0) {
+		case "validate":
+			os.Exit(executeConfigValidate(fs.Args()[1:], os.Stdout))
+		case "show":
+			os.Exit(executeConfigShow(fs.Args()[1:], os.Stdout))
+		default:
+			fmt.Fprintf(os.Stderr, "Error: unknown config command: %s\n\n", fs.Arg(0))
+			printConfigUsage()
+			os.Exit(1)
+		}
+	}
 	if err := executeConfig(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
@@ -324,7 +364,7 @@ func executeConfig() error {
 	}
 
 	// Check if config file exists
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+	if _, err := os.Stat(configPath); os.IsNotExist(err) && !config.IsRemote(configPath) {
 		return fmt.Errorf("config file not found: %s", configPath)
 	}
 
@@ -380,7 +420,11 @@ func runBench(promptStr, scope string, stream bool, model string) {
 	promptStr = strings.TrimSpace(promptStr)
 
 	// Initialize providers
-	providers := initProviders(cfg)
+	providers, err := initProviders(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 	benchProviders := asBenchProviderMap(providers)
 
 	// Create benchmark context
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"flag"
 	"io"
 	"os"
@@ -10,6 +11,7 @@ import (
 	"testing"
 
 	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/logger"
 )
 
 func TestPrintUsage(t *testing.T) {
@@ -202,7 +204,7 @@ func TestPrintVersion_Dev(t *testing.T) {
 }
 
 func TestRunServer_WithNonExistentConfigPath(t *testing.T) {
-	_, err := loadAndValidateConfig("/nonexistent/config.json")
+	_, err := loadAndValidateConfig("/nonexistent/config.json", config.Overrides{})
 	if err == nil {
 		t.Fatal("expected error for non-existent config path")
 	}
@@ -214,12 +216,65 @@ func TestRunServer_WithInvalidConfigFile(t *testing.T) {
 		t.Fatalf("failed to write config: %v", err)
 	}
 
-	_, err := loadAndValidateConfig(configPath)
+	_, err := loadAndValidateConfig(configPath, config.Overrides{})
 	if err == nil {
 		t.Fatal("expected error for invalid config file")
 	}
 }
 
+func TestExecuteServeCmd_Overrides(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "openmodel.json")
+	configJSON := `{
+		"server": {"port": 12345, "host": "localhost"},
+		"log_level": "info",
+		"providers": {"local": {"url": "http://localhost:11434/v1"}},
+		"models": {}
+	}`
+	if err := os.WriteFile(configPath, []byte(configJSON), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		args         []string
+		wantExitCode int
+		wantHost     string
+		wantPort     int
+		wantLevel    string
+	}{
+		{name: "config values", args: []string{"--config", configPath}, wantHost: "localhost", wantPort: 12345, wantLevel: "info"},
+		{name: "overrides", args: []string{"--config", configPath, "--host", "0.0.0.0", "--port", "8080", "--log-level", "warn"}, wantHost: "0.0.0.0", wantPort: 8080, wantLevel: "warn"},
+		{name: "invalid port", args: []string{"--config", configPath, "--port", "70000"}, wantExitCode: 1},
+		{name: "non-numeric port", args: []string{"--config", configPath, "--port", "http"}, wantExitCode: 1},
+		{name: "invalid log level", args: []string{"--config", configPath, "--log-level", "loud"}, wantExitCode: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, overrides, exitCode := executeServeCmd(tt.args)
+			if exitCode != tt.wantExitCode {
+				t.Fatalf("executeServeCmd exitCode = %d, want %d", exitCode, tt.wantExitCode)
+			}
+			if tt.wantExitCode != 0 {
+				return
+			}
+			if cfg.Server.Host != tt.wantHost || cfg.Server.Port != tt.wantPort || cfg.LogLevel != tt.wantLevel {
+				t.Errorf("got host %q port %d log level %q, want %q %d %q", cfg.Server.Host, cfg.Server.Port, cfg.LogLevel, tt.wantHost, tt.wantPort, tt.wantLevel)
+			}
+
+			// The overrides apply again to a reloaded config
+			reloaded, err := config.Load(configPath)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			overrides.Apply(reloaded)
+			if reloaded.Server.Host != cfg.Server.Host || reloaded.Server.Port != cfg.Server.Port || reloaded.LogLevel != cfg.LogLevel {
+				t.Errorf("reloaded config %+v does not keep the overrides %+v", reloaded.Server, cfg.Server)
+			}
+		})
+	}
+	logger.Init("info", "")
+}
+
 func TestRunModels_WithNoConfig(t *testing.T) {
 	// Set a non-existent config path - config.Load() will return default config
 	// which has no models defined
@@ -417,6 +472,190 @@ func TestRunConfig_WithValidConfig(t *testing.T) {
 	}
 }
 
+func TestExecuteConfigValidate(t *testing.T) {
+	t.Setenv("OPENMODEL_TEST_KEY", "sk-test")
+
+	tests := []struct {
+		name         string
+		config       string
+		wantExitCode int
+		wantStatus   map[string]string
+		wantErr      string
+	}{
+		{
+			name:       "valid",
+			config:     `{"server": {"port": 12345, "host": "localhost"}, "providers": {"local": {"url": "http://localhost:11434/v1", "api_key": "${OPENMODEL_TEST_KEY}"}}, "models": {"llama": ["local/llama3"]}}`,
+			wantStatus: map[string]string{"load": checkOK, "env": checkOK, "settings": checkOK},
+		},
+		{
+			name:         "unset env var",
+			config:       `{"server": {"port": 12345, "host": "localhost"}, "providers": {"local": {"url": "http://localhost:11434/v1", "api_key": "${OPENMODEL_TEST_MISSING}"}}, "models": {}}`,
+			wantExitCode: 1,
+			wantStatus:   map[string]string{"load": checkOK, "env": checkFailed, "settings": checkOK},
+			wantErr:      "OPENMODEL_TEST_MISSING is not set",
+		},
+		{
+			name:         "undefined provider",
+			config:       `{"server": {"port": 12345, "host": "localhost"}, "providers": {}, "models": {"llama": {"providers": [{"provider": "remote", "model": "llama3"}]}}}`,
+			wantExitCode: 1,
+			wantStatus:   map[string]string{"load": checkFailed, "env": checkOK, "settings": checkSkipped},
+			wantErr:      `references unknown provider \"remote\"`,
+		},
+		{
+			name:         "inconsistent settings",
+			config:       `{"server": {"port": 12345, "host": "localhost"}, "providers": {"local": {"url": "http://localhost:11434/v1"}}, "models": {"a": {"default": true, "providers": [{"provider": "local", "model": "a"}]}, "b": {"default": true, "providers": [{"provider": "local", "model": "b"}]}}}`,
+			wantExitCode: 1,
+			wantStatus:   map[string]string{"load": checkOK, "env": checkOK, "settings": checkFailed},
+			wantErr:      "multiple models marked as default",
+		},
+		{
+			name:         "schema violation",
+			config:       `{"server": {"port": "12345", "host": "localhost"}, "providers": {}, "models": {}}`,
+			wantExitCode: 1,
+			wantStatus:   map[string]string{"load": checkFailed, "env": checkOK, "settings": checkSkipped},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "openmodel.json")
+			if err := os.WriteFile(configPath, []byte(tt.config), 0644); err != nil {
+				t.Fatalf("failed to write config: %v", err)
+			}
+
+			var out bytes.Buffer
+			exitCode := executeConfigValidate([]string{"--config", configPath, "--json"}, &out)
+			if exitCode != tt.wantExitCode {
+				t.Fatalf("exitCode = %d, want %d; report: %s", exitCode, tt.wantExitCode, out.String())
+			}
+			var report validateReport
+			if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+				t.Fatalf("invalid report %s: %v", out.String(), err)
+			}
+			if report.Config != configPath || report.Valid != (tt.wantExitCode == 0) {
+				t.Errorf("unexpected report %+v", report)
+			}
+			for _, check := range report.Checks {
+				if check.Status != tt.wantStatus[check.Name] {
+					t.Errorf("check %s = %s, want %s (%v)", check.Name, check.Status, tt.wantStatus[check.Name], check.Errors)
+				}
+			}
+			if tt.wantErr != "" && !strings.Contains(out.String(), tt.wantErr) {
+				t.Errorf("expected %q in the report, got %s", tt.wantErr, out.String())
+			}
+		})
+	}
+
+	var out bytes.Buffer
+	executeConfigValidate([]string{"--config", filepath.Join(t.TempDir(), "missing.json")}, &out)
+	if !strings.Contains(out.String(), "failed   load") || !strings.Contains(out.String(), "config is invalid") {
+		t.Errorf("expected a failed load check for a missing file, got %s", out.String())
+	}
+}
+
+func TestExecuteConfigShow(t *testing.T) {
+	t.Setenv("OPENMODEL_TEST_KEY", "sk-test-123456")
+	configPath := filepath.Join(t.TempDir(), "openmodel.json")
+	configJSON := `{
+		"server": {"port": 12345, "host": "localhost"},
+		"providers": {"hosted": {"url": "${OPENMODEL_TEST_URL:-https://api.example.com/v1}", "api_key": "${OPENMODEL_TEST_KEY}"}},
+		"models": {}
+	}`
+	if err := os.WriteFile(configPath, []byte(configJSON), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	var out bytes.Buffer
+	if exitCode := executeConfigShow([]string{"--config", configPath}, &out); exitCode != 0 {
+		t.Fatalf("exitCode = %d, want 0", exitCode)
+	}
+	var shown struct {
+		Providers map[string]config.ProviderConfig `json:"providers"`
+		LogLevel  string                           `json:"log_level"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &shown); err != nil {
+		t.Fatalf("invalid output %s: %v", out.String(), err)
+	}
+	hosted := shown.Providers["hosted"]
+	if hosted.URL != "https://api.example.com/v1" || hosted.APIKey != "[redacted]" {
+		t.Errorf("expected the URL expanded and the key redacted, got %+v", hosted)
+	}
+	if shown.LogLevel != "info" {
+		t.Errorf("expected the default log level shown, got %q", shown.LogLevel)
+	}
+	if strings.Contains(out.String(), "sk-test-123456") {
+		t.Errorf("the API key leaked: %s", out.String())
+	}
+
+	if exitCode := executeConfigShow([]string{"--config", filepath.Join(t.TempDir(), "missing.json")}, &out); exitCode != 1 {
+		t.Errorf("exitCode = %d for a missing config, want 1", exitCode)
+	}
+}
+
+func TestExecuteKeys(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "openmodel.json")
+	configJSON := `{
+		"server": {"port": 12345, "host": "localhost"},
+		"providers": {},
+		"models": {},
+		"key_store": {"enabled": true, "path": "` + filepath.Join(dir, "keys.db") + `"}
+	}`
+	if err := os.WriteFile(configPath, []byte(configJSON), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	var out bytes.Buffer
+	args := []string{"create", "--config", configPath, "--json", "--name", "indexer", "--models", "text-embedding-*", "--endpoints", "openai", "--rpm", "60"}
+	if exitCode := executeKeys(args, &out); exitCode != 0 {
+		t.Fatalf("create exitCode = %d, want 0", exitCode)
+	}
+	var created struct {
+		ID        string   `json:"id"`
+		Name      string   `json:"name"`
+		Key       string   `json:"key"`
+		Models    []string `json:"models"`
+		Endpoints []string `json:"endpoints"`
+		RPM       int      `json:"rpm"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &created); err != nil {
+		t.Fatalf("invalid output %s: %v", out.String(), err)
+	}
+	if created.Name != "indexer" || !strings.HasPrefix(created.Key, "om-") || len(created.Models) != 1 || len(created.Endpoints) != 1 || created.RPM != 60 {
+		t.Errorf("unexpected key %+v", created)
+	}
+
+	out.Reset()
+	if exitCode := executeKeys([]string{"list", "--config", configPath}, &out); exitCode != 0 {
+		t.Fatalf("list exitCode = %d, want 0", exitCode)
+	}
+	if !strings.Contains(out.String(), created.ID) || strings.Contains(out.String(), created.Key) {
+		t.Errorf("expected the key listed without the key itself, got %s", out.String())
+	}
+
+	out.Reset()
+	if exitCode := executeKeys([]string{"rotate", "--config", configPath, created.ID}, &out); exitCode != 0 {
+		t.Fatalf("rotate exitCode = %d, want 0", exitCode)
+	}
+	if !strings.Contains(out.String(), "key:  om-") {
+		t.Errorf("expected the new key printed, got %s", out.String())
+	}
+	if exitCode := executeKeys([]string{"revoke", "--config", configPath, created.ID}, io.Discard); exitCode != 1 {
+		t.Errorf("revoking a rotated key: exitCode = %d, want 1", exitCode)
+	}
+
+	for _, args := range [][]string{
+		{"create", "--config", configPath},
+		{"create", "--config", configPath, "--name", "x", "--endpoints", "admin"},
+		{"create", "--config", configPath, "--name", "x", "--tpm", "-1"},
+		{"revoke", "--config", configPath},
+		{"unknown"},
+	} {
+		if exitCode := executeKeys(args, io.Discard); exitCode != 1 {
+			t.Errorf("executeKeys(%v) exitCode = %d, want 1", args, exitCode)
+		}
+	}
+}
+
 func TestPrintModelsUsage(t *testing.T) {
 	oldStderr := os.Stderr
 	defer func() { os.Stderr = oldStderr }()
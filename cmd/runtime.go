@@ -3,51 +3,132 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 
+	"github.com/macedot/openmodel/internal/audit"
+	"github.com/macedot/openmodel/internal/bodylog"
 	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/keys"
 	"github.com/macedot/openmodel/internal/logger"
 	"github.com/macedot/openmodel/internal/provider"
 	"github.com/macedot/openmodel/internal/server"
 	"github.com/macedot/openmodel/internal/state"
+	"github.com/macedot/openmodel/internal/usage"
 )
 
 // initProviders creates and initializes all configured providers.
-func initProviders(cfg *config.Config) map[string]provider.Provider {
+func initProviders(cfg *config.Config) (map[string]provider.Provider, error) {
 	providers := make(map[string]provider.Provider)
 
-	httpConfig := provider.HTTPConfig{
-		TimeoutSeconds:               cfg.HTTP.TimeoutSeconds,
-		MaxIdleConns:                 cfg.HTTP.MaxIdleConns,
-		MaxIdleConnsPerHost:          cfg.HTTP.MaxIdleConnsPerHost,
-		IdleConnTimeoutSeconds:       cfg.HTTP.IdleConnTimeoutSeconds,
-		DialTimeoutSeconds:           cfg.HTTP.DialTimeoutSeconds,
-		TLSHandshakeTimeoutSeconds:   cfg.HTTP.TLSHandshakeTimeoutSeconds,
-		ResponseHeaderTimeoutSeconds: cfg.HTTP.ResponseHeaderTimeoutSeconds,
+	for name, pc := range cfg.Providers {
+		p, err := server.NewProvider(cfg, name, pc)
+		if err != nil {
+			return nil, err
+		}
+		providers[name] = p
+		logger.Info("Provider initialized", "name", name, "type", pc.Type, "url", pc.URL, "api_mode", p.APIMode())
+	}
+	return providers, nil
+}
+
+// initState creates the state manager, sharing it through Redis when configured.
+func initState(cfg *config.Config) (*state.State, error) {
+	stateMgr := state.New()
+	if cfg.State.GetBackend() != config.StateBackendRedis {
+		return stateMgr, nil
 	}
 
-	for name, pc := range cfg.Providers {
-		providers[name] = provider.NewOpenAIProviderWithConfig(name, pc.URL, pc.APIKey, pc.ApiMode, httpConfig)
-		logger.Info("Provider initialized", "name", name, "url", pc.URL, "api_mode", pc.ApiMode)
+	store, err := state.NewRedisStore(cfg.State.GetRedisURL(), cfg.State.GetKeyPrefix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create state store: %w", err)
+	}
+	stateMgr.SetStore(store)
+	logger.Info("State store initialized", "backend", config.StateBackendRedis, "key_prefix", cfg.State.GetKeyPrefix())
+	return stateMgr, nil
+}
+
+// initUsage opens the usage database when usage accounting is enabled, nil otherwise.
+func initUsage(cfg *config.Config) (*usage.Store, error) {
+	if !cfg.Usage.IsEnabled() {
+		return nil, nil
+	}
+	store, err := usage.Open(cfg.Usage.GetPath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create usage store: %w", err)
+	}
+	logger.Info("Usage store initialized", "path", cfg.Usage.GetPath())
+	return store, nil
+}
+
+// initKeyStore opens the store of issued API keys when it is enabled, nil otherwise.
+func initKeyStore(cfg *config.Config) (*keys.Store, error) {
+	if !cfg.KeyStore.IsEnabled() {
+		return nil, nil
+	}
+	store, err := keys.Open(cfg.KeyStore.GetPath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create key store: %w", err)
+	}
+	logger.Info("Key store initialized", "path", cfg.KeyStore.GetPath())
+	return store, nil
+}
+
+// initBodyLog opens the body log when debug body logging is enabled, nil otherwise.
+func initBodyLog(cfg *config.Config) (*bodylog.Logger, error) {
+	if !cfg.BodyLog.IsEnabled() {
+		return nil, nil
+	}
+	l, err := bodylog.Open(cfg.BodyLog.GetPath(), bodylog.Options{
+		Fields:      cfg.BodyLog.RedactFields,
+		Patterns:    cfg.BodyLog.RedactPatterns,
+		KeepUserIDs: cfg.BodyLog.KeepUserIDs,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create body log: %w", err)
+	}
+	logger.Warn("Body logging enabled: request and response bodies are written to disk", "path", cfg.BodyLog.GetPath())
+	return l, nil
+}
+
+// initAudit opens the audit log when auditing is enabled, nil otherwise.
+func initAudit(cfg *config.Config) (*audit.Logger, error) {
+	if !cfg.Audit.IsEnabled() {
+		return nil, nil
+	}
+	var l *audit.Logger
+	var err error
+	if cfg.Audit.GetSink() == config.AuditSinkSyslog {
+		network, address := cfg.Audit.GetSyslogAddress()
+		l, err = audit.OpenSyslog(network, address, cfg.Audit.GetSyslogTag())
+	} else {
+		l, err = audit.OpenFile(cfg.Audit.GetPath())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create audit log: %w", err)
 	}
-	return providers
+	logger.Info("Audit log initialized", "sink", cfg.Audit.GetSink())
+	return l, nil
 }
 
-// loadAndValidateConfig loads config, initializes logger, validates, and returns cfg.
-func loadAndValidateConfig(configPath string) (*config.Config, error) {
+// loadAndValidateConfig loads config, applies command-line overrides, initializes logger,
+// validates, and returns cfg.
+func loadAndValidateConfig(configPath string, overrides config.Overrides) (*config.Config, error) {
 	cfg, err := config.Load(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
+	overrides.Apply(cfg)
 
 	if err := logger.Init(cfg.LogLevel, ""); err != nil {
 		return nil, fmt.Errorf("failed to initialize logger: %w", err)
 	}
+	logger.SetSecrets("config", cfg.Secrets()...)
 
-	logger.Info("Config loaded", "config_path", cfg.GetConfigPath())
+	logger.Info("Config loaded", "config_path", cfg.GetConfigPath(), "profile", cfg.GetProfile())
 	if cfg.LogLevel != "" && cfg.LogLevel != "info" {
 		logger.Debug("Log level set", "level", cfg.LogLevel)
 	}
@@ -60,7 +141,7 @@ func loadAndValidateConfig(configPath string) (*config.Config, error) {
 }
 
 func mustLoadAndValidateConfig(configPath string) *config.Config {
-	cfg, err := loadAndValidateConfig(configPath)
+	cfg, err := loadAndValidateConfig(configPath, config.Overrides{})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
@@ -68,33 +149,43 @@ func mustLoadAndValidateConfig(configPath string) *config.Config {
 	return cfg
 }
 
-func reloadServerConfig(srv *server.Server, configPath string) error {
-	newCfg, err := config.Load(configPath)
-	if err != nil {
-		return err
-	}
-	if err := newCfg.Validate(); err != nil {
-		return err
-	}
-	return srv.ReloadConfig(newCfg)
+// configWatcher reloads the config when it changes: a file watcher, or a poller of a
+// config loaded from a URL
+type configWatcher interface {
+	Start() error
+	Stop()
 }
 
-func startConfigWatcher(configPath string, srv *server.Server) *config.Watcher {
+func startConfigWatcher(cfg *config.Config, srv *server.Server) configWatcher {
+	configPath := cfg.GetConfigPath()
 	if configPath == "" {
 		return nil
 	}
 
-	watcher := config.NewWatcher(configPath, func(newCfg *config.Config, err error) {
+	reload := func(newCfg *config.Config, err error) {
 		if err != nil {
 			logger.Error("config_reload_failed", "error", err)
+			srv.RecordConfigReload(audit.ActorWatcher, "", err)
 			return
 		}
 		if err := srv.ReloadConfig(newCfg); err != nil {
 			logger.Error("config_reload_failed", "error", err)
+			srv.RecordConfigReload(audit.ActorWatcher, "", err)
 			return
 		}
 		logger.Info("config_reloaded_successfully")
-	})
+		srv.RecordConfigReload(audit.ActorWatcher, "", nil)
+	}
+	var watcher configWatcher
+	if config.IsRemote(configPath) {
+		refresh := cfg.GetConfigRefresh()
+		if refresh == 0 {
+			return nil
+		}
+		watcher = config.NewRemoteWatcher(configPath, refresh, reload)
+	} else {
+		watcher = config.NewWatcher(configPath, reload)
+	}
 
 	if err := watcher.Start(); err != nil {
 		logger.Warn("config_watcher_failed", "error", err)
@@ -120,11 +211,14 @@ func startSignalHandler(ctx context.Context, cancel context.CancelFunc, srv *ser
 				if configPath == "" {
 					continue
 				}
-				if err := reloadServerConfig(srv, configPath); err != nil {
-					logger.Error("config_reload_failed", "error", err)
+				diff, err := srv.ReloadFromFile()
+				if err != nil {
+					logger.Error("config_reload_failed", "source", "sighup", "error", err)
+					srv.RecordConfigReload(audit.ActorSignal, "", err)
 					continue
 				}
-				logger.Info("config_reloaded_successfully")
+				logger.Info("config_reloaded_successfully", "changes", diff.String())
+				srv.RecordConfigReload(audit.ActorSignal, diff.String(), nil)
 			case syscall.SIGINT, syscall.SIGTERM:
 				logger.Info("Shutting_down")
 				srv.Stop(ctx)
@@ -135,21 +229,69 @@ func startSignalHandler(ctx context.Context, cancel context.CancelFunc, srv *ser
 	}()
 }
 
-// runServer starts the HTTP server with the given config.
-func runServer(cfg *config.Config) {
-	providers := initProviders(cfg)
-	stateMgr := state.New(10000)
+// runServer starts the HTTP server with the given config, keeping the command-line
+// overrides across reloads.
+func runServer(cfg *config.Config, overrides config.Overrides) {
+	providers, err := initProviders(cfg)
+	if err != nil {
+		logger.Error("Provider_init_failed", "error", err)
+		os.Exit(1)
+	}
+	stateMgr, err := initState(cfg)
+	if err != nil {
+		logger.Error("State_init_failed", "error", err)
+		os.Exit(1)
+	}
+	usageStore, err := initUsage(cfg)
+	if err != nil {
+		logger.Error("Usage_init_failed", "error", err)
+		os.Exit(1)
+	}
+	defer usageStore.Close()
+	keyStore, err := initKeyStore(cfg)
+	if err != nil {
+		logger.Error("Key_store_init_failed", "error", err)
+		os.Exit(1)
+	}
+	defer keyStore.Close()
+	bodyLog, err := initBodyLog(cfg)
+	if err != nil {
+		logger.Error("Body_log_init_failed", "error", err)
+		os.Exit(1)
+	}
+	defer bodyLog.Close()
+	auditLog, err := initAudit(cfg)
+	if err != nil {
+		logger.Error("Audit_log_init_failed", "error", err)
+		os.Exit(1)
+	}
+	defer auditLog.Close()
 	srv := server.New(cfg, providers, stateMgr, Version)
+	srv.SetOverrides(overrides)
+	srv.SetUsageStore(usageStore)
+	srv.SetKeyStore(keyStore)
+	srv.SetBodyLog(bodyLog)
+	srv.SetAuditLog(auditLog)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Pull backend health published by other instances
+	if store := stateMgr.Store(); store != nil {
+		if closer, ok := store.(io.Closer); ok {
+			defer closer.Close()
+		}
+		go stateMgr.RunSync(ctx, cfg.State.GetSyncInterval())
+	}
+
 	configPath := cfg.GetConfigPath()
-	if watcher := startConfigWatcher(configPath, srv); watcher != nil {
+	if watcher := startConfigWatcher(cfg, srv); watcher != nil {
 		defer watcher.Stop()
 	}
 
 	startSignalHandler(ctx, cancel, srv, configPath)
+	go srv.RunHealthChecks(ctx)
+	go srv.RunModelDiscovery(ctx)
 
 	logger.Info("Starting_openmodel", "host", cfg.Server.Host, "port", cfg.Server.Port)
 	if err := srv.Start(); err != nil && err != http.ErrServerClosed {
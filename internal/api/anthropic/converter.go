@@ -26,6 +26,15 @@ func OpenAIToAnthropicRequest(openaiReq *openai.ChatCompletionRequest) *Messages
 		anthropicReq.Stop = openaiReq.Stop
 	}
 
+	for _, tool := range openaiReq.Tools {
+		anthropicReq.Tools = append(anthropicReq.Tools, Tool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: tool.Function.Parameters,
+		})
+	}
+	anthropicReq.ToolChoice = openAIToolChoiceToAnthropic(openaiReq.ToolChoice, openaiReq.ParallelToolCalls)
+
 	// Convert messages
 	var systemPrompt string
 	anthropicReq.Messages = make([]Message, 0, len(openaiReq.Messages))
@@ -61,10 +70,27 @@ func AnthropicToOpenAIRequest(anthropicReq *MessagesRequest) *openai.ChatComplet
 		openaiReq.MaxTokens = &anthropicReq.MaxTokens
 	}
 
+	// Ask the backend for usage so message_delta can report real token counts
+	if anthropicReq.Stream {
+		openaiReq.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	}
+
 	if len(anthropicReq.Stop) > 0 {
 		openaiReq.Stop = anthropicReq.Stop
 	}
 
+	for _, tool := range anthropicReq.Tools {
+		openaiReq.Tools = append(openaiReq.Tools, openai.Tool{
+			Type: "function",
+			Function: openai.ToolFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.InputSchema,
+			},
+		})
+	}
+	openaiReq.ToolChoice, openaiReq.ParallelToolCalls = anthropicToolChoiceToOpenAI(anthropicReq.ToolChoice)
+
 	// Convert messages
 	openaiReq.Messages = make([]openai.ChatCompletionMessage, 0, len(anthropicReq.Messages)+1)
 
@@ -86,6 +112,69 @@ func AnthropicToOpenAIRequest(anthropicReq *MessagesRequest) *openai.ChatComplet
 	return openaiReq
 }
 
+// openAIToolChoiceToAnthropic maps OpenAI tool_choice and parallel_tool_calls to an Anthropic tool_choice.
+// Returns nil when neither is set, leaving the backend default in place.
+func openAIToolChoiceToAnthropic(choice any, parallel *bool) *ToolChoice {
+	var tc *ToolChoice
+	switch v := choice.(type) {
+	case string:
+		switch v {
+		case "auto":
+			tc = &ToolChoice{Type: "auto"}
+		case "none":
+			tc = &ToolChoice{Type: "none"}
+		case "required":
+			tc = &ToolChoice{Type: "any"}
+		}
+	case map[string]any:
+		if fn, ok := v["function"].(map[string]any); ok {
+			if name, ok := fn["name"].(string); ok && name != "" {
+				tc = &ToolChoice{Type: "tool", Name: name}
+			}
+		}
+	}
+
+	if parallel != nil && !*parallel {
+		if tc == nil {
+			tc = &ToolChoice{Type: "auto"}
+		}
+		// Anthropic rejects disable_parallel_tool_use together with "none"
+		if tc.Type != "none" {
+			tc.DisableParallelToolUse = true
+		}
+	}
+	return tc
+}
+
+// anthropicToolChoiceToOpenAI maps an Anthropic tool_choice to OpenAI tool_choice and parallel_tool_calls
+func anthropicToolChoiceToOpenAI(tc *ToolChoice) (any, *bool) {
+	if tc == nil {
+		return nil, nil
+	}
+
+	var parallel *bool
+	if tc.DisableParallelToolUse {
+		disabled := false
+		parallel = &disabled
+	}
+
+	switch tc.Type {
+	case "auto":
+		return "auto", parallel
+	case "none":
+		return "none", parallel
+	case "any":
+		return "required", parallel
+	case "tool":
+		return map[string]any{
+			"type":     "function",
+			"function": map[string]any{"name": tc.Name},
+		}, parallel
+	default:
+		return nil, parallel
+	}
+}
+
 // OpenAIToAnthropicResponse converts OpenAI chat completion response to Anthropic messages response
 func OpenAIToAnthropicResponse(openaiResp *openai.ChatCompletionResponse) *MessagesResponse {
 	if openaiResp == nil || len(openaiResp.Choices) == 0 {
@@ -108,12 +197,7 @@ func OpenAIToAnthropicResponse(openaiResp *openai.ChatCompletionResponse) *Messa
 		})
 	}
 
-	stopReason := ""
-	if choice.FinishReason == "stop" {
-		stopReason = "end_turn"
-	} else if choice.FinishReason != "" {
-		stopReason = choice.FinishReason
-	}
+	stopReason := openAIFinishToStopReason(choice.FinishReason)
 
 	usage := Usage{}
 	if openaiResp.Usage != nil {
@@ -189,8 +273,25 @@ func extractTextContent(content any) string {
 	}
 }
 
+// StreamMetrics accumulates the finish reason and token usage observed while
+// converting a stream, so they can be reported accurately at the end of it.
+type StreamMetrics struct {
+	Usage        openai.Usage
+	FinishReason string // OpenAI finish_reason ("stop", "length", "tool_calls", ...)
+	// ToolUse reports whether the open content block of a converted OpenAI stream is a
+	// tool_use block rather than text
+	ToolUse bool
+}
+
 // ConvertAnthropicStreamToOpenAI converts Anthropic SSE stream to OpenAI format
 func ConvertAnthropicStreamToOpenAI(line string, model string, id string) string {
+	return ConvertAnthropicStreamToOpenAIWithMetrics(line, model, id, nil, false)
+}
+
+// ConvertAnthropicStreamToOpenAIWithMetrics converts Anthropic SSE stream to OpenAI format while
+// recording stop reason and token usage from message_start/message_delta events into metrics
+// (may be nil). When includeUsage is set, a usage-only chunk is emitted before the [DONE] marker.
+func ConvertAnthropicStreamToOpenAIWithMetrics(line string, model string, id string, metrics *StreamMetrics, includeUsage bool) string {
 	// Parse Anthropic SSE event
 	if !isAnthropicSSE(line) {
 		return line
@@ -211,6 +312,13 @@ func ConvertAnthropicStreamToOpenAI(line string, model string, id string) string
 
 	switch eventType {
 	case "message_start":
+		if metrics != nil {
+			if msg, ok := event["message"].(map[string]interface{}); ok {
+				if u, ok := msg["usage"].(map[string]interface{}); ok {
+					metrics.Usage.PromptTokens = intFromJSON(u["input_tokens"])
+				}
+			}
+		}
 		// Initial message - create first chunk with role
 		return fmt.Sprintf("data: {\"id\":\"%s\",\"object\":\"chat.completion.chunk\",\"created\":0,\"model\":\"%s\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"\"},\"finish_reason\":null}]}\n\n", id, model)
 
@@ -231,11 +339,31 @@ func ConvertAnthropicStreamToOpenAI(line string, model string, id string) string
 		return "" // No equivalent
 
 	case "message_delta":
+		if metrics != nil {
+			if delta, ok := event["delta"].(map[string]interface{}); ok {
+				if stopReason, ok := delta["stop_reason"].(string); ok && stopReason != "" {
+					metrics.FinishReason = anthropicStopToFinishReason(stopReason)
+				}
+			}
+			if u, ok := event["usage"].(map[string]interface{}); ok {
+				metrics.Usage.CompletionTokens = intFromJSON(u["output_tokens"])
+				metrics.Usage.TotalTokens = metrics.Usage.PromptTokens + metrics.Usage.CompletionTokens
+			}
+		}
 		// Stop reason
 		return "" // Will be handled in message_stop
 
 	case "message_stop":
-		return fmt.Sprintf("data: {\"id\":\"%s\",\"object\":\"chat.completion.chunk\",\"created\":0,\"model\":\"%s\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n", id, model)
+		finishReason := "stop"
+		if metrics != nil && metrics.FinishReason != "" {
+			finishReason = metrics.FinishReason
+		}
+		finish := fmt.Sprintf("data: {\"id\":\"%s\",\"object\":\"chat.completion.chunk\",\"created\":0,\"model\":\"%s\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"%s\"}]}\n\n", id, model, finishReason)
+		if includeUsage && metrics != nil {
+			usageChunk, _ := json.Marshal(openai.NewUsageChunk(id, model, metrics.Usage))
+			finish += fmt.Sprintf("data: %s\n\n", usageChunk)
+		}
+		return finish + "data: [DONE]\n\n"
 
 	default:
 		return line
@@ -246,10 +374,21 @@ func ConvertAnthropicStreamToOpenAI(line string, model string, id string) string
 
 // ConvertOpenAIStreamToAnthropic converts OpenAI SSE stream to Anthropic format
 func ConvertOpenAIStreamToAnthropic(line string, model string, id string, isFirst *bool, blockIdx *int) string {
+	return ConvertOpenAIStreamToAnthropicWithMetrics(line, model, id, isFirst, blockIdx, nil)
+}
+
+// ConvertOpenAIStreamToAnthropicWithMetrics converts OpenAI SSE stream to Anthropic format.
+// When metrics is non-nil, the message_delta event is deferred until the [DONE] marker so that
+// it can carry the real stop reason and the token usage from a trailing usage-only chunk.
+func ConvertOpenAIStreamToAnthropicWithMetrics(line string, model string, id string, isFirst *bool, blockIdx *int, metrics *StreamMetrics) string {
 	data := extractSSEData(line)
 	if data == "" || data == "[DONE]" {
 		if data == "[DONE]" {
-			return fmt.Sprintf("event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n")
+			stop := "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"
+			if metrics != nil {
+				return messageDeltaEvent(metrics.FinishReason, metrics.Usage.CompletionTokens) + stop
+			}
+			return stop
 		}
 		return line
 	}
@@ -259,6 +398,10 @@ func ConvertOpenAIStreamToAnthropic(line string, model string, id string, isFirs
 		return line
 	}
 
+	if metrics != nil && chunk.Usage != nil {
+		metrics.Usage = *chunk.Usage
+	}
+
 	if len(chunk.Choices) == 0 {
 		return ""
 	}
@@ -277,21 +420,108 @@ func ConvertOpenAIStreamToAnthropic(line string, model string, id string, isFirs
 		*blockIdx = 0
 	}
 
-	// Content delta
+	// Without metrics the open block is tracked for this line only
+	blocks := metrics
+	if blocks == nil {
+		blocks = &StreamMetrics{}
+	}
+
+	// Content delta, in a new text block when a tool_use block is open
 	if choice.Delta.Content != "" {
+		if blocks.ToolUse {
+			events = append(events, fmt.Sprintf("event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":%d}\n\n", *blockIdx))
+			*blockIdx++
+			events = append(events, fmt.Sprintf("event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":%d,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}\n\n", *blockIdx))
+			blocks.ToolUse = false
+		}
 		escaped, _ := json.Marshal(choice.Delta.Content)
 		events = append(events, fmt.Sprintf("event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":%d,\"delta\":{\"type\":\"text_delta\",\"text\":%s}}\n\n", *blockIdx, string(escaped)))
 	}
 
-	// Finish reason - end message
+	// Tool call deltas: the first fragment of a call (with its id or name) opens a tool_use
+	// block, and argument fragments follow as input_json_delta
+	for _, tc := range choice.Delta.ToolCalls {
+		var name, arguments string
+		if tc.Function != nil {
+			name, arguments = tc.Function.Name, tc.Function.Arguments
+		}
+		if tc.ID != "" || name != "" {
+			toolID := tc.ID
+			if toolID == "" {
+				toolID = fmt.Sprintf("toolu_%s_%d", id, tc.Index)
+			}
+			escapedID, _ := json.Marshal(toolID)
+			escapedName, _ := json.Marshal(name)
+			events = append(events, fmt.Sprintf("event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":%d}\n\n", *blockIdx))
+			*blockIdx++
+			events = append(events, fmt.Sprintf("event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":%d,\"content_block\":{\"type\":\"tool_use\",\"id\":%s,\"name\":%s,\"input\":{}}}\n\n", *blockIdx, escapedID, escapedName))
+			blocks.ToolUse = true
+		}
+		if arguments != "" && blocks.ToolUse {
+			escaped, _ := json.Marshal(arguments)
+			events = append(events, fmt.Sprintf("event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":%d,\"delta\":{\"type\":\"input_json_delta\",\"partial_json\":%s}}\n\n", *blockIdx, string(escaped)))
+		}
+	}
+
+	// Finish reason - close the content block and report the stop reason.
+	// message_stop itself is emitted when the [DONE] marker arrives.
 	if choice.FinishReason != nil && *choice.FinishReason != "" {
 		events = append(events, fmt.Sprintf("event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":%d}\n\n", *blockIdx))
-		events = append(events, "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n")
+		if metrics != nil {
+			metrics.FinishReason = *choice.FinishReason
+		} else {
+			events = append(events, messageDeltaEvent(*choice.FinishReason, 0))
+		}
 	}
 
 	return joinEvents(events)
 }
 
+// messageDeltaEvent builds an Anthropic message_delta event from an OpenAI finish_reason
+func messageDeltaEvent(finishReason string, outputTokens int) string {
+	stopReason := openAIFinishToStopReason(finishReason)
+	if stopReason == "" {
+		stopReason = "end_turn"
+	}
+	return fmt.Sprintf("event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"%s\"},\"usage\":{\"output_tokens\":%d}}\n\n", stopReason, outputTokens)
+}
+
+// anthropicStopToFinishReason maps an Anthropic stop_reason to an OpenAI finish_reason
+func anthropicStopToFinishReason(stopReason string) string {
+	switch stopReason {
+	case "end_turn", "stop_sequence":
+		return "stop"
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	default:
+		return stopReason
+	}
+}
+
+// openAIFinishToStopReason maps an OpenAI finish_reason to an Anthropic stop_reason
+func openAIFinishToStopReason(finishReason string) string {
+	switch finishReason {
+	case "stop":
+		return "end_turn"
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	default:
+		return finishReason
+	}
+}
+
+// intFromJSON converts a decoded JSON number to int (0 when absent or not a number)
+func intFromJSON(v any) int {
+	if f, ok := v.(float64); ok {
+		return int(f)
+	}
+	return 0
+}
+
 func isAnthropicSSE(line string) bool {
 	return len(line) > 6 && (line[:6] == "event:" || line[:5] == "data:")
 }
@@ -1,10 +1,14 @@
 package anthropic
 
 import (
+	"encoding/json"
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/macedot/openmodel/internal/api/openai"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestOpenAIToAnthropicRequest(t *testing.T) {
@@ -212,3 +216,184 @@ func TestExtractSSEData(t *testing.T) {
 	// Non-data lines are returned unchanged
 	assert.Equal(t, "event: test", extractSSEData("event: test"))
 }
+
+func TestParseMessagesRequest_SystemBlocks(t *testing.T) {
+	body := []byte(`{"model":"claude-3","system":[{"type":"text","text":"You are "},{"type":"text","text":"helpful."}],"messages":[{"role":"user","content":"hi"}]}`)
+
+	req, err := ParseMessagesRequest(body)
+	require.NoError(t, err)
+	assert.Equal(t, "You are helpful.", req.System)
+	assert.Equal(t, "claude-3", req.Model)
+	require.Len(t, req.Messages, 1)
+
+	req, err = ParseMessagesRequest([]byte(`{"model":"claude-3","system":"plain","messages":[]}`))
+	require.NoError(t, err)
+	assert.Equal(t, "plain", req.System)
+}
+
+func TestConvertOpenAIStreamToAnthropic_StopReason(t *testing.T) {
+	isFirst := false
+	blockIdx := 0
+
+	chunk := `data: {"id":"chatcmpl-1","object":"chat.completion.chunk","created":0,"model":"gpt-4","choices":[{"index":0,"delta":{},"finish_reason":"length"}]}`
+	result := ConvertOpenAIStreamToAnthropic(chunk, "claude-3-opus", "msg-123", &isFirst, &blockIdx)
+	assert.Contains(t, result, `"type":"content_block_stop"`)
+	assert.Contains(t, result, `"stop_reason":"max_tokens"`)
+	assert.NotContains(t, result, `"type":"message_stop"`)
+}
+
+func TestConvertAnthropicStreamToOpenAIWithMetrics(t *testing.T) {
+	metrics := &StreamMetrics{}
+
+	ConvertAnthropicStreamToOpenAIWithMetrics(`data: {"type":"message_start","message":{"id":"msg-1","usage":{"input_tokens":12,"output_tokens":0}}}`, "gpt-4", "id", metrics, true)
+	ConvertAnthropicStreamToOpenAIWithMetrics(`data: {"type":"message_delta","delta":{"stop_reason":"max_tokens"},"usage":{"output_tokens":5}}`, "gpt-4", "id", metrics, true)
+	result := ConvertAnthropicStreamToOpenAIWithMetrics(`data: {"type":"message_stop"}`, "gpt-4", "id", metrics, true)
+
+	assert.Equal(t, openai.Usage{PromptTokens: 12, CompletionTokens: 5, TotalTokens: 17}, metrics.Usage)
+	assert.Contains(t, result, `"finish_reason":"length"`)
+	assert.Contains(t, result, `"usage":{"prompt_tokens":12,"completion_tokens":5,"total_tokens":17}`)
+	assert.Less(t, strings.Index(result, `"usage"`), strings.Index(result, "[DONE]"))
+}
+
+func TestConvertOpenAIStreamToAnthropicWithMetrics(t *testing.T) {
+	isFirst := false
+	blockIdx := 0
+	metrics := &StreamMetrics{}
+
+	finish := `data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`
+	result := ConvertOpenAIStreamToAnthropicWithMetrics(finish, "claude", "msg-1", &isFirst, &blockIdx, metrics)
+	assert.Contains(t, result, `"type":"content_block_stop"`)
+	assert.NotContains(t, result, `"type":"message_delta"`)
+
+	usageChunk := `data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4","choices":[],"usage":{"prompt_tokens":4,"completion_tokens":9,"total_tokens":13}}`
+	assert.Empty(t, ConvertOpenAIStreamToAnthropicWithMetrics(usageChunk, "claude", "msg-1", &isFirst, &blockIdx, metrics))
+
+	result = ConvertOpenAIStreamToAnthropicWithMetrics("data: [DONE]", "claude", "msg-1", &isFirst, &blockIdx, metrics)
+	assert.Contains(t, result, `"stop_reason":"tool_use"`)
+	assert.Contains(t, result, `"output_tokens":9`)
+	assert.Less(t, strings.Index(result, "message_delta"), strings.Index(result, "message_stop"))
+}
+
+func TestConvertOpenAIStreamToAnthropic_ToolCalls(t *testing.T) {
+	isFirst := true
+	blockIdx := 0
+	metrics := &StreamMetrics{}
+
+	lines := []string{
+		`data: {"id":"c1","choices":[{"index":0,"delta":{"role":"assistant","content":"Checking."}}]}`,
+		`data: {"id":"c1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}`,
+		`data: {"id":"c1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}]}`,
+		`data: {"id":"c1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]}}]}`,
+		`data: {"id":"c1","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"function":{"name":"get_time","arguments":"{}"}}]}}]}`,
+		`data: {"id":"c1","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		"data: [DONE]",
+	}
+	var events []map[string]any
+	for _, line := range lines {
+		out := ConvertOpenAIStreamToAnthropicWithMetrics(line, "claude", "msg-1", &isFirst, &blockIdx, metrics)
+		for _, event := range strings.Split(out, "\n") {
+			if data, ok := strings.CutPrefix(event, "data: "); ok {
+				var e map[string]any
+				require.NoError(t, json.Unmarshal([]byte(data), &e), data)
+				events = append(events, e)
+			}
+		}
+	}
+
+	var summary []string
+	for _, e := range events {
+		switch e["type"] {
+		case "content_block_start":
+			block := e["content_block"].(map[string]any)
+			summary = append(summary, fmt.Sprintf("start %v %v %v %v", e["index"], block["type"], block["id"], block["name"]))
+		case "content_block_delta":
+			delta := e["delta"].(map[string]any)
+			summary = append(summary, fmt.Sprintf("delta %v %v%v", e["index"], delta["text"], delta["partial_json"]))
+		case "content_block_stop":
+			summary = append(summary, fmt.Sprintf("stop %v", e["index"]))
+		case "message_delta":
+			summary = append(summary, fmt.Sprintf("message_delta %v", e["delta"].(map[string]any)["stop_reason"]))
+		default:
+			summary = append(summary, e["type"].(string))
+		}
+	}
+	assert.Equal(t, []string{
+		"message_start",
+		"start 0 text <nil> <nil>",
+		"delta 0 Checking.<nil>",
+		"stop 0",
+		"start 1 tool_use call_1 get_weather",
+		"delta 1 <nil>{\"city\":",
+		"delta 1 <nil>\"Paris\"}",
+		"stop 1",
+		"start 2 tool_use toolu_msg-1_1 get_time",
+		"delta 2 <nil>{}",
+		"stop 2",
+		"message_delta tool_use",
+		"message_stop",
+	}, summary)
+}
+
+func TestToolChoiceConversion(t *testing.T) {
+	disabled := false
+
+	tests := []struct {
+		name      string
+		choice    any
+		parallel  *bool
+		expected  *ToolChoice
+		roundTrip any
+	}{
+		{name: "unset", expected: nil},
+		{name: "auto", choice: "auto", expected: &ToolChoice{Type: "auto"}, roundTrip: "auto"},
+		{name: "none", choice: "none", expected: &ToolChoice{Type: "none"}, roundTrip: "none"},
+		{name: "required", choice: "required", expected: &ToolChoice{Type: "any"}, roundTrip: "required"},
+		{
+			name:      "specific function",
+			choice:    map[string]any{"type": "function", "function": map[string]any{"name": "get_weather"}},
+			expected:  &ToolChoice{Type: "tool", Name: "get_weather"},
+			roundTrip: map[string]any{"type": "function", "function": map[string]any{"name": "get_weather"}},
+		},
+		{name: "parallel disabled without choice", parallel: &disabled, expected: &ToolChoice{Type: "auto", DisableParallelToolUse: true}, roundTrip: "auto"},
+		{name: "parallel disabled with required", choice: "required", parallel: &disabled, expected: &ToolChoice{Type: "any", DisableParallelToolUse: true}, roundTrip: "required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := openAIToolChoiceToAnthropic(tt.choice, tt.parallel)
+			assert.Equal(t, tt.expected, tc)
+
+			choice, parallel := anthropicToolChoiceToOpenAI(tc)
+			assert.Equal(t, tt.roundTrip, choice)
+			if tc != nil && tc.DisableParallelToolUse {
+				require.NotNil(t, parallel)
+				assert.False(t, *parallel)
+			} else {
+				assert.Nil(t, parallel)
+			}
+		})
+	}
+}
+
+func TestOpenAIToAnthropicRequest_Tools(t *testing.T) {
+	body := []byte(`{"model":"gpt-4","messages":[{"role":"user","content":"weather?"}],
+		"tools":[{"type":"function","function":{"name":"get_weather","description":"Look up weather","parameters":{"type":"object"}}}],
+		"tool_choice":"required","parallel_tool_calls":false}`)
+
+	openaiReq, err := openai.ParseChatCompletionRequest(body)
+	require.NoError(t, err)
+	assert.NotContains(t, openaiReq.Extra, "parallel_tool_calls")
+
+	anthropicReq := OpenAIToAnthropicRequest(openaiReq)
+	require.Len(t, anthropicReq.Tools, 1)
+	assert.Equal(t, "get_weather", anthropicReq.Tools[0].Name)
+	assert.Equal(t, map[string]any{"type": "object"}, anthropicReq.Tools[0].InputSchema)
+	assert.Equal(t, &ToolChoice{Type: "any", DisableParallelToolUse: true}, anthropicReq.ToolChoice)
+
+	back := AnthropicToOpenAIRequest(anthropicReq)
+	require.Len(t, back.Tools, 1)
+	assert.Equal(t, "function", back.Tools[0].Type)
+	assert.Equal(t, "required", back.ToolChoice)
+	require.NotNil(t, back.ParallelToolCalls)
+	assert.False(t, *back.ParallelToolCalls)
+}
@@ -26,15 +26,31 @@ type ContentSource struct {
 
 // MessagesRequest is sent to /v1/messages
 type MessagesRequest struct {
-	Model       string    `json:"model"`
-	Messages    []Message `json:"messages"`
-	MaxTokens   int       `json:"max_tokens,omitempty"`
-	Stream      bool      `json:"stream,omitempty"`
-	Temperature *float64  `json:"temperature,omitempty"`
-	TopP        *float64  `json:"top_p,omitempty"`
-	TopK        *int      `json:"top_k,omitempty"`
-	System      string    `json:"system,omitempty"`
-	Stop        []string  `json:"stop_sequences,omitempty"`
+	Model       string      `json:"model"`
+	Messages    []Message   `json:"messages"`
+	MaxTokens   int         `json:"max_tokens,omitempty"`
+	Stream      bool        `json:"stream,omitempty"`
+	Temperature *float64    `json:"temperature,omitempty"`
+	TopP        *float64    `json:"top_p,omitempty"`
+	TopK        *int        `json:"top_k,omitempty"`
+	System      string      `json:"system,omitempty"`
+	Stop        []string    `json:"stop_sequences,omitempty"`
+	Tools       []Tool      `json:"tools,omitempty"`
+	ToolChoice  *ToolChoice `json:"tool_choice,omitempty"`
+}
+
+// Tool describes a client tool the model may call
+type Tool struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	InputSchema any    `json:"input_schema"`
+}
+
+// ToolChoice constrains how the model uses the provided tools
+type ToolChoice struct {
+	Type                   string `json:"type"`           // "auto" | "any" | "tool" | "none"
+	Name                   string `json:"name,omitempty"` // Tool name when Type is "tool"
+	DisableParallelToolUse bool   `json:"disable_parallel_tool_use,omitempty"`
 }
 
 // MessagesResponse is returned from /v1/messages
@@ -113,6 +129,30 @@ func (e *ErrorResponse) Error() string {
 	return e.ErrorDetail.Message
 }
 
+// UnmarshalJSON accepts the system prompt either as a plain string or as an
+// array of text content blocks, flattening the latter into a single string.
+func (r *MessagesRequest) UnmarshalJSON(data []byte) error {
+	type Alias MessagesRequest
+	aux := struct {
+		*Alias
+		System json.RawMessage `json:"system,omitempty"`
+	}{Alias: (*Alias)(r)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	r.System = ""
+	if len(aux.System) == 0 || string(aux.System) == "null" {
+		return nil
+	}
+	var system any
+	if err := json.Unmarshal(aux.System, &system); err != nil {
+		return err
+	}
+	r.System = extractTextContent(system)
+	return nil
+}
+
 // ParseMessagesRequest parses raw JSON into MessagesRequest
 func ParseMessagesRequest(data []byte) (*MessagesRequest, error) {
 	var req MessagesRequest
@@ -0,0 +1,244 @@
+// Package cohere provides conversion between OpenAI and Cohere v2 formats
+package cohere
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/macedot/openmodel/internal/api/openai"
+)
+
+// DefaultInputType is the embed input_type used when the request does not set one
+const DefaultInputType = "search_document"
+
+// OpenAIToCohereRequest converts an OpenAI chat completion request to a Cohere chat request.
+// Message names and logit bias have no Cohere equivalent and are dropped.
+func OpenAIToCohereRequest(req *openai.ChatCompletionRequest) *ChatRequest {
+	cohereReq := &ChatRequest{
+		Model:            req.Model,
+		Stream:           req.Stream,
+		MaxTokens:        req.MaxTokens,
+		StopSequences:    req.Stop,
+		Temperature:      req.Temperature,
+		P:                req.TopP,
+		Seed:             req.Seed,
+		FrequencyPenalty: req.FrequencyPenalty,
+		PresencePenalty:  req.PresencePenalty,
+		Messages:         make([]Message, 0, len(req.Messages)),
+	}
+
+	for _, msg := range req.Messages {
+		m := Message{Role: msg.Role, Content: msg.Content, ToolCallID: msg.ToolCallID}
+		for _, call := range msg.ToolCalls {
+			m.ToolCalls = append(m.ToolCalls, ToolCall{
+				ID:       call.ID,
+				Type:     "function",
+				Function: ToolFunction{Name: call.Function.Name, Arguments: call.Function.Arguments},
+			})
+		}
+		cohereReq.Messages = append(cohereReq.Messages, m)
+	}
+
+	if rf := req.ResponseFormat; rf != nil && rf.Type != "text" {
+		cohereReq.ResponseFormat = &ResponseFormat{Type: "json_object"}
+		if schema, ok := rf.JSONSchema.(map[string]any); ok {
+			cohereReq.ResponseFormat.JSONSchema = schema["schema"]
+		}
+	}
+
+	forced := forcedToolName(req.ToolChoice)
+	for _, tool := range req.Tools {
+		if forced != "" && tool.Function.Name != forced {
+			continue
+		}
+		cohereReq.Tools = append(cohereReq.Tools, Tool{
+			Type: "function",
+			Function: ToolDefinition{
+				Name:        tool.Function.Name,
+				Description: tool.Function.Description,
+				Parameters:  tool.Function.Parameters,
+			},
+		})
+	}
+	if len(cohereReq.Tools) > 0 {
+		switch {
+		case req.ToolChoice == "required", forced != "":
+			cohereReq.ToolChoice = "REQUIRED"
+		case req.ToolChoice == "none":
+			cohereReq.ToolChoice = "NONE"
+		}
+	}
+
+	return cohereReq
+}
+
+// forcedToolName returns the function an OpenAI tool_choice object forces, if any. Cohere
+// cannot name the tool to call, so only that tool is offered.
+func forcedToolName(choice any) string {
+	obj, ok := choice.(map[string]any)
+	if !ok {
+		return ""
+	}
+	function, _ := obj["function"].(map[string]any)
+	name, _ := function["name"].(string)
+	return name
+}
+
+// CohereToOpenAIResponse converts a Cohere chat response to an OpenAI chat completion response
+func CohereToOpenAIResponse(resp *ChatResponse, model string) *openai.ChatCompletionResponse {
+	var content strings.Builder
+	for _, block := range resp.Message.Content {
+		if block.Type == "text" {
+			content.WriteString(block.Text)
+		}
+	}
+
+	message := &openai.ChatCompletionMessage{Role: "assistant", Content: content.String()}
+	for _, call := range resp.Message.ToolCalls {
+		message.ToolCalls = append(message.ToolCalls, openai.ToolCall{
+			ID:       call.ID,
+			Type:     "function",
+			Function: openai.ToolCallFunction{Name: call.Function.Name, Arguments: call.Function.Arguments},
+		})
+	}
+
+	return &openai.ChatCompletionResponse{
+		ID:     resp.ID,
+		Object: "chat.completion",
+		Model:  model,
+		Choices: []openai.ChatCompletionChoice{{
+			Index:        0,
+			Message:      message,
+			FinishReason: finishReason(resp.FinishReason),
+		}},
+		Usage: convertUsage(resp.Usage),
+	}
+}
+
+// finishReason maps a Cohere finish_reason to an OpenAI finish_reason
+func finishReason(reason string) string {
+	switch reason {
+	case "COMPLETE", "STOP_SEQUENCE", "":
+		return "stop"
+	case "MAX_TOKENS":
+		return "length"
+	case "TOOL_CALL":
+		return "tool_calls"
+	default:
+		return strings.ToLower(reason)
+	}
+}
+
+// convertUsage converts Cohere usage to OpenAI usage, preferring the tokens the model saw
+// over the billed ones
+func convertUsage(usage *Usage) *openai.Usage {
+	if usage == nil {
+		return nil
+	}
+	tokens := usage.Tokens
+	if tokens == nil {
+		tokens = usage.BilledUnits
+	}
+	if tokens == nil {
+		return nil
+	}
+	prompt, completion := int(tokens.InputTokens), int(tokens.OutputTokens)
+	return &openai.Usage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion}
+}
+
+// StreamState carries what a stream conversion needs across events
+type StreamState struct {
+	ID    string // Chunk id, taken from message-start when not set
+	Model string
+}
+
+// ConvertStreamEvent converts the data of a /v2/chat stream event to OpenAI chunks. done
+// reports the end of the message; the final chunk carries the finish reason and usage.
+// Events without an OpenAI equivalent (content-start, tool-plan-delta, ...) give no chunk.
+func ConvertStreamEvent(data string, state *StreamState) (chunks []openai.ChatCompletionChunk, done bool) {
+	var event StreamEvent
+	if err := json.Unmarshal([]byte(data), &event); err != nil || event.Delta == nil {
+		return nil, false
+	}
+	delta, msg := event.Delta, event.Delta.Message
+
+	switch event.Type {
+	case "message-start":
+		if state.ID == "" {
+			state.ID = event.ID
+		}
+		return []openai.ChatCompletionChunk{state.chunk(openai.ChatCompletionDelta{Role: "assistant"}, nil)}, false
+
+	case "content-delta":
+		if msg == nil || msg.Content == nil || msg.Content.Text == "" {
+			return nil, false
+		}
+		return []openai.ChatCompletionChunk{state.chunk(openai.ChatCompletionDelta{Content: msg.Content.Text}, nil)}, false
+
+	case "tool-call-start", "tool-call-delta":
+		if msg == nil || msg.ToolCalls == nil {
+			return nil, false
+		}
+		call := openai.ChatToolCallDelta{
+			Index:    event.Index,
+			Function: &openai.ToolCallFunctionDelta{Name: msg.ToolCalls.Function.Name, Arguments: msg.ToolCalls.Function.Arguments},
+		}
+		if event.Type == "tool-call-start" {
+			call.ID, call.Type = msg.ToolCalls.ID, "function"
+		}
+		return []openai.ChatCompletionChunk{state.chunk(openai.ChatCompletionDelta{ToolCalls: []openai.ChatToolCallDelta{call}}, nil)}, false
+
+	case "message-end":
+		reason := finishReason(delta.FinishReason)
+		chunk := state.chunk(openai.ChatCompletionDelta{}, &reason)
+		chunk.Usage = convertUsage(delta.Usage)
+		return []openai.ChatCompletionChunk{chunk}, true
+	}
+	return nil, false
+}
+
+// chunk builds a single-choice chat.completion.chunk
+func (s *StreamState) chunk(delta openai.ChatCompletionDelta, finishReason *string) openai.ChatCompletionChunk {
+	return openai.ChatCompletionChunk{
+		ID:     s.ID,
+		Object: "chat.completion.chunk",
+		Model:  s.Model,
+		Choices: []openai.ChatCompletionChunkChoice{{
+			Index:        0,
+			Delta:        delta,
+			FinishReason: finishReason,
+		}},
+	}
+}
+
+// OpenAIToCohereEmbed builds a Cohere embed request for float embeddings
+func OpenAIToCohereEmbed(model string, texts []string, inputType string, dimensions int) *EmbedRequest {
+	if inputType == "" {
+		inputType = DefaultInputType
+	}
+	return &EmbedRequest{
+		Model:          model,
+		Texts:          texts,
+		InputType:      inputType,
+		EmbeddingTypes: []string{"float"},
+		OutputDim:      dimensions,
+	}
+}
+
+// CohereToOpenAIEmbed converts a Cohere embed response to an OpenAI embedding response
+func CohereToOpenAIEmbed(resp *EmbedResponse, model string) *openai.EmbeddingResponse {
+	out := &openai.EmbeddingResponse{
+		Object: "list",
+		Model:  model,
+		Data:   make([]openai.EmbeddingData, 0, len(resp.Embeddings.Float)),
+		Usage:  &openai.Usage{},
+	}
+	for i, embedding := range resp.Embeddings.Float {
+		out.Data = append(out.Data, openai.EmbeddingData{Object: "embedding", Index: i, Embedding: embedding})
+	}
+	if resp.Meta != nil && resp.Meta.BilledUnits != nil {
+		out.Usage.PromptTokens = int(resp.Meta.BilledUnits.InputTokens)
+		out.Usage.TotalTokens = out.Usage.PromptTokens
+	}
+	return out
+}
@@ -0,0 +1,134 @@
+package cohere
+
+import (
+	"testing"
+
+	"github.com/macedot/openmodel/internal/api/openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAIToCohereRequest(t *testing.T) {
+	topP := 0.9
+	maxTokens := 100
+	req := &openai.ChatCompletionRequest{
+		Model:     "command-r",
+		TopP:      &topP,
+		MaxTokens: &maxTokens,
+		Stop:      []string{"END"},
+		Messages: []openai.ChatCompletionMessage{
+			{Role: "system", Content: "Be brief."},
+			{Role: "user", Content: "Weather?", Name: "alice"},
+			{Role: "assistant", ToolCalls: []openai.ToolCall{{ID: "call_1", Type: "function", Function: openai.ToolCallFunction{Name: "weather", Arguments: `{"city":"Paris"}`}}}},
+			{Role: "tool", Content: "sunny", ToolCallID: "call_1"},
+		},
+		Tools: []openai.Tool{
+			{Type: "function", Function: openai.ToolFunction{Name: "weather"}},
+			{Type: "function", Function: openai.ToolFunction{Name: "time"}},
+		},
+		ToolChoice:     map[string]any{"type": "function", "function": map[string]any{"name": "weather"}},
+		ResponseFormat: &openai.ResponseFormat{Type: "json_schema", JSONSchema: map[string]any{"name": "w", "schema": map[string]any{"type": "object"}}},
+	}
+
+	cohereReq := OpenAIToCohereRequest(req)
+
+	assert.Equal(t, "command-r", cohereReq.Model)
+	assert.Equal(t, &topP, cohereReq.P)
+	assert.Equal(t, &maxTokens, cohereReq.MaxTokens)
+	assert.Equal(t, []string{"END"}, cohereReq.StopSequences)
+	require.Len(t, cohereReq.Messages, 4)
+	assert.Equal(t, Message{Role: "system", Content: "Be brief."}, cohereReq.Messages[0])
+	assert.Equal(t, Message{Role: "user", Content: "Weather?"}, cohereReq.Messages[1], "names are dropped")
+	assert.Equal(t, []ToolCall{{ID: "call_1", Type: "function", Function: ToolFunction{Name: "weather", Arguments: `{"city":"Paris"}`}}}, cohereReq.Messages[2].ToolCalls)
+	assert.Equal(t, "call_1", cohereReq.Messages[3].ToolCallID)
+	require.Len(t, cohereReq.Tools, 1, "a forced tool is the only one offered")
+	assert.Equal(t, "weather", cohereReq.Tools[0].Function.Name)
+	assert.Equal(t, "REQUIRED", cohereReq.ToolChoice)
+	assert.Equal(t, &ResponseFormat{Type: "json_object", JSONSchema: map[string]any{"type": "object"}}, cohereReq.ResponseFormat)
+}
+
+func TestCohereToOpenAIResponse(t *testing.T) {
+	resp := &ChatResponse{
+		ID:           "c1",
+		FinishReason: "TOOL_CALL",
+		Message: AssistantMessage{
+			Role:      "assistant",
+			Content:   []ContentBlock{{Type: "text", Text: "Let me "}, {Type: "text", Text: "check."}},
+			ToolCalls: []ToolCall{{ID: "call_1", Type: "function", Function: ToolFunction{Name: "weather", Arguments: `{}`}}},
+		},
+		Usage: &Usage{BilledUnits: &Tokens{InputTokens: 9, OutputTokens: 4}, Tokens: &Tokens{InputTokens: 20, OutputTokens: 4}},
+	}
+
+	out := CohereToOpenAIResponse(resp, "command-r")
+
+	assert.Equal(t, "c1", out.ID)
+	assert.Equal(t, "command-r", out.Model)
+	require.Len(t, out.Choices, 1)
+	assert.Equal(t, "Let me check.", out.Choices[0].Message.Content)
+	assert.Equal(t, "tool_calls", out.Choices[0].FinishReason)
+	require.Len(t, out.Choices[0].Message.ToolCalls, 1)
+	assert.Equal(t, "weather", out.Choices[0].Message.ToolCalls[0].Function.Name)
+	assert.Equal(t, &openai.Usage{PromptTokens: 20, CompletionTokens: 4, TotalTokens: 24}, out.Usage)
+}
+
+func TestFinishReason(t *testing.T) {
+	tests := map[string]string{
+		"COMPLETE":      "stop",
+		"STOP_SEQUENCE": "stop",
+		"MAX_TOKENS":    "length",
+		"TOOL_CALL":     "tool_calls",
+		"ERROR":         "error",
+	}
+	for in, want := range tests {
+		assert.Equal(t, want, finishReason(in), in)
+	}
+}
+
+func TestConvertStreamEvent(t *testing.T) {
+	state := &StreamState{Model: "command-r"}
+	events := []string{
+		`{"type":"message-start","id":"c1","delta":{"message":{"role":"assistant"}}}`,
+		`{"type":"content-start","index":0,"delta":{"message":{"content":{"type":"text","text":""}}}}`,
+		`{"type":"content-delta","index":0,"delta":{"message":{"content":{"text":"Hi"}}}}`,
+		`{"type":"tool-call-start","index":0,"delta":{"message":{"tool_calls":{"id":"call_1","type":"function","function":{"name":"weather","arguments":""}}}}}`,
+		`{"type":"tool-call-delta","index":0,"delta":{"message":{"tool_calls":{"function":{"arguments":"{}"}}}}}`,
+		`{"type":"content-end","index":0}`,
+		`{"type":"message-end","delta":{"finish_reason":"MAX_TOKENS","usage":{"tokens":{"input_tokens":3,"output_tokens":1}}}}`,
+	}
+
+	var chunks []openai.ChatCompletionChunk
+	done := false
+	for _, event := range events {
+		require.False(t, done, "no event after message-end")
+		var c []openai.ChatCompletionChunk
+		c, done = ConvertStreamEvent(event, state)
+		chunks = append(chunks, c...)
+	}
+
+	assert.True(t, done)
+	require.Len(t, chunks, 5)
+	for _, c := range chunks {
+		assert.Equal(t, "c1", c.ID)
+		assert.Equal(t, "command-r", c.Model)
+	}
+	assert.Equal(t, "assistant", chunks[0].Choices[0].Delta.Role)
+	assert.Equal(t, "Hi", chunks[1].Choices[0].Delta.Content)
+	assert.Equal(t, openai.ChatToolCallDelta{Index: 0, ID: "call_1", Type: "function", Function: &openai.ToolCallFunctionDelta{Name: "weather"}}, chunks[2].Choices[0].Delta.ToolCalls[0])
+	assert.Equal(t, "{}", chunks[3].Choices[0].Delta.ToolCalls[0].Function.Arguments)
+	require.NotNil(t, chunks[4].Choices[0].FinishReason)
+	assert.Equal(t, "length", *chunks[4].Choices[0].FinishReason)
+	assert.Equal(t, &openai.Usage{PromptTokens: 3, CompletionTokens: 1, TotalTokens: 4}, chunks[4].Usage)
+}
+
+func TestCohereToOpenAIEmbed(t *testing.T) {
+	resp := &EmbedResponse{ID: "e1"}
+	resp.Embeddings.Float = [][]float64{{0.1, 0.2}, {0.3, 0.4}}
+
+	out := CohereToOpenAIEmbed(resp, "embed-v4.0")
+
+	assert.Equal(t, "list", out.Object)
+	require.Len(t, out.Data, 2)
+	assert.Equal(t, 1, out.Data[1].Index)
+	assert.Equal(t, []float64{0.3, 0.4}, out.Data[1].Embedding)
+	assert.Equal(t, DefaultInputType, OpenAIToCohereEmbed("embed-v4.0", []string{"a"}, "", 0).InputType)
+}
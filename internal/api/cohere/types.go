@@ -0,0 +1,149 @@
+// Package cohere defines types for the Cohere v2 API
+package cohere
+
+// Message represents a message in the messages array
+type Message struct {
+	Role       string     `json:"role"`                   // "system", "user", "assistant" or "tool"
+	Content    string     `json:"content,omitempty"`      // Text content
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`   // Calls made by an assistant message
+	ToolCallID string     `json:"tool_call_id,omitempty"` // Call answered by a tool message
+}
+
+// ToolCall is a function call made by the model
+type ToolCall struct {
+	ID       string       `json:"id,omitempty"`
+	Type     string       `json:"type,omitempty"` // "function"
+	Function ToolFunction `json:"function"`
+}
+
+// ToolFunction is the function and JSON-encoded arguments of a tool call
+type ToolFunction struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+}
+
+// Tool describes a function the model may call
+type Tool struct {
+	Type     string         `json:"type"` // "function"
+	Function ToolDefinition `json:"function"`
+}
+
+// ToolDefinition defines a function tool
+type ToolDefinition struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+}
+
+// ResponseFormat constrains the response to JSON
+type ResponseFormat struct {
+	Type       string `json:"type"` // "text" or "json_object"
+	JSONSchema any    `json:"json_schema,omitempty"`
+}
+
+// ChatRequest is sent to /v2/chat
+type ChatRequest struct {
+	Model            string          `json:"model"`
+	Messages         []Message       `json:"messages"`
+	Stream           bool            `json:"stream,omitempty"`
+	MaxTokens        *int            `json:"max_tokens,omitempty"`
+	StopSequences    []string        `json:"stop_sequences,omitempty"`
+	Temperature      *float64        `json:"temperature,omitempty"`
+	P                *float64        `json:"p,omitempty"` // Nucleus sampling (OpenAI top_p)
+	Seed             *int            `json:"seed,omitempty"`
+	FrequencyPenalty *float64        `json:"frequency_penalty,omitempty"`
+	PresencePenalty  *float64        `json:"presence_penalty,omitempty"`
+	ResponseFormat   *ResponseFormat `json:"response_format,omitempty"`
+	Tools            []Tool          `json:"tools,omitempty"`
+	ToolChoice       string          `json:"tool_choice,omitempty"` // "REQUIRED" or "NONE"
+}
+
+// ContentBlock is a block of assistant content
+type ContentBlock struct {
+	Type string `json:"type"` // "text"
+	Text string `json:"text,omitempty"`
+}
+
+// AssistantMessage is the message of a chat response
+type AssistantMessage struct {
+	Role      string         `json:"role"`
+	Content   []ContentBlock `json:"content,omitempty"`
+	ToolPlan  string         `json:"tool_plan,omitempty"`
+	ToolCalls []ToolCall     `json:"tool_calls,omitempty"`
+}
+
+// Tokens counts input and output tokens
+type Tokens struct {
+	InputTokens  float64 `json:"input_tokens"`
+	OutputTokens float64 `json:"output_tokens"`
+}
+
+// Usage contains token usage information; Tokens are the tokens the model saw, BilledUnits
+// those charged
+type Usage struct {
+	BilledUnits *Tokens `json:"billed_units,omitempty"`
+	Tokens      *Tokens `json:"tokens,omitempty"`
+}
+
+// ChatResponse is returned from /v2/chat
+type ChatResponse struct {
+	ID           string           `json:"id"`
+	FinishReason string           `json:"finish_reason"` // "COMPLETE", "MAX_TOKENS", "STOP_SEQUENCE", "TOOL_CALL" or "ERROR"
+	Message      AssistantMessage `json:"message"`
+	Usage        *Usage           `json:"usage,omitempty"`
+}
+
+// StreamEvent is an event of a /v2/chat stream. Delta carries what the event type adds.
+type StreamEvent struct {
+	Type  string       `json:"type"` // "message-start", "content-delta", "tool-call-start", "message-end", ...
+	ID    string       `json:"id,omitempty"`
+	Index int          `json:"index"`
+	Delta *StreamDelta `json:"delta,omitempty"`
+}
+
+// StreamDelta is the delta of a stream event
+type StreamDelta struct {
+	Message      *StreamMessage `json:"message,omitempty"`
+	FinishReason string         `json:"finish_reason,omitempty"`
+	Usage        *Usage         `json:"usage,omitempty"`
+}
+
+// StreamMessage is the message part of a stream delta
+type StreamMessage struct {
+	Role      string         `json:"role,omitempty"`
+	Content   *StreamContent `json:"content,omitempty"`
+	ToolCalls *ToolCall      `json:"tool_calls,omitempty"` // A single call per event
+}
+
+// StreamContent is the content part of a stream delta
+type StreamContent struct {
+	Text string `json:"text,omitempty"`
+}
+
+// EmbedRequest is sent to /v2/embed
+type EmbedRequest struct {
+	Model          string   `json:"model"`
+	Texts          []string `json:"texts"`
+	InputType      string   `json:"input_type"` // "search_document", "search_query", "classification" or "clustering"
+	EmbeddingTypes []string `json:"embedding_types"`
+	OutputDim      int      `json:"output_dimension,omitempty"`
+}
+
+// EmbedResponse is returned from /v2/embed
+type EmbedResponse struct {
+	ID         string `json:"id"`
+	Embeddings struct {
+		Float [][]float64 `json:"float"`
+	} `json:"embeddings"`
+	Meta *struct {
+		BilledUnits *Tokens `json:"billed_units,omitempty"`
+	} `json:"meta,omitempty"`
+}
+
+// ModelList is returned from /v1/models
+type ModelList struct {
+	Models []struct {
+		Name      string   `json:"name"`
+		Endpoints []string `json:"endpoints"`
+	} `json:"models"`
+}
@@ -0,0 +1,101 @@
+package openai
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Embedding encoding formats
+const (
+	EncodingFormatFloat  = "float"
+	EncodingFormatBase64 = "base64"
+)
+
+// ConvertEmbeddingEncoding rewrites the embeddings of a /v1/embeddings response body in
+// the encoding the client requested ("float", the default, or "base64"), for backends
+// that ignore encoding_format or only answer in one of them. base64 embeddings are
+// little-endian float32 arrays. The body is returned unchanged when it already matches.
+func ConvertEmbeddingEncoding(body []byte, format string) ([]byte, error) {
+	if format == "" {
+		format = EncodingFormatFloat
+	}
+	var resp map[string]json.RawMessage
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse embedding response: %w", err)
+	}
+	var data []map[string]json.RawMessage
+	if err := json.Unmarshal(resp["data"], &data); err != nil {
+		return nil, fmt.Errorf("failed to parse embedding response data: %w", err)
+	}
+
+	changed := false
+	for i, item := range data {
+		embedding := item["embedding"]
+		if len(embedding) == 0 {
+			continue
+		}
+		isBase64 := embedding[0] == '"'
+		var converted []byte
+		var err error
+		switch {
+		case format == EncodingFormatFloat && isBase64:
+			converted, err = base64EmbeddingToFloat(embedding)
+		case format == EncodingFormatBase64 && !isBase64:
+			converted, err = floatEmbeddingToBase64(embedding)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("embedding %d: %w", i, err)
+		}
+		item["embedding"] = converted
+		changed = true
+	}
+	if !changed {
+		return body, nil
+	}
+
+	rawData, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	resp["data"] = rawData
+	return json.Marshal(resp)
+}
+
+// base64EmbeddingToFloat decodes a base64 JSON string of float32 values into a JSON array
+func base64EmbeddingToFloat(embedding json.RawMessage) ([]byte, error) {
+	var encoded string
+	if err := json.Unmarshal(embedding, &encoded); err != nil {
+		return nil, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 embedding: %w", err)
+	}
+	if len(raw)%4 != 0 {
+		return nil, errors.New("base64 embedding is not a float32 array")
+	}
+	values := make([]float32, len(raw)/4)
+	for i := range values {
+		values[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw[i*4:]))
+	}
+	return json.Marshal(values)
+}
+
+// floatEmbeddingToBase64 encodes a JSON array of numbers as a base64 JSON string of float32 values
+func floatEmbeddingToBase64(embedding json.RawMessage) ([]byte, error) {
+	var values []float64
+	if err := json.Unmarshal(embedding, &values); err != nil {
+		return nil, err
+	}
+	raw := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint32(raw[i*4:], math.Float32bits(float32(v)))
+	}
+	return json.Marshal(base64.StdEncoding.EncodeToString(raw))
+}
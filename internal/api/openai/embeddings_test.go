@@ -0,0 +1,54 @@
+package openai
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertEmbeddingEncoding(t *testing.T) {
+	// 1.0 and -0.5 as little-endian float32
+	const encoded = "AACAPwAAAL8="
+	floatBody := `{"object":"list","data":[{"object":"embedding","index":0,"embedding":[1,-0.5]}],"model":"m","usage":{"prompt_tokens":2,"total_tokens":2}}`
+	base64Body := `{"object":"list","data":[{"object":"embedding","index":0,"embedding":"` + encoded + `"}],"model":"m","usage":{"prompt_tokens":2,"total_tokens":2}}`
+
+	tests := []struct {
+		name    string
+		body    string
+		format  string
+		want    any
+		wantErr string
+	}{
+		{name: "float requested, base64 returned", body: base64Body, format: EncodingFormatFloat, want: []any{1.0, -0.5}},
+		{name: "default format is float", body: base64Body, want: []any{1.0, -0.5}},
+		{name: "base64 requested, float returned", body: floatBody, format: EncodingFormatBase64, want: encoded},
+		{name: "float already", body: floatBody, format: EncodingFormatFloat, want: []any{1.0, -0.5}},
+		{name: "base64 already", body: base64Body, format: EncodingFormatBase64, want: encoded},
+		{name: "truncated base64", body: `{"data":[{"embedding":"AACAPw=="},{"embedding":"AACA"}]}`, wantErr: "embedding 1"},
+		{name: "not JSON", body: "oops", wantErr: "failed to parse"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := ConvertEmbeddingEncoding([]byte(tt.body), tt.format)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			var resp struct {
+				Data []struct {
+					Embedding any `json:"embedding"`
+				} `json:"data"`
+				Usage Usage `json:"usage"`
+			}
+			require.NoError(t, json.Unmarshal(out, &resp))
+			require.Len(t, resp.Data, 1)
+			assert.Equal(t, tt.want, resp.Data[0].Embedding)
+			assert.Equal(t, 2, resp.Usage.PromptTokens, "other fields are kept")
+		})
+	}
+}
@@ -0,0 +1,73 @@
+// Package openai provides validation utilities for OpenAI API requests
+package openai
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// structuredOutputSchemaURL is the resource name under which request schemas are compiled
+const structuredOutputSchemaURL = "response_format.json_schema"
+
+// StructuredOutputSchema extracts response_format.json_schema.schema from a raw chat
+// completion request. ok is false unless response_format.type is "json_schema".
+func StructuredOutputSchema(data []byte) (schema any, ok bool) {
+	var req struct {
+		ResponseFormat *struct {
+			Type       string `json:"type"`
+			JSONSchema *struct {
+				Schema json.RawMessage `json:"schema"`
+			} `json:"json_schema"`
+		} `json:"response_format"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil || req.ResponseFormat == nil {
+		return nil, false
+	}
+	if req.ResponseFormat.Type != "json_schema" || req.ResponseFormat.JSONSchema == nil || len(req.ResponseFormat.JSONSchema.Schema) == 0 {
+		return nil, false
+	}
+
+	schema, err := jsonschema.UnmarshalJSON(strings.NewReader(string(req.ResponseFormat.JSONSchema.Schema)))
+	if err != nil {
+		return nil, false
+	}
+	return schema, true
+}
+
+// ValidateStructuredOutput checks that every choice in a chat completion response
+// carries assistant content that is valid JSON matching the requested schema.
+func ValidateStructuredOutput(schema any, respBody []byte) error {
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(structuredOutputSchemaURL, schema); err != nil {
+		return fmt.Errorf("invalid json_schema: %w", err)
+	}
+	compiled, err := compiler.Compile(structuredOutputSchemaURL)
+	if err != nil {
+		return fmt.Errorf("invalid json_schema: %w", err)
+	}
+
+	var resp ChatCompletionResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return fmt.Errorf("response has no choices")
+	}
+
+	for _, choice := range resp.Choices {
+		if choice.Message == nil {
+			return fmt.Errorf("choice %d has no message", choice.Index)
+		}
+		output, err := jsonschema.UnmarshalJSON(strings.NewReader(choice.Message.Content))
+		if err != nil {
+			return fmt.Errorf("choice %d content is not valid JSON: %w", choice.Index, err)
+		}
+		if err := compiled.Validate(output); err != nil {
+			return fmt.Errorf("choice %d does not match json_schema: %w", choice.Index, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package openai
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStructuredOutputSchema(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		ok   bool
+	}{
+		{name: "json_schema", body: `{"response_format":{"type":"json_schema","json_schema":{"name":"x","schema":{"type":"object"}}}}`, ok: true},
+		{name: "json_object", body: `{"response_format":{"type":"json_object"}}`},
+		{name: "missing schema", body: `{"response_format":{"type":"json_schema","json_schema":{"name":"x"}}}`},
+		{name: "no response_format", body: `{"model":"gpt-4"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ok := StructuredOutputSchema([]byte(tt.body))
+			assert.Equal(t, tt.ok, ok)
+		})
+	}
+}
+
+func TestValidateStructuredOutput(t *testing.T) {
+	schema, ok := StructuredOutputSchema([]byte(`{"response_format":{"type":"json_schema","json_schema":{"name":"person","schema":{
+		"type":"object","required":["name","age"],"properties":{"name":{"type":"string"},"age":{"type":"integer"}}}}}}`))
+	require.True(t, ok)
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "valid", content: `{\"name\":\"Ada\",\"age\":36}`},
+		{name: "schema mismatch", content: `{\"name\":\"Ada\"}`, wantErr: "does not match json_schema"},
+		{name: "not JSON", content: `Ada is 36`, wantErr: "not valid JSON"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := `{"id":"c1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"` + tt.content + `"},"finish_reason":"stop"}]}`
+			err := ValidateStructuredOutput(schema, []byte(resp))
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
@@ -13,6 +13,24 @@ type Model struct {
 	Object  string `json:"object"`
 	Created int64  `json:"created"`
 	OwnedBy string `json:"owned_by"`
+
+	// openmodel extensions (omitted for upstream provider models)
+	Strategy string   `json:"strategy,omitempty"` // Provider selection strategy
+	Backends []string `json:"backends,omitempty"` // Configured "provider/model" chain
+	// Capabilities any backend supports (tools, vision, json_mode, embeddings)
+	Capabilities  []string `json:"capabilities,omitempty"`
+	ContextLength int      `json:"context_length,omitempty"` // Declared, or largest backend, context window in tokens
+	// Metadata declared in the config
+	Description   string        `json:"description,omitempty"`
+	Family        string        `json:"family,omitempty"`
+	ParameterSize string        `json:"parameter_size,omitempty"`
+	Pricing       *ModelPricing `json:"pricing,omitempty"`
+}
+
+// ModelPricing is the advertised price of a model's tokens
+type ModelPricing struct {
+	InputPerMillion  float64 `json:"input_per_million"`
+	OutputPerMillion float64 `json:"output_per_million"`
 }
 
 // ModelList is returned by /v1/models
@@ -23,31 +41,53 @@ type ModelList struct {
 
 // ChatCompletionMessage represents a message in a chat completion
 type ChatCompletionMessage struct {
-	Role     string `json:"role"`
-	Content  string `json:"content"`
-	Thinking string `json:"thinking,omitempty"`
-	Name     string `json:"name,omitempty"`
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	Thinking   string     `json:"thinking,omitempty"`
+	Name       string     `json:"name,omitempty"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`   // Calls made by an assistant message
+	ToolCallID string     `json:"tool_call_id,omitempty"` // Call answered by a tool message
+}
+
+// ToolCall is a function call made by the model
+type ToolCall struct {
+	ID       string           `json:"id"`
+	Type     string           `json:"type"` // "function"
+	Function ToolCallFunction `json:"function"`
+}
+
+// ToolCallFunction is the function and JSON-encoded arguments of a tool call
+type ToolCallFunction struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
 }
 
 // ChatCompletionRequest is sent to /v1/chat/completions
 type ChatCompletionRequest struct {
-	Model            string                  `json:"model"`
-	Messages         []ChatCompletionMessage `json:"messages"`
-	Temperature      *float64                `json:"temperature,omitempty"`
-	TopP             *float64                `json:"top_p,omitempty"`
-	N                *int                    `json:"n,omitempty"`
-	Stream           bool                    `json:"stream,omitempty"`
-	Stop             []string                `json:"stop,omitempty"`
-	MaxTokens        *int                    `json:"max_tokens,omitempty"`
-	PresencePenalty  *float64                `json:"presence_penalty,omitempty"`
-	FrequencyPenalty *float64                `json:"frequency_penalty,omitempty"`
-	LogitBias        map[string]float64      `json:"logit_bias,omitempty"`
-	User             string                  `json:"user,omitempty"`
-	ResponseFormat   *ResponseFormat         `json:"response_format,omitempty"`
-	Seed             *int                    `json:"seed,omitempty"`
-	Tools            []Tool                  `json:"tools,omitempty"`
-	ToolChoice       any                     `json:"tool_choice,omitempty"`
-	Extra            map[string]any          `json:"-"` // Provider-specific fields (e.g., enable_thinking)
+	Model             string                  `json:"model"`
+	Messages          []ChatCompletionMessage `json:"messages"`
+	Temperature       *float64                `json:"temperature,omitempty"`
+	TopP              *float64                `json:"top_p,omitempty"`
+	N                 *int                    `json:"n,omitempty"`
+	Stream            bool                    `json:"stream,omitempty"`
+	StreamOptions     *StreamOptions          `json:"stream_options,omitempty"`
+	Stop              []string                `json:"stop,omitempty"`
+	MaxTokens         *int                    `json:"max_tokens,omitempty"`
+	PresencePenalty   *float64                `json:"presence_penalty,omitempty"`
+	FrequencyPenalty  *float64                `json:"frequency_penalty,omitempty"`
+	LogitBias         map[string]float64      `json:"logit_bias,omitempty"`
+	User              string                  `json:"user,omitempty"`
+	ResponseFormat    *ResponseFormat         `json:"response_format,omitempty"`
+	Seed              *int                    `json:"seed,omitempty"`
+	Tools             []Tool                  `json:"tools,omitempty"`
+	ToolChoice        any                     `json:"tool_choice,omitempty"` // "auto" | "none" | "required" | {"type":"function","function":{"name":...}}
+	ParallelToolCalls *bool                   `json:"parallel_tool_calls,omitempty"`
+	Extra             map[string]any          `json:"-"` // Provider-specific fields (e.g., enable_thinking)
+}
+
+// StreamOptions configures streaming behavior
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage,omitempty"` // Emit a final chunk with token usage before [DONE]
 }
 
 // ResponseFormat specifies the format of the response
@@ -279,6 +319,7 @@ type ChatCompletionChunk struct {
 	Created           int64                       `json:"created"`
 	Model             string                      `json:"model"`
 	Choices           []ChatCompletionChunkChoice `json:"choices"`
+	Usage             *Usage                      `json:"usage,omitempty"`
 	SystemFingerprint string                      `json:"system_fingerprint,omitempty"`
 }
 
@@ -299,6 +340,29 @@ func StreamResponseToChunk(data []byte) (*ChatCompletionChunk, error) {
 	return &chunk, nil
 }
 
+// IncludeUsageRequested reports whether a raw chat completion request asks for
+// a usage chunk at the end of the stream (stream_options.include_usage)
+func IncludeUsageRequested(data []byte) bool {
+	var req struct {
+		StreamOptions *StreamOptions `json:"stream_options"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil || req.StreamOptions == nil {
+		return false
+	}
+	return req.StreamOptions.IncludeUsage
+}
+
+// NewUsageChunk builds the final streaming chunk carrying token usage and no choices
+func NewUsageChunk(id, model string, usage Usage) ChatCompletionChunk {
+	return ChatCompletionChunk{
+		ID:      id,
+		Object:  "chat.completion.chunk",
+		Model:   model,
+		Choices: []ChatCompletionChunkChoice{},
+		Usage:   &usage,
+	}
+}
+
 // ParseChatCompletionRequest parses raw JSON into ChatCompletionRequest
 func ParseChatCompletionRequest(data []byte) (*ChatCompletionRequest, error) {
 	var req ChatCompletionRequest
@@ -365,22 +429,24 @@ func (r *ChatCompletionRequest) UnmarshalJSON(data []byte) error {
 
 	// Known field names
 	knownFields := map[string]bool{
-		"model":             true,
-		"messages":          true,
-		"temperature":       true,
-		"top_p":             true,
-		"n":                 true,
-		"stream":            true,
-		"stop":              true,
-		"max_tokens":        true,
-		"presence_penalty":  true,
-		"frequency_penalty": true,
-		"logit_bias":        true,
-		"user":              true,
-		"response_format":   true,
-		"seed":              true,
-		"tools":             true,
-		"tool_choice":       true,
+		"model":               true,
+		"messages":            true,
+		"temperature":         true,
+		"top_p":               true,
+		"n":                   true,
+		"stream":              true,
+		"stream_options":      true,
+		"stop":                true,
+		"max_tokens":          true,
+		"presence_penalty":    true,
+		"frequency_penalty":   true,
+		"logit_bias":          true,
+		"user":                true,
+		"response_format":     true,
+		"seed":                true,
+		"tools":               true,
+		"tool_choice":         true,
+		"parallel_tool_calls": true,
 	}
 
 	// Unmarshal known fields
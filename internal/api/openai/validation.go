@@ -4,6 +4,7 @@ package openai
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"strings"
 )
 
@@ -197,8 +198,16 @@ func ValidateEmbeddingRequest(data []byte) error {
 		return ValidationError{Field: "input", Message: "must be string or array"}
 	}
 
-	return nil
+	if format, ok := req["encoding_format"]; ok && format != EncodingFormatFloat && format != EncodingFormatBase64 {
+		return ValidationError{Field: "encoding_format", Message: "must be 'float' or 'base64'"}
+	}
+	if dimensions, ok := req["dimensions"]; ok {
+		if d, isNumber := dimensions.(float64); !isNumber || d < 1 || d != math.Trunc(d) {
+			return ValidationError{Field: "dimensions", Message: "must be a positive integer"}
+		}
+	}
 
+	return nil
 }
 
 // ValidateModerationRequest validates a moderation request
@@ -232,10 +241,19 @@ func ValidateCompletionRequest(data []byte) error {
 		return ValidationError{Field: "prompt", Message: "is required"}
 	}
 
+	// Suffix enables fill-in-the-middle completion
+	suffix, hasSuffix := req["suffix"]
+	if hasSuffix && suffix != nil {
+		if _, ok := suffix.(string); !ok {
+			return ValidationError{Field: "suffix", Message: "must be a string"}
+		}
+	}
+
 	// Prompt can be string or array
 	switch v := prompt.(type) {
 	case string:
-		if v == "" {
+		// An empty prompt is valid for fill-in-the-middle when a suffix is given
+		if v == "" && (suffix == nil || suffix == "") {
 			return ValidationError{Field: "prompt", Message: "cannot be empty"}
 		}
 	case []interface{}:
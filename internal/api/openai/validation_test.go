@@ -97,6 +97,50 @@ func TestValidateEmbeddingRequest(t *testing.T) {
 		require.Error(t, err)
 		assert.Contains(t, err.Error(), "input")
 	})
+	t.Run("dimensions and encoding format", func(t *testing.T) {
+		data := `{"model":"text-embedding-3-small","input":"Hello","dimensions":256,"encoding_format":"base64"}`
+		assert.NoError(t, openai.ValidateEmbeddingRequest([]byte(data)))
+	})
+
+	t.Run("invalid encoding format", func(t *testing.T) {
+		data := `{"model":"text-embedding-3-small","input":"Hello","encoding_format":"int8"}`
+		err := openai.ValidateEmbeddingRequest([]byte(data))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "encoding_format")
+	})
+
+	t.Run("invalid dimensions", func(t *testing.T) {
+		data := `{"model":"text-embedding-3-small","input":"Hello","dimensions":0.5}`
+		err := openai.ValidateEmbeddingRequest([]byte(data))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "dimensions")
+	})
+}
+
+func TestValidateCompletionRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{name: "valid prompt", data: `{"model":"m","prompt":"def fib(n):"}`},
+		{name: "fill-in-the-middle", data: `{"model":"m","prompt":"def fib(n):","suffix":"    return a"}`},
+		{name: "empty prompt with suffix", data: `{"model":"m","prompt":"","suffix":"return a"}`},
+		{name: "empty prompt without suffix", data: `{"model":"m","prompt":""}`, wantErr: "prompt"},
+		{name: "non-string suffix", data: `{"model":"m","prompt":"x","suffix":42}`, wantErr: "suffix"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := openai.ValidateCompletionRequest([]byte(tt.data))
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
 }
 
 func TestValidateModerationRequest(t *testing.T) {
@@ -0,0 +1,143 @@
+// Package tgi provides conversion between OpenAI and TGI native formats
+package tgi
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/macedot/openmodel/internal/api/openai"
+)
+
+// CompletionRequest is an OpenAI completion request with the sampling extensions
+// self-hosted servers accept: vLLM's guided decoding fields and TGI's grammar
+type CompletionRequest struct {
+	openai.CompletionRequest
+	TopK              *int     `json:"top_k,omitempty"`
+	RepetitionPenalty *float64 `json:"repetition_penalty,omitempty"`
+	Seed              *int     `json:"seed,omitempty"`
+	Grammar           *Grammar `json:"grammar,omitempty"`
+	GuidedJSON        any      `json:"guided_json,omitempty"`
+	GuidedRegex       string   `json:"guided_regex,omitempty"`
+}
+
+// OpenAIToGenerateRequest converts an OpenAI completion request to a generate request.
+// TGI takes a single prompt; sampling is enabled by a positive temperature or top_p.
+func OpenAIToGenerateRequest(req *CompletionRequest) (*GenerateRequest, error) {
+	prompt, err := singlePrompt(req.Prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	params := Parameters{
+		MaxNewTokens:      req.MaxTokens,
+		TopP:              req.TopP,
+		TopK:              req.TopK,
+		RepetitionPenalty: req.RepetitionPenalty,
+		FrequencyPenalty:  req.FrequencyPenalty,
+		Stop:              req.Stop,
+		Seed:              req.Seed,
+		BestOf:            req.BestOf,
+		ReturnFullText:    req.Echo,
+		Grammar:           req.Grammar,
+		Details:           true,
+	}
+	if req.Temperature != nil && *req.Temperature > 0 {
+		params.Temperature = req.Temperature
+		params.DoSample = true
+	}
+	if req.TopP != nil && *req.TopP < 1 {
+		params.DoSample = true
+	}
+	if params.Grammar == nil {
+		params.Grammar = GrammarFromGuided(req.GuidedJSON, req.GuidedRegex)
+	}
+
+	return &GenerateRequest{Inputs: prompt, Parameters: params, Stream: req.Stream}, nil
+}
+
+// singlePrompt returns the prompt of a completion request, which must be a single string
+func singlePrompt(prompt any) (string, error) {
+	switch p := prompt.(type) {
+	case string:
+		return p, nil
+	case []any:
+		if len(p) == 1 {
+			if s, ok := p[0].(string); ok {
+				return s, nil
+			}
+		}
+	}
+	return "", errors.New("prompt must be a single string")
+}
+
+// GrammarFromGuided converts vLLM guided decoding fields to a TGI grammar, nil when neither is set
+func GrammarFromGuided(guidedJSON any, guidedRegex string) *Grammar {
+	switch {
+	case guidedJSON != nil:
+		if s, ok := guidedJSON.(string); ok {
+			var schema any
+			if json.Unmarshal([]byte(s), &schema) == nil {
+				guidedJSON = schema
+			}
+		}
+		return &Grammar{Type: "json", Value: guidedJSON}
+	case guidedRegex != "":
+		return &Grammar{Type: "regex", Value: guidedRegex}
+	}
+	return nil
+}
+
+// GenerateToOpenAIResponse converts a generate response to an OpenAI completion response
+func GenerateToOpenAIResponse(resp *GenerateResponse, model, id string, created int64) *openai.CompletionResponse {
+	out := &openai.CompletionResponse{
+		ID:      id,
+		Object:  "text_completion",
+		Created: created,
+		Model:   model,
+		Choices: []openai.CompletionChoice{{Text: resp.GeneratedText, FinishReason: "stop"}},
+	}
+	if resp.Details != nil {
+		out.Choices[0].FinishReason = finishReason(resp.Details.FinishReason)
+		out.Usage = &openai.Usage{CompletionTokens: resp.Details.GeneratedTokens, TotalTokens: resp.Details.GeneratedTokens}
+	}
+	return out
+}
+
+// ConvertStreamResponse converts the data of a /generate_stream event to an OpenAI
+// completion chunk. ok is false for events to skip (special tokens, malformed data); done
+// reports the last event, whose chunk carries the finish reason and usage.
+func ConvertStreamResponse(data, model, id string, created int64) (chunk openai.CompletionResponse, done, ok bool) {
+	var event StreamResponse
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		return chunk, false, false
+	}
+	done = event.Details != nil
+	if event.Token.Special && !done {
+		return chunk, false, false
+	}
+
+	choice := openai.CompletionChoice{}
+	if !event.Token.Special {
+		choice.Text = event.Token.Text
+	}
+	chunk = openai.CompletionResponse{
+		ID:      id,
+		Object:  "text_completion",
+		Created: created,
+		Model:   model,
+		Choices: []openai.CompletionChoice{choice},
+	}
+	if done {
+		chunk.Choices[0].FinishReason = finishReason(event.Details.FinishReason)
+		chunk.Usage = &openai.Usage{CompletionTokens: event.Details.GeneratedTokens, TotalTokens: event.Details.GeneratedTokens}
+	}
+	return chunk, done, true
+}
+
+// finishReason maps a TGI finish_reason to an OpenAI finish_reason
+func finishReason(reason string) string {
+	if reason == "length" {
+		return "length"
+	}
+	return "stop"
+}
@@ -0,0 +1,109 @@
+package tgi
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/macedot/openmodel/internal/api/openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAIToGenerateRequest(t *testing.T) {
+	temp, zero, topP := 0.7, 0.0, 0.9
+	maxTokens, topK := 64, 40
+
+	tests := []struct {
+		name     string
+		req      CompletionRequest
+		wantErr  bool
+		validate func(t *testing.T, r *GenerateRequest)
+	}{
+		{
+			name: "sampling options",
+			req: CompletionRequest{
+				CompletionRequest: openai.CompletionRequest{Prompt: "Once", MaxTokens: &maxTokens, Temperature: &temp, Stop: []string{"\n"}},
+				TopK:              &topK,
+			},
+			validate: func(t *testing.T, r *GenerateRequest) {
+				assert.Equal(t, "Once", r.Inputs)
+				assert.Equal(t, &maxTokens, r.Parameters.MaxNewTokens)
+				assert.Equal(t, &temp, r.Parameters.Temperature)
+				assert.Equal(t, &topK, r.Parameters.TopK)
+				assert.True(t, r.Parameters.DoSample)
+				assert.True(t, r.Parameters.Details)
+			},
+		},
+		{
+			name: "zero temperature is greedy",
+			req:  CompletionRequest{CompletionRequest: openai.CompletionRequest{Prompt: []any{"Once"}, Temperature: &zero}},
+			validate: func(t *testing.T, r *GenerateRequest) {
+				assert.Nil(t, r.Parameters.Temperature)
+				assert.False(t, r.Parameters.DoSample)
+			},
+		},
+		{
+			name: "top_p samples",
+			req:  CompletionRequest{CompletionRequest: openai.CompletionRequest{Prompt: "x", TopP: &topP}},
+			validate: func(t *testing.T, r *GenerateRequest) {
+				assert.True(t, r.Parameters.DoSample)
+			},
+		},
+		{
+			name: "guided json as a string",
+			req:  CompletionRequest{CompletionRequest: openai.CompletionRequest{Prompt: "x"}, GuidedJSON: `{"type":"object"}`},
+			validate: func(t *testing.T, r *GenerateRequest) {
+				assert.Equal(t, &Grammar{Type: "json", Value: map[string]any{"type": "object"}}, r.Parameters.Grammar)
+			},
+		},
+		{
+			name:    "several prompts",
+			req:     CompletionRequest{CompletionRequest: openai.CompletionRequest{Prompt: []any{"a", "b"}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := OpenAIToGenerateRequest(&tt.req)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			tt.validate(t, r)
+		})
+	}
+}
+
+func TestCompletionRequest_Unmarshal(t *testing.T) {
+	var req CompletionRequest
+	require.NoError(t, json.Unmarshal([]byte(`{"model":"m","prompt":"hi","top_k":5,"guided_regex":"[0-9]+"}`), &req))
+	assert.Equal(t, "m", req.Model)
+	assert.Equal(t, 5, *req.TopK)
+	assert.Equal(t, "[0-9]+", req.GuidedRegex)
+}
+
+func TestConvertStreamResponse(t *testing.T) {
+	chunk, done, ok := ConvertStreamResponse(`{"index":1,"token":{"id":1,"text":"Hi","special":false},"generated_text":null,"details":null}`, "m", "cmpl-1", 1)
+	require.True(t, ok)
+	assert.False(t, done)
+	assert.Equal(t, "Hi", chunk.Choices[0].Text)
+	assert.Equal(t, "text_completion", chunk.Object)
+
+	_, _, ok = ConvertStreamResponse(`{"token":{"id":2,"text":"<s>","special":true},"generated_text":null,"details":null}`, "m", "cmpl-1", 1)
+	assert.False(t, ok, "special tokens are skipped")
+
+	chunk, done, ok = ConvertStreamResponse(`{"token":{"id":3,"text":"</s>","special":true},"generated_text":"Hi","details":{"finish_reason":"eos_token","generated_tokens":2}}`, "m", "cmpl-1", 1)
+	require.True(t, ok)
+	assert.True(t, done)
+	assert.Equal(t, "", chunk.Choices[0].Text)
+	assert.Equal(t, "stop", chunk.Choices[0].FinishReason)
+	assert.Equal(t, 2, chunk.Usage.CompletionTokens)
+}
+
+func TestGenerateToOpenAIResponse(t *testing.T) {
+	resp := GenerateToOpenAIResponse(&GenerateResponse{GeneratedText: "Hi", Details: &Details{FinishReason: "length", GeneratedTokens: 8}}, "m", "cmpl-1", 1)
+	assert.Equal(t, "Hi", resp.Choices[0].Text)
+	assert.Equal(t, "length", resp.Choices[0].FinishReason)
+	assert.Equal(t, 8, resp.Usage.TotalTokens)
+}
@@ -0,0 +1,60 @@
+// Package tgi defines types for the HuggingFace Text Generation Inference native API
+package tgi
+
+// Grammar constrains generation to a JSON schema or a regular expression
+type Grammar struct {
+	Type  string `json:"type"` // "json" or "regex"
+	Value any    `json:"value"`
+}
+
+// Parameters are the generation parameters of a generate request
+type Parameters struct {
+	MaxNewTokens      *int     `json:"max_new_tokens,omitempty"`
+	Temperature       *float64 `json:"temperature,omitempty"` // Must be positive; greedy decoding when unset
+	TopP              *float64 `json:"top_p,omitempty"`
+	TopK              *int     `json:"top_k,omitempty"`
+	RepetitionPenalty *float64 `json:"repetition_penalty,omitempty"`
+	FrequencyPenalty  *float64 `json:"frequency_penalty,omitempty"`
+	Stop              []string `json:"stop,omitempty"`
+	Seed              *int     `json:"seed,omitempty"`
+	BestOf            *int     `json:"best_of,omitempty"`
+	DoSample          bool     `json:"do_sample,omitempty"`
+	ReturnFullText    bool     `json:"return_full_text,omitempty"`
+	Grammar           *Grammar `json:"grammar,omitempty"`
+	Details           bool     `json:"details"`
+}
+
+// GenerateRequest is sent to /generate and /generate_stream
+type GenerateRequest struct {
+	Inputs     string     `json:"inputs"`
+	Parameters Parameters `json:"parameters"`
+	Stream     bool       `json:"stream,omitempty"`
+}
+
+// Details describe how a generation ended
+type Details struct {
+	FinishReason    string `json:"finish_reason"` // "length", "eos_token" or "stop_sequence"
+	GeneratedTokens int    `json:"generated_tokens"`
+}
+
+// GenerateResponse is returned from /generate
+type GenerateResponse struct {
+	GeneratedText string   `json:"generated_text"`
+	Details       *Details `json:"details,omitempty"`
+}
+
+// Token is a token generated in a stream
+type Token struct {
+	ID      int     `json:"id"`
+	Text    string  `json:"text"`
+	Logprob float64 `json:"logprob"`
+	Special bool    `json:"special"`
+}
+
+// StreamResponse is an event of a /generate_stream stream; the last one carries the
+// generated text and details
+type StreamResponse struct {
+	Token         Token    `json:"token"`
+	GeneratedText *string  `json:"generated_text"`
+	Details       *Details `json:"details"`
+}
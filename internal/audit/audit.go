@@ -0,0 +1,117 @@
+// Package audit records administrative and configuration actions, and failed
+// authentications, to an append-only log: a JSON lines file or syslog
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/syslog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	applogger "github.com/macedot/openmodel/internal/logger"
+)
+
+// Actions recorded
+const (
+	ActionConfigReload   = "config.reload"
+	ActionBackendDisable = "backend.disable"
+	ActionBackendEnable  = "backend.enable"
+	ActionBackendReset   = "backend.reset"
+	ActionWeightsSet     = "weights.set"
+	ActionWeightsReset   = "weights.reset"
+	ActionDrainStart     = "drain.start"
+	ActionDrainResume    = "drain.resume"
+	ActionAuthFailure    = "auth.failure"
+	ActionKeyCreate      = "key.create"
+	ActionKeyRevoke      = "key.revoke"
+	ActionKeyRotate      = "key.rotate"
+)
+
+// Outcomes of actions
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Actors of actions not taken through the admin API
+const (
+	ActorSignal  = "signal"         // SIGHUP
+	ActorWatcher = "config_watcher" // A change of the config file or URL
+)
+
+// Event is one action
+type Event struct {
+	Time       string `json:"time"`
+	Action     string `json:"action"`
+	Outcome    string `json:"outcome"`
+	Actor      string `json:"actor"`                 // Who acted: "admin", "metrics", "client", ActorSignal or ActorWatcher
+	KeyID      string `json:"key_id,omitempty"`      // Id of the bearer token presented, see usage.KeyID
+	RemoteAddr string `json:"remote_addr,omitempty"` // Client address of API requests
+	Target     string `json:"target,omitempty"`      // Backend, model, API key id or path acted on
+	Detail     string `json:"detail,omitempty"`      // What changed
+	Error      string `json:"error,omitempty"`
+}
+
+// Logger appends events to its sink. Its methods do nothing on a nil logger, so callers
+// can record whether or not auditing is enabled.
+type Logger struct {
+	mu  sync.Mutex
+	w   io.WriteCloser
+	now func() time.Time
+}
+
+// OpenFile opens the file at path for appending, creating it and its directory if
+// needed. The file is readable by its owner only.
+func OpenFile(path string) (*Logger, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+		}
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &Logger{w: f, now: time.Now}, nil
+}
+
+// OpenSyslog connects to the syslog daemon at address over network ("udp", "tcp"), or
+// to the local one when network is empty. Events are sent with the auth facility.
+func OpenSyslog(network, address, tag string) (*Logger, error) {
+	w, err := syslog.Dial(network, address, syslog.LOG_NOTICE|syslog.LOG_AUTH, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return &Logger{w: w, now: time.Now}, nil
+}
+
+// Close closes the sink
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.w.Close()
+}
+
+// Record appends an event, timestamped now. Failing to write it is logged, not returned:
+// the action has already happened.
+func (l *Logger) Record(e Event) {
+	if l == nil {
+		return
+	}
+	e.Time = l.now().UTC().Format(time.RFC3339Nano)
+	data, err := json.Marshal(e)
+	if err != nil {
+		applogger.Error("audit_log_failed", "action", e.Action, "error", err)
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.w.Write(append(data, '\n')); err != nil {
+		applogger.Error("audit_log_failed", "action", e.Action, "error", err)
+	}
+}
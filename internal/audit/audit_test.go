@@ -0,0 +1,70 @@
+package audit
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "audit.jsonl")
+	l, err := OpenFile(path)
+	require.NoError(t, err)
+	l.now = func() time.Time { return time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC) }
+	l.Record(Event{Action: ActionBackendDisable, Outcome: OutcomeSuccess, Actor: "admin", KeyID: "0123456789abcdef", RemoteAddr: "10.0.0.1", Target: "openai/gpt-4o"})
+	require.NoError(t, l.Close())
+
+	// Reopening appends
+	l, err = OpenFile(path)
+	require.NoError(t, err)
+	l.Record(Event{Action: ActionConfigReload, Outcome: OutcomeFailure, Actor: ActorSignal, Error: "invalid config"})
+	require.NoError(t, l.Close())
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, `{"time":"2026-03-01T12:00:00Z","action":"backend.disable","outcome":"success","actor":"admin","key_id":"0123456789abcdef","remote_addr":"10.0.0.1","target":"openai/gpt-4o"}`, lines[0])
+	var event Event
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &event))
+	assert.Equal(t, ActionConfigReload, event.Action)
+	assert.Equal(t, "invalid config", event.Error)
+	assert.NotEmpty(t, event.Time)
+}
+
+func TestOpenSyslog(t *testing.T) {
+	daemon, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer daemon.Close()
+
+	l, err := OpenSyslog("udp", daemon.LocalAddr().String(), "openmodel")
+	require.NoError(t, err)
+	l.Record(Event{Action: ActionAuthFailure, Outcome: OutcomeFailure, Actor: "admin", Target: "/admin/reload"})
+	require.NoError(t, l.Close())
+
+	buf := make([]byte, 4096)
+	require.NoError(t, daemon.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := daemon.ReadFrom(buf)
+	require.NoError(t, err)
+	msg := string(buf[:n])
+	// Priority: auth facility (4) * 8 + notice (5)
+	assert.True(t, strings.HasPrefix(msg, "<37>"), msg)
+	assert.Contains(t, msg, "openmodel")
+	assert.Contains(t, msg, `"action":"auth.failure"`)
+}
+
+func TestLogger_Nil(t *testing.T) {
+	var l *Logger
+	l.Record(Event{Action: ActionDrainStart})
+	assert.NoError(t, l.Close())
+}
@@ -0,0 +1,240 @@
+// Package bodylog writes the request and response bodies of API requests to a JSON lines
+// file for debugging, with API keys, user identifiers and configured patterns redacted
+package bodylog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	applogger "github.com/macedot/openmodel/internal/logger"
+)
+
+// Redacted replaces redacted values
+const Redacted = "[REDACTED]"
+
+// secretFields are JSON fields always redacted, matched case-insensitively
+var secretFields = []string{"api_key", "apikey", "authorization", "token", "access_token", "refresh_token", "password", "secret"}
+
+// UserIDFields are JSON fields identifying end users: OpenAI's user and safety_identifier
+// and Anthropic's metadata.user_id
+var UserIDFields = []string{"user", "user_id", "safety_identifier"}
+
+// Entry is one request and its response
+type Entry struct {
+	Time           string            `json:"time"`
+	RequestID      string            `json:"request_id,omitempty"`
+	Method         string            `json:"method"`
+	Path           string            `json:"path"`
+	Status         int               `json:"status"`
+	Model          string            `json:"model,omitempty"`
+	Backend        string            `json:"backend,omitempty"`
+	DurationMs     int64             `json:"duration_ms"`
+	RequestHeaders map[string]string `json:"request_headers,omitempty"`
+	Request        any               `json:"request,omitempty"`
+	Response       any               `json:"response,omitempty"`
+	Stream         bool              `json:"stream,omitempty"`
+	ResponseText   string            `json:"response_text,omitempty"` // Streamed output reassembled
+}
+
+// Options select what is redacted besides API keys
+type Options struct {
+	Fields      []string // JSON fields whose values are redacted, at any depth
+	Patterns    []string // Regular expressions redacted wherever they match
+	KeepUserIDs bool     // Leave UserIDFields as they are
+}
+
+// Logger writes entries as JSON lines. Its methods do nothing on a nil logger.
+type Logger struct {
+	mu       sync.Mutex
+	w        io.WriteCloser
+	fields   map[string]bool
+	patterns []*regexp.Regexp
+}
+
+// Open opens the file at path for appending, creating it and its directory if needed.
+// The file is readable by its owner only, since bodies hold prompts and completions.
+func Open(path string, opts Options) (*Logger, error) {
+	l, err := newLogger(opts)
+	if err != nil {
+		return nil, err
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create body log directory: %w", err)
+		}
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open body log: %w", err)
+	}
+	l.w = f
+	return l, nil
+}
+
+// newLogger compiles the redaction options
+func newLogger(opts Options) (*Logger, error) {
+	l := &Logger{fields: make(map[string]bool)}
+	fields := append(append([]string{}, secretFields...), opts.Fields...)
+	if !opts.KeepUserIDs {
+		fields = append(fields, UserIDFields...)
+	}
+	for _, f := range fields {
+		l.fields[strings.ToLower(f)] = true
+	}
+	for _, p := range opts.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", p, err)
+		}
+		l.patterns = append(l.patterns, re)
+	}
+	return l, nil
+}
+
+// Close closes the file
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.w.Close()
+}
+
+// Write appends an entry
+func (l *Logger) Write(e Entry) {
+	if l == nil {
+		return
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		applogger.Warn("body_log_failed", "request_id", e.RequestID, "error", err)
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.w.Write(append(data, '\n')); err != nil {
+		applogger.Warn("body_log_failed", "request_id", e.RequestID, "error", err)
+	}
+}
+
+// Body returns a body as logged: JSON redacted field by field, other text redacted by
+// pattern, and a placeholder for binary content such as audio
+func (l *Logger) Body(body []byte, contentType string) any {
+	if l == nil || len(body) == 0 {
+		return nil
+	}
+	var v any
+	if err := json.Unmarshal(body, &v); err == nil {
+		return l.redactValue(v)
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if utf8.Valid(body) && (strings.HasPrefix(mediaType, "text/") || mediaType == "") {
+		return l.redactText(string(body))
+	}
+	return fmt.Sprintf("[%d bytes of %s]", len(body), mediaType)
+}
+
+// Headers returns headers as logged, with credentials redacted
+func (l *Logger) Headers(headers map[string]string) map[string]string {
+	if l == nil {
+		return nil
+	}
+	redacted := applogger.RedactHeaders(headers)
+	for k, v := range redacted {
+		redacted[k] = l.redactText(v)
+	}
+	return redacted
+}
+
+// Text returns text with the configured patterns redacted
+func (l *Logger) Text(s string) string {
+	if l == nil {
+		return s
+	}
+	return l.redactText(s)
+}
+
+// redactValue redacts a decoded JSON value in place
+func (l *Logger) redactValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if l.fields[strings.ToLower(k)] {
+				v[k] = Redacted
+			} else {
+				v[k] = l.redactValue(child)
+			}
+		}
+		return v
+	case []any:
+		for i, child := range v {
+			v[i] = l.redactValue(child)
+		}
+		return v
+	case string:
+		return l.redactText(v)
+	default:
+		return v
+	}
+}
+
+// redactText replaces the matches of the configured patterns
+func (l *Logger) redactText(s string) string {
+	for _, re := range l.patterns {
+		s = re.ReplaceAllString(s, Redacted)
+	}
+	return s
+}
+
+// Assembler reassembles the text of a streamed response from its SSE lines, in the
+// OpenAI or Anthropic format
+type Assembler struct {
+	text strings.Builder
+}
+
+// Add adds the text carried by the SSE lines of a chunk of the stream
+func (a *Assembler) Add(chunk string) {
+	if a == nil {
+		return
+	}
+	for _, line := range strings.Split(chunk, "\n") {
+		data, ok := strings.CutPrefix(strings.TrimSpace(line), "data:")
+		if !ok {
+			continue
+		}
+		var event struct {
+			Choices []struct {
+				Text  string `json:"text"`
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+			Delta struct {
+				Text string `json:"text"`
+			} `json:"delta"`
+		}
+		if json.Unmarshal([]byte(strings.TrimSpace(data)), &event) != nil {
+			continue
+		}
+		for _, choice := range event.Choices {
+			a.text.WriteString(choice.Text)
+			a.text.WriteString(choice.Delta.Content)
+		}
+		a.text.WriteString(event.Delta.Text)
+	}
+}
+
+// String returns the text reassembled so far
+func (a *Assembler) String() string {
+	if a == nil {
+		return ""
+	}
+	return a.text.String()
+}
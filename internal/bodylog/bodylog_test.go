@@ -0,0 +1,101 @@
+package bodylog
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogger_Body(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        Options
+		body        string
+		contentType string
+		want        any
+	}{
+		{
+			name: "secrets and user ids",
+			body: `{"model":"gpt-4","user":"u-42","api_key":"sk-1","metadata":{"user_id":"u-42"},"messages":[{"role":"user","content":"hi"}]}`,
+			want: map[string]any{"model": "gpt-4", "user": Redacted, "api_key": Redacted, "metadata": map[string]any{"user_id": Redacted},
+				"messages": []any{map[string]any{"role": "user", "content": "hi"}}},
+		},
+		{
+			name: "user ids kept, extra field and pattern",
+			opts: Options{KeepUserIDs: true, Fields: []string{"Session"}, Patterns: []string{`[\w.+-]+@[\w-]+\.[\w.]+`}},
+			body: `{"user":"u-42","session":"s-1","messages":[{"content":"mail me at jane@example.com"}]}`,
+			want: map[string]any{"user": "u-42", "session": Redacted, "messages": []any{map[string]any{"content": "mail me at " + Redacted}}},
+		},
+		{
+			name:        "text",
+			opts:        Options{Patterns: []string{`\d{3}-\d{2}-\d{4}`}},
+			body:        "ssn 123-45-6789",
+			contentType: "text/plain; charset=utf-8",
+			want:        "ssn " + Redacted,
+		},
+		{
+			name:        "binary",
+			body:        "ID3\x03\x00\xff\xfe",
+			contentType: "audio/mpeg",
+			want:        "[7 bytes of audio/mpeg]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := newLogger(tt.opts)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, l.Body([]byte(tt.body), tt.contentType))
+		})
+	}
+
+	_, err := newLogger(Options{Patterns: []string{"("}})
+	assert.Error(t, err)
+}
+
+func TestLogger_Headers(t *testing.T) {
+	l, err := newLogger(Options{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"Authorization": Redacted, "X-Api-Key": Redacted, "Content-Type": "application/json"},
+		l.Headers(map[string]string{"Authorization": "Bearer sk-1", "X-Api-Key": "sk-1", "Content-Type": "application/json"}))
+}
+
+func TestLogger_Write(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "bodies.jsonl")
+	l, err := Open(path, Options{})
+	require.NoError(t, err)
+	l.Write(Entry{RequestID: "r1", Method: "POST", Path: "/v1/chat/completions", Status: 200})
+	l.Write(Entry{RequestID: "r2", Method: "POST", Path: "/v1/messages", Status: 200, Stream: true, ResponseText: "hi"})
+	require.NoError(t, l.Close())
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+	var entry Entry
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &entry))
+	assert.Equal(t, "r2", entry.RequestID)
+	assert.Equal(t, "hi", entry.ResponseText)
+
+	var nilLogger *Logger
+	nilLogger.Write(Entry{})
+	assert.Nil(t, nilLogger.Body([]byte(`{}`), ""))
+	assert.NoError(t, nilLogger.Close())
+}
+
+func TestAssembler(t *testing.T) {
+	var a Assembler
+	a.Add("data: {\"choices\":[{\"delta\":{\"role\":\"assistant\"}}]}\n\n")
+	a.Add("data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\ndata: {\"choices\":[{\"delta\":{\"content\":\"lo\"}}]}\n\n")
+	a.Add("event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\", world\"}}\n\n")
+	a.Add("data: {\"choices\":[{\"text\":\"!\"}]}\n\n")
+	a.Add("data: [DONE]\n\n")
+	assert.Equal(t, "Hello, world!", a.String())
+}
@@ -0,0 +1,37 @@
+// Package config handles JSON configuration loading
+package config
+
+import "fmt"
+
+// AdminConfig holds settings for the runtime administration API (/admin/...)
+type AdminConfig struct {
+	Enabled bool   `json:"enabled"`
+	Token   string `json:"token"`           // Bearer token required on admin requests (supports ${VAR} expansion)
+	Debug   bool   `json:"debug,omitempty"` // Serve pprof profiles and Go runtime stats under /admin/debug
+}
+
+// IsEnabled reports whether the admin API is enabled
+func (a *AdminConfig) IsEnabled() bool {
+	return a != nil && a.Enabled
+}
+
+// IsDebugEnabled reports whether the admin API serves the debug endpoints
+func (a *AdminConfig) IsDebugEnabled() bool {
+	return a.IsEnabled() && a.Debug
+}
+
+// GetToken returns the admin token with environment variables expanded
+func (a *AdminConfig) GetToken() string {
+	if a == nil {
+		return ""
+	}
+	return expandEnvVars(a.Token)
+}
+
+// ValidateAdmin checks that an enabled admin API has a token
+func (c *Config) ValidateAdmin() error {
+	if c.Admin.IsEnabled() && c.Admin.GetToken() == "" {
+		return fmt.Errorf("admin API requires a token when enabled")
+	}
+	return nil
+}
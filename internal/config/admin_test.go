@@ -0,0 +1,28 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateAdmin(t *testing.T) {
+	t.Setenv("OPENMODEL_TEST_ADMIN_TOKEN", "s3cret")
+	tests := []struct {
+		name    string
+		admin   *AdminConfig
+		wantErr bool
+	}{
+		{name: "not configured"},
+		{name: "disabled without token", admin: &AdminConfig{}},
+		{name: "token from env", admin: &AdminConfig{Enabled: true, Token: "${OPENMODEL_TEST_ADMIN_TOKEN}"}},
+		{name: "enabled without token", admin: &AdminConfig{Enabled: true}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&Config{Admin: tt.admin}).ValidateAdmin()
+			assert.Equal(t, tt.wantErr, err != nil, "ValidateAdmin() error = %v", err)
+		})
+	}
+}
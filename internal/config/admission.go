@@ -0,0 +1,76 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AdmissionConfig limits how many requests a model serves at once. Excess requests wait
+// in a bounded queue, highest priority first, and are rejected with 429 when the queue is
+// full or their wait exceeds the queue timeout.
+type AdmissionConfig struct {
+	MaxConcurrent  int    `json:"max_concurrent"`   // Requests served at once (0 disables admission control)
+	MaxQueue       int    `json:"max_queue"`        // Requests allowed to wait for a slot (default 0: reject at once)
+	QueueTimeoutMs int    `json:"queue_timeout_ms"` // Longest wait for a slot (default 30000)
+	PriorityHeader string `json:"priority_header"`  // Header with an integer priority, higher first (default X-Priority)
+	// KeyPriorities maps client API keys (Authorization bearer or x-api-key) to a priority
+	// tier that takes precedence over the header (keys support ${VAR} expansion)
+	KeyPriorities map[string]int `json:"key_priorities,omitempty"`
+}
+
+// GetQueueTimeout returns the longest time a request waits for a slot
+func (a *AdmissionConfig) GetQueueTimeout() time.Duration {
+	if a == nil || a.QueueTimeoutMs <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(a.QueueTimeoutMs) * time.Millisecond
+}
+
+// GetPriorityHeader returns the header carrying request priority
+func (a *AdmissionConfig) GetPriorityHeader() string {
+	if a == nil || a.PriorityHeader == "" {
+		return "X-Priority"
+	}
+	return a.PriorityHeader
+}
+
+// KeyPriority returns the priority tier of a client API key
+func (a *AdmissionConfig) KeyPriority(key string) (int, bool) {
+	if a == nil || key == "" {
+		return 0, false
+	}
+	for k, priority := range a.KeyPriorities {
+		if expandEnvVars(k) == key {
+			return priority, true
+		}
+	}
+	return 0, false
+}
+
+// ValidateAdmission checks that model admission limits are not negative
+func (c *Config) ValidateAdmission() error {
+	var errs []string
+
+	for modelName, modelConfig := range c.Models {
+		a := modelConfig.Admission
+		if a == nil {
+			continue
+		}
+		if a.MaxConcurrent < 0 || a.MaxQueue < 0 || a.QueueTimeoutMs < 0 {
+			errs = append(errs, fmt.Sprintf(
+				"  model %q admission values must not be negative", modelName))
+		}
+		if a.MaxConcurrent == 0 && a.MaxQueue > 0 {
+			errs = append(errs, fmt.Sprintf(
+				"  model %q admission max_queue requires max_concurrent", modelName))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("admission validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
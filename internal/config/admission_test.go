@@ -0,0 +1,39 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateAdmission(t *testing.T) {
+	tests := []struct {
+		name      string
+		admission *AdmissionConfig
+		wantErr   string
+	}{
+		{name: "not configured"},
+		{name: "valid", admission: &AdmissionConfig{MaxConcurrent: 4, MaxQueue: 16, QueueTimeoutMs: 5000}},
+		{name: "negative", admission: &AdmissionConfig{MaxConcurrent: -1}, wantErr: "must not be negative"},
+		{name: "queue without limit", admission: &AdmissionConfig{MaxQueue: 5}, wantErr: "requires max_concurrent"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Models: map[string]ModelConfig{"m": {Admission: tt.admission}}}
+			err := cfg.ValidateAdmission()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+
+	var unset *AdmissionConfig
+	assert.Equal(t, 30*time.Second, unset.GetQueueTimeout())
+	assert.Equal(t, "X-Priority", unset.GetPriorityHeader())
+	assert.Equal(t, 2*time.Second, (&AdmissionConfig{QueueTimeoutMs: 2000}).GetQueueTimeout())
+}
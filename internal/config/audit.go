@@ -0,0 +1,90 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"cmp"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Audit log sinks
+const (
+	AuditSinkFile   = "file"
+	AuditSinkSyslog = "syslog"
+)
+
+// AuditConfig holds settings for the audit log (requires restart). Config reloads, admin
+// actions that change the server's behavior and failed admin or metrics authentications
+// are appended to a JSON lines file or sent to syslog.
+type AuditConfig struct {
+	Enabled bool   `json:"enabled"`
+	Sink    string `json:"sink,omitempty"` // "file" (default) or "syslog"
+	Path    string `json:"path,omitempty"` // File sink (supports ${VAR} expansion; default ~/.config/openmodel/audit.jsonl)
+	// SyslogAddress is the syslog daemon, "udp://host:514" or "tcp://host:514" (default the local daemon)
+	SyslogAddress string `json:"syslog_address,omitempty"`
+	SyslogTag     string `json:"syslog_tag,omitempty"` // Tag of syslog messages (default "openmodel")
+}
+
+// IsEnabled reports whether actions are audited
+func (a *AuditConfig) IsEnabled() bool {
+	return a != nil && a.Enabled
+}
+
+// GetSink returns where events are written
+func (a *AuditConfig) GetSink() string {
+	return cmp.Or(a.Sink, AuditSinkFile)
+}
+
+// GetPath returns the file of the file sink with environment variables expanded
+func (a *AuditConfig) GetPath() string {
+	if path := expandEnvVars(a.Path); path != "" {
+		return path
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "audit.jsonl"
+	}
+	return filepath.Join(homeDir, ".config", "openmodel", "audit.jsonl")
+}
+
+// GetSyslogAddress returns the network and address of the syslog daemon, both empty for
+// the local one
+func (a *AuditConfig) GetSyslogAddress() (network, address string) {
+	u, err := url.Parse(expandEnvVars(a.SyslogAddress))
+	if err != nil || a.SyslogAddress == "" {
+		return "", ""
+	}
+	return u.Scheme, u.Host
+}
+
+// GetSyslogTag returns the tag of syslog messages
+func (a *AuditConfig) GetSyslogTag() string {
+	return cmp.Or(a.SyslogTag, "openmodel")
+}
+
+// ValidateAudit checks the sink of the audit log and the syslog daemon's address
+func (c *Config) ValidateAudit() error {
+	if !c.Audit.IsEnabled() {
+		return nil
+	}
+	var errs []string
+	switch c.Audit.GetSink() {
+	case AuditSinkFile:
+	case AuditSinkSyslog:
+		if c.Audit.SyslogAddress != "" {
+			u, err := url.Parse(expandEnvVars(c.Audit.SyslogAddress))
+			if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+				errs = append(errs, fmt.Sprintf("  syslog_address %q must be udp://host:port or tcp://host:port", c.Audit.SyslogAddress))
+			}
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("  invalid sink %q (must be %s or %s)", c.Audit.Sink, AuditSinkFile, AuditSinkSyslog))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("audit validation failed:\n%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
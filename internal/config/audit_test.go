@@ -0,0 +1,45 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateAudit(t *testing.T) {
+	tests := []struct {
+		name    string
+		audit   *AuditConfig
+		wantErr []string
+	}{
+		{name: "disabled", audit: &AuditConfig{Sink: "kafka"}},
+		{name: "file", audit: &AuditConfig{Enabled: true}},
+		{name: "local syslog", audit: &AuditConfig{Enabled: true, Sink: AuditSinkSyslog}},
+		{name: "remote syslog", audit: &AuditConfig{Enabled: true, Sink: AuditSinkSyslog, SyslogAddress: "udp://logs.example.com:514"}},
+		{name: "invalid sink", audit: &AuditConfig{Enabled: true, Sink: "kafka"}, wantErr: []string{`invalid sink "kafka"`}},
+		{name: "invalid address", audit: &AuditConfig{Enabled: true, Sink: AuditSinkSyslog, SyslogAddress: "logs.example.com:514"},
+			wantErr: []string{`syslog_address "logs.example.com:514" must be`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Audit: tt.audit}
+			err := cfg.ValidateAudit()
+			if len(tt.wantErr) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				for _, want := range tt.wantErr {
+					assert.Contains(t, err.Error(), want)
+				}
+			}
+		})
+	}
+
+	network, address := (&AuditConfig{SyslogAddress: "tcp://logs.example.com:6514"}).GetSyslogAddress()
+	assert.Equal(t, "tcp", network)
+	assert.Equal(t, "logs.example.com:6514", address)
+	network, address = (&AuditConfig{}).GetSyslogAddress()
+	assert.Empty(t, network)
+	assert.Empty(t, address)
+}
@@ -0,0 +1,56 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// BodyLogConfig holds settings for debug body logging (requires restart). The request and
+// response bodies of API requests, with streamed output reassembled, are appended to a
+// JSON lines file. API keys and user identifiers are always redacted, and so are the
+// configured fields and patterns.
+type BodyLogConfig struct {
+	Enabled        bool     `json:"enabled"`
+	Path           string   `json:"path,omitempty"`            // JSON lines file (supports ${VAR} expansion; default ~/.config/openmodel/bodies.jsonl)
+	RedactFields   []string `json:"redact_fields,omitempty"`   // More JSON fields whose values are redacted, at any depth
+	RedactPatterns []string `json:"redact_patterns,omitempty"` // Regular expressions redacted wherever they match, e.g. emails
+	KeepUserIDs    bool     `json:"keep_user_ids,omitempty"`   // Log user, user_id and safety_identifier as sent
+}
+
+// IsEnabled reports whether bodies are logged
+func (b *BodyLogConfig) IsEnabled() bool {
+	return b != nil && b.Enabled
+}
+
+// GetPath returns the log file with environment variables expanded
+func (b *BodyLogConfig) GetPath() string {
+	if path := expandEnvVars(b.Path); path != "" {
+		return path
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "bodies.jsonl"
+	}
+	return filepath.Join(homeDir, ".config", "openmodel", "bodies.jsonl")
+}
+
+// ValidateBodyLog checks that the redaction patterns of the body log compile
+func (c *Config) ValidateBodyLog() error {
+	if c.BodyLog == nil {
+		return nil
+	}
+	var errs []string
+	for _, pattern := range c.BodyLog.RedactPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			errs = append(errs, fmt.Sprintf("  invalid redact pattern %q: %v", pattern, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("body_log validation failed:\n%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
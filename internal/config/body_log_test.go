@@ -0,0 +1,19 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateBodyLog(t *testing.T) {
+	cfg := &Config{}
+	assert.NoError(t, cfg.ValidateBodyLog())
+
+	cfg.BodyLog = &BodyLogConfig{Enabled: true, RedactPatterns: []string{`[\w.+-]+@[\w-]+\.[\w.]+`, `sk-(`}}
+	err := cfg.ValidateBodyLog()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "body_log validation failed")
+		assert.Contains(t, err.Error(), "invalid redact pattern \"sk-(\"")
+	}
+}
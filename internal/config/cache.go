@@ -0,0 +1,151 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SemanticCacheConfig sets up the semantic cache of chat completions. The prompt of a
+// non-streaming request to a model that enables the cache is embedded with a configured
+// embedding model; when an earlier prompt to the model, with the same other parameters,
+// is at least threshold similar (by cosine similarity), its completion is returned
+// without calling a backend. The cache is kept in memory, per instance.
+type SemanticCacheConfig struct {
+	EmbeddingModel string  `json:"embedding_model"`       // Configured model embedding prompts
+	Threshold      float64 `json:"threshold,omitempty"`   // Least similarity of a hit, up to 1 (default 0.95)
+	TTLSeconds     int     `json:"ttl_seconds,omitempty"` // How long completions are served from the cache (default 3600)
+	MaxEntries     int     `json:"max_entries,omitempty"` // Completions kept per model, the oldest evicted first (default 1000)
+}
+
+// GetThreshold returns the least similarity of a cache hit
+func (s *SemanticCacheConfig) GetThreshold() float64 {
+	if s == nil || s.Threshold <= 0 {
+		return 0.95
+	}
+	return s.Threshold
+}
+
+// GetTTL returns how long completions are served from the cache
+func (s *SemanticCacheConfig) GetTTL() time.Duration {
+	if s == nil || s.TTLSeconds <= 0 {
+		return time.Hour
+	}
+	return time.Duration(s.TTLSeconds) * time.Second
+}
+
+// GetMaxEntries returns how many completions are kept per model
+func (s *SemanticCacheConfig) GetMaxEntries() int {
+	if s == nil || s.MaxEntries <= 0 {
+		return 1000
+	}
+	return s.MaxEntries
+}
+
+// SemanticCacheThreshold returns the least similarity of a semantic cache hit for a
+// configured model, and whether the model uses the cache
+func (c *Config) SemanticCacheThreshold(model string) (float64, bool) {
+	mc := c.Models[model].SemanticCache
+	if c.SemanticCache == nil || mc == nil || !mc.Enabled {
+		return 0, false
+	}
+	if mc.Threshold > 0 {
+		return mc.Threshold, true
+	}
+	return c.SemanticCache.GetThreshold(), true
+}
+
+// EmbeddingCacheConfig sets up the cache of embeddings. The embedding of each input of a
+// /v1/embeddings request is kept by model, input and the other parameters, such as
+// dimensions, and returned for the same input without calling a backend. The cache is
+// kept in memory, per instance.
+type EmbeddingCacheConfig struct {
+	TTLSeconds int `json:"ttl_seconds,omitempty"` // How long embeddings are served from the cache (default 86400)
+	MaxEntries int `json:"max_entries,omitempty"` // Embeddings kept, the least recently used evicted first (default 10000)
+}
+
+// GetTTL returns how long embeddings are served from the cache
+func (e *EmbeddingCacheConfig) GetTTL() time.Duration {
+	if e == nil || e.TTLSeconds <= 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(e.TTLSeconds) * time.Second
+}
+
+// GetMaxEntries returns how many embeddings are kept
+func (e *EmbeddingCacheConfig) GetMaxEntries() int {
+	if e == nil || e.MaxEntries <= 0 {
+		return 10000
+	}
+	return e.MaxEntries
+}
+
+// ModelSemanticCache enables the semantic cache for a model
+type ModelSemanticCache struct {
+	Enabled   bool    `json:"enabled"`
+	Threshold float64 `json:"threshold,omitempty"` // Overrides semantic_cache.threshold
+}
+
+// ValidateSemanticCache checks that the embedding model exists and the thresholds are
+// similarities, and that models only enable the cache when it is set up
+func (c *Config) ValidateSemanticCache() error {
+	var errs []string
+	if sc := c.SemanticCache; sc != nil {
+		if sc.EmbeddingModel == "" {
+			errs = append(errs, "  embedding_model is required")
+		} else if _, exists := c.Models[sc.EmbeddingModel]; !exists {
+			errs = append(errs, fmt.Sprintf("  embedding_model %q is not defined in models", sc.EmbeddingModel))
+		}
+		if sc.Threshold < 0 || sc.Threshold > 1 {
+			errs = append(errs, fmt.Sprintf("  threshold must be between 0 and 1 (got %g)", sc.Threshold))
+		}
+		if sc.TTLSeconds < 0 {
+			errs = append(errs, fmt.Sprintf("  ttl_seconds must not be negative (got %d)", sc.TTLSeconds))
+		}
+		if sc.MaxEntries < 0 {
+			errs = append(errs, fmt.Sprintf("  max_entries must not be negative (got %d)", sc.MaxEntries))
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Models)) {
+		mc := c.Models[name].SemanticCache
+		if mc == nil {
+			continue
+		}
+		if mc.Enabled && c.SemanticCache == nil {
+			errs = append(errs, fmt.Sprintf("  model %q enables the semantic cache, which requires semantic_cache", name))
+		}
+		if mc.Threshold < 0 || mc.Threshold > 1 {
+			errs = append(errs, fmt.Sprintf("  model %q threshold must be between 0 and 1 (got %g)", name, mc.Threshold))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("semantic_cache validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// ValidateEmbeddingCache checks that the embedding cache limits are not negative
+func (c *Config) ValidateEmbeddingCache() error {
+	ec := c.EmbeddingCache
+	if ec == nil {
+		return nil
+	}
+	var errs []string
+	if ec.TTLSeconds < 0 {
+		errs = append(errs, fmt.Sprintf("  ttl_seconds must not be negative (got %d)", ec.TTLSeconds))
+	}
+	if ec.MaxEntries < 0 {
+		errs = append(errs, fmt.Sprintf("  max_entries must not be negative (got %d)", ec.MaxEntries))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("embedding_cache validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
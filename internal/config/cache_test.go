@@ -0,0 +1,145 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSemanticCache(t *testing.T) {
+	tests := []struct {
+		name    string
+		cache   *SemanticCacheConfig
+		model   *ModelSemanticCache
+		wantErr string
+	}{
+		{name: "not configured"},
+		{name: "valid", cache: &SemanticCacheConfig{EmbeddingModel: "embed", Threshold: 0.9, TTLSeconds: 600, MaxEntries: 100}, model: &ModelSemanticCache{Enabled: true, Threshold: 0.97}},
+		{name: "set up without models", cache: &SemanticCacheConfig{EmbeddingModel: "embed"}},
+		{name: "no embedding model", cache: &SemanticCacheConfig{}, wantErr: "embedding_model is required"},
+		{name: "unknown embedding model", cache: &SemanticCacheConfig{EmbeddingModel: "missing"}, wantErr: `embedding_model "missing" is not defined`},
+		{name: "threshold out of range", cache: &SemanticCacheConfig{EmbeddingModel: "embed", Threshold: 1.5}, wantErr: "threshold must be between 0 and 1"},
+		{name: "negative ttl", cache: &SemanticCacheConfig{EmbeddingModel: "embed", TTLSeconds: -1}, wantErr: "ttl_seconds must not be negative"},
+		{name: "negative max entries", cache: &SemanticCacheConfig{EmbeddingModel: "embed", MaxEntries: -1}, wantErr: "max_entries must not be negative"},
+		{name: "model enabled without cache", model: &ModelSemanticCache{Enabled: true}, wantErr: `model "chat" enables the semantic cache`},
+		{name: "model threshold out of range", cache: &SemanticCacheConfig{EmbeddingModel: "embed"}, model: &ModelSemanticCache{Enabled: true, Threshold: -0.5}, wantErr: `model "chat" threshold must be between 0 and 1`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Models: map[string]ModelConfig{
+					"embed": {Strategy: "fallback"},
+					"chat":  {Strategy: "fallback", SemanticCache: tt.model},
+				},
+				SemanticCache: tt.cache,
+			}
+			err := cfg.ValidateSemanticCache()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+
+	cfg := &Config{
+		Models: map[string]ModelConfig{
+			"chat":   {SemanticCache: &ModelSemanticCache{Enabled: true}},
+			"strict": {SemanticCache: &ModelSemanticCache{Enabled: true, Threshold: 0.99}},
+			"off":    {SemanticCache: &ModelSemanticCache{Threshold: 0.99}},
+			"plain":  {},
+		},
+		SemanticCache: &SemanticCacheConfig{EmbeddingModel: "embed"},
+	}
+	for model, want := range map[string]float64{"chat": 0.95, "strict": 0.99} {
+		threshold, ok := cfg.SemanticCacheThreshold(model)
+		assert.True(t, ok, model)
+		assert.Equal(t, want, threshold, model)
+	}
+	for _, model := range []string{"off", "plain", "missing"} {
+		_, ok := cfg.SemanticCacheThreshold(model)
+		assert.False(t, ok, model)
+	}
+	assert.Equal(t, time.Hour, cfg.SemanticCache.GetTTL())
+	assert.Equal(t, 1000, cfg.SemanticCache.GetMaxEntries())
+}
+
+func TestValidateEmbeddingCache(t *testing.T) {
+	tests := []struct {
+		name    string
+		cache   *EmbeddingCacheConfig
+		wantErr string
+	}{
+		{name: "not configured"},
+		{name: "defaults", cache: &EmbeddingCacheConfig{}},
+		{name: "valid", cache: &EmbeddingCacheConfig{TTLSeconds: 600, MaxEntries: 100}},
+		{name: "negative ttl", cache: &EmbeddingCacheConfig{TTLSeconds: -1}, wantErr: "ttl_seconds must not be negative"},
+		{name: "negative max entries", cache: &EmbeddingCacheConfig{MaxEntries: -1}, wantErr: "max_entries must not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{EmbeddingCache: tt.cache}
+			err := cfg.ValidateEmbeddingCache()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+
+	ec := &EmbeddingCacheConfig{}
+	assert.Equal(t, 24*time.Hour, ec.GetTTL())
+	assert.Equal(t, 10000, ec.GetMaxEntries())
+	ec = &EmbeddingCacheConfig{TTLSeconds: 60, MaxEntries: 5}
+	assert.Equal(t, time.Minute, ec.GetTTL())
+	assert.Equal(t, 5, ec.GetMaxEntries())
+}
+
+func TestLoadFromPath_ModelSemanticCache(t *testing.T) {
+	write := func(models string) string {
+		configPath := filepath.Join(t.TempDir(), "config.json")
+		configContent := `{
+			"providers": {"local": {"url": "http://localhost:11434/v1", "models": ["llama3", "nomic-embed-text"]}},
+			"semantic_cache": {"embedding_model": "embed", "threshold": 0.9},
+			"models": {"embed": ["local/nomic-embed-text"], ` + models + `}
+		}`
+		if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+			t.Fatalf("failed to write temp config: %v", err)
+		}
+		return configPath
+	}
+
+	cfg, err := LoadFromPath(write(`
+		"chat": {"providers": ["local/llama3"], "semantic_cache": {"enabled": true}},
+		"strict": {"providers": ["local/llama3"], "semantic_cache": {"enabled": true, "threshold": 0.97}},
+		"off": {"providers": ["local/llama3"], "semantic_cache": {"threshold": 0.97}},
+		"plain": {"providers": ["local/llama3"]}`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, &ModelSemanticCache{Enabled: true, Threshold: 0.97}, cfg.Models["strict"].SemanticCache)
+	for model, want := range map[string]float64{"chat": 0.9, "strict": 0.97} {
+		threshold, ok := cfg.SemanticCacheThreshold(model)
+		assert.True(t, ok, model)
+		assert.Equal(t, want, threshold, model)
+	}
+	for _, model := range []string{"off", "plain"} {
+		_, ok := cfg.SemanticCacheThreshold(model)
+		assert.False(t, ok, model)
+	}
+
+	_, err = LoadFromPath(write(`"chat": {"providers": ["local/llama3"], "semantic_cache": true}`))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `model "chat": invalid semantic_cache config`)
+	}
+}
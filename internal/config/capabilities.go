@@ -0,0 +1,60 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Capability names a backend can declare; requests needing one skip backends without it
+const (
+	CapabilityTools      = "tools"      // Function/tool calling
+	CapabilityVision     = "vision"     // Image inputs
+	CapabilityJSONMode   = "json_mode"  // response_format json_object/json_schema
+	CapabilityEmbeddings = "embeddings" // Embedding requests
+)
+
+// validCapabilities lists the capability names accepted in config
+var validCapabilities = map[string]bool{
+	CapabilityTools:      true,
+	CapabilityVision:     true,
+	CapabilityJSONMode:   true,
+	CapabilityEmbeddings: true,
+}
+
+// BackendCapabilities returns the capabilities declared for a backend: its own list, else
+// its provider's. nil means nothing was declared and every capability is assumed.
+func (c *Config) BackendCapabilities(mp ModelProvider) []string {
+	if mp.Capabilities != nil {
+		return mp.Capabilities
+	}
+	return c.Providers[mp.Provider].Capabilities
+}
+
+// ValidateCapabilities checks that providers and backends only declare known capabilities
+func (c *Config) ValidateCapabilities() error {
+	var errs []string
+	check := func(owner string, capabilities []string) {
+		for _, name := range capabilities {
+			if !validCapabilities[name] {
+				errs = append(errs, fmt.Sprintf(
+					"  %s has unknown capability %q (must be 'tools', 'vision', 'json_mode', or 'embeddings')", owner, name))
+			}
+		}
+	}
+
+	for providerName, providerConfig := range c.Providers {
+		check(fmt.Sprintf("provider %q", providerName), providerConfig.Capabilities)
+	}
+	for modelName, modelConfig := range c.Models {
+		for i, p := range modelConfig.Providers {
+			check(fmt.Sprintf("model %q providers[%d]", modelName, i), p.Capabilities)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("capability validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
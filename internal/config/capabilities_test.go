@@ -0,0 +1,27 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateCapabilities(t *testing.T) {
+	cfg := &Config{
+		Providers: map[string]ProviderConfig{"local": {Capabilities: []string{"tools", "vision"}}},
+		Models: map[string]ModelConfig{"m": {Providers: []ModelProvider{
+			{Provider: "local", Model: "llava"},
+			{Provider: "local", Model: "phi", Capabilities: []string{}},
+		}}},
+	}
+	assert.NoError(t, cfg.ValidateCapabilities())
+	assert.Equal(t, []string{"tools", "vision"}, cfg.BackendCapabilities(cfg.Models["m"].Providers[0]))
+	assert.Empty(t, cfg.BackendCapabilities(cfg.Models["m"].Providers[1]))
+	assert.Nil(t, cfg.BackendCapabilities(ModelProvider{Provider: "other"}))
+
+	cfg.Models["m"].Providers[1].Capabilities = []string{"telepathy"}
+	err := cfg.ValidateCapabilities()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `model "m" providers[1] has unknown capability "telepathy"`)
+	}
+}
@@ -0,0 +1,60 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ChaosConfig injects failures into the chat, completion and embedding requests of a
+// backend, to exercise failover, circuit breaking and retries
+type ChaosConfig struct {
+	ErrorRate   float64 `json:"error_rate,omitempty"`   // Fraction of requests failed without reaching the backend (0-1)
+	ErrorStatus int     `json:"error_status,omitempty"` // HTTP status of injected errors (default 503)
+	LatencyMs   int     `json:"latency_ms,omitempty"`   // Delay added before each request
+	// StreamDropRate is the fraction of streams cut off after StreamDropAfter lines,
+	// without their end marker (0-1)
+	StreamDropRate  float64 `json:"stream_drop_rate,omitempty"`
+	StreamDropAfter int     `json:"stream_drop_after,omitempty"`
+	// Seed makes the injected failures the same on every run (random when 0)
+	Seed uint64 `json:"seed,omitempty"`
+}
+
+// GetErrorStatus returns the status of injected errors, 503 by default
+func (c ChaosConfig) GetErrorStatus() int {
+	if c.ErrorStatus == 0 {
+		return 503
+	}
+	return c.ErrorStatus
+}
+
+// ValidateChaos checks that failure injection rates are fractions and the injected
+// status is an error
+func (c *Config) ValidateChaos() error {
+	var errs []string
+
+	for modelName, modelConfig := range c.Models {
+		for i, p := range modelConfig.Providers {
+			chaos := p.Chaos
+			if chaos == nil {
+				continue
+			}
+			owner := fmt.Sprintf("model %q providers[%d] chaos", modelName, i)
+			if chaos.ErrorRate < 0 || chaos.ErrorRate > 1 || chaos.StreamDropRate < 0 || chaos.StreamDropRate > 1 {
+				errs = append(errs, fmt.Sprintf("  %s rates must be between 0 and 1", owner))
+			}
+			if status := chaos.GetErrorStatus(); status < 400 || status > 599 {
+				errs = append(errs, fmt.Sprintf("  %s error_status must be between 400 and 599", owner))
+			}
+			if chaos.LatencyMs < 0 || chaos.StreamDropAfter < 0 {
+				errs = append(errs, fmt.Sprintf("  %s latency_ms and stream_drop_after must not be negative", owner))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("chaos validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
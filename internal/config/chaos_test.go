@@ -0,0 +1,38 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateChaos(t *testing.T) {
+	tests := []struct {
+		name    string
+		chaos   *ChaosConfig
+		wantErr string
+	}{
+		{name: "none"},
+		{name: "valid", chaos: &ChaosConfig{ErrorRate: 0.5, ErrorStatus: 429, LatencyMs: 100, StreamDropRate: 1, StreamDropAfter: 2}},
+		{name: "rate above one", chaos: &ChaosConfig{ErrorRate: 1.5}, wantErr: "rates must be between 0 and 1"},
+		{name: "negative drop rate", chaos: &ChaosConfig{StreamDropRate: -0.1}, wantErr: "rates must be between 0 and 1"},
+		{name: "success status", chaos: &ChaosConfig{ErrorStatus: 200}, wantErr: "error_status must be between 400 and 599"},
+		{name: "negative latency", chaos: &ChaosConfig{LatencyMs: -1}, wantErr: "latency_ms and stream_drop_after must not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Providers: map[string]ProviderConfig{"local": {}},
+				Models:    map[string]ModelConfig{"m": {Providers: []ModelProvider{{Provider: "local", Model: "llama3", Chaos: tt.chaos}}}},
+			}
+			err := cfg.ValidateChaos()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), `model "m" providers[0] chaos `+tt.wantErr)
+		})
+	}
+}
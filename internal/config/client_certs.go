@@ -0,0 +1,94 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ClientCert is a client authenticated by the certificate it presents: one whose common
+// name or a subject alternative name matches one of its subjects. It is held to the
+// limits of an API key.
+type ClientCert struct {
+	Name          string   `json:"name"`                     // Label used in logs, the key name "cert:<name>"
+	Subjects      []string `json:"subjects"`                 // Common names, DNS names, emails or URIs, "*" patterns allowed
+	Models        []string `json:"models,omitempty"`         // As for api keys
+	Endpoints     []string `json:"endpoints,omitempty"`      // As for api keys
+	RPM           int      `json:"rpm,omitempty"`            // As for api keys
+	TPM           int      `json:"tpm,omitempty"`            // As for api keys
+	MonthlyTokens int64    `json:"monthly_tokens,omitempty"` // As for api keys
+	MonthlyBudget float64  `json:"monthly_budget,omitempty"` // As for api keys
+	Tenant        string   `json:"tenant,omitempty"`         // As for api keys
+	Tenants       []string `json:"tenants,omitempty"`        // As for api keys
+}
+
+// clientCertKeyPrefix starts the API key name of a client authenticated by its certificate
+const clientCertKeyPrefix = "cert:"
+
+// Matches reports whether a certificate name matches one of the client's subjects
+func (cc ClientCert) Matches(name string) bool {
+	return name != "" && (RuleMatch{Models: cc.Subjects}).MatchesModel(name)
+}
+
+// APIKey returns the API key of the client
+func (cc ClientCert) APIKey() APIKey {
+	return APIKey{
+		Name:          clientCertKeyPrefix + cc.Name,
+		Models:        cc.Models,
+		Endpoints:     cc.Endpoints,
+		RPM:           cc.RPM,
+		TPM:           cc.TPM,
+		MonthlyTokens: cc.MonthlyTokens,
+		MonthlyBudget: cc.MonthlyBudget,
+		Tenant:        cc.Tenant,
+		Tenants:       cc.Tenants,
+	}
+}
+
+// LookupClientCert returns the first client matched by one of the names of a certificate
+func (c *Config) LookupClientCert(names []string) (ClientCert, bool) {
+	for _, cc := range c.ClientCerts {
+		for _, name := range names {
+			if cc.Matches(name) {
+				return cc, true
+			}
+		}
+	}
+	return ClientCert{}, false
+}
+
+// ValidateClientCerts checks that certificate clients are named, have subjects and valid
+// limits, and can be authenticated by a listener verifying client certificates
+func (c *Config) ValidateClientCerts() error {
+	if len(c.ClientCerts) == 0 {
+		return nil
+	}
+	var errs []string
+	if !slices.ContainsFunc(c.Server.GetListeners(), func(l ListenerConfig) bool { return l.TLS != nil && l.TLS.ClientCAFile != "" }) {
+		errs = append(errs, "  client_certs require a listener with tls client_ca_file")
+	}
+	names := make(map[string]bool)
+	for i, cc := range c.ClientCerts {
+		name := cc.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+			errs = append(errs, fmt.Sprintf("  client cert %s has no name", name))
+		} else if names[name] {
+			errs = append(errs, fmt.Sprintf("  client cert %q is defined more than once", name))
+		}
+		names[name] = true
+		if len(cc.Subjects) == 0 || slices.Contains(cc.Subjects, "") {
+			errs = append(errs, fmt.Sprintf("  client cert %q needs non-empty subjects", name))
+		}
+		for _, problem := range cc.APIKey().LimitErrors() {
+			errs = append(errs, fmt.Sprintf("  client cert %q has %s", name, problem))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("client_certs validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
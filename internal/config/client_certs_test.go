@@ -0,0 +1,56 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateClientCerts(t *testing.T) {
+	mtls := ServerConfig{Listeners: []ListenerConfig{{Address: ":8443", TLS: &ListenerTLSConfig{CertFile: "c", KeyFile: "k", ClientCAFile: "ca"}}}}
+	tests := []struct {
+		name    string
+		server  ServerConfig
+		certs   []ClientCert
+		wantErr string
+	}{
+		{name: "not configured"},
+		{name: "valid", server: mtls, certs: []ClientCert{
+			{Name: "indexer", Subjects: []string{"indexer.internal", "spiffe://internal/indexer"}, Models: []string{"text-embedding-*"}},
+			{Name: "batch", Subjects: []string{"*.batch.internal"}, MonthlyBudget: 100},
+		}},
+		{name: "no mutual tls listener", certs: []ClientCert{{Name: "a", Subjects: []string{"a"}}}, wantErr: "require a listener with tls client_ca_file"},
+		{name: "unnamed", server: mtls, certs: []ClientCert{{Subjects: []string{"a"}}}, wantErr: "client cert #1 has no name"},
+		{name: "duplicate", server: mtls, certs: []ClientCert{{Name: "a", Subjects: []string{"a"}}, {Name: "a", Subjects: []string{"b"}}}, wantErr: "defined more than once"},
+		{name: "no subjects", server: mtls, certs: []ClientCert{{Name: "a"}}, wantErr: "needs non-empty subjects"},
+		{name: "bad limits", server: mtls, certs: []ClientCert{{Name: "a", Subjects: []string{"a"}, RPM: -1}}, wantErr: "a negative rpm"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&Config{Server: tt.server, ClientCerts: tt.certs}).ValidateClientCerts()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+
+	cfg := &Config{ClientCerts: []ClientCert{
+		{Name: "indexer", Subjects: []string{"indexer.internal"}, RPM: 60},
+		{Name: "batch", Subjects: []string{"*.batch.internal"}},
+	}}
+	cc, ok := cfg.LookupClientCert([]string{"job-1.batch.internal"})
+	assert.True(t, ok)
+	assert.Equal(t, "batch", cc.Name)
+	cc, ok = cfg.LookupClientCert([]string{"", "indexer.internal"})
+	assert.True(t, ok)
+	assert.Equal(t, APIKey{Name: "cert:indexer", RPM: 60}, cc.APIKey())
+	_, ok = cfg.LookupClientCert([]string{"batch.internal", ""})
+	assert.False(t, ok)
+	assert.Equal(t, ClientAuthRequire, (&ListenerTLSConfig{ClientCAFile: "ca"}).GetClientAuth())
+	assert.Empty(t, (&ListenerTLSConfig{}).GetClientAuth())
+}
@@ -3,31 +3,12 @@ package config
 
 import (
 	"bytes"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
 	"path/filepath"
-	"strings"
-	"sync"
-	"time"
-
-	"github.com/santhosh-tekuri/jsonschema/v6"
 )
 
-// Environment variable to control remote schema fetching
-// Set to "false" or "0" to disallow remote schemas (security hardening)
-const envAllowRemoteSchemas = "OPENMODEL_ALLOW_REMOTE_SCHEMAS"
-
-// Known schema checksums for integrity verification
-// Maps schema URLs to their expected SHA256 checksums
-var knownSchemaChecksums = map[string]string{
-	"https://raw.githubusercontent.com/macedot/openmodel/master/openmodel.schema.json": "62ccb4faffd88dad8f58a43f9811623a08a7584d2fa45ac7fe3b4d0560f34055",
-}
-
 // jsonErrorWithContext wraps JSON parsing errors with line number and context
 func jsonErrorWithContext(data []byte, err error, context string) error {
 	if err == nil {
@@ -96,7 +77,87 @@ type Config struct {
 	RateLimit  *RateLimitConfig          `json:"rate_limit,omitempty"`
 	HTTP       HTTPConfig                `json:"http,omitempty"`
 	Limits     LimitsConfig              `json:"limits,omitempty"`
-	configPath string                    `json:"-"` // Path to config file that was loaded
+	Management *ManagementConfig         `json:"management,omitempty"`
+	Moderation *ModerationConfig         `json:"moderation,omitempty"`
+	// Guardrails check the prompts of chat and completion requests before they are routed,
+	// rejecting or rewriting those that break a policy
+	Guardrails *GuardrailsConfig `json:"guardrails,omitempty"`
+	// SemanticCache answers chat completion requests to the models that enable it with the
+	// completion of an earlier request whose prompt means the same
+	SemanticCache *SemanticCacheConfig `json:"semantic_cache,omitempty"`
+	// EmbeddingCache keeps the embeddings of /v1/embeddings inputs, so inputs embedded
+	// before by the same model are not sent to a backend again
+	EmbeddingCache *EmbeddingCacheConfig `json:"embedding_cache,omitempty"`
+	// StructuredOutputs controls json_schema response validation
+	StructuredOutputs *StructuredOutputsConfig `json:"structured_outputs,omitempty"`
+	// State selects where backend health is kept (shared between replicas with redis)
+	State *StateConfig `json:"state,omitempty"`
+	// HealthCheck periodically probes every provider in the background
+	HealthCheck *HealthCheckConfig `json:"health_check,omitempty"`
+	// Readiness sets what /readyz requires besides a valid config
+	Readiness *ReadinessConfig `json:"readiness,omitempty"`
+	// Admin enables the authenticated runtime administration API
+	Admin *AdminConfig `json:"admin,omitempty"`
+	// Metrics serves Prometheus metrics at /metrics
+	Metrics *MetricsConfig `json:"metrics,omitempty"`
+	// Tracing exports OpenTelemetry traces of requests to an OTLP collector
+	Tracing *TracingConfig `json:"tracing,omitempty"`
+	// StatsD pushes the metrics to a StatsD or DogStatsD agent
+	StatsD *StatsDConfig `json:"statsd,omitempty"`
+	// Usage records token usage by day, model, backend and API key in SQLite
+	Usage *UsageConfig `json:"usage,omitempty"`
+	// BodyLog writes full request and response bodies to a separate file for debugging
+	BodyLog *BodyLogConfig `json:"body_log,omitempty"`
+	// Audit records administrative and configuration actions and auth failures
+	Audit *AuditConfig `json:"audit,omitempty"`
+	// LLMExport ships prompts, completions and token usage to Langfuse or LangSmith
+	LLMExport *LLMExportConfig `json:"llm_export,omitempty"`
+	// EventSink publishes a usage event per completed request to Kafka, NATS or a webhook
+	EventSink *EventSinkConfig `json:"event_sink,omitempty"`
+	// CostAlerts warn when the spend of a provider, backend or API key crosses a threshold
+	CostAlerts []CostAlert `json:"cost_alerts,omitempty"`
+	// Notifications post to webhooks when backends or whole models go down or recover
+	Notifications []Notification `json:"notifications,omitempty"`
+	// APIKeys require clients of the model APIs to present one of these keys, each limited
+	// to some models and endpoint groups (unset: the model APIs are open)
+	APIKeys []APIKey `json:"api_keys,omitempty"`
+	// KeyStore keeps API keys issued through /admin/keys or the keys command in SQLite
+	KeyStore *KeyStoreConfig `json:"key_store,omitempty"`
+	// JWT accepts JWTs from an OpenID Connect identity provider in place of API keys
+	JWT *JWTConfig `json:"jwt,omitempty"`
+	// ClientCerts authenticate clients by the verified certificates they present to a
+	// listener with client_ca_file, mapping certificate names to clients and their limits
+	ClientCerts []ClientCert `json:"client_certs,omitempty"`
+	// Tenants are the teams sharing the instance, each with its own models, backend
+	// chains, quota and usage; a request belongs to the tenant of its API key, and
+	// requests without one are refused
+	Tenants []Tenant `json:"tenants,omitempty"`
+	// TenantHeader names the request header with which API keys choose one of the tenants
+	// they are allowed (unset: only keys assign tenants)
+	TenantHeader string `json:"tenant_header,omitempty"`
+	// GlobalLimits cap the requests to the model APIs served at once and per second
+	// across all clients, queueing or rejecting the excess
+	GlobalLimits *GlobalLimitsConfig `json:"global_limits,omitempty"`
+	// Rules send chat requests with matching attributes to another model's backend chain
+	Rules []RoutingRule `json:"rules,omitempty"`
+	// Experiments split a model's traffic between backend chains for A/B comparison
+	Experiments []ExperimentConfig `json:"experiments,omitempty"`
+	// Plugins define custom provider types served by external processes, by type name
+	Plugins map[string]PluginConfig `json:"plugins,omitempty"`
+	// StrictEnv fails the load when a ${VAR} reference names an unset variable
+	StrictEnv bool `json:"strict_env,omitempty"`
+	// ConfigRefreshMs is how often a config loaded from a URL is polled for changes
+	// (requires restart, default 60000, -1 disables)
+	ConfigRefreshMs int    `json:"config_refresh_ms,omitempty"`
+	configPath      string `json:"-"` // Path or URL of the config that was loaded
+	profile         string `json:"-"` // Profile applied (OPENMODEL_PROFILE)
+}
+
+// PluginConfig defines a custom provider type served by an external process that speaks
+// JSON lines over stdio (see provider.PluginProvider); providers use it with "type"
+type PluginConfig struct {
+	Command []string          `json:"command"`       // Executable and arguments (supports ${VAR} expansion)
+	Env     map[string]string `json:"env,omitempty"` // Extra environment variables (values support ${VAR} expansion)
 }
 
 // RateLimitConfig holds rate limiting configuration
@@ -108,15 +169,24 @@ type RateLimitConfig struct {
 	TrustedProxies    []string `json:"trusted_proxies"` // List of trusted proxy IP ranges (CIDR notation supported)
 }
 
-// HTTPConfig holds HTTP client configuration
-type HTTPConfig struct {
-	TimeoutSeconds               int `json:"timeout_seconds"`
-	MaxIdleConns                 int `json:"max_idle_conns"`
-	MaxIdleConnsPerHost          int `json:"max_idle_conns_per_host"`
-	IdleConnTimeoutSeconds       int `json:"idle_conn_timeout_seconds"`
-	DialTimeoutSeconds           int `json:"dial_timeout_seconds"`
-	TLSHandshakeTimeoutSeconds   int `json:"tls_handshake_timeout_seconds"`
-	ResponseHeaderTimeoutSeconds int `json:"response_header_timeout_seconds"`
+// ManagementConfig holds settings for the Ollama model management passthrough
+// (/api/create, /api/copy, /api/delete)
+type ManagementConfig struct {
+	Enabled  bool   `json:"enabled"`
+	Provider string `json:"provider"` // Provider name of the managed Ollama backend
+}
+
+// StructuredOutputsConfig holds settings for response_format json_schema validation
+type StructuredOutputsConfig struct {
+	MaxRetries int `json:"max_retries"` // Extra backend attempts when output does not match the schema
+}
+
+// GetStructuredOutputRetries returns the number of retries on invalid structured output
+func (c *Config) GetStructuredOutputRetries() int {
+	if c.StructuredOutputs == nil || c.StructuredOutputs.MaxRetries < 0 {
+		return 0
+	}
+	return c.StructuredOutputs.MaxRetries
 }
 
 // LimitsConfig holds request/response size limits
@@ -139,304 +209,6 @@ func (c *Config) GetLimits() LimitsConfig {
 	return c.Limits
 }
 
-// ModelConfig holds configuration for a model alias
-type ModelConfig struct {
-	Strategy  string          `json:"strategy"`  // "fallback" | "round-robin" | "random", default "fallback"
-	Default   bool            `json:"default"`   // If true, this model is the default when no model is specified
-	Providers []ModelProvider `json:"providers"` // Resolved model providers
-}
-
-// Strategy constants
-const (
-	StrategyFallback   = "fallback"
-	StrategyRoundRobin = "round-robin"
-	StrategyRandom     = "random"
-)
-
-// GetThresholds returns the thresholds for a provider (provider-specific or global)
-func (c *Config) GetThresholds(providerName string) ThresholdsConfig {
-	if provider, ok := c.Providers[providerName]; ok && provider.Thresholds != nil {
-		return *provider.Thresholds
-	}
-	return c.Thresholds
-}
-
-// ResolveOwnModel resolves an "own model" (without provider prefix) to a ModelProvider
-// by searching through all providers for one that has this model in its models list
-// visited is used to detect circular references
-func (c *Config) ResolveOwnModel(modelName string, visited map[string]bool) (ModelProvider, bool) {
-	// Check for circular reference
-	if visited[modelName] {
-		return ModelProvider{}, false
-	}
-	// Mark as visited
-	visited[modelName] = true
-	defer func() { visited[modelName] = false }()
-
-	for providerName, provider := range c.Providers {
-		for _, m := range provider.Models {
-			if m == modelName {
-				return ModelProvider{Provider: providerName, Model: m}, true
-			}
-		}
-	}
-	return ModelProvider{}, false
-}
-
-// ServerConfig holds server settings
-type ServerConfig struct {
-	Port int    `json:"port"`
-	Host string `json:"host"`
-}
-
-// ProviderConfig holds provider connection settings
-type ProviderConfig struct {
-	URL        string            `json:"url"`        // Base URL for the provider (e.g., https://api.openai.com/v1)
-	APIKey     string            `json:"api_key"`    // API key (supports ${VAR} expansion)
-	ApiMode    string            `json:"api_mode"`   // API format: "openai" or "anthropic" (required)
-	Models     []string          `json:"models"`     // List of models available on this provider
-	Thresholds *ThresholdsConfig `json:"thresholds"` // Provider-specific thresholds (optional, defaults to global)
-}
-
-// ModelProvider represents a provider model in the chain (legacy format)
-type ModelProvider struct {
-	Provider string `json:"provider"` // Provider name from providers config
-	Model    string `json:"model"`    // Model name on that provider
-}
-
-// ProviderModel represents a model in "provider/model" format
-type ProviderModel string
-
-// ParseProviderModel parses a "provider/model" string into a ModelProvider
-func ParseProviderModel(pm ProviderModel) (ModelProvider, error) {
-	// Use / as separator: provider/model (model can contain /)
-	parts := strings.Split(string(pm), "/")
-	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
-		return ModelProvider{}, fmt.Errorf("invalid provider model format: %q (expected 'provider/model')", pm)
-	}
-	return ModelProvider{Provider: parts[0], Model: strings.Join(parts[1:], "/")}, nil
-}
-
-// parseModelEntries parses model entries from an array of raw values
-func parseModelEntries(cfg *Config, modelName string, entries []any, visited map[string]bool) ([]ModelProvider, error) {
-	result := make([]ModelProvider, 0, len(entries))
-	for _, entry := range entries {
-		switch v := entry.(type) {
-		case string:
-			// Check if it's "provider/model" format or an "own model"
-			// Check if it's "provider@model" format (or "provider/model" legacy) or an "own model"
-			// Check if it's "provider/model" format (model can contain /) or an "own model"
-			if strings.Contains(v, "/") {
-				// It's "provider/model" format
-				mp, err := ParseProviderModel(ProviderModel(v))
-				if err != nil {
-					return nil, fmt.Errorf("invalid model %q: %w", modelName, err)
-				}
-				// Validate provider exists
-				provider, ok := cfg.Providers[mp.Provider]
-				if !ok {
-					return nil, fmt.Errorf("model %q references unknown provider %q", modelName, mp.Provider)
-				}
-				// Validate model exists in provider's models list (if models list is defined)
-				if len(provider.Models) > 0 {
-					modelExists := false
-					for _, m := range provider.Models {
-						if m == mp.Model {
-							modelExists = true
-							break
-						}
-					}
-					if !modelExists {
-						return nil, fmt.Errorf("model %q references model %q not found in provider %q's models list", modelName, mp.Model, mp.Provider)
-					}
-				}
-				result = append(result, mp)
-			} else {
-				// It's an "own model" - resolve to first provider that has it
-				// Note: visited map tracks resolution chain to detect true circular references
-				mp, found := cfg.ResolveOwnModel(v, visited)
-				if !found {
-					return nil, fmt.Errorf("own model %q not found in any provider's models list", v)
-				}
-				result = append(result, mp)
-			}
-
-		case map[string]any:
-			// Object format {provider, model}
-			provider, _ := v["provider"].(string)
-			model, _ := v["model"].(string)
-			if provider == "" || model == "" {
-				return nil, fmt.Errorf("invalid model entry in %q: missing provider or model", modelName)
-			}
-			providerCfg, ok := cfg.Providers[provider]
-			if !ok {
-				return nil, fmt.Errorf("model %q references unknown provider %q", modelName, provider)
-			}
-			// Validate model exists in provider's models list (if models list is defined)
-			if len(providerCfg.Models) > 0 {
-				modelExists := false
-				for _, m := range providerCfg.Models {
-					if m == model {
-						modelExists = true
-						break
-					}
-				}
-				if !modelExists {
-					return nil, fmt.Errorf("model %q references model %q not found in provider %q's models list", modelName, model, provider)
-				}
-			}
-			result = append(result, ModelProvider{Provider: provider, Model: model})
-
-		default:
-			return nil, fmt.Errorf("invalid model entry type in %q", modelName)
-		}
-	}
-	return result, nil
-}
-
-// ToProviderModel converts a ModelProvider to ProviderModel format
-func (mp ModelProvider) ToProviderModel() ProviderModel {
-	return ProviderModel(mp.Provider + "/" + mp.Model)
-}
-
-// ThresholdsConfig holds failure threshold settings
-type ThresholdsConfig struct {
-	FailuresBeforeSwitch int `json:"failures_before_switch"`
-	InitialTimeout       int `json:"initial_timeout_ms"`
-	MaxTimeout           int `json:"max_timeout_ms"`
-}
-
-// configWithSchema is used to extract the $schema field before full parsing
-type configWithSchema struct {
-	Schema string `json:"$schema"`
-}
-
-// SchemaCache caches compiled JSON schemas
-type SchemaCache struct {
-	mu        sync.RWMutex
-	compilers map[string]*jsonschema.Compiler
-}
-
-var (
-	// Global schema cache instance
-	schemaCache = &SchemaCache{
-		compilers: make(map[string]*jsonschema.Compiler),
-	}
-)
-
-func getSchemaCompiler(schemaURL string) (*jsonschema.Compiler, error) {
-	// Check cache first (read lock)
-	schemaCache.mu.RLock()
-	if compiler, exists := schemaCache.compilers[schemaURL]; exists {
-		schemaCache.mu.RUnlock()
-		return compiler, nil
-	}
-	schemaCache.mu.RUnlock()
-
-	// Acquire write lock and double-check
-	schemaCache.mu.Lock()
-	defer schemaCache.mu.Unlock()
-
-	// Double-check after acquiring write lock
-	if compiler, exists := schemaCache.compilers[schemaURL]; exists {
-		return compiler, nil
-	}
-
-	// Compile new schema
-	compiler := jsonschema.NewCompiler()
-
-	var schemaData any
-	var schemaBytes []byte
-
-	isRemote := strings.HasPrefix(schemaURL, "http://") || strings.HasPrefix(schemaURL, "https://")
-
-	if isRemote {
-		// Check if remote schemas are allowed
-		if !isRemoteSchemaAllowed() {
-			return nil, fmt.Errorf("remote schema fetching is disabled (set %s=true to allow)", envAllowRemoteSchemas)
-		}
-
-		// Warn about remote schema fetching
-		fmt.Fprintf(os.Stderr, "Warning: Fetching remote schema from %s (potential security risk)\n", schemaURL)
-
-		client := &http.Client{Timeout: 5 * time.Second} // Reduced timeout for better availability
-		resp, err := client.Get(schemaURL)
-		if err != nil {
-			return nil, fmt.Errorf("failed to fetch schema: %w", err)
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("schema fetch returned status %d", resp.StatusCode)
-		}
-
-		// Read all bytes for checksum verification
-		schemaBytes, err = readAllWithLimit(resp.Body, 10*1024*1024) // 10MB limit
-		if err != nil {
-			return nil, fmt.Errorf("failed to read schema: %w", err)
-		}
-
-		// Verify checksum if known
-		if expectedChecksum, known := knownSchemaChecksums[schemaURL]; known && expectedChecksum != "" {
-			actualChecksum := sha256Sum(schemaBytes)
-			if actualChecksum != expectedChecksum {
-				return nil, fmt.Errorf("schema checksum mismatch: expected %s, got %s", expectedChecksum, actualChecksum)
-			}
-		}
-
-		if err := json.Unmarshal(schemaBytes, &schemaData); err != nil {
-			return nil, fmt.Errorf("failed to parse schema: %w", err)
-		}
-	} else {
-		schemaPath := schemaURL
-		if _, err := os.Stat(schemaPath); os.IsNotExist(err) {
-			schemaPath = filepath.Join(os.Getenv("HOME"), ".config", "openmodel", schemaURL)
-		}
-		if _, err := os.Stat(schemaPath); os.IsNotExist(err) {
-			schemaPath = filepath.Join(filepath.Dir(os.Args[0]), schemaURL)
-		}
-
-		var err error
-		schemaBytes, err = os.ReadFile(schemaPath)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read schema file: %w", err)
-		}
-
-		if err := json.Unmarshal(schemaBytes, &schemaData); err != nil {
-			return nil, fmt.Errorf("failed to parse schema: %w", err)
-		}
-	}
-
-	if err := compiler.AddResource(schemaURL, schemaData); err != nil {
-		return nil, fmt.Errorf("failed to add schema: %w", err)
-	}
-
-	// Store in cache
-	schemaCache.compilers[schemaURL] = compiler
-
-	return compiler, nil
-}
-
-// isRemoteSchemaAllowed checks if remote schema fetching is allowed
-func isRemoteSchemaAllowed() bool {
-	val := os.Getenv(envAllowRemoteSchemas)
-	if val == "" {
-		return true // Default: allow for backward compatibility
-	}
-	return strings.ToLower(val) != "false" && val != "0"
-}
-
-// readAllWithLimit reads from reader with a size limit to prevent memory exhaustion
-func readAllWithLimit(r io.Reader, limit int64) ([]byte, error) {
-	return io.ReadAll(io.LimitReader(r, limit))
-}
-
-// sha256Sum computes the SHA256 checksum of data and returns it as hex string
-func sha256Sum(data []byte) string {
-	hash := sha256.Sum256(data)
-	return hex.EncodeToString(hash[:])
-}
-
 // DefaultConfig returns the default configuration
 func DefaultConfig() *Config {
 	return &Config{
@@ -470,6 +242,7 @@ func DefaultConfig() *Config {
 			DialTimeoutSeconds:           10,
 			TLSHandshakeTimeoutSeconds:   10,
 			ResponseHeaderTimeoutSeconds: 30,
+			KeepAliveSeconds:             30,
 		},
 		Limits: LimitsConfig{
 			MaxRequestBodyBytes:  1 * 1024 * 1024, // 1MB
@@ -479,29 +252,9 @@ func DefaultConfig() *Config {
 	}
 }
 
-// expandEnvVars expands environment variables in ${VAR} format
-func expandEnvVars(s string) string {
-	for {
-		start := strings.Index(s, "${")
-		if start == -1 {
-			break
-		}
-		end := strings.Index(s[start:], "}")
-		if end == -1 {
-			break
-		}
-		end += start
-		varName := s[start+2 : end]
-		envValue := os.Getenv(varName)
-		s = s[:start] + envValue + s[end+1:]
-	}
-	return s
-}
-
-// expandProviderEnvVars expands environment variables in provider config
-func expandProviderEnvVars(pc *ProviderConfig) {
-	pc.APIKey = expandEnvVars(pc.APIKey)
-	pc.URL = expandEnvVars(pc.URL)
+// GetProfile returns the profile applied to the config, "" when none was selected
+func (c *Config) GetProfile() string {
+	return c.profile
 }
 
 // GetConfigPath returns the path to the config file
@@ -524,13 +277,76 @@ func (c *Config) GetConfigPath() string {
 
 // Validate runs the repository-level configuration validations used at startup and reload time.
 func (c *Config) Validate() error {
-	if err := c.ValidateProviderReferences(); err != nil {
-		return err
+	for _, validate := range c.validators() {
+		if err := validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateAll runs every validation Validate does and returns all their errors, rather
+// than stopping at the first
+func (c *Config) ValidateAll() []error {
+	var errs []error
+	for _, validate := range c.validators() {
+		if err := validate(); err != nil {
+			errs = append(errs, err)
+		}
 	}
-	if err := c.ValidateDefaultModels(); err != nil {
-		return err
+	return errs
+}
+
+// validators lists the validations of Validate, in order
+func (c *Config) validators() []func() error {
+	return []func() error{
+		c.ValidateProviderReferences,
+		c.ValidateDefaultModels,
+		c.ValidateReadiness,
+		c.ValidateModeration,
+		c.ValidateGuardrails,
+		c.ValidateSemanticCache,
+		c.ValidateEmbeddingCache,
+		c.ValidateStrategies,
+		c.ValidateRetryPolicies,
+		c.ValidateMirrors,
+		c.ValidateAdmission,
+		c.ValidateGlobalLimits,
+		c.ValidateDiscovery,
+		c.ValidateTimeouts,
+		c.ValidateThresholds,
+		c.ValidateSchedules,
+		c.ValidateErrorRates,
+		c.ValidateRules,
+		c.ValidateExperiments,
+		c.ValidateAdmin,
+		c.ValidateAPIKeys,
+		c.ValidateJWT,
+		c.ValidateClientCerts,
+		c.ValidateTenants,
+		c.ValidateTracing,
+		c.ValidateStatsD,
+		c.ValidateBodyLog,
+		c.ValidateAudit,
+		c.ValidateLLMExport,
+		c.ValidateEventSink,
+		c.ValidateProviderLimits,
+		c.ValidateCostAlerts,
+		c.ValidateNotifications,
+		c.ValidateProviderHeaders,
+		c.ValidateProxies,
+		c.ValidateListeners,
+		c.ValidateHTTP,
+		c.ValidateCredentialSources,
+		c.ValidateState,
+		c.ValidateCapabilities,
+		c.ValidateOptionRules,
+		c.ValidateReplay,
+		c.ValidateEcho,
+		c.ValidateChaos,
+		c.ValidateModelMetadata,
+		c.ValidateApiModes,
 	}
-	return c.ValidateApiModes()
 }
 
 // GetConfigPath returns the path to the config file (standalone function for backward compatibility)
@@ -559,6 +375,31 @@ func GetConfigPaths() (currentDirPath, userConfigPath string) {
 	return currentDirPath, userConfigPath
 }
 
+// Overrides are settings given on the command line. They take precedence over the config
+// file and the environment, and are applied again on each reload.
+type Overrides struct {
+	Host     string
+	Port     int
+	LogLevel string
+}
+
+// Apply sets the overridden settings in cfg; zero values leave the config's own
+func (o Overrides) Apply(cfg *Config) {
+	if o.Host != "" {
+		cfg.Server.Host = o.Host
+	}
+	if o.Port != 0 {
+		cfg.Server.Port = o.Port
+	}
+	// A host or port given on the command line is the one address to listen on
+	if o.Host != "" || o.Port != 0 {
+		cfg.Server.Listeners = nil
+	}
+	if o.LogLevel != "" {
+		cfg.LogLevel = o.LogLevel
+	}
+}
+
 // getLogLevel returns the log level from environment or default
 func getLogLevel() string {
 	if level := os.Getenv("OPENMODEL_LOG_LEVEL"); level != "" {
@@ -570,13 +411,14 @@ func getLogLevel() string {
 // Load loads configuration from the specified path or default locations.
 // If path is empty, it merges current directory config with user config.
 // Current directory config has higher priority when merging.
+// A path may also be a URL to fetch the config from (see IsRemote).
 func Load(path string) (*Config, error) {
 	// If explicit path provided, load from that path
 	if path != "" {
-		if _, err := os.Stat(path); os.IsNotExist(err) {
+		if _, err := os.Stat(path); os.IsNotExist(err) && !IsRemote(path) {
 			return nil, fmt.Errorf("config file not found: %s", path)
 		}
-		data, err := os.ReadFile(path)
+		data, err := readConfigSource(path)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read config file: %w", err)
 		}
@@ -592,12 +434,19 @@ func Load(path string) (*Config, error) {
 	currentDirPath, userConfigPath := GetConfigPaths()
 
 	// Try current directory first
-	currentDirData, currentDirErr := os.ReadFile(currentDirPath)
+	currentDirData, currentDirErr := readConfigSource(currentDirPath)
+	if currentDirErr != nil && !os.IsNotExist(currentDirErr) {
+		return nil, fmt.Errorf("failed to read config file: %w", currentDirErr)
+	}
 
 	// Try user config
 	var userConfigData []byte
 	if userConfigPath != "" {
-		userConfigData, _ = os.ReadFile(userConfigPath)
+		var err error
+		userConfigData, err = readConfigFile(userConfigPath)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
 	}
 
 	// If neither exists, return defaults
@@ -658,7 +507,8 @@ func mergeAndParseConfig(lowerPriorityData, higherPriorityData []byte) (*Config,
 	return parseConfig(mergedData, true)
 }
 
-// mergeMaps recursively merges two maps, with b taking priority over a
+// mergeMaps recursively merges two maps, with b taking priority over a. A null in b
+// removes the key.
 func mergeMaps(a, b map[string]any) map[string]any {
 	result := make(map[string]any)
 
@@ -669,7 +519,9 @@ func mergeMaps(a, b map[string]any) map[string]any {
 
 	// Override with b
 	for k, v := range b {
-		if vMap, ok := v.(map[string]any); ok {
+		if v == nil {
+			delete(result, k)
+		} else if vMap, ok := v.(map[string]any); ok {
 			// If both are maps, recurse
 			if aMap, ok := result[k].(map[string]any); ok {
 				result[k] = mergeMaps(aMap, vMap)
@@ -701,26 +553,32 @@ func LoadFromPath(path string) (*Config, error) {
 
 // parseConfig parses configuration data with optional schema validation
 func parseConfig(data []byte, validateSchema bool) (*Config, error) {
+	data, profile, err := applyProfile(data)
+	if err != nil {
+		return nil, err
+	}
+
 	// Extract $schema field
 	var schemaConfig configWithSchema
 	if err := jsonUnmarshalWithLines(data, &schemaConfig, "parsing $schema field"); err != nil {
 		return nil, err
 	}
 
-	// Validate schema is present if validation is enabled
-	if validateSchema && schemaConfig.Schema == "" {
-		return nil, fmt.Errorf("config file must contain $schema field")
+	// Validate against the built-in schema unless $schema names another one
+	schemaURL := schemaConfig.Schema
+	if schemaURL == "" {
+		schemaURL = DefaultSchemaURL
 	}
 
 	// Validate schema if enabled
-	if validateSchema && schemaConfig.Schema != "" {
+	if validateSchema {
 		// Get schema compiler
-		compiler, err := getSchemaCompiler(schemaConfig.Schema)
+		compiler, err := getSchemaCompiler(schemaURL)
 		if err != nil {
 			// Log warning but continue - schema validation is not critical
 			fmt.Fprintf(os.Stderr, "Warning: schema validation unavailable: %v\n", err)
 		} else if compiler != nil {
-			compiledSchema, err := compiler.Compile(schemaConfig.Schema)
+			compiledSchema, err := compiler.Compile(schemaURL)
 			if err != nil {
 				return nil, fmt.Errorf("failed to compile schema: %w", err)
 			}
@@ -738,15 +596,52 @@ func parseConfig(data []byte, validateSchema bool) (*Config, error) {
 
 	// Parse config into a temporary structure to handle both model formats
 	var tempConfig struct {
-		Server     ServerConfig              `json:"server"`
-		Providers  map[string]ProviderConfig `json:"providers"`
-		Models     map[string]any            `json:"models"`
-		LogLevel   string                    `json:"log_level"`
-		Thresholds ThresholdsConfig          `json:"thresholds"`
+		Server         ServerConfig              `json:"server"`
+		Providers      map[string]ProviderConfig `json:"providers"`
+		Models         map[string]any            `json:"models"`
+		LogLevel       string                    `json:"log_level"`
+		Thresholds     ThresholdsConfig          `json:"thresholds"`
+		Management     *ManagementConfig         `json:"management"`
+		Moderation     *ModerationConfig         `json:"moderation"`
+		Guardrails     *GuardrailsConfig         `json:"guardrails"`
+		SemanticCache  *SemanticCacheConfig      `json:"semantic_cache"`
+		EmbeddingCache *EmbeddingCacheConfig     `json:"embedding_cache"`
+
+		StructuredOutputs *StructuredOutputsConfig `json:"structured_outputs"`
+		State             *StateConfig             `json:"state"`
+		HealthCheck       *HealthCheckConfig       `json:"health_check"`
+		Readiness         *ReadinessConfig         `json:"readiness"`
+		Admin             *AdminConfig             `json:"admin"`
+		Metrics           *MetricsConfig           `json:"metrics"`
+		Tracing           *TracingConfig           `json:"tracing"`
+		StatsD            *StatsDConfig            `json:"statsd"`
+		Usage             *UsageConfig             `json:"usage"`
+		BodyLog           *BodyLogConfig           `json:"body_log"`
+		Audit             *AuditConfig             `json:"audit"`
+		LLMExport         *LLMExportConfig         `json:"llm_export"`
+		EventSink         *EventSinkConfig         `json:"event_sink"`
+		CostAlerts        []CostAlert              `json:"cost_alerts"`
+		Notifications     []Notification           `json:"notifications"`
+		HTTP              json.RawMessage          `json:"http"`
+		APIKeys           []APIKey                 `json:"api_keys"`
+		KeyStore          *KeyStoreConfig          `json:"key_store"`
+		GlobalLimits      *GlobalLimitsConfig      `json:"global_limits"`
+		JWT               *JWTConfig               `json:"jwt"`
+		ClientCerts       []ClientCert             `json:"client_certs"`
+		Tenants           []Tenant                 `json:"tenants"`
+		TenantHeader      string                   `json:"tenant_header"`
+		Rules             []RoutingRule            `json:"rules"`
+		Experiments       []ExperimentConfig       `json:"experiments"`
+		Plugins           map[string]PluginConfig  `json:"plugins"`
+		StrictEnv         bool                     `json:"strict_env"`
+		ConfigRefreshMs   int                      `json:"config_refresh_ms"`
 	}
 	if err := jsonUnmarshalWithLines(data, &tempConfig, "parsing config structure"); err != nil {
 		return nil, err
 	}
+	if err := checkEnvVars(data, tempConfig.StrictEnv); err != nil {
+		return nil, err
+	}
 
 	cfg := DefaultConfig()
 	// Only override non-zero values from tempConfig
@@ -756,6 +651,14 @@ func parseConfig(data []byte, validateSchema bool) (*Config, error) {
 	if tempConfig.Server.Host != "" {
 		cfg.Server.Host = tempConfig.Server.Host
 	}
+	cfg.Server.DrainTimeoutMs = tempConfig.Server.DrainTimeoutMs
+	cfg.Server.Listeners = tempConfig.Server.Listeners
+	cfg.Server.ReadTimeoutMs = tempConfig.Server.ReadTimeoutMs
+	cfg.Server.WriteTimeoutMs = tempConfig.Server.WriteTimeoutMs
+	cfg.Server.IdleTimeoutMs = tempConfig.Server.IdleTimeoutMs
+	cfg.Server.StreamWriteTimeoutMs = tempConfig.Server.StreamWriteTimeoutMs
+	cfg.Server.MaxHeaderBytes = tempConfig.Server.MaxHeaderBytes
+	cfg.Server.DisabledEndpoints = tempConfig.Server.DisabledEndpoints
 	if len(tempConfig.Providers) > 0 {
 		cfg.Providers = tempConfig.Providers
 	}
@@ -767,6 +670,58 @@ func parseConfig(data []byte, validateSchema bool) (*Config, error) {
 	if tempConfig.Thresholds.FailuresBeforeSwitch != 0 {
 		cfg.Thresholds = tempConfig.Thresholds
 	}
+	cfg.Thresholds.ErrorRate = tempConfig.Thresholds.ErrorRate
+	cfg.Management = tempConfig.Management
+	cfg.Moderation = tempConfig.Moderation
+	cfg.Guardrails = tempConfig.Guardrails
+	cfg.SemanticCache = tempConfig.SemanticCache
+	cfg.EmbeddingCache = tempConfig.EmbeddingCache
+	cfg.StructuredOutputs = tempConfig.StructuredOutputs
+	cfg.State = tempConfig.State
+	cfg.HealthCheck = tempConfig.HealthCheck
+	cfg.Readiness = tempConfig.Readiness
+	cfg.Admin = tempConfig.Admin
+	cfg.Metrics = tempConfig.Metrics
+	cfg.Tracing = tempConfig.Tracing
+	cfg.StatsD = tempConfig.StatsD
+	cfg.Usage = tempConfig.Usage
+	cfg.BodyLog = tempConfig.BodyLog
+	cfg.Audit = tempConfig.Audit
+	cfg.LLMExport = tempConfig.LLMExport
+	cfg.EventSink = tempConfig.EventSink
+	cfg.CostAlerts = tempConfig.CostAlerts
+	cfg.Notifications = tempConfig.Notifications
+	cfg.APIKeys = tempConfig.APIKeys
+	cfg.KeyStore = tempConfig.KeyStore
+	cfg.GlobalLimits = tempConfig.GlobalLimits
+	cfg.JWT = tempConfig.JWT
+	cfg.ClientCerts = tempConfig.ClientCerts
+	cfg.Tenants = tempConfig.Tenants
+	cfg.TenantHeader = tempConfig.TenantHeader
+	cfg.Rules = tempConfig.Rules
+	cfg.Experiments = tempConfig.Experiments
+	cfg.StrictEnv = tempConfig.StrictEnv
+	cfg.ConfigRefreshMs = tempConfig.ConfigRefreshMs
+	cfg.profile = profile
+	for name, plugin := range tempConfig.Plugins {
+		for i, arg := range plugin.Command {
+			plugin.Command[i] = expandEnvVars(arg)
+		}
+		for key, value := range plugin.Env {
+			plugin.Env[key] = expandEnvVars(value)
+		}
+		if cfg.Plugins == nil {
+			cfg.Plugins = make(map[string]PluginConfig)
+		}
+		cfg.Plugins[name] = plugin
+	}
+	// Settings left out of the http section keep their defaults
+	if len(tempConfig.HTTP) > 0 {
+		if err := json.Unmarshal(tempConfig.HTTP, &cfg.HTTP); err != nil {
+			return nil, fmt.Errorf("invalid http config: %w", err)
+		}
+		cfg.HTTP.Proxy = expandEnvVars(cfg.HTTP.Proxy)
+	}
 
 	// Extract model names in order from raw JSON to preserve config file order
 	var rawConfig struct {
@@ -812,18 +767,80 @@ func parseConfig(data []byte, validateSchema bool) (*Config, error) {
 		case map[string]any:
 			// New format: object with strategy and providers
 			if strategy, ok := v["strategy"].(string); ok && strategy != "" {
-				modelConfig.Strategy = strategy
+				modelConfig.Strategy = NormalizeStrategy(strategy)
 			}
 			if defaultVal, ok := v["default"].(bool); ok {
 				modelConfig.Default = defaultVal
 			}
+			if hedgeAfter, ok := v["hedge_after_ms"].(float64); ok {
+				modelConfig.HedgeAfterMs = int(hedgeAfter)
+			}
+			if stickyHeader, ok := v["sticky_header"].(string); ok {
+				modelConfig.StickyHeader = stickyHeader
+			}
+			if retryRaw, ok := v["retry"]; ok {
+				retry, err := parseRetryConfig(retryRaw)
+				if err != nil {
+					return nil, fmt.Errorf("model %q: %w", modelName, err)
+				}
+				modelConfig.Retry = retry
+			}
+			if mirrorRaw, ok := v["mirror"]; ok {
+				mirror, err := parseMirrorConfig(mirrorRaw)
+				if err != nil {
+					return nil, fmt.Errorf("model %q: %w", modelName, err)
+				}
+				modelConfig.Mirror = mirror
+			}
+			if admissionRaw, ok := v["admission"]; ok {
+				admission, err := parseAdmissionConfig(admissionRaw)
+				if err != nil {
+					return nil, fmt.Errorf("model %q: %w", modelName, err)
+				}
+				modelConfig.Admission = admission
+			}
+			if timeoutsRaw, ok := v["timeouts"]; ok {
+				timeouts, err := parseTimeoutsConfig(timeoutsRaw)
+				if err != nil {
+					return nil, fmt.Errorf("model %q: %w", modelName, err)
+				}
+				modelConfig.Timeouts = timeouts
+			}
+			if discoverRaw, ok := v["discover"]; ok {
+				discover, err := parseDiscoverConfig(discoverRaw)
+				if err != nil {
+					return nil, fmt.Errorf("model %q: %w", modelName, err)
+				}
+				modelConfig.Discover = discover
+			}
+			if metadataRaw, ok := v["metadata"]; ok {
+				metadata, err := parseModelMetadata(metadataRaw)
+				if err != nil {
+					return nil, fmt.Errorf("model %q: %w", modelName, err)
+				}
+				modelConfig.Metadata = metadata
+			}
+			if thresholdsRaw, ok := v["thresholds"]; ok {
+				thresholds, err := parseThresholdsConfig(thresholdsRaw)
+				if err != nil {
+					return nil, fmt.Errorf("model %q: %w", modelName, err)
+				}
+				modelConfig.Thresholds = thresholds
+			}
+			if semanticCacheRaw, ok := v["semantic_cache"]; ok {
+				semanticCache, err := parseModelSemanticCache(semanticCacheRaw)
+				if err != nil {
+					return nil, fmt.Errorf("model %q: %w", modelName, err)
+				}
+				modelConfig.SemanticCache = semanticCache
+			}
 			if providersRaw, ok := v["providers"].([]any); ok {
 				providers, err := parseModelEntries(cfg, modelName, providersRaw, visited)
 				if err != nil {
 					return nil, err
 				}
 				modelConfig.Providers = providers
-			} else {
+			} else if modelConfig.Discover == nil {
 				return nil, fmt.Errorf("model %q missing providers array", modelName)
 			}
 
@@ -847,64 +864,3 @@ func parseConfig(data []byte, validateSchema bool) (*Config, error) {
 
 	return cfg, nil
 }
-
-// ValidateProviderReferences checks that all model providers are defined
-// in the providers section. Returns an error with details if any references
-// are invalid.
-func (c *Config) ValidateProviderReferences() error {
-	var errs []string
-
-	for modelName, modelConfig := range c.Models {
-		for i, providerRef := range modelConfig.Providers {
-			// Check provider exists
-			if _, exists := c.Providers[providerRef.Provider]; !exists {
-				errs = append(errs, fmt.Sprintf(
-					"  model %q providers[%d] references undefined provider %q",
-					modelName, i, providerRef.Provider))
-			}
-		}
-	}
-
-	if len(errs) > 0 {
-		return fmt.Errorf("provider validation failed:\n%s",
-			strings.Join(errs, "\n"))
-	}
-	return nil
-}
-
-// ValidateDefaultModels checks that at most one model has default: true.
-// Returns an error if multiple models are marked as default.
-func (c *Config) ValidateDefaultModels() error {
-	var defaultModels []string
-	for modelName, modelConfig := range c.Models {
-		if modelConfig.Default {
-			defaultModels = append(defaultModels, modelName)
-		}
-	}
-
-	if len(defaultModels) > 1 {
-		return fmt.Errorf("multiple models marked as default: %s (only one model can be default)", strings.Join(defaultModels, ", "))
-	}
-	return nil
-}
-
-// ValidateApiModes checks that all provider api_mode values are valid.
-// Returns an error if any provider has an invalid api_mode (empty is allowed for passthrough).
-func (c *Config) ValidateApiModes() error {
-	validApiModes := map[string]bool{"": true, "openai": true, "anthropic": true}
-	var errs []string
-
-	for providerName, providerConfig := range c.Providers {
-		if !validApiModes[providerConfig.ApiMode] {
-			errs = append(errs, fmt.Sprintf(
-				"  provider %q has invalid api_mode: %q (must be 'openai', 'anthropic', or empty for passthrough)",
-				providerName, providerConfig.ApiMode))
-		}
-	}
-
-	if len(errs) > 0 {
-		return fmt.Errorf("api_mode validation failed:\n%s",
-			strings.Join(errs, "\n"))
-	}
-	return nil
-}
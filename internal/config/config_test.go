@@ -1,23 +1,15 @@
 package config
 
 import (
-	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
-func TestKnownSchemaChecksum_IsPinned(t *testing.T) {
-	const schemaURL = "https://raw.githubusercontent.com/macedot/openmodel/master/openmodel.schema.json"
-
-	checksum, ok := knownSchemaChecksums[schemaURL]
-	assert.True(t, ok)
-	assert.Len(t, checksum, 64)
-	assert.NotEqual(t, "known-sha256-to-be-verified", checksum)
-}
-
 func TestConfigValidate(t *testing.T) {
 	t.Run("valid config", func(t *testing.T) {
 		cfg := &Config{
@@ -59,6 +51,9 @@ func TestDefaultConfig(t *testing.T) {
 		if cfg.Server.Host != "localhost" {
 			t.Errorf("expected host localhost, got %s", cfg.Server.Host)
 		}
+		if cfg.Server.GetDrainTimeout() != 30*time.Second {
+			t.Errorf("expected drain timeout 30s, got %s", cfg.Server.GetDrainTimeout())
+		}
 
 		// Verify providers map is initialized
 		if cfg.Providers == nil {
@@ -101,78 +96,58 @@ func TestDefaultConfig(t *testing.T) {
 	})
 }
 
-// TestExpandEnvVars tests the expandEnvVars function
-func TestExpandEnvVars(t *testing.T) {
-	origEnv := map[string]string{
-		"TEST_VAR":      "testvalue",
-		"ANOTHER_VAR":   "anothervalue",
-		"EMPTY_VAR":     "",
-		"SPECIAL_CHARS": "hello world!",
-		"PATH_VAR":      "/usr/local/bin",
-	}
-	for k, v := range origEnv {
-		os.Setenv(k, v)
-	}
-	defer func() {
-		for k := range origEnv {
-			os.Unsetenv(k)
-		}
-	}()
+func TestLoadFromPath_EnvVars(t *testing.T) {
+	t.Setenv("OPENMODEL_TEST_KEY", "sk-test")
 
 	tests := []struct {
-		name     string
-		input    string
-		expected string
+		name    string
+		config  string
+		wantErr []string
 	}{
-		{name: "no env vars", input: "hello world", expected: "hello world"},
-		{name: "single env var", input: "prefix${TEST_VAR}suffix", expected: "prefixtestvaluesuffix"},
-		{name: "multiple env vars", input: "${TEST_VAR}-${ANOTHER_VAR}", expected: "testvalue-anothervalue"},
-		{name: "env var at start", input: "${TEST_VAR}suffix", expected: "testvaluesuffix"},
-		{name: "env var at end", input: "prefix${TEST_VAR}", expected: "prefixtestvalue"},
-		{name: "empty env var", input: "prefix${EMPTY_VAR}suffix", expected: "prefixsuffix"},
-		{name: "env var with special chars", input: "value is ${SPECIAL_CHARS}", expected: "value is hello world!"},
-		{name: "env var in path", input: "${PATH_VAR}/file", expected: "/usr/local/bin/file"},
-		{name: "unclosed env var stays as is", input: "prefix${UNCLOSED", expected: "prefix${UNCLOSED"},
-		{name: "empty braces expands to empty", input: "prefix${}suffix", expected: "prefixsuffix"},
-		{name: "undefined env var expands to empty", input: "prefix${UNDEFINED_VAR}suffix", expected: "prefixsuffix"},
-		{name: "first match expands var only", input: "prefix${TEST}VAR}suffix", expected: "prefixVAR}suffix"},
-		{name: "multiple same env var", input: "${TEST_VAR} and ${TEST_VAR}", expected: "testvalue and testvalue"},
+		{
+			name:   "unset var expands to empty",
+			config: `{"providers": {"p": {"url": "http://localhost", "api_key": "${OPENMODEL_TEST_MISSING}"}}}`,
+		},
+		{
+			name:   "strict with every var set",
+			config: `{"strict_env": true, "providers": {"p": {"url": "${OPENMODEL_TEST_URL:-http://localhost}", "api_key": "${OPENMODEL_TEST_KEY}"}}}`,
+		},
+		{
+			name:    "strict with unset vars",
+			config:  `{"strict_env": true, "providers": {"p": {"url": "${OPENMODEL_TEST_URL}", "api_key": "${OPENMODEL_TEST_MISSING}"}, "q": {"url": "${OPENMODEL_TEST_URL}"}}}`,
+			wantErr: []string{"OPENMODEL_TEST_URL is not set", "OPENMODEL_TEST_MISSING is not set"},
+		},
+		{
+			name:    "required var without strict",
+			config:  `{"providers": {"p": {"url": "http://localhost", "api_key": "${OPENMODEL_TEST_MISSING:?set it to the lab key}"}}}`,
+			wantErr: []string{"OPENMODEL_TEST_MISSING: set it to the lab key"},
+		},
+		{
+			name:   "escaped reference",
+			config: `{"strict_env": true, "providers": {"p": {"url": "http://localhost", "headers": {"X-Template": "$${OPENMODEL_TEST_MISSING}"}}}}`,
+		},
 	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.json")
+			if !assert.NoError(t, os.WriteFile(configPath, []byte(tt.config), 0644)) {
+				return
+			}
 
-	for _, tc := range tests {
-		t.Run(tc.name, func(t *testing.T) {
-			result := expandEnvVars(tc.input)
-			if result != tc.expected {
-				t.Errorf("expandEnvVars(%q) = %q, want %q", tc.input, result, tc.expected)
+			_, err := LoadFromPath(configPath)
+			if len(tt.wantErr) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				for _, want := range tt.wantErr {
+					assert.Equal(t, 1, strings.Count(err.Error(), want), "error lists %q once", want)
+				}
 			}
 		})
 	}
 }
 
-// TestExpandProviderEnvVars tests the expandProviderEnvVars function
-func TestExpandProviderEnvVars(t *testing.T) {
-	defer os.Unsetenv("TEST_API_KEY")
-	os.Setenv("TEST_API_KEY", "secret123")
-
-	t.Run("expands API key and URL", func(t *testing.T) {
-		pc := &ProviderConfig{
-			URL:    "http://localhost:${PORT}/v1",
-			APIKey: "${TEST_API_KEY}",
-		}
-		os.Setenv("PORT", "8080")
-		defer os.Unsetenv("PORT")
-
-		expandProviderEnvVars(pc)
-
-		if pc.APIKey != "secret123" {
-			t.Errorf("APIKey = %q, want %q", pc.APIKey, "secret123")
-		}
-		if pc.URL != "http://localhost:8080/v1" {
-			t.Errorf("URL = %q, want %q", pc.URL, "http://localhost:8080/v1")
-		}
-	})
-}
-
 // TestLoadFromPath tests the LoadFromPath function
 func TestLoadFromPath(t *testing.T) {
 	t.Run("valid config file", func(t *testing.T) {
@@ -318,10 +293,10 @@ func TestLoad(t *testing.T) {
 		}
 	})
 
-	t.Run("missing schema field", func(t *testing.T) {
+	t.Run("missing schema field uses the built-in schema", func(t *testing.T) {
 		tmpDir := t.TempDir()
 		configPath := filepath.Join(tmpDir, "config.json")
-		configContent := `{"server": {"port": 9000}, "providers": {}, "models": {}}`
+		configContent := `{"server": {"port": 9000, "host": "localhost"}, "providers": {}, "models": {}}`
 
 		if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
 			t.Fatalf("failed to write temp config: %v", err)
@@ -329,9 +304,20 @@ func TestLoad(t *testing.T) {
 
 		os.Setenv("OPENMODEL_CONFIG", configPath)
 
-		_, err := Load("")
-		if err == nil {
-			t.Error("Load() expected error for missing $schema field")
+		cfg, err := Load("")
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if cfg.Server.Port != 9000 {
+			t.Errorf("Port = %d, want 9000", cfg.Server.Port)
+		}
+
+		// The built-in schema still rejects invalid configs
+		if err := os.WriteFile(configPath, []byte(`{"server": {"port": 9000}, "providers": {}, "models": {}}`), 0644); err != nil {
+			t.Fatalf("failed to write temp config: %v", err)
+		}
+		if _, err := Load(""); err == nil || !strings.Contains(err.Error(), "missing property 'host'") {
+			t.Errorf("Load() expected a schema error for the missing host, got %v", err)
 		}
 	})
 
@@ -410,187 +396,6 @@ func TestGetLogLevel(t *testing.T) {
 	})
 }
 
-// TestGetSchemaCompiler tests the getSchemaCompiler function
-func TestGetSchemaCompiler(t *testing.T) {
-	t.Run("local schema file", func(t *testing.T) {
-		// Create a minimal valid JSON schema
-		tmpDir := t.TempDir()
-		schemaPath := filepath.Join(tmpDir, "schema.json")
-		schemaContent := `{
-			"$schema": "http://json-schema.org/draft-07/schema#",
-			"type": "object"
-		}`
-		if err := os.WriteFile(schemaPath, []byte(schemaContent), 0644); err != nil {
-			t.Fatalf("failed to write schema: %v", err)
-		}
-
-		_, err := getSchemaCompiler(schemaPath)
-		if err != nil {
-			t.Fatalf("getSchemaCompiler() error = %v", err)
-		}
-	})
-
-	t.Run("nonexistent schema file", func(t *testing.T) {
-		_, err := getSchemaCompiler("/nonexistent/schema.json")
-		if err == nil {
-			t.Error("getSchemaCompiler() expected error for nonexistent file")
-		}
-	})
-
-	t.Run("cache hit returns cached compiler", func(t *testing.T) {
-		// Create a minimal valid JSON schema
-		tmpDir := t.TempDir()
-		schemaPath := filepath.Join(tmpDir, "schema_cache.json")
-		schemaContent := `{
-			"$schema": "http://json-schema.org/draft-07/schema#",
-			"type": "object"
-		}`
-		if err := os.WriteFile(schemaPath, []byte(schemaContent), 0644); err != nil {
-			t.Fatalf("failed to write schema: %v", err)
-		}
-
-		// First call - populates cache
-		compiler1, err := getSchemaCompiler(schemaPath)
-		if err != nil {
-			t.Fatalf("first getSchemaCompiler() error = %v", err)
-		}
-
-		// Second call - should return cached compiler
-		compiler2, err := getSchemaCompiler(schemaPath)
-		if err != nil {
-			t.Fatalf("second getSchemaCompiler() error = %v", err)
-		}
-
-		// Both should be the same instance (cache hit)
-		if compiler1 != compiler2 {
-			t.Error("expected same compiler instance on cache hit")
-		}
-	})
-
-	t.Run("different schemas produce different compilers", func(t *testing.T) {
-		// Create two minimal valid JSON schemas
-		tmpDir := t.TempDir()
-		schemaPath1 := filepath.Join(tmpDir, "schema1.json")
-		schemaPath2 := filepath.Join(tmpDir, "schema2.json")
-		schemaContent := `{
-			"$schema": "http://json-schema.org/draft-07/schema#",
-			"type": "object"
-		}`
-
-		if err := os.WriteFile(schemaPath1, []byte(schemaContent), 0644); err != nil {
-			t.Fatalf("failed to write schema1: %v", err)
-		}
-		if err := os.WriteFile(schemaPath2, []byte(schemaContent), 0644); err != nil {
-			t.Fatalf("failed to write schema2: %v", err)
-		}
-
-		// Get compiler for first schema
-		compiler1, err := getSchemaCompiler(schemaPath1)
-		if err != nil {
-			t.Fatalf("getSchemaCompiler(schema1) error = %v", err)
-		}
-
-		// Get compiler for second schema - should be different
-		compiler2, err := getSchemaCompiler(schemaPath2)
-		if err != nil {
-			t.Fatalf("getSchemaCompiler(schema2) error = %v", err)
-		}
-
-		// Different schemas should produce different compilers
-		if compiler1 == compiler2 {
-			t.Error("expected different compiler instances for different schemas")
-		}
-	})
-}
-
-// TestGetSchemaCompilerConcurrent tests thread safety of the schema compiler cache
-func TestGetSchemaCompilerConcurrent(t *testing.T) {
-	// Create a minimal valid JSON schema
-	tmpDir := t.TempDir()
-	schemaPath := filepath.Join(tmpDir, "schema_concurrent.json")
-	schemaContent := `{
-		"$schema": "http://json-schema.org/draft-07/schema#",
-		"type": "object"
-	}`
-	if err := os.WriteFile(schemaPath, []byte(schemaContent), 0644); err != nil {
-		t.Fatalf("failed to write schema: %v", err)
-	}
-
-	// Run multiple concurrent calls - should not panic
-	// This tests the cache is thread-safe
-	done := make(chan bool, 10)
-	for i := 0; i < 10; i++ {
-		go func() {
-			defer func() {
-				done <- true
-			}()
-			_, _ = getSchemaCompiler(schemaPath)
-		}()
-	}
-
-	// Wait for all goroutines to complete
-	for i := 0; i < 10; i++ {
-		<-done
-	}
-}
-
-// TestLoad_SchemaValidationFailure tests that schema validation failures are detected
-func TestLoad_SchemaValidationFailure(t *testing.T) {
-	// Save original env
-	origConfig := os.Getenv("OPENMODEL_CONFIG")
-	defer func() {
-		if origConfig != "" {
-			os.Setenv("OPENMODEL_CONFIG", origConfig)
-		} else {
-			os.Unsetenv("OPENMODEL_CONFIG")
-		}
-	}()
-
-	// Create temp directory with custom schema that validates port minimum
-	tmpDir := t.TempDir()
-	schemaPath := filepath.Join(tmpDir, "schema.json")
-	schemaContent := `{
-		"$schema": "http://json-schema.org/draft-07/schema#",
-		"type": "object",
-		"properties": {
-			"server": {
-				"type": "object",
-				"properties": {
-					"port": {"type": "integer", "minimum": 1},
-					"host": {"type": "string"}
-				},
-				"required": ["port", "host"]
-			}
-		},
-		"required": ["server"]
-	}`
-	err := os.WriteFile(schemaPath, []byte(schemaContent), 0644)
-	assert.NoError(t, err)
-
-	// Create config that violates schema (port = 0 is below minimum of 1)
-	configPath := filepath.Join(tmpDir, "config.json")
-	configContent := fmt.Sprintf(`{
-		"$schema": "%s",
-		"server": {"port": 0, "host": "localhost"}
-	}`, schemaPath)
-
-	err = os.WriteFile(configPath, []byte(configContent), 0644)
-	assert.NoError(t, err)
-
-	os.Setenv("OPENMODEL_CONFIG", configPath)
-
-	_, err = Load("")
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "validation failed")
-}
-
-// TestGetSchemaCompiler_InvalidSchemaURL tests error handling for invalid schema URLs
-func TestGetSchemaCompiler_InvalidSchemaURL(t *testing.T) {
-	// Test with malformed schema URL (invalid host that will fail to connect)
-	_, err := getSchemaCompiler("http://invalid:9999/schema.json")
-	assert.Error(t, err)
-}
-
 // BenchmarkDefaultConfig benchmarks the DefaultConfig function - this is the hot path
 // as it's called on every server startup
 func BenchmarkDefaultConfig(b *testing.B) {
@@ -599,422 +404,51 @@ func BenchmarkDefaultConfig(b *testing.B) {
 	}
 }
 
-// TestModelValidation tests model reference validation
-func TestModelValidation(t *testing.T) {
-	t.Run("valid provider/model format", func(t *testing.T) {
-		tmpDir := t.TempDir()
-		configPath := filepath.Join(tmpDir, "config.json")
-		configContent := `{
-			"$schema": "http://json-schema.org/draft-07/schema#",
-			"server": {"port": 12345, "host": "localhost"},
-			"providers": {
-				"test": {
-					"url": "http://localhost:8080/v1",
-					"models": ["model1", "model2"]
-				}
-			},
-			"models": {
-				"my-model": {
-					"strategy": "fallback",
-				"providers": ["test/model1"]
-				}
-			},
-			"log_level": "info",
-			"thresholds": {"failures_before_switch": 3, "initial_timeout_ms": 10000, "max_timeout_ms": 300000}
-		}`
-
-		if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
-			t.Fatalf("failed to write temp config: %v", err)
-		}
-
-		cfg, err := LoadFromPath(configPath)
-		assert.NoError(t, err)
-		assert.Len(t, cfg.Models["my-model"].Providers, 1)
-		assert.Equal(t, "test", cfg.Models["my-model"].Providers[0].Provider)
-		assert.Equal(t, "model1", cfg.Models["my-model"].Providers[0].Model)
-	})
-
-	t.Run("invalid provider reference", func(t *testing.T) {
-		tmpDir := t.TempDir()
-		configPath := filepath.Join(tmpDir, "config.json")
-		configContent := `{
-			"$schema": "http://json-schema.org/draft-07/schema#",
-			"server": {"port": 12345, "host": "localhost"},
-			"providers": {
-				"test": {
-					"url": "http://localhost:8080/v1",
-					"models": ["model1"]
-				}
-			},
-			"models": {
-				"my-model": {
-					"strategy": "fallback",
-				"providers": ["unknown/model1"]
-				}
-			},
-			"log_level": "info",
-			"thresholds": {"failures_before_switch": 3, "initial_timeout_ms": 10000, "max_timeout_ms": 300000}
-		}`
-
-		if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
-			t.Fatalf("failed to write temp config: %v", err)
-		}
-
-		_, err := LoadFromPath(configPath)
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "unknown provider")
-	})
-
-	t.Run("invalid model reference in provider list", func(t *testing.T) {
-		tmpDir := t.TempDir()
-		configPath := filepath.Join(tmpDir, "config.json")
-		configContent := `{
-			"$schema": "http://json-schema.org/draft-07/schema#",
-			"server": {"port": 12345, "host": "localhost"},
-			"providers": {
-				"test": {
-					"url": "http://localhost:8080/v1",
-					"models": ["model1", "model2"]
-				}
-			},
-			"models": {
-				"my-model": {
-					"strategy": "fallback",
-				"providers": ["test/nonexistent"]
-				}
-			},
-			"log_level": "info",
-			"thresholds": {"failures_before_switch": 3, "initial_timeout_ms": 10000, "max_timeout_ms": 300000}
-		}`
-
-		if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
-			t.Fatalf("failed to write temp config: %v", err)
-		}
-
-		_, err := LoadFromPath(configPath)
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "not found in provider")
-	})
-
-	t.Run("valid own model reference", func(t *testing.T) {
-		tmpDir := t.TempDir()
-		configPath := filepath.Join(tmpDir, "config.json")
-		configContent := `{
-			"$schema": "http://json-schema.org/draft-07/schema#",
-			"server": {"port": 12345, "host": "localhost"},
-			"providers": {
-				"test": {
-					"url": "http://localhost:8080/v1",
-					"models": ["model1", "model2"]
-				}
-			},
-			"models": {
-				"my-model": {
-					"strategy": "fallback",
-					"providers": ["model1"]
-				}
-			},
-			"log_level": "info",
-			"thresholds": {"failures_before_switch": 3, "initial_timeout_ms": 10000, "max_timeout_ms": 300000}
-		}`
-
-		if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
-			t.Fatalf("failed to write temp config: %v", err)
-		}
-
-		cfg, err := LoadFromPath(configPath)
-		assert.NoError(t, err)
-		assert.Len(t, cfg.Models["my-model"].Providers, 1)
-		assert.Equal(t, "test", cfg.Models["my-model"].Providers[0].Provider)
-		assert.Equal(t, "model1", cfg.Models["my-model"].Providers[0].Model)
-	})
-
-	t.Run("invalid own model reference", func(t *testing.T) {
-		tmpDir := t.TempDir()
-		configPath := filepath.Join(tmpDir, "config.json")
-		configContent := `{
-			"$schema": "http://json-schema.org/draft-07/schema#",
-			"server": {"port": 12345, "host": "localhost"},
-			"providers": {
-				"test": {
-					"url": "http://localhost:8080/v1",
-					"models": ["model1", "model2"]
-				}
-			},
-			"models": {
-				"my-model": {
-					"strategy": "fallback",
-					"providers": ["nonexistent"]
-				}
-			},
-			"log_level": "info",
-			"thresholds": {"failures_before_switch": 3, "initial_timeout_ms": 10000, "max_timeout_ms": 300000}
-		}`
-
-		if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
-			t.Fatalf("failed to write temp config: %v", err)
-		}
-
-		_, err := LoadFromPath(configPath)
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "not found in any provider's models list")
-	})
-
-	t.Run("provider/model without models list definition passes", func(t *testing.T) {
-		tmpDir := t.TempDir()
-		configPath := filepath.Join(tmpDir, "config.json")
-		configContent := `{
-			"$schema": "http://json-schema.org/draft-07/schema#",
-			"server": {"port": 12345, "host": "localhost"},
-			"providers": {
-				"test": {
-					"url": "http://localhost:8080/v1"
-				}
-			},
-			"models": {
-				"my-model": {
-					"strategy": "fallback",
-				"providers": ["test/any-model"]
-				}
-			},
-			"log_level": "info",
-			"thresholds": {"failures_before_switch": 3, "initial_timeout_ms": 10000, "max_timeout_ms": 300000}
-		}`
-
-		if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
-			t.Fatalf("failed to write temp config: %v", err)
-		}
-
-		cfg, err := LoadFromPath(configPath)
-		assert.NoError(t, err)
-		assert.Len(t, cfg.Models["my-model"].Providers, 1)
-		assert.Equal(t, "test", cfg.Models["my-model"].Providers[0].Provider)
-		assert.Equal(t, "any-model", cfg.Models["my-model"].Providers[0].Model)
-	})
-
-	t.Run("valid object format model reference", func(t *testing.T) {
-		tmpDir := t.TempDir()
-		configPath := filepath.Join(tmpDir, "config.json")
-		configContent := `{
-			"$schema": "http://json-schema.org/draft-07/schema#",
-			"server": {"port": 12345, "host": "localhost"},
-			"providers": {
-				"test": {
-					"url": "http://localhost:8080/v1",
-					"models": ["model1"]
-				}
-			},
-			"models": {
-				"my-model": {
-					"strategy": "fallback",
-					"providers": [{"provider": "test", "model": "model1"}]
-				}
-			},
-			"log_level": "info",
-			"thresholds": {"failures_before_switch": 3, "initial_timeout_ms": 10000, "max_timeout_ms": 300000}
-		}`
-
-		if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
-			t.Fatalf("failed to write temp config: %v", err)
-		}
-
-		cfg, err := LoadFromPath(configPath)
-		assert.NoError(t, err)
-		assert.Len(t, cfg.Models["my-model"].Providers, 1)
-		assert.Equal(t, "test", cfg.Models["my-model"].Providers[0].Provider)
-		assert.Equal(t, "model1", cfg.Models["my-model"].Providers[0].Model)
-	})
-
-	t.Run("invalid object format model reference", func(t *testing.T) {
-		tmpDir := t.TempDir()
-		configPath := filepath.Join(tmpDir, "config.json")
-		configContent := `{
-			"$schema": "http://json-schema.org/draft-07/schema#",
-			"server": {"port": 12345, "host": "localhost"},
-			"providers": {
-				"test": {
-					"url": "http://localhost:8080/v1",
-					"models": ["model1"]
-				}
-			},
-			"models": {
-				"my-model": {
-					"strategy": "fallback",
-					"providers": [{"provider": "test", "model": "nonexistent"}]
-				}
-			},
-			"log_level": "info",
-			"thresholds": {"failures_before_switch": 3, "initial_timeout_ms": 10000, "max_timeout_ms": 300000}
-		}`
-
-		if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
-			t.Fatalf("failed to write temp config: %v", err)
-		}
-
-		_, err := LoadFromPath(configPath)
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "not found in provider")
-	})
-}
-
-// TestValidateProviderReferences tests the ValidateProviderReferences function
-func TestValidateProviderReferences(t *testing.T) {
-	t.Run("valid references", func(t *testing.T) {
-		cfg := &Config{
-			Providers: map[string]ProviderConfig{
-				"openai": {URL: "https://api.openai.com/v1"},
-				"ollama": {URL: "http://localhost:11434/v1"},
-			},
-			Models: map[string]ModelConfig{
-				"gpt-4": {
-					Strategy: StrategyFallback,
-					Providers: []ModelProvider{
-						{Provider: "openai", Model: "gpt-4"},
-						{Provider: "ollama", Model: "llama2"},
-					},
-				},
-			},
-		}
-
-		err := cfg.ValidateProviderReferences()
-		assert.NoError(t, err)
-	})
-
-	t.Run("missing provider reference", func(t *testing.T) {
-		cfg := &Config{
-			Providers: map[string]ProviderConfig{
-				"openai": {URL: "https://api.openai.com/v1"},
-			},
-			Models: map[string]ModelConfig{
-				"gpt-4": {
-					Strategy: StrategyFallback,
-					Providers: []ModelProvider{
-						{Provider: "openai", Model: "gpt-4"},
-						{Provider: "missing", Model: "claude"}, // This provider doesn't exist
-					},
-				},
-			},
-		}
-
-		err := cfg.ValidateProviderReferences()
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "missing")
-		assert.Contains(t, err.Error(), `"gpt-4"`)
-	})
-
-	t.Run("multiple missing providers", func(t *testing.T) {
-		cfg := &Config{
-			Providers: map[string]ProviderConfig{
-				"local": {URL: "http://localhost:11434/v1"},
-			},
-			Models: map[string]ModelConfig{
-				"model1": {
-					Strategy: StrategyFallback,
-					Providers: []ModelProvider{
-						{Provider: "missing1", Model: "m1"},
-					},
-				},
-				"model2": {
-					Strategy: StrategyFallback,
-					Providers: []ModelProvider{
-						{Provider: "missing2", Model: "m2"},
-					},
-				},
-			},
-		}
-
-		err := cfg.ValidateProviderReferences()
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "missing1")
-		assert.Contains(t, err.Error(), "missing2")
-	})
-
-	t.Run("empty models", func(t *testing.T) {
-		cfg := &Config{
-			Providers: map[string]ProviderConfig{
-				"openai": {URL: "https://api.openai.com/v1"},
-			},
-			Models: map[string]ModelConfig{},
-		}
-
-		err := cfg.ValidateProviderReferences()
-		assert.NoError(t, err)
-	})
-
-	t.Run("empty providers", func(t *testing.T) {
-		cfg := &Config{
-			Providers: map[string]ProviderConfig{},
-			Models: map[string]ModelConfig{
-				"gpt-4": {
-					Strategy: StrategyFallback,
-					Providers: []ModelProvider{
-						{Provider: "openai", Model: "gpt-4"},
-					},
-				},
-			},
-		}
-
-		err := cfg.ValidateProviderReferences()
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "openai")
-	})
-}
-
-func TestValidateDefaultModels(t *testing.T) {
-	t.Run("no models with default", func(t *testing.T) {
-		cfg := &Config{
-			Models: map[string]ModelConfig{
-				"model-a": {Strategy: "fallback"},
-				"model-b": {Strategy: "fallback"},
-			},
-		}
-		err := cfg.ValidateDefaultModels()
-		assert.NoError(t, err)
-	})
-
-	t.Run("single model with default", func(t *testing.T) {
-		cfg := &Config{
-			Models: map[string]ModelConfig{
-				"model-a": {Strategy: "fallback", Default: true},
-				"model-b": {Strategy: "fallback"},
-			},
-		}
-		err := cfg.ValidateDefaultModels()
-		assert.NoError(t, err)
-	})
-
-	t.Run("multiple models with default", func(t *testing.T) {
-		cfg := &Config{
-			Models: map[string]ModelConfig{
-				"model-a": {Strategy: "fallback", Default: true},
-				"model-b": {Strategy: "fallback", Default: true},
-			},
-		}
-		err := cfg.ValidateDefaultModels()
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "multiple models marked as default")
-		assert.Contains(t, err.Error(), "model-a")
-		assert.Contains(t, err.Error(), "model-b")
-	})
-
-	t.Run("three models with default", func(t *testing.T) {
-		cfg := &Config{
-			Models: map[string]ModelConfig{
-				"model-a": {Strategy: "fallback", Default: true},
-				"model-b": {Strategy: "fallback", Default: true},
-				"model-c": {Strategy: "fallback", Default: true},
-			},
-		}
-		err := cfg.ValidateDefaultModels()
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "multiple models marked as default")
-	})
+func TestLoadFromPath_TopLevelSections(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.json")
+	configContent := `{
+		"providers": {"local": {"url": "http://localhost:11434/v1", "models": ["llama3"]}},
+		"server": {"port": 8080, "host": "0.0.0.0", "drain_timeout_ms": 60000, "write_timeout_ms": 300000, "stream_write_timeout_ms": -1, "max_header_bytes": 16384},
+		"models": {"chat": ["local/llama3"], "chat-b": ["local/llama3"]},
+		"state": {"backend": "redis", "redis_url": "redis://cache:6379/1", "key_prefix": "om", "sync_interval_ms": 250},
+		"health_check": {"enabled": true, "interval_ms": 10000, "endpoint": "/models"},
+		"http": {"timeout_seconds": 300, "dial_timeout_seconds": 3},
+		"thresholds": {"error_rate": {"percent": 50, "requests": 20}},
+		"rules": [{"name": "vision", "match": {"has_images": true, "headers": {"X-Tier": "*"}}, "model": "chat"}],
+		"experiments": [{"name": "local-vs-b", "model": "chat", "arms": [{"name": "a", "model": "chat"}, {"name": "b", "model": "chat-b", "weight": 3}]}]
+	}`
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("failed to write temp config: %v", err)
+	}
 
-	t.Run("empty models", func(t *testing.T) {
-		cfg := &Config{
-			Models: map[string]ModelConfig{},
-		}
-		err := cfg.ValidateDefaultModels()
-		assert.NoError(t, err)
-	})
+	cfg, err := LoadFromPath(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, cfg.Server.GetDrainTimeout())
+	assert.Equal(t, 30*time.Second, cfg.Server.GetReadTimeout())
+	assert.Equal(t, 5*time.Minute, cfg.Server.GetWriteTimeout())
+	assert.Equal(t, time.Duration(0), cfg.Server.GetStreamWriteTimeout(), "-1 disables the stream write timeout")
+	assert.Equal(t, 16384, cfg.Server.GetMaxHeaderBytes())
+	assert.Equal(t, StateBackendRedis, cfg.State.GetBackend())
+	assert.Equal(t, "redis://cache:6379/1", cfg.State.GetRedisURL())
+	assert.Equal(t, "om", cfg.State.GetKeyPrefix())
+	assert.Equal(t, 250*time.Millisecond, cfg.State.GetSyncInterval())
+	assert.True(t, cfg.HealthCheck.IsEnabled())
+	assert.Equal(t, 10*time.Second, cfg.HealthCheck.GetInterval())
+	assert.Equal(t, "/models", cfg.HealthCheck.GetEndpoint())
+	assert.Equal(t, 300, cfg.HTTP.TimeoutSeconds)
+	assert.Equal(t, 3, cfg.HTTP.DialTimeoutSeconds)
+	assert.Equal(t, 30, cfg.HTTP.ResponseHeaderTimeoutSeconds, "unset values keep their default")
+	assert.Equal(t, 3, cfg.Thresholds.FailuresBeforeSwitch, "an error rate alone keeps the default thresholds")
+	assert.True(t, cfg.Thresholds.ErrorRate.IsEnabled())
+	if assert.Len(t, cfg.Rules, 1) {
+		assert.Equal(t, "chat", cfg.Rules[0].Model)
+		assert.True(t, *cfg.Rules[0].Match.HasImages)
+		assert.Equal(t, "*", cfg.Rules[0].Match.Headers["X-Tier"])
+	}
+	exp, ok := cfg.ExperimentFor("chat")
+	if assert.True(t, ok) && assert.Len(t, exp.Arms, 2) {
+		assert.Equal(t, 1, exp.Arms[0].GetWeight())
+		assert.Equal(t, 3, exp.Arms[1].GetWeight())
+	}
 }
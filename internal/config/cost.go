@@ -0,0 +1,120 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"cmp"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ModelPrice holds the price of a model's tokens
+type ModelPrice struct {
+	InputPerMillion  float64 `json:"input_per_million"`  // Price of one million prompt tokens
+	OutputPerMillion float64 `json:"output_per_million"` // Price of one million completion tokens
+}
+
+// Cost returns the price of a request's tokens
+func (m ModelPrice) Cost(inputTokens, outputTokens int) float64 {
+	return (float64(inputTokens)*m.InputPerMillion + float64(outputTokens)*m.OutputPerMillion) / 1e6
+}
+
+// BudgetConfig holds spend ceilings in the currency of the provider's pricing (0 means no limit)
+type BudgetConfig struct {
+	Daily   float64 `json:"daily"`   // Per UTC calendar day
+	Monthly float64 `json:"monthly"` // Per UTC calendar month
+}
+
+// Exceeded reports whether spend has reached a daily or monthly ceiling
+func (b *BudgetConfig) Exceeded(daily, monthly float64) bool {
+	if b == nil {
+		return false
+	}
+	return (b.Daily > 0 && daily >= b.Daily) || (b.Monthly > 0 && monthly >= b.Monthly)
+}
+
+// PriceFor returns the configured price of a model, falling back to the "*" entry
+func (p ProviderConfig) PriceFor(model string) (ModelPrice, bool) {
+	if price, ok := p.Pricing[model]; ok {
+		return price, true
+	}
+	price, ok := p.Pricing["*"]
+	return price, ok
+}
+
+// Cost alert scopes: what spend is added up over
+const (
+	CostScopeTotal    = "total"    // All requests
+	CostScopeProvider = "provider" // Each provider
+	CostScopeBackend  = "backend"  // Each backend, "provider/model"
+	CostScopeKey      = "key"      // Each client API key, by key id
+)
+
+// Cost alert periods, in UTC
+const (
+	CostPeriodDay   = "day"
+	CostPeriodMonth = "month"
+)
+
+// CostAlert warns when spend, priced with the providers' pricing, crosses a threshold in a
+// period. Each alert fires once per period and what it matches.
+type CostAlert struct {
+	Name      string  `json:"name,omitempty"`    // Name reported with the alert
+	Scope     string  `json:"scope"`             // "total" | "provider" | "backend" | "key"
+	Match     string  `json:"match,omitempty"`   // Provider, backend or key id the alert is limited to (default each one)
+	Period    string  `json:"period,omitempty"`  // "day" (default) | "month"
+	Threshold float64 `json:"threshold"`         // Spend, in the currency of the pricing
+	Webhook   string  `json:"webhook,omitempty"` // URL the alert is posted to as JSON (supports ${VAR} expansion)
+}
+
+// GetPeriod returns the period spend is added up over
+func (a CostAlert) GetPeriod() string {
+	if a.Period == "" {
+		return CostPeriodDay
+	}
+	return a.Period
+}
+
+// GetWebhook returns the webhook URL with environment variables expanded
+func (a CostAlert) GetWebhook() string {
+	return expandEnvVars(a.Webhook)
+}
+
+// ValidateCostAlerts checks the scope, period, threshold and webhook of each cost alert
+func (c *Config) ValidateCostAlerts() error {
+	var errs []string
+	for i, alert := range c.CostAlerts {
+		name := cmp.Or(alert.Name, fmt.Sprintf("cost_alerts[%d]", i))
+		switch alert.Scope {
+		case CostScopeTotal:
+			if alert.Match != "" {
+				errs = append(errs, fmt.Sprintf("  alert %q: match is not allowed with scope %q", name, alert.Scope))
+			}
+		case CostScopeProvider:
+			if alert.Match != "" {
+				if _, ok := c.Providers[alert.Match]; !ok {
+					errs = append(errs, fmt.Sprintf("  alert %q: unknown provider %q", name, alert.Match))
+				}
+			}
+		case CostScopeBackend, CostScopeKey:
+		default:
+			errs = append(errs, fmt.Sprintf("  alert %q: invalid scope %q (must be %s, %s, %s or %s)",
+				name, alert.Scope, CostScopeTotal, CostScopeProvider, CostScopeBackend, CostScopeKey))
+		}
+		if period := alert.GetPeriod(); period != CostPeriodDay && period != CostPeriodMonth {
+			errs = append(errs, fmt.Sprintf("  alert %q: invalid period %q (must be %s or %s)", name, period, CostPeriodDay, CostPeriodMonth))
+		}
+		if alert.Threshold <= 0 {
+			errs = append(errs, fmt.Sprintf("  alert %q: threshold must be positive", name))
+		}
+		if webhook := alert.GetWebhook(); webhook != "" {
+			if u, err := url.Parse(webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				errs = append(errs, fmt.Sprintf("  alert %q: webhook must be an http:// or https:// URL", name))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("cost alerts validation failed:\n%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProviderConfig_PriceFor(t *testing.T) {
+	p := ProviderConfig{Pricing: map[string]ModelPrice{
+		"gpt-4o": {InputPerMillion: 2.5, OutputPerMillion: 10},
+		"*":      {InputPerMillion: 1, OutputPerMillion: 1},
+	}}
+	price, ok := p.PriceFor("gpt-4o")
+	assert.True(t, ok)
+	assert.InDelta(t, 0.0075, price.Cost(1000, 500), 1e-12)
+	price, ok = p.PriceFor("other")
+	assert.True(t, ok)
+	assert.Equal(t, 1.0, price.InputPerMillion)
+	_, ok = ProviderConfig{}.PriceFor("gpt-4o")
+	assert.False(t, ok)
+
+	assert.False(t, (*BudgetConfig)(nil).Exceeded(100, 100))
+	assert.True(t, (&BudgetConfig{Monthly: 10}).Exceeded(0, 10))
+	assert.False(t, (&BudgetConfig{Daily: 1}).Exceeded(0.5, 50))
+}
+
+func TestValidateCostAlerts(t *testing.T) {
+	tests := []struct {
+		name    string
+		alerts  []CostAlert
+		wantErr []string
+	}{
+		{name: "valid", alerts: []CostAlert{
+			{Scope: CostScopeTotal, Threshold: 100, Period: CostPeriodMonth},
+			{Scope: CostScopeProvider, Match: "openai", Threshold: 10, Webhook: "https://hooks.example.com/cost"},
+			{Scope: CostScopeKey, Threshold: 5},
+		}},
+		{name: "invalid", alerts: []CostAlert{
+			{Name: "team", Scope: "team", Threshold: 0, Period: "week", Webhook: "hooks.example.com"},
+			{Scope: CostScopeProvider, Match: "missing", Threshold: 1},
+			{Scope: CostScopeTotal, Match: "openai", Threshold: 1},
+		}, wantErr: []string{
+			`alert "team": invalid scope "team"`, `alert "team": invalid period "week"`, `alert "team": threshold must be positive`,
+			`alert "team": webhook must be`, `alert "cost_alerts[1]": unknown provider "missing"`, `alert "cost_alerts[2]": match is not allowed`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Providers: map[string]ProviderConfig{"openai": {}}, CostAlerts: tt.alerts}
+			err := cfg.ValidateCostAlerts()
+			if len(tt.wantErr) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				for _, want := range tt.wantErr {
+					assert.Contains(t, err.Error(), want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DiscoverConfig exposes the models a provider lists. The entry name holds one "*",
+// replaced by each discovered model name: "*" exposes them under their own names and
+// "local/*" under "local/<name>". Every discovered model routes to that model on the
+// provider with the entry's other settings; configured models of the same name win.
+type DiscoverConfig struct {
+	Provider       string   `json:"provider"`        // Provider whose models are listed
+	Include        []string `json:"include"`         // Model name globs to expose (default all)
+	Exclude        []string `json:"exclude"`         // Model name globs to leave out
+	RefreshSeconds int      `json:"refresh_seconds"` // How often the list is refreshed (default 300)
+}
+
+// GetRefresh returns how often the provider's model list is refreshed
+func (d *DiscoverConfig) GetRefresh() time.Duration {
+	if d == nil || d.RefreshSeconds <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(d.RefreshSeconds) * time.Second
+}
+
+// Matches reports whether a listed model name passes the include and exclude globs
+func (d *DiscoverConfig) Matches(name string) bool {
+	matches := func(pattern string) bool {
+		return pattern == name || (IsModelPattern(pattern) && matchModelPattern(pattern, name))
+	}
+	if len(d.Include) > 0 && !slices.ContainsFunc(d.Include, matches) {
+		return false
+	}
+	return !slices.ContainsFunc(d.Exclude, matches)
+}
+
+// DiscoveredModels returns a copy of the configuration with the models discovered for
+// each discover entry (entry name -> provider model names) added as regular models
+func (c *Config) DiscoveredModels(discovered map[string][]string) *Config {
+	if len(discovered) == 0 {
+		return c
+	}
+	out := *c
+	out.Models = maps.Clone(c.Models)
+	out.ModelOrder = slices.Clone(c.ModelOrder)
+	for _, entry := range c.ModelOrder {
+		template, ok := c.Models[entry]
+		if !ok || template.Discover == nil {
+			continue
+		}
+		for _, model := range discovered[entry] {
+			name := strings.Replace(entry, "*", model, 1)
+			if _, exists := out.Models[name]; exists {
+				continue
+			}
+			modelConfig := template
+			modelConfig.Discover = nil
+			modelConfig.Default = false
+			modelConfig.Providers = []ModelProvider{{Provider: template.Discover.Provider, Model: model}}
+			out.Models[name] = modelConfig
+			out.ModelOrder = append(out.ModelOrder, name)
+		}
+	}
+	return &out
+}
+
+// ValidateDiscovery checks that discover entries name a known provider, hold exactly one
+// "*" and list no providers of their own
+func (c *Config) ValidateDiscovery() error {
+	var errs []string
+
+	for modelName, modelConfig := range c.Models {
+		d := modelConfig.Discover
+		if d == nil {
+			continue
+		}
+		if _, exists := c.Providers[d.Provider]; !exists {
+			errs = append(errs, fmt.Sprintf(
+				"  model %q discover references unknown provider %q", modelName, d.Provider))
+		}
+		if strings.Count(modelName, "*") != 1 {
+			errs = append(errs, fmt.Sprintf(
+				"  model %q discover entry name must contain exactly one \"*\"", modelName))
+		}
+		if len(modelConfig.Providers) > 0 {
+			errs = append(errs, fmt.Sprintf(
+				"  model %q cannot set both discover and providers", modelName))
+		}
+		if modelConfig.Default {
+			errs = append(errs, fmt.Sprintf(
+				"  model %q discover entry cannot be the default model", modelName))
+		}
+		if d.RefreshSeconds < 0 {
+			errs = append(errs, fmt.Sprintf(
+				"  model %q discover refresh_seconds must not be negative", modelName))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("discover validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
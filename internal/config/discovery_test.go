@@ -0,0 +1,87 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscoverConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.json")
+	configContent := `{
+		"providers": {"ollama": {"url": "http://ollama:11434/v1"}},
+		"models": {
+			"chat": ["ollama/llama3"],
+			"local/*": {"discover": {"provider": "ollama", "include": ["llama*", "qwen*"], "exclude": ["*-embed"], "refresh_seconds": 60}, "retry": {"max_attempts": 2}}
+		}
+	}`
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("failed to write temp config: %v", err)
+	}
+
+	cfg, err := LoadFromPath(configPath)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, cfg.Validate())
+
+	d := cfg.Models["local/*"].Discover
+	if !assert.NotNil(t, d) {
+		return
+	}
+	assert.Equal(t, time.Minute, d.GetRefresh())
+	assert.True(t, d.Matches("llama3"))
+	assert.False(t, d.Matches("llama3-embed"))
+	assert.False(t, d.Matches("mistral"))
+	assert.Equal(t, 5*time.Minute, (&DiscoverConfig{}).GetRefresh())
+
+	_, ok := cfg.ResolveModel("local/llama3")
+	assert.False(t, ok, "a discover entry only serves discovered models")
+
+	discovered := cfg.DiscoveredModels(map[string][]string{"local/*": {"llama3", "qwen2"}})
+	assert.NotContains(t, cfg.Models, "local/llama3", "the loaded configuration is left as is")
+	resolved, ok := discovered.ResolveModel("local/qwen2")
+	assert.True(t, ok)
+	assert.Equal(t, "local/qwen2", resolved)
+	model := discovered.Models["local/qwen2"]
+	assert.Equal(t, []ModelProvider{{Provider: "ollama", Model: "qwen2"}}, model.Providers)
+	assert.Nil(t, model.Discover)
+	assert.Equal(t, 2, model.GetRetryPolicy().MaxAttempts)
+	assert.Equal(t, []string{"chat", "local/*", "local/llama3", "local/qwen2"}, discovered.ModelOrder)
+}
+
+func TestValidateDiscovery(t *testing.T) {
+	tests := []struct {
+		name    string
+		model   string
+		config  ModelConfig
+		wantErr string
+	}{
+		{name: "valid", model: "local/*", config: ModelConfig{Discover: &DiscoverConfig{Provider: "ollama"}}},
+		{name: "unknown provider", model: "*", config: ModelConfig{Discover: &DiscoverConfig{Provider: "missing"}}, wantErr: `unknown provider "missing"`},
+		{name: "no wildcard", model: "local", config: ModelConfig{Discover: &DiscoverConfig{Provider: "ollama"}}, wantErr: "exactly one"},
+		{name: "two wildcards", model: "*/*", config: ModelConfig{Discover: &DiscoverConfig{Provider: "ollama"}}, wantErr: "exactly one"},
+		{name: "with providers", model: "*", config: ModelConfig{Discover: &DiscoverConfig{Provider: "ollama"}, Providers: []ModelProvider{{Provider: "ollama", Model: "llama3"}}}, wantErr: "both discover and providers"},
+		{name: "default", model: "*", config: ModelConfig{Default: true, Discover: &DiscoverConfig{Provider: "ollama"}}, wantErr: "default model"},
+		{name: "negative refresh", model: "*", config: ModelConfig{Discover: &DiscoverConfig{Provider: "ollama", RefreshSeconds: -1}}, wantErr: "must not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Providers: map[string]ProviderConfig{"ollama": {URL: "http://ollama"}},
+				Models:    map[string]ModelConfig{tt.model: tt.config},
+			}
+			err := cfg.ValidateDiscovery()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
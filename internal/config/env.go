@@ -0,0 +1,131 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// envProblem is a ${...} reference whose variable is unset
+type envProblem struct {
+	name string
+	// message is that of a ${VAR:?message} reference, which fails the load even when
+	// strict_env is off
+	message  string
+	required bool
+}
+
+func (p envProblem) String() string {
+	if p.message != "" {
+		return fmt.Sprintf("%s: %s", p.name, p.message)
+	}
+	return p.name + " is not set"
+}
+
+// expandEnvVars expands environment variables in ${VAR} format. ${VAR:-default} falls
+// back to default when VAR is unset or empty, and $${ is a literal ${. Unset variables
+// expand to an empty string.
+func expandEnvVars(s string) string {
+	expanded, _ := expandEnv(s)
+	return expanded
+}
+
+// expandEnv expands the ${...} references of s and reports those whose variable is unset.
+// Expanded values are not expanded again.
+func expandEnv(s string) (string, []envProblem) {
+	var b strings.Builder
+	var problems []envProblem
+	for {
+		start := strings.Index(s, "${")
+		if start == -1 {
+			break
+		}
+		if start > 0 && s[start-1] == '$' {
+			b.WriteString(s[:start-1] + "${")
+			s = s[start+2:]
+			continue
+		}
+		end := strings.Index(s[start:], "}")
+		if end == -1 {
+			break
+		}
+		end += start
+		value, problem := resolveEnvRef(s[start+2 : end])
+		if problem != nil {
+			problems = append(problems, *problem)
+		}
+		b.WriteString(s[:start] + value)
+		s = s[end+1:]
+	}
+	b.WriteString(s)
+	return b.String(), problems
+}
+
+// resolveEnvRef resolves the inside of a ${...} reference: VAR, VAR:-default or
+// VAR:?message
+func resolveEnvRef(ref string) (string, *envProblem) {
+	if name, def, ok := strings.Cut(ref, ":-"); ok {
+		if value := os.Getenv(name); value != "" {
+			return value, nil
+		}
+		return def, nil
+	}
+	if name, message, ok := strings.Cut(ref, ":?"); ok {
+		if value := os.Getenv(name); value != "" {
+			return value, nil
+		}
+		if message == "" {
+			message = "is required"
+		}
+		return "", &envProblem{name: name, message: message, required: true}
+	}
+	value, ok := os.LookupEnv(ref)
+	if !ok && ref != "" {
+		return "", &envProblem{name: ref}
+	}
+	return value, nil
+}
+
+// checkEnvVars reports the ${...} references of the raw config data whose variable is
+// unset: ${VAR:?message} ones always, plain ${VAR} ones too when strict
+func checkEnvVars(data []byte, strict bool) error {
+	_, problems := expandEnv(string(data))
+	var errs []string
+	for _, problem := range problems {
+		if !problem.required && !strict {
+			continue
+		}
+		if line := "  " + problem.String(); !slices.Contains(errs, line) {
+			errs = append(errs, line)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("environment variables not set:\n%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// UnsetEnvVars lists the environment variables the ${...} references of the config files
+// at paths, with the files they include, name but which are unset. Missing files are
+// skipped.
+func UnsetEnvVars(paths ...string) ([]string, error) {
+	var unset []string
+	for _, path := range paths {
+		data, err := readConfigSource(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		_, problems := expandEnv(string(data))
+		for _, problem := range problems {
+			if line := problem.String(); !slices.Contains(unset, line) {
+				unset = append(unset, line)
+			}
+		}
+	}
+	return unset, nil
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+// TestExpandEnvVars tests the expandEnvVars function
+func TestExpandEnvVars(t *testing.T) {
+	origEnv := map[string]string{
+		"TEST_VAR":      "testvalue",
+		"ANOTHER_VAR":   "anothervalue",
+		"EMPTY_VAR":     "",
+		"SPECIAL_CHARS": "hello world!",
+		"PATH_VAR":      "/usr/local/bin",
+		"NESTED_VAR":    "${TEST_VAR}",
+	}
+	for k, v := range origEnv {
+		os.Setenv(k, v)
+	}
+	defer func() {
+		for k := range origEnv {
+			os.Unsetenv(k)
+		}
+	}()
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "no env vars", input: "hello world", expected: "hello world"},
+		{name: "single env var", input: "prefix${TEST_VAR}suffix", expected: "prefixtestvaluesuffix"},
+		{name: "multiple env vars", input: "${TEST_VAR}-${ANOTHER_VAR}", expected: "testvalue-anothervalue"},
+		{name: "env var at start", input: "${TEST_VAR}suffix", expected: "testvaluesuffix"},
+		{name: "env var at end", input: "prefix${TEST_VAR}", expected: "prefixtestvalue"},
+		{name: "empty env var", input: "prefix${EMPTY_VAR}suffix", expected: "prefixsuffix"},
+		{name: "env var with special chars", input: "value is ${SPECIAL_CHARS}", expected: "value is hello world!"},
+		{name: "env var in path", input: "${PATH_VAR}/file", expected: "/usr/local/bin/file"},
+		{name: "unclosed env var stays as is", input: "prefix${UNCLOSED", expected: "prefix${UNCLOSED"},
+		{name: "empty braces expands to empty", input: "prefix${}suffix", expected: "prefixsuffix"},
+		{name: "undefined env var expands to empty", input: "prefix${UNDEFINED_VAR}suffix", expected: "prefixsuffix"},
+		{name: "first match expands var only", input: "prefix${TEST}VAR}suffix", expected: "prefixVAR}suffix"},
+		{name: "multiple same env var", input: "${TEST_VAR} and ${TEST_VAR}", expected: "testvalue and testvalue"},
+		{name: "default of set var", input: "${TEST_VAR:-fallback}", expected: "testvalue"},
+		{name: "default of unset var", input: "${UNDEFINED_VAR:-http://localhost:11434}/v1", expected: "http://localhost:11434/v1"},
+		{name: "default of empty var", input: "${EMPTY_VAR:-fallback}", expected: "fallback"},
+		{name: "empty default", input: "a${UNDEFINED_VAR:-}b", expected: "ab"},
+		{name: "required unset var expands to empty", input: "a${UNDEFINED_VAR:?needed}b", expected: "ab"},
+		{name: "escaped reference stays literal", input: "$${TEST_VAR} is ${TEST_VAR}", expected: "${TEST_VAR} is testvalue"},
+		{name: "expanded values are not expanded again", input: "${NESTED_VAR}", expected: "${TEST_VAR}"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result := expandEnvVars(tc.input)
+			if result != tc.expected {
+				t.Errorf("expandEnvVars(%q) = %q, want %q", tc.input, result, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"cmp"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Event sink types
+const (
+	EventSinkKafka   = "kafka"
+	EventSinkNATS    = "nats"
+	EventSinkWebhook = "webhook"
+)
+
+// EventSinkConfig holds settings for publishing usage events to Kafka, NATS or a webhook
+// (requires restart). A JSON event with the model, backend, tokens, latency and status of
+// each completed OpenAI or Anthropic API request is published in the background.
+type EventSinkConfig struct {
+	Enabled bool   `json:"enabled"`
+	Type    string `json:"type"` // "kafka", "nats" or "webhook"
+	// Brokers are the Kafka bootstrap brokers, host:port (values support ${VAR} expansion)
+	Brokers []string `json:"brokers,omitempty"`
+	// URL is the NATS server, nats://[user:pass@]host:port or tls:// for TLS (default
+	// NATS_URL, then nats://localhost:4222), or the http(s) URL batches of events are
+	// posted to (supports ${VAR} expansion)
+	URL string `json:"url,omitempty"`
+	// Token authenticates to NATS, or is sent to the webhook as a bearer token (supports
+	// ${VAR} expansion; default NATS_TOKEN for nats)
+	Token string `json:"token,omitempty"`
+	// Topic is the Kafka topic or NATS subject events are published to (default "openmodel.usage")
+	Topic string `json:"topic,omitempty"`
+	// TLS connects to the Kafka brokers over TLS
+	TLS bool `json:"tls,omitempty"`
+	// Username and Password authenticate to Kafka with SASL/PLAIN (support ${VAR} expansion)
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// IsEnabled reports whether usage events are published
+func (e *EventSinkConfig) IsEnabled() bool {
+	return e != nil && e.Enabled
+}
+
+// GetBrokers returns the Kafka bootstrap brokers with environment variables expanded
+func (e *EventSinkConfig) GetBrokers() []string {
+	brokers := make([]string, 0, len(e.Brokers))
+	for _, broker := range e.Brokers {
+		if broker = expandEnvVars(broker); broker != "" {
+			brokers = append(brokers, broker)
+		}
+	}
+	return brokers
+}
+
+// GetURL returns the NATS server or webhook URL
+func (e *EventSinkConfig) GetURL() string {
+	if e.Type == EventSinkWebhook {
+		return expandEnvVars(e.URL)
+	}
+	return cmp.Or(expandEnvVars(e.URL), os.Getenv("NATS_URL"), "nats://localhost:4222")
+}
+
+// GetToken returns the NATS or webhook token
+func (e *EventSinkConfig) GetToken() string {
+	if e.Type == EventSinkWebhook {
+		return expandEnvVars(e.Token)
+	}
+	return cmp.Or(expandEnvVars(e.Token), os.Getenv("NATS_TOKEN"))
+}
+
+// GetTopic returns the Kafka topic or NATS subject
+func (e *EventSinkConfig) GetTopic() string {
+	return cmp.Or(e.Topic, "openmodel.usage")
+}
+
+// GetUsername returns the Kafka SASL username
+func (e *EventSinkConfig) GetUsername() string {
+	return expandEnvVars(e.Username)
+}
+
+// GetPassword returns the Kafka SASL password
+func (e *EventSinkConfig) GetPassword() string {
+	return expandEnvVars(e.Password)
+}
+
+// ValidateEventSink checks the type, the brokers or URL and the topic of the event sink
+func (c *Config) ValidateEventSink() error {
+	if !c.EventSink.IsEnabled() {
+		return nil
+	}
+	var errs []string
+	kafkaSettings := c.EventSink.TLS || c.EventSink.Username != "" || c.EventSink.Password != "" || len(c.EventSink.Brokers) > 0
+	switch c.EventSink.Type {
+	case EventSinkKafka:
+		brokers := c.EventSink.GetBrokers()
+		if len(brokers) == 0 {
+			errs = append(errs, "  brokers are required for kafka")
+		}
+		for _, broker := range brokers {
+			if _, port, err := net.SplitHostPort(broker); err != nil || port == "" {
+				errs = append(errs, fmt.Sprintf("  broker %q must be host:port", broker))
+			}
+		}
+		if c.EventSink.Password != "" && c.EventSink.Username == "" {
+			errs = append(errs, "  password requires a username")
+		}
+		if c.EventSink.Token != "" || c.EventSink.URL != "" {
+			errs = append(errs, "  url and token are nats and webhook settings")
+		}
+		if strings.ContainsAny(c.EventSink.GetTopic(), " \t\r\n") {
+			errs = append(errs, fmt.Sprintf("  topic %q must not contain whitespace", c.EventSink.GetTopic()))
+		}
+	case EventSinkNATS:
+		if u, err := url.Parse(c.EventSink.GetURL()); err != nil || (u.Scheme != "nats" && u.Scheme != "tls") || u.Host == "" {
+			errs = append(errs, fmt.Sprintf("  url %q must be a nats:// or tls:// URL", redactString("url", c.EventSink.GetURL())))
+		}
+		if kafkaSettings {
+			errs = append(errs, "  brokers, tls, username and password are kafka settings (use a tls:// url with user:pass@ or token for nats)")
+		}
+		if strings.ContainsAny(c.EventSink.GetTopic(), " \t\r\n") {
+			errs = append(errs, fmt.Sprintf("  topic %q must not contain whitespace", c.EventSink.GetTopic()))
+		}
+	case EventSinkWebhook:
+		if u, err := url.Parse(c.EventSink.GetURL()); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Sprintf("  url %q must be an http:// or https:// URL", redactString("url", c.EventSink.GetURL())))
+		}
+		if kafkaSettings {
+			errs = append(errs, "  brokers, tls, username and password are kafka settings")
+		}
+		if c.EventSink.Topic != "" {
+			errs = append(errs, "  topic is a kafka and nats setting")
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("  invalid type %q (must be %s, %s or %s)", c.EventSink.Type, EventSinkKafka, EventSinkNATS, EventSinkWebhook))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("event_sink validation failed:\n%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
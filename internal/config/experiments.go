@@ -0,0 +1,90 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ExperimentConfig splits the requests for a model between arms, each served by the
+// backend chain of another model. Responses are tagged with the arm so results can be
+// compared offline.
+type ExperimentConfig struct {
+	Name  string          `json:"name"`
+	Model string          `json:"model"` // Model whose requests are split
+	Arms  []ExperimentArm `json:"arms"`  // At least two
+}
+
+// ExperimentArm is one side of an experiment
+type ExperimentArm struct {
+	Name   string `json:"name"`
+	Model  string `json:"model"`            // Model whose backend chain serves the arm
+	Weight int    `json:"weight,omitempty"` // Relative share of traffic (default 1)
+}
+
+// GetWeight returns the arm's relative share of traffic (default 1)
+func (a ExperimentArm) GetWeight() int {
+	if a.Weight <= 0 {
+		return 1
+	}
+	return a.Weight
+}
+
+// ExperimentFor returns the experiment that splits a model's requests, if any
+func (c *Config) ExperimentFor(model string) (*ExperimentConfig, bool) {
+	for i := range c.Experiments {
+		if c.Experiments[i].Model == model {
+			return &c.Experiments[i], true
+		}
+	}
+	return nil, false
+}
+
+// ValidateExperiments checks that experiments split a configured model, one experiment
+// per model, between at least two uniquely named arms served by configured models
+func (c *Config) ValidateExperiments() error {
+	var errs []string
+	names := make(map[string]bool)
+	models := make(map[string]bool)
+
+	for i, exp := range c.Experiments {
+		name := exp.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+			errs = append(errs, fmt.Sprintf("  experiment %s has no name", name))
+		} else if names[name] {
+			errs = append(errs, fmt.Sprintf("  experiment %q is defined more than once", name))
+		}
+		names[name] = true
+
+		if _, exists := c.Models[exp.Model]; !exists {
+			errs = append(errs, fmt.Sprintf("  experiment %q splits unknown model %q", name, exp.Model))
+		} else if models[exp.Model] {
+			errs = append(errs, fmt.Sprintf("  experiment %q splits model %q, which another experiment already splits", name, exp.Model))
+		}
+		models[exp.Model] = true
+
+		if len(exp.Arms) < 2 {
+			errs = append(errs, fmt.Sprintf("  experiment %q needs at least two arms", name))
+		}
+		arms := make(map[string]bool)
+		for _, arm := range exp.Arms {
+			if arm.Name == "" || arms[arm.Name] {
+				errs = append(errs, fmt.Sprintf("  experiment %q arms need unique names", name))
+			}
+			arms[arm.Name] = true
+			if _, exists := c.Models[arm.Model]; !exists {
+				errs = append(errs, fmt.Sprintf("  experiment %q arm %q uses unknown model %q", name, arm.Name, arm.Model))
+			}
+			if arm.Weight < 0 {
+				errs = append(errs, fmt.Sprintf("  experiment %q arm %q weight must not be negative", name, arm.Name))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("experiments validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
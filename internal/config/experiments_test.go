@@ -0,0 +1,49 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateExperiments(t *testing.T) {
+	arms := []ExperimentArm{{Name: "a", Model: "chat"}, {Name: "b", Model: "chat-b", Weight: 2}}
+	tests := []struct {
+		name       string
+		experiment ExperimentConfig
+		wantErr    string
+	}{
+		{name: "valid", experiment: ExperimentConfig{Name: "ab", Model: "chat", Arms: arms}},
+		{name: "no name", experiment: ExperimentConfig{Model: "chat", Arms: arms}, wantErr: "experiment #1 has no name"},
+		{name: "unknown model", experiment: ExperimentConfig{Name: "ab", Model: "missing", Arms: arms}, wantErr: "splits unknown model"},
+		{name: "single arm", experiment: ExperimentConfig{Name: "ab", Model: "chat", Arms: arms[:1]}, wantErr: "needs at least two arms"},
+		{name: "duplicate arm", experiment: ExperimentConfig{Name: "ab", Model: "chat", Arms: []ExperimentArm{arms[0], arms[0]}}, wantErr: "arms need unique names"},
+		{name: "unknown arm model", experiment: ExperimentConfig{Name: "ab", Model: "chat", Arms: []ExperimentArm{arms[0], {Name: "c", Model: "missing"}}}, wantErr: "arm \"c\" uses unknown model"},
+		{name: "negative weight", experiment: ExperimentConfig{Name: "ab", Model: "chat", Arms: []ExperimentArm{arms[0], {Name: "c", Model: "chat-b", Weight: -1}}}, wantErr: "weight must not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Models:      map[string]ModelConfig{"chat": {}, "chat-b": {}},
+				Experiments: []ExperimentConfig{tt.experiment},
+			}
+			err := cfg.ValidateExperiments()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+
+	twice := &Config{
+		Models: map[string]ModelConfig{"chat": {}, "chat-b": {}},
+		Experiments: []ExperimentConfig{
+			{Name: "one", Model: "chat", Arms: arms},
+			{Name: "two", Model: "chat", Arms: arms},
+		},
+	}
+	assert.ErrorContains(t, twice.ValidateExperiments(), "which another experiment already splits")
+}
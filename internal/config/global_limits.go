@@ -0,0 +1,62 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// GlobalLimitsConfig caps the requests to the model APIs the server serves at once and
+// per second, across all clients and models. Excess requests wait in a bounded queue and
+// are rejected with 429 when the queue is full or their wait exceeds the queue timeout.
+type GlobalLimitsConfig struct {
+	MaxConcurrent     int `json:"max_concurrent,omitempty"`      // Requests served at once (0: unlimited)
+	RequestsPerSecond int `json:"requests_per_second,omitempty"` // Requests started per second (0: unlimited)
+	Burst             int `json:"burst,omitempty"`               // Requests started at once after an idle spell (default requests_per_second)
+	MaxQueue          int `json:"max_queue,omitempty"`           // Requests allowed to wait for each limit (default 0: reject at once)
+	QueueTimeoutMs    int `json:"queue_timeout_ms,omitempty"`    // Longest wait (default 30000)
+}
+
+// IsEnabled reports whether any global limit is set
+func (g *GlobalLimitsConfig) IsEnabled() bool {
+	return g != nil && (g.MaxConcurrent > 0 || g.RequestsPerSecond > 0)
+}
+
+// GetBurst returns how many requests may start at once
+func (g *GlobalLimitsConfig) GetBurst() int {
+	return max(g.Burst, g.RequestsPerSecond, 1)
+}
+
+// GetQueueTimeout returns the longest time a request waits
+func (g *GlobalLimitsConfig) GetQueueTimeout() time.Duration {
+	if g == nil || g.QueueTimeoutMs <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(g.QueueTimeoutMs) * time.Millisecond
+}
+
+// ValidateGlobalLimits checks that global limits are not negative and queue only behind
+// a limit
+func (c *Config) ValidateGlobalLimits() error {
+	g := c.GlobalLimits
+	if g == nil {
+		return nil
+	}
+	var errs []string
+	if g.MaxConcurrent < 0 || g.RequestsPerSecond < 0 || g.Burst < 0 || g.MaxQueue < 0 || g.QueueTimeoutMs < 0 {
+		errs = append(errs, "  global_limits values must not be negative")
+	}
+	if g.Burst > 0 && g.RequestsPerSecond <= 0 {
+		errs = append(errs, "  global_limits burst requires requests_per_second")
+	}
+	if g.MaxQueue > 0 && !g.IsEnabled() {
+		errs = append(errs, "  global_limits max_queue requires max_concurrent or requests_per_second")
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("global_limits validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateGlobalLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  *GlobalLimitsConfig
+		wantErr string
+	}{
+		{name: "not configured"},
+		{name: "valid", limits: &GlobalLimitsConfig{MaxConcurrent: 8, RequestsPerSecond: 20, Burst: 40, MaxQueue: 100, QueueTimeoutMs: 5000}},
+		{name: "negative", limits: &GlobalLimitsConfig{MaxConcurrent: -1}, wantErr: "must not be negative"},
+		{name: "burst without rate", limits: &GlobalLimitsConfig{MaxConcurrent: 4, Burst: 10}, wantErr: "burst requires requests_per_second"},
+		{name: "queue without limit", limits: &GlobalLimitsConfig{MaxQueue: 5}, wantErr: "max_queue requires"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&Config{GlobalLimits: tt.limits}).ValidateGlobalLimits()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+
+	var unset *GlobalLimitsConfig
+	assert.False(t, unset.IsEnabled())
+	assert.Equal(t, 30*time.Second, unset.GetQueueTimeout())
+	assert.Equal(t, 5, (&GlobalLimitsConfig{RequestsPerSecond: 5}).GetBurst())
+	assert.Equal(t, 10, (&GlobalLimitsConfig{RequestsPerSecond: 5, Burst: 10}).GetBurst())
+}
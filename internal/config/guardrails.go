@@ -0,0 +1,143 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// GuardrailsConfig checks the prompt text of chat and completion requests, the text of
+// their messages, system prompt or prompt, before they are routed: its length, regular
+// expressions it must not match and the verdict of a classifier model. A request breaking
+// a policy is rejected with a policy violation error, unless a pattern rewrites it.
+type GuardrailsConfig struct {
+	Models         []string             `json:"models,omitempty"`           // Requested model names checked, "*" patterns allowed (default all)
+	MaxPromptChars int                  `json:"max_prompt_chars,omitempty"` // Longest prompt text in characters (0: unlimited)
+	Deny           []GuardrailPattern   `json:"deny,omitempty"`             // Patterns rejecting or redacting prompt text
+	Classifier     *GuardrailClassifier `json:"classifier,omitempty"`       // Model judging prompts
+}
+
+// GuardrailPattern is a regular expression prompt text must not match
+type GuardrailPattern struct {
+	Name        string `json:"name"`                  // Named in the violation
+	Pattern     string `json:"pattern"`               // Regular expression (RE2 syntax)
+	Action      string `json:"action,omitempty"`      // "reject" (default) or "redact"
+	Replacement string `json:"replacement,omitempty"` // Text replacing matches when redacting (default "[REDACTED]")
+}
+
+// GuardrailClassifier asks a configured model whether a prompt is allowed: a moderation
+// model through /v1/moderations, or a chat model, such as Llama Guard, whose answer
+// starts with "unsafe" for a prompt breaking the policy
+type GuardrailClassifier struct {
+	Model      string             `json:"model"`                 // Configured model judging prompts
+	Mode       string             `json:"mode,omitempty"`        // "moderation" (default) or "chat"
+	Prompt     string             `json:"prompt,omitempty"`      // System prompt of the chat mode (default: asks for safe or unsafe)
+	Thresholds map[string]float64 `json:"thresholds,omitempty"`  // Category score thresholds of the moderation mode (default: the model's flags)
+	FailClosed bool               `json:"fail_closed,omitempty"` // Reject requests when the classifier fails (default: let them through)
+}
+
+// Guardrail pattern actions and classifier modes
+const (
+	GuardrailActionReject    = "reject"
+	GuardrailActionRedact    = "redact"
+	GuardrailModeModeration  = "moderation"
+	GuardrailModeChat        = "chat"
+	defaultGuardrailRedacted = "[REDACTED]"
+)
+
+// AppliesTo reports whether guardrails check requests for a requested model name
+func (g *GuardrailsConfig) AppliesTo(model string) bool {
+	return g != nil && (g.MaxPromptChars > 0 || len(g.Deny) > 0 || g.Classifier != nil) &&
+		RuleMatch{Models: g.Models}.MatchesModel(model)
+}
+
+// GetAction returns what a match of the pattern does
+func (p GuardrailPattern) GetAction() string {
+	if p.Action == "" {
+		return GuardrailActionReject
+	}
+	return p.Action
+}
+
+// GetReplacement returns the text replacing redacted matches
+func (p GuardrailPattern) GetReplacement() string {
+	if p.Replacement == "" {
+		return defaultGuardrailRedacted
+	}
+	return p.Replacement
+}
+
+// GetMode returns how the classifier is asked
+func (c *GuardrailClassifier) GetMode() string {
+	if c.Mode == "" {
+		return GuardrailModeModeration
+	}
+	return c.Mode
+}
+
+// ValidateGuardrails checks that guardrail patterns compile and the classifier model exists
+func (c *Config) ValidateGuardrails() error {
+	g := c.Guardrails
+	if g == nil {
+		return nil
+	}
+	var errs []string
+	if g.MaxPromptChars < 0 {
+		errs = append(errs, fmt.Sprintf("  max_prompt_chars must not be negative (got %d)", g.MaxPromptChars))
+	}
+	names := make(map[string]bool)
+	for i, p := range g.Deny {
+		name := p.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+			errs = append(errs, fmt.Sprintf("  deny pattern %s has no name", name))
+		} else if names[name] {
+			errs = append(errs, fmt.Sprintf("  deny pattern %q is defined more than once", name))
+		}
+		names[name] = true
+		if p.Pattern == "" {
+			errs = append(errs, fmt.Sprintf("  deny pattern %q has no pattern", name))
+		} else if _, err := regexp.Compile(p.Pattern); err != nil {
+			errs = append(errs, fmt.Sprintf("  deny pattern %q is invalid: %v", name, err))
+		}
+		if action := p.GetAction(); action != GuardrailActionReject && action != GuardrailActionRedact {
+			errs = append(errs, fmt.Sprintf("  deny pattern %q action %q must be %q or %q", name, action, GuardrailActionReject, GuardrailActionRedact))
+		}
+		if p.Replacement != "" && p.GetAction() != GuardrailActionRedact {
+			errs = append(errs, fmt.Sprintf("  deny pattern %q replacement only applies to %q", name, GuardrailActionRedact))
+		}
+	}
+	if cl := g.Classifier; cl != nil {
+		if cl.Model == "" {
+			errs = append(errs, "  classifier model is required")
+		} else if _, exists := c.Models[cl.Model]; !exists {
+			errs = append(errs, fmt.Sprintf("  classifier model %q is not defined in models", cl.Model))
+		}
+		switch cl.GetMode() {
+		case GuardrailModeModeration:
+			if cl.Prompt != "" {
+				errs = append(errs, fmt.Sprintf("  classifier prompt only applies to the %q mode", GuardrailModeChat))
+			}
+		case GuardrailModeChat:
+			if len(cl.Thresholds) > 0 {
+				errs = append(errs, fmt.Sprintf("  classifier thresholds only apply to the %q mode", GuardrailModeModeration))
+			}
+		default:
+			errs = append(errs, fmt.Sprintf("  classifier mode %q must be %q or %q", cl.Mode, GuardrailModeModeration, GuardrailModeChat))
+		}
+		for _, category := range slices.Sorted(maps.Keys(cl.Thresholds)) {
+			if threshold := cl.Thresholds[category]; threshold < 0 || threshold > 1 {
+				errs = append(errs, fmt.Sprintf("  classifier threshold of %q must be between 0 and 1 (got %g)", category, threshold))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("guardrails validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateGuardrails(t *testing.T) {
+	models := map[string]ModelConfig{"guard": {Strategy: "fallback"}}
+
+	tests := []struct {
+		name       string
+		guardrails *GuardrailsConfig
+		wantErr    string
+	}{
+		{name: "not configured"},
+		{name: "valid", guardrails: &GuardrailsConfig{
+			Models:         []string{"gpt-*"},
+			MaxPromptChars: 20000,
+			Deny: []GuardrailPattern{
+				{Name: "jailbreak", Pattern: `(?i)ignore previous instructions`},
+				{Name: "card", Pattern: `\d{4}-\d{4}-\d{4}-\d{4}`, Action: GuardrailActionRedact, Replacement: "[card]"},
+			},
+			Classifier: &GuardrailClassifier{Model: "guard", Thresholds: map[string]float64{"violence": 0.8}},
+		}},
+		{name: "valid chat classifier", guardrails: &GuardrailsConfig{Classifier: &GuardrailClassifier{Model: "guard", Mode: GuardrailModeChat, Prompt: "Answer safe or unsafe."}}},
+		{name: "negative max chars", guardrails: &GuardrailsConfig{MaxPromptChars: -1}, wantErr: "max_prompt_chars must not be negative"},
+		{name: "unnamed pattern", guardrails: &GuardrailsConfig{Deny: []GuardrailPattern{{Pattern: "x"}}}, wantErr: "deny pattern #1 has no name"},
+		{name: "duplicate pattern", guardrails: &GuardrailsConfig{Deny: []GuardrailPattern{{Name: "a", Pattern: "x"}, {Name: "a", Pattern: "y"}}}, wantErr: "defined more than once"},
+		{name: "invalid pattern", guardrails: &GuardrailsConfig{Deny: []GuardrailPattern{{Name: "a", Pattern: "("}}}, wantErr: `deny pattern "a" is invalid`},
+		{name: "invalid action", guardrails: &GuardrailsConfig{Deny: []GuardrailPattern{{Name: "a", Pattern: "x", Action: "drop"}}}, wantErr: `action "drop"`},
+		{name: "replacement on reject", guardrails: &GuardrailsConfig{Deny: []GuardrailPattern{{Name: "a", Pattern: "x", Replacement: "y"}}}, wantErr: "replacement only applies"},
+		{name: "unknown classifier model", guardrails: &GuardrailsConfig{Classifier: &GuardrailClassifier{Model: "missing"}}, wantErr: "not defined in models"},
+		{name: "invalid mode", guardrails: &GuardrailsConfig{Classifier: &GuardrailClassifier{Model: "guard", Mode: "vote"}}, wantErr: `classifier mode "vote"`},
+		{name: "thresholds in chat mode", guardrails: &GuardrailsConfig{Classifier: &GuardrailClassifier{Model: "guard", Mode: GuardrailModeChat, Thresholds: map[string]float64{"hate": 0.5}}}, wantErr: "thresholds only apply"},
+		{name: "threshold out of range", guardrails: &GuardrailsConfig{Classifier: &GuardrailClassifier{Model: "guard", Thresholds: map[string]float64{"hate": 2}}}, wantErr: "must be between 0 and 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Models: models, Guardrails: tt.guardrails}
+			err := cfg.ValidateGuardrails()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+
+	g := &GuardrailsConfig{Models: []string{"gpt-*"}, MaxPromptChars: 100}
+	assert.True(t, g.AppliesTo("gpt-4"))
+	assert.False(t, g.AppliesTo("llama3"))
+	assert.True(t, (&GuardrailsConfig{MaxPromptChars: 100}).AppliesTo("llama3"))
+	assert.False(t, (&GuardrailsConfig{}).AppliesTo("llama3"), "nothing to check")
+}
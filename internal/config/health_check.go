@@ -0,0 +1,73 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// HealthCheckConfig holds settings for background provider health checks
+type HealthCheckConfig struct {
+	Enabled    bool   `json:"enabled"`
+	IntervalMs int    `json:"interval_ms"` // Time between checks, default 30000
+	TimeoutMs  int    `json:"timeout_ms"`  // Per-check timeout, default 5000
+	Endpoint   string `json:"endpoint"`    // Endpoint requested with GET, default /v1/models
+}
+
+// IsEnabled reports whether background health checks run
+func (h *HealthCheckConfig) IsEnabled() bool {
+	return h != nil && h.Enabled
+}
+
+// GetInterval returns the time between health checks
+func (h *HealthCheckConfig) GetInterval() time.Duration {
+	if h == nil || h.IntervalMs <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(h.IntervalMs) * time.Millisecond
+}
+
+// GetTimeout returns the timeout of a single health check
+func (h *HealthCheckConfig) GetTimeout() time.Duration {
+	if h == nil || h.TimeoutMs <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(h.TimeoutMs) * time.Millisecond
+}
+
+// GetEndpoint returns the endpoint requested by health checks
+func (h *HealthCheckConfig) GetEndpoint() string {
+	if h == nil || h.Endpoint == "" {
+		return "/v1/models"
+	}
+	return h.Endpoint
+}
+
+// ReadinessConfig holds settings for the readiness probe (/readyz)
+type ReadinessConfig struct {
+	// CriticalModels must each have a backend in rotation for the server to be ready
+	CriticalModels []string `json:"critical_models,omitempty"`
+}
+
+// GetCriticalModels returns the models that must have a backend in rotation
+func (r *ReadinessConfig) GetCriticalModels() []string {
+	if r == nil {
+		return nil
+	}
+	return r.CriticalModels
+}
+
+// ValidateReadiness checks that the critical models of the readiness probe are defined
+func (c *Config) ValidateReadiness() error {
+	var errs []string
+	for _, model := range c.Readiness.GetCriticalModels() {
+		if _, exists := c.Models[model]; !exists {
+			errs = append(errs, fmt.Sprintf("  critical model %q is not defined in models", model))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("readiness validation failed:\n%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateReadiness(t *testing.T) {
+	cfg := &Config{Models: map[string]ModelConfig{"gpt-4": {}}}
+	assert.NoError(t, cfg.ValidateReadiness())
+
+	cfg.Readiness = &ReadinessConfig{CriticalModels: []string{"gpt-4", "missing"}}
+	err := cfg.ValidateReadiness()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `critical model "missing" is not defined`)
+		assert.NotContains(t, err.Error(), `"gpt-4"`)
+	}
+}
@@ -0,0 +1,147 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// HTTPConfig holds HTTP client configuration
+type HTTPConfig struct {
+	TimeoutSeconds               int  `json:"timeout_seconds"`
+	MaxIdleConns                 int  `json:"max_idle_conns"`
+	MaxIdleConnsPerHost          int  `json:"max_idle_conns_per_host"`
+	IdleConnTimeoutSeconds       int  `json:"idle_conn_timeout_seconds"`
+	DialTimeoutSeconds           int  `json:"dial_timeout_seconds"` // Connect timeout
+	TLSHandshakeTimeoutSeconds   int  `json:"tls_handshake_timeout_seconds"`
+	ResponseHeaderTimeoutSeconds int  `json:"response_header_timeout_seconds"`
+	KeepAliveSeconds             int  `json:"keep_alive_seconds"`  // TCP keep-alive interval (-1 disables)
+	DisableKeepAlives            bool `json:"disable_keep_alives"` // New connection for every request
+	// Proxy is the default outbound proxy of all providers: an http://, https:// or
+	// socks5:// URL (supports ${VAR} expansion); empty for direct connections
+	Proxy string `json:"proxy,omitempty"`
+}
+
+// ProxyDirect as a provider proxy bypasses the global http.proxy
+const ProxyDirect = "direct"
+
+// ProviderProxy returns the outbound proxy URL of a provider: its own proxy, else the
+// global http.proxy, "" for a direct connection
+func (c *Config) ProviderProxy(providerName string) string {
+	proxy := c.Providers[providerName].Proxy
+	if proxy == "" {
+		proxy = c.HTTP.Proxy
+	}
+	if proxy == ProxyDirect {
+		return ""
+	}
+	return proxy
+}
+
+// ProviderHTTP returns the HTTP client settings of a provider: each one its http section
+// sets, else the global one, with the proxy resolved by ProviderProxy
+func (c *Config) ProviderHTTP(providerName string) HTTPConfig {
+	h := c.HTTP
+	if o := c.Providers[providerName].HTTP; o != nil {
+		if o.TimeoutSeconds > 0 {
+			h.TimeoutSeconds = o.TimeoutSeconds
+		}
+		if o.MaxIdleConns > 0 {
+			h.MaxIdleConns = o.MaxIdleConns
+		}
+		if o.MaxIdleConnsPerHost > 0 {
+			h.MaxIdleConnsPerHost = o.MaxIdleConnsPerHost
+		}
+		if o.IdleConnTimeoutSeconds > 0 {
+			h.IdleConnTimeoutSeconds = o.IdleConnTimeoutSeconds
+		}
+		if o.DialTimeoutSeconds > 0 {
+			h.DialTimeoutSeconds = o.DialTimeoutSeconds
+		}
+		if o.TLSHandshakeTimeoutSeconds > 0 {
+			h.TLSHandshakeTimeoutSeconds = o.TLSHandshakeTimeoutSeconds
+		}
+		if o.ResponseHeaderTimeoutSeconds > 0 {
+			h.ResponseHeaderTimeoutSeconds = o.ResponseHeaderTimeoutSeconds
+		}
+		if o.KeepAliveSeconds != 0 {
+			h.KeepAliveSeconds = o.KeepAliveSeconds
+		}
+		if o.DisableKeepAlives {
+			h.DisableKeepAlives = true
+		}
+	}
+	h.Proxy = c.ProviderProxy(providerName)
+	return h
+}
+
+// ValidateProxies checks the global and per-provider proxy URLs
+func (c *Config) ValidateProxies() error {
+	var errs []string
+
+	if c.HTTP.Proxy == ProxyDirect {
+		errs = append(errs, "  http.proxy cannot be \"direct\" (leave it empty for direct connections)")
+	} else if msg := checkProxyURL(c.HTTP.Proxy); msg != "" {
+		errs = append(errs, "  http.proxy "+msg)
+	}
+	for providerName, providerConfig := range c.Providers {
+		if providerConfig.Proxy == ProxyDirect {
+			continue
+		}
+		if msg := checkProxyURL(providerConfig.Proxy); msg != "" {
+			errs = append(errs, fmt.Sprintf("  provider %q proxy %s", providerName, msg))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("proxy validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// checkProxyURL describes what is wrong with a proxy URL, "" when it is empty or valid.
+// The URL itself is left out of the message since it may carry credentials.
+func checkProxyURL(proxy string) string {
+	if proxy == "" {
+		return ""
+	}
+	u, err := url.Parse(proxy)
+	if err != nil || u.Host == "" {
+		return "is not a valid URL"
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return ""
+	}
+	return fmt.Sprintf("has unsupported scheme %q (must be http, https, socks5 or socks5h)", u.Scheme)
+}
+
+// ValidateHTTP checks the global and per-provider http client settings
+func (c *Config) ValidateHTTP() error {
+	var errs []string
+	check := func(owner string, h *HTTPConfig) {
+		if h == nil {
+			return
+		}
+		if h.TimeoutSeconds < 0 || h.MaxIdleConns < 0 || h.MaxIdleConnsPerHost < 0 || h.IdleConnTimeoutSeconds < 0 ||
+			h.DialTimeoutSeconds < 0 || h.TLSHandshakeTimeoutSeconds < 0 || h.ResponseHeaderTimeoutSeconds < 0 {
+			errs = append(errs, fmt.Sprintf("  %s settings must not be negative", owner))
+		}
+		if h.KeepAliveSeconds < -1 {
+			errs = append(errs, fmt.Sprintf("  %s keep_alive_seconds must be -1 (disabled) or more", owner))
+		}
+	}
+
+	check("http", &c.HTTP)
+	for providerName, providerConfig := range c.Providers {
+		check(fmt.Sprintf("provider %q http", providerName), providerConfig.HTTP)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("http validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
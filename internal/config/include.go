@@ -0,0 +1,117 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// includeDirName is the directory beside a config file whose *.json files are merged
+// into it, e.g. ~/.config/openmodel/config.d
+const includeDirName = "config.d"
+
+// includeFiles lists the files merged into the config file at path: the *.json files of
+// the config.d directory beside it in name order, then those its "include" entries name.
+// Relative entries are relative to the config file and may be glob patterns.
+func includeFiles(path string, raw map[string]any) ([]string, error) {
+	dir := filepath.Dir(path)
+	files, err := filepath.Glob(filepath.Join(dir, includeDirName, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(files)
+
+	include, ok := raw["include"]
+	if !ok {
+		return files, nil
+	}
+	entries, ok := include.([]any)
+	if !ok {
+		return nil, fmt.Errorf("include must be a list of file paths")
+	}
+	for _, entry := range entries {
+		pattern, ok := entry.(string)
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("include entries must be file paths")
+		}
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("include %q: %w", entry, err)
+		}
+		// A plain path must exist; a pattern may match nothing
+		if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			return nil, fmt.Errorf("include %q: file not found", entry)
+		}
+		slices.Sort(matches)
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// configFiles lists the config file at path and the files merged into it
+func configFiles(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]any
+	if json.Unmarshal(data, &raw) != nil {
+		return []string{path}, nil
+	}
+	included, err := includeFiles(path, raw)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{path}, included...), nil
+}
+
+// readConfigFile reads the config file at path with its included files merged in, in
+// order, each overriding what came before. Included files may not include others.
+func readConfigFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]any
+	if json.Unmarshal(data, &raw) != nil {
+		// Left for parsing to report with line numbers
+		return data, nil
+	}
+	files, err := includeFiles(path, raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(files) == 0 {
+		return data, nil
+	}
+
+	delete(raw, "include")
+	for _, file := range files {
+		fragmentData, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read included config: %w", err)
+		}
+		var fragment map[string]any
+		if err := jsonUnmarshalWithLines(fragmentData, &fragment, "parsing included config "+file); err != nil {
+			return nil, err
+		}
+		if _, ok := fragment["include"]; ok {
+			return nil, fmt.Errorf("%s: included configs may not include others", file)
+		}
+		delete(fragment, "$schema")
+		raw = mergeMaps(raw, fragment)
+	}
+
+	merged, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal merged config: %w", err)
+	}
+	return merged, nil
+}
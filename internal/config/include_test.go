@@ -0,0 +1,95 @@
+package config
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad_Includes(t *testing.T) {
+	const base = `{"server": {"port": 9000, "host": "localhost"}, "providers": {}, "models": {}`
+	tests := []struct {
+		name    string
+		main    string
+		files   map[string]string
+		wantErr string
+		check   func(t *testing.T, cfg *Config)
+	}{
+		{
+			name: "config.d files merge in name order",
+			main: base + `}`,
+			files: map[string]string{
+				"config.d/10-ollama.json":   `{"providers": {"ollama": {"url": "http://localhost:11434/v1"}}}`,
+				"config.d/20-models.json":   `{"models": {"llama3": ["ollama/llama3"]}, "server": {"port": 9001}}`,
+				"config.d/30-override.json": `{"$schema": "https://example.com/other.json", "server": {"port": 9002}}`,
+				"config.d/notes.txt":        `not merged`,
+			},
+			check: func(t *testing.T, cfg *Config) {
+				assert.Contains(t, cfg.Providers, "ollama")
+				assert.Contains(t, cfg.Models, "llama3")
+				assert.Equal(t, 9002, cfg.Server.Port)
+				assert.Equal(t, "localhost", cfg.Server.Host)
+			},
+		},
+		{
+			name: "include entries after config.d",
+			main: base + `, "include": ["teams/*.json", "extra.json"]}`,
+			files: map[string]string{
+				"config.d/a.json":   `{"log_level": "debug"}`,
+				"teams/search.json": `{"providers": {"search": {"url": "http://search/v1"}}}`,
+				"extra.json":        `{"log_level": "warn"}`,
+			},
+			check: func(t *testing.T, cfg *Config) {
+				assert.Contains(t, cfg.Providers, "search")
+				assert.Equal(t, "warn", cfg.LogLevel)
+			},
+		},
+		{
+			name:    "missing include",
+			main:    base + `, "include": ["missing.json"]}`,
+			wantErr: `include "missing.json": file not found`,
+		},
+		{
+			name:    "nested include",
+			main:    base + `, "include": ["a.json"]}`,
+			files:   map[string]string{"a.json": `{"include": ["b.json"]}`},
+			wantErr: "may not include others",
+		},
+		{
+			name:    "invalid included file",
+			main:    base + `}`,
+			files:   map[string]string{"config.d/broken.json": `{"providers": `},
+			wantErr: "broken.json",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			configPath := filepath.Join(dir, "openmodel.json")
+			files := map[string]string{"openmodel.json": tt.main}
+			maps.Copy(files, tt.files)
+			for name, content := range files {
+				path := filepath.Join(dir, name)
+				if !assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755)) || !assert.NoError(t, os.WriteFile(path, []byte(content), 0o644)) {
+					return
+				}
+			}
+
+			cfg, err := Load(configPath)
+			if tt.wantErr != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tt.wantErr)
+				}
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, configPath, cfg.GetConfigPath())
+			tt.check(t, cfg)
+		})
+	}
+}
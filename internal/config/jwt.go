@@ -0,0 +1,123 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// JWTConfig lets clients of the model APIs present a JWT issued by an OpenID Connect
+// identity provider as their API key (verifier settings require restart). A token is
+// checked against the provider's JWKS, its issuer and its audience; the identity claim
+// names the client, which is held to the limits of the first role its claims match.
+type JWTConfig struct {
+	Issuer        string    `json:"issuer"`                   // Required iss claim, also the base of OpenID discovery
+	Audience      string    `json:"audience,omitempty"`       // Required aud claim (default: not checked)
+	JWKSURL       string    `json:"jwks_url,omitempty"`       // Signing keys (default: the jwks_uri the issuer publishes)
+	IdentityClaim string    `json:"identity_claim,omitempty"` // Claim naming the client (default "sub")
+	Roles         []JWTRole `json:"roles,omitempty"`          // Limits by claim (unset: every valid token has full access)
+}
+
+// JWTRole gives the tokens whose claim holds a value the limits of an API key. A role
+// without a claim matches every token.
+type JWTRole struct {
+	Name          string   `json:"name"`                     // Label used in logs
+	Claim         string   `json:"claim,omitempty"`          // Claim to match, a string or an array of strings
+	Value         string   `json:"value,omitempty"`          // Value the claim must be or contain
+	Models        []string `json:"models,omitempty"`         // As for api keys
+	Endpoints     []string `json:"endpoints,omitempty"`      // As for api keys
+	RPM           int      `json:"rpm,omitempty"`            // Per identity, as for api keys
+	TPM           int      `json:"tpm,omitempty"`            // Per identity, as for api keys
+	MonthlyTokens int64    `json:"monthly_tokens,omitempty"` // Per identity, as for api keys
+	MonthlyBudget float64  `json:"monthly_budget,omitempty"` // Per identity, as for api keys
+	Tenant        string   `json:"tenant,omitempty"`         // As for api keys
+	Tenants       []string `json:"tenants,omitempty"`        // As for api keys
+}
+
+// IsEnabled reports whether JWTs are accepted
+func (j *JWTConfig) IsEnabled() bool {
+	return j != nil && j.Issuer != ""
+}
+
+// GetIdentityClaim returns the claim naming the client
+func (j *JWTConfig) GetIdentityClaim() string {
+	if j.IdentityClaim == "" {
+		return "sub"
+	}
+	return j.IdentityClaim
+}
+
+// MatchRole returns the first role matched by the claims of a token, read with claim as
+// lists of strings, or a role without limits when there are no roles
+func (j *JWTConfig) MatchRole(claim func(name string) []string) (JWTRole, bool) {
+	if len(j.Roles) == 0 {
+		return JWTRole{}, true
+	}
+	for _, role := range j.Roles {
+		if role.Claim == "" || slices.Contains(claim(role.Claim), role.Value) {
+			return role, true
+		}
+	}
+	return JWTRole{}, false
+}
+
+// APIKey returns the API key the role gives a client
+func (r JWTRole) APIKey(name string) APIKey {
+	return APIKey{
+		Name:          name,
+		Models:        r.Models,
+		Endpoints:     r.Endpoints,
+		RPM:           r.RPM,
+		TPM:           r.TPM,
+		MonthlyTokens: r.MonthlyTokens,
+		MonthlyBudget: r.MonthlyBudget,
+		Tenant:        r.Tenant,
+		Tenants:       r.Tenants,
+	}
+}
+
+// ValidateJWT checks that JWT authentication has URLs to fetch keys from and roles that
+// match a claim and hold valid limits
+func (c *Config) ValidateJWT() error {
+	j := c.JWT
+	if j == nil {
+		return nil
+	}
+	var errs []string
+	for _, field := range []struct{ name, value string }{{"issuer", j.Issuer}, {"jwks_url", j.JWKSURL}} {
+		if field.value == "" {
+			continue
+		}
+		if u, err := url.Parse(field.value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Sprintf("  %s %q must be an http:// or https:// URL", field.name, field.value))
+		}
+	}
+	if j.Issuer == "" && (j.Audience != "" || j.JWKSURL != "" || len(j.Roles) > 0) {
+		errs = append(errs, "  issuer is required")
+	}
+	names := make(map[string]bool)
+	for i, role := range j.Roles {
+		name := role.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+			errs = append(errs, fmt.Sprintf("  role %s has no name", name))
+		} else if names[name] {
+			errs = append(errs, fmt.Sprintf("  role %q is defined more than once", name))
+		}
+		names[name] = true
+		if (role.Claim == "") != (role.Value == "") {
+			errs = append(errs, fmt.Sprintf("  role %q needs both a claim and a value, or neither", name))
+		}
+		for _, problem := range role.APIKey(name).LimitErrors() {
+			errs = append(errs, fmt.Sprintf("  role %q has %s", name, problem))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("jwt validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
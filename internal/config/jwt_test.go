@@ -0,0 +1,55 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateJWT(t *testing.T) {
+	issuer := "https://login.example.com"
+	tests := []struct {
+		name    string
+		jwt     *JWTConfig
+		wantErr string
+	}{
+		{name: "not configured"},
+		{name: "valid", jwt: &JWTConfig{Issuer: issuer, Audience: "openmodel", Roles: []JWTRole{
+			{Name: "dev", Claim: "groups", Value: "dev", Models: []string{"gpt-*"}, RPM: 60},
+			{Name: "everyone", MonthlyTokens: 100000},
+		}}},
+		{name: "no issuer", jwt: &JWTConfig{Audience: "openmodel"}, wantErr: "issuer is required"},
+		{name: "issuer not a URL", jwt: &JWTConfig{Issuer: "login.example.com"}, wantErr: "must be an http:// or https:// URL"},
+		{name: "bad jwks url", jwt: &JWTConfig{Issuer: issuer, JWKSURL: "ftp://keys"}, wantErr: "jwks_url"},
+		{name: "unnamed role", jwt: &JWTConfig{Issuer: issuer, Roles: []JWTRole{{}}}, wantErr: "role #1 has no name"},
+		{name: "duplicate role", jwt: &JWTConfig{Issuer: issuer, Roles: []JWTRole{{Name: "a"}, {Name: "a"}}}, wantErr: "defined more than once"},
+		{name: "claim without value", jwt: &JWTConfig{Issuer: issuer, Roles: []JWTRole{{Name: "a", Claim: "groups"}}}, wantErr: "both a claim and a value"},
+		{name: "bad limits", jwt: &JWTConfig{Issuer: issuer, Roles: []JWTRole{{Name: "a", Endpoints: []string{"admin"}, TPM: -1}}}, wantErr: "a negative tpm"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&Config{JWT: tt.jwt}).ValidateJWT()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+
+	var unset *JWTConfig
+	assert.False(t, unset.IsEnabled())
+	jwt := &JWTConfig{Issuer: issuer, Roles: []JWTRole{{Name: "dev", Claim: "groups", Value: "dev"}, {Name: "rest"}}}
+	assert.Equal(t, "sub", jwt.GetIdentityClaim())
+	claims := map[string][]string{"groups": {"staff", "dev"}}
+	role, ok := jwt.MatchRole(func(name string) []string { return claims[name] })
+	assert.True(t, ok)
+	assert.Equal(t, "dev", role.Name)
+	role, _ = jwt.MatchRole(func(string) []string { return nil })
+	assert.Equal(t, "rest", role.Name)
+	_, ok = (&JWTConfig{Issuer: issuer, Roles: jwt.Roles[:1]}).MatchRole(func(string) []string { return nil })
+	assert.False(t, ok)
+}
@@ -0,0 +1,169 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// APIKey is a client key of the model APIs. Clients send it as an Authorization bearer
+// token or, for Anthropic clients, in x-api-key.
+type APIKey struct {
+	Name      string   `json:"name"`                // Label used in logs and the audit log
+	Key       string   `json:"key"`                 // The key (supports ${VAR} expansion)
+	Models    []string `json:"models,omitempty"`    // Requested model names, "*" patterns allowed (default all)
+	Endpoints []string `json:"endpoints,omitempty"` // Endpoint groups: "openai", "anthropic", "ollama" (default all)
+	RPM       int      `json:"rpm,omitempty"`       // Requests per minute (0: unlimited)
+	TPM       int      `json:"tpm,omitempty"`       // Prompt and completion tokens per minute (0: unlimited)
+	// MonthlyTokens and MonthlyBudget cap the tokens and the cost, priced like provider
+	// budgets, of the key's requests in a UTC calendar month (0: unlimited)
+	MonthlyTokens int64   `json:"monthly_tokens,omitempty"`
+	MonthlyBudget float64 `json:"monthly_budget,omitempty"`
+	Tenant        string  `json:"tenant,omitempty"` // Tenant the key's requests belong to (default none)
+	// Tenants the key may choose with the tenant header in place of its own, "*" patterns
+	// allowed (default none)
+	Tenants []string `json:"tenants,omitempty"`
+}
+
+// apiKeyEndpointGroups are the endpoint groups API keys give access to
+var apiKeyEndpointGroups = []string{EndpointsOpenAI, EndpointsAnthropic, EndpointsOllama}
+
+// GetKey returns the key with environment variables expanded
+func (k APIKey) GetKey() string {
+	return expandEnvVars(k.Key)
+}
+
+// AllowsModel reports whether the key may request a model name
+func (k APIKey) AllowsModel(name string) bool {
+	return RuleMatch{Models: k.Models}.MatchesModel(name)
+}
+
+// HasQuota reports whether the key has a monthly token or cost quota
+func (k APIKey) HasQuota() bool {
+	return k.MonthlyTokens > 0 || k.MonthlyBudget > 0
+}
+
+// MayChooseTenant reports whether the key may assign its requests to a tenant: its own
+// or one of those it may choose
+func (k APIKey) MayChooseTenant(name string) bool {
+	return name == k.Tenant || (len(k.Tenants) > 0 && RuleMatch{Models: k.Tenants}.MatchesModel(name))
+}
+
+// AllowsEndpoints reports whether the key may use an endpoint group
+func (k APIKey) AllowsEndpoints(group string) bool {
+	return len(k.Endpoints) == 0 || slices.Contains(k.Endpoints, group)
+}
+
+// LimitErrors returns what is wrong with the models, endpoint groups, rates and quotas the
+// key is limited to
+func (k APIKey) LimitErrors() []string {
+	var errs []string
+	for _, model := range k.Models {
+		if model == "" {
+			errs = append(errs, "an empty model name")
+		}
+	}
+	for _, group := range k.Endpoints {
+		if !slices.Contains(apiKeyEndpointGroups, group) {
+			errs = append(errs, fmt.Sprintf("invalid endpoint group %q (must be one of: %s)", group, strings.Join(apiKeyEndpointGroups, ", ")))
+		}
+	}
+	if k.RPM < 0 {
+		errs = append(errs, fmt.Sprintf("a negative rpm (%d)", k.RPM))
+	}
+	if k.TPM < 0 {
+		errs = append(errs, fmt.Sprintf("a negative tpm (%d)", k.TPM))
+	}
+	if k.MonthlyTokens < 0 {
+		errs = append(errs, fmt.Sprintf("negative monthly_tokens (%d)", k.MonthlyTokens))
+	}
+	if k.MonthlyBudget < 0 {
+		errs = append(errs, fmt.Sprintf("a negative monthly_budget (%g)", k.MonthlyBudget))
+	}
+	return errs
+}
+
+// IsAPIKeyEndpointGroup reports whether requests to an endpoint group present an API key
+// when API keys are in use
+func IsAPIKeyEndpointGroup(group string) bool {
+	return slices.Contains(apiKeyEndpointGroups, group)
+}
+
+// LookupAPIKey returns the API key a client presented, comparing in constant time
+func (c *Config) LookupAPIKey(key string) (APIKey, bool) {
+	if key == "" {
+		return APIKey{}, false
+	}
+	for _, k := range c.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(k.GetKey()), []byte(key)) == 1 {
+			return k, true
+		}
+	}
+	return APIKey{}, false
+}
+
+// KeyStoreConfig holds settings for the store of API keys issued at runtime (requires
+// restart). Keys are stored hashed, with the models and endpoint groups they may use.
+type KeyStoreConfig struct {
+	Enabled bool   `json:"enabled"`
+	Path    string `json:"path,omitempty"` // SQLite database file (supports ${VAR} expansion; default ~/.config/openmodel/keys.db)
+}
+
+// IsEnabled reports whether issued keys are accepted
+func (k *KeyStoreConfig) IsEnabled() bool {
+	return k != nil && k.Enabled
+}
+
+// GetPath returns the database file with environment variables expanded
+func (k *KeyStoreConfig) GetPath() string {
+	if k != nil {
+		if path := expandEnvVars(k.Path); path != "" {
+			return path
+		}
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "keys.db"
+	}
+	return filepath.Join(homeDir, ".config", "openmodel", "keys.db")
+}
+
+// ValidateAPIKeys checks that API keys are named, unique and limited to endpoint groups
+// they can serve
+func (c *Config) ValidateAPIKeys() error {
+	var errs []string
+	names := make(map[string]bool)
+	keys := make(map[string]bool)
+
+	for i, k := range c.APIKeys {
+		name := k.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+			errs = append(errs, fmt.Sprintf("  api key %s has no name", name))
+		} else if names[name] {
+			errs = append(errs, fmt.Sprintf("  api key %q is defined more than once", name))
+		}
+		names[name] = true
+
+		if key := k.GetKey(); key == "" {
+			errs = append(errs, fmt.Sprintf("  api key %q has no key", name))
+		} else if keys[key] {
+			errs = append(errs, fmt.Sprintf("  api key %q reuses the key of another api key", name))
+		} else {
+			keys[key] = true
+		}
+		for _, problem := range k.LimitErrors() {
+			errs = append(errs, fmt.Sprintf("  api key %q has %s", name, problem))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("api_keys validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
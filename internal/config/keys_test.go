@@ -0,0 +1,75 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateAPIKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    []APIKey
+		wantErr string
+	}{
+		{name: "none"},
+		{name: "valid", keys: []APIKey{
+			{Name: "chat", Key: "sk-chat"},
+			{Name: "embeddings", Key: "sk-embed", Models: []string{"text-embedding-*"}, Endpoints: []string{EndpointsOpenAI}},
+		}},
+		{name: "no name", keys: []APIKey{{Key: "sk-chat"}}, wantErr: "api key #1 has no name"},
+		{name: "duplicate name", keys: []APIKey{{Name: "a", Key: "sk-1"}, {Name: "a", Key: "sk-2"}}, wantErr: "is defined more than once"},
+		{name: "no key", keys: []APIKey{{Name: "a", Key: "${OPENMODEL_TEST_UNSET_API_KEY}"}}, wantErr: "has no key"},
+		{name: "duplicate key", keys: []APIKey{{Name: "a", Key: "sk-1"}, {Name: "b", Key: "sk-1"}}, wantErr: "reuses the key"},
+		{name: "invalid endpoint group", keys: []APIKey{{Name: "a", Key: "sk-1", Endpoints: []string{EndpointsAdmin}}}, wantErr: "invalid endpoint group \"admin\""},
+		{name: "empty model", keys: []APIKey{{Name: "a", Key: "sk-1", Models: []string{""}}}, wantErr: "empty model name"},
+		{name: "rates", keys: []APIKey{{Name: "a", Key: "sk-1", RPM: 60, TPM: 100000}}},
+		{name: "negative rpm", keys: []APIKey{{Name: "a", Key: "sk-1", RPM: -1}}, wantErr: "negative rpm"},
+		{name: "negative tpm", keys: []APIKey{{Name: "a", Key: "sk-1", TPM: -1}}, wantErr: "negative tpm"},
+		{name: "quotas", keys: []APIKey{{Name: "a", Key: "sk-1", MonthlyTokens: 1000000, MonthlyBudget: 50}}},
+		{name: "negative monthly tokens", keys: []APIKey{{Name: "a", Key: "sk-1", MonthlyTokens: -1}}, wantErr: "negative monthly_tokens"},
+		{name: "negative monthly budget", keys: []APIKey{{Name: "a", Key: "sk-1", MonthlyBudget: -1}}, wantErr: "negative monthly_budget"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&Config{APIKeys: tt.keys}).ValidateAPIKeys()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLookupAPIKey(t *testing.T) {
+	t.Setenv("OPENMODEL_TEST_API_KEY", "sk-embed")
+	cfg := &Config{APIKeys: []APIKey{
+		{Name: "chat", Key: "sk-chat"},
+		{Name: "embeddings", Key: "${OPENMODEL_TEST_API_KEY}", Models: []string{"text-embedding-*"}, Endpoints: []string{EndpointsOpenAI}},
+	}}
+
+	key, ok := cfg.LookupAPIKey("sk-embed")
+	if assert.True(t, ok) {
+		assert.Equal(t, "embeddings", key.Name)
+		assert.True(t, key.AllowsModel("text-embedding-3-small"))
+		assert.False(t, key.AllowsModel("gpt-4o"))
+		assert.True(t, key.AllowsEndpoints(EndpointsOpenAI))
+		assert.False(t, key.AllowsEndpoints(EndpointsAnthropic))
+	}
+	key, ok = cfg.LookupAPIKey("sk-chat")
+	if assert.True(t, ok) {
+		assert.True(t, key.AllowsModel("gpt-4o"))
+		assert.True(t, key.AllowsEndpoints(EndpointsOllama))
+	}
+	_, ok = cfg.LookupAPIKey("sk-other")
+	assert.False(t, ok)
+	_, ok = cfg.LookupAPIKey("")
+	assert.False(t, ok)
+
+	assert.True(t, IsAPIKeyEndpointGroup(EndpointsAnthropic))
+	assert.False(t, IsAPIKeyEndpointGroup(EndpointsAdmin))
+}
@@ -0,0 +1,156 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Endpoint groups a listener can serve
+const (
+	ListenerEndpointsAPI   = "api"   // Every endpoint but the admin API
+	ListenerEndpointsAdmin = "admin" // The /admin/... endpoints and /metrics
+)
+
+// unixAddressPrefix marks a listener address as a unix domain socket path
+const unixAddressPrefix = "unix:"
+
+// ListenerConfig is an address the server accepts requests on
+type ListenerConfig struct {
+	// Address is "host:port", or "unix:" followed by the path of a unix domain socket
+	Address string `json:"address"`
+	// Endpoints limits the listener to groups of endpoints, "api" and/or "admin" (default both)
+	Endpoints []string `json:"endpoints,omitempty"`
+	// SocketMode sets the permissions of a unix socket, in octal (e.g. "0660"; default
+	// from the umask)
+	SocketMode string `json:"socket_mode,omitempty"`
+	// TLS serves the listener over TLS, optionally verifying client certificates
+	TLS *ListenerTLSConfig `json:"tls,omitempty"`
+}
+
+// Client certificate modes of a TLS listener
+const (
+	ClientAuthRequire  = "require"  // Every client presents a certificate signed by a client CA
+	ClientAuthOptional = "optional" // Certificates are verified when presented
+)
+
+// ListenerTLSConfig serves a listener over TLS (requires restart). With client_ca_file,
+// clients authenticate with certificates signed by one of its CAs (mutual TLS).
+type ListenerTLSConfig struct {
+	CertFile     string `json:"cert_file"`                // PEM certificate chain of the server
+	KeyFile      string `json:"key_file"`                 // PEM private key of the server
+	ClientCAFile string `json:"client_ca_file,omitempty"` // PEM CAs client certificates are verified against
+	ClientAuth   string `json:"client_auth,omitempty"`    // "require" (default) or "optional" with client_ca_file
+}
+
+// GetClientAuth returns whether clients must present a certificate, empty without client CAs
+func (t *ListenerTLSConfig) GetClientAuth() string {
+	if t.ClientCAFile == "" {
+		return ""
+	}
+	if t.ClientAuth == "" {
+		return ClientAuthRequire
+	}
+	return t.ClientAuth
+}
+
+// UnixSocket returns the socket path of a unix listener
+func (l ListenerConfig) UnixSocket() (string, bool) {
+	return strings.CutPrefix(l.Address, unixAddressPrefix)
+}
+
+// Serves reports whether the listener serves an endpoint group
+func (l ListenerConfig) Serves(endpoints string) bool {
+	return len(l.Endpoints) == 0 || slices.Contains(l.Endpoints, endpoints)
+}
+
+// GetSocketMode returns the permissions of a unix socket, 0 to leave them as created
+func (l ListenerConfig) GetSocketMode() os.FileMode {
+	mode, err := strconv.ParseUint(l.SocketMode, 8, 32)
+	if err != nil {
+		return 0
+	}
+	return os.FileMode(mode)
+}
+
+// GetListeners returns the addresses the server accepts requests on: the listeners when
+// configured, host:port otherwise
+func (s ServerConfig) GetListeners() []ListenerConfig {
+	if len(s.Listeners) > 0 {
+		return s.Listeners
+	}
+	return []ListenerConfig{{Address: net.JoinHostPort(s.Host, strconv.Itoa(s.Port)), TLS: s.TLS}}
+}
+
+// ValidateListeners checks that listener addresses are host:port or unix socket paths,
+// not repeated, and that they serve known endpoint groups, as do the disabled endpoints
+func (c *Config) ValidateListeners() error {
+	var errs []string
+	if c.Server.TLS != nil && len(c.Server.Listeners) > 0 {
+		errs = append(errs, "  server tls applies to host:port; set tls on each listener instead")
+	}
+	for _, listener := range c.Server.GetListeners() {
+		errs = append(errs, listener.TLS.validationErrors(listener.Address)...)
+	}
+	seen := make(map[string]bool)
+	for i, listener := range c.Server.Listeners {
+		owner := fmt.Sprintf("server listeners[%d]", i)
+		if path, ok := listener.UnixSocket(); ok {
+			if path == "" {
+				errs = append(errs, fmt.Sprintf("  %s has no socket path", owner))
+			}
+			if listener.SocketMode != "" && listener.GetSocketMode() == 0 {
+				errs = append(errs, fmt.Sprintf("  %s socket_mode %q is not an octal file mode", owner, listener.SocketMode))
+			}
+		} else {
+			_, port, err := net.SplitHostPort(listener.Address)
+			if n, portErr := strconv.Atoi(port); err != nil || portErr != nil || n < 0 || n > 65535 {
+				errs = append(errs, fmt.Sprintf("  %s address %q must be host:port or unix:/path", owner, listener.Address))
+			}
+			if listener.SocketMode != "" {
+				errs = append(errs, fmt.Sprintf("  %s socket_mode only applies to unix sockets", owner))
+			}
+		}
+		if seen[listener.Address] {
+			errs = append(errs, fmt.Sprintf("  %s address %q is listed twice", owner, listener.Address))
+		}
+		seen[listener.Address] = true
+		for _, endpoints := range listener.Endpoints {
+			if endpoints != ListenerEndpointsAPI && endpoints != ListenerEndpointsAdmin {
+				errs = append(errs, fmt.Sprintf("  %s endpoints %q must be %q or %q", owner, endpoints, ListenerEndpointsAPI, ListenerEndpointsAdmin))
+			}
+		}
+	}
+	for _, group := range c.Server.DisabledEndpoints {
+		if !slices.Contains(endpointGroups, group) {
+			errs = append(errs, fmt.Sprintf("  server disabled_endpoints %q must be one of %s", group, strings.Join(endpointGroups, ", ")))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("listeners validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// validationErrors returns what is wrong with the TLS settings of the listener on address
+func (t *ListenerTLSConfig) validationErrors(address string) []string {
+	if t == nil {
+		return nil
+	}
+	var errs []string
+	if t.CertFile == "" || t.KeyFile == "" {
+		errs = append(errs, fmt.Sprintf("  listener %q tls requires cert_file and key_file", address))
+	}
+	if t.ClientAuth != "" && t.ClientCAFile == "" {
+		errs = append(errs, fmt.Sprintf("  listener %q tls client_auth requires client_ca_file", address))
+	} else if t.ClientAuth != "" && t.ClientAuth != ClientAuthRequire && t.ClientAuth != ClientAuthOptional {
+		errs = append(errs, fmt.Sprintf("  listener %q tls client_auth %q must be %q or %q", address, t.ClientAuth, ClientAuthRequire, ClientAuthOptional))
+	}
+	return errs
+}
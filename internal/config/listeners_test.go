@@ -0,0 +1,62 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateListeners(t *testing.T) {
+	tests := []struct {
+		name      string
+		listeners []ListenerConfig
+		disabled  []string
+		serverTLS *ListenerTLSConfig
+		wantErr   string
+	}{
+		{name: "not configured"},
+		{name: "valid", listeners: []ListenerConfig{
+			{Address: "0.0.0.0:8080", Endpoints: []string{ListenerEndpointsAPI}},
+			{Address: "127.0.0.1:8081", Endpoints: []string{ListenerEndpointsAdmin}},
+			{Address: "unix:/run/openmodel.sock", SocketMode: "0660"},
+		}},
+		{name: "missing port", listeners: []ListenerConfig{{Address: "localhost"}}, wantErr: "must be host:port or unix:/path"},
+		{name: "port out of range", listeners: []ListenerConfig{{Address: ":70000"}}, wantErr: "must be host:port or unix:/path"},
+		{name: "empty socket path", listeners: []ListenerConfig{{Address: "unix:"}}, wantErr: "has no socket path"},
+		{name: "bad socket mode", listeners: []ListenerConfig{{Address: "unix:/run/openmodel.sock", SocketMode: "rw"}}, wantErr: "not an octal file mode"},
+		{name: "socket mode of tcp", listeners: []ListenerConfig{{Address: ":8080", SocketMode: "0660"}}, wantErr: "only applies to unix sockets"},
+		{name: "repeated address", listeners: []ListenerConfig{{Address: ":8080"}, {Address: ":8080"}}, wantErr: "listed twice"},
+		{name: "unknown endpoints", listeners: []ListenerConfig{{Address: ":8080", Endpoints: []string{"public"}}}, wantErr: "endpoints \"public\""},
+		{name: "disabled endpoints", disabled: []string{EndpointsOllama, EndpointsAdmin}},
+		{name: "tls", listeners: []ListenerConfig{
+			{Address: ":8443", TLS: &ListenerTLSConfig{CertFile: "server.crt", KeyFile: "server.key", ClientCAFile: "ca.crt", ClientAuth: ClientAuthOptional}},
+		}},
+		{name: "tls without key", listeners: []ListenerConfig{{Address: ":8443", TLS: &ListenerTLSConfig{CertFile: "server.crt"}}}, wantErr: "requires cert_file and key_file"},
+		{name: "client auth without CA", listeners: []ListenerConfig{{Address: ":8443", TLS: &ListenerTLSConfig{CertFile: "c", KeyFile: "k", ClientAuth: ClientAuthRequire}}}, wantErr: "client_auth requires client_ca_file"},
+		{name: "unknown client auth", listeners: []ListenerConfig{{Address: ":8443", TLS: &ListenerTLSConfig{CertFile: "c", KeyFile: "k", ClientCAFile: "ca", ClientAuth: "always"}}}, wantErr: "client_auth \"always\""},
+		{name: "server tls", serverTLS: &ListenerTLSConfig{KeyFile: "k"}, wantErr: "listener \":0\" tls requires cert_file"},
+		{name: "server tls with listeners", listeners: []ListenerConfig{{Address: ":8080"}}, serverTLS: &ListenerTLSConfig{CertFile: "c", KeyFile: "k"}, wantErr: "set tls on each listener"},
+		{name: "unknown disabled endpoints", disabled: []string{"api"}, wantErr: "disabled_endpoints \"api\""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&Config{Server: ServerConfig{Listeners: tt.listeners, DisabledEndpoints: tt.disabled, TLS: tt.serverTLS}}).ValidateListeners()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+
+	server := ServerConfig{Host: "localhost", Port: 12345}
+	assert.Equal(t, []ListenerConfig{{Address: "localhost:12345"}}, server.GetListeners())
+	server.Listeners = []ListenerConfig{{Address: "unix:/run/openmodel.sock"}}
+	assert.Equal(t, server.Listeners, server.GetListeners())
+
+	cfg := &Config{Server: server}
+	Overrides{Port: 8080}.Apply(cfg)
+	assert.Equal(t, []ListenerConfig{{Address: "localhost:8080"}}, cfg.Server.GetListeners(), "a port on the command line replaces the listeners")
+}
@@ -0,0 +1,114 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"cmp"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// LLM observability platforms
+const (
+	LLMExportLangfuse  = "langfuse"
+	LLMExportLangSmith = "langsmith"
+)
+
+// LLMExportConfig holds settings for exporting generations to an LLM observability
+// platform (requires restart). The prompt, completion, latency and token usage of OpenAI
+// and Anthropic API requests are sent in batches in the background.
+type LLMExportConfig struct {
+	Enabled  bool   `json:"enabled"`
+	Platform string `json:"platform"` // "langfuse" or "langsmith"
+	// Endpoint is the platform's API base URL (default LANGFUSE_HOST, then
+	// https://cloud.langfuse.com; LANGSMITH_ENDPOINT, then https://api.smith.langchain.com)
+	Endpoint string `json:"endpoint,omitempty"`
+	// PublicKey and SecretKey authenticate to Langfuse (support ${VAR} expansion; default
+	// LANGFUSE_PUBLIC_KEY and LANGFUSE_SECRET_KEY)
+	PublicKey string `json:"public_key,omitempty"`
+	SecretKey string `json:"secret_key,omitempty"`
+	// APIKey authenticates to LangSmith (supports ${VAR} expansion; default LANGSMITH_API_KEY)
+	APIKey string `json:"api_key,omitempty"`
+	// Project is the LangSmith project runs are logged to (default LANGSMITH_PROJECT, then "default")
+	Project string `json:"project,omitempty"`
+	// SampleRate is the share of requests exported, from 0 to 1 (default 1)
+	SampleRate *float64 `json:"sample_rate,omitempty"`
+}
+
+// IsEnabled reports whether generations are exported
+func (l *LLMExportConfig) IsEnabled() bool {
+	return l != nil && l.Enabled
+}
+
+// GetEndpoint returns the platform's API base URL
+func (l *LLMExportConfig) GetEndpoint() string {
+	endpoint := expandEnvVars(l.Endpoint)
+	if endpoint == "" {
+		if l.Platform == LLMExportLangSmith {
+			endpoint = cmp.Or(os.Getenv("LANGSMITH_ENDPOINT"), "https://api.smith.langchain.com")
+		} else {
+			endpoint = cmp.Or(os.Getenv("LANGFUSE_HOST"), "https://cloud.langfuse.com")
+		}
+	}
+	return strings.TrimSuffix(endpoint, "/")
+}
+
+// GetPublicKey returns the Langfuse public key
+func (l *LLMExportConfig) GetPublicKey() string {
+	return cmp.Or(expandEnvVars(l.PublicKey), os.Getenv("LANGFUSE_PUBLIC_KEY"))
+}
+
+// GetSecretKey returns the Langfuse secret key
+func (l *LLMExportConfig) GetSecretKey() string {
+	return cmp.Or(expandEnvVars(l.SecretKey), os.Getenv("LANGFUSE_SECRET_KEY"))
+}
+
+// GetAPIKey returns the LangSmith API key
+func (l *LLMExportConfig) GetAPIKey() string {
+	return cmp.Or(expandEnvVars(l.APIKey), os.Getenv("LANGSMITH_API_KEY"))
+}
+
+// GetProject returns the LangSmith project
+func (l *LLMExportConfig) GetProject() string {
+	return cmp.Or(l.Project, os.Getenv("LANGSMITH_PROJECT"), "default")
+}
+
+// GetSampleRate returns the share of requests exported
+func (l *LLMExportConfig) GetSampleRate() float64 {
+	if l.SampleRate == nil {
+		return 1
+	}
+	return *l.SampleRate
+}
+
+// ValidateLLMExport checks the platform, endpoint, credentials and sample rate of the
+// LLM observability export
+func (c *Config) ValidateLLMExport() error {
+	if !c.LLMExport.IsEnabled() {
+		return nil
+	}
+	var errs []string
+	switch c.LLMExport.Platform {
+	case LLMExportLangfuse:
+		if c.LLMExport.GetPublicKey() == "" || c.LLMExport.GetSecretKey() == "" {
+			errs = append(errs, "  public_key and secret_key are required for langfuse")
+		}
+	case LLMExportLangSmith:
+		if c.LLMExport.GetAPIKey() == "" {
+			errs = append(errs, "  api_key is required for langsmith")
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("  invalid platform %q (must be %s or %s)", c.LLMExport.Platform, LLMExportLangfuse, LLMExportLangSmith))
+	}
+	if u, err := url.Parse(c.LLMExport.GetEndpoint()); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Sprintf("  endpoint %q must be an http:// or https:// URL", c.LLMExport.GetEndpoint()))
+	}
+	if rate := c.LLMExport.GetSampleRate(); rate < 0 || rate > 1 {
+		errs = append(errs, fmt.Sprintf("  sample_rate %g must be between 0 and 1", rate))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("llm_export validation failed:\n%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateLLMExport(t *testing.T) {
+	for _, env := range []string{"LANGFUSE_HOST", "LANGFUSE_PUBLIC_KEY", "LANGFUSE_SECRET_KEY", "LANGSMITH_ENDPOINT", "LANGSMITH_API_KEY", "LANGSMITH_PROJECT"} {
+		t.Setenv(env, "")
+	}
+	half, tooMuch := 0.5, 1.5
+	tests := []struct {
+		name    string
+		export  *LLMExportConfig
+		wantErr []string
+	}{
+		{name: "disabled", export: &LLMExportConfig{Platform: "datadog"}},
+		{name: "langfuse", export: &LLMExportConfig{Enabled: true, Platform: LLMExportLangfuse, PublicKey: "pk", SecretKey: "sk", SampleRate: &half}},
+		{name: "langsmith", export: &LLMExportConfig{Enabled: true, Platform: LLMExportLangSmith, APIKey: "key"}},
+		{name: "missing credentials", export: &LLMExportConfig{Enabled: true, Platform: LLMExportLangfuse, PublicKey: "pk"},
+			wantErr: []string{"public_key and secret_key are required"}},
+		{name: "invalid", export: &LLMExportConfig{Enabled: true, Platform: "datadog", Endpoint: "localhost:3000", SampleRate: &tooMuch},
+			wantErr: []string{`invalid platform "datadog"`, `endpoint "localhost:3000" must be`, "sample_rate 1.5 must be between 0 and 1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{LLMExport: tt.export}
+			err := cfg.ValidateLLMExport()
+			if len(tt.wantErr) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				for _, want := range tt.wantErr {
+					assert.Contains(t, err.Error(), want)
+				}
+			}
+		})
+	}
+
+	langsmith := &LLMExportConfig{Platform: LLMExportLangSmith}
+	assert.Equal(t, "https://api.smith.langchain.com", langsmith.GetEndpoint())
+	assert.Equal(t, "default", langsmith.GetProject())
+	t.Setenv("LANGFUSE_HOST", "https://langfuse.example.com/")
+	t.Setenv("LANGFUSE_SECRET_KEY", "sk-env")
+	langfuse := &LLMExportConfig{Platform: LLMExportLangfuse}
+	assert.Equal(t, "https://langfuse.example.com", langfuse.GetEndpoint())
+	assert.Equal(t, "sk-env", langfuse.GetSecretKey())
+	assert.Equal(t, 1.0, langfuse.GetSampleRate())
+}
@@ -0,0 +1,22 @@
+// Package config handles JSON configuration loading
+package config
+
+// MetricsConfig holds settings for the Prometheus metrics endpoint (/metrics). Listeners
+// serving only the admin endpoints serve it too, so it can be kept off the public address.
+type MetricsConfig struct {
+	Enabled bool   `json:"enabled"`
+	Token   string `json:"token,omitempty"` // Bearer token required on scrapes (supports ${VAR} expansion; default none)
+}
+
+// IsEnabled reports whether /metrics is served
+func (m *MetricsConfig) IsEnabled() bool {
+	return m != nil && m.Enabled
+}
+
+// GetToken returns the scrape token with environment variables expanded
+func (m *MetricsConfig) GetToken() string {
+	if m == nil {
+		return ""
+	}
+	return expandEnvVars(m.Token)
+}
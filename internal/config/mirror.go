@@ -0,0 +1,51 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MirrorConfig sends a copy of some requests to a shadow backend whose responses are
+// logged and compared with the primary response, never returned to the client
+type MirrorConfig struct {
+	Target  string  `json:"target"`  // Backend as "provider/model"
+	Percent float64 `json:"percent"` // Share of requests mirrored, 0-100 (default 0: none)
+}
+
+// TargetBackend splits the mirror target into provider and model names
+func (m MirrorConfig) TargetBackend() (provider, model string, ok bool) {
+	provider, model, ok = strings.Cut(m.Target, "/")
+	return provider, model, ok && provider != "" && model != ""
+}
+
+// ValidateMirrors checks that mirror targets name a configured provider and that the
+// mirrored share is a percentage
+func (c *Config) ValidateMirrors() error {
+	var errs []string
+
+	for modelName, modelConfig := range c.Models {
+		m := modelConfig.Mirror
+		if m == nil {
+			continue
+		}
+		providerName, _, ok := m.TargetBackend()
+		if !ok {
+			errs = append(errs, fmt.Sprintf(
+				"  model %q mirror target %q must be \"provider/model\"", modelName, m.Target))
+		} else if _, exists := c.Providers[providerName]; !exists {
+			errs = append(errs, fmt.Sprintf(
+				"  model %q mirror target references unknown provider %q", modelName, providerName))
+		}
+		if m.Percent < 0 || m.Percent > 100 {
+			errs = append(errs, fmt.Sprintf(
+				"  model %q mirror percent %v must be between 0 and 100", modelName, m.Percent))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("mirror validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
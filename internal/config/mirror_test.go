@@ -0,0 +1,37 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateMirrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		mirror  *MirrorConfig
+		wantErr string
+	}{
+		{name: "not configured"},
+		{name: "valid", mirror: &MirrorConfig{Target: "shadow/gpt-4o", Percent: 10}},
+		{name: "target without model", mirror: &MirrorConfig{Target: "shadow", Percent: 10}, wantErr: "must be \"provider/model\""},
+		{name: "unknown provider", mirror: &MirrorConfig{Target: "missing/gpt-4o", Percent: 10}, wantErr: "unknown provider \"missing\""},
+		{name: "percent out of range", mirror: &MirrorConfig{Target: "shadow/gpt-4o", Percent: 150}, wantErr: "between 0 and 100"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Providers: map[string]ProviderConfig{"shadow": {URL: "http://shadow"}},
+				Models:    map[string]ModelConfig{"m": {Mirror: tt.mirror}},
+			}
+			err := cfg.ValidateMirrors()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
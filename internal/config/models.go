@@ -0,0 +1,561 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"iter"
+	"strings"
+	"time"
+)
+
+// ModelConfig holds configuration for a model alias
+type ModelConfig struct {
+	Strategy  string          `json:"strategy"`  // "fallback" | "round-robin" | "weighted" | "random" | "least-busy", default "fallback"
+	Default   bool            `json:"default"`   // If true, this model is the default when no model is specified
+	Providers []ModelProvider `json:"providers"` // Resolved model providers
+	// HedgeAfterMs sends a streaming request to the next provider as well when the
+	// first one has produced no output after this many milliseconds (0 disables)
+	HedgeAfterMs int `json:"hedge_after_ms,omitempty"`
+	// StickyHeader names the request header whose value pins a conversation to a provider
+	// with the sticky strategy; without it (or when absent) the request's user field is used.
+	StickyHeader string `json:"sticky_header,omitempty"`
+	// Retry controls how transient failures are retried on the same provider before failing over
+	Retry *RetryConfig `json:"retry,omitempty"`
+	// Mirror duplicates a share of the model's traffic to a shadow backend
+	Mirror *MirrorConfig `json:"mirror,omitempty"`
+	// Admission limits concurrent requests to the model and queues the excess by priority
+	Admission *AdmissionConfig `json:"admission,omitempty"`
+	// Timeouts bound each backend attempt of the model; backends may override them
+	Timeouts *TimeoutsConfig `json:"timeouts,omitempty"`
+	// Discover populates the entry from a provider's model list instead of providers
+	Discover *DiscoverConfig `json:"discover,omitempty"`
+	// Metadata describes the model to clients listing it
+	Metadata *ModelMetadata `json:"metadata,omitempty"`
+	// Thresholds override the failure thresholds of the model's backends; backends may
+	// override them in turn
+	Thresholds *ThresholdsConfig `json:"thresholds,omitempty"`
+	// SemanticCache enables the semantic cache for the model
+	SemanticCache *ModelSemanticCache `json:"semantic_cache,omitempty"`
+}
+
+// ModelMetadata describes a virtual model. It is reported by /v1/models as declared;
+// context_window takes precedence over the context windows of the backends.
+type ModelMetadata struct {
+	Description   string      `json:"description,omitempty"`
+	Family        string      `json:"family,omitempty"`         // e.g. "llama"
+	ParameterSize string      `json:"parameter_size,omitempty"` // e.g. "8B"
+	ContextWindow int         `json:"context_window,omitempty"` // Tokens
+	Pricing       *ModelPrice `json:"pricing,omitempty"`        // Price advertised to clients
+}
+
+// GetHedgeDelay returns the hedging delay, or 0 when hedging is disabled
+func (m ModelConfig) GetHedgeDelay() time.Duration {
+	if m.HedgeAfterMs <= 0 {
+		return 0
+	}
+	return time.Duration(m.HedgeAfterMs) * time.Millisecond
+}
+
+// Strategy constants
+const (
+	StrategyFallback   = "fallback"
+	StrategyRoundRobin = "round-robin"
+	StrategyWeighted   = "weighted"
+	StrategyRandom     = "random"
+	StrategyLeastBusy  = "least-busy"
+	StrategySticky     = "sticky"
+)
+
+// strategyAliases maps accepted alternative spellings to their canonical strategy
+var strategyAliases = map[string]string{
+	"priority":    StrategyFallback,
+	"round_robin": StrategyRoundRobin,
+	"least_busy":  StrategyLeastBusy,
+}
+
+// IsModelPattern reports whether a model name is a wildcard entry such as "gpt-*"
+func IsModelPattern(name string) bool {
+	return strings.Contains(name, "*")
+}
+
+// ResolveModel returns the configured model that serves a requested name: an exact
+// entry, otherwise the matching wildcard entry with the most literal characters
+// ("*" alone is a catch-all chain for unknown names). Discover entries only serve the
+// models they discovered.
+func (c *Config) ResolveModel(name string) (string, bool) {
+	if modelConfig, ok := c.Models[name]; ok && modelConfig.Discover == nil {
+		return name, true
+	}
+	return mostSpecificPattern(func(yield func(string) bool) {
+		for pattern, modelConfig := range c.Models {
+			if modelConfig.Discover == nil && !yield(pattern) {
+				return
+			}
+		}
+	}, name)
+}
+
+// mostSpecificPattern returns the "*" pattern matching name with the most literal
+// characters, the lowest of equally specific ones
+func mostSpecificPattern(patterns iter.Seq[string], name string) (string, bool) {
+	best := ""
+	for pattern := range patterns {
+		if !IsModelPattern(pattern) || !matchModelPattern(pattern, name) {
+			continue
+		}
+		specificity := len(pattern) - strings.Count(pattern, "*")
+		bestSpecificity := len(best) - strings.Count(best, "*")
+		if best == "" || specificity > bestSpecificity || (specificity == bestSpecificity && pattern < best) {
+			best = pattern
+		}
+	}
+	return best, best != ""
+}
+
+// matchModelPattern matches name against a pattern where each "*" stands for any
+// (possibly empty) run of characters, including "/"
+func matchModelPattern(pattern, name string) bool {
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(name, parts[0]) {
+		return false
+	}
+	name = name[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(name, part)
+		if i < 0 {
+			return false
+		}
+		name = name[i+len(part):]
+	}
+	return len(parts) > 1 && strings.HasSuffix(name, last)
+}
+
+// NormalizeStrategy returns the canonical name for a strategy, resolving aliases
+// ("priority" -> "fallback", "round_robin" -> "round-robin", "least_busy" -> "least-busy").
+// Empty means fallback.
+func NormalizeStrategy(strategy string) string {
+	if strategy == "" {
+		return StrategyFallback
+	}
+	if canonical, ok := strategyAliases[strategy]; ok {
+		return canonical
+	}
+	return strategy
+}
+
+// ResolveOwnModel resolves an "own model" (without provider prefix) to a ModelProvider
+// by searching through all providers for one that has this model in its models list
+// visited is used to detect circular references
+func (c *Config) ResolveOwnModel(modelName string, visited map[string]bool) (ModelProvider, bool) {
+	// Check for circular reference
+	if visited[modelName] {
+		return ModelProvider{}, false
+	}
+	// Mark as visited
+	visited[modelName] = true
+	defer func() { visited[modelName] = false }()
+
+	for providerName, provider := range c.Providers {
+		for _, m := range provider.Models {
+			if m == modelName {
+				return ModelProvider{Provider: providerName, Model: m}, true
+			}
+		}
+	}
+	return ModelProvider{}, false
+}
+
+// ModelProvider represents a provider model in the chain (legacy format)
+type ModelProvider struct {
+	Provider string `json:"provider"`         // Provider name from providers config
+	Model    string `json:"model"`            // Model name on that provider
+	Weight   int    `json:"weight,omitempty"` // Relative weight for the "weighted" strategy (default 1)
+	// Capabilities overrides the provider's capabilities for this backend
+	Capabilities []string `json:"capabilities,omitempty"`
+	// Timeouts overrides the model's timeouts for this backend
+	Timeouts *TimeoutsConfig `json:"timeouts,omitempty"`
+	// Options rewrites request options for this backend, after the provider's rules
+	Options *OptionRules `json:"options,omitempty"`
+	// Chaos injects failures into this backend's requests (testing only)
+	Chaos *ChaosConfig `json:"chaos,omitempty"`
+	// Thresholds override the model's failure thresholds for this backend
+	Thresholds *ThresholdsConfig `json:"thresholds,omitempty"`
+	// Schedule limits the hours this backend is used
+	Schedule *ScheduleConfig `json:"schedule,omitempty"`
+}
+
+// GetWeight returns the weight used by the weighted strategy (default 1)
+func (mp ModelProvider) GetWeight() int {
+	if mp.Weight <= 0 {
+		return 1
+	}
+	return mp.Weight
+}
+
+// ProviderModel represents a model in "provider/model" format
+type ProviderModel string
+
+// ParseProviderModel parses a "provider/model" string into a ModelProvider
+func ParseProviderModel(pm ProviderModel) (ModelProvider, error) {
+	// Use / as separator: provider/model (model can contain /)
+	parts := strings.Split(string(pm), "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return ModelProvider{}, fmt.Errorf("invalid provider model format: %q (expected 'provider/model')", pm)
+	}
+	return ModelProvider{Provider: parts[0], Model: strings.Join(parts[1:], "/")}, nil
+}
+
+// parseModelEntries parses model entries from an array of raw values
+func parseModelEntries(cfg *Config, modelName string, entries []any, visited map[string]bool) ([]ModelProvider, error) {
+	result := make([]ModelProvider, 0, len(entries))
+	for _, entry := range entries {
+		switch v := entry.(type) {
+		case string:
+			// Check if it's "provider/model" format or an "own model"
+			// Check if it's "provider@model" format (or "provider/model" legacy) or an "own model"
+			// Check if it's "provider/model" format (model can contain /) or an "own model"
+			if strings.Contains(v, "/") {
+				// It's "provider/model" format
+				mp, err := ParseProviderModel(ProviderModel(v))
+				if err != nil {
+					return nil, fmt.Errorf("invalid model %q: %w", modelName, err)
+				}
+				// Validate provider exists
+				provider, ok := cfg.Providers[mp.Provider]
+				if !ok {
+					return nil, fmt.Errorf("model %q references unknown provider %q", modelName, mp.Provider)
+				}
+				// Validate model exists in provider's models list (if models list is defined)
+				if len(provider.Models) > 0 {
+					modelExists := false
+					for _, m := range provider.Models {
+						if m == mp.Model {
+							modelExists = true
+							break
+						}
+					}
+					if !modelExists {
+						return nil, fmt.Errorf("model %q references model %q not found in provider %q's models list", modelName, mp.Model, mp.Provider)
+					}
+				}
+				result = append(result, mp)
+			} else {
+				// It's an "own model" - resolve to first provider that has it
+				// Note: visited map tracks resolution chain to detect true circular references
+				mp, found := cfg.ResolveOwnModel(v, visited)
+				if !found {
+					return nil, fmt.Errorf("own model %q not found in any provider's models list", v)
+				}
+				result = append(result, mp)
+			}
+
+		case map[string]any:
+			// Object format {provider, model, weight}
+			provider, _ := v["provider"].(string)
+			model, _ := v["model"].(string)
+			weight, _ := v["weight"].(float64)
+			var capabilities []string
+			if raw, ok := v["capabilities"].([]any); ok {
+				capabilities = make([]string, 0, len(raw))
+				for _, c := range raw {
+					if name, ok := c.(string); ok {
+						capabilities = append(capabilities, name)
+					}
+				}
+			}
+			var timeouts *TimeoutsConfig
+			if raw, ok := v["timeouts"]; ok {
+				t, err := parseTimeoutsConfig(raw)
+				if err != nil {
+					return nil, fmt.Errorf("model %q: %w", modelName, err)
+				}
+				timeouts = t
+			}
+			var options *OptionRules
+			if raw, ok := v["options"]; ok {
+				o, err := parseOptionRules(raw)
+				if err != nil {
+					return nil, fmt.Errorf("model %q: %w", modelName, err)
+				}
+				options = o
+			}
+			var chaos *ChaosConfig
+			if raw, ok := v["chaos"]; ok {
+				ch, err := parseChaosConfig(raw)
+				if err != nil {
+					return nil, fmt.Errorf("model %q: %w", modelName, err)
+				}
+				chaos = ch
+			}
+			var thresholds *ThresholdsConfig
+			if raw, ok := v["thresholds"]; ok {
+				t, err := parseThresholdsConfig(raw)
+				if err != nil {
+					return nil, fmt.Errorf("model %q: %w", modelName, err)
+				}
+				thresholds = t
+			}
+			var schedule *ScheduleConfig
+			if raw, ok := v["schedule"]; ok {
+				sc, err := parseScheduleConfig(raw)
+				if err != nil {
+					return nil, fmt.Errorf("model %q: %w", modelName, err)
+				}
+				schedule = sc
+			}
+			if provider == "" || model == "" {
+				return nil, fmt.Errorf("invalid model entry in %q: missing provider or model", modelName)
+			}
+			providerCfg, ok := cfg.Providers[provider]
+			if !ok {
+				return nil, fmt.Errorf("model %q references unknown provider %q", modelName, provider)
+			}
+			// Validate model exists in provider's models list (if models list is defined)
+			if len(providerCfg.Models) > 0 {
+				modelExists := false
+				for _, m := range providerCfg.Models {
+					if m == model {
+						modelExists = true
+						break
+					}
+				}
+				if !modelExists {
+					return nil, fmt.Errorf("model %q references model %q not found in provider %q's models list", modelName, model, provider)
+				}
+			}
+			result = append(result, ModelProvider{Provider: provider, Model: model, Weight: int(weight), Capabilities: capabilities, Timeouts: timeouts, Options: options, Chaos: chaos, Thresholds: thresholds, Schedule: schedule})
+
+		default:
+			return nil, fmt.Errorf("invalid model entry type in %q", modelName)
+		}
+	}
+	return result, nil
+}
+
+// parseRetryConfig decodes a model "retry" object
+func parseRetryConfig(raw any) (*RetryConfig, error) {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid retry config: %w", err)
+	}
+	var retry RetryConfig
+	if err := json.Unmarshal(data, &retry); err != nil {
+		return nil, fmt.Errorf("invalid retry config: %w", err)
+	}
+	return &retry, nil
+}
+
+// parseAdmissionConfig decodes a model "admission" object
+func parseAdmissionConfig(raw any) (*AdmissionConfig, error) {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid admission config: %w", err)
+	}
+	var admission AdmissionConfig
+	if err := json.Unmarshal(data, &admission); err != nil {
+		return nil, fmt.Errorf("invalid admission config: %w", err)
+	}
+	return &admission, nil
+}
+
+// parseMirrorConfig decodes a model "mirror" object
+func parseMirrorConfig(raw any) (*MirrorConfig, error) {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mirror config: %w", err)
+	}
+	var mirror MirrorConfig
+	if err := json.Unmarshal(data, &mirror); err != nil {
+		return nil, fmt.Errorf("invalid mirror config: %w", err)
+	}
+	return &mirror, nil
+}
+
+// parseDiscoverConfig decodes a model "discover" object
+func parseDiscoverConfig(raw any) (*DiscoverConfig, error) {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid discover config: %w", err)
+	}
+	var discover DiscoverConfig
+	if err := json.Unmarshal(data, &discover); err != nil {
+		return nil, fmt.Errorf("invalid discover config: %w", err)
+	}
+	return &discover, nil
+}
+
+// parseModelMetadata decodes a model "metadata" object
+func parseModelMetadata(raw any) (*ModelMetadata, error) {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata: %w", err)
+	}
+	var metadata ModelMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("invalid metadata: %w", err)
+	}
+	return &metadata, nil
+}
+
+// parseThresholdsConfig decodes a model or backend "thresholds" object
+func parseThresholdsConfig(raw any) (*ThresholdsConfig, error) {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid thresholds config: %w", err)
+	}
+	var thresholds ThresholdsConfig
+	if err := json.Unmarshal(data, &thresholds); err != nil {
+		return nil, fmt.Errorf("invalid thresholds config: %w", err)
+	}
+	return &thresholds, nil
+}
+
+// parseModelSemanticCache decodes a model "semantic_cache" object
+func parseModelSemanticCache(raw any) (*ModelSemanticCache, error) {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid semantic_cache config: %w", err)
+	}
+	var semanticCache ModelSemanticCache
+	if err := json.Unmarshal(data, &semanticCache); err != nil {
+		return nil, fmt.Errorf("invalid semantic_cache config: %w", err)
+	}
+	return &semanticCache, nil
+}
+
+// parseScheduleConfig decodes a backend "schedule" object
+func parseScheduleConfig(raw any) (*ScheduleConfig, error) {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule: %w", err)
+	}
+	var schedule ScheduleConfig
+	if err := json.Unmarshal(data, &schedule); err != nil {
+		return nil, fmt.Errorf("invalid schedule: %w", err)
+	}
+	return &schedule, nil
+}
+
+// parseTimeoutsConfig decodes a model or backend "timeouts" object
+func parseTimeoutsConfig(raw any) (*TimeoutsConfig, error) {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timeouts config: %w", err)
+	}
+	var timeouts TimeoutsConfig
+	if err := json.Unmarshal(data, &timeouts); err != nil {
+		return nil, fmt.Errorf("invalid timeouts config: %w", err)
+	}
+	return &timeouts, nil
+}
+
+// parseOptionRules decodes a backend "options" object
+func parseOptionRules(raw any) (*OptionRules, error) {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid options config: %w", err)
+	}
+	var options OptionRules
+	if err := json.Unmarshal(data, &options); err != nil {
+		return nil, fmt.Errorf("invalid options config: %w", err)
+	}
+	return &options, nil
+}
+
+// parseChaosConfig decodes a backend "chaos" object
+func parseChaosConfig(raw any) (*ChaosConfig, error) {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chaos config: %w", err)
+	}
+	var chaos ChaosConfig
+	if err := json.Unmarshal(data, &chaos); err != nil {
+		return nil, fmt.Errorf("invalid chaos config: %w", err)
+	}
+	return &chaos, nil
+}
+
+// ToProviderModel converts a ModelProvider to ProviderModel format
+func (mp ModelProvider) ToProviderModel() ProviderModel {
+	return ProviderModel(mp.Provider + "/" + mp.Model)
+}
+
+// ValidateDefaultModels checks that at most one model has default: true.
+// Returns an error if multiple models are marked as default.
+func (c *Config) ValidateDefaultModels() error {
+	var defaultModels []string
+	for modelName, modelConfig := range c.Models {
+		if modelConfig.Default {
+			defaultModels = append(defaultModels, modelName)
+		}
+	}
+
+	if len(defaultModels) > 1 {
+		return fmt.Errorf("multiple models marked as default: %s (only one model can be default)", strings.Join(defaultModels, ", "))
+	}
+	return nil
+}
+
+// ValidateStrategies checks that every model uses a known selection strategy
+// and that provider weights and hedging delays are not negative.
+func (c *Config) ValidateStrategies() error {
+	validStrategies := map[string]bool{
+		StrategyFallback:   true,
+		StrategyRoundRobin: true,
+		StrategyWeighted:   true,
+		StrategyRandom:     true,
+		StrategyLeastBusy:  true,
+		StrategySticky:     true,
+	}
+	var errs []string
+
+	for modelName, modelConfig := range c.Models {
+		if strategy := NormalizeStrategy(modelConfig.Strategy); !validStrategies[strategy] {
+			errs = append(errs, fmt.Sprintf(
+				"  model %q has invalid strategy: %q (must be 'fallback', 'round-robin', 'weighted', 'random', 'least-busy', or 'sticky')",
+				modelName, modelConfig.Strategy))
+		}
+		if modelConfig.HedgeAfterMs < 0 {
+			errs = append(errs, fmt.Sprintf(
+				"  model %q has negative hedge_after_ms %d", modelName, modelConfig.HedgeAfterMs))
+		}
+		for i, p := range modelConfig.Providers {
+			if p.Weight < 0 {
+				errs = append(errs, fmt.Sprintf(
+					"  model %q providers[%d] has negative weight %d", modelName, i, p.Weight))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("strategy validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// ValidateModelMetadata checks that declared context windows and prices are not negative
+func (c *Config) ValidateModelMetadata() error {
+	var errs []string
+
+	for modelName, modelConfig := range c.Models {
+		metadata := modelConfig.Metadata
+		if metadata == nil {
+			continue
+		}
+		if metadata.ContextWindow < 0 {
+			errs = append(errs, fmt.Sprintf("  model %q metadata context_window must not be negative", modelName))
+		}
+		if price := metadata.Pricing; price != nil && (price.InputPerMillion < 0 || price.OutputPerMillion < 0) {
+			errs = append(errs, fmt.Sprintf("  model %q metadata pricing must not be negative", modelName))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("model metadata validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
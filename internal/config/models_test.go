@@ -0,0 +1,484 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestModelValidation tests model reference validation
+func TestModelValidation(t *testing.T) {
+	t.Run("valid provider/model format", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		configPath := filepath.Join(tmpDir, "config.json")
+		configContent := `{
+			"$schema": "http://json-schema.org/draft-07/schema#",
+			"server": {"port": 12345, "host": "localhost"},
+			"providers": {
+				"test": {
+					"url": "http://localhost:8080/v1",
+					"models": ["model1", "model2"]
+				}
+			},
+			"models": {
+				"my-model": {
+					"strategy": "fallback",
+				"providers": ["test/model1"]
+				}
+			},
+			"log_level": "info",
+			"thresholds": {"failures_before_switch": 3, "initial_timeout_ms": 10000, "max_timeout_ms": 300000}
+		}`
+
+		if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+			t.Fatalf("failed to write temp config: %v", err)
+		}
+
+		cfg, err := LoadFromPath(configPath)
+		assert.NoError(t, err)
+		assert.Len(t, cfg.Models["my-model"].Providers, 1)
+		assert.Equal(t, "test", cfg.Models["my-model"].Providers[0].Provider)
+		assert.Equal(t, "model1", cfg.Models["my-model"].Providers[0].Model)
+	})
+
+	t.Run("invalid provider reference", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		configPath := filepath.Join(tmpDir, "config.json")
+		configContent := `{
+			"$schema": "http://json-schema.org/draft-07/schema#",
+			"server": {"port": 12345, "host": "localhost"},
+			"providers": {
+				"test": {
+					"url": "http://localhost:8080/v1",
+					"models": ["model1"]
+				}
+			},
+			"models": {
+				"my-model": {
+					"strategy": "fallback",
+				"providers": ["unknown/model1"]
+				}
+			},
+			"log_level": "info",
+			"thresholds": {"failures_before_switch": 3, "initial_timeout_ms": 10000, "max_timeout_ms": 300000}
+		}`
+
+		if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+			t.Fatalf("failed to write temp config: %v", err)
+		}
+
+		_, err := LoadFromPath(configPath)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "unknown provider")
+	})
+
+	t.Run("invalid model reference in provider list", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		configPath := filepath.Join(tmpDir, "config.json")
+		configContent := `{
+			"$schema": "http://json-schema.org/draft-07/schema#",
+			"server": {"port": 12345, "host": "localhost"},
+			"providers": {
+				"test": {
+					"url": "http://localhost:8080/v1",
+					"models": ["model1", "model2"]
+				}
+			},
+			"models": {
+				"my-model": {
+					"strategy": "fallback",
+				"providers": ["test/nonexistent"]
+				}
+			},
+			"log_level": "info",
+			"thresholds": {"failures_before_switch": 3, "initial_timeout_ms": 10000, "max_timeout_ms": 300000}
+		}`
+
+		if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+			t.Fatalf("failed to write temp config: %v", err)
+		}
+
+		_, err := LoadFromPath(configPath)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "not found in provider")
+	})
+
+	t.Run("valid own model reference", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		configPath := filepath.Join(tmpDir, "config.json")
+		configContent := `{
+			"$schema": "http://json-schema.org/draft-07/schema#",
+			"server": {"port": 12345, "host": "localhost"},
+			"providers": {
+				"test": {
+					"url": "http://localhost:8080/v1",
+					"models": ["model1", "model2"]
+				}
+			},
+			"models": {
+				"my-model": {
+					"strategy": "fallback",
+					"providers": ["model1"]
+				}
+			},
+			"log_level": "info",
+			"thresholds": {"failures_before_switch": 3, "initial_timeout_ms": 10000, "max_timeout_ms": 300000}
+		}`
+
+		if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+			t.Fatalf("failed to write temp config: %v", err)
+		}
+
+		cfg, err := LoadFromPath(configPath)
+		assert.NoError(t, err)
+		assert.Len(t, cfg.Models["my-model"].Providers, 1)
+		assert.Equal(t, "test", cfg.Models["my-model"].Providers[0].Provider)
+		assert.Equal(t, "model1", cfg.Models["my-model"].Providers[0].Model)
+	})
+
+	t.Run("invalid own model reference", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		configPath := filepath.Join(tmpDir, "config.json")
+		configContent := `{
+			"$schema": "http://json-schema.org/draft-07/schema#",
+			"server": {"port": 12345, "host": "localhost"},
+			"providers": {
+				"test": {
+					"url": "http://localhost:8080/v1",
+					"models": ["model1", "model2"]
+				}
+			},
+			"models": {
+				"my-model": {
+					"strategy": "fallback",
+					"providers": ["nonexistent"]
+				}
+			},
+			"log_level": "info",
+			"thresholds": {"failures_before_switch": 3, "initial_timeout_ms": 10000, "max_timeout_ms": 300000}
+		}`
+
+		if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+			t.Fatalf("failed to write temp config: %v", err)
+		}
+
+		_, err := LoadFromPath(configPath)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "not found in any provider's models list")
+	})
+
+	t.Run("provider/model without models list definition passes", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		configPath := filepath.Join(tmpDir, "config.json")
+		configContent := `{
+			"$schema": "http://json-schema.org/draft-07/schema#",
+			"server": {"port": 12345, "host": "localhost"},
+			"providers": {
+				"test": {
+					"url": "http://localhost:8080/v1"
+				}
+			},
+			"models": {
+				"my-model": {
+					"strategy": "fallback",
+				"providers": ["test/any-model"]
+				}
+			},
+			"log_level": "info",
+			"thresholds": {"failures_before_switch": 3, "initial_timeout_ms": 10000, "max_timeout_ms": 300000}
+		}`
+
+		if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+			t.Fatalf("failed to write temp config: %v", err)
+		}
+
+		cfg, err := LoadFromPath(configPath)
+		assert.NoError(t, err)
+		assert.Len(t, cfg.Models["my-model"].Providers, 1)
+		assert.Equal(t, "test", cfg.Models["my-model"].Providers[0].Provider)
+		assert.Equal(t, "any-model", cfg.Models["my-model"].Providers[0].Model)
+	})
+
+	t.Run("valid object format model reference", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		configPath := filepath.Join(tmpDir, "config.json")
+		configContent := `{
+			"$schema": "http://json-schema.org/draft-07/schema#",
+			"server": {"port": 12345, "host": "localhost"},
+			"providers": {
+				"test": {
+					"url": "http://localhost:8080/v1",
+					"models": ["model1"]
+				}
+			},
+			"models": {
+				"my-model": {
+					"strategy": "fallback",
+					"providers": [{"provider": "test", "model": "model1"}]
+				}
+			},
+			"log_level": "info",
+			"thresholds": {"failures_before_switch": 3, "initial_timeout_ms": 10000, "max_timeout_ms": 300000}
+		}`
+
+		if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+			t.Fatalf("failed to write temp config: %v", err)
+		}
+
+		cfg, err := LoadFromPath(configPath)
+		assert.NoError(t, err)
+		assert.Len(t, cfg.Models["my-model"].Providers, 1)
+		assert.Equal(t, "test", cfg.Models["my-model"].Providers[0].Provider)
+		assert.Equal(t, "model1", cfg.Models["my-model"].Providers[0].Model)
+	})
+
+	t.Run("invalid object format model reference", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		configPath := filepath.Join(tmpDir, "config.json")
+		configContent := `{
+			"$schema": "http://json-schema.org/draft-07/schema#",
+			"server": {"port": 12345, "host": "localhost"},
+			"providers": {
+				"test": {
+					"url": "http://localhost:8080/v1",
+					"models": ["model1"]
+				}
+			},
+			"models": {
+				"my-model": {
+					"strategy": "fallback",
+					"providers": [{"provider": "test", "model": "nonexistent"}]
+				}
+			},
+			"log_level": "info",
+			"thresholds": {"failures_before_switch": 3, "initial_timeout_ms": 10000, "max_timeout_ms": 300000}
+		}`
+
+		if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+			t.Fatalf("failed to write temp config: %v", err)
+		}
+
+		_, err := LoadFromPath(configPath)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "not found in provider")
+	})
+}
+
+func TestValidateDefaultModels(t *testing.T) {
+	t.Run("no models with default", func(t *testing.T) {
+		cfg := &Config{
+			Models: map[string]ModelConfig{
+				"model-a": {Strategy: "fallback"},
+				"model-b": {Strategy: "fallback"},
+			},
+		}
+		err := cfg.ValidateDefaultModels()
+		assert.NoError(t, err)
+	})
+
+	t.Run("single model with default", func(t *testing.T) {
+		cfg := &Config{
+			Models: map[string]ModelConfig{
+				"model-a": {Strategy: "fallback", Default: true},
+				"model-b": {Strategy: "fallback"},
+			},
+		}
+		err := cfg.ValidateDefaultModels()
+		assert.NoError(t, err)
+	})
+
+	t.Run("multiple models with default", func(t *testing.T) {
+		cfg := &Config{
+			Models: map[string]ModelConfig{
+				"model-a": {Strategy: "fallback", Default: true},
+				"model-b": {Strategy: "fallback", Default: true},
+			},
+		}
+		err := cfg.ValidateDefaultModels()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "multiple models marked as default")
+		assert.Contains(t, err.Error(), "model-a")
+		assert.Contains(t, err.Error(), "model-b")
+	})
+
+	t.Run("three models with default", func(t *testing.T) {
+		cfg := &Config{
+			Models: map[string]ModelConfig{
+				"model-a": {Strategy: "fallback", Default: true},
+				"model-b": {Strategy: "fallback", Default: true},
+				"model-c": {Strategy: "fallback", Default: true},
+			},
+		}
+		err := cfg.ValidateDefaultModels()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "multiple models marked as default")
+	})
+
+	t.Run("empty models", func(t *testing.T) {
+		cfg := &Config{
+			Models: map[string]ModelConfig{},
+		}
+		err := cfg.ValidateDefaultModels()
+		assert.NoError(t, err)
+	})
+}
+
+func TestValidateStrategies(t *testing.T) {
+	tests := []struct {
+		name    string
+		model   ModelConfig
+		wantErr string
+	}{
+		{name: "empty defaults to fallback", model: ModelConfig{}},
+		{name: "priority alias", model: ModelConfig{Strategy: "priority"}},
+		{name: "round_robin alias", model: ModelConfig{Strategy: "round_robin"}},
+		{name: "weighted", model: ModelConfig{Strategy: StrategyWeighted, Providers: []ModelProvider{{Provider: "a", Model: "m", Weight: 3}}}},
+		{name: "unknown strategy", model: ModelConfig{Strategy: "fastest"}, wantErr: "invalid strategy"},
+		{name: "negative weight", model: ModelConfig{Strategy: StrategyWeighted, Providers: []ModelProvider{{Provider: "a", Model: "m", Weight: -1}}}, wantErr: "negative weight"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Models: map[string]ModelConfig{"m": tt.model}}
+			err := cfg.ValidateStrategies()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestNormalizeStrategy(t *testing.T) {
+	assert.Equal(t, StrategyFallback, NormalizeStrategy(""))
+	assert.Equal(t, StrategyFallback, NormalizeStrategy("priority"))
+	assert.Equal(t, StrategyRoundRobin, NormalizeStrategy("round_robin"))
+	assert.Equal(t, StrategyWeighted, NormalizeStrategy("weighted"))
+}
+
+func TestValidateModelMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata *ModelMetadata
+		wantErr  string
+	}{
+		{name: "none"},
+		{name: "valid", metadata: &ModelMetadata{Description: "d", Family: "llama", ParameterSize: "8B", ContextWindow: 8192, Pricing: &ModelPrice{InputPerMillion: 1}}},
+		{name: "negative context window", metadata: &ModelMetadata{ContextWindow: -1}, wantErr: "context_window must not be negative"},
+		{name: "negative price", metadata: &ModelMetadata{Pricing: &ModelPrice{OutputPerMillion: -1}}, wantErr: "pricing must not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Models: map[string]ModelConfig{"m": {Metadata: tt.metadata}}}
+			err := cfg.ValidateModelMetadata()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), `model "m" metadata `+tt.wantErr)
+		})
+	}
+}
+
+func TestLoadFromPath_ModelRoutingOptions(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.json")
+	configContent := `{
+		"providers": {
+			"local": {"url": "http://localhost:11434/v1", "models": ["llama3"], "options": {"strip": ["logit_bias"]}},
+			"hosted": {"url": "https://api.example.com/v1", "models": ["gpt-4o"]}
+		},
+		"models": {
+			"chat": {
+				"strategy": "round_robin",
+				"hedge_after_ms": 1500,
+				"sticky_header": "X-Session-ID",
+				"retry": {"max_attempts": 3, "backoff_ms": 50, "jitter": 0.1, "retry_on": [429, 503]},
+				"timeouts": {"connect_ms": 2000, "first_token_ms": 5000, "total_ms": 60000},
+				"metadata": {"description": "General chat", "family": "llama", "parameter_size": "8B", "context_window": 8192, "pricing": {"input_per_million": 0.1, "output_per_million": 0.2}},
+				"thresholds": {"failures_before_switch": 5, "cooldown_ms": 60000},
+				"providers": [
+					{"provider": "local", "model": "llama3", "weight": 3, "timeouts": {"first_token_ms": 20000}, "thresholds": {"failures_before_switch": 1},
+					 "options": {"clamp": {"temperature": {"max": 1}}, "defaults": {"options.num_ctx": 8192}},
+					 "chaos": {"error_rate": 0.2, "latency_ms": 300, "stream_drop_rate": 0.1, "stream_drop_after": 4, "seed": 7},
+					 "schedule": {"windows": [{"days": ["mon", "fri"], "start": "09:00", "end": "18:00"}], "timezone": "Europe/Berlin"}},
+					"hosted/gpt-4o"
+				]
+			}
+		}
+	}`
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("failed to write temp config: %v", err)
+	}
+
+	cfg, err := LoadFromPath(configPath)
+	assert.NoError(t, err)
+
+	model := cfg.Models["chat"]
+	assert.Equal(t, StrategyRoundRobin, model.Strategy)
+	assert.Equal(t, 1500*time.Millisecond, model.GetHedgeDelay())
+	assert.Equal(t, "X-Session-ID", model.StickyHeader)
+	assert.Equal(t, &ModelMetadata{Description: "General chat", Family: "llama", ParameterSize: "8B", ContextWindow: 8192, Pricing: &ModelPrice{InputPerMillion: 0.1, OutputPerMillion: 0.2}}, model.Metadata)
+	assert.Equal(t, 3, model.Providers[0].GetWeight())
+	assert.Equal(t, 1, model.Providers[1].GetWeight())
+	if assert.NotNil(t, model.Retry) {
+		assert.Equal(t, 3, model.Retry.MaxAttempts)
+		assert.Equal(t, []int{429, 503}, model.Retry.RetryOn)
+	}
+	local := model.BackendTimeouts(model.Providers[0])
+	assert.Equal(t, 2*time.Second, local.GetConnect())
+	assert.Equal(t, 20*time.Second, local.GetFirstToken())
+	assert.Equal(t, time.Minute, local.GetTotal())
+	assert.Equal(t, 5*time.Second, model.BackendTimeouts(model.Providers[1]).GetFirstToken())
+	if options := cfg.BackendOptions(model.Providers[0]); assert.Len(t, options, 2) {
+		assert.Equal(t, []string{"logit_bias"}, options[0].Strip, "provider rules apply first")
+		assert.Equal(t, 1.0, *options[1].Clamp["temperature"].Max)
+		assert.Equal(t, 8192.0, options[1].Defaults["options.num_ctx"])
+	}
+	assert.Empty(t, cfg.BackendOptions(model.Providers[1]))
+	assert.Equal(t, &ChaosConfig{ErrorRate: 0.2, LatencyMs: 300, StreamDropRate: 0.1, StreamDropAfter: 4, Seed: 7}, model.Providers[0].Chaos)
+	assert.Nil(t, model.Providers[1].Chaos)
+	assert.Equal(t, &ThresholdsConfig{FailuresBeforeSwitch: 5, CooldownMs: 60000}, model.Thresholds)
+	assert.Equal(t, &ThresholdsConfig{FailuresBeforeSwitch: 1}, model.Providers[0].Thresholds)
+	assert.Equal(t, &ScheduleConfig{Windows: []TimeWindow{{Days: []string{"mon", "fri"}, Start: "09:00", End: "18:00"}}, Timezone: "Europe/Berlin"}, model.Providers[0].Schedule)
+	assert.Nil(t, model.Providers[1].Schedule)
+}
+
+func TestResolveModel(t *testing.T) {
+	cfg := &Config{Models: map[string]ModelConfig{
+		"gpt-4":      {},
+		"gpt-*":      {},
+		"gpt-4o-*":   {},
+		"*-instruct": {},
+		"*":          {},
+	}}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "gpt-4", want: "gpt-4"},
+		{name: "gpt-3.5-turbo", want: "gpt-*"},
+		{name: "gpt-4o-mini", want: "gpt-4o-*"},
+		{name: "llama-3-instruct", want: "*-instruct"},
+		{name: "meta-llama/Llama-3", want: "*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := cfg.ResolveModel(tt.name)
+			assert.True(t, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	delete(cfg.Models, "*")
+	_, ok := cfg.ResolveModel("unknown")
+	assert.False(t, ok)
+}
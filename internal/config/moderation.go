@@ -0,0 +1,46 @@
+// Package config handles JSON configuration loading
+package config
+
+import "fmt"
+
+// ModerationConfig holds settings for /v1/moderations and pre-flight chat moderation
+type ModerationConfig struct {
+	Model      string             `json:"model"`      // Configured model used for moderation
+	Preflight  bool               `json:"preflight"`  // Moderate chat requests before forwarding them
+	Action     string             `json:"action"`     // "block" | "annotate", default "block"
+	Thresholds map[string]float64 `json:"thresholds"` // Per-category score thresholds (optional, defaults to the model's flags)
+}
+
+// Moderation action constants
+const (
+	ModerationActionBlock    = "block"
+	ModerationActionAnnotate = "annotate"
+)
+
+// GetAction returns the moderation action, defaulting to block
+func (m *ModerationConfig) GetAction() string {
+	if m == nil || m.Action == "" {
+		return ModerationActionBlock
+	}
+	return m.Action
+}
+
+// ValidateModeration checks that the moderation model exists and the action is known.
+func (c *Config) ValidateModeration() error {
+	if c.Moderation == nil {
+		return nil
+	}
+	if c.Moderation.Model != "" {
+		if _, exists := c.Models[c.Moderation.Model]; !exists {
+			return fmt.Errorf("moderation model %q is not defined in models", c.Moderation.Model)
+		}
+	} else if c.Moderation.Preflight {
+		return fmt.Errorf("moderation preflight requires a moderation model")
+	}
+	switch c.Moderation.Action {
+	case "", ModerationActionBlock, ModerationActionAnnotate:
+		return nil
+	default:
+		return fmt.Errorf("invalid moderation action: %q (must be 'block' or 'annotate')", c.Moderation.Action)
+	}
+}
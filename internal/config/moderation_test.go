@@ -0,0 +1,37 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateModeration(t *testing.T) {
+	models := map[string]ModelConfig{"guard": {Strategy: "fallback"}}
+
+	tests := []struct {
+		name       string
+		moderation *ModerationConfig
+		wantErr    string
+	}{
+		{name: "not configured"},
+		{name: "valid block", moderation: &ModerationConfig{Model: "guard", Preflight: true}},
+		{name: "valid annotate", moderation: &ModerationConfig{Model: "guard", Action: "annotate"}},
+		{name: "unknown model", moderation: &ModerationConfig{Model: "missing"}, wantErr: "not defined in models"},
+		{name: "preflight without model", moderation: &ModerationConfig{Preflight: true}, wantErr: "requires a moderation model"},
+		{name: "invalid action", moderation: &ModerationConfig{Model: "guard", Action: "drop"}, wantErr: "invalid moderation action"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Models: models, Moderation: tt.moderation}
+			err := cfg.ValidateModeration()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
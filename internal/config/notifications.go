@@ -0,0 +1,80 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"cmp"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Notification events
+const (
+	NotifyBackendDown = "backend_down" // A backend was taken out of rotation by failures or a health check
+	NotifyBackendUp   = "backend_up"   // A backend that was down is back in rotation
+	NotifyModelDown   = "model_down"   // Every backend of a model is out of rotation
+	NotifyModelUp     = "model_up"     // A model that was down has a backend in rotation again
+)
+
+// Notification payload formats
+const (
+	NotifyFormatJSON    = "json"    // The event as JSON
+	NotifyFormatSlack   = "slack"   // A Slack incoming webhook message
+	NotifyFormatDiscord = "discord" // A Discord webhook message
+)
+
+// notifyEvents lists the notification events
+var notifyEvents = []string{NotifyBackendDown, NotifyBackendUp, NotifyModelDown, NotifyModelUp}
+
+// Notification is a webhook told about backend and model outages and recoveries
+type Notification struct {
+	Name    string   `json:"name,omitempty"`   // Name for logs
+	Webhook string   `json:"webhook"`          // URL posted to (supports ${VAR} expansion)
+	Format  string   `json:"format,omitempty"` // "json" (default) | "slack" | "discord"
+	Events  []string `json:"events,omitempty"` // Events posted (default all)
+}
+
+// GetWebhook returns the webhook URL with environment variables expanded
+func (n Notification) GetWebhook() string {
+	return expandEnvVars(n.Webhook)
+}
+
+// GetFormat returns the payload format
+func (n Notification) GetFormat() string {
+	if n.Format == "" {
+		return NotifyFormatJSON
+	}
+	return n.Format
+}
+
+// Wants reports whether the webhook is posted event
+func (n Notification) Wants(event string) bool {
+	return len(n.Events) == 0 || slices.Contains(n.Events, event)
+}
+
+// ValidateNotifications checks the webhook, format and events of each notification
+func (c *Config) ValidateNotifications() error {
+	var errs []string
+	for i, n := range c.Notifications {
+		name := cmp.Or(n.Name, fmt.Sprintf("notifications[%d]", i))
+		if u, err := url.Parse(n.GetWebhook()); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Sprintf("  notification %q: webhook must be an http:// or https:// URL", name))
+		}
+		switch n.GetFormat() {
+		case NotifyFormatJSON, NotifyFormatSlack, NotifyFormatDiscord:
+		default:
+			errs = append(errs, fmt.Sprintf("  notification %q: invalid format %q (must be %s, %s or %s)",
+				name, n.Format, NotifyFormatJSON, NotifyFormatSlack, NotifyFormatDiscord))
+		}
+		for _, event := range n.Events {
+			if !slices.Contains(notifyEvents, event) {
+				errs = append(errs, fmt.Sprintf("  notification %q: unknown event %q (must be one of %s)", name, event, strings.Join(notifyEvents, ", ")))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("notifications validation failed:\n%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateNotifications(t *testing.T) {
+	tests := []struct {
+		name          string
+		notifications []Notification
+		wantErr       []string
+	}{
+		{name: "valid", notifications: []Notification{
+			{Webhook: "https://hooks.slack.com/services/T0/B0/x", Format: NotifyFormatSlack},
+			{Webhook: "${ONCALL_WEBHOOK}", Events: []string{NotifyModelDown, NotifyModelUp}},
+		}},
+		{name: "invalid", notifications: []Notification{
+			{Name: "oncall", Webhook: "hooks.example.com", Format: "teams", Events: []string{"backend_slow"}},
+		}, wantErr: []string{
+			`notification "oncall": webhook must be`, `notification "oncall": invalid format "teams"`, `notification "oncall": unknown event "backend_slow"`,
+		}},
+	}
+	t.Setenv("ONCALL_WEBHOOK", "https://oncall.example.com/hook")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Notifications: tt.notifications}
+			err := cfg.ValidateNotifications()
+			if len(tt.wantErr) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				for _, want := range tt.wantErr {
+					assert.Contains(t, err.Error(), want)
+				}
+			}
+		})
+	}
+}
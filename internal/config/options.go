@@ -0,0 +1,90 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OptionRules rewrite the options of requests forwarded to a backend, for backends that
+// reject or misread some of them. They apply in order: strip, rename, clamp, defaults.
+// Options are request fields in the backend's API format, dotted for nested fields
+// (e.g. "options.num_ctx").
+type OptionRules struct {
+	Strip    []string               `json:"strip,omitempty"`    // Options removed
+	Rename   map[string]string      `json:"rename,omitempty"`   // Options moved to another name
+	Clamp    map[string]OptionRange `json:"clamp,omitempty"`    // Numeric options held within a range
+	Defaults map[string]any         `json:"defaults,omitempty"` // Options set when the request leaves them out
+}
+
+// OptionRange bounds a numeric option; either end may be left open
+type OptionRange struct {
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+}
+
+// IsEmpty reports whether the rules leave requests unchanged
+func (r *OptionRules) IsEmpty() bool {
+	return r == nil || len(r.Strip)+len(r.Rename)+len(r.Clamp)+len(r.Defaults) == 0
+}
+
+// BackendOptions returns the option rules of a backend, in the order they apply: its
+// provider's, then its own
+func (c *Config) BackendOptions(mp ModelProvider) []*OptionRules {
+	var rules []*OptionRules
+	if r := c.Providers[mp.Provider].Options; !r.IsEmpty() {
+		rules = append(rules, r)
+	}
+	if !mp.Options.IsEmpty() {
+		rules = append(rules, mp.Options)
+	}
+	return rules
+}
+
+// ValidateOptionRules checks that option rules name their options and clamp to sensible ranges
+func (c *Config) ValidateOptionRules() error {
+	var errs []string
+	check := func(owner string, r *OptionRules) {
+		if r == nil {
+			return
+		}
+		for _, name := range r.Strip {
+			if name == "" {
+				errs = append(errs, fmt.Sprintf("  %s strips an empty option name", owner))
+			}
+		}
+		for from, to := range r.Rename {
+			if from == "" || to == "" || from == to {
+				errs = append(errs, fmt.Sprintf("  %s renames %q to %q; both names are required and must differ", owner, from, to))
+			}
+		}
+		for name, rng := range r.Clamp {
+			switch {
+			case rng.Min == nil && rng.Max == nil:
+				errs = append(errs, fmt.Sprintf("  %s clamps %q without min or max", owner, name))
+			case rng.Min != nil && rng.Max != nil && *rng.Min > *rng.Max:
+				errs = append(errs, fmt.Sprintf("  %s clamps %q with min above max", owner, name))
+			}
+		}
+		for name, value := range r.Defaults {
+			if value == nil {
+				errs = append(errs, fmt.Sprintf("  %s defaults %q to null", owner, name))
+			}
+		}
+	}
+
+	for providerName, providerConfig := range c.Providers {
+		check(fmt.Sprintf("provider %q options", providerName), providerConfig.Options)
+	}
+	for modelName, modelConfig := range c.Models {
+		for i, p := range modelConfig.Providers {
+			check(fmt.Sprintf("model %q providers[%d] options", modelName, i), p.Options)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("options validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateOptionRules(t *testing.T) {
+	low, high := 0.0, 2.0
+	tests := []struct {
+		name    string
+		options *OptionRules
+		wantErr string
+	}{
+		{name: "none"},
+		{name: "valid", options: &OptionRules{
+			Strip:    []string{"logit_bias"},
+			Rename:   map[string]string{"max_tokens": "max_completion_tokens"},
+			Clamp:    map[string]OptionRange{"temperature": {Min: &low, Max: &high}},
+			Defaults: map[string]any{"options.num_ctx": 8192},
+		}},
+		{name: "empty strip", options: &OptionRules{Strip: []string{""}}, wantErr: "strips an empty option name"},
+		{name: "rename to itself", options: &OptionRules{Rename: map[string]string{"seed": "seed"}}, wantErr: `renames "seed" to "seed"`},
+		{name: "unbounded clamp", options: &OptionRules{Clamp: map[string]OptionRange{"temperature": {}}}, wantErr: `clamps "temperature" without min or max`},
+		{name: "inverted clamp", options: &OptionRules{Clamp: map[string]OptionRange{"temperature": {Min: &high, Max: &low}}}, wantErr: `clamps "temperature" with min above max`},
+		{name: "null default", options: &OptionRules{Defaults: map[string]any{"seed": nil}}, wantErr: `defaults "seed" to null`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Providers: map[string]ProviderConfig{"local": {}},
+				Models:    map[string]ModelConfig{"m": {Providers: []ModelProvider{{Provider: "local", Model: "llama3", Options: tt.options}}}},
+			}
+			err := cfg.ValidateOptionRules()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), `model "m" providers[0] options `+tt.wantErr)
+		})
+	}
+}
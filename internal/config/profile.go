@@ -0,0 +1,61 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// ProfileEnvVar selects the profile of the config to apply, e.g. OPENMODEL_PROFILE=prod
+const ProfileEnvVar = "OPENMODEL_PROFILE"
+
+// applyProfile merges the profile selected by OPENMODEL_PROFILE over the rest of the
+// config, the way included files are merged, and drops the "profiles" section. It
+// returns the name of the profile applied, "" when none is selected.
+func applyProfile(data []byte) ([]byte, string, error) {
+	name := os.Getenv(ProfileEnvVar)
+	var raw map[string]any
+	if json.Unmarshal(data, &raw) != nil {
+		// Left for parsing to report with line numbers
+		return data, "", nil
+	}
+	section, hasProfiles := raw["profiles"]
+	if !hasProfiles && name == "" {
+		return data, "", nil
+	}
+
+	profiles, ok := section.(map[string]any)
+	if hasProfiles && !ok {
+		return nil, "", fmt.Errorf("profiles must be an object of config sections by profile name")
+	}
+	delete(raw, "profiles")
+	if name != "" {
+		profile, ok := profiles[name].(map[string]any)
+		if !ok {
+			if len(profiles) == 0 {
+				return nil, "", fmt.Errorf("%s=%s: the config defines no profiles", ProfileEnvVar, name)
+			}
+			names := make([]string, 0, len(profiles))
+			for profileName := range profiles {
+				names = append(names, profileName)
+			}
+			slices.Sort(names)
+			return nil, "", fmt.Errorf("%s=%s: the config defines no such profile (profiles: %s)", ProfileEnvVar, name, strings.Join(names, ", "))
+		}
+		for _, key := range []string{"profiles", "include", "$schema"} {
+			if _, ok := profile[key]; ok {
+				return nil, "", fmt.Errorf("profile %q may not set %q", name, key)
+			}
+		}
+		raw = mergeMaps(raw, profile)
+	}
+
+	merged, err := json.Marshal(raw)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to marshal config profile: %w", err)
+	}
+	return merged, name, nil
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadFromPath_Profiles(t *testing.T) {
+	config := `{
+		"providers": {
+			"local": {"url": "http://localhost:11434/v1", "models": ["llama3"]},
+			"openai": {"url": "https://api.openai.com/v1", "api_key": "${OPENMODEL_TEST_PROD_KEY}"}
+		},
+		"models": {"chat": ["local/llama3"]},
+		"thresholds": {"failures_before_switch": 3, "initial_timeout_ms": 10000, "max_timeout_ms": 300000},
+		"strict_env": true,
+		"profiles": {
+			"dev": {"log_level": "debug", "providers": {"openai": null}},
+			"prod": {
+				"providers": {"local": {"url": "http://gpu:11434/v1"}},
+				"models": {"chat": ["openai/gpt-4o", "local/llama3"]},
+				"thresholds": {"failures_before_switch": 1}
+			}
+		}
+	}`
+	tests := []struct {
+		name      string
+		profile   string
+		wantURL   string
+		wantChain []string
+		wantTries int
+		wantErr   string
+	}{
+		{name: "no profile", wantURL: "http://localhost:11434/v1", wantChain: []string{"local/llama3"}, wantTries: 3, wantErr: "OPENMODEL_TEST_PROD_KEY is not set"},
+		{name: "dev", profile: "dev", wantURL: "http://localhost:11434/v1", wantChain: []string{"local/llama3"}, wantTries: 3},
+		{name: "prod", profile: "prod", wantURL: "http://gpu:11434/v1", wantChain: []string{"openai/gpt-4o", "local/llama3"}, wantTries: 1},
+		{name: "unknown", profile: "staging", wantErr: "no such profile (profiles: dev, prod)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(ProfileEnvVar, tt.profile)
+			if tt.profile == "prod" {
+				t.Setenv("OPENMODEL_TEST_PROD_KEY", "sk-prod")
+			}
+			configPath := filepath.Join(t.TempDir(), "config.json")
+			if !assert.NoError(t, os.WriteFile(configPath, []byte(config), 0644)) {
+				return
+			}
+
+			cfg, err := LoadFromPath(configPath)
+			if tt.wantErr != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tt.wantErr)
+				}
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tt.profile, cfg.GetProfile())
+			assert.Equal(t, tt.profile != "dev", cfg.Providers["openai"].URL != "", "null removes a provider")
+			assert.Equal(t, tt.wantURL, cfg.Providers["local"].URL)
+			var chain []string
+			for _, p := range cfg.Models["chat"].Providers {
+				chain = append(chain, string(p.ToProviderModel()))
+			}
+			assert.Equal(t, tt.wantChain, chain)
+			assert.Equal(t, tt.wantTries, cfg.Thresholds.FailuresBeforeSwitch)
+		})
+	}
+}
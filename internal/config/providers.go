@@ -0,0 +1,396 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+)
+
+// ProviderConfig holds provider connection settings
+type ProviderConfig struct {
+	// Type is the provider implementation: "openai" (default) for OpenAI-compatible APIs,
+	// "anthropic" for the native Anthropic Messages API (implies api_mode "anthropic"), or
+	// one implying api_mode "openai": "cohere" (Cohere v2 chat and embed APIs), "mistral"
+	// (Mistral's La Plateforme), "vllm" (vLLM's OpenAI server) or "tgi" (HuggingFace TGI)
+	Type   string `json:"type,omitempty"`
+	URL    string `json:"url"`     // Base URL for the provider (e.g., https://api.openai.com/v1)
+	APIKey string `json:"api_key"` // API key (supports ${VAR} expansion)
+	// APIKeySource fetches the API key from a file, a command or a secret manager instead
+	APIKeySource *CredentialSource `json:"api_key_source,omitempty"`
+	ApiMode      string            `json:"api_mode"`   // API format: "openai" or "anthropic" (required)
+	Models       []string          `json:"models"`     // List of models available on this provider
+	Thresholds   *ThresholdsConfig `json:"thresholds"` // Provider-specific thresholds (optional, defaults to global)
+	Audio        bool              `json:"audio"`      // Provider serves /v1/audio endpoints (transcription, speech)
+	// Headers are extra HTTP headers sent on every request to the provider (values
+	// support ${VAR} expansion), e.g. an organization id or a gateway's own auth header
+	Headers map[string]string `json:"headers,omitempty"`
+	// Organization and Project select the OpenAI organization and project billed for
+	// requests, for keys that belong to several (sent as OpenAI-Organization and
+	// OpenAI-Project, supports ${VAR} expansion)
+	Organization string `json:"organization,omitempty"`
+	Project      string `json:"project,omitempty"`
+	// HTTP overrides the global http client settings for this provider; settings it leaves
+	// out (or zero) are inherited, and its proxy is ignored in favor of Proxy
+	HTTP *HTTPConfig `json:"http,omitempty"`
+	// Proxy overrides http.proxy for this provider: a proxy URL, or "direct" to connect
+	// without one (supports ${VAR} expansion)
+	Proxy string `json:"proxy,omitempty"`
+	// Capabilities the provider's models support (optional, the provider type's defaults
+	// when unset); see Capability*
+	Capabilities []string `json:"capabilities,omitempty"`
+	// MaxContext is the context window of the provider's models in tokens, reported by
+	// /v1/models (optional)
+	MaxContext int `json:"max_context,omitempty"`
+	// Pricing maps model names ("*" for any other model) to token prices, for spend tracking
+	Pricing map[string]ModelPrice `json:"pricing,omitempty"`
+	// Budget caps spend on the provider; once reached it is skipped until the period ends
+	Budget *BudgetConfig `json:"budget,omitempty"`
+	// MaxConcurrency caps requests in flight to the provider across all its models; further
+	// requests spill over to the next backend in the chain (0 means unlimited)
+	MaxConcurrency int `json:"max_concurrency,omitempty"`
+	// Options rewrites the options of requests forwarded to the provider
+	Options *OptionRules `json:"options,omitempty"`
+	// Replay configures a provider of type "replay"
+	Replay *ReplayConfig `json:"replay,omitempty"`
+	// Echo configures a provider of type "echo"
+	Echo *EchoConfig `json:"echo,omitempty"`
+}
+
+// EchoConfig sets the artificial latency of an "echo" provider, which answers with the
+// prompt (see provider.EchoProvider)
+type EchoConfig struct {
+	DelayMs      int `json:"delay_ms,omitempty"`       // Before the response, or its first token
+	TokenDelayMs int `json:"token_delay_ms,omitempty"` // Between streamed tokens
+}
+
+// ReplayConfig makes a "replay" provider answer from fixture files instead of a backend
+// (see provider.ReplayProvider)
+type ReplayConfig struct {
+	Fixtures string `json:"fixtures"` // Directory of fixture files (supports ${VAR} expansion)
+	// Record forwards requests no fixture matches to the provider url and saves the
+	// responses as new fixtures
+	Record bool `json:"record,omitempty"`
+}
+
+// GetHeaders returns the extra headers sent on every request to the provider: the
+// configured headers plus the organization and project ones, unless headers sets them
+func (pc ProviderConfig) GetHeaders() map[string]string {
+	if pc.Organization == "" && pc.Project == "" {
+		return pc.Headers
+	}
+	headers := maps.Clone(pc.Headers)
+	if headers == nil {
+		headers = make(map[string]string, 2)
+	}
+	set := func(name, value string) {
+		if value == "" {
+			return
+		}
+		for key := range headers {
+			if strings.EqualFold(key, name) {
+				return
+			}
+		}
+		headers[name] = value
+	}
+	set("OpenAI-Organization", pc.Organization)
+	set("OpenAI-Project", pc.Project)
+	return headers
+}
+
+// CredentialSource fetches a secret instead of reading it from the config. Set exactly one
+// source; its settings support ${VAR} expansion.
+type CredentialSource struct {
+	File      string   `json:"file,omitempty"`       // File holding the secret
+	Command   []string `json:"command,omitempty"`    // Command (and arguments) printing the secret
+	Vault     string   `json:"vault,omitempty"`      // Vault KV path, "path#field" (field defaults to api_key; VAULT_ADDR, VAULT_TOKEN)
+	AWSSecret string   `json:"aws_secret,omitempty"` // AWS Secrets Manager secret id, "id#field" for JSON secrets (aws CLI)
+	GCPSecret string   `json:"gcp_secret,omitempty"` // GCP Secret Manager secret name or projects/.../secrets/... (gcloud CLI)
+	// RefreshSeconds refetches the secret this often, in the background (0 fetches it once)
+	RefreshSeconds int `json:"refresh_seconds,omitempty"`
+}
+
+// count returns how many sources are set
+func (s *CredentialSource) count() int {
+	n := 0
+	for _, set := range []bool{s.File != "", len(s.Command) > 0, s.Vault != "", s.AWSSecret != "", s.GCPSecret != ""} {
+		if set {
+			n++
+		}
+	}
+	return n
+}
+
+// expandEnvVars expands environment variables in the source settings
+func (s *CredentialSource) expandEnvVars() {
+	s.File = expandEnvVars(s.File)
+	s.Vault = expandEnvVars(s.Vault)
+	s.AWSSecret = expandEnvVars(s.AWSSecret)
+	s.GCPSecret = expandEnvVars(s.GCPSecret)
+	if len(s.Command) > 0 {
+		command := make([]string, len(s.Command))
+		for i, arg := range s.Command {
+			command[i] = expandEnvVars(arg)
+		}
+		s.Command = command
+	}
+}
+
+// expandProviderEnvVars expands environment variables in provider config
+func expandProviderEnvVars(pc *ProviderConfig) {
+	pc.APIKey = expandEnvVars(pc.APIKey)
+	pc.URL = expandEnvVars(pc.URL)
+	pc.Proxy = expandEnvVars(pc.Proxy)
+	pc.Organization = expandEnvVars(pc.Organization)
+	pc.Project = expandEnvVars(pc.Project)
+	if pc.APIKeySource != nil {
+		source := *pc.APIKeySource
+		source.expandEnvVars()
+		pc.APIKeySource = &source
+	}
+	if pc.Replay != nil {
+		replay := *pc.Replay
+		replay.Fixtures = expandEnvVars(replay.Fixtures)
+		pc.Replay = &replay
+	}
+	if len(pc.Headers) > 0 {
+		headers := make(map[string]string, len(pc.Headers))
+		for key, value := range pc.Headers {
+			headers[key] = expandEnvVars(value)
+		}
+		pc.Headers = headers
+	}
+}
+
+// ValidateProviderReferences checks that all model providers are defined
+// in the providers section. Returns an error with details if any references
+// are invalid.
+func (c *Config) ValidateProviderReferences() error {
+	var errs []string
+
+	for modelName, modelConfig := range c.Models {
+		for i, providerRef := range modelConfig.Providers {
+			// Check provider exists
+			if _, exists := c.Providers[providerRef.Provider]; !exists {
+				errs = append(errs, fmt.Sprintf(
+					"  model %q providers[%d] references undefined provider %q",
+					modelName, i, providerRef.Provider))
+			}
+		}
+	}
+
+	if c.Management != nil && c.Management.Enabled {
+		if _, exists := c.Providers[c.Management.Provider]; !exists {
+			errs = append(errs, fmt.Sprintf(
+				"  management references undefined provider %q", c.Management.Provider))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("provider validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// ValidateProviderLimits checks that prices, budgets and concurrency limits are not negative
+// and that budgeted providers have pricing to measure spend against
+func (c *Config) ValidateProviderLimits() error {
+	var errs []string
+
+	for providerName, providerConfig := range c.Providers {
+		for model, price := range providerConfig.Pricing {
+			if price.InputPerMillion < 0 || price.OutputPerMillion < 0 {
+				errs = append(errs, fmt.Sprintf(
+					"  provider %q pricing for %q must not be negative", providerName, model))
+			}
+		}
+		if providerConfig.MaxConcurrency < 0 {
+			errs = append(errs, fmt.Sprintf(
+				"  provider %q max_concurrency must not be negative", providerName))
+		}
+		if providerConfig.MaxContext < 0 {
+			errs = append(errs, fmt.Sprintf(
+				"  provider %q max_context must not be negative", providerName))
+		}
+		b := providerConfig.Budget
+		if b == nil {
+			continue
+		}
+		if b.Daily < 0 || b.Monthly < 0 {
+			errs = append(errs, fmt.Sprintf(
+				"  provider %q budget must not be negative", providerName))
+		}
+		if len(providerConfig.Pricing) == 0 {
+			errs = append(errs, fmt.Sprintf(
+				"  provider %q has a budget but no pricing", providerName))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("provider limits validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// ValidateProviderHeaders checks that provider headers are well-formed, so a typo fails at
+// load time rather than on every request
+func (c *Config) ValidateProviderHeaders() error {
+	var errs []string
+
+	for providerName, providerConfig := range c.Providers {
+		for key, value := range providerConfig.Headers {
+			if key == "" || strings.ContainsAny(key, " \t\r\n:") {
+				errs = append(errs, fmt.Sprintf(
+					"  provider %q has invalid header name %q", providerName, key))
+			}
+			if strings.ContainsAny(value, "\r\n") {
+				errs = append(errs, fmt.Sprintf(
+					"  provider %q header %q must not contain line breaks", providerName, key))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("provider headers validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// ValidateCredentialSources checks that each api_key_source sets exactly one source and
+// does not come with an api_key
+func (c *Config) ValidateCredentialSources() error {
+	var errs []string
+
+	for providerName, providerConfig := range c.Providers {
+		source := providerConfig.APIKeySource
+		if source == nil {
+			continue
+		}
+		if n := source.count(); n != 1 {
+			errs = append(errs, fmt.Sprintf(
+				"  provider %q api_key_source must set exactly one of file, command, vault, aws_secret or gcp_secret (%d set)", providerName, n))
+		}
+		if providerConfig.APIKey != "" {
+			errs = append(errs, fmt.Sprintf(
+				"  provider %q cannot set both api_key and api_key_source", providerName))
+		}
+		if source.RefreshSeconds < 0 {
+			errs = append(errs, fmt.Sprintf(
+				"  provider %q api_key_source refresh_seconds must not be negative", providerName))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("credential sources validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// ValidateEcho checks that echo delays are not negative and that only echo providers set them
+func (c *Config) ValidateEcho() error {
+	var errs []string
+
+	for providerName, providerConfig := range c.Providers {
+		echo := providerConfig.Echo
+		if echo == nil {
+			continue
+		}
+		if providerConfig.Type != "echo" {
+			errs = append(errs, fmt.Sprintf(
+				"  provider %q sets echo but is not of type 'echo'", providerName))
+		} else if echo.DelayMs < 0 || echo.TokenDelayMs < 0 {
+			errs = append(errs, fmt.Sprintf(
+				"  provider %q echo delays must not be negative", providerName))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("echo validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// ValidateReplay checks that replay providers have a fixtures directory, and a url to
+// record from in record mode, and that other providers do not configure replay
+func (c *Config) ValidateReplay() error {
+	var errs []string
+
+	for providerName, providerConfig := range c.Providers {
+		replay := providerConfig.Replay
+		if providerConfig.Type != "replay" {
+			if replay != nil {
+				errs = append(errs, fmt.Sprintf(
+					"  provider %q sets replay but is not of type 'replay'", providerName))
+			}
+			continue
+		}
+		if replay == nil || replay.Fixtures == "" {
+			errs = append(errs, fmt.Sprintf(
+				"  provider %q of type 'replay' needs replay.fixtures", providerName))
+			continue
+		}
+		if replay.Record && providerConfig.URL == "" {
+			errs = append(errs, fmt.Sprintf(
+				"  provider %q records fixtures but has no url to record from", providerName))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("replay validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// ValidateApiModes checks that all provider api_mode and type values are valid.
+// Returns an error if any provider has an invalid api_mode (empty is allowed for passthrough),
+// an unknown type, or a native type with an api_mode other than its own, or if a plugin
+// has no command or reuses a built-in type name.
+func (c *Config) ValidateApiModes() error {
+	validApiModes := map[string]bool{"": true, "openai": true, "anthropic": true}
+	// Native provider types speak one API format
+	typeModes := map[string]string{"": "", "openai": "", "anthropic": "anthropic", "cohere": "openai", "mistral": "openai", "vllm": "openai", "tgi": "openai", "replay": "", "echo": "openai"}
+	var errs []string
+
+	for pluginName, plugin := range c.Plugins {
+		if _, builtin := typeModes[pluginName]; builtin {
+			errs = append(errs, fmt.Sprintf("  plugin %q shadows a built-in provider type", pluginName))
+		}
+		if len(plugin.Command) == 0 {
+			errs = append(errs, fmt.Sprintf("  plugin %q has no command", pluginName))
+		}
+	}
+
+	for providerName, providerConfig := range c.Providers {
+		if !validApiModes[providerConfig.ApiMode] {
+			errs = append(errs, fmt.Sprintf(
+				"  provider %q has invalid api_mode: %q (must be 'openai', 'anthropic', or empty for passthrough)",
+				providerName, providerConfig.ApiMode))
+		}
+		mode, ok := typeModes[providerConfig.Type]
+		if _, plugin := c.Plugins[providerConfig.Type]; plugin && !ok {
+			// Plugins speak the OpenAI API
+			mode, ok = "openai", true
+		}
+		if !ok {
+			errs = append(errs, fmt.Sprintf(
+				"  provider %q has invalid type: %q (must be 'openai', 'anthropic', 'cohere', 'mistral', 'vllm', 'tgi', 'replay', 'echo' or a plugin)",
+				providerName, providerConfig.Type))
+		} else if mode != "" && providerConfig.ApiMode != "" && providerConfig.ApiMode != mode {
+			errs = append(errs, fmt.Sprintf(
+				"  provider %q of type %q cannot use api_mode %q", providerName, providerConfig.Type, providerConfig.ApiMode))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("api_mode validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
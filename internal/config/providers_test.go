@@ -0,0 +1,384 @@
+package config
+
+import (
+	"maps"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestExpandProviderEnvVars tests the expandProviderEnvVars function
+func TestExpandProviderEnvVars(t *testing.T) {
+	defer os.Unsetenv("TEST_API_KEY")
+	os.Setenv("TEST_API_KEY", "secret123")
+
+	t.Run("expands API key and URL", func(t *testing.T) {
+		pc := &ProviderConfig{
+			URL:    "http://localhost:${PORT}/v1",
+			APIKey: "${TEST_API_KEY}",
+		}
+		os.Setenv("PORT", "8080")
+		defer os.Unsetenv("PORT")
+
+		expandProviderEnvVars(pc)
+
+		if pc.APIKey != "secret123" {
+			t.Errorf("APIKey = %q, want %q", pc.APIKey, "secret123")
+		}
+		if pc.URL != "http://localhost:8080/v1" {
+			t.Errorf("URL = %q, want %q", pc.URL, "http://localhost:8080/v1")
+		}
+	})
+
+	t.Run("expands api key source", func(t *testing.T) {
+		pc := &ProviderConfig{APIKeySource: &CredentialSource{Command: []string{"op", "read", "${TEST_API_KEY}"}, Vault: "secret/${TEST_API_KEY}"}}
+
+		expandProviderEnvVars(pc)
+
+		if pc.APIKeySource.Command[2] != "secret123" || pc.APIKeySource.Vault != "secret/secret123" {
+			t.Errorf("APIKeySource = %+v, want its settings expanded", pc.APIKeySource)
+		}
+	})
+
+	t.Run("expands header values", func(t *testing.T) {
+		headers := map[string]string{"X-Org-Id": "org-1", "X-Gateway-Key": "${TEST_API_KEY}"}
+		pc := &ProviderConfig{Headers: headers}
+
+		expandProviderEnvVars(pc)
+
+		if pc.Headers["X-Gateway-Key"] != "secret123" || pc.Headers["X-Org-Id"] != "org-1" {
+			t.Errorf("Headers = %v, want the key expanded", pc.Headers)
+		}
+		if headers["X-Gateway-Key"] != "${TEST_API_KEY}" {
+			t.Errorf("expected the original headers untouched, got %v", headers)
+		}
+	})
+
+	t.Run("expands organization and project", func(t *testing.T) {
+		pc := &ProviderConfig{Organization: "org-${TEST_API_KEY}", Project: "${TEST_API_KEY}"}
+
+		expandProviderEnvVars(pc)
+
+		if pc.Organization != "org-secret123" || pc.Project != "secret123" {
+			t.Errorf("Organization, Project = %q, %q, want them expanded", pc.Organization, pc.Project)
+		}
+	})
+}
+
+func TestProviderConfig_GetHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider ProviderConfig
+		want     map[string]string
+	}{
+		{name: "none"},
+		{name: "headers only", provider: ProviderConfig{Headers: map[string]string{"X-Org-Id": "acme"}}, want: map[string]string{"X-Org-Id": "acme"}},
+		{
+			name:     "organization and project",
+			provider: ProviderConfig{Organization: "org-1", Project: "proj-1", Headers: map[string]string{"X-Org-Id": "acme"}},
+			want:     map[string]string{"X-Org-Id": "acme", "OpenAI-Organization": "org-1", "OpenAI-Project": "proj-1"},
+		},
+		{name: "project only", provider: ProviderConfig{Project: "proj-1"}, want: map[string]string{"OpenAI-Project": "proj-1"}},
+		{
+			name:     "headers win",
+			provider: ProviderConfig{Organization: "org-1", Headers: map[string]string{"openai-organization": "org-2"}},
+			want:     map[string]string{"openai-organization": "org-2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := maps.Clone(tt.provider.Headers)
+			assert.Equal(t, tt.want, tt.provider.GetHeaders())
+			assert.Equal(t, headers, tt.provider.Headers, "configured headers are left as is")
+		})
+	}
+}
+
+// TestValidateProviderReferences tests the ValidateProviderReferences function
+func TestValidateProviderReferences(t *testing.T) {
+	t.Run("valid references", func(t *testing.T) {
+		cfg := &Config{
+			Providers: map[string]ProviderConfig{
+				"openai": {URL: "https://api.openai.com/v1"},
+				"ollama": {URL: "http://localhost:11434/v1"},
+			},
+			Models: map[string]ModelConfig{
+				"gpt-4": {
+					Strategy: StrategyFallback,
+					Providers: []ModelProvider{
+						{Provider: "openai", Model: "gpt-4"},
+						{Provider: "ollama", Model: "llama2"},
+					},
+				},
+			},
+		}
+
+		err := cfg.ValidateProviderReferences()
+		assert.NoError(t, err)
+	})
+
+	t.Run("missing provider reference", func(t *testing.T) {
+		cfg := &Config{
+			Providers: map[string]ProviderConfig{
+				"openai": {URL: "https://api.openai.com/v1"},
+			},
+			Models: map[string]ModelConfig{
+				"gpt-4": {
+					Strategy: StrategyFallback,
+					Providers: []ModelProvider{
+						{Provider: "openai", Model: "gpt-4"},
+						{Provider: "missing", Model: "claude"}, // This provider doesn't exist
+					},
+				},
+			},
+		}
+
+		err := cfg.ValidateProviderReferences()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "missing")
+		assert.Contains(t, err.Error(), `"gpt-4"`)
+	})
+
+	t.Run("multiple missing providers", func(t *testing.T) {
+		cfg := &Config{
+			Providers: map[string]ProviderConfig{
+				"local": {URL: "http://localhost:11434/v1"},
+			},
+			Models: map[string]ModelConfig{
+				"model1": {
+					Strategy: StrategyFallback,
+					Providers: []ModelProvider{
+						{Provider: "missing1", Model: "m1"},
+					},
+				},
+				"model2": {
+					Strategy: StrategyFallback,
+					Providers: []ModelProvider{
+						{Provider: "missing2", Model: "m2"},
+					},
+				},
+			},
+		}
+
+		err := cfg.ValidateProviderReferences()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "missing1")
+		assert.Contains(t, err.Error(), "missing2")
+	})
+
+	t.Run("empty models", func(t *testing.T) {
+		cfg := &Config{
+			Providers: map[string]ProviderConfig{
+				"openai": {URL: "https://api.openai.com/v1"},
+			},
+			Models: map[string]ModelConfig{},
+		}
+
+		err := cfg.ValidateProviderReferences()
+		assert.NoError(t, err)
+	})
+
+	t.Run("empty providers", func(t *testing.T) {
+		cfg := &Config{
+			Providers: map[string]ProviderConfig{},
+			Models: map[string]ModelConfig{
+				"gpt-4": {
+					Strategy: StrategyFallback,
+					Providers: []ModelProvider{
+						{Provider: "openai", Model: "gpt-4"},
+					},
+				},
+			},
+		}
+
+		err := cfg.ValidateProviderReferences()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "openai")
+	})
+}
+
+func TestValidateProviderLimits(t *testing.T) {
+	pricing := map[string]ModelPrice{"*": {InputPerMillion: 1, OutputPerMillion: 2}}
+	tests := []struct {
+		name     string
+		provider ProviderConfig
+		wantErr  string
+	}{
+		{name: "not configured"},
+		{name: "pricing only", provider: ProviderConfig{Pricing: pricing}},
+		{name: "budget with pricing", provider: ProviderConfig{Pricing: pricing, Budget: &BudgetConfig{Daily: 5, Monthly: 100}}},
+		{name: "budget without pricing", provider: ProviderConfig{Budget: &BudgetConfig{Daily: 5}}, wantErr: "no pricing"},
+		{name: "negative budget", provider: ProviderConfig{Pricing: pricing, Budget: &BudgetConfig{Monthly: -1}}, wantErr: "budget must not be negative"},
+		{name: "negative price", provider: ProviderConfig{Pricing: map[string]ModelPrice{"gpt-4o": {InputPerMillion: -1}}}, wantErr: "pricing for \"gpt-4o\""},
+		{name: "negative max_concurrency", provider: ProviderConfig{MaxConcurrency: -2}, wantErr: "max_concurrency"},
+		{name: "negative max_context", provider: ProviderConfig{MaxContext: -1}, wantErr: "max_context"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Providers: map[string]ProviderConfig{"p": tt.provider}}
+			err := cfg.ValidateProviderLimits()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestValidateProviderHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		wantErr string
+	}{
+		{name: "not configured"},
+		{name: "valid", headers: map[string]string{"X-Org-Id": "org-1", "Authorization": "Gateway ${TOKEN}"}},
+		{name: "empty name", headers: map[string]string{"": "x"}, wantErr: `invalid header name ""`},
+		{name: "name with colon", headers: map[string]string{"X-Org-Id:": "x"}, wantErr: "invalid header name"},
+		{name: "value with line break", headers: map[string]string{"X-Org-Id": "a\r\nX-Evil: b"}, wantErr: "line breaks"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Providers: map[string]ProviderConfig{"p": {Headers: tt.headers}}}
+			err := cfg.ValidateProviderHeaders()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestValidateCredentialSources(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider ProviderConfig
+		wantErr  string
+	}{
+		{name: "not configured", provider: ProviderConfig{APIKey: "sk"}},
+		{name: "file", provider: ProviderConfig{APIKeySource: &CredentialSource{File: "/run/secrets/openai"}}},
+		{name: "command with refresh", provider: ProviderConfig{APIKeySource: &CredentialSource{Command: []string{"op", "read", "op://openai/key"}, RefreshSeconds: 300}}},
+		{name: "no source", provider: ProviderConfig{APIKeySource: &CredentialSource{}}, wantErr: "(0 set)"},
+		{name: "two sources", provider: ProviderConfig{APIKeySource: &CredentialSource{File: "/key", Vault: "secret/data/openai"}}, wantErr: "(2 set)"},
+		{name: "with api_key", provider: ProviderConfig{APIKey: "sk", APIKeySource: &CredentialSource{AWSSecret: "prod/openai"}}, wantErr: "both api_key and api_key_source"},
+		{name: "negative refresh", provider: ProviderConfig{APIKeySource: &CredentialSource{GCPSecret: "openai", RefreshSeconds: -1}}, wantErr: "refresh_seconds"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Providers: map[string]ProviderConfig{"p": tt.provider}}
+			err := cfg.ValidateCredentialSources()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestValidateApiModes(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider ProviderConfig
+		wantErr  string
+		plugins  map[string]PluginConfig
+	}{
+		{name: "passthrough"},
+		{name: "openai", provider: ProviderConfig{ApiMode: "openai"}},
+		{name: "anthropic type", provider: ProviderConfig{Type: "anthropic"}},
+		{name: "anthropic type and mode", provider: ProviderConfig{Type: "anthropic", ApiMode: "anthropic"}},
+		{name: "invalid mode", provider: ProviderConfig{ApiMode: "ollama"}, wantErr: `invalid api_mode: "ollama"`},
+		{name: "invalid type", provider: ProviderConfig{Type: "gemini"}, wantErr: `invalid type: "gemini"`},
+		{name: "anthropic type in openai mode", provider: ProviderConfig{Type: "anthropic", ApiMode: "openai"}, wantErr: `type "anthropic" cannot use api_mode "openai"`},
+		{name: "cohere type", provider: ProviderConfig{Type: "cohere", ApiMode: "openai"}},
+		{name: "mistral type", provider: ProviderConfig{Type: "mistral"}},
+		{name: "vllm type", provider: ProviderConfig{Type: "vllm", ApiMode: "openai"}},
+		{name: "tgi type", provider: ProviderConfig{Type: "tgi"}},
+		{name: "replay type in anthropic mode", provider: ProviderConfig{Type: "replay", ApiMode: "anthropic"}},
+		{name: "echo type", provider: ProviderConfig{Type: "echo"}},
+		{name: "echo type in anthropic mode", provider: ProviderConfig{Type: "echo", ApiMode: "anthropic"}, wantErr: `type "echo" cannot use api_mode "anthropic"`},
+		{name: "cohere type in anthropic mode", provider: ProviderConfig{Type: "cohere", ApiMode: "anthropic"}, wantErr: `type "cohere" cannot use api_mode "anthropic"`},
+		{name: "plugin type", provider: ProviderConfig{Type: "exotic", ApiMode: "openai"}},
+		{name: "plugin type in anthropic mode", provider: ProviderConfig{Type: "exotic", ApiMode: "anthropic"}, wantErr: `type "exotic" cannot use api_mode "anthropic"`},
+		{name: "plugin without command", plugins: map[string]PluginConfig{"bare": {}}, wantErr: `plugin "bare" has no command`},
+		{name: "plugin shadowing a type", plugins: map[string]PluginConfig{"mistral": {Command: []string{"x"}}}, wantErr: `plugin "mistral" shadows`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugins := tt.plugins
+			if plugins == nil {
+				plugins = map[string]PluginConfig{"exotic": {Command: []string{"./exotic-plugin"}}}
+			}
+			err := (&Config{Providers: map[string]ProviderConfig{"p": tt.provider}, Plugins: plugins}).ValidateApiModes()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestValidateReplay(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider ProviderConfig
+		wantErr  string
+	}{
+		{name: "not replay"},
+		{name: "replay", provider: ProviderConfig{Type: "replay", Replay: &ReplayConfig{Fixtures: "testdata/fixtures"}}},
+		{name: "recording", provider: ProviderConfig{Type: "replay", URL: "https://api.openai.com", Replay: &ReplayConfig{Fixtures: "fixtures", Record: true}}},
+		{name: "no fixtures", provider: ProviderConfig{Type: "replay"}, wantErr: "needs replay.fixtures"},
+		{name: "recording without url", provider: ProviderConfig{Type: "replay", Replay: &ReplayConfig{Fixtures: "fixtures", Record: true}}, wantErr: "no url to record from"},
+		{name: "replay on another type", provider: ProviderConfig{Type: "vllm", Replay: &ReplayConfig{Fixtures: "fixtures"}}, wantErr: "not of type 'replay'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&Config{Providers: map[string]ProviderConfig{"p": tt.provider}}).ValidateReplay()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestValidateEcho(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider ProviderConfig
+		wantErr  string
+	}{
+		{name: "echo without delays", provider: ProviderConfig{Type: "echo"}},
+		{name: "echo", provider: ProviderConfig{Type: "echo", Echo: &EchoConfig{DelayMs: 100, TokenDelayMs: 20}}},
+		{name: "negative delay", provider: ProviderConfig{Type: "echo", Echo: &EchoConfig{TokenDelayMs: -1}}, wantErr: "echo delays must not be negative"},
+		{name: "echo on another type", provider: ProviderConfig{Echo: &EchoConfig{}}, wantErr: "not of type 'echo'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&Config{Providers: map[string]ProviderConfig{"p": tt.provider}}).ValidateEcho()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
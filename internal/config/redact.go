@@ -0,0 +1,187 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/macedot/openmodel/internal/logger"
+)
+
+// redactedValue replaces secrets in the redacted config
+const redactedValue = "[redacted]"
+
+// secretNameSuffixes are the last words of setting, header and environment variable names
+// whose values are secrets, e.g. api_key, X-Api-Key, Authorization, OPENAI_API_KEY. Webhook
+// URLs often embed their credentials.
+var secretNameSuffixes = []string{"key", "apikey", "token", "secret", "password", "authorization", "cookie", "credentials", "webhook"}
+
+// Redacted returns the effective config as a JSON object, defaults included, with env
+// vars expanded and secrets redacted: API keys, tokens, secret headers and env values,
+// key_priorities keys and the passwords of URLs
+func (c *Config) Redacted() (map[string]any, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+	redactMap(raw)
+	return raw, nil
+}
+
+// redactMap redacts the secrets of a JSON object in place
+func redactMap(m map[string]any) {
+	for name, value := range m {
+		switch v := value.(type) {
+		case string:
+			m[name] = redactString(name, v)
+		case map[string]any:
+			if name == "key_priorities" {
+				m[name] = redactKeys(v)
+				continue
+			}
+			redactMap(v)
+		case []any:
+			for _, item := range v {
+				if obj, ok := item.(map[string]any); ok {
+					redactMap(obj)
+				}
+			}
+		}
+	}
+}
+
+// redactString redacts the value of a setting named name: all of it for secret names,
+// the password of URLs otherwise
+func redactString(name, value string) string {
+	value = expandEnvVars(value)
+	if value == "" {
+		return value
+	}
+	if isSecretName(name) {
+		return redactedValue
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return value
+}
+
+// redactKeys masks the API keys of a key_priorities map, keeping their last 4 characters
+// so they can be told apart
+func redactKeys(m map[string]any) map[string]any {
+	masked := make(map[string]any, len(m))
+	for key, value := range m {
+		key = expandEnvVars(key)
+		if len(key) > 8 {
+			key = "..." + key[len(key)-4:]
+		} else {
+			key = redactedValue
+		}
+		masked[key] = value
+	}
+	return masked
+}
+
+// isSecretName reports whether the last word of a setting, header or environment variable
+// name names a secret
+func isSecretName(name string) bool {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return r == '_' || r == '-' || r == '.'
+	})
+	if len(words) == 0 {
+		return false
+	}
+	for _, suffix := range secretNameSuffixes {
+		if words[len(words)-1] == suffix {
+			return true
+		}
+	}
+	return false
+}
+
+// Secrets returns the secret values of the config, with environment variables expanded:
+// API keys, tokens and passwords, the values of credential headers, and the passwords and
+// credential query parameters of URLs. They are masked in logs and errors.
+func (c *Config) Secrets() []string {
+	var secrets []string
+	add := func(values ...string) {
+		for _, v := range values {
+			if v != "" {
+				secrets = append(secrets, v)
+			}
+		}
+	}
+	addHeaders := func(headers map[string]string) {
+		for name, value := range headers {
+			if logger.IsSensitiveHeader(name) {
+				add(expandEnvVars(value))
+			}
+		}
+	}
+
+	for _, pc := range c.Providers {
+		add(pc.APIKey)
+		add(urlSecrets(pc.URL)...)
+		add(urlSecrets(pc.Proxy)...)
+		addHeaders(pc.Headers)
+	}
+	add(urlSecrets(c.HTTP.Proxy)...)
+	for _, plugin := range c.Plugins {
+		addHeaders(plugin.Env)
+	}
+	for _, k := range c.APIKeys {
+		add(k.GetKey())
+	}
+	if c.Admin != nil {
+		add(c.Admin.GetToken())
+	}
+	if c.Metrics != nil {
+		add(c.Metrics.GetToken())
+	}
+	if c.Tracing != nil {
+		addHeaders(c.Tracing.Headers)
+	}
+	if c.LLMExport != nil {
+		add(c.LLMExport.GetSecretKey(), c.LLMExport.GetAPIKey())
+	}
+	if c.EventSink != nil {
+		add(c.EventSink.GetToken(), c.EventSink.GetPassword())
+		add(urlSecrets(c.EventSink.GetURL())...)
+	}
+	if c.State != nil {
+		add(urlSecrets(c.State.GetRedisURL())...)
+	}
+	// Slack and Discord webhook URLs are credentials themselves
+	for _, a := range c.CostAlerts {
+		add(a.GetWebhook())
+	}
+	for _, n := range c.Notifications {
+		add(n.GetWebhook())
+	}
+	return secrets
+}
+
+// urlSecrets returns the password and the credential query parameters (such as ?key=) of
+// a URL
+func urlSecrets(raw string) []string {
+	u, err := url.Parse(raw)
+	if err != nil || raw == "" {
+		return nil
+	}
+	var secrets []string
+	if password, ok := u.User.Password(); ok {
+		secrets = append(secrets, password)
+	}
+	for name, values := range u.Query() {
+		if logger.IsSensitiveHeader(name) {
+			secrets = append(secrets, values...)
+		}
+	}
+	return secrets
+}
@@ -0,0 +1,383 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Schemes of config sources fetched over the network rather than read from disk
+const (
+	remoteSchemeHTTP  = "http://"
+	remoteSchemeHTTPS = "https://"
+	remoteSchemeS3    = "s3://"
+	remoteSchemeGCS   = "gs://"
+)
+
+// Remote config fetching defaults
+const (
+	remoteFetchTimeout       = 30 * time.Second
+	remoteMaxConfigSize      = 10 << 20 // 10MB
+	defaultConfigRefresh     = time.Minute
+	defaultS3Region          = "us-east-1"
+	gcsEndpoint              = "https://storage.googleapis.com"
+	emptyPayloadSHA256       = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	awsSigningAlgorithm      = "AWS4-HMAC-SHA256"
+	awsAmzDateFormat         = "20060102T150405Z"
+	awsCredentialScopeFormat = "20060102"
+)
+
+// remoteHTTPClient fetches remote configs
+var remoteHTTPClient = &http.Client{Timeout: remoteFetchTimeout}
+
+// IsRemote reports whether a config path is a URL (http://, https://, s3:// or gs://)
+// to fetch the config from
+func IsRemote(path string) bool {
+	for _, scheme := range []string{remoteSchemeHTTP, remoteSchemeHTTPS, remoteSchemeS3, remoteSchemeGCS} {
+		if strings.HasPrefix(path, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteConfig is the content of a remote config and the ETag it was served with
+type remoteConfig struct {
+	data []byte
+	etag string
+}
+
+// readConfigSource reads the config at path, fetching it when it is a URL
+func readConfigSource(path string) ([]byte, error) {
+	if !IsRemote(path) {
+		return readConfigFile(path)
+	}
+	remote, _, err := fetchRemoteConfig(context.Background(), path, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRemoteConfig(path, remote.data); err != nil {
+		return nil, err
+	}
+	return remote.data, nil
+}
+
+// parseRemoteConfig parses the content of the remote config at path
+func parseRemoteConfig(path string, data []byte) (*Config, error) {
+	if err := checkRemoteConfig(path, data); err != nil {
+		return nil, err
+	}
+	cfg, err := parseConfig(data, true)
+	if err != nil {
+		return nil, err
+	}
+	cfg.configPath = path
+	return cfg, nil
+}
+
+// checkRemoteConfig rejects includes in a remote config: it is read as it is
+func checkRemoteConfig(path string, data []byte) error {
+	var raw map[string]any
+	if json.Unmarshal(data, &raw) == nil {
+		if _, ok := raw["include"]; ok {
+			return fmt.Errorf("%s: remote configs may not include others", path)
+		}
+	}
+	return nil
+}
+
+// fetchRemoteConfig fetches the config at rawURL. Given the ETag of the content last
+// fetched, it reports unchanged content (304 Not Modified) with modified false.
+func fetchRemoteConfig(ctx context.Context, rawURL, etag string) (remoteConfig, bool, error) {
+	req, err := newRemoteConfigRequest(ctx, rawURL, time.Now())
+	if err != nil {
+		return remoteConfig{}, false, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := remoteHTTPClient.Do(req)
+	if err != nil {
+		return remoteConfig{}, false, fmt.Errorf("failed to fetch config: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && etag != "":
+		return remoteConfig{etag: etag}, false, nil
+	case resp.StatusCode != http.StatusOK:
+		return remoteConfig{}, false, fmt.Errorf("failed to fetch config %s: status %d", rawURL, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, remoteMaxConfigSize+1))
+	if err != nil {
+		return remoteConfig{}, false, fmt.Errorf("failed to fetch config: %w", err)
+	}
+	if len(data) > remoteMaxConfigSize {
+		return remoteConfig{}, false, fmt.Errorf("config %s is larger than %d bytes", rawURL, remoteMaxConfigSize)
+	}
+	return remoteConfig{data: data, etag: resp.Header.Get("ETag")}, true, nil
+}
+
+// newRemoteConfigRequest builds the GET request of a remote config:
+//   - http(s):// URLs are fetched as they are, with OPENMODEL_CONFIG_TOKEN as a bearer
+//     token when it is set
+//   - s3://bucket/key is fetched from S3 (or AWS_ENDPOINT_URL_S3 / AWS_ENDPOINT_URL),
+//     signed with the AWS default credentials (see lookupAWSCredentials) when there are any
+//   - gs://bucket/object is fetched from Cloud Storage, with a token of the Google default
+//     credentials (see lookupGCSToken) when there are any
+func newRemoteConfigRequest(ctx context.Context, rawURL string, now time.Time) (*http.Request, error) {
+	switch {
+	case strings.HasPrefix(rawURL, remoteSchemeS3):
+		return newS3Request(ctx, strings.TrimPrefix(rawURL, remoteSchemeS3), now)
+	case strings.HasPrefix(rawURL, remoteSchemeGCS):
+		bucket, object, ok := strings.Cut(strings.TrimPrefix(rawURL, remoteSchemeGCS), "/")
+		if !ok || bucket == "" || object == "" {
+			return nil, fmt.Errorf("invalid config URL %q: expected gs://bucket/object", rawURL)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, gcsEndpoint+"/"+bucket+"/"+escapeObjectKey(object), nil)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config URL %q: %w", rawURL, err)
+		}
+		token, ok, err := lookupGCSToken(ctx, now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get credentials for %s: %w", rawURL, err)
+		}
+		if ok {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return req, nil
+	default:
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config URL %q: %w", rawURL, err)
+		}
+		if token := os.Getenv("OPENMODEL_CONFIG_TOKEN"); token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return req, nil
+	}
+}
+
+// newS3Request builds the GET request of an S3 object, given as bucket/key. A custom
+// endpoint (e.g. MinIO) is addressed path-style, AWS itself virtual-hosted-style.
+func newS3Request(ctx context.Context, location string, now time.Time) (*http.Request, error) {
+	bucket, key, ok := strings.Cut(location, "/")
+	if !ok || bucket == "" || key == "" {
+		return nil, fmt.Errorf("invalid config URL %q: expected s3://bucket/key", remoteSchemeS3+location)
+	}
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = defaultS3Region
+	}
+
+	objectURL := "https://" + bucket + ".s3." + region + ".amazonaws.com/" + escapeObjectKey(key)
+	endpoint := os.Getenv("AWS_ENDPOINT_URL_S3")
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	if endpoint != "" {
+		objectURL = strings.TrimSuffix(endpoint, "/") + "/" + bucket + "/" + escapeObjectKey(key)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, objectURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config URL %q: %w", remoteSchemeS3+location, err)
+	}
+
+	creds, ok, err := lookupAWSCredentials(ctx, region, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credentials for %s: %w", remoteSchemeS3+location, err)
+	}
+	if ok {
+		signS3Request(req, creds.accessKey, creds.secretKey, creds.sessionToken, region, now)
+	}
+	return req, nil
+}
+
+// signS3Request signs a body-less S3 request with AWS Signature Version 4
+func signS3Request(req *http.Request, accessKey, secretKey, sessionToken, region string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format(awsAmzDateFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadSHA256)
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + emptyPayloadSHA256 + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	if sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+		signedHeaders += ";x-amz-security-token"
+		canonicalHeaders += "x-amz-security-token:" + sessionToken + "\n"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		emptyPayloadSHA256,
+	}, "\n")
+	scope := now.Format(awsCredentialScopeFormat) + "/" + region + "/s3/aws4_request"
+	stringToSign := awsSigningAlgorithm + "\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{now.Format(awsCredentialScopeFormat), region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		awsSigningAlgorithm, accessKey, scope, signedHeaders, signature))
+}
+
+// escapeObjectKey escapes an object key for a URL path the way AWS canonical URIs expect:
+// every byte but unreserved characters and "/" is percent-encoded
+func escapeObjectKey(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if c == '/' || c == '-' || c == '_' || c == '.' || c == '~' ||
+			('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// RemoteWatcher polls a remote config for changes, the counterpart of Watcher for
+// configs loaded from a URL. Unchanged content is detected with its ETag, or by
+// comparing it when the server sends none.
+type RemoteWatcher struct {
+	url      string
+	callback func(*Config, error)
+	interval time.Duration
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	running  atomic.Bool
+	// last is the config last handled
+	last remoteConfig
+}
+
+// NewRemoteWatcher creates a watcher of the config at rawURL, polled every interval
+// The callback receives the new config and any validation error
+func NewRemoteWatcher(rawURL string, interval time.Duration, callback func(*Config, error)) *RemoteWatcher {
+	return &RemoteWatcher{
+		url:      rawURL,
+		callback: callback,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start fetches the config once to know its current content, then polls it
+func (w *RemoteWatcher) Start() error {
+	if !w.running.CompareAndSwap(false, true) {
+		return nil
+	}
+	last, _, err := fetchRemoteConfig(context.Background(), w.url, "")
+	if err != nil {
+		w.running.Store(false)
+		return err
+	}
+	w.last = last
+
+	go w.pollLoop()
+	return nil
+}
+
+// pollLoop fetches the config every interval
+func (w *RemoteWatcher) pollLoop() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stopCh:
+			return
+		case <-ticker.C:
+			w.poll()
+		}
+	}
+}
+
+// poll fetches the config and, when it changed, loads and validates it and calls the
+// callback
+func (w *RemoteWatcher) poll() {
+	ctx, cancel := context.WithTimeout(context.Background(), remoteFetchTimeout)
+	defer cancel()
+	current, modified, err := fetchRemoteConfig(ctx, w.url, w.last.etag)
+	if err != nil {
+		w.callback(nil, err)
+		return
+	}
+	if !modified || bytes.Equal(current.data, w.last.data) {
+		return
+	}
+	w.last = current
+
+	cfg, err := parseRemoteConfig(w.url, current.data)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		w.callback(nil, err)
+		return
+	}
+	w.callback(cfg, nil)
+}
+
+// Stop stops the watcher
+func (w *RemoteWatcher) Stop() {
+	if !w.running.Load() {
+		return
+	}
+	w.stopOnce.Do(func() {
+		close(w.stopCh)
+	})
+	w.running.Store(false)
+}
+
+// IsRunning returns whether the watcher is currently running
+func (w *RemoteWatcher) IsRunning() bool {
+	return w.running.Load()
+}
+
+// GetConfigRefresh returns how often a config loaded from a URL is polled for changes,
+// 0 when it is not
+func (c *Config) GetConfigRefresh() time.Duration {
+	switch {
+	case c.ConfigRefreshMs < 0:
+		return 0
+	case c.ConfigRefreshMs == 0:
+		return defaultConfigRefresh
+	default:
+		return time.Duration(c.ConfigRefreshMs) * time.Millisecond
+	}
+}
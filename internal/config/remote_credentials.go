@@ -0,0 +1,568 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"bufio"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Credential sources of remote config fetches, found the way the AWS and Google SDKs find
+// their default credentials
+const (
+	awsContainerEndpoint   = "http://169.254.170.2"
+	awsIMDSEndpoint        = "http://169.254.169.254"
+	awsIMDSTokenTTL        = "21600"
+	awsSTSVersion          = "2011-06-15"
+	awsRoleSessionName     = "openmodel"
+	gceMetadataHost        = "169.254.169.254"
+	gcsReadScope           = "https://www.googleapis.com/auth/devstorage.read_only"
+	googleTokenURL         = "https://oauth2.googleapis.com/token"
+	googleJWTBearerGrant   = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+	googleTokenLifetime    = time.Hour
+	metadataProbeTimeout   = time.Second
+	credentialRefreshEarly = 5 * time.Minute // Credentials are renewed this long before they expire
+)
+
+// awsCredentials are the keys S3 requests are signed with
+type awsCredentials struct {
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	expires      time.Time // Zero when they do not expire
+}
+
+// valid reports whether the credentials are set and not about to expire
+func (c awsCredentials) valid(now time.Time) bool {
+	return c.accessKey != "" && (c.expires.IsZero() || now.Before(c.expires.Add(-credentialRefreshEarly)))
+}
+
+// credentialCache keeps the credentials fetched from metadata services and token
+// endpoints until shortly before they expire, and remembers metadata services found
+// unreachable so that hosts outside the cloud do not probe them on every fetch
+type credentialCache struct {
+	mu            sync.Mutex
+	aws           awsCredentials
+	gcsToken      string
+	gcsExpires    time.Time
+	noIMDS        bool
+	noGCEMetadata bool
+}
+
+// remoteCredentials are the credentials of remote config fetches
+var remoteCredentials = &credentialCache{}
+
+// credentialsHTTPClient calls metadata services and token endpoints
+var credentialsHTTPClient = &http.Client{Timeout: remoteFetchTimeout}
+
+// lookupAWSCredentials returns the credentials S3 requests are signed with, from the
+// first source that has them:
+//   - AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+//   - the AWS_PROFILE (default "default") profile of the shared credentials file,
+//     AWS_SHARED_CREDENTIALS_FILE or ~/.aws/credentials
+//   - a web identity token, AWS_WEB_IDENTITY_TOKEN_FILE, exchanged for AWS_ROLE_ARN with
+//     STS (EKS IAM roles for service accounts)
+//   - the container credentials endpoint (ECS, EKS Pod Identity)
+//   - the instance profile, from the EC2 instance metadata service (IMDSv2) unless
+//     AWS_EC2_METADATA_DISABLED is true
+//
+// ok is false when there are none and the request goes unsigned. A source that is set up
+// but fails is an error, so a refresh fails visibly rather than falling back to anonymous
+// access.
+func lookupAWSCredentials(ctx context.Context, region string, now time.Time) (awsCredentials, bool, error) {
+	if accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); accessKey != "" && secretKey != "" {
+		return awsCredentials{accessKey: accessKey, secretKey: secretKey, sessionToken: os.Getenv("AWS_SESSION_TOKEN")}, true, nil
+	}
+	if creds, ok, err := readSharedAWSCredentials(); ok || err != nil {
+		return creds, ok, err
+	}
+
+	cache := remoteCredentials
+	cache.mu.Lock()
+	cached, noIMDS := cache.aws, cache.noIMDS
+	cache.mu.Unlock()
+	if cached.valid(now) {
+		return cached, true, nil
+	}
+
+	var (
+		creds awsCredentials
+		err   error
+	)
+	switch {
+	case os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE") != "" && os.Getenv("AWS_ROLE_ARN") != "":
+		creds, err = assumeRoleWithWebIdentity(ctx, region)
+	case os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI") != "" || os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI") != "":
+		creds, err = fetchContainerCredentials(ctx)
+	case noIMDS || strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true"):
+		return awsCredentials{}, false, nil
+	default:
+		var found bool
+		creds, found, err = fetchInstanceProfileCredentials(ctx)
+		if err == nil && !found {
+			return awsCredentials{}, false, nil
+		}
+	}
+	if err != nil {
+		return awsCredentials{}, false, err
+	}
+	cache.mu.Lock()
+	cache.aws = creds
+	cache.mu.Unlock()
+	return creds, true, nil
+}
+
+// readSharedAWSCredentials reads the keys of the AWS_PROFILE profile from the shared
+// credentials file. A missing file or profile is not an error.
+func readSharedAWSCredentials() (awsCredentials, bool, error) {
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return awsCredentials{}, false, nil
+		}
+		path = filepath.Join(home, ".aws", "credentials")
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return awsCredentials{}, false, nil
+	}
+	if err != nil {
+		return awsCredentials{}, false, fmt.Errorf("failed to read aws credentials: %w", err)
+	}
+	defer f.Close()
+
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+	var (
+		creds   awsCredentials
+		section string
+	)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if !ok || section != profile {
+			continue
+		}
+		switch strings.TrimSpace(name) {
+		case "aws_access_key_id":
+			creds.accessKey = strings.TrimSpace(value)
+		case "aws_secret_access_key":
+			creds.secretKey = strings.TrimSpace(value)
+		case "aws_session_token":
+			creds.sessionToken = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return awsCredentials{}, false, fmt.Errorf("failed to read aws credentials: %w", err)
+	}
+	return creds, creds.accessKey != "" && creds.secretKey != "", nil
+}
+
+// assumeRoleWithWebIdentity exchanges the web identity token for credentials of
+// AWS_ROLE_ARN with STS, AWS_ENDPOINT_URL_STS or the regional endpoint
+func assumeRoleWithWebIdentity(ctx context.Context, region string) (awsCredentials, error) {
+	token, err := os.ReadFile(os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"))
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to read web identity token: %w", err)
+	}
+	endpoint := os.Getenv("AWS_ENDPOINT_URL_STS")
+	if endpoint == "" {
+		endpoint = "https://sts." + region + ".amazonaws.com"
+	}
+	sessionName := os.Getenv("AWS_ROLE_SESSION_NAME")
+	if sessionName == "" {
+		sessionName = awsRoleSessionName
+	}
+	form := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {awsSTSVersion},
+		"RoleArn":          {os.Getenv("AWS_ROLE_ARN")},
+		"RoleSessionName":  {sessionName},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/", strings.NewReader(form.Encode()))
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("invalid sts endpoint: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	body, err := doCredentialsRequest(credentialsHTTPClient, req, "sts")
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	var resp struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.Unmarshal(body, &resp); err != nil || resp.Credentials.AccessKeyID == "" {
+		return awsCredentials{}, fmt.Errorf("invalid sts response: %v", err)
+	}
+	c := resp.Credentials
+	return awsCredentials{accessKey: c.AccessKeyID, secretKey: c.SecretAccessKey, sessionToken: c.SessionToken, expires: c.Expiration}, nil
+}
+
+// metadataCredentials are the credentials served by the container and instance metadata
+// endpoints
+type metadataCredentials struct {
+	AccessKeyID     string    `json:"AccessKeyId"`
+	SecretAccessKey string    `json:"SecretAccessKey"`
+	Token           string    `json:"Token"`
+	Expiration      time.Time `json:"Expiration"`
+}
+
+// parseMetadataCredentials reads the credentials of a metadata endpoint
+func parseMetadataCredentials(body []byte, source string) (awsCredentials, error) {
+	var c metadataCredentials
+	if err := json.Unmarshal(body, &c); err != nil || c.AccessKeyID == "" {
+		return awsCredentials{}, fmt.Errorf("invalid %s credentials: %v", source, err)
+	}
+	return awsCredentials{accessKey: c.AccessKeyID, secretKey: c.SecretAccessKey, sessionToken: c.Token, expires: c.Expiration}, nil
+}
+
+// fetchContainerCredentials reads the credentials of the container credentials endpoint
+func fetchContainerCredentials(ctx context.Context) (awsCredentials, error) {
+	endpoint := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if relative := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); relative != "" {
+		endpoint = awsContainerEndpoint + relative
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("invalid container credentials endpoint: %w", err)
+	}
+	token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	if path := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return awsCredentials{}, fmt.Errorf("failed to read container authorization token: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	body, err := doCredentialsRequest(credentialsHTTPClient, req, "container credentials")
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	return parseMetadataCredentials(body, "container")
+}
+
+// fetchInstanceProfileCredentials reads the credentials of the instance profile from
+// IMDSv2, AWS_EC2_METADATA_SERVICE_ENDPOINT or the link-local address. found is false
+// when the service is unreachable or refuses a session token, which is remembered, or
+// the instance has no profile.
+func fetchInstanceProfileCredentials(ctx context.Context) (awsCredentials, bool, error) {
+	endpoint := strings.TrimSuffix(os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT"), "/")
+	if endpoint == "" {
+		endpoint = awsIMDSEndpoint
+	}
+	probeCtx, cancel := context.WithTimeout(ctx, metadataProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(probeCtx, http.MethodPut, endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return awsCredentials{}, false, fmt.Errorf("invalid instance metadata endpoint: %w", err)
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", awsIMDSTokenTTL)
+	resp, err := credentialsHTTPClient.Do(req)
+	if err != nil || (resp.StatusCode >= 400 && resp.StatusCode < 500) {
+		// Another cloud's metadata server, or none, answers on the link-local address
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if ctx.Err() == nil {
+			remoteCredentials.mu.Lock()
+			remoteCredentials.noIMDS = true
+			remoteCredentials.mu.Unlock()
+		}
+		return awsCredentials{}, false, nil
+	}
+	token, err := readCredentialsResponse(resp, "instance metadata")
+	if err != nil {
+		return awsCredentials{}, false, err
+	}
+
+	get := func(path string) ([]byte, int, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+path, nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		req.Header.Set("X-aws-ec2-metadata-token", string(token))
+		resp, err := credentialsHTTPClient.Do(req)
+		if err != nil {
+			return nil, 0, fmt.Errorf("instance metadata request failed: %w", err)
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			return nil, resp.StatusCode, nil
+		}
+		body, err := readCredentialsResponse(resp, "instance metadata")
+		return body, resp.StatusCode, err
+	}
+	const credentialsPath = "/latest/meta-data/iam/security-credentials/"
+	roles, status, err := get(credentialsPath)
+	if err != nil {
+		return awsCredentials{}, false, err
+	}
+	role, _, _ := strings.Cut(strings.TrimSpace(string(roles)), "\n")
+	if status == http.StatusNotFound || role == "" {
+		return awsCredentials{}, false, nil
+	}
+	body, _, err := get(credentialsPath + url.PathEscape(role))
+	if err != nil {
+		return awsCredentials{}, false, err
+	}
+	creds, err := parseMetadataCredentials(body, "instance profile")
+	return creds, err == nil, err
+}
+
+// lookupGCSToken returns the OAuth access token Cloud Storage requests carry, from the
+// first source that has one:
+//   - GOOGLE_OAUTH_ACCESS_TOKEN
+//   - the application default credentials of GOOGLE_APPLICATION_CREDENTIALS or
+//     ~/.config/gcloud/application_default_credentials.json: a service account key or
+//     the refresh token of `gcloud auth application-default login`
+//   - the service account of the instance, from the metadata server (GCE, GKE, Cloud
+//     Run), GCE_METADATA_HOST or the link-local address
+//
+// ok is false when there is none and the request is sent without a token. A source that
+// is set up but fails is an error.
+func lookupGCSToken(ctx context.Context, now time.Time) (string, bool, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, true, nil
+	}
+	cache := remoteCredentials
+	cache.mu.Lock()
+	token, expires, noMetadata := cache.gcsToken, cache.gcsExpires, cache.noGCEMetadata
+	cache.mu.Unlock()
+	if token != "" && now.Before(expires.Add(-credentialRefreshEarly)) {
+		return token, true, nil
+	}
+
+	var (
+		lifetime time.Duration
+		err      error
+	)
+	path, explicit := os.LookupEnv("GOOGLE_APPLICATION_CREDENTIALS")
+	if !explicit {
+		if home, homeErr := os.UserHomeDir(); homeErr == nil {
+			path = filepath.Join(home, ".config", "gcloud", "application_default_credentials.json")
+		}
+	}
+	data, readErr := os.ReadFile(path)
+	switch {
+	case readErr == nil:
+		token, lifetime, err = exchangeGoogleCredentials(ctx, data, now)
+	case explicit && path != "":
+		return "", false, fmt.Errorf("failed to read google credentials: %w", readErr)
+	case noMetadata:
+		return "", false, nil
+	default:
+		var found bool
+		token, lifetime, found, err = fetchGCEMetadataToken(ctx)
+		if err == nil && !found {
+			return "", false, nil
+		}
+	}
+	if err != nil {
+		return "", false, err
+	}
+	cache.mu.Lock()
+	cache.gcsToken, cache.gcsExpires = token, now.Add(lifetime)
+	cache.mu.Unlock()
+	return token, true, nil
+}
+
+// googleCredentials is an application default credentials file
+type googleCredentials struct {
+	Type         string `json:"type"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyID string `json:"private_key_id"`
+	TokenURI     string `json:"token_uri"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// exchangeGoogleCredentials obtains an access token for application default credentials:
+// a JWT signed with a service account key, or a refresh token of an authorized user
+func exchangeGoogleCredentials(ctx context.Context, data []byte, now time.Time) (string, time.Duration, error) {
+	var creds googleCredentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return "", 0, fmt.Errorf("invalid google credentials: %w", err)
+	}
+	tokenURL := creds.TokenURI
+	if tokenURL == "" {
+		tokenURL = googleTokenURL
+	}
+	var form url.Values
+	switch creds.Type {
+	case "service_account":
+		assertion, err := signGoogleJWT(creds, tokenURL, now)
+		if err != nil {
+			return "", 0, err
+		}
+		form = url.Values{"grant_type": {googleJWTBearerGrant}, "assertion": {assertion}}
+	case "authorized_user":
+		form = url.Values{
+			"grant_type":    {"refresh_token"},
+			"client_id":     {creds.ClientID},
+			"client_secret": {creds.ClientSecret},
+			"refresh_token": {creds.RefreshToken},
+		}
+	default:
+		return "", 0, fmt.Errorf("unsupported google credentials type %q (use a service account key or GOOGLE_OAUTH_ACCESS_TOKEN)", creds.Type)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid google token_uri: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	body, err := doCredentialsRequest(credentialsHTTPClient, req, "google token")
+	if err != nil {
+		return "", 0, err
+	}
+	return parseGoogleToken(body)
+}
+
+// signGoogleJWT signs the JWT a service account exchanges for a read-only Cloud Storage
+// token
+func signGoogleJWT(creds googleCredentials, audience string, now time.Time) (string, error) {
+	block, _ := pem.Decode([]byte(creds.PrivateKey))
+	if block == nil {
+		return "", fmt.Errorf("invalid google credentials: no PEM private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return "", fmt.Errorf("invalid google credentials private key: %w", err)
+		}
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("invalid google credentials: private key is not RSA")
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": creds.PrivateKeyID})
+	claims, _ := json.Marshal(map[string]any{
+		"iss":   creds.ClientEmail,
+		"scope": gcsReadScope,
+		"aud":   audience,
+		"iat":   now.Unix(),
+		"exp":   now.Add(googleTokenLifetime).Unix(),
+	})
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign google credentials assertion: %w", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// fetchGCEMetadataToken reads the token of the instance's service account from the
+// metadata server. found is false when the server is unreachable or is not Google's,
+// which is remembered, or the instance has no service account.
+func fetchGCEMetadataToken(ctx context.Context) (string, time.Duration, bool, error) {
+	host := os.Getenv("GCE_METADATA_HOST")
+	if host == "" {
+		host = gceMetadataHost
+	}
+	probeCtx, cancel := context.WithTimeout(ctx, metadataProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(probeCtx, http.MethodGet, "http://"+host+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return "", 0, false, fmt.Errorf("invalid metadata host: %w", err)
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := credentialsHTTPClient.Do(req)
+	if err != nil || resp.Header.Get("Metadata-Flavor") != "Google" {
+		// Another cloud's metadata server, or none, answers on the link-local address
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if ctx.Err() == nil {
+			remoteCredentials.mu.Lock()
+			remoteCredentials.noGCEMetadata = true
+			remoteCredentials.mu.Unlock()
+		}
+		return "", 0, false, nil
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return "", 0, false, nil
+	}
+	body, err := readCredentialsResponse(resp, "metadata server token")
+	if err != nil {
+		return "", 0, false, err
+	}
+	token, lifetime, err := parseGoogleToken(body)
+	return token, lifetime, err == nil, err
+}
+
+// parseGoogleToken reads an OAuth token response
+func parseGoogleToken(body []byte) (string, time.Duration, error) {
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil || resp.AccessToken == "" {
+		return "", 0, fmt.Errorf("invalid google token response: %v", err)
+	}
+	return resp.AccessToken, time.Duration(resp.ExpiresIn) * time.Second, nil
+}
+
+// doCredentialsRequest sends a request to a credentials endpoint and returns the body of
+// its 200 response
+func doCredentialsRequest(client *http.Client, req *http.Request, source string) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s request failed: %w", source, err)
+	}
+	return readCredentialsResponse(resp, source)
+}
+
+// readCredentialsResponse returns the body of a 200 response of a credentials endpoint
+func readCredentialsResponse(resp *http.Response, source string) ([]byte, error) {
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("%s request failed: %w", source, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s request failed: status %d", source, resp.StatusCode)
+	}
+	return body, nil
+}
@@ -0,0 +1,94 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RetryConfig holds the retry policy for requests to a single provider
+type RetryConfig struct {
+	MaxAttempts  int     `json:"max_attempts"`   // Total attempts per provider, including the first (default 1: no retry)
+	BackoffMs    int     `json:"backoff_ms"`     // Delay before the first retry, doubled on each subsequent retry (default 200)
+	MaxBackoffMs int     `json:"max_backoff_ms"` // Upper bound for the backoff delay (default 5000)
+	Jitter       float64 `json:"jitter"`         // Random fraction (0-1) of the delay added or removed (default 0)
+	RetryOn      []int   `json:"retry_on"`       // HTTP statuses to retry (default 429, 502, 503, 504); timeouts are always retried
+}
+
+// defaultRetryOn lists the statuses retried when retry_on is not configured
+var defaultRetryOn = []int{429, 502, 503, 504}
+
+// GetRetryPolicy returns the model retry policy with defaults applied
+func (m ModelConfig) GetRetryPolicy() RetryConfig {
+	policy := RetryConfig{MaxAttempts: 1, BackoffMs: 200, MaxBackoffMs: 5000, RetryOn: defaultRetryOn}
+	if m.Retry == nil {
+		return policy
+	}
+	if m.Retry.MaxAttempts > 0 {
+		policy.MaxAttempts = m.Retry.MaxAttempts
+	}
+	if m.Retry.BackoffMs > 0 {
+		policy.BackoffMs = m.Retry.BackoffMs
+	}
+	if m.Retry.MaxBackoffMs > 0 {
+		policy.MaxBackoffMs = m.Retry.MaxBackoffMs
+	}
+	if len(m.Retry.RetryOn) > 0 {
+		policy.RetryOn = m.Retry.RetryOn
+	}
+	policy.Jitter = m.Retry.Jitter
+	return policy
+}
+
+// Backoff returns the delay before retry number n (1-based), without jitter
+func (r RetryConfig) Backoff(n int) time.Duration {
+	delay := time.Duration(r.BackoffMs) * time.Millisecond
+	limit := time.Duration(r.MaxBackoffMs) * time.Millisecond
+	for i := 1; i < n && delay < limit; i++ {
+		delay *= 2
+	}
+	return min(delay, limit)
+}
+
+// RetriesStatus reports whether status is in the retry_on list
+func (r RetryConfig) RetriesStatus(status int) bool {
+	for _, code := range r.RetryOn {
+		if code == status {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateRetryPolicies checks that model retry settings are within range
+func (c *Config) ValidateRetryPolicies() error {
+	var errs []string
+
+	for modelName, modelConfig := range c.Models {
+		r := modelConfig.Retry
+		if r == nil {
+			continue
+		}
+		if r.MaxAttempts < 0 || r.BackoffMs < 0 || r.MaxBackoffMs < 0 {
+			errs = append(errs, fmt.Sprintf(
+				"  model %q retry values must not be negative", modelName))
+		}
+		if r.Jitter < 0 || r.Jitter > 1 {
+			errs = append(errs, fmt.Sprintf(
+				"  model %q retry jitter %v must be between 0 and 1", modelName, r.Jitter))
+		}
+		for _, code := range r.RetryOn {
+			if code < 400 || code > 599 {
+				errs = append(errs, fmt.Sprintf(
+					"  model %q retry_on has invalid status %d (must be 400-599)", modelName, code))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("retry validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
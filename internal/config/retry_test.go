@@ -0,0 +1,50 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetRetryPolicy(t *testing.T) {
+	policy := ModelConfig{}.GetRetryPolicy()
+	assert.Equal(t, 1, policy.MaxAttempts)
+	assert.True(t, policy.RetriesStatus(429))
+	assert.False(t, policy.RetriesStatus(400))
+
+	policy = ModelConfig{Retry: &RetryConfig{MaxAttempts: 4, BackoffMs: 100, MaxBackoffMs: 300, RetryOn: []int{500}}}.GetRetryPolicy()
+	assert.Equal(t, 4, policy.MaxAttempts)
+	assert.True(t, policy.RetriesStatus(500))
+	assert.False(t, policy.RetriesStatus(429))
+	assert.Equal(t, 100*time.Millisecond, policy.Backoff(1))
+	assert.Equal(t, 200*time.Millisecond, policy.Backoff(2))
+	assert.Equal(t, 300*time.Millisecond, policy.Backoff(3), "capped at max_backoff_ms")
+}
+
+func TestValidateRetryPolicies(t *testing.T) {
+	tests := []struct {
+		name    string
+		retry   *RetryConfig
+		wantErr string
+	}{
+		{name: "not configured"},
+		{name: "valid", retry: &RetryConfig{MaxAttempts: 3, BackoffMs: 100, Jitter: 0.2, RetryOn: []int{429, 503}}},
+		{name: "negative attempts", retry: &RetryConfig{MaxAttempts: -1}, wantErr: "must not be negative"},
+		{name: "jitter out of range", retry: &RetryConfig{Jitter: 1.5}, wantErr: "jitter"},
+		{name: "invalid status", retry: &RetryConfig{RetryOn: []int{200}}, wantErr: "invalid status 200"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Models: map[string]ModelConfig{"m": {Retry: tt.retry}}}
+			err := cfg.ValidateRetryPolicies()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,71 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RoutingRule sends chat requests that match all of its conditions to the backend chain
+// of another configured model. Rules are checked in order; the first match wins.
+type RoutingRule struct {
+	Name  string    `json:"name,omitempty"` // Label used in logs
+	Match RuleMatch `json:"match"`
+	Model string    `json:"model"` // Model whose backend chain serves matching requests
+}
+
+// RuleMatch holds the conditions of a routing rule. Unset conditions always hold.
+type RuleMatch struct {
+	Models         []string          `json:"models,omitempty"`           // Requested model names, "*" patterns allowed
+	MinMessages    int               `json:"min_messages,omitempty"`     // At least this many messages
+	MaxMessages    int               `json:"max_messages,omitempty"`     // At most this many messages
+	MinPromptChars int               `json:"min_prompt_chars,omitempty"` // At least this many characters of prompt text
+	MaxPromptChars int               `json:"max_prompt_chars,omitempty"` // At most this many characters of prompt text
+	HasTools       *bool             `json:"has_tools,omitempty"`        // Request does (or does not) offer tools
+	HasImages      *bool             `json:"has_images,omitempty"`       // Request does (or does not) include images
+	Users          []string          `json:"users,omitempty"`            // OpenAI user or Anthropic metadata.user_id values
+	Headers        map[string]string `json:"headers,omitempty"`          // Header values, "*" for any value
+}
+
+// MatchesModel reports whether the rule applies to a requested model name
+func (m RuleMatch) MatchesModel(name string) bool {
+	if len(m.Models) == 0 {
+		return true
+	}
+	for _, pattern := range m.Models {
+		if pattern == name || (IsModelPattern(pattern) && matchModelPattern(pattern, name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateRules checks that routing rules target configured models and have sensible bounds
+func (c *Config) ValidateRules() error {
+	var errs []string
+
+	for i, rule := range c.Rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if rule.Model == "" {
+			errs = append(errs, fmt.Sprintf("  rule %q has no target model", name))
+		} else if _, exists := c.Models[rule.Model]; !exists {
+			errs = append(errs, fmt.Sprintf("  rule %q targets unknown model %q", name, rule.Model))
+		}
+		m := rule.Match
+		if m.MinMessages < 0 || m.MaxMessages < 0 || m.MinPromptChars < 0 || m.MaxPromptChars < 0 {
+			errs = append(errs, fmt.Sprintf("  rule %q bounds must not be negative", name))
+		}
+		if (m.MaxMessages > 0 && m.MinMessages > m.MaxMessages) || (m.MaxPromptChars > 0 && m.MinPromptChars > m.MaxPromptChars) {
+			errs = append(errs, fmt.Sprintf("  rule %q has a minimum above its maximum", name))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("rules validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
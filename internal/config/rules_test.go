@@ -0,0 +1,41 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    RoutingRule
+		wantErr string
+	}{
+		{name: "valid", rule: RoutingRule{Name: "long", Match: RuleMatch{MinPromptChars: 20000}, Model: "long-context"}},
+		{name: "no target", rule: RoutingRule{Name: "broken"}, wantErr: "rule \"broken\" has no target model"},
+		{name: "unknown target", rule: RoutingRule{Model: "missing"}, wantErr: "rule \"#1\" targets unknown model"},
+		{name: "negative bound", rule: RoutingRule{Match: RuleMatch{MinMessages: -1}, Model: "long-context"}, wantErr: "must not be negative"},
+		{name: "inverted bounds", rule: RoutingRule{Match: RuleMatch{MinMessages: 5, MaxMessages: 2}, Model: "long-context"}, wantErr: "minimum above its maximum"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Models: map[string]ModelConfig{"long-context": {}},
+				Rules:  []RoutingRule{tt.rule},
+			}
+			err := cfg.ValidateRules()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+
+	assert.True(t, RuleMatch{}.MatchesModel("anything"))
+	assert.True(t, RuleMatch{Models: []string{"gpt-4o", "claude-*"}}.MatchesModel("claude-sonnet"))
+	assert.False(t, RuleMatch{Models: []string{"gpt-4o"}}.MatchesModel("gpt-4o-mini"))
+}
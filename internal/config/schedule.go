@@ -0,0 +1,155 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	// Time zone data for schedules on hosts without a zoneinfo database (e.g. scratch images)
+	_ "time/tzdata"
+)
+
+// ScheduleConfig limits the hours a backend is used. A backend outside its schedule is
+// skipped like an unavailable one, e.g. a costly provider outside business hours.
+type ScheduleConfig struct {
+	// Windows are the times the backend is used (default always)
+	Windows []TimeWindow `json:"windows,omitempty"`
+	// Off are times the backend is not used, even within a window
+	Off []TimeWindow `json:"off,omitempty"`
+	// Timezone is the IANA time zone of the windows, e.g. "Europe/Berlin" (default the
+	// server's local time)
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// TimeWindow is a daily time range. A window whose end is before its start runs past
+// midnight, into the day after each of its days; equal start and end cover the whole day.
+type TimeWindow struct {
+	Days  []string `json:"days,omitempty"`  // "mon" to "sun" (default every day)
+	Start string   `json:"start,omitempty"` // "HH:MM" (default "00:00")
+	End   string   `json:"end,omitempty"`   // "HH:MM", "24:00" for midnight (default "00:00")
+}
+
+// weekdays maps the day names of time windows to weekdays
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// scheduleLocations caches loaded time zones by name
+var scheduleLocations sync.Map
+
+// Active reports whether a backend with this schedule is used at time t
+func (s *ScheduleConfig) Active(t time.Time) bool {
+	if s.Timezone != "" {
+		if loc, err := loadScheduleLocation(s.Timezone); err == nil {
+			t = t.In(loc)
+		}
+	}
+	if len(s.Windows) > 0 && !slices.ContainsFunc(s.Windows, func(w TimeWindow) bool { return w.contains(t) }) {
+		return false
+	}
+	return !slices.ContainsFunc(s.Off, func(w TimeWindow) bool { return w.contains(t) })
+}
+
+// contains reports whether t is within the window
+func (w TimeWindow) contains(t time.Time) bool {
+	start, _ := parseClock(w.Start)
+	end, _ := parseClock(w.End)
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	switch {
+	case start < end:
+		return minute >= start && minute < end && w.onDay(day)
+	case start > end:
+		// The part after midnight belongs to the window of the day before
+		return (minute >= start && w.onDay(day)) || (minute < end && w.onDay((day+6)%7))
+	default:
+		return w.onDay(day)
+	}
+}
+
+// onDay reports whether the window applies to a weekday
+func (w TimeWindow) onDay(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(w.Days, func(name string) bool {
+		d, ok := weekdays[strings.ToLower(name)]
+		return ok && d == day
+	})
+}
+
+// validate returns what is wrong with the schedule
+func (s *ScheduleConfig) validate() []string {
+	var errs []string
+	if s.Timezone != "" {
+		if _, err := loadScheduleLocation(s.Timezone); err != nil {
+			errs = append(errs, fmt.Sprintf("timezone %q is not a known time zone", s.Timezone))
+		}
+	}
+	for _, w := range slices.Concat(s.Windows, s.Off) {
+		for _, clock := range []string{w.Start, w.End} {
+			if _, err := parseClock(clock); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+		for _, day := range w.Days {
+			if _, ok := weekdays[strings.ToLower(day)]; !ok {
+				errs = append(errs, fmt.Sprintf("day %q must be one of mon, tue, wed, thu, fri, sat, sun", day))
+			}
+		}
+	}
+	return errs
+}
+
+// parseClock returns the minutes after midnight of an "HH:MM" time, 0 when empty
+func parseClock(clock string) (int, error) {
+	if clock == "" {
+		return 0, nil
+	}
+	hours, minutes, ok := strings.Cut(clock, ":")
+	h, hErr := strconv.Atoi(hours)
+	m, mErr := strconv.Atoi(minutes)
+	if !ok || hErr != nil || mErr != nil || len(minutes) != 2 || h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, fmt.Errorf("time %q must be HH:MM, from 00:00 to 24:00", clock)
+	}
+	return h*60 + m, nil
+}
+
+// loadScheduleLocation loads a time zone, once
+func loadScheduleLocation(name string) (*time.Location, error) {
+	if loc, ok := scheduleLocations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	scheduleLocations.Store(name, loc)
+	return loc, nil
+}
+
+// ValidateSchedules checks the time zones, times and days of backend schedules
+func (c *Config) ValidateSchedules() error {
+	var errs []string
+	for modelName, modelConfig := range c.Models {
+		for _, p := range modelConfig.Providers {
+			if p.Schedule == nil {
+				continue
+			}
+			for _, msg := range p.Schedule.validate() {
+				errs = append(errs, fmt.Sprintf("  model %q backend %q schedule %s", modelName, p.ToProviderModel(), msg))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		slices.Sort(errs)
+		return fmt.Errorf("schedules validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
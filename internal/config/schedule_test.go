@@ -0,0 +1,74 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduleConfig_Active(t *testing.T) {
+	// 2026-03-02 is a Monday
+	at := func(day int, clock string) time.Time {
+		parsed, err := time.Parse("15:04", clock)
+		if err != nil {
+			t.Fatalf("invalid clock %q: %v", clock, err)
+		}
+		return time.Date(2026, 3, day, parsed.Hour(), parsed.Minute(), 0, 0, time.UTC)
+	}
+	businessHours := TimeWindow{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "18:00"}
+	overnight := TimeWindow{Days: []string{"fri"}, Start: "22:00", End: "06:00"}
+
+	tests := []struct {
+		name     string
+		schedule ScheduleConfig
+		at       time.Time
+		want     bool
+	}{
+		{name: "no windows", at: at(2, "03:00"), want: true},
+		{name: "within business hours", schedule: ScheduleConfig{Windows: []TimeWindow{businessHours}}, at: at(2, "09:00"), want: true},
+		{name: "end is exclusive", schedule: ScheduleConfig{Windows: []TimeWindow{businessHours}}, at: at(2, "18:00"), want: false},
+		{name: "weekend", schedule: ScheduleConfig{Windows: []TimeWindow{businessHours}}, at: at(7, "12:00"), want: false},
+		{name: "overnight before midnight", schedule: ScheduleConfig{Windows: []TimeWindow{overnight}}, at: at(6, "23:30"), want: true},
+		{name: "overnight into the next day", schedule: ScheduleConfig{Windows: []TimeWindow{overnight}}, at: at(7, "05:59"), want: true},
+		{name: "overnight of another day", schedule: ScheduleConfig{Windows: []TimeWindow{overnight}}, at: at(3, "05:00"), want: false},
+		{name: "whole day", schedule: ScheduleConfig{Windows: []TimeWindow{{Days: []string{"Sun"}}}}, at: at(8, "12:00"), want: true},
+		{name: "off hours", schedule: ScheduleConfig{Off: []TimeWindow{businessHours}}, at: at(2, "12:00"), want: false},
+		{name: "outside off hours", schedule: ScheduleConfig{Off: []TimeWindow{businessHours}}, at: at(2, "20:00"), want: true},
+		{name: "time zone", schedule: ScheduleConfig{Windows: []TimeWindow{businessHours}, Timezone: "America/New_York"}, at: at(2, "12:00"), want: false},
+		{name: "time zone within", schedule: ScheduleConfig{Windows: []TimeWindow{businessHours}, Timezone: "America/New_York"}, at: at(2, "15:00"), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.schedule.Active(tt.at))
+		})
+	}
+}
+
+func TestValidateSchedules(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule *ScheduleConfig
+		wantErr  []string
+	}{
+		{name: "not configured"},
+		{name: "valid", schedule: &ScheduleConfig{Windows: []TimeWindow{{Days: []string{"mon"}, Start: "09:00", End: "24:00"}}, Timezone: "Asia/Tokyo"}},
+		{name: "invalid", schedule: &ScheduleConfig{Off: []TimeWindow{{Days: []string{"monday"}, Start: "9am", End: "24:30"}}, Timezone: "Mars/Olympus"},
+			wantErr: []string{`day "monday"`, `time "9am"`, `time "24:30"`, `timezone "Mars/Olympus"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Models: map[string]ModelConfig{"m": {Providers: []ModelProvider{{Provider: "p", Model: "x", Schedule: tt.schedule}}}}}
+			err := cfg.ValidateSchedules()
+			if len(tt.wantErr) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				for _, want := range tt.wantErr {
+					assert.Contains(t, err.Error(), want)
+				}
+			}
+		})
+	}
+}
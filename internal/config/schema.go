@@ -0,0 +1,169 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/macedot/openmodel"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// Environment variable to control remote schema fetching
+// Set to "false" or "0" to disallow remote schemas (security hardening)
+const envAllowRemoteSchemas = "OPENMODEL_ALLOW_REMOTE_SCHEMAS"
+
+// DefaultSchemaURL identifies the configuration schema built into the binary. Configs
+// without $schema, or naming this URL, are validated against the built-in copy, so
+// loading a config never fetches it.
+const DefaultSchemaURL = "https://raw.githubusercontent.com/macedot/openmodel/master/openmodel.schema.json"
+
+// Known schema checksums for integrity verification
+// Maps schema URLs to their expected SHA256 checksums
+var knownSchemaChecksums = map[string]string{
+	DefaultSchemaURL: "62ccb4faffd88dad8f58a43f9811623a08a7584d2fa45ac7fe3b4d0560f34055",
+}
+
+// configWithSchema is used to extract the $schema field before full parsing
+type configWithSchema struct {
+	Schema string `json:"$schema"`
+}
+
+// SchemaCache caches compiled JSON schemas
+type SchemaCache struct {
+	mu        sync.RWMutex
+	compilers map[string]*jsonschema.Compiler
+}
+
+var (
+	// Global schema cache instance
+	schemaCache = &SchemaCache{
+		compilers: make(map[string]*jsonschema.Compiler),
+	}
+)
+
+func getSchemaCompiler(schemaURL string) (*jsonschema.Compiler, error) {
+	// Check cache first (read lock)
+	schemaCache.mu.RLock()
+	if compiler, exists := schemaCache.compilers[schemaURL]; exists {
+		schemaCache.mu.RUnlock()
+		return compiler, nil
+	}
+	schemaCache.mu.RUnlock()
+
+	// Acquire write lock and double-check
+	schemaCache.mu.Lock()
+	defer schemaCache.mu.Unlock()
+
+	// Double-check after acquiring write lock
+	if compiler, exists := schemaCache.compilers[schemaURL]; exists {
+		return compiler, nil
+	}
+
+	// Compile new schema
+	compiler := jsonschema.NewCompiler()
+
+	var schemaData any
+	var schemaBytes []byte
+
+	isRemote := strings.HasPrefix(schemaURL, "http://") || strings.HasPrefix(schemaURL, "https://")
+
+	if schemaURL == DefaultSchemaURL {
+		if err := json.Unmarshal(openmodel.ConfigSchema, &schemaData); err != nil {
+			return nil, fmt.Errorf("failed to parse built-in schema: %w", err)
+		}
+	} else if isRemote {
+		// Check if remote schemas are allowed
+		if !isRemoteSchemaAllowed() {
+			return nil, fmt.Errorf("remote schema fetching is disabled (set %s=true to allow)", envAllowRemoteSchemas)
+		}
+
+		// Warn about remote schema fetching
+		fmt.Fprintf(os.Stderr, "Warning: Fetching remote schema from %s (potential security risk)\n", schemaURL)
+
+		client := &http.Client{Timeout: 5 * time.Second} // Reduced timeout for better availability
+		resp, err := client.Get(schemaURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch schema: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("schema fetch returned status %d", resp.StatusCode)
+		}
+
+		// Read all bytes for checksum verification
+		schemaBytes, err = readAllWithLimit(resp.Body, 10*1024*1024) // 10MB limit
+		if err != nil {
+			return nil, fmt.Errorf("failed to read schema: %w", err)
+		}
+
+		// Verify checksum if known
+		if expectedChecksum, known := knownSchemaChecksums[schemaURL]; known && expectedChecksum != "" {
+			actualChecksum := sha256Sum(schemaBytes)
+			if actualChecksum != expectedChecksum {
+				return nil, fmt.Errorf("schema checksum mismatch: expected %s, got %s", expectedChecksum, actualChecksum)
+			}
+		}
+
+		if err := json.Unmarshal(schemaBytes, &schemaData); err != nil {
+			return nil, fmt.Errorf("failed to parse schema: %w", err)
+		}
+	} else {
+		schemaPath := schemaURL
+		if _, err := os.Stat(schemaPath); os.IsNotExist(err) {
+			schemaPath = filepath.Join(os.Getenv("HOME"), ".config", "openmodel", schemaURL)
+		}
+		if _, err := os.Stat(schemaPath); os.IsNotExist(err) {
+			schemaPath = filepath.Join(filepath.Dir(os.Args[0]), schemaURL)
+		}
+
+		var err error
+		schemaBytes, err = os.ReadFile(schemaPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read schema file: %w", err)
+		}
+
+		if err := json.Unmarshal(schemaBytes, &schemaData); err != nil {
+			return nil, fmt.Errorf("failed to parse schema: %w", err)
+		}
+	}
+
+	if err := compiler.AddResource(schemaURL, schemaData); err != nil {
+		return nil, fmt.Errorf("failed to add schema: %w", err)
+	}
+
+	// Store in cache
+	schemaCache.compilers[schemaURL] = compiler
+
+	return compiler, nil
+}
+
+// isRemoteSchemaAllowed checks if remote schema fetching is allowed
+func isRemoteSchemaAllowed() bool {
+	val := os.Getenv(envAllowRemoteSchemas)
+	if val == "" {
+		return true // Default: allow for backward compatibility
+	}
+	return strings.ToLower(val) != "false" && val != "0"
+}
+
+// readAllWithLimit reads from reader with a size limit to prevent memory exhaustion
+func readAllWithLimit(r io.Reader, limit int64) ([]byte, error) {
+	return io.ReadAll(io.LimitReader(r, limit))
+}
+
+// sha256Sum computes the SHA256 checksum of data and returns it as hex string
+func sha256Sum(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
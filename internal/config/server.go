@@ -0,0 +1,116 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"slices"
+	"time"
+)
+
+// ServerConfig holds server settings
+type ServerConfig struct {
+	Port int    `json:"port"`
+	Host string `json:"host"`
+	// DrainTimeoutMs bounds how long requests in flight may take to finish once the server
+	// drains, on shutdown or when drained through the admin API (default 30000)
+	DrainTimeoutMs int `json:"drain_timeout_ms,omitempty"`
+	// Listeners replace the host:port bind with one or more addresses, each serving all
+	// endpoints or some of them (requires restart)
+	Listeners []ListenerConfig `json:"listeners,omitempty"`
+	// Timeouts of client connections (requires restart): reading a request (default 30000),
+	// writing a response (default 120000) and waiting for the next request on a keep-alive
+	// connection (default 120000). -1 disables the read and write timeouts.
+	ReadTimeoutMs  int `json:"read_timeout_ms,omitempty"`
+	WriteTimeoutMs int `json:"write_timeout_ms,omitempty"`
+	IdleTimeoutMs  int `json:"idle_timeout_ms,omitempty"`
+	// StreamWriteTimeoutMs bounds writing a streamed response instead of the write timeout,
+	// which otherwise cuts long streams off (default write_timeout_ms, -1 disables)
+	StreamWriteTimeoutMs int `json:"stream_write_timeout_ms,omitempty"`
+	// MaxHeaderBytes is the largest request header accepted (requires restart, default 4096)
+	MaxHeaderBytes int `json:"max_header_bytes,omitempty"`
+	// TLS serves host:port over TLS; listeners have their own (requires restart)
+	TLS *ListenerTLSConfig `json:"tls,omitempty"`
+	// DisabledEndpoints lists endpoint groups that are not served: "openai", "anthropic",
+	// "ollama", "admin" and "docs". /, /health, /healthz and /readyz are always served.
+	DisabledEndpoints []string `json:"disabled_endpoints,omitempty"`
+	// BackendHeaders adds X-OpenModel-Backend, X-OpenModel-Attempts and X-OpenModel-Latency
+	// to responses, telling clients which backend served them after how many attempts
+	BackendHeaders bool `json:"backend_headers,omitempty"`
+	// StreamStats ends streamed responses with an event carrying the time to first token
+	// and output tokens per second of the backend that served them
+	StreamStats bool `json:"stream_stats,omitempty"`
+}
+
+// Endpoint groups that can be disabled
+const (
+	EndpointsOpenAI    = "openai"    // The OpenAI API, /v1/... and /ws/v1/chat
+	EndpointsAnthropic = "anthropic" // The Anthropic Messages API, /v1/messages
+	EndpointsOllama    = "ollama"    // The Ollama model management passthrough, /api/...
+	EndpointsAdmin     = "admin"     // The admin API, /admin/...
+	EndpointsDocs      = "docs"      // The API documentation, /openapi.json and /docs
+)
+
+// endpointGroups lists the endpoint groups that can be disabled
+var endpointGroups = []string{EndpointsOpenAI, EndpointsAnthropic, EndpointsOllama, EndpointsAdmin, EndpointsDocs}
+
+// EndpointsEnabled reports whether an endpoint group is served
+func (s ServerConfig) EndpointsEnabled(group string) bool {
+	return !slices.Contains(s.DisabledEndpoints, group)
+}
+
+// Defaults for client connections
+const (
+	defaultServerReadTimeout  = 30 * time.Second
+	defaultServerWriteTimeout = 120 * time.Second
+	defaultServerIdleTimeout  = 120 * time.Second
+	defaultMaxHeaderBytes     = 4096
+)
+
+// serverTimeout returns a timeout in milliseconds, its default when unset and 0 (none)
+// when negative
+func serverTimeout(ms int, fallback time.Duration) time.Duration {
+	switch {
+	case ms < 0:
+		return 0
+	case ms == 0:
+		return fallback
+	default:
+		return time.Duration(ms) * time.Millisecond
+	}
+}
+
+// GetReadTimeout returns how long reading a request may take (0 means no limit)
+func (s ServerConfig) GetReadTimeout() time.Duration {
+	return serverTimeout(s.ReadTimeoutMs, defaultServerReadTimeout)
+}
+
+// GetWriteTimeout returns how long writing a response may take (0 means no limit)
+func (s ServerConfig) GetWriteTimeout() time.Duration {
+	return serverTimeout(s.WriteTimeoutMs, defaultServerWriteTimeout)
+}
+
+// GetIdleTimeout returns how long a keep-alive connection may wait for its next request
+func (s ServerConfig) GetIdleTimeout() time.Duration {
+	return serverTimeout(max(s.IdleTimeoutMs, 0), defaultServerIdleTimeout)
+}
+
+// GetStreamWriteTimeout returns how long writing a streamed response may take (0 means
+// no limit)
+func (s ServerConfig) GetStreamWriteTimeout() time.Duration {
+	return serverTimeout(s.StreamWriteTimeoutMs, s.GetWriteTimeout())
+}
+
+// GetMaxHeaderBytes returns the largest request header accepted
+func (s ServerConfig) GetMaxHeaderBytes() int {
+	if s.MaxHeaderBytes <= 0 {
+		return defaultMaxHeaderBytes
+	}
+	return s.MaxHeaderBytes
+}
+
+// GetDrainTimeout returns how long requests in flight may take to finish during a drain
+func (s ServerConfig) GetDrainTimeout() time.Duration {
+	if s.DrainTimeoutMs <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(s.DrainTimeoutMs) * time.Millisecond
+}
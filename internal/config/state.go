@@ -0,0 +1,68 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// StateConfig selects the store for failure counts, cooldowns and rate-limit counters
+type StateConfig struct {
+	Backend        string `json:"backend"`          // "memory" (default) | "redis"
+	RedisURL       string `json:"redis_url"`        // redis://[:password@]host:port[/db], rediss:// for TLS (supports ${VAR} expansion)
+	KeyPrefix      string `json:"key_prefix"`       // Prefix for shared keys, default "openmodel"
+	SyncIntervalMs int    `json:"sync_interval_ms"` // How often shared backend health is pulled, default 1000
+}
+
+// State backend constants
+const (
+	StateBackendMemory = "memory"
+	StateBackendRedis  = "redis"
+)
+
+// GetBackend returns the state backend, defaulting to memory
+func (s *StateConfig) GetBackend() string {
+	if s == nil || s.Backend == "" {
+		return StateBackendMemory
+	}
+	return s.Backend
+}
+
+// GetRedisURL returns the Redis URL with environment variables expanded
+func (s *StateConfig) GetRedisURL() string {
+	if s == nil {
+		return ""
+	}
+	return expandEnvVars(s.RedisURL)
+}
+
+// GetKeyPrefix returns the prefix for shared keys
+func (s *StateConfig) GetKeyPrefix() string {
+	if s == nil || s.KeyPrefix == "" {
+		return "openmodel"
+	}
+	return s.KeyPrefix
+}
+
+// GetSyncInterval returns how often shared backend health is pulled
+func (s *StateConfig) GetSyncInterval() time.Duration {
+	if s == nil || s.SyncIntervalMs <= 0 {
+		return time.Second
+	}
+	return time.Duration(s.SyncIntervalMs) * time.Millisecond
+}
+
+// ValidateState checks that the state backend is known and redis has a URL
+func (c *Config) ValidateState() error {
+	switch c.State.GetBackend() {
+	case StateBackendMemory:
+		return nil
+	case StateBackendRedis:
+		if c.State.RedisURL == "" {
+			return fmt.Errorf("state backend %q requires redis_url", StateBackendRedis)
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid state backend: %q (must be 'memory' or 'redis')", c.State.Backend)
+	}
+}
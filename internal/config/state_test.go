@@ -0,0 +1,34 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateState(t *testing.T) {
+	tests := []struct {
+		name    string
+		state   *StateConfig
+		wantErr string
+	}{
+		{name: "not configured"},
+		{name: "memory", state: &StateConfig{Backend: "memory"}},
+		{name: "redis", state: &StateConfig{Backend: "redis", RedisURL: "redis://localhost:6379/0"}},
+		{name: "redis without url", state: &StateConfig{Backend: "redis"}, wantErr: "requires redis_url"},
+		{name: "unknown backend", state: &StateConfig{Backend: "etcd"}, wantErr: "invalid state backend"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{State: tt.state}
+			err := cfg.ValidateState()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
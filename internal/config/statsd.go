@@ -0,0 +1,106 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"cmp"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatsD formats
+const (
+	StatsDFormatDogStatsD = "dogstatsd" // Labels sent as tags
+	StatsDFormatStatsD    = "statsd"    // Label values appended to metric names
+)
+
+// StatsDConfig holds settings for pushing the metrics to a StatsD or DogStatsD agent over
+// UDP (requires restart). Counters and histograms are sent as they are updated, gauges
+// every flush interval.
+type StatsDConfig struct {
+	Enabled bool `json:"enabled"`
+	// Host is the agent's host (supports ${VAR} expansion; default DD_AGENT_HOST, then localhost)
+	Host string `json:"host,omitempty"`
+	// Port is the agent's UDP port (default 8125)
+	Port int `json:"port,omitempty"`
+	// Prefix is prepended to metric names (default "openmodel.")
+	Prefix *string `json:"prefix,omitempty"`
+	// Tags are added to every metric, e.g. "env:prod" (dogstatsd only; values support ${VAR} expansion)
+	Tags []string `json:"tags,omitempty"`
+	// Format is "dogstatsd" (default) or "statsd"
+	Format string `json:"format,omitempty"`
+	// FlushIntervalMs is how often buffered metrics and gauges are sent (default 10000)
+	FlushIntervalMs int `json:"flush_interval_ms,omitempty"`
+}
+
+// defaultStatsDPort is the port StatsD and DogStatsD agents listen on by default
+const defaultStatsDPort = 8125
+
+// IsEnabled reports whether metrics are pushed to StatsD
+func (s *StatsDConfig) IsEnabled() bool {
+	return s != nil && s.Enabled
+}
+
+// GetAddress returns the agent's host:port
+func (s *StatsDConfig) GetAddress() string {
+	host := cmp.Or(expandEnvVars(s.Host), os.Getenv("DD_AGENT_HOST"), "localhost")
+	return net.JoinHostPort(host, strconv.Itoa(cmp.Or(s.Port, defaultStatsDPort)))
+}
+
+// GetPrefix returns the prefix of metric names
+func (s *StatsDConfig) GetPrefix() string {
+	if s.Prefix == nil {
+		return "openmodel."
+	}
+	return *s.Prefix
+}
+
+// GetTags returns the tags added to every metric with environment variables expanded
+func (s *StatsDConfig) GetTags() []string {
+	tags := make([]string, len(s.Tags))
+	for i, tag := range s.Tags {
+		tags[i] = expandEnvVars(tag)
+	}
+	return tags
+}
+
+// GetFormat returns the format metrics are sent in
+func (s *StatsDConfig) GetFormat() string {
+	return cmp.Or(s.Format, StatsDFormatDogStatsD)
+}
+
+// GetFlushInterval returns how often buffered metrics are sent
+func (s *StatsDConfig) GetFlushInterval() time.Duration {
+	return time.Duration(cmp.Or(s.FlushIntervalMs, 10000)) * time.Millisecond
+}
+
+// ValidateStatsD checks the port, format, flush interval and tags of the StatsD agent
+func (c *Config) ValidateStatsD() error {
+	if !c.StatsD.IsEnabled() {
+		return nil
+	}
+	var errs []string
+	if c.StatsD.Port < 0 || c.StatsD.Port > 65535 {
+		errs = append(errs, fmt.Sprintf("  port %d must be between 1 and 65535", c.StatsD.Port))
+	}
+	switch c.StatsD.GetFormat() {
+	case StatsDFormatDogStatsD, StatsDFormatStatsD:
+	default:
+		errs = append(errs, fmt.Sprintf("  invalid format %q (must be %s or %s)", c.StatsD.Format, StatsDFormatDogStatsD, StatsDFormatStatsD))
+	}
+	if c.StatsD.FlushIntervalMs < 0 {
+		errs = append(errs, fmt.Sprintf("  flush_interval_ms %d must not be negative", c.StatsD.FlushIntervalMs))
+	}
+	for _, tag := range c.StatsD.Tags {
+		if tag == "" || strings.ContainsAny(tag, "|,#") {
+			errs = append(errs, fmt.Sprintf("  invalid tag %q (must be non-empty, without '|', ',' or '#')", tag))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("statsd validation failed:\n%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
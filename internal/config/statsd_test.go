@@ -0,0 +1,53 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateStatsD(t *testing.T) {
+	tests := []struct {
+		name    string
+		statsd  *StatsDConfig
+		wantErr []string
+	}{
+		{name: "disabled", statsd: &StatsDConfig{Port: -1, Format: "graphite"}},
+		{name: "defaults", statsd: &StatsDConfig{Enabled: true}},
+		{name: "valid", statsd: &StatsDConfig{Enabled: true, Host: "${DD_HOST}", Port: 9125, Tags: []string{"env:prod"}, Format: StatsDFormatStatsD}},
+		{name: "invalid", statsd: &StatsDConfig{Enabled: true, Port: 70000, Format: "graphite", FlushIntervalMs: -1, Tags: []string{"env:prod,team:ml"}},
+			wantErr: []string{"port 70000", `invalid format "graphite"`, "flush_interval_ms -1", `invalid tag "env:prod,team:ml"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{StatsD: tt.statsd}
+			err := cfg.ValidateStatsD()
+			if len(tt.wantErr) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				for _, want := range tt.wantErr {
+					assert.Contains(t, err.Error(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestStatsDConfig_Getters(t *testing.T) {
+	t.Setenv("DD_AGENT_HOST", "datadog-agent")
+	t.Setenv("ENV", "prod")
+	cfg := &StatsDConfig{Enabled: true, Tags: []string{"env:${ENV}"}}
+	assert.Equal(t, "datadog-agent:8125", cfg.GetAddress())
+	assert.Equal(t, "openmodel.", cfg.GetPrefix())
+	assert.Equal(t, []string{"env:prod"}, cfg.GetTags())
+	assert.Equal(t, StatsDFormatDogStatsD, cfg.GetFormat())
+	assert.Equal(t, 10*time.Second, cfg.GetFlushInterval())
+
+	empty := ""
+	cfg = &StatsDConfig{Enabled: true, Host: "10.0.0.1", Port: 9125, Prefix: &empty}
+	assert.Equal(t, "10.0.0.1:9125", cfg.GetAddress())
+	assert.Empty(t, cfg.GetPrefix())
+}
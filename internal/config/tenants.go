@@ -0,0 +1,131 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Tenant is a team sharing the instance with others. Its clients only see and use its
+// models, its chains serve model names for it in place of the shared ones, and its
+// requests are held to its monthly quota and accounted to it in usage reports.
+type Tenant struct {
+	Name   string   `json:"name"`
+	Models []string `json:"models,omitempty"` // Requested model names, "*" patterns allowed (default all)
+	// Chains map requested model names, "*" patterns allowed, to the configured models
+	// whose backend chains serve them for the tenant
+	Chains map[string]string `json:"chains,omitempty"`
+	// MonthlyTokens and MonthlyBudget cap the tokens and cost of all the tenant's requests
+	// in a UTC calendar month (0: unlimited)
+	MonthlyTokens int64   `json:"monthly_tokens,omitempty"`
+	MonthlyBudget float64 `json:"monthly_budget,omitempty"`
+}
+
+// AllowsModel reports whether the tenant may use a requested model name
+func (t Tenant) AllowsModel(name string) bool {
+	return RuleMatch{Models: t.Models}.MatchesModel(name)
+}
+
+// HasQuota reports whether the tenant has a monthly token or cost quota
+func (t Tenant) HasQuota() bool {
+	return t.MonthlyTokens > 0 || t.MonthlyBudget > 0
+}
+
+// Chain returns the configured model serving a requested name for the tenant: that of
+// an exact entry, otherwise of the matching pattern with the most literal characters
+func (t Tenant) Chain(name string) (string, bool) {
+	if model, ok := t.Chains[name]; ok {
+		return model, true
+	}
+	best, ok := mostSpecificPattern(maps.Keys(t.Chains), name)
+	return t.Chains[best], ok
+}
+
+// LookupTenant returns the tenant with the given name
+func (c *Config) LookupTenant(name string) (Tenant, bool) {
+	for _, t := range c.Tenants {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return Tenant{}, false
+}
+
+// ValidateTenants checks that tenants are named, their chains lead to configured models
+// and their quotas are not negative, that clients authenticate to be assigned to them,
+// and that keys, roles and client certs name existing tenants
+func (c *Config) ValidateTenants() error {
+	var errs []string
+	if strings.ContainsAny(c.TenantHeader, " \t\r\n:") {
+		errs = append(errs, fmt.Sprintf("  tenant_header %q is not a valid header name", c.TenantHeader))
+	}
+	if c.TenantHeader != "" && len(c.Tenants) == 0 {
+		errs = append(errs, "  tenant_header requires tenants")
+	}
+	if len(c.Tenants) > 0 && len(c.APIKeys) == 0 && len(c.ClientCerts) == 0 && !c.KeyStore.IsEnabled() && !c.JWT.IsEnabled() {
+		errs = append(errs, "  tenants require api_keys, key_store, jwt or client_certs to assign requests to them")
+	}
+	names := make(map[string]bool)
+	for i, t := range c.Tenants {
+		name := t.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+			errs = append(errs, fmt.Sprintf("  tenant %s has no name", name))
+		} else if names[name] {
+			errs = append(errs, fmt.Sprintf("  tenant %q is defined more than once", name))
+		}
+		names[name] = true
+		if slices.Contains(t.Models, "") {
+			errs = append(errs, fmt.Sprintf("  tenant %q has an empty model name", name))
+		}
+		for _, requested := range slices.Sorted(maps.Keys(t.Chains)) {
+			model := t.Chains[requested]
+			modelConfig, ok := c.Models[model]
+			switch {
+			case requested == "":
+				errs = append(errs, fmt.Sprintf("  tenant %q has a chain with an empty model name", name))
+			case IsModelPattern(model) || !ok || modelConfig.Discover != nil:
+				errs = append(errs, fmt.Sprintf("  tenant %q chain %q references unknown model %q", name, requested, model))
+			}
+		}
+		if t.MonthlyTokens < 0 {
+			errs = append(errs, fmt.Sprintf("  tenant %q has negative monthly_tokens", name))
+		}
+		if t.MonthlyBudget < 0 {
+			errs = append(errs, fmt.Sprintf("  tenant %q has negative monthly_budget", name))
+		}
+	}
+
+	checkTenant := func(kind, name, tenant string, choices []string) {
+		if tenant != "" && !names[tenant] {
+			errs = append(errs, fmt.Sprintf("  %s %q references unknown tenant %q", kind, name, tenant))
+		}
+		for _, choice := range choices {
+			if !IsModelPattern(choice) && !names[choice] {
+				errs = append(errs, fmt.Sprintf("  %s %q references unknown tenant %q", kind, name, choice))
+			}
+		}
+		if len(choices) > 0 && c.TenantHeader == "" {
+			errs = append(errs, fmt.Sprintf("  %s %q tenants require tenant_header", kind, name))
+		}
+	}
+	for _, key := range c.APIKeys {
+		checkTenant("api key", key.Name, key.Tenant, key.Tenants)
+	}
+	if c.JWT != nil {
+		for _, role := range c.JWT.Roles {
+			checkTenant("jwt role", role.Name, role.Tenant, role.Tenants)
+		}
+	}
+	for _, cc := range c.ClientCerts {
+		checkTenant("client cert", cc.Name, cc.Tenant, cc.Tenants)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("tenants validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
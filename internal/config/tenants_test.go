@@ -0,0 +1,87 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTenants(t *testing.T) {
+	models := map[string]ModelConfig{
+		"gpt-4":      {Providers: []ModelProvider{{Provider: "p", Model: "x"}}},
+		"gpt-4-eu":   {Providers: []ModelProvider{{Provider: "p", Model: "y"}}},
+		"gpt-*":      {Providers: []ModelProvider{{Provider: "p", Model: "x"}}},
+		"discovered": {Discover: &DiscoverConfig{Provider: "p"}},
+	}
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{name: "not configured"},
+		{name: "valid", cfg: Config{
+			TenantHeader: "X-Tenant",
+			Tenants: []Tenant{
+				{Name: "eu", Models: []string{"gpt-*"}, Chains: map[string]string{"gpt-4": "gpt-4-eu", "gpt-4-*": "gpt-4-eu"}, MonthlyBudget: 500},
+				{Name: "research", MonthlyTokens: 1000000},
+			},
+			APIKeys:     []APIKey{{Name: "app", Key: "sk-app", Tenant: "eu", Tenants: []string{"research"}}},
+			JWT:         &JWTConfig{Issuer: "https://idp", Roles: []JWTRole{{Name: "staff", Tenant: "research", Tenants: []string{"*"}}}},
+			ClientCerts: []ClientCert{{Name: "batch", Subjects: []string{"batch"}, Tenant: "research"}},
+		}},
+		{name: "unnamed", cfg: Config{Tenants: []Tenant{{}}}, wantErr: "tenant #1 has no name"},
+		{name: "duplicate", cfg: Config{Tenants: []Tenant{{Name: "a"}, {Name: "a"}}}, wantErr: "defined more than once"},
+		{name: "empty model", cfg: Config{Tenants: []Tenant{{Name: "a", Models: []string{""}}}}, wantErr: "empty model name"},
+		{name: "unknown chain model", cfg: Config{Tenants: []Tenant{{Name: "a", Chains: map[string]string{"gpt-4": "claude"}}}}, wantErr: `chain "gpt-4" references unknown model "claude"`},
+		{name: "pattern chain model", cfg: Config{Tenants: []Tenant{{Name: "a", Chains: map[string]string{"gpt-4": "gpt-*"}}}}, wantErr: "references unknown model"},
+		{name: "discovered chain model", cfg: Config{Tenants: []Tenant{{Name: "a", Chains: map[string]string{"gpt-4": "discovered"}}}}, wantErr: "references unknown model"},
+		{name: "negative quota", cfg: Config{Tenants: []Tenant{{Name: "a", MonthlyTokens: -1}}}, wantErr: "negative monthly_tokens"},
+		{name: "unknown key tenant", cfg: Config{Tenants: []Tenant{{Name: "a"}}, APIKeys: []APIKey{{Name: "app", Tenant: "b"}}}, wantErr: `api key "app" references unknown tenant "b"`},
+		{name: "unknown role tenant", cfg: Config{JWT: &JWTConfig{Roles: []JWTRole{{Name: "staff", Tenant: "b"}}}}, wantErr: `jwt role "staff" references unknown tenant "b"`},
+		{name: "unknown cert tenant", cfg: Config{ClientCerts: []ClientCert{{Name: "batch", Tenant: "b"}}}, wantErr: `client cert "batch" references unknown tenant "b"`},
+		{name: "unknown key tenant choice", cfg: Config{TenantHeader: "X-Tenant", Tenants: []Tenant{{Name: "a"}}, APIKeys: []APIKey{{Name: "app", Tenants: []string{"a", "b"}}}}, wantErr: `api key "app" references unknown tenant "b"`},
+		{name: "tenant choices without header", cfg: Config{Tenants: []Tenant{{Name: "a"}}, APIKeys: []APIKey{{Name: "app", Tenants: []string{"a"}}}}, wantErr: `api key "app" tenants require tenant_header`},
+		{name: "tenants without clients", cfg: Config{TenantHeader: "X-Tenant", Tenants: []Tenant{{Name: "a"}}}, wantErr: "tenants require api_keys, key_store, jwt or client_certs"},
+		{name: "header without tenants", cfg: Config{TenantHeader: "X-Tenant"}, wantErr: "tenant_header requires tenants"},
+		{name: "invalid header", cfg: Config{Tenants: []Tenant{{Name: "a"}}, APIKeys: []APIKey{{Name: "app"}}, TenantHeader: "X Tenant"}, wantErr: "not a valid header name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Models = models
+			err := tt.cfg.ValidateTenants()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+
+	tenant := Tenant{Name: "eu", Models: []string{"gpt-*"}, Chains: map[string]string{"gpt-4": "gpt-4-eu", "gpt-*": "gpt-4", "gpt-4-*": "gpt-4-eu"}}
+	for requested, want := range map[string]string{"gpt-4": "gpt-4-eu", "gpt-4-turbo": "gpt-4-eu", "gpt-3.5": "gpt-4"} {
+		chain, ok := tenant.Chain(requested)
+		assert.True(t, ok, requested)
+		assert.Equal(t, want, chain, requested)
+	}
+	_, ok := tenant.Chain("claude")
+	assert.False(t, ok)
+	assert.True(t, tenant.AllowsModel("gpt-4o"))
+	assert.False(t, tenant.AllowsModel("claude"))
+
+	key := APIKey{Tenant: "eu", Tenants: []string{"research-*"}}
+	assert.True(t, key.MayChooseTenant("eu"))
+	assert.True(t, key.MayChooseTenant("research-nlp"))
+	assert.False(t, key.MayChooseTenant("ops"))
+	assert.False(t, APIKey{}.MayChooseTenant("eu"))
+	assert.True(t, Tenant{}.AllowsModel("claude"))
+
+	cfg := &Config{Tenants: []Tenant{tenant}}
+	found, ok := cfg.LookupTenant("eu")
+	assert.True(t, ok)
+	assert.Equal(t, "eu", found.Name)
+	_, ok = cfg.LookupTenant("us")
+	assert.False(t, ok)
+}
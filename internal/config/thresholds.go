@@ -0,0 +1,259 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// GetThresholds returns the thresholds for a provider: the global ones, overridden by
+// those the provider sets
+func (c *Config) GetThresholds(providerName string) ThresholdsConfig {
+	return c.Thresholds.Merge(c.Providers[providerName].Thresholds)
+}
+
+// GetBackendThresholds returns the thresholds of a backend ("provider/model"): its
+// provider's, overridden by those of the models whose chains include it, overridden in
+// turn by those of its entries in the chains. ValidateThresholds ensures the chains agree,
+// as a backend has a single circuit breaker whichever model routes to it.
+func (c *Config) GetBackendThresholds(backend string) ThresholdsConfig {
+	providerName, _, _ := strings.Cut(backend, "/")
+	thresholds := c.GetThresholds(providerName)
+	if override, _ := c.backendThresholds(backend); override != nil {
+		thresholds = thresholds.Merge(override)
+	}
+	return thresholds
+}
+
+// backendThresholds returns the model and entry threshold overrides of a backend and the
+// model they come from, the first by name that has any
+func (c *Config) backendThresholds(backend string) (*ThresholdsConfig, string) {
+	var override *ThresholdsConfig
+	var owner string
+	for modelName, modelConfig := range c.Models {
+		if override != nil && modelName > owner {
+			continue
+		}
+		for _, mp := range modelConfig.Providers {
+			if (modelConfig.Thresholds == nil && mp.Thresholds == nil) || string(mp.ToProviderModel()) != backend {
+				continue
+			}
+			merged := ThresholdsConfig{}.Merge(modelConfig.Thresholds).Merge(mp.Thresholds)
+			override, owner = &merged, modelName
+			break
+		}
+	}
+	return override, owner
+}
+
+// ThresholdsConfig holds failure threshold settings
+type ThresholdsConfig struct {
+	FailuresBeforeSwitch int `json:"failures_before_switch"`
+	InitialTimeout       int `json:"initial_timeout_ms"` // First cooldown of a failed provider (used when cooldown_ms is unset)
+	MaxTimeout           int `json:"max_timeout_ms"`     // Cap for progressive cooldowns
+	CooldownMs           int `json:"cooldown_ms"`        // Time before a failed provider gets a probe request (-1 disables recovery)
+	FailureWindowMs      int `json:"failure_window_ms"`  // Failures older than this are forgotten (default 60000, -1 never)
+	// ErrorRate trips the breaker on the share of recent requests that failed instead of
+	// on failures_before_switch
+	ErrorRate *ErrorRateConfig `json:"error_rate,omitempty"`
+}
+
+// ErrorRateConfig is a rolling-window circuit breaker: a backend is taken out of rotation
+// when more than Percent of its last Requests requests within the window failed. It
+// tolerates the occasional failure of a busy backend that a failure count would not.
+type ErrorRateConfig struct {
+	Percent     float64 `json:"percent"`      // Failure share that trips the breaker (e.g. 50)
+	Requests    int     `json:"requests"`     // Requests in the rolling sample (default 20)
+	MinRequests int     `json:"min_requests"` // Requests needed in the sample before it can trip (default 10)
+	WindowMs    int     `json:"window_ms"`    // Requests older than this leave the sample (default 60000)
+}
+
+// Defaults for the error-rate breaker
+const (
+	defaultErrorRateRequests    = 20
+	defaultErrorRateMinRequests = 10
+	defaultErrorRateWindow      = 60 * time.Second
+)
+
+// IsEnabled reports whether the error-rate breaker replaces the failure count
+func (e *ErrorRateConfig) IsEnabled() bool {
+	return e != nil && e.Percent > 0
+}
+
+// GetRequests returns the size of the rolling sample
+func (e *ErrorRateConfig) GetRequests() int {
+	if e == nil || e.Requests <= 0 {
+		return defaultErrorRateRequests
+	}
+	return e.Requests
+}
+
+// GetMinRequests returns how many requests the sample needs before it can trip,
+// never more than the sample size
+func (e *ErrorRateConfig) GetMinRequests() int {
+	if e == nil || e.MinRequests <= 0 {
+		return min(defaultErrorRateMinRequests, e.GetRequests())
+	}
+	return min(e.MinRequests, e.GetRequests())
+}
+
+// GetWindow returns how long a request stays in the sample
+func (e *ErrorRateConfig) GetWindow() time.Duration {
+	if e == nil || e.WindowMs <= 0 {
+		return defaultErrorRateWindow
+	}
+	return time.Duration(e.WindowMs) * time.Millisecond
+}
+
+// Merge returns the thresholds with the settings override sets (non-zero) replacing
+// their own
+func (t ThresholdsConfig) Merge(override *ThresholdsConfig) ThresholdsConfig {
+	if override == nil {
+		return t
+	}
+	if override.FailuresBeforeSwitch != 0 {
+		t.FailuresBeforeSwitch = override.FailuresBeforeSwitch
+	}
+	if override.InitialTimeout != 0 {
+		t.InitialTimeout = override.InitialTimeout
+	}
+	if override.MaxTimeout != 0 {
+		t.MaxTimeout = override.MaxTimeout
+	}
+	if override.CooldownMs != 0 {
+		t.CooldownMs = override.CooldownMs
+	}
+	if override.FailureWindowMs != 0 {
+		t.FailureWindowMs = override.FailureWindowMs
+	}
+	if override.ErrorRate != nil {
+		t.ErrorRate = override.ErrorRate
+	}
+	return t
+}
+
+// Defaults for provider recovery
+const (
+	defaultCooldown      = 30 * time.Second
+	defaultFailureWindow = 60 * time.Second
+)
+
+// GetCooldown returns how long a failed provider is skipped before it is probed again.
+// Zero means the provider stays unavailable until it is reset.
+func (t ThresholdsConfig) GetCooldown() time.Duration {
+	switch {
+	case t.CooldownMs < 0:
+		return 0
+	case t.CooldownMs > 0:
+		return time.Duration(t.CooldownMs) * time.Millisecond
+	case t.InitialTimeout > 0:
+		return time.Duration(t.InitialTimeout) * time.Millisecond
+	default:
+		return defaultCooldown
+	}
+}
+
+// GetMaxCooldown returns the cap for progressive cooldowns (0 means no cap)
+func (t ThresholdsConfig) GetMaxCooldown() time.Duration {
+	return time.Duration(max(t.MaxTimeout, 0)) * time.Millisecond
+}
+
+// GetFailureWindow returns how long failures count towards the threshold (0 means forever)
+func (t ThresholdsConfig) GetFailureWindow() time.Duration {
+	switch {
+	case t.FailureWindowMs < 0:
+		return 0
+	case t.FailureWindowMs == 0:
+		return defaultFailureWindow
+	default:
+		return time.Duration(t.FailureWindowMs) * time.Millisecond
+	}
+}
+
+// ValidateErrorRates checks the error-rate breakers of the global and provider thresholds
+func (c *Config) ValidateErrorRates() error {
+	var errs []string
+	check := func(owner string, e *ErrorRateConfig) {
+		if e == nil {
+			return
+		}
+		if e.Percent < 0 || e.Percent >= 100 {
+			errs = append(errs, fmt.Sprintf(
+				"  %s error_rate percent %v must be between 0 and 100 (exclusive)", owner, e.Percent))
+		}
+		if e.Requests < 0 || e.MinRequests < 0 || e.WindowMs < 0 {
+			errs = append(errs, fmt.Sprintf(
+				"  %s error_rate values must not be negative", owner))
+		}
+	}
+
+	check("thresholds", c.Thresholds.ErrorRate)
+	for providerName, providerConfig := range c.Providers {
+		if providerConfig.Thresholds != nil {
+			check(fmt.Sprintf("provider %q thresholds", providerName), providerConfig.Thresholds.ErrorRate)
+		}
+	}
+	for modelName, modelConfig := range c.Models {
+		if modelConfig.Thresholds != nil {
+			check(fmt.Sprintf("model %q thresholds", modelName), modelConfig.Thresholds.ErrorRate)
+		}
+		for i, mp := range modelConfig.Providers {
+			if mp.Thresholds != nil {
+				check(fmt.Sprintf("model %q providers[%d] thresholds", modelName, i), mp.Thresholds.ErrorRate)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("error rate validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// ValidateThresholds checks that model and backend thresholds are in range and that the
+// models sharing a backend agree on its thresholds, as it has a single circuit breaker
+func (c *Config) ValidateThresholds() error {
+	var errs []string
+	check := func(owner string, t *ThresholdsConfig) {
+		if t != nil && (t.FailuresBeforeSwitch < 0 || t.InitialTimeout < 0 || t.MaxTimeout < 0 || t.CooldownMs < -1 || t.FailureWindowMs < -1) {
+			errs = append(errs, fmt.Sprintf("  %s thresholds must not be negative (except -1 for cooldown_ms and failure_window_ms)", owner))
+		}
+	}
+
+	for _, modelName := range slices.Sorted(maps.Keys(c.Models)) {
+		modelConfig := c.Models[modelName]
+		check(fmt.Sprintf("model %q", modelName), modelConfig.Thresholds)
+		for _, p := range modelConfig.Providers {
+			check(fmt.Sprintf("model %q backend %q", modelName, p.ToProviderModel()), p.Thresholds)
+			if modelConfig.Thresholds == nil && p.Thresholds == nil {
+				continue
+			}
+			shared, owner := c.backendThresholds(string(p.ToProviderModel()))
+			own := ThresholdsConfig{}.Merge(modelConfig.Thresholds).Merge(p.Thresholds)
+			if owner != modelName && !sameThresholds(own, *shared) {
+				errs = append(errs, fmt.Sprintf(
+					"  model %q backend %q thresholds differ from those of model %q (a backend has one circuit breaker, whichever model routes to it)",
+					modelName, p.ToProviderModel(), owner))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("thresholds validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// sameThresholds reports whether two thresholds have the same settings
+func sameThresholds(a, b ThresholdsConfig) bool {
+	if (a.ErrorRate == nil) != (b.ErrorRate == nil) || (a.ErrorRate != nil && *a.ErrorRate != *b.ErrorRate) {
+		return false
+	}
+	a.ErrorRate, b.ErrorRate = nil, nil
+	return a == b
+}
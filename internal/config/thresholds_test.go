@@ -0,0 +1,132 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetBackendThresholds(t *testing.T) {
+	cfg := &Config{
+		Thresholds: ThresholdsConfig{FailuresBeforeSwitch: 3, InitialTimeout: 10000, MaxTimeout: 300000},
+		Providers: map[string]ProviderConfig{
+			"free": {Thresholds: &ThresholdsConfig{FailuresBeforeSwitch: 1, CooldownMs: 120000}},
+			"paid": {},
+		},
+		Models: map[string]ModelConfig{
+			"chat": {
+				Thresholds: &ThresholdsConfig{FailureWindowMs: 30000},
+				Providers: []ModelProvider{
+					{Provider: "free", Model: "llama3"},
+					{Provider: "paid", Model: "gpt-4o", Thresholds: &ThresholdsConfig{FailuresBeforeSwitch: 10, ErrorRate: &ErrorRateConfig{Percent: 50}}},
+				},
+			},
+			"other": {Providers: []ModelProvider{{Provider: "free", Model: "qwen"}}},
+		},
+	}
+
+	tests := []struct {
+		backend string
+		want    ThresholdsConfig
+	}{
+		{backend: "free/llama3", want: ThresholdsConfig{FailuresBeforeSwitch: 1, InitialTimeout: 10000, MaxTimeout: 300000, CooldownMs: 120000, FailureWindowMs: 30000}},
+		{backend: "paid/gpt-4o", want: ThresholdsConfig{FailuresBeforeSwitch: 10, InitialTimeout: 10000, MaxTimeout: 300000, FailureWindowMs: 30000, ErrorRate: &ErrorRateConfig{Percent: 50}}},
+		{backend: "free/qwen", want: ThresholdsConfig{FailuresBeforeSwitch: 1, InitialTimeout: 10000, MaxTimeout: 300000, CooldownMs: 120000}},
+		{backend: "unknown/model", want: cfg.Thresholds},
+	}
+	for _, tt := range tests {
+		t.Run(tt.backend, func(t *testing.T) {
+			assert.Equal(t, tt.want, cfg.GetBackendThresholds(tt.backend))
+		})
+	}
+}
+
+func TestValidateThresholds(t *testing.T) {
+	tests := []struct {
+		name    string
+		models  map[string]ModelConfig
+		wantErr string
+	}{
+		{name: "not configured", models: map[string]ModelConfig{"a": {Providers: []ModelProvider{{Provider: "p", Model: "x"}}}}},
+		{
+			name: "shared backend with the same thresholds",
+			models: map[string]ModelConfig{
+				"a": {Thresholds: &ThresholdsConfig{FailuresBeforeSwitch: 1}, Providers: []ModelProvider{{Provider: "p", Model: "x"}}},
+				"b": {Providers: []ModelProvider{{Provider: "p", Model: "x", Thresholds: &ThresholdsConfig{FailuresBeforeSwitch: 1}}}},
+				"c": {Providers: []ModelProvider{{Provider: "p", Model: "x"}}},
+			},
+		},
+		{
+			name: "shared backend with different thresholds",
+			models: map[string]ModelConfig{
+				"a": {Thresholds: &ThresholdsConfig{FailuresBeforeSwitch: 1}, Providers: []ModelProvider{{Provider: "p", Model: "x"}}},
+				"b": {Providers: []ModelProvider{{Provider: "p", Model: "x", Thresholds: &ThresholdsConfig{FailuresBeforeSwitch: 5}}}},
+			},
+			wantErr: "model \"b\" backend \"p/x\" thresholds differ from those of model \"a\"",
+		},
+		{
+			name:    "negative model threshold",
+			models:  map[string]ModelConfig{"a": {Thresholds: &ThresholdsConfig{MaxTimeout: -1}, Providers: []ModelProvider{{Provider: "p", Model: "x"}}}},
+			wantErr: "model \"a\" thresholds must not be negative",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&Config{Models: tt.models}).ValidateThresholds()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestValidateErrorRates(t *testing.T) {
+	tests := []struct {
+		name     string
+		global   *ErrorRateConfig
+		provider *ErrorRateConfig
+		wantErr  string
+	}{
+		{name: "not configured"},
+		{name: "valid", global: &ErrorRateConfig{Percent: 50, Requests: 20, WindowMs: 60000}, provider: &ErrorRateConfig{Percent: 25}},
+		{name: "percent of 100", global: &ErrorRateConfig{Percent: 100}, wantErr: "between 0 and 100"},
+		{name: "negative provider sample", provider: &ErrorRateConfig{Percent: 50, Requests: -1}, wantErr: "provider \"p\" thresholds error_rate values"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Thresholds: ThresholdsConfig{ErrorRate: tt.global},
+				Providers:  map[string]ProviderConfig{"p": {Thresholds: &ThresholdsConfig{ErrorRate: tt.provider}}},
+			}
+			err := cfg.ValidateErrorRates()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+
+	var unset *ErrorRateConfig
+	assert.False(t, unset.IsEnabled())
+	assert.Equal(t, 20, unset.GetRequests())
+	assert.Equal(t, 10, unset.GetMinRequests())
+	assert.Equal(t, time.Minute, unset.GetWindow())
+	assert.Equal(t, 5, (&ErrorRateConfig{Requests: 5}).GetMinRequests(), "min requests never exceed the sample")
+}
+
+func TestThresholdsGetCooldown(t *testing.T) {
+	assert.Equal(t, 30*time.Second, ThresholdsConfig{}.GetCooldown())
+	assert.Equal(t, 5*time.Second, ThresholdsConfig{CooldownMs: 5000}.GetCooldown())
+	assert.Equal(t, time.Duration(0), ThresholdsConfig{CooldownMs: -1}.GetCooldown())
+	assert.Equal(t, 10*time.Second, ThresholdsConfig{InitialTimeout: 10000}.GetCooldown())
+	assert.Equal(t, 60*time.Second, ThresholdsConfig{}.GetFailureWindow())
+	assert.Equal(t, time.Duration(0), ThresholdsConfig{FailureWindowMs: -1}.GetFailureWindow())
+}
@@ -0,0 +1,90 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimeoutsConfig bounds a single backend attempt. An attempt that exceeds one of them is
+// abandoned as a timeout and the request fails over to the next backend. Zero (or unset)
+// leaves that phase bounded only by the HTTP client settings.
+type TimeoutsConfig struct {
+	ConnectMs    int `json:"connect_ms"`     // Establishing the connection to the backend
+	FirstTokenMs int `json:"first_token_ms"` // From sending a streaming request to its first content token
+	TotalMs      int `json:"total_ms"`       // Whole attempt, including reading the full response or stream
+}
+
+// GetConnect returns the connect timeout, or 0 when unbounded
+func (t TimeoutsConfig) GetConnect() time.Duration {
+	return time.Duration(max(t.ConnectMs, 0)) * time.Millisecond
+}
+
+// GetFirstToken returns the first-token timeout, or 0 when unbounded
+func (t TimeoutsConfig) GetFirstToken() time.Duration {
+	return time.Duration(max(t.FirstTokenMs, 0)) * time.Millisecond
+}
+
+// GetTotal returns the timeout of the whole attempt, or 0 when unbounded
+func (t TimeoutsConfig) GetTotal() time.Duration {
+	return time.Duration(max(t.TotalMs, 0)) * time.Millisecond
+}
+
+// BackendTimeouts returns the timeouts of one of the model's backends: each one the
+// backend sets, else the model's
+func (m ModelConfig) BackendTimeouts(mp ModelProvider) TimeoutsConfig {
+	var t TimeoutsConfig
+	if m.Timeouts != nil {
+		t = *m.Timeouts
+	}
+	if o := mp.Timeouts; o != nil {
+		if o.ConnectMs > 0 {
+			t.ConnectMs = o.ConnectMs
+		}
+		if o.FirstTokenMs > 0 {
+			t.FirstTokenMs = o.FirstTokenMs
+		}
+		if o.TotalMs > 0 {
+			t.TotalMs = o.TotalMs
+		}
+	}
+	return t
+}
+
+// ValidateTimeouts checks that model and backend timeouts are not negative
+func (c *Config) ValidateTimeouts() error {
+	var errs []string
+	check := func(owner string, t *TimeoutsConfig) {
+		if t != nil && (t.ConnectMs < 0 || t.FirstTokenMs < 0 || t.TotalMs < 0) {
+			errs = append(errs, fmt.Sprintf("  %s timeouts must not be negative", owner))
+		}
+	}
+
+	for modelName, modelConfig := range c.Models {
+		check(fmt.Sprintf("model %q", modelName), modelConfig.Timeouts)
+		for _, p := range modelConfig.Providers {
+			check(fmt.Sprintf("model %q backend %q", modelName, p.ToProviderModel()), p.Timeouts)
+		}
+	}
+
+	server := c.Server
+	if server.ReadTimeoutMs < -1 || server.WriteTimeoutMs < -1 || server.StreamWriteTimeoutMs < -1 {
+		errs = append(errs, "  server read, write and stream write timeouts must not be negative (except -1 to disable them)")
+	}
+	if server.IdleTimeoutMs < 0 {
+		errs = append(errs, "  server idle_timeout_ms must not be negative")
+	}
+	if server.MaxHeaderBytes < 0 {
+		errs = append(errs, "  server max_header_bytes must not be negative")
+	}
+	if c.ConfigRefreshMs < -1 {
+		errs = append(errs, "  config_refresh_ms must not be negative (except -1 to disable it)")
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("timeouts validation failed:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
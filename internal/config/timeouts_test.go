@@ -0,0 +1,44 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTimeouts(t *testing.T) {
+	tests := []struct {
+		name    string
+		model   *TimeoutsConfig
+		backend *TimeoutsConfig
+		server  ServerConfig
+		wantErr string
+	}{
+		{name: "not configured"},
+		{name: "valid", model: &TimeoutsConfig{ConnectMs: 1000, TotalMs: 30000}, backend: &TimeoutsConfig{FirstTokenMs: 500}},
+		{name: "negative model timeout", model: &TimeoutsConfig{TotalMs: -1}, wantErr: "model \"m\" timeouts"},
+		{name: "negative backend timeout", backend: &TimeoutsConfig{ConnectMs: -5}, wantErr: "backend \"p/x\" timeouts"},
+		{name: "disabled server timeouts", server: ServerConfig{ReadTimeoutMs: -1, WriteTimeoutMs: -1, StreamWriteTimeoutMs: -1}},
+		{name: "negative server timeout", server: ServerConfig{WriteTimeoutMs: -2}, wantErr: "server read, write and stream write timeouts"},
+		{name: "negative idle timeout", server: ServerConfig{IdleTimeoutMs: -1}, wantErr: "server idle_timeout_ms"},
+		{name: "negative max header bytes", server: ServerConfig{MaxHeaderBytes: -1}, wantErr: "server max_header_bytes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Server: tt.server, Models: map[string]ModelConfig{"m": {
+				Timeouts:  tt.model,
+				Providers: []ModelProvider{{Provider: "p", Model: "x", Timeouts: tt.backend}},
+			}}}
+			err := cfg.ValidateTimeouts()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+
+	assert.Equal(t, TimeoutsConfig{}, ModelConfig{}.BackendTimeouts(ModelProvider{}))
+}
@@ -0,0 +1,88 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"cmp"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// TracingConfig holds settings for OpenTelemetry tracing (requires restart). Each request
+// is traced with a span per backend attempt, exported over OTLP/HTTP in JSON.
+type TracingConfig struct {
+	Enabled bool `json:"enabled"`
+	// Endpoint is the collector's OTLP/HTTP base URL, to which /v1/traces is added
+	// (default OTEL_EXPORTER_OTLP_ENDPOINT, then http://localhost:4318)
+	Endpoint string `json:"endpoint,omitempty"`
+	// Headers are added to export requests, e.g. the API key of a hosted collector
+	// (values support ${VAR} expansion)
+	Headers map[string]string `json:"headers,omitempty"`
+	// ServiceName is the service.name of the spans (default OTEL_SERVICE_NAME, then "openmodel")
+	ServiceName string `json:"service_name,omitempty"`
+	// SampleRatio is the share of new traces recorded, from 0 to 1 (default 1). Requests
+	// with a traceparent header follow its sampled flag.
+	SampleRatio *float64 `json:"sample_ratio,omitempty"`
+}
+
+// defaultOTLPEndpoint is where an OpenTelemetry collector receives OTLP/HTTP by default
+const defaultOTLPEndpoint = "http://localhost:4318"
+
+// IsEnabled reports whether traces are exported
+func (t *TracingConfig) IsEnabled() bool {
+	return t != nil && t.Enabled
+}
+
+// GetTracesURL returns the URL spans are posted to. OTEL_EXPORTER_OTLP_TRACES_ENDPOINT,
+// when set, is used as is, like other OpenTelemetry exporters do.
+func (t *TracingConfig) GetTracesURL() string {
+	endpoint := expandEnvVars(t.Endpoint)
+	if endpoint == "" {
+		if traces := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); traces != "" {
+			return traces
+		}
+		endpoint = cmp.Or(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), defaultOTLPEndpoint)
+	}
+	return strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+}
+
+// GetHeaders returns the export request headers with environment variables expanded
+func (t *TracingConfig) GetHeaders() map[string]string {
+	headers := make(map[string]string, len(t.Headers))
+	for key, value := range t.Headers {
+		headers[key] = expandEnvVars(value)
+	}
+	return headers
+}
+
+// GetServiceName returns the service.name of the spans
+func (t *TracingConfig) GetServiceName() string {
+	return cmp.Or(t.ServiceName, os.Getenv("OTEL_SERVICE_NAME"), "openmodel")
+}
+
+// GetSampleRatio returns the share of new traces recorded
+func (t *TracingConfig) GetSampleRatio() float64 {
+	if t.SampleRatio == nil {
+		return 1
+	}
+	return *t.SampleRatio
+}
+
+// ValidateTracing checks that enabled tracing has a usable collector URL and sample ratio
+func (c *Config) ValidateTracing() error {
+	if !c.Tracing.IsEnabled() {
+		return nil
+	}
+	var errs []string
+	if u, err := url.Parse(c.Tracing.GetTracesURL()); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Sprintf("  endpoint %q must be an http:// or https:// URL", c.Tracing.GetTracesURL()))
+	}
+	if ratio := c.Tracing.GetSampleRatio(); ratio < 0 || ratio > 1 {
+		errs = append(errs, fmt.Sprintf("  sample_ratio %g must be between 0 and 1", ratio))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("tracing validation failed:\n%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracingConfig(t *testing.T) {
+	half, tooMuch := 0.5, 1.5
+	tests := []struct {
+		name        string
+		tracing     TracingConfig
+		env         map[string]string
+		wantURL     string
+		wantService string
+		wantErr     []string
+	}{
+		{name: "defaults", tracing: TracingConfig{Enabled: true}, wantURL: "http://localhost:4318/v1/traces", wantService: "openmodel"},
+		{name: "configured", tracing: TracingConfig{Enabled: true, Endpoint: "https://otlp.example.com/", ServiceName: "gateway", SampleRatio: &half},
+			env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318", "OTEL_SERVICE_NAME": "other"}, wantURL: "https://otlp.example.com/v1/traces", wantService: "gateway"},
+		{name: "otel env", tracing: TracingConfig{Enabled: true}, env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318", "OTEL_SERVICE_NAME": "gw"},
+			wantURL: "http://collector:4318/v1/traces", wantService: "gw"},
+		{name: "otel traces env", tracing: TracingConfig{Enabled: true}, env: map[string]string{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "http://collector:4318/custom"},
+			wantURL: "http://collector:4318/custom", wantService: "openmodel"},
+		{name: "invalid", tracing: TracingConfig{Enabled: true, Endpoint: "collector:4317", SampleRatio: &tooMuch}, wantURL: "collector:4317/v1/traces", wantService: "openmodel",
+			wantErr: []string{`endpoint "collector:4317/v1/traces"`, "sample_ratio 1.5"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTEL_SERVICE_NAME"} {
+				t.Setenv(name, tt.env[name])
+			}
+			assert.Equal(t, tt.wantURL, tt.tracing.GetTracesURL())
+			assert.Equal(t, tt.wantService, tt.tracing.GetServiceName())
+			err := (&Config{Tracing: &tt.tracing}).ValidateTracing()
+			if len(tt.wantErr) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				for _, want := range tt.wantErr {
+					assert.Contains(t, err.Error(), want)
+				}
+			}
+		})
+	}
+}
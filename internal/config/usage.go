@@ -0,0 +1,32 @@
+// Package config handles JSON configuration loading
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// UsageConfig holds settings for token usage accounting (requires restart). The tokens of
+// each request are added up by day, model, backend and API key in a SQLite database,
+// reported at /admin/usage.
+type UsageConfig struct {
+	Enabled bool   `json:"enabled"`
+	Path    string `json:"path,omitempty"` // SQLite database file (supports ${VAR} expansion; default ~/.config/openmodel/usage.db)
+}
+
+// IsEnabled reports whether usage is recorded
+func (u *UsageConfig) IsEnabled() bool {
+	return u != nil && u.Enabled
+}
+
+// GetPath returns the database file with environment variables expanded
+func (u *UsageConfig) GetPath() string {
+	if path := expandEnvVars(u.Path); path != "" {
+		return path
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "usage.db"
+	}
+	return filepath.Join(homeDir, ".config", "openmodel", "usage.db")
+}
@@ -0,0 +1,25 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsageConfig_GetPath(t *testing.T) {
+	t.Setenv("HOME", "/home/op")
+	t.Setenv("USAGE_DIR", "/var/lib/openmodel")
+	tests := []struct {
+		name  string
+		usage UsageConfig
+		want  string
+	}{
+		{name: "default", usage: UsageConfig{Enabled: true}, want: "/home/op/.config/openmodel/usage.db"},
+		{name: "configured", usage: UsageConfig{Enabled: true, Path: "${USAGE_DIR}/usage.db"}, want: "/var/lib/openmodel/usage.db"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.usage.GetPath())
+		})
+	}
+}
@@ -2,12 +2,20 @@
 package config
 
 import (
+	"bytes"
+	"os"
+	"path/filepath"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 )
 
+// watchDebounce is how long the watcher waits for a burst of file events to settle
+// before reloading, so an editor's save triggers a single reload
+const watchDebounce = 100 * time.Millisecond
+
 // Watcher watches for config file changes
 type Watcher struct {
 	configPath string
@@ -17,19 +25,30 @@ type Watcher struct {
 	stopCh     chan struct{}
 	stopOnce   sync.Once
 	running    atomic.Bool
+	debounce   time.Duration
+	// files are the config file and those it includes; dirs are the directories watched
+	files map[string]bool
+	dirs  map[string]bool
+	// lastContent is the content of the files last handled, so rewrites that change
+	// nothing do not reload
+	lastContent []byte
 }
 
 // NewWatcher creates a new config watcher
 // The callback receives the new config and any validation error
 func NewWatcher(configPath string, callback func(*Config, error)) *Watcher {
 	return &Watcher{
-		configPath: configPath,
+		configPath: filepath.Clean(configPath),
 		callback:   callback,
 		stopCh:     make(chan struct{}),
+		debounce:   watchDebounce,
 	}
 }
 
-// Start begins watching for config file changes
+// Start begins watching for config file changes, including the files it includes and
+// those of its config.d directory. Directories are watched rather than files, so saves
+// that replace a file (write to a temporary file, then rename it into place) are seen
+// as well.
 func (w *Watcher) Start() error {
 	if w.running.Load() {
 		return nil
@@ -42,38 +61,107 @@ func (w *Watcher) Start() error {
 		return nil
 	}
 
+	files, content, err := w.snapshot()
+	if err != nil {
+		return err
+	}
+
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return err
 	}
 
-	if err := watcher.Add(w.configPath); err != nil {
+	if err := watcher.Add(filepath.Dir(w.configPath)); err != nil {
 		watcher.Close()
 		return err
 	}
 
 	w.watcher = watcher
+	w.dirs = map[string]bool{filepath.Dir(w.configPath): true}
+	w.watchFiles(files)
+	w.lastContent = content
 	w.running.Store(true)
 
-	go w.watchLoop()
+	go w.watchLoop(watcher)
 
 	return nil
 }
 
-// watchLoop handles file system events
-func (w *Watcher) watchLoop() {
+// includeDir returns the config.d directory beside the config file
+func (w *Watcher) includeDir() string {
+	return filepath.Join(filepath.Dir(w.configPath), includeDirName)
+}
+
+// snapshot lists the config files and reads their content. When the includes cannot be
+// resolved only the config file is read, so loading it reports why.
+func (w *Watcher) snapshot() (map[string]bool, []byte, error) {
+	paths, err := configFiles(w.configPath)
+	if err != nil {
+		paths = []string{w.configPath}
+	}
+	files := make(map[string]bool, len(paths))
+	var content bytes.Buffer
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		files[filepath.Clean(path)] = true
+		content.WriteString(path + "\x00")
+		content.Write(data)
+		content.WriteByte(0)
+	}
+	return files, content.Bytes(), nil
+}
+
+// watchFiles watches the directories of the config files and the config.d directory,
+// when it exists. Directories that cannot be watched are skipped: their files are
+// still reloaded with the config file.
+func (w *Watcher) watchFiles(files map[string]bool) {
+	w.files = files
+	dirs := []string{w.includeDir()}
+	for path := range files {
+		dirs = append(dirs, filepath.Dir(path))
+	}
+	for _, dir := range dirs {
+		if !w.dirs[dir] && w.watcher.Add(dir) == nil {
+			w.dirs[dir] = true
+		}
+	}
+}
+
+// relevant reports whether an event concerns the config
+func (w *Watcher) relevant(event fsnotify.Event) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	path := filepath.Clean(event.Name)
+	if path == w.configPath {
+		return event.Has(fsnotify.Write | fsnotify.Create)
+	}
+	return w.files[path] || (filepath.Dir(path) == w.includeDir() && filepath.Ext(path) == ".json")
+}
+
+// watchLoop handles the file system events of watcher, reloading once the events on the
+// config files have settled. A restarted Watcher has a new watcher and loop.
+func (w *Watcher) watchLoop(watcher *fsnotify.Watcher) {
+	var settled <-chan time.Time
 	for {
 		select {
 		case <-w.stopCh:
 			return
-		case event, ok := <-w.watcher.Events:
+		case event, ok := <-watcher.Events:
 			if !ok {
 				return
 			}
-			if event.Has(fsnotify.Write) {
+			if w.relevant(event) {
+				settled = time.After(w.debounce)
+			}
+		case <-settled:
+			settled = nil
+			if w.contentChanged() {
 				w.handleConfigChange()
 			}
-		case _, ok := <-w.watcher.Errors:
+		case _, ok := <-watcher.Errors:
 			if !ok {
 				return
 			}
@@ -81,6 +169,20 @@ func (w *Watcher) watchLoop() {
 	}
 }
 
+// contentChanged reports whether the config files differ from the content last handled.
+// A config file missing mid-replace is left for the event that recreates it.
+func (w *Watcher) contentChanged() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	files, content, err := w.snapshot()
+	if err != nil || bytes.Equal(content, w.lastContent) {
+		return false
+	}
+	w.watchFiles(files)
+	w.lastContent = content
+	return true
+}
+
 // handleConfigChange loads and validates the new config, then calls callback
 func (w *Watcher) handleConfigChange() {
 	cfg, err := Load(w.configPath)
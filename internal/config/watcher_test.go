@@ -1,11 +1,14 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -214,3 +217,80 @@ func TestWatcherNonExistentFile(t *testing.T) {
 	// Suppress unused warning
 	_ = callbackErr
 }
+
+func TestWatcherReloadsOnSave(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.json")
+	configContent := func(port int) string {
+		return fmt.Sprintf(`{%s "server": {"port": %d, "host": "localhost"}, "providers": {}, "models": {}}`, testConfigSchema, port)
+	}
+	require.NoError(t, os.WriteFile(configPath, []byte(configContent(12345)), 0644))
+
+	var callbackMu sync.Mutex
+	var ports []int
+	watcher := NewWatcher(configPath, func(cfg *Config, err error) {
+		callbackMu.Lock()
+		defer callbackMu.Unlock()
+		if assert.NoError(t, err) {
+			ports = append(ports, cfg.Server.Port)
+		}
+	})
+	watcher.debounce = 20 * time.Millisecond
+	require.NoError(t, watcher.Start())
+	defer watcher.Stop()
+	reloaded := func() []int {
+		callbackMu.Lock()
+		defer callbackMu.Unlock()
+		return append([]int(nil), ports...)
+	}
+
+	// Rewriting the same content does not reload
+	require.NoError(t, os.WriteFile(configPath, []byte(configContent(12345)), 0644))
+	time.Sleep(100 * time.Millisecond)
+	assert.Empty(t, reloaded())
+
+	// An in-place write and a save that renames a new file into place both reload once
+	require.NoError(t, os.WriteFile(configPath, []byte(configContent(12346)), 0644))
+	assert.Eventually(t, func() bool { return len(reloaded()) == 1 }, 2*time.Second, 10*time.Millisecond)
+
+	tmpPath := filepath.Join(tmpDir, ".config.json.tmp")
+	require.NoError(t, os.WriteFile(tmpPath, []byte(configContent(12347)), 0644))
+	require.NoError(t, os.Rename(tmpPath, configPath))
+	assert.Eventually(t, func() bool { return len(reloaded()) == 2 }, 2*time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, []int{12346, 12347}, reloaded())
+}
+
+func TestWatcherReloadsOnIncludedFileChange(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.json")
+	require.NoError(t, os.WriteFile(configPath, []byte(`{"server": {"port": 12345, "host": "localhost"}, "providers": {}, "models": {}}`), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(tmpDir, "config.d"), 0755))
+
+	var callbackMu sync.Mutex
+	var hasOllama []bool
+	watcher := NewWatcher(configPath, func(cfg *Config, err error) {
+		callbackMu.Lock()
+		defer callbackMu.Unlock()
+		if assert.NoError(t, err) {
+			_, ok := cfg.Providers["ollama"]
+			hasOllama = append(hasOllama, ok)
+		}
+	})
+	watcher.debounce = 20 * time.Millisecond
+	require.NoError(t, watcher.Start())
+	defer watcher.Stop()
+	reloaded := func() []bool {
+		callbackMu.Lock()
+		defer callbackMu.Unlock()
+		return slices.Clone(hasOllama)
+	}
+
+	// Adding, then removing a config.d file reloads each time
+	fragmentPath := filepath.Join(tmpDir, "config.d", "ollama.json")
+	require.NoError(t, os.WriteFile(fragmentPath, []byte(`{"providers": {"ollama": {"url": "http://localhost:11434/v1"}}}`), 0644))
+	assert.Eventually(t, func() bool { return len(reloaded()) == 1 }, 2*time.Second, 10*time.Millisecond)
+	require.NoError(t, os.Remove(fragmentPath))
+	assert.Eventually(t, func() bool { return len(reloaded()) == 2 }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []bool{true, false}, reloaded())
+}
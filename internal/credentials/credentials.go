@@ -0,0 +1,241 @@
+// Package credentials fetches secrets such as provider API keys from files, commands and
+// secret managers, refreshing them periodically
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/macedot/openmodel/internal/logger"
+)
+
+// fetchTimeout bounds fetching a secret once
+const fetchTimeout = 30 * time.Second
+
+// defaultVaultField is the field read from a Vault secret when the path names none
+const defaultVaultField = "api_key"
+
+// vaultClient is the HTTP client of Vault requests
+var vaultClient = &http.Client{Timeout: fetchTimeout}
+
+// Source says where a secret comes from. Exactly one of File, Command, Vault, AWSSecret
+// and GCPSecret is set.
+type Source struct {
+	File      string   // File holding the secret
+	Command   []string // Command printing the secret on stdout
+	Vault     string   // HashiCorp Vault KV path, "path#field" (VAULT_ADDR, VAULT_TOKEN)
+	AWSSecret string   // AWS Secrets Manager secret id, "id#field" for JSON secrets (aws CLI)
+	GCPSecret string   // GCP Secret Manager secret name or resource name (gcloud CLI)
+	Refresh   time.Duration
+}
+
+// String describes the source without revealing the secret
+func (s Source) String() string {
+	switch {
+	case s.File != "":
+		return "file " + s.File
+	case len(s.Command) > 0:
+		return "command " + s.Command[0]
+	case s.Vault != "":
+		return "vault " + s.Vault
+	case s.AWSSecret != "":
+		return "aws_secret " + s.AWSSecret
+	case s.GCPSecret != "":
+		return "gcp_secret " + s.GCPSecret
+	}
+	return "none"
+}
+
+// Secret is a secret fetched from a Source. Value returns the last fetched value and,
+// once it is older than the refresh interval, refetches it in the background; a failed
+// refresh keeps the previous value.
+type Secret struct {
+	source     Source
+	value      atomic.Pointer[string]
+	fetchedAt  atomic.Int64 // Unix nanoseconds
+	refreshing atomic.Bool
+}
+
+// Load fetches a secret, failing when the first fetch does
+func Load(ctx context.Context, source Source) (*Secret, error) {
+	s := &Secret{source: source}
+	value, err := fetch(ctx, source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch secret from %s: %w", source, err)
+	}
+	s.store(value)
+	return s, nil
+}
+
+// Value returns the secret
+func (s *Secret) Value() string {
+	if s.source.Refresh > 0 && time.Since(time.Unix(0, s.fetchedAt.Load())) >= s.source.Refresh &&
+		s.refreshing.CompareAndSwap(false, true) {
+		go s.refresh()
+	}
+	return *s.value.Load()
+}
+
+// refresh refetches the secret, keeping the previous value on failure
+func (s *Secret) refresh() {
+	defer s.refreshing.Store(false)
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	value, err := fetch(ctx, s.source)
+	if err != nil {
+		logger.Warn("credential_refresh_failed", "source", s.source.String(), "error", err)
+		// Retry after another interval rather than on every request
+		s.fetchedAt.Store(time.Now().UnixNano())
+		return
+	}
+	s.store(value)
+}
+
+// store records a freshly fetched value, which logs and errors then mask
+func (s *Secret) store(value string) {
+	logger.SetSecrets("credential "+s.source.String(), value)
+	s.value.Store(&value)
+	s.fetchedAt.Store(time.Now().UnixNano())
+}
+
+// fetch reads the secret from its source, trimming surrounding whitespace
+func fetch(ctx context.Context, source Source) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	var (
+		value string
+		err   error
+	)
+	switch {
+	case source.File != "":
+		var data []byte
+		data, err = os.ReadFile(source.File)
+		value = string(data)
+	case len(source.Command) > 0:
+		value, err = run(ctx, source.Command)
+	case source.Vault != "":
+		value, err = fetchVault(ctx, source.Vault)
+	case source.AWSSecret != "":
+		id, field, _ := strings.Cut(source.AWSSecret, "#")
+		value, err = run(ctx, []string{"aws", "secretsmanager", "get-secret-value", "--secret-id", id, "--query", "SecretString", "--output", "text"})
+		if err == nil && field != "" {
+			value, err = jsonField([]byte(value), field)
+		}
+	case source.GCPSecret != "":
+		value, err = run(ctx, gcloudArgs(source.GCPSecret))
+	default:
+		return "", errors.New("no source configured")
+	}
+	if err != nil {
+		return "", err
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", errors.New("secret is empty")
+	}
+	return value, nil
+}
+
+// run runs a command (name and arguments) and returns its stdout
+func run(ctx context.Context, command []string) (string, error) {
+	name := command[0]
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, command[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: %w: %s", name, err, msg)
+		}
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	return stdout.String(), nil
+}
+
+// gcloudArgs returns the gcloud command reading the latest version of a secret, or the
+// version a resource name (projects/P/secrets/S[/versions/V]) names
+func gcloudArgs(secret string) []string {
+	args := []string{"gcloud", "secrets", "versions", "access"}
+	parts := strings.Split(secret, "/")
+	if len(parts) >= 4 && parts[0] == "projects" && parts[2] == "secrets" {
+		version := "latest"
+		if len(parts) == 6 && parts[4] == "versions" {
+			version = parts[5]
+		}
+		return append(args, version, "--secret="+parts[3], "--project="+parts[1])
+	}
+	return append(args, "latest", "--secret="+secret)
+}
+
+// fetchVault reads a field of a Vault KV secret (v1 or v2) over the HTTP API
+func fetchVault(ctx context.Context, pathField string) (string, error) {
+	addr := strings.TrimSuffix(os.Getenv("VAULT_ADDR"), "/")
+	if addr == "" {
+		return "", errors.New("VAULT_ADDR is not set")
+	}
+	path, field, _ := strings.Cut(pathField, "#")
+	if field == "" {
+		field = defaultVaultField
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", os.Getenv("VAULT_TOKEN"))
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	resp, err := vaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned status %d", resp.StatusCode)
+	}
+
+	var secret struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return "", fmt.Errorf("failed to decode vault response: %w", err)
+	}
+	// KV v2 nests the secret under data.data, next to its metadata
+	var kv2 struct {
+		Data     json.RawMessage `json:"data"`
+		Metadata json.RawMessage `json:"metadata"`
+	}
+	if json.Unmarshal(secret.Data, &kv2) == nil && kv2.Data != nil && kv2.Metadata != nil {
+		return jsonField(kv2.Data, field)
+	}
+	return jsonField(secret.Data, field)
+}
+
+// jsonField returns a string field of a JSON object
+func jsonField(data []byte, field string) (string, error) {
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return "", errors.New("secret is not a JSON object")
+	}
+	value, ok := fields[field].(string)
+	if !ok {
+		return "", fmt.Errorf("secret has no string field %q", field)
+	}
+	return value, nil
+}
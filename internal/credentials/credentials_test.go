@@ -0,0 +1,108 @@
+package credentials
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestLoad_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key")
+	require.NoError(t, os.WriteFile(path, []byte("sk-file\n"), 0o600))
+
+	secret, err := Load(context.Background(), Source{File: path})
+	require.NoError(t, err)
+	assert.Equal(t, "sk-file", secret.Value())
+
+	_, err = Load(context.Background(), Source{File: filepath.Join(t.TempDir(), "missing")})
+	assert.ErrorContains(t, err, "failed to fetch secret from file")
+}
+
+func TestLoad_Command(t *testing.T) {
+	secret, err := Load(context.Background(), Source{Command: []string{"sh", "-c", "echo sk-command"}})
+	require.NoError(t, err)
+	assert.Equal(t, "sk-command", secret.Value())
+
+	_, err = Load(context.Background(), Source{Command: []string{"sh", "-c", "echo denied >&2; exit 3"}})
+	assert.ErrorContains(t, err, "denied")
+
+	_, err = Load(context.Background(), Source{Command: []string{"true"}})
+	assert.ErrorContains(t, err, "secret is empty")
+}
+
+func TestSecret_Refresh(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key")
+	require.NoError(t, os.WriteFile(path, []byte("old"), 0o600))
+
+	secret, err := Load(context.Background(), Source{File: path, Refresh: 10 * time.Millisecond})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, []byte("new"), 0o600))
+	time.Sleep(20 * time.Millisecond)
+
+	assert.Equal(t, "old", secret.Value(), "a stale value is served while refreshing")
+	assert.Eventually(t, func() bool { return secret.Value() == "new" }, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, os.Remove(path))
+	time.Sleep(20 * time.Millisecond)
+	secret.Value()
+	assert.Eventually(t, func() bool { return !secret.refreshing.Load() }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "new", secret.Value(), "a failed refresh keeps the previous value")
+}
+
+func TestLoad_Vault(t *testing.T) {
+	t.Setenv("VAULT_ADDR", "https://vault.internal:8200/")
+	t.Setenv("VAULT_TOKEN", "s.token")
+	defer func(c *http.Client) { vaultClient = c }(vaultClient)
+
+	responses := map[string]string{
+		"/v1/secret/data/openmodel": `{"data":{"data":{"api_key":"sk-v2","other":"x"},"metadata":{"version":3}}}`,
+		"/v1/kv/openmodel":          `{"data":{"openai":"sk-v1"}}`,
+	}
+	vaultClient = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		assert.Equal(t, "s.token", r.Header.Get("X-Vault-Token"))
+		body, ok := responses[r.URL.Path]
+		status := http.StatusOK
+		if !ok {
+			status = http.StatusNotFound
+		}
+		return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(body)), Header: http.Header{}}, nil
+	})}
+
+	secret, err := Load(context.Background(), Source{Vault: "secret/data/openmodel"})
+	require.NoError(t, err)
+	assert.Equal(t, "sk-v2", secret.Value())
+
+	secret, err = Load(context.Background(), Source{Vault: "kv/openmodel#openai"})
+	require.NoError(t, err)
+	assert.Equal(t, "sk-v1", secret.Value())
+
+	_, err = Load(context.Background(), Source{Vault: "kv/openmodel#missing"})
+	assert.ErrorContains(t, err, `no string field "missing"`)
+	_, err = Load(context.Background(), Source{Vault: "kv/unknown"})
+	assert.ErrorContains(t, err, "status 404")
+}
+
+func TestGcloudArgs(t *testing.T) {
+	assert.Equal(t, []string{"gcloud", "secrets", "versions", "access", "latest", "--secret=openai-key"}, gcloudArgs("openai-key"))
+	assert.Equal(t, []string{"gcloud", "secrets", "versions", "access", "latest", "--secret=openai-key", "--project=acme"},
+		gcloudArgs("projects/acme/secrets/openai-key"))
+	assert.Equal(t, []string{"gcloud", "secrets", "versions", "access", "7", "--secret=openai-key", "--project=acme"},
+		gcloudArgs("projects/acme/secrets/openai-key/versions/7"))
+}
+
+func TestSource_String(t *testing.T) {
+	assert.Equal(t, "command op", Source{Command: []string{"op", "read", "op://vault/openai/key"}}.String())
+	assert.Equal(t, "aws_secret prod/openai#key", Source{AWSSecret: "prod/openai#key"}.String())
+}
@@ -8,6 +8,9 @@ const (
 	V1Models          = "/v1/models"
 	V1Embeddings      = "/v1/embeddings"
 	V1Moderations     = "/v1/moderations"
+
+	V1AudioTranscriptions = "/v1/audio/transcriptions"
+	V1AudioSpeech         = "/v1/audio/speech"
 )
 
 // Anthropic endpoints (Claude API paths)
@@ -15,8 +18,53 @@ const (
 	V1Messages = "/v1/messages"
 )
 
+// Cohere endpoints (Cohere v2 API paths, used by the native Cohere provider)
+const (
+	V2Chat  = "/v2/chat"
+	V2Embed = "/v2/embed"
+)
+
+// TGI endpoints (HuggingFace Text Generation Inference native API, used by the TGI provider)
+const (
+	TGIGenerate       = "/generate"
+	TGIGenerateStream = "/generate_stream"
+)
+
+// WebSocket endpoints
+const (
+	WSV1Chat = "/ws/v1/chat"
+)
+
+// Ollama model management endpoints (forwarded to the managed backend)
+const (
+	APICreate = "/api/create"
+	APICopy   = "/api/copy"
+	APIDelete = "/api/delete"
+)
+
+// Admin endpoints (runtime administration, disabled unless configured)
+const (
+	AdminWeights  = "/admin/weights"
+	AdminSpend    = "/admin/spend"
+	AdminUsage    = "/admin/usage"
+	AdminKeys     = "/admin/keys"
+	AdminQuotas   = "/admin/quotas"
+	AdminDrain    = "/admin/drain"
+	AdminReload   = "/admin/reload"
+	AdminConfig   = "/admin/config"
+	AdminBackends = "/admin/backends"
+	AdminState    = "/admin/state"
+	AdminPprof    = "/admin/debug/pprof"
+	AdminRuntime  = "/admin/debug/runtime"
+)
+
 // Internal endpoints (server routes)
 const (
-	Root   = "/"
-	Health = "/health"
+	Root    = "/"
+	Health  = "/health"
+	Healthz = "/healthz" // Liveness probe
+	Readyz  = "/readyz"  // Readiness probe
+	OpenAPI = "/openapi.json"
+	Docs    = "/docs"
+	Metrics = "/metrics"
 )
@@ -0,0 +1,186 @@
+// Package eventsink publishes a usage event per completed request to Kafka, NATS or a
+// webhook, for billing and analytics pipelines downstream
+package eventsink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	applogger "github.com/macedot/openmodel/internal/logger"
+)
+
+// Destinations events are published to
+const (
+	TypeKafka   = "kafka"
+	TypeNATS    = "nats"
+	TypeWebhook = "webhook"
+)
+
+// Publish batching: events are sent once a batch is full or the interval has passed.
+// Events beyond the queue size are dropped rather than slowing requests down.
+const (
+	publishBatchSize = 100
+	publishInterval  = time.Second
+	publishQueueSize = 4096
+	publishTimeout   = 10 * time.Second
+	dialTimeout      = 5 * time.Second
+)
+
+// Config configures a sink
+type Config struct {
+	Type     string   // TypeKafka, TypeNATS or TypeWebhook
+	Brokers  []string // Kafka bootstrap brokers, host:port
+	URL      string   // NATS server, nats://[user:pass@]host:port, tls:// for TLS, or webhook URL
+	Token    string   // NATS token, or bearer token sent to the webhook
+	Topic    string   // Kafka topic or NATS subject
+	TLS      bool     // Connect to the Kafka brokers over TLS
+	Username string   // Kafka SASL/PLAIN username
+	Password string   // Kafka SASL/PLAIN password
+}
+
+// Event is one completed request
+type Event struct {
+	Time             time.Time `json:"time"`
+	RequestID        string    `json:"request_id,omitempty"`
+	Endpoint         string    `json:"endpoint"`
+	Model            string    `json:"model,omitempty"`
+	Backend          string    `json:"backend,omitempty"` // "provider/model" that served
+	KeyID            string    `json:"key_id,omitempty"`  // Id of the client's API key
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	TotalTokens      int       `json:"total_tokens"`
+	Cost             float64   `json:"cost,omitempty"`
+	LatencyMs        int64     `json:"latency_ms"`
+	Status           int       `json:"status"`
+	Stream           bool      `json:"stream"`
+}
+
+// message is an encoded event; key partitions Kafka topics
+type message struct {
+	key, value []byte
+}
+
+// publisher sends a batch of messages to the broker
+type publisher interface {
+	publish(ctx context.Context, msgs []message) error
+	close() error
+}
+
+// Sink publishes events in batches in the background. Its methods do nothing on a nil sink.
+type Sink struct {
+	cfg Config
+	pub publisher
+
+	queue    chan message
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// New creates a sink and starts its publish loop. Connections are opened on the first
+// publish.
+func New(cfg Config) (*Sink, error) {
+	s := &Sink{
+		cfg:   cfg,
+		queue: make(chan message, publishQueueSize),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	var err error
+	switch cfg.Type {
+	case TypeKafka:
+		s.pub, err = newKafkaPublisher(cfg)
+	case TypeNATS:
+		s.pub, err = newNATSPublisher(cfg)
+	case TypeWebhook:
+		s.pub, err = newWebhookPublisher(cfg)
+	default:
+		err = fmt.Errorf("unknown sink type %q", cfg.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	go s.loop()
+	return s, nil
+}
+
+// Publish queues an event, dropping it when the queue is full
+func (s *Sink) Publish(e Event) {
+	if s == nil {
+		return
+	}
+	value, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	select {
+	case s.queue <- message{key: []byte(e.Model), value: value}:
+	default:
+		applogger.Debug("event_sink_dropped", "request_id", e.RequestID)
+	}
+}
+
+// Shutdown publishes the events still queued and closes the connections, waiting until
+// ctx is done at most
+func (s *Sink) Shutdown(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	s.stopOnce.Do(func() { close(s.stop) })
+	select {
+	case <-s.done:
+		return s.pub.close()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// loop publishes queued events in batches until the sink is shut down
+func (s *Sink) loop() {
+	defer close(s.done)
+	ticker := time.NewTicker(publishInterval)
+	defer ticker.Stop()
+	var batch []message
+	send := func() {
+		if len(batch) > 0 {
+			s.publish(batch)
+			batch = nil
+		}
+	}
+	for {
+		select {
+		case m := <-s.queue:
+			batch = append(batch, m)
+			if len(batch) >= publishBatchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case <-s.stop:
+			for {
+				select {
+				case m := <-s.queue:
+					batch = append(batch, m)
+					if len(batch) >= publishBatchSize {
+						send()
+					}
+				default:
+					send()
+					return
+				}
+			}
+		}
+	}
+}
+
+// publish sends a batch of events. Failures are logged: events are not retried.
+func (s *Sink) publish(msgs []message) {
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	if err := s.pub.publish(ctx, msgs); err != nil {
+		applogger.Warn("event_sink_publish_failed", "type", s.cfg.Type, "events", len(msgs), "error", err.Error())
+	}
+}
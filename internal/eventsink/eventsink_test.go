@@ -0,0 +1,425 @@
+package eventsink
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testEvent(model string) Event {
+	return Event{
+		Time:             time.Date(2026, 3, 14, 10, 2, 11, 0, time.UTC),
+		RequestID:        "abc123",
+		Endpoint:         "/v1/chat/completions",
+		Model:            model,
+		Backend:          "openai/gpt-4o",
+		PromptTokens:     10,
+		CompletionTokens: 3,
+		TotalTokens:      13,
+		LatencyMs:        800,
+		Status:           200,
+	}
+}
+
+// listen starts a fake broker serving each connection with serve
+func listen(t *testing.T, serve func(net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				serve(conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// fakeNATS is a minimal NATS server recording the CONNECT options and published messages
+type fakeNATS struct {
+	mu       sync.Mutex
+	connect  map[string]any
+	messages map[string][]string
+}
+
+func (f *fakeNATS) serve(conn net.Conn) {
+	io.WriteString(conn, `INFO {"server_id":"test","max_payload":1048576}`+"\r\n")
+	rd := bufio.NewReader(conn)
+	for {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimSuffix(line, "\r\n")
+		switch verb, args, _ := strings.Cut(line, " "); verb {
+		case "CONNECT":
+			f.mu.Lock()
+			json.Unmarshal([]byte(args), &f.connect)
+			token, _ := f.connect["auth_token"].(string)
+			f.mu.Unlock()
+			if token == "bad" {
+				io.WriteString(conn, "-ERR 'Authorization Violation'\r\n")
+				return
+			}
+		case "PUB":
+			fields := strings.Fields(args)
+			size, _ := strconv.Atoi(fields[len(fields)-1])
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(rd, payload); err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.messages[fields[0]] = append(f.messages[fields[0]], string(payload[:size]))
+			f.mu.Unlock()
+		case "PING":
+			// Ping the client first to check it answers
+			io.WriteString(conn, "PING\r\n")
+			if line, _ := rd.ReadString('\n'); line != "PONG\r\n" {
+				return
+			}
+			io.WriteString(conn, "PONG\r\n")
+		}
+	}
+}
+
+func TestSink_NATS(t *testing.T) {
+	f := &fakeNATS{messages: make(map[string][]string)}
+	addr := listen(t, f.serve)
+
+	s, err := New(Config{Type: TypeNATS, URL: "nats://secret@" + addr, Topic: "openmodel.usage"})
+	require.NoError(t, err)
+	s.Publish(testEvent("gpt-4"))
+	s.Publish(testEvent("claude"))
+	require.NoError(t, s.Shutdown(context.Background()))
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	assert.Equal(t, "secret", f.connect["auth_token"])
+	require.Len(t, f.messages["openmodel.usage"], 2)
+	var event map[string]any
+	require.NoError(t, json.Unmarshal([]byte(f.messages["openmodel.usage"][0]), &event))
+	assert.Equal(t, "gpt-4", event["model"])
+	assert.Equal(t, "openai/gpt-4o", event["backend"])
+	assert.Equal(t, 13.0, event["total_tokens"])
+	assert.Equal(t, 800.0, event["latency_ms"])
+	assert.Equal(t, 200.0, event["status"])
+}
+
+func TestNATSPublisher_Errors(t *testing.T) {
+	f := &fakeNATS{messages: make(map[string][]string)}
+	addr := listen(t, f.serve)
+
+	p, err := newNATSPublisher(Config{URL: "nats://bad@" + addr, Topic: "usage"})
+	require.NoError(t, err)
+	err = p.publish(context.Background(), []message{{value: []byte("{}")}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Authorization Violation")
+
+	p, err = newNATSPublisher(Config{URL: "nats://user:pass@" + addr, Topic: "usage"})
+	require.NoError(t, err)
+	require.NoError(t, p.publish(context.Background(), []message{{value: []byte("{}")}}))
+	assert.Equal(t, "user", f.connect["user"])
+	assert.Equal(t, "pass", f.connect["pass"])
+	require.NoError(t, p.close())
+
+	for _, cfg := range []Config{
+		{URL: "http://localhost:4222", Topic: "usage"},
+		{URL: "nats://localhost:4222", Topic: "has space"},
+		{URL: "nats://localhost:4222"},
+	} {
+		_, err := newNATSPublisher(cfg)
+		assert.Error(t, err, cfg)
+	}
+}
+
+// fakeKafka is a minimal Kafka broker leading the partitions of one topic and recording
+// the records produced to each
+type fakeKafka struct {
+	addr       string
+	topic      string
+	partitions int
+	password   string
+
+	mu      sync.Mutex
+	records map[int32][]string
+}
+
+func (f *fakeKafka) serve(conn net.Conn) {
+	authed := f.password == ""
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		frame := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(conn, frame); err != nil {
+			return
+		}
+		r := &kafkaReader{b: frame}
+		apiKey := r.int16()
+		r.int16() // version
+		correlation := r.int32()
+		r.string() // client id
+
+		var resp []byte
+		switch apiKey {
+		case kafkaAPISaslHandshake:
+			resp = binary.BigEndian.AppendUint16(resp, 0)
+			resp = binary.BigEndian.AppendUint32(resp, 1)
+			resp = appendString(resp, "PLAIN")
+		case kafkaAPISaslAuthenticate:
+			token := string(r.next(int(r.int32())))
+			authed = token == "\x00user\x00"+f.password
+			if authed {
+				resp = binary.BigEndian.AppendUint16(resp, 0)
+				resp = binary.BigEndian.AppendUint16(resp, 0xffff)
+			} else {
+				resp = binary.BigEndian.AppendUint16(resp, 58)
+				resp = appendString(resp, "Invalid username or password")
+			}
+			resp = binary.BigEndian.AppendUint32(resp, 0)
+		case kafkaAPIMetadata:
+			if !authed {
+				return
+			}
+			host, port, _ := net.SplitHostPort(f.addr)
+			portNum, _ := strconv.Atoi(port)
+			resp = binary.BigEndian.AppendUint32(resp, 1)
+			resp = binary.BigEndian.AppendUint32(resp, 0)
+			resp = appendString(resp, host)
+			resp = binary.BigEndian.AppendUint32(resp, uint32(portNum))
+			resp = binary.BigEndian.AppendUint16(resp, 0xffff)
+			resp = binary.BigEndian.AppendUint32(resp, 0) // controller
+			resp = binary.BigEndian.AppendUint32(resp, 1)
+			resp = binary.BigEndian.AppendUint16(resp, 0)
+			resp = appendString(resp, f.topic)
+			resp = append(resp, 0)
+			resp = binary.BigEndian.AppendUint32(resp, uint32(f.partitions))
+			for i := range f.partitions {
+				resp = binary.BigEndian.AppendUint16(resp, 0)
+				resp = binary.BigEndian.AppendUint32(resp, uint32(i))
+				resp = binary.BigEndian.AppendUint32(resp, 0) // leader
+				resp = binary.BigEndian.AppendUint32(resp, 1) // replicas: [0]
+				resp = binary.BigEndian.AppendUint32(resp, 0)
+				resp = binary.BigEndian.AppendUint32(resp, 0xffffffff) // null isr
+			}
+		case kafkaAPIProduce:
+			if !authed {
+				return
+			}
+			resp = f.produce(r)
+		default:
+			return
+		}
+		out := binary.BigEndian.AppendUint32(nil, uint32(4+len(resp)))
+		out = binary.BigEndian.AppendUint32(out, uint32(correlation))
+		conn.Write(append(out, resp...))
+	}
+}
+
+// produce stores the records of a Produce v3 request, rejecting batches with a bad CRC
+func (f *fakeKafka) produce(r *kafkaReader) []byte {
+	r.string() // transactional id
+	r.int16()  // acks
+	r.int32()  // timeout
+	var resp []byte
+	resp = binary.BigEndian.AppendUint32(resp, uint32(r.array()))
+	topic := r.string()
+	resp = appendString(resp, topic)
+	count := r.array()
+	resp = binary.BigEndian.AppendUint32(resp, uint32(count))
+	for range count {
+		partition := r.int32()
+		batch := &kafkaReader{b: r.next(int(r.int32()))}
+		batch.int64() // base offset
+		batch.int32() // length
+		batch.int32() // leader epoch
+		magic := batch.int8()
+		crc := uint32(batch.int32())
+		code := uint16(0)
+		if magic != 2 || crc != crc32.Checksum(batch.b, crc32c) {
+			code = 2 // corrupt message
+		} else {
+			batch.next(2 + 4 + 8 + 8 + 8 + 2 + 4)
+			for range batch.array() {
+				batch.varint() // length
+				batch.int8()   // attributes
+				batch.varint() // timestamp delta
+				batch.varint() // offset delta
+				batch.next(int(batch.varint()))
+				value := string(batch.next(int(batch.varint())))
+				batch.varint() // headers
+				f.mu.Lock()
+				f.records[partition] = append(f.records[partition], value)
+				f.mu.Unlock()
+			}
+		}
+		resp = binary.BigEndian.AppendUint32(resp, uint32(partition))
+		resp = binary.BigEndian.AppendUint16(resp, code)
+		resp = binary.BigEndian.AppendUint64(resp, 0)
+		resp = binary.BigEndian.AppendUint64(resp, 0xffffffffffffffff)
+	}
+	return binary.BigEndian.AppendUint32(resp, 0) // throttle time
+}
+
+func (r *kafkaReader) varint() int64 {
+	n, size := binary.Varint(r.b)
+	if size <= 0 {
+		r.next(len(r.b) + 1)
+		return 0
+	}
+	r.next(size)
+	return n
+}
+
+func newFakeKafka(t *testing.T, password string) *fakeKafka {
+	t.Helper()
+	f := &fakeKafka{topic: "openmodel.usage", partitions: 3, password: password, records: make(map[int32][]string)}
+	f.addr = listen(t, f.serve)
+	return f
+}
+
+func TestSink_Kafka(t *testing.T) {
+	f := newFakeKafka(t, "pass")
+
+	s, err := New(Config{Type: TypeKafka, Brokers: []string{f.addr}, Topic: f.topic, Username: "user", Password: "pass"})
+	require.NoError(t, err)
+	for _, model := range []string{"gpt-4", "claude", "gpt-4", "llama"} {
+		s.Publish(testEvent(model))
+	}
+	require.NoError(t, s.Shutdown(context.Background()))
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	total := 0
+	for _, values := range f.records {
+		total += len(values)
+	}
+	require.Equal(t, 4, total)
+
+	// Events of a model land on the same partition
+	partitionOf := make(map[string]int32)
+	for partition, values := range f.records {
+		for _, value := range values {
+			var event map[string]any
+			require.NoError(t, json.Unmarshal([]byte(value), &event))
+			assert.Equal(t, "abc123", event["request_id"])
+			model := event["model"].(string)
+			if p, ok := partitionOf[model]; ok {
+				assert.Equal(t, p, partition, model)
+			}
+			partitionOf[model] = partition
+		}
+	}
+	assert.Len(t, partitionOf, 3)
+}
+
+func TestKafkaPublisher_Errors(t *testing.T) {
+	f := newFakeKafka(t, "pass")
+
+	p, err := newKafkaPublisher(Config{Brokers: []string{f.addr}, Topic: f.topic, Username: "user", Password: "wrong"})
+	require.NoError(t, err)
+	err = p.publish(context.Background(), []message{{value: []byte("{}")}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "SASL authentication failed")
+
+	p, err = newKafkaPublisher(Config{Brokers: []string{f.addr}, Topic: "missing", Username: "user", Password: "pass"})
+	require.NoError(t, err)
+	err = p.publish(context.Background(), []message{{value: []byte("{}")}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"missing" not found`)
+
+	_, err = newKafkaPublisher(Config{Topic: "usage"})
+	assert.Error(t, err)
+	_, err = newKafkaPublisher(Config{Brokers: []string{f.addr}})
+	assert.Error(t, err)
+}
+
+func TestSink_Webhook(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		auth    string
+		batches [][]map[string]any
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		auth = r.Header.Get("Authorization")
+		batches = append(batches, batch)
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	s, err := New(Config{Type: TypeWebhook, URL: srv.URL, Token: "secret"})
+	require.NoError(t, err)
+	s.Publish(testEvent("gpt-4"))
+	s.Publish(testEvent("claude"))
+	require.NoError(t, s.Shutdown(context.Background()))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, "Bearer secret", auth)
+	require.Len(t, batches, 1)
+	require.Len(t, batches[0], 2)
+	assert.Equal(t, "gpt-4", batches[0][0]["model"])
+	assert.Equal(t, "claude", batches[0][1]["model"])
+	assert.Equal(t, 13.0, batches[0][0]["total_tokens"])
+}
+
+func TestWebhookPublisher_Errors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	p, err := newWebhookPublisher(Config{URL: srv.URL})
+	require.NoError(t, err)
+	err = p.publish(context.Background(), []message{{value: []byte("{}")}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "status 503")
+	require.NoError(t, p.close())
+
+	for _, cfg := range []Config{
+		{URL: "nats://localhost:4222"},
+		{URL: "https://"},
+		{},
+	} {
+		_, err := newWebhookPublisher(cfg)
+		assert.Error(t, err, cfg)
+	}
+}
+
+func TestSink_Nil(t *testing.T) {
+	_, err := New(Config{Type: "rabbitmq"})
+	assert.Error(t, err)
+
+	var s *Sink
+	s.Publish(testEvent("gpt-4"))
+	assert.NoError(t, s.Shutdown(context.Background()))
+}
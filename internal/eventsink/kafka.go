@@ -0,0 +1,485 @@
+package eventsink
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Kafka APIs and the versions used: old enough for any broker since 0.11
+const (
+	kafkaAPIProduce          = 0
+	kafkaAPIMetadata         = 3
+	kafkaAPISaslHandshake    = 17
+	kafkaAPISaslAuthenticate = 36
+
+	kafkaProduceVersion          = 3
+	kafkaMetadataVersion         = 1
+	kafkaSaslHandshakeVersion    = 1
+	kafkaSaslAuthenticateVersion = 0
+
+	kafkaClientID        = "openmodel"
+	kafkaAcks            = 1 // The leader has written the records
+	kafkaMaxResponseSize = 16 << 20
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// kafkaError is an error code returned by a broker
+type kafkaError int16
+
+func (e kafkaError) Error() string {
+	switch e {
+	case 3:
+		return "kafka: unknown topic or partition"
+	case 6:
+		return "kafka: not leader for partition"
+	case 58:
+		return "kafka: SASL authentication failed"
+	}
+	return "kafka: error code " + strconv.Itoa(int(e))
+}
+
+// kafkaPublisher produces messages to a topic. Messages are partitioned by a hash of their
+// key and sent to the leader of their partition, found in the metadata of the bootstrap
+// brokers.
+type kafkaPublisher struct {
+	cfg Config
+
+	mu          sync.Mutex
+	brokers     map[int32]string // Broker addresses by node id
+	leaders     []int32          // Leader of each partition, nil until metadata is fetched
+	conns       map[int32]*kafkaConn
+	correlation int32
+}
+
+// kafkaConn is a connection to a broker
+type kafkaConn struct {
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+func newKafkaPublisher(cfg Config) (*kafkaPublisher, error) {
+	if len(cfg.Brokers) == 0 {
+		return nil, fmt.Errorf("no kafka brokers")
+	}
+	if cfg.Topic == "" {
+		return nil, fmt.Errorf("no kafka topic")
+	}
+	return &kafkaPublisher{cfg: cfg, conns: make(map[int32]*kafkaConn)}, nil
+}
+
+// publish produces messages to the leaders of their partitions. Errors drop the
+// connection and the metadata so the next call fetches them again.
+func (p *kafkaPublisher) publish(ctx context.Context, msgs []message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.leaders == nil {
+		if err := p.refreshMetadataLocked(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Group messages by leader, then by partition
+	byLeader := make(map[int32]map[int32][]message)
+	for _, m := range msgs {
+		h := fnv.New32a()
+		h.Write(m.key)
+		partition := int32(h.Sum32() % uint32(len(p.leaders)))
+		leader := p.leaders[partition]
+		if byLeader[leader] == nil {
+			byLeader[leader] = make(map[int32][]message)
+		}
+		byLeader[leader][partition] = append(byLeader[leader][partition], m)
+	}
+
+	var errs []error
+	for leader, partitions := range byLeader {
+		if err := p.produceLocked(ctx, leader, partitions); err != nil {
+			p.dropLocked(leader)
+			p.leaders = nil
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (p *kafkaPublisher) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for node := range p.conns {
+		p.dropLocked(node)
+	}
+	return nil
+}
+
+// refreshMetadataLocked fetches the brokers and the partition leaders of the topic from
+// the first bootstrap broker that answers
+func (p *kafkaPublisher) refreshMetadataLocked(ctx context.Context) error {
+	var req []byte
+	req = binary.BigEndian.AppendUint32(req, 1)
+	req = appendString(req, p.cfg.Topic)
+
+	var errs []error
+	for _, addr := range p.cfg.Brokers {
+		c, err := p.dialLocked(ctx, addr)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		resp, err := p.roundTripLocked(ctx, c, kafkaAPIMetadata, kafkaMetadataVersion, req)
+		c.conn.Close()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		return p.parseMetadataLocked(resp)
+	}
+	return fmt.Errorf("failed to fetch kafka metadata: %w", errors.Join(errs...))
+}
+
+// parseMetadataLocked reads a Metadata v1 response
+func (p *kafkaPublisher) parseMetadataLocked(resp []byte) error {
+	r := &kafkaReader{b: resp}
+	brokers := make(map[int32]string)
+	for range r.array() {
+		node := r.int32()
+		host := r.string()
+		port := r.int32()
+		r.string() // rack
+		brokers[node] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	r.int32() // controller id
+
+	var leaders []int32
+	for range r.array() {
+		code := r.int16()
+		name := r.string()
+		r.int8() // is internal
+		partitions := make(map[int32]int32)
+		for range r.array() {
+			partitionCode := r.int16()
+			partition := r.int32()
+			leader := r.int32()
+			r.skipInt32s() // replicas
+			r.skipInt32s() // in-sync replicas
+			if partitionCode != 0 && code == 0 {
+				code = partitionCode
+			}
+			partitions[partition] = leader
+		}
+		if r.err != nil {
+			break
+		}
+		if name != p.cfg.Topic {
+			continue
+		}
+		if code != 0 {
+			return fmt.Errorf("kafka topic %q: %w", name, kafkaError(code))
+		}
+		leaders = make([]int32, len(partitions))
+		for partition, leader := range partitions {
+			if int(partition) >= len(leaders) || leader < 0 {
+				return fmt.Errorf("kafka topic %q: partition %d has no leader", name, partition)
+			}
+			leaders[partition] = leader
+		}
+	}
+	if r.err != nil {
+		return fmt.Errorf("invalid kafka metadata: %w", r.err)
+	}
+	if len(leaders) == 0 {
+		return fmt.Errorf("kafka topic %q not found", p.cfg.Topic)
+	}
+	p.brokers, p.leaders = brokers, leaders
+	return nil
+}
+
+// produceLocked sends a Produce v3 request holding a record batch per partition to their
+// leader and checks the error code of each partition
+func (p *kafkaPublisher) produceLocked(ctx context.Context, leader int32, partitions map[int32][]message) error {
+	c := p.conns[leader]
+	if c == nil {
+		addr, ok := p.brokers[leader]
+		if !ok {
+			return fmt.Errorf("kafka broker %d not in metadata", leader)
+		}
+		var err error
+		if c, err = p.dialLocked(ctx, addr); err != nil {
+			return err
+		}
+		p.conns[leader] = c
+	}
+
+	var req []byte
+	req = binary.BigEndian.AppendUint16(req, 0xffff) // null transactional id
+	req = binary.BigEndian.AppendUint16(req, kafkaAcks)
+	req = binary.BigEndian.AppendUint32(req, uint32(publishTimeout.Milliseconds()))
+	req = binary.BigEndian.AppendUint32(req, 1)
+	req = appendString(req, p.cfg.Topic)
+	req = binary.BigEndian.AppendUint32(req, uint32(len(partitions)))
+	for partition, msgs := range partitions {
+		batch := recordBatch(msgs, time.Now())
+		req = binary.BigEndian.AppendUint32(req, uint32(partition))
+		req = binary.BigEndian.AppendUint32(req, uint32(len(batch)))
+		req = append(req, batch...)
+	}
+
+	resp, err := p.roundTripLocked(ctx, c, kafkaAPIProduce, kafkaProduceVersion, req)
+	if err != nil {
+		return err
+	}
+	r := &kafkaReader{b: resp}
+	var errs []error
+	for range r.array() {
+		r.string() // topic
+		for range r.array() {
+			partition := r.int32()
+			code := r.int16()
+			r.int64() // base offset
+			r.int64() // log append time
+			if code != 0 && r.err == nil {
+				errs = append(errs, fmt.Errorf("kafka partition %d: %w", partition, kafkaError(code)))
+			}
+		}
+	}
+	if r.err != nil {
+		return fmt.Errorf("invalid kafka produce response: %w", r.err)
+	}
+	return errors.Join(errs...)
+}
+
+// dialLocked connects to a broker and authenticates with SASL/PLAIN when a username is set
+func (p *kafkaPublisher) dialLocked(ctx context.Context, addr string) (*kafkaConn, error) {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	var (
+		conn net.Conn
+		err  error
+	)
+	if p.cfg.TLS {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{MinVersion: tls.VersionTLS12}}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to kafka: %w", err)
+	}
+	c := &kafkaConn{conn: conn, rd: bufio.NewReader(conn)}
+	if p.cfg.Username == "" {
+		return c, nil
+	}
+	if err := p.authenticateLocked(ctx, c); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to set up kafka connection: %w", err)
+	}
+	return c, nil
+}
+
+// authenticateLocked runs a SASL/PLAIN handshake
+func (p *kafkaPublisher) authenticateLocked(ctx context.Context, c *kafkaConn) error {
+	resp, err := p.roundTripLocked(ctx, c, kafkaAPISaslHandshake, kafkaSaslHandshakeVersion, appendString(nil, "PLAIN"))
+	if err != nil {
+		return err
+	}
+	r := &kafkaReader{b: resp}
+	if code := r.int16(); code != 0 {
+		return kafkaError(code)
+	}
+
+	token := "\x00" + p.cfg.Username + "\x00" + p.cfg.Password
+	req := binary.BigEndian.AppendUint32(nil, uint32(len(token)))
+	req = append(req, token...)
+	if resp, err = p.roundTripLocked(ctx, c, kafkaAPISaslAuthenticate, kafkaSaslAuthenticateVersion, req); err != nil {
+		return err
+	}
+	r = &kafkaReader{b: resp}
+	if code := r.int16(); code != 0 {
+		if msg := r.string(); msg != "" {
+			return fmt.Errorf("%w: %s", kafkaError(code), msg)
+		}
+		return kafkaError(code)
+	}
+	return r.err
+}
+
+// roundTripLocked sends a request with a v1 header and returns the body of its response
+func (p *kafkaPublisher) roundTripLocked(ctx context.Context, c *kafkaConn, apiKey, version int16, body []byte) ([]byte, error) {
+	setDeadline(ctx, c.conn)
+	p.correlation++
+	correlation := p.correlation
+
+	header := binary.BigEndian.AppendUint16(nil, uint16(apiKey))
+	header = binary.BigEndian.AppendUint16(header, uint16(version))
+	header = binary.BigEndian.AppendUint32(header, uint32(correlation))
+	header = appendString(header, kafkaClientID)
+	frame := binary.BigEndian.AppendUint32(nil, uint32(len(header)+len(body)))
+	frame = append(append(frame, header...), body...)
+	if _, err := c.conn.Write(frame); err != nil {
+		return nil, fmt.Errorf("kafka write failed: %w", err)
+	}
+
+	var size [4]byte
+	if _, err := io.ReadFull(c.rd, size[:]); err != nil {
+		return nil, fmt.Errorf("kafka read failed: %w", err)
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n < 4 || n > kafkaMaxResponseSize {
+		return nil, fmt.Errorf("kafka: invalid response size %d", n)
+	}
+	resp := make([]byte, n)
+	if _, err := io.ReadFull(c.rd, resp); err != nil {
+		return nil, fmt.Errorf("kafka read failed: %w", err)
+	}
+	if got := int32(binary.BigEndian.Uint32(resp)); got != correlation {
+		return nil, fmt.Errorf("kafka: response %d to request %d", got, correlation)
+	}
+	return resp[4:], nil
+}
+
+// dropLocked closes the connection to a broker
+func (p *kafkaPublisher) dropLocked(node int32) {
+	if c := p.conns[node]; c != nil {
+		c.conn.Close()
+		delete(p.conns, node)
+	}
+}
+
+// recordBatch encodes messages as a v2 record batch, uncompressed and without a producer id
+func recordBatch(msgs []message, now time.Time) []byte {
+	ts := now.UnixMilli()
+	var records []byte
+	for i, m := range msgs {
+		var rec []byte
+		rec = append(rec, 0)                     // attributes
+		rec = binary.AppendVarint(rec, 0)        // timestamp delta
+		rec = binary.AppendVarint(rec, int64(i)) // offset delta
+		rec = appendVarintBytes(rec, m.key)
+		rec = appendVarintBytes(rec, m.value)
+		rec = binary.AppendVarint(rec, 0) // headers
+		records = binary.AppendVarint(records, int64(len(rec)))
+		records = append(records, rec...)
+	}
+
+	// The CRC covers everything from the attributes on
+	var tail []byte
+	tail = binary.BigEndian.AppendUint16(tail, 0) // attributes
+	tail = binary.BigEndian.AppendUint32(tail, uint32(len(msgs)-1))
+	tail = binary.BigEndian.AppendUint64(tail, uint64(ts))
+	tail = binary.BigEndian.AppendUint64(tail, uint64(ts))
+	tail = binary.BigEndian.AppendUint64(tail, 0xffffffffffffffff) // producer id
+	tail = binary.BigEndian.AppendUint16(tail, 0xffff)             // producer epoch
+	tail = binary.BigEndian.AppendUint32(tail, 0xffffffff)         // base sequence
+	tail = binary.BigEndian.AppendUint32(tail, uint32(len(msgs)))
+	tail = append(tail, records...)
+
+	var batch []byte
+	batch = binary.BigEndian.AppendUint64(batch, 0) // base offset
+	batch = binary.BigEndian.AppendUint32(batch, uint32(4+1+4+len(tail)))
+	batch = binary.BigEndian.AppendUint32(batch, 0xffffffff) // partition leader epoch
+	batch = append(batch, 2)                                 // magic
+	batch = binary.BigEndian.AppendUint32(batch, crc32.Checksum(tail, crc32c))
+	return append(batch, tail...)
+}
+
+// appendString appends a string with an int16 length
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// appendVarintBytes appends bytes with a varint length, -1 for nil
+func appendVarintBytes(b, data []byte) []byte {
+	if data == nil {
+		return binary.AppendVarint(b, -1)
+	}
+	b = binary.AppendVarint(b, int64(len(data)))
+	return append(b, data...)
+}
+
+// kafkaReader decodes a response, keeping the first error
+type kafkaReader struct {
+	b   []byte
+	err error
+}
+
+func (r *kafkaReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.b) {
+		r.err = io.ErrUnexpectedEOF
+		r.b = nil
+		return nil
+	}
+	data := r.b[:n]
+	r.b = r.b[n:]
+	return data
+}
+
+func (r *kafkaReader) int8() int8 {
+	if b := r.next(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (r *kafkaReader) int16() int16 {
+	if b := r.next(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (r *kafkaReader) int32() int32 {
+	if b := r.next(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (r *kafkaReader) int64() int64 {
+	if b := r.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+// string reads a string with an int16 length, "" when null
+func (r *kafkaReader) string() string {
+	n := r.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(r.next(int(n)))
+}
+
+// array reads the length of an array, 0 when null. A length larger than the bytes left
+// is an error.
+func (r *kafkaReader) array() int {
+	n := int(r.int32())
+	if n < 0 {
+		return 0
+	}
+	if n > len(r.b) {
+		r.next(n)
+		return 0
+	}
+	return n
+}
+
+// skipInt32s skips an array of int32
+func (r *kafkaReader) skipInt32s() {
+	r.next(r.array() * 4)
+}
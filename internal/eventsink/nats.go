@@ -0,0 +1,210 @@
+package eventsink
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// natsPublisher publishes messages with the NATS client protocol: a PUB per message,
+// then a PING whose PONG confirms the server has processed them
+type natsPublisher struct {
+	addr     string
+	host     string
+	useTLS   bool
+	user     string
+	password string
+	token    string
+	subject  string
+
+	mu   sync.Mutex
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+// newNATSPublisher parses a nats:// or tls:// server URL. A username without a password
+// is a token, like the NATS clients read it.
+func newNATSPublisher(cfg Config) (*natsPublisher, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nats url: %w", err)
+	}
+	if u.Scheme != "nats" && u.Scheme != "tls" {
+		return nil, fmt.Errorf("invalid nats url scheme %q", u.Scheme)
+	}
+	if cfg.Topic == "" || strings.ContainsAny(cfg.Topic, " \t\r\n") {
+		return nil, fmt.Errorf("invalid nats subject %q", cfg.Topic)
+	}
+
+	p := &natsPublisher{
+		addr:    u.Host,
+		host:    u.Hostname(),
+		useTLS:  u.Scheme == "tls",
+		token:   cfg.Token,
+		subject: cfg.Topic,
+	}
+	if u.Port() == "" {
+		p.addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			p.user, p.password = u.User.Username(), password
+		} else if p.token == "" {
+			p.token = u.User.Username()
+		}
+	}
+	return p, nil
+}
+
+// publish sends messages and waits for the server to acknowledge them. Errors drop the
+// connection so the next call reconnects.
+func (p *natsPublisher) publish(ctx context.Context, msgs []message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		if err := p.connectLocked(ctx); err != nil {
+			return err
+		}
+	}
+	setDeadline(ctx, p.conn)
+
+	var buf []byte
+	for _, m := range msgs {
+		buf = fmt.Appendf(buf, "PUB %s %d\r\n", p.subject, len(m.value))
+		buf = append(buf, m.value...)
+		buf = append(buf, "\r\n"...)
+	}
+	buf = append(buf, "PING\r\n"...)
+	if _, err := p.conn.Write(buf); err != nil {
+		p.closeLocked()
+		return fmt.Errorf("nats write failed: %w", err)
+	}
+	if err := p.waitPongLocked(); err != nil {
+		p.closeLocked()
+		return err
+	}
+	return nil
+}
+
+func (p *natsPublisher) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closeLocked()
+}
+
+// connectLocked dials the server, upgrades to TLS after its INFO when asked to, and
+// authenticates
+func (p *natsPublisher) connectLocked(ctx context.Context) error {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", p.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to nats: %w", err)
+	}
+	setDeadline(ctx, conn)
+	p.conn, p.rd = conn, bufio.NewReader(conn)
+
+	line, err := p.readLineLocked()
+	if err != nil {
+		p.closeLocked()
+		return err
+	}
+	infoJSON, ok := strings.CutPrefix(line, "INFO ")
+	if !ok {
+		p.closeLocked()
+		return fmt.Errorf("nats: unexpected greeting %q", line)
+	}
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	json.Unmarshal([]byte(infoJSON), &info)
+	if info.TLSRequired && !p.useTLS {
+		p.closeLocked()
+		return fmt.Errorf("nats server requires TLS, use a tls:// url")
+	}
+	if p.useTLS {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: p.host, MinVersion: tls.VersionTLS12})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			p.closeLocked()
+			return fmt.Errorf("nats tls handshake failed: %w", err)
+		}
+		p.conn, p.rd = tlsConn, bufio.NewReader(tlsConn)
+	}
+
+	connect, _ := json.Marshal(map[string]any{
+		"verbose":      false,
+		"pedantic":     false,
+		"tls_required": p.useTLS,
+		"name":         "openmodel",
+		"lang":         "go",
+		"user":         p.user,
+		"pass":         p.password,
+		"auth_token":   p.token,
+	})
+	if _, err := fmt.Fprintf(p.conn, "CONNECT %s\r\nPING\r\n", connect); err != nil {
+		p.closeLocked()
+		return fmt.Errorf("nats write failed: %w", err)
+	}
+	if err := p.waitPongLocked(); err != nil {
+		p.closeLocked()
+		return fmt.Errorf("failed to set up nats connection: %w", err)
+	}
+	return nil
+}
+
+// waitPongLocked reads until the PONG answering our PING, answering the server's PINGs
+func (p *natsPublisher) waitPongLocked() error {
+	for {
+		line, err := p.readLineLocked()
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := io.WriteString(p.conn, "PONG\r\n"); err != nil {
+				return fmt.Errorf("nats write failed: %w", err)
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New("nats: " + strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")), "'"))
+		}
+		// +OK and INFO updates need no answer
+	}
+}
+
+func (p *natsPublisher) readLineLocked() (string, error) {
+	line, err := p.rd.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("nats read failed: %w", err)
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
+
+// closeLocked drops the connection
+func (p *natsPublisher) closeLocked() error {
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Close()
+	p.conn, p.rd = nil, nil
+	return err
+}
+
+// setDeadline bounds the I/O on conn by the deadline of ctx
+func setDeadline(ctx context.Context, conn net.Conn) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Time{})
+	}
+}
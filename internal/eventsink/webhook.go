@@ -0,0 +1,70 @@
+package eventsink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// webhookPublisher posts each batch of messages to a URL as a JSON array of events, for
+// services that ingest over HTTP such as a log shipper or a serverless function
+type webhookPublisher struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// newWebhookPublisher checks the http(s) URL batches are posted to
+func newWebhookPublisher(cfg Config) (*webhookPublisher, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook url: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook url scheme %q", u.Scheme)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: dialTimeout}).DialContext
+	return &webhookPublisher{url: cfg.URL, token: cfg.Token, client: &http.Client{Transport: transport}}, nil
+}
+
+// publish posts messages and fails unless the webhook answers with a 2xx status
+func (p *webhookPublisher) publish(ctx context.Context, msgs []message) error {
+	body := []byte{'['}
+	for i, m := range msgs {
+		if i > 0 {
+			body = append(body, ',')
+		}
+		body = append(body, m.value...)
+	}
+	body = append(body, ']')
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook post failed: %w", err)
+	}
+	defer resp.Body.Close()
+	// Drain the body so the connection is reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (p *webhookPublisher) close() error {
+	p.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,429 @@
+// Package jwtauth verifies JWTs issued by an OpenID Connect identity provider against the
+// signing keys it publishes as a JWKS
+package jwtauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Key set fetching: keys are refetched after the refresh interval, or sooner for a token
+// signed with an unknown key, but not more than once per minRefetch
+const (
+	defaultRefresh = time.Hour
+	minRefetch     = time.Minute
+	fetchTimeout   = 10 * time.Second
+	// leeway tolerates clock skew between the identity provider and the server
+	leeway = time.Minute
+)
+
+// ErrInvalidToken is returned, wrapped, for tokens that are malformed, badly signed,
+// expired or issued to someone else
+var ErrInvalidToken = errors.New("invalid token")
+
+// Config configures a verifier
+type Config struct {
+	Issuer   string        // Required iss claim
+	Audience string        // Value the aud claim must hold (empty: any)
+	JWKSURL  string        // Key set URL (empty: discovered from the issuer's OpenID configuration)
+	Refresh  time.Duration // How long a fetched key set is used (default 1h)
+}
+
+// Claims are the claims of a verified token
+type Claims map[string]any
+
+// Strings returns a claim as a list of strings: a string claim is one item, an array
+// claim its string items, and a missing claim nil
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		var list []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// Verifier verifies tokens, caching the identity provider's keys
+type Verifier struct {
+	cfg    Config
+	client *http.Client
+	now    func() time.Time
+
+	mu       sync.Mutex
+	jwksURL  string
+	keys     map[string]crypto.PublicKey // By kid
+	fetched  time.Time                   // When the last fetch started, whether it succeeded or not
+	fetching *keyFetch                   // The fetch in progress, if any
+}
+
+// keyFetch is a fetch of the key set, which every request needing it waits for
+type keyFetch struct {
+	done chan struct{}
+	err  error // Set before done is closed
+}
+
+// New creates a verifier; keys are fetched on first use
+func New(cfg Config) *Verifier {
+	if cfg.Refresh <= 0 {
+		cfg.Refresh = defaultRefresh
+	}
+	return &Verifier{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: fetchTimeout},
+		now:     time.Now,
+		jwksURL: cfg.JWKSURL,
+	}
+}
+
+// LooksLikeJWT reports whether a bearer token has the shape of a JWT, so it is not
+// mistaken for an API key
+func LooksLikeJWT(token string) bool {
+	return strings.HasPrefix(token, "eyJ") && strings.Count(token, ".") == 2
+}
+
+// Verify checks a token's signature, issuer, audience and validity period and returns
+// its claims
+func (v *Verifier) Verify(ctx context.Context, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: not a JWT", ErrInvalidToken)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrInvalidToken, err)
+	}
+
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrInvalidToken, err)
+	}
+	if err := v.validate(claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return claims, nil
+}
+
+// validate checks the registered claims
+func (v *Verifier) validate(claims Claims) error {
+	if iss, _ := claims["iss"].(string); iss != v.cfg.Issuer {
+		return fmt.Errorf("issuer %q is not %q", iss, v.cfg.Issuer)
+	}
+	if v.cfg.Audience != "" && !slices.Contains(claims.Strings("aud"), v.cfg.Audience) {
+		return fmt.Errorf("audience is not %q", v.cfg.Audience)
+	}
+	now := v.now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return fmt.Errorf("no expiry")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(leeway)) {
+		return fmt.Errorf("expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(leeway).Before(time.Unix(int64(nbf), 0)) {
+		return fmt.Errorf("not valid yet")
+	}
+	return nil
+}
+
+// key returns the signing key with the given id, fetching the key set when it is stale or
+// lacks the key. The fetch runs apart from the requests waiting for it, so a slow identity
+// provider holds up only those, and one cancelled request does not fail it for the others.
+func (v *Verifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	now := v.now()
+	key, ok := v.lookup(kid)
+	stale := now.Sub(v.fetched) > v.cfg.Refresh
+	if ok && !stale {
+		v.mu.Unlock()
+		return key, nil
+	}
+	if !stale && now.Sub(v.fetched) <= minRefetch && v.fetching == nil {
+		v.mu.Unlock()
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidToken, kid)
+		}
+		return key, nil
+	}
+	f := v.startFetchLocked(ctx, now)
+	v.mu.Unlock()
+
+	select {
+	case <-f.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if f.err != nil {
+		if ok {
+			// Keep using the key set the identity provider published last
+			return key, nil
+		}
+		return nil, f.err
+	}
+	v.mu.Lock()
+	key, ok = v.lookup(kid)
+	v.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidToken, kid)
+	}
+	return key, nil
+}
+
+// startFetchLocked returns the fetch of the key set in progress, starting one if there is
+// none. The fetch keeps the values of ctx but not its cancellation.
+func (v *Verifier) startFetchLocked(ctx context.Context, now time.Time) *keyFetch {
+	if v.fetching != nil {
+		return v.fetching
+	}
+	f := &keyFetch{done: make(chan struct{})}
+	v.fetching = f
+	jwksURL := v.jwksURL
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), fetchTimeout)
+		defer cancel()
+		jwksURL, keys, err := v.fetch(ctx, jwksURL)
+
+		v.mu.Lock()
+		// A failed fetch also counts, so an unreachable identity provider is not asked
+		// again on every request
+		v.fetched = now
+		v.jwksURL = jwksURL
+		if err == nil {
+			v.keys = keys
+		}
+		v.fetching = nil
+		v.mu.Unlock()
+		f.err = err
+		close(f.done)
+	}()
+	return f
+}
+
+// lookup returns a cached key. A token without a kid may use the only key of the set.
+func (v *Verifier) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, true
+		}
+	}
+	key, ok := v.keys[kid]
+	return key, ok
+}
+
+// fetch returns the identity provider's key set from jwksURL, discovering the URL first
+// when it is empty, and the URL it used
+func (v *Verifier) fetch(ctx context.Context, jwksURL string) (string, map[string]crypto.PublicKey, error) {
+	if jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := v.getJSON(ctx, strings.TrimSuffix(v.cfg.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+			return "", nil, fmt.Errorf("failed to discover jwks_uri: %w", err)
+		}
+		if discovery.JWKSURI == "" {
+			return "", nil, fmt.Errorf("failed to discover jwks_uri: the openid configuration has none")
+		}
+		jwksURL = discovery.JWKSURI
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := v.getJSON(ctx, jwksURL, &set); err != nil {
+		return jwksURL, nil, fmt.Errorf("failed to fetch jwks: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			// Keys of unsupported types do not prevent using the others
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return jwksURL, keys, nil
+}
+
+func (v *Verifier) getJSON(ctx context.Context, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
+
+// jwk is a JSON Web Key with the members of RSA and EC public keys
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("rsa exponent out of range")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve %s", k.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// verifySignature checks a signature made with alg; only asymmetric algorithms are accepted
+func verifySignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	var hash crypto.Hash
+	switch alg[min(2, len(alg)):] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	digest := digest(hash, signed)
+
+	switch {
+	case strings.HasPrefix(alg, "RS"), strings.HasPrefix(alg, "PS"):
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("algorithm %s does not match the signing key", alg)
+		}
+		if alg[0] == 'P' {
+			return rsa.VerifyPSS(rsaKey, hash, digest, signature, nil)
+		}
+		return rsa.VerifyPKCS1v15(rsaKey, hash, digest, signature)
+	case strings.HasPrefix(alg, "ES"):
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("algorithm %s does not match the signing key", alg)
+		}
+		size := (ecKey.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return fmt.Errorf("bad signature length")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(ecKey, digest, r, s) {
+			return fmt.Errorf("bad signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported algorithm %q", alg)
+}
+
+func digest(hash crypto.Hash, signed string) []byte {
+	switch hash {
+	case crypto.SHA384:
+		sum := sha512.Sum384([]byte(signed))
+		return sum[:]
+	case crypto.SHA512:
+		sum := sha512.Sum512([]byte(signed))
+		return sum[:]
+	}
+	sum := sha256.Sum256([]byte(signed))
+	return sum[:]
+}
+
+func decodeSegment(segment string, out any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(data) == 0 {
+		return nil, fmt.Errorf("bad key parameter")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,242 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// provider is a fake OpenID Connect identity provider
+type provider struct {
+	*httptest.Server
+	keys    []map[string]string
+	fetches atomic.Int32
+	gate    chan struct{} // Holds key set responses until closed, when set
+}
+
+func newProvider(t *testing.T) *provider {
+	t.Helper()
+	p := &provider{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"issuer": p.URL, "jwks_uri": p.URL + "/jwks"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		p.fetches.Add(1)
+		if p.gate != nil {
+			<-p.gate
+		}
+		json.NewEncoder(w).Encode(map[string]any{"keys": p.keys})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func rsaJWK(kid string, key *rsa.PrivateKey) map[string]string {
+	return map[string]string{"kty": "RSA", "kid": kid, "use": "sig", "n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes())}
+}
+
+func ecJWK(kid string, key *ecdsa.PrivateKey) map[string]string {
+	return map[string]string{"kty": "EC", "kid": kid, "crv": "P-256", "x": b64(key.X.FillBytes(make([]byte, 32))), "y": b64(key.Y.FillBytes(make([]byte, 32)))}
+}
+
+// sign returns a token with the given header and claims, signed with key unless it is nil
+func sign(t *testing.T, header, claims map[string]any, key crypto.Signer) string {
+	t.Helper()
+	h, err := json.Marshal(header)
+	require.NoError(t, err)
+	c, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed := b64(h) + "." + b64(c)
+	if key == nil {
+		return signed + "."
+	}
+	digest := sha256.Sum256([]byte(signed))
+	var signature []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k, digest[:])
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	require.NoError(t, err)
+	return signed + "." + b64(signature)
+}
+
+func TestVerify(t *testing.T) {
+	p := newProvider(t)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	p.keys = []map[string]string{rsaJWK("rsa", rsaKey), ecJWK("ec", ecKey)}
+
+	now := time.Now().Unix()
+	claims := func(changes map[string]any) map[string]any {
+		c := map[string]any{"iss": p.URL, "aud": "openmodel", "sub": "alice", "exp": now + 300}
+		for k, v := range changes {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+	rs256 := map[string]any{"alg": "RS256", "kid": "rsa"}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{"rs256", sign(t, rs256, claims(nil), rsaKey), ""},
+		{"es256", sign(t, map[string]any{"alg": "ES256", "kid": "ec"}, claims(nil), ecKey), ""},
+		{"audience in a list", sign(t, rs256, claims(map[string]any{"aud": []string{"other", "openmodel"}}), rsaKey), ""},
+		{"expired within leeway", sign(t, rs256, claims(map[string]any{"exp": now - 30}), rsaKey), ""},
+		{"expired", sign(t, rs256, claims(map[string]any{"exp": now - 300}), rsaKey), "expired"},
+		{"no expiry", sign(t, rs256, claims(map[string]any{"exp": nil}), rsaKey), "no expiry"},
+		{"not valid yet", sign(t, rs256, claims(map[string]any{"nbf": now + 300}), rsaKey), "not valid yet"},
+		{"wrong issuer", sign(t, rs256, claims(map[string]any{"iss": "https://evil.example"}), rsaKey), "issuer"},
+		{"wrong audience", sign(t, rs256, claims(map[string]any{"aud": "other"}), rsaKey), "audience"},
+		{"signed with another key", sign(t, rs256, claims(nil), otherKey), "verification error"},
+		{"key of the wrong type", sign(t, map[string]any{"alg": "RS256", "kid": "ec"}, claims(nil), rsaKey), "does not match"},
+		{"unsigned", sign(t, map[string]any{"alg": "none", "kid": "rsa"}, claims(nil), nil), "unsupported algorithm"},
+		{"hmac", sign(t, map[string]any{"alg": "HS256", "kid": "rsa"}, claims(nil), rsaKey), "unsupported algorithm"},
+		{"unknown key", sign(t, map[string]any{"alg": "RS256", "kid": "gone"}, claims(nil), rsaKey), "unknown signing key"},
+		{"not a JWT", "sk-123", "not a JWT"},
+	}
+
+	v := New(Config{Issuer: p.URL, Audience: "openmodel"})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := v.Verify(context.Background(), tt.token)
+			if tt.wantErr != "" {
+				require.ErrorIs(t, err, ErrInvalidToken)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, []string{"alice"}, got.Strings("sub"))
+		})
+	}
+	// Keys were discovered and fetched once; the unknown key was within the refetch interval
+	assert.Equal(t, int32(1), p.fetches.Load())
+}
+
+func TestVerify_KeyRotation(t *testing.T) {
+	p := newProvider(t)
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	p.keys = []map[string]string{rsaJWK("old", oldKey)}
+
+	now := time.Now()
+	v := New(Config{Issuer: p.URL, JWKSURL: p.URL + "/jwks"})
+	v.now = func() time.Time { return now }
+	claims := map[string]any{"iss": p.URL, "sub": "alice", "exp": now.Add(24 * time.Hour).Unix()}
+
+	_, err = v.Verify(context.Background(), sign(t, map[string]any{"alg": "RS256", "kid": "old"}, claims, oldKey))
+	require.NoError(t, err)
+
+	// A token signed with a new key is refused until the key set may be fetched again
+	p.keys = append(p.keys, rsaJWK("new", newKey))
+	rotated := sign(t, map[string]any{"alg": "RS256", "kid": "new"}, claims, newKey)
+	_, err = v.Verify(context.Background(), rotated)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	now = now.Add(2 * time.Minute)
+	_, err = v.Verify(context.Background(), rotated)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), p.fetches.Load())
+
+	// A stale key set is refreshed; an unreachable provider leaves the cached keys in use
+	p.Close()
+	now = now.Add(2 * time.Hour)
+	_, err = v.Verify(context.Background(), rotated)
+	assert.NoError(t, err)
+}
+
+func TestVerify_SlowProvider(t *testing.T) {
+	p := newProvider(t)
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	p.keys = []map[string]string{rsaJWK("old", oldKey)}
+
+	now := time.Now()
+	v := New(Config{Issuer: p.URL, JWKSURL: p.URL + "/jwks"})
+	v.now = func() time.Time { return now }
+	claims := map[string]any{"iss": p.URL, "sub": "alice", "exp": now.Add(24 * time.Hour).Unix()}
+	known := sign(t, map[string]any{"alg": "RS256", "kid": "old"}, claims, oldKey)
+	_, err = v.Verify(context.Background(), known)
+	require.NoError(t, err)
+
+	p.keys = append(p.keys, rsaJWK("new", newKey))
+	p.gate = make(chan struct{})
+	now = now.Add(2 * time.Minute)
+	rotated := sign(t, map[string]any{"alg": "RS256", "kid": "new"}, claims, newKey)
+
+	// The caller that starts the fetch gives up without failing it for the others
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = v.Verify(ctx, rotated)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	errs := make(chan error, 3)
+	for range 3 {
+		go func() {
+			_, err := v.Verify(context.Background(), rotated)
+			errs <- err
+		}()
+	}
+
+	// Known keys verify while the fetch is held up
+	_, err = v.Verify(context.Background(), known)
+	require.NoError(t, err)
+
+	close(p.gate)
+	for range 3 {
+		assert.NoError(t, <-errs)
+	}
+	assert.Equal(t, int32(2), p.fetches.Load())
+}
+
+func TestClaims_Strings(t *testing.T) {
+	claims := Claims{"sub": "alice", "groups": []any{"admin", 1, "dev"}, "n": 1.0}
+	assert.Equal(t, []string{"alice"}, claims.Strings("sub"))
+	assert.Equal(t, []string{"admin", "dev"}, claims.Strings("groups"))
+	assert.Nil(t, claims.Strings("n"))
+	assert.Nil(t, claims.Strings("missing"))
+}
+
+func TestLooksLikeJWT(t *testing.T) {
+	assert.True(t, LooksLikeJWT("eyJhbGciOiJSUzI1NiJ9.eyJzdWIiOiJhIn0.c2ln"))
+	assert.False(t, LooksLikeJWT("sk-abc"))
+	assert.False(t, LooksLikeJWT("eyJhbGciOiJSUzI1NiJ9.eyJzdWIiOiJhIn0"))
+}
@@ -0,0 +1,304 @@
+// Package keys keeps client API keys issued at runtime in a SQLite database. Only a hash
+// of each key is stored: the key itself is shown once, when it is created or rotated.
+package keys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/macedot/openmodel/internal/usage"
+	_ "modernc.org/sqlite" // Registers the "sqlite" database/sql driver
+)
+
+// Prefix starts every issued key, so leaked keys are easy to recognize
+const Prefix = "om-"
+
+// displayPrefixLen is how much of a key is kept to tell keys apart in listings
+const displayPrefixLen = len(Prefix) + 6
+
+// ErrNotFound is returned for a key id that is unknown or already revoked
+var ErrNotFound = errors.New("api key not found")
+
+const schema = `CREATE TABLE IF NOT EXISTS api_keys (
+	id         TEXT NOT NULL PRIMARY KEY,
+	name       TEXT NOT NULL,
+	hash       TEXT NOT NULL UNIQUE,
+	prefix     TEXT NOT NULL,
+	models     TEXT NOT NULL DEFAULT '[]',
+	endpoints  TEXT NOT NULL DEFAULT '[]',
+	created_at TEXT NOT NULL,
+	revoked_at TEXT NOT NULL DEFAULT ''
+)`
+
+// migrations upgrade the schema of databases created by earlier versions. The database's
+// user_version counts those applied.
+var migrations = []string{
+	`ALTER TABLE api_keys ADD COLUMN rpm INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE api_keys ADD COLUMN tpm INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE api_keys ADD COLUMN monthly_tokens INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE api_keys ADD COLUMN monthly_budget REAL NOT NULL DEFAULT 0`,
+	`ALTER TABLE api_keys ADD COLUMN tenant TEXT NOT NULL DEFAULT ''`,
+}
+
+const columns = "id, name, prefix, models, endpoints, rpm, tpm, monthly_tokens, monthly_budget, tenant, created_at, revoked_at"
+
+// Key is an issued API key, without the key itself
+type Key struct {
+	ID     string `json:"id"`     // usage.KeyID of the key, as in usage reports
+	Name   string `json:"name"`   // Application the key was issued to
+	Prefix string `json:"prefix"` // First characters of the key
+	Limits
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Limits are what a key may use
+type Limits struct {
+	Models    []string `json:"models,omitempty"`    // Requested model names, "*" patterns allowed (empty: all)
+	Endpoints []string `json:"endpoints,omitempty"` // Endpoint groups (empty: all)
+	RPM       int      `json:"rpm,omitempty"`       // Requests per minute (0: unlimited)
+	TPM       int      `json:"tpm,omitempty"`       // Tokens per minute (0: unlimited)
+	// Tokens and cost per UTC calendar month (0: unlimited)
+	MonthlyTokens int64   `json:"monthly_tokens,omitempty"`
+	MonthlyBudget float64 `json:"monthly_budget,omitempty"`
+	Tenant        string  `json:"tenant,omitempty"` // Tenant the key's requests belong to (empty: none)
+}
+
+// Store keeps API keys in a SQLite database. Lookup does nothing on a nil store, so
+// callers can check keys whether or not the store is enabled.
+type Store struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+// Open opens the database at path, creating it and its directory if needed
+func Open(path string) (*Store, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create key database directory: %w", err)
+		}
+	}
+	// WAL lets the keys command change keys while a server reads them
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open key database: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create key table: %w", err)
+	}
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db, now: time.Now}, nil
+}
+
+// migrate applies the migrations the database has not had yet
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("failed to read key schema version: %w", err)
+	}
+	for i := version; i < len(migrations); i++ {
+		if _, err := db.Exec(migrations[i]); err != nil {
+			return fmt.Errorf("failed to upgrade key schema to version %d: %w", i+1, err)
+		}
+		if _, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			return fmt.Errorf("failed to upgrade key schema to version %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	if s == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// Create issues a key with limits to the application name and returns it with the key
+// itself
+func (s *Store) Create(ctx context.Context, name string, limits Limits) (Key, string, error) {
+	if name == "" {
+		return Key{}, "", fmt.Errorf("api key name is required")
+	}
+	return s.insert(ctx, s.db, name, limits)
+}
+
+// List returns the keys in the order they were created, with the revoked ones when all
+// is set
+func (s *Store) List(ctx context.Context, all bool) ([]Key, error) {
+	query := "SELECT " + columns + " FROM api_keys"
+	if !all {
+		query += " WHERE revoked_at = ''"
+	}
+	rows, err := s.db.QueryContext(ctx, query+" ORDER BY created_at, id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	defer rows.Close()
+	list := []Key{}
+	for rows.Next() {
+		k, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	return list, nil
+}
+
+// Revoke revokes the key with the given id, which stops working at once
+func (s *Store) Revoke(ctx context.Context, id string) (Key, error) {
+	k, err := s.active(ctx, s.db, id)
+	if err != nil {
+		return Key{}, err
+	}
+	now := s.now().UTC()
+	if _, err := s.db.ExecContext(ctx, "UPDATE api_keys SET revoked_at = ? WHERE id = ?", now.Format(time.RFC3339Nano), id); err != nil {
+		return Key{}, fmt.Errorf("failed to revoke api key: %w", err)
+	}
+	k.RevokedAt = &now
+	return k, nil
+}
+
+// Rotate replaces the key with the given id by a new key with the same name and limits,
+// revoking the old one, and returns the new key with the key itself
+func (s *Store) Rotate(ctx context.Context, id string) (Key, string, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Key{}, "", fmt.Errorf("failed to rotate api key: %w", err)
+	}
+	defer tx.Rollback()
+
+	old, err := s.active(ctx, tx, id)
+	if err != nil {
+		return Key{}, "", err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE api_keys SET revoked_at = ? WHERE id = ?", s.now().UTC().Format(time.RFC3339Nano), id); err != nil {
+		return Key{}, "", fmt.Errorf("failed to rotate api key: %w", err)
+	}
+	k, secret, err := s.insert(ctx, tx, old.Name, old.Limits)
+	if err != nil {
+		return Key{}, "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return Key{}, "", fmt.Errorf("failed to rotate api key: %w", err)
+	}
+	return k, secret, nil
+}
+
+// Lookup returns the unrevoked key a client presented
+func (s *Store) Lookup(ctx context.Context, secret string) (Key, bool, error) {
+	if s == nil || secret == "" {
+		return Key{}, false, nil
+	}
+	row := s.db.QueryRowContext(ctx, "SELECT "+columns+" FROM api_keys WHERE hash = ? AND revoked_at = ''", hash(secret))
+	k, err := scanKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Key{}, false, nil
+	}
+	if err != nil {
+		return Key{}, false, err
+	}
+	return k, true, nil
+}
+
+// execer is a database or a transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// insert generates a key and stores it
+func (s *Store) insert(ctx context.Context, db execer, name string, limits Limits) (Key, string, error) {
+	secret, err := generate()
+	if err != nil {
+		return Key{}, "", err
+	}
+	k := Key{
+		ID:        usage.KeyID(secret),
+		Name:      name,
+		Prefix:    secret[:displayPrefixLen],
+		Limits:    limits,
+		CreatedAt: s.now().UTC(),
+	}
+	modelsJSON, _ := json.Marshal(nonNil(limits.Models))
+	endpointsJSON, _ := json.Marshal(nonNil(limits.Endpoints))
+	if _, err := db.ExecContext(ctx,
+		"INSERT INTO api_keys (id, name, hash, prefix, models, endpoints, rpm, tpm, monthly_tokens, monthly_budget, tenant, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		k.ID, k.Name, hash(secret), k.Prefix, string(modelsJSON), string(endpointsJSON), limits.RPM, limits.TPM,
+		limits.MonthlyTokens, limits.MonthlyBudget, limits.Tenant, k.CreatedAt.Format(time.RFC3339Nano),
+	); err != nil {
+		return Key{}, "", fmt.Errorf("failed to store api key: %w", err)
+	}
+	return k, secret, nil
+}
+
+// active returns the unrevoked key with the given id
+func (s *Store) active(ctx context.Context, db execer, id string) (Key, error) {
+	k, err := scanKey(db.QueryRowContext(ctx, "SELECT "+columns+" FROM api_keys WHERE id = ? AND revoked_at = ''", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Key{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return k, err
+}
+
+// scanKey reads a key selected with columns
+func scanKey(row interface{ Scan(dest ...any) error }) (Key, error) {
+	var k Key
+	var models, endpoints, created, revoked string
+	if err := row.Scan(&k.ID, &k.Name, &k.Prefix, &models, &endpoints, &k.RPM, &k.TPM, &k.MonthlyTokens, &k.MonthlyBudget, &k.Tenant, &created, &revoked); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Key{}, err
+		}
+		return Key{}, fmt.Errorf("failed to read api key: %w", err)
+	}
+	json.Unmarshal([]byte(models), &k.Models)
+	json.Unmarshal([]byte(endpoints), &k.Endpoints)
+	k.CreatedAt, _ = time.Parse(time.RFC3339Nano, created)
+	if revoked != "" {
+		t, _ := time.Parse(time.RFC3339Nano, revoked)
+		k.RevokedAt = &t
+	}
+	return k, nil
+}
+
+// generate returns a new random key
+func generate() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	return Prefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hash is what is stored of a key: its full SHA-256
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
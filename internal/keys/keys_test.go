@@ -0,0 +1,126 @@
+package keys
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/macedot/openmodel/internal/usage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "keys.db")
+	store, err := Open(path)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	indexer, indexerSecret, err := store.Create(ctx, "indexer", Limits{Models: []string{"text-embedding-*"}, Endpoints: []string{"openai"}, RPM: 60, TPM: 100000, Tenant: "search"})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(indexerSecret, Prefix))
+	assert.Equal(t, usage.KeyID(indexerSecret), indexer.ID)
+	assert.Equal(t, indexerSecret[:displayPrefixLen], indexer.Prefix)
+	now = now.Add(time.Minute)
+	chat, chatSecret, err := store.Create(ctx, "chat-app", Limits{})
+	require.NoError(t, err)
+	assert.NotEqual(t, indexerSecret, chatSecret)
+
+	_, _, err = store.Create(ctx, "", Limits{})
+	assert.Error(t, err)
+	require.NoError(t, store.Close())
+
+	// Keys persist across restarts, and only their hash is stored
+	store, err = Open(path)
+	require.NoError(t, err)
+	defer store.Close()
+	var stored int
+	require.NoError(t, store.db.QueryRow("SELECT COUNT(*) FROM api_keys WHERE hash = ? OR prefix = ?", indexerSecret, indexerSecret).Scan(&stored))
+	assert.Zero(t, stored)
+
+	got, ok, err := store.Lookup(ctx, indexerSecret)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "indexer", got.Name)
+	assert.Equal(t, []string{"text-embedding-*"}, got.Models)
+	assert.Equal(t, []string{"openai"}, got.Endpoints)
+	assert.Equal(t, 60, got.RPM)
+	assert.Equal(t, 100000, got.TPM)
+	assert.Equal(t, "search", got.Tenant)
+	assert.Nil(t, got.RevokedAt)
+	_, ok, err = store.Lookup(ctx, "om-unknown")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	list, err := store.List(ctx, false)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, indexer.ID, list[0].ID)
+	assert.Equal(t, chat.ID, list[1].ID)
+
+	// A rotated key keeps its name and limits; the old key stops working
+	rotated, rotatedSecret, err := store.Rotate(ctx, indexer.ID)
+	require.NoError(t, err)
+	assert.NotEqual(t, indexer.ID, rotated.ID)
+	assert.Equal(t, "indexer", rotated.Name)
+	assert.Equal(t, []string{"text-embedding-*"}, rotated.Models)
+	assert.Equal(t, 60, rotated.RPM)
+	_, ok, _ = store.Lookup(ctx, indexerSecret)
+	assert.False(t, ok)
+	_, ok, _ = store.Lookup(ctx, rotatedSecret)
+	assert.True(t, ok)
+
+	revoked, err := store.Revoke(ctx, chat.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, revoked.RevokedAt)
+	_, ok, _ = store.Lookup(ctx, chatSecret)
+	assert.False(t, ok)
+	_, err = store.Revoke(ctx, chat.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, _, err = store.Rotate(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	list, err = store.List(ctx, false)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, rotated.ID, list[0].ID)
+	list, err = store.List(ctx, true)
+	require.NoError(t, err)
+	assert.Len(t, list, 3)
+}
+
+func TestStore_Nil(t *testing.T) {
+	var store *Store
+	_, ok, err := store.Lookup(context.Background(), "om-key")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.NoError(t, store.Close())
+}
+
+func TestOpen_Migrates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.db")
+	db, err := sql.Open("sqlite", "file:"+path)
+	require.NoError(t, err)
+	_, err = db.Exec(schema)
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO api_keys (id, name, hash, prefix, created_at) VALUES ('k1', 'old', 'h', 'om-abc', '2026-01-01T00:00:00Z')")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	// Keys issued before rate limits existed have none
+	store, err := Open(path)
+	require.NoError(t, err)
+	defer store.Close()
+	list, err := store.List(context.Background(), false)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Zero(t, list[0].RPM)
+	assert.Zero(t, list[0].TPM)
+	assert.Empty(t, list[0].Tenant)
+}
@@ -0,0 +1,393 @@
+// Package llmexport ships the prompts, completions, latency and token usage of requests
+// to an LLM observability platform, Langfuse or LangSmith
+package llmexport
+
+import (
+	"bytes"
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	applogger "github.com/macedot/openmodel/internal/logger"
+)
+
+// Platforms generations are exported to
+const (
+	PlatformLangfuse  = "langfuse"
+	PlatformLangSmith = "langsmith"
+)
+
+// Export batching: generations are sent once a batch is full or the interval has passed.
+// Generations beyond the queue size are dropped rather than slowing requests down.
+const (
+	exportBatchSize = 50
+	exportInterval  = 5 * time.Second
+	exportQueueSize = 1024
+	exportTimeout   = 10 * time.Second
+)
+
+// Config configures an exporter
+type Config struct {
+	Platform   string  // PlatformLangfuse or PlatformLangSmith
+	Endpoint   string  // Base URL of the platform's API
+	PublicKey  string  // Langfuse public key
+	SecretKey  string  // Langfuse secret key
+	APIKey     string  // LangSmith API key
+	Project    string  // LangSmith project runs are logged to
+	SampleRate float64 // Share of requests exported, from 0 to 1
+}
+
+// Generation is one request answered by a model
+type Generation struct {
+	RequestID        string
+	Name             string // Endpoint called, e.g. /v1/chat/completions
+	Model            string // Model requested
+	Backend          string // Backend that served, "provider/model"
+	Input            any    // Request body
+	Output           any    // Response body, or the text of a streamed response
+	Start            time.Time
+	End              time.Time
+	PromptTokens     int
+	CompletionTokens int
+	Status           int // HTTP status of the response
+	Stream           bool
+}
+
+// Exporter sends generations to the platform in batches in the background. Its methods do
+// nothing on a nil exporter.
+type Exporter struct {
+	cfg    Config
+	url    string
+	encode func([]Generation) ([]byte, error)
+	client *http.Client
+
+	queue    chan Generation
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// New creates an exporter and starts its export loop
+func New(cfg Config) (*Exporter, error) {
+	e := &Exporter{
+		cfg:    cfg,
+		client: &http.Client{Timeout: exportTimeout},
+		queue:  make(chan Generation, exportQueueSize),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	switch cfg.Platform {
+	case PlatformLangfuse:
+		e.url, e.encode = cfg.Endpoint+"/api/public/ingestion", encodeLangfuse
+	case PlatformLangSmith:
+		e.url, e.encode = cfg.Endpoint+"/runs/batch", func(gens []Generation) ([]byte, error) {
+			return encodeLangSmith(gens, cfg.Project)
+		}
+	default:
+		return nil, fmt.Errorf("unknown platform %q", cfg.Platform)
+	}
+	go e.loop()
+	return e, nil
+}
+
+// Sampled reports whether a new request is exported, by the sample rate
+func (e *Exporter) Sampled() bool {
+	return e != nil && (e.cfg.SampleRate >= 1 || rand.Float64() < e.cfg.SampleRate)
+}
+
+// Export queues a generation, dropping it when the queue is full
+func (e *Exporter) Export(g Generation) {
+	if e == nil {
+		return
+	}
+	select {
+	case e.queue <- g:
+	default:
+		applogger.Debug("llm_export_dropped", "request_id", g.RequestID)
+	}
+}
+
+// Shutdown exports the generations still queued, waiting until ctx is done at most
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	if e == nil {
+		return nil
+	}
+	e.stopOnce.Do(func() { close(e.stop) })
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// loop exports queued generations in batches until the exporter is shut down
+func (e *Exporter) loop() {
+	defer close(e.done)
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+	var batch []Generation
+	send := func() {
+		if len(batch) > 0 {
+			e.export(batch)
+			batch = nil
+		}
+	}
+	for {
+		select {
+		case g := <-e.queue:
+			batch = append(batch, g)
+			if len(batch) >= exportBatchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case <-e.stop:
+			for {
+				select {
+				case g := <-e.queue:
+					batch = append(batch, g)
+					if len(batch) >= exportBatchSize {
+						send()
+					}
+				default:
+					send()
+					return
+				}
+			}
+		}
+	}
+}
+
+// export sends a batch of generations. Failures are logged: generations are not retried.
+func (e *Exporter) export(gens []Generation) {
+	body, err := e.encode(gens)
+	if err == nil {
+		err = e.post(body)
+	}
+	if err != nil {
+		applogger.Warn("llm_export_failed", "platform", e.cfg.Platform, "generations", len(gens), "error", err.Error())
+	}
+}
+
+// post sends a batch to the platform
+func (e *Exporter) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	switch e.cfg.Platform {
+	case PlatformLangfuse:
+		req.SetBasicAuth(e.cfg.PublicKey, e.cfg.SecretKey)
+	case PlatformLangSmith:
+		req.Header.Set("x-api-key", e.cfg.APIKey)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s responded with status %d", e.cfg.Platform, resp.StatusCode)
+	}
+	return nil
+}
+
+// newID returns a random UUID (version 4), the id format both platforms accept
+func newID() string {
+	var b [16]byte
+	cryptorand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// metadata is what the platforms show of a generation beside its input and output
+func (g Generation) metadata() map[string]any {
+	m := map[string]any{"backend": g.Backend, "status": g.Status, "stream": g.Stream}
+	if g.RequestID != "" {
+		m["request_id"] = g.RequestID
+	}
+	return m
+}
+
+// failed reports whether the request was answered with an error
+func (g Generation) failed() bool {
+	return g.Status >= 400
+}
+
+// timestamp formats a time as both platforms expect
+func timestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// Langfuse ingestion API: each generation is a trace holding one generation observation
+type (
+	langfuseBatch struct {
+		Batch []langfuseEvent `json:"batch"`
+	}
+	langfuseEvent struct {
+		ID        string `json:"id"`
+		Timestamp string `json:"timestamp"`
+		Type      string `json:"type"`
+		Body      any    `json:"body"`
+	}
+	langfuseTrace struct {
+		ID        string         `json:"id"`
+		Timestamp string         `json:"timestamp"`
+		Name      string         `json:"name"`
+		Input     any            `json:"input,omitempty"`
+		Output    any            `json:"output,omitempty"`
+		Metadata  map[string]any `json:"metadata,omitempty"`
+	}
+	langfuseGeneration struct {
+		ID        string         `json:"id"`
+		TraceID   string         `json:"traceId"`
+		Name      string         `json:"name"`
+		StartTime string         `json:"startTime"`
+		EndTime   string         `json:"endTime"`
+		Model     string         `json:"model,omitempty"`
+		Input     any            `json:"input,omitempty"`
+		Output    any            `json:"output,omitempty"`
+		Usage     *langfuseUsage `json:"usage,omitempty"`
+		Level     string         `json:"level,omitempty"`
+		Metadata  map[string]any `json:"metadata,omitempty"`
+	}
+	langfuseUsage struct {
+		Input  int    `json:"input"`
+		Output int    `json:"output"`
+		Total  int    `json:"total"`
+		Unit   string `json:"unit"`
+	}
+)
+
+// encodeLangfuse encodes generations as a Langfuse ingestion batch
+func encodeLangfuse(gens []Generation) ([]byte, error) {
+	batch := langfuseBatch{Batch: make([]langfuseEvent, 0, 2*len(gens))}
+	for _, g := range gens {
+		traceID := newID()
+		generation := langfuseGeneration{
+			ID:        newID(),
+			TraceID:   traceID,
+			Name:      g.Name,
+			StartTime: timestamp(g.Start),
+			EndTime:   timestamp(g.End),
+			Model:     g.Model,
+			Input:     g.Input,
+			Output:    g.Output,
+			Metadata:  g.metadata(),
+		}
+		if g.PromptTokens > 0 || g.CompletionTokens > 0 {
+			generation.Usage = &langfuseUsage{
+				Input:  g.PromptTokens,
+				Output: g.CompletionTokens,
+				Total:  g.PromptTokens + g.CompletionTokens,
+				Unit:   "TOKENS",
+			}
+		}
+		if g.failed() {
+			generation.Level = "ERROR"
+		}
+		batch.Batch = append(batch.Batch,
+			langfuseEvent{ID: newID(), Timestamp: timestamp(g.Start), Type: "trace-create", Body: langfuseTrace{
+				ID:        traceID,
+				Timestamp: timestamp(g.Start),
+				Name:      g.Name,
+				Input:     g.Input,
+				Output:    g.Output,
+				Metadata:  g.metadata(),
+			}},
+			langfuseEvent{ID: newID(), Timestamp: timestamp(g.End), Type: "generation-create", Body: generation},
+		)
+	}
+	return json.Marshal(batch)
+}
+
+// LangSmith batch API: each generation is a root run of type llm
+type (
+	langSmithBatch struct {
+		Post []langSmithRun `json:"post"`
+	}
+	langSmithRun struct {
+		ID          string         `json:"id"`
+		TraceID     string         `json:"trace_id"`
+		DottedOrder string         `json:"dotted_order"`
+		Name        string         `json:"name"`
+		RunType     string         `json:"run_type"`
+		SessionName string         `json:"session_name,omitempty"`
+		StartTime   string         `json:"start_time"`
+		EndTime     string         `json:"end_time"`
+		Inputs      map[string]any `json:"inputs"`
+		Outputs     map[string]any `json:"outputs,omitempty"`
+		Error       string         `json:"error,omitempty"`
+		Extra       map[string]any `json:"extra,omitempty"`
+	}
+)
+
+// encodeLangSmith encodes generations as a LangSmith run batch logged to project
+func encodeLangSmith(gens []Generation, project string) ([]byte, error) {
+	batch := langSmithBatch{Post: make([]langSmithRun, 0, len(gens))}
+	for _, g := range gens {
+		id := newID()
+		start := g.Start.UTC()
+		metadata := g.metadata()
+		metadata["ls_model_name"] = g.Model
+		run := langSmithRun{
+			ID:      id,
+			TraceID: id,
+			// A root run's order is its start time, to the microsecond, and its id
+			DottedOrder: start.Format("20060102T150405") + fmt.Sprintf("%06dZ", start.Nanosecond()/1000) + id,
+			Name:        g.Name,
+			RunType:     "llm",
+			SessionName: project,
+			StartTime:   timestamp(g.Start),
+			EndTime:     timestamp(g.End),
+			Inputs:      asObject(g.Input, "input"),
+			Outputs:     asObject(g.Output, "output"),
+			Extra:       map[string]any{"metadata": metadata},
+		}
+		if g.PromptTokens > 0 || g.CompletionTokens > 0 {
+			if run.Outputs == nil {
+				run.Outputs = map[string]any{}
+			}
+			run.Outputs["usage_metadata"] = map[string]int{
+				"input_tokens":  g.PromptTokens,
+				"output_tokens": g.CompletionTokens,
+				"total_tokens":  g.PromptTokens + g.CompletionTokens,
+			}
+		}
+		if g.failed() {
+			run.Error = fmt.Sprintf("status %d", g.Status)
+		}
+		batch.Post = append(batch.Post, run)
+	}
+	return json.Marshal(batch)
+}
+
+// asObject returns v as the JSON object LangSmith inputs and outputs must be, wrapping
+// other values under key
+func asObject(v any, key string) map[string]any {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case map[string]any:
+		// Usage is added to outputs, so they are copied rather than changed
+		m := make(map[string]any, len(v)+1)
+		for k, value := range v {
+			m[k] = value
+		}
+		return m
+	default:
+		return map[string]any{key: v}
+	}
+}
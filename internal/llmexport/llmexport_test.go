@@ -0,0 +1,126 @@
+package llmexport
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// capture records the requests of a fake platform
+type capture struct {
+	path, auth, apiKey string
+	body               map[string]any
+}
+
+func newPlatform(t *testing.T) (*httptest.Server, chan capture) {
+	t.Helper()
+	requests := make(chan capture, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		var body map[string]any
+		if err := json.Unmarshal(data, &body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		requests <- capture{path: r.URL.Path, auth: r.Header.Get("Authorization"), apiKey: r.Header.Get("x-api-key"), body: body}
+		w.WriteHeader(http.StatusMultiStatus)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, requests
+}
+
+func testGeneration() Generation {
+	start := time.Date(2026, 3, 14, 10, 2, 11, 520000000, time.UTC)
+	return Generation{
+		RequestID:        "abc123",
+		Name:             "/v1/chat/completions",
+		Model:            "gpt-4",
+		Backend:          "openai/gpt-4o",
+		Input:            map[string]any{"messages": []any{map[string]any{"role": "user", "content": "hello"}}},
+		Output:           "hi there",
+		Start:            start,
+		End:              start.Add(800 * time.Millisecond),
+		PromptTokens:     10,
+		CompletionTokens: 3,
+		Status:           200,
+		Stream:           true,
+	}
+}
+
+func TestExporter_Langfuse(t *testing.T) {
+	platform, requests := newPlatform(t)
+	e, err := New(Config{Platform: PlatformLangfuse, Endpoint: platform.URL, PublicKey: "pk", SecretKey: "sk", SampleRate: 1})
+	require.NoError(t, err)
+	assert.True(t, e.Sampled())
+	e.Export(testGeneration())
+	require.NoError(t, e.Shutdown(context.Background()))
+
+	req := <-requests
+	assert.Equal(t, "/api/public/ingestion", req.path)
+	assert.Equal(t, "Basic cGs6c2s=", req.auth)
+	batch := req.body["batch"].([]any)
+	require.Len(t, batch, 2)
+	trace := batch[0].(map[string]any)
+	generation := batch[1].(map[string]any)
+	assert.Equal(t, "trace-create", trace["type"])
+	assert.Equal(t, "generation-create", generation["type"])
+	body := generation["body"].(map[string]any)
+	assert.Equal(t, trace["body"].(map[string]any)["id"], body["traceId"])
+	assert.Equal(t, "gpt-4", body["model"])
+	assert.Equal(t, "hi there", body["output"])
+	assert.Equal(t, "2026-03-14T10:02:11.52Z", body["startTime"])
+	assert.Equal(t, "2026-03-14T10:02:12.32Z", body["endTime"])
+	assert.Equal(t, map[string]any{"input": 10.0, "output": 3.0, "total": 13.0, "unit": "TOKENS"}, body["usage"])
+	assert.Equal(t, "openai/gpt-4o", body["metadata"].(map[string]any)["backend"])
+}
+
+func TestExporter_LangSmith(t *testing.T) {
+	platform, requests := newPlatform(t)
+	e, err := New(Config{Platform: PlatformLangSmith, Endpoint: platform.URL, APIKey: "ls-key", Project: "prod", SampleRate: 1})
+	require.NoError(t, err)
+	g := testGeneration()
+	g.Status = 502
+	e.Export(g)
+	require.NoError(t, e.Shutdown(context.Background()))
+
+	req := <-requests
+	assert.Equal(t, "/runs/batch", req.path)
+	assert.Equal(t, "ls-key", req.apiKey)
+	runs := req.body["post"].([]any)
+	require.Len(t, runs, 1)
+	run := runs[0].(map[string]any)
+	assert.Equal(t, run["id"], run["trace_id"])
+	assert.Equal(t, "20260314T100211520000Z"+run["id"].(string), run["dotted_order"])
+	assert.Equal(t, "llm", run["run_type"])
+	assert.Equal(t, "prod", run["session_name"])
+	assert.Equal(t, "status 502", run["error"])
+	assert.Contains(t, run["inputs"], "messages")
+	outputs := run["outputs"].(map[string]any)
+	assert.Equal(t, "hi there", outputs["output"])
+	assert.Equal(t, map[string]any{"input_tokens": 10.0, "output_tokens": 3.0, "total_tokens": 13.0}, outputs["usage_metadata"])
+	assert.Equal(t, "gpt-4", run["extra"].(map[string]any)["metadata"].(map[string]any)["ls_model_name"])
+}
+
+func TestExporter_Sampling(t *testing.T) {
+	e, err := New(Config{Platform: PlatformLangfuse, Endpoint: "http://localhost:1", SampleRate: 0})
+	require.NoError(t, err)
+	defer e.Shutdown(context.Background())
+	for range 100 {
+		assert.False(t, e.Sampled())
+	}
+
+	_, err = New(Config{Platform: "datadog"})
+	assert.Error(t, err)
+
+	var nilExporter *Exporter
+	assert.False(t, nilExporter.Sampled())
+	nilExporter.Export(testGeneration())
+	assert.NoError(t, nilExporter.Shutdown(context.Background()))
+}
@@ -191,7 +191,7 @@ func Init(levelStr string, format string) error {
 		handler = slog.NewTextHandler(getWriter(), opts)
 	}
 
-	logger = slog.New(handler)
+	logger = slog.New(scrubHandler{handler})
 	slog.SetDefault(logger)
 
 	return nil
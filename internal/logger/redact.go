@@ -61,14 +61,7 @@ func RedactHeaders(headers map[string]string) map[string]string {
 
 	redacted := make(map[string]string, len(headers))
 	for k, v := range headers {
-		lowerKey := strings.ToLower(k)
-		if lowerKey == "authorization" ||
-			lowerKey == "api-key" ||
-			strings.Contains(lowerKey, "api-key") ||
-			strings.Contains(lowerKey, "token") ||
-			strings.Contains(lowerKey, "secret") ||
-			strings.Contains(lowerKey, "password") ||
-			strings.Contains(lowerKey, "key") {
+		if IsSensitiveHeader(k) {
 			redacted[k] = "[REDACTED]"
 		} else {
 			redacted[k] = v
@@ -77,6 +70,16 @@ func RedactHeaders(headers map[string]string) map[string]string {
 	return redacted
 }
 
+// IsSensitiveHeader reports whether an HTTP header carries credentials, judging by its name
+func IsSensitiveHeader(name string) bool {
+	lowerKey := strings.ToLower(name)
+	return lowerKey == "authorization" ||
+		strings.Contains(lowerKey, "token") ||
+		strings.Contains(lowerKey, "secret") ||
+		strings.Contains(lowerKey, "password") ||
+		strings.Contains(lowerKey, "key")
+}
+
 // RedactURL redacts sensitive query parameters from URLs.
 // This prevents API keys in URL parameters from being logged.
 func RedactURL(url string) string {
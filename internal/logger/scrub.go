@@ -0,0 +1,145 @@
+// Package logger provides structured logging for openmodel.
+package logger
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// minSecretLength is the length below which values are not scrubbed, so placeholder keys
+// such as "ollama" or "none" do not mask ordinary words
+const minSecretLength = 8
+
+// scrubbed replaces known secrets in logs and errors
+const scrubbed = "[REDACTED]"
+
+// secrets holds the known secret values by group, and the replacer built from all of them
+var secrets struct {
+	mu       sync.Mutex
+	groups   map[string][]string
+	replacer atomic.Pointer[strings.Replacer] // nil when there are none
+}
+
+// SetSecrets replaces the secret values of a group (e.g. "config", or a credential
+// source) that are masked in logs and in errors passed to ScrubError. Empty and short
+// values are ignored.
+func SetSecrets(group string, values ...string) {
+	secrets.mu.Lock()
+	defer secrets.mu.Unlock()
+	if secrets.groups == nil {
+		secrets.groups = make(map[string][]string)
+	}
+	delete(secrets.groups, group)
+	for _, value := range values {
+		if len(value) >= minSecretLength {
+			secrets.groups[group] = append(secrets.groups[group], value)
+		}
+	}
+
+	var all []string
+	for _, values := range secrets.groups {
+		all = append(all, values...)
+	}
+	if len(all) == 0 {
+		secrets.replacer.Store(nil)
+		return
+	}
+	// Longest first, so a secret containing another is masked whole
+	slices.SortFunc(all, func(a, b string) int { return cmp.Or(len(b)-len(a), strings.Compare(a, b)) })
+	pairs := make([]string, 0, 2*len(all))
+	for _, value := range slices.Compact(all) {
+		pairs = append(pairs, value, scrubbed)
+	}
+	secrets.replacer.Store(strings.NewReplacer(pairs...))
+}
+
+// Scrub masks the known secrets in s
+func Scrub(s string) string {
+	replacer := secrets.replacer.Load()
+	if replacer == nil || s == "" {
+		return s
+	}
+	return replacer.Replace(s)
+}
+
+// scrubbedError is an error whose message had secrets masked
+type scrubbedError struct {
+	err error
+	msg string
+}
+
+func (e *scrubbedError) Error() string { return e.msg }
+
+// Unwrap returns the original error, so errors.Is and errors.As still see it
+func (e *scrubbedError) Unwrap() error { return e.err }
+
+// ScrubError returns err with the known secrets masked in its message, or err itself
+// when its message has none
+func ScrubError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	if masked := Scrub(msg); masked != msg {
+		return &scrubbedError{err: err, msg: masked}
+	}
+	return err
+}
+
+// scrubHandler masks the known secrets in the message and attributes of log records
+type scrubHandler struct {
+	slog.Handler
+}
+
+func (h scrubHandler) Handle(ctx context.Context, r slog.Record) error {
+	if secrets.replacer.Load() == nil {
+		return h.Handler.Handle(ctx, r)
+	}
+	masked := slog.NewRecord(r.Time, r.Level, Scrub(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		masked.AddAttrs(scrubAttr(a))
+		return true
+	})
+	return h.Handler.Handle(ctx, masked)
+}
+
+func (h scrubHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	masked := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		masked[i] = scrubAttr(a)
+	}
+	return scrubHandler{h.Handler.WithAttrs(masked)}
+}
+
+func (h scrubHandler) WithGroup(name string) slog.Handler {
+	return scrubHandler{h.Handler.WithGroup(name)}
+}
+
+// scrubAttr masks the secrets in an attribute. Values other than strings and groups, such
+// as errors, are replaced by their masked text only when it differs.
+func scrubAttr(a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(Scrub(a.Value.String()))
+	case slog.KindGroup:
+		group := a.Value.Group()
+		masked := make([]slog.Attr, len(group))
+		for i, member := range group {
+			masked[i] = scrubAttr(member)
+		}
+		a.Value = slog.GroupValue(masked...)
+	case slog.KindAny:
+		text := fmt.Sprint(a.Value.Any())
+		if masked := Scrub(text); masked != text {
+			a.Value = slog.StringValue(masked)
+		}
+	}
+	return a
+}
@@ -0,0 +1,87 @@
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestScrub(t *testing.T) {
+	SetSecrets("config", "sk-provider-key", "ollama", "")
+	SetSecrets("credential", "sk-provider-key-rotated")
+	defer SetSecrets("config")
+	defer SetSecrets("credential")
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"", ""},
+		{"no secrets here", "no secrets here"},
+		{`Post "https://api.example.com/v1?key=sk-provider-key": timeout`, `Post "https://api.example.com/v1?key=[REDACTED]": timeout`},
+		{"Bearer sk-provider-key-rotated", "Bearer [REDACTED]"},
+		{"provider ollama is down", "provider ollama is down"},
+	}
+	for _, tt := range tests {
+		if got := Scrub(tt.input); got != tt.want {
+			t.Errorf("Scrub(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	// Setting a group replaces its previous values
+	SetSecrets("config", "sk-other-provider")
+	if got := Scrub("sk-provider-key"); got != "sk-provider-key" {
+		t.Errorf("replaced secret still scrubbed: %q", got)
+	}
+	if got := Scrub("sk-other-provider"); got != "[REDACTED]" {
+		t.Errorf("new secret not scrubbed: %q", got)
+	}
+}
+
+func TestScrubError(t *testing.T) {
+	SetSecrets("config", "sk-provider-key")
+	defer SetSecrets("config")
+
+	if ScrubError(nil) != nil {
+		t.Error("ScrubError(nil) is not nil")
+	}
+	plain := errors.New("connection refused")
+	if ScrubError(plain) != plain {
+		t.Error("an error without secrets is not returned as is")
+	}
+
+	err := ScrubError(fmt.Errorf("open sk-provider-key: %w", fs.ErrNotExist))
+	if err.Error() != "open [REDACTED]: file does not exist" {
+		t.Errorf("unexpected message: %q", err.Error())
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Error("the scrubbed error does not wrap the original")
+	}
+}
+
+func TestScrubHandler(t *testing.T) {
+	SetSecrets("config", "sk-provider-key")
+	defer SetSecrets("config")
+
+	var buf bytes.Buffer
+	log := slog.New(scrubHandler{slog.NewJSONHandler(&buf, nil)}).With("key", "sk-provider-key")
+	log.Warn("failed with sk-provider-key",
+		"error", errors.New("401: invalid key sk-provider-key"),
+		"headers", map[string]string{"Authorization": "Bearer sk-provider-key"},
+		slog.Group("request", "url", "https://host/v1?key=sk-provider-key"),
+		"status", 401)
+
+	out := buf.String()
+	if strings.Contains(out, "sk-provider-key") {
+		t.Errorf("secret logged: %s", out)
+	}
+	for _, want := range []string{`"msg":"failed with [REDACTED]"`, `"key":"[REDACTED]"`, `"error":"401: invalid key [REDACTED]"`, `"url":"https://host/v1?key=[REDACTED]"`, `"status":401`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %s in %s", want, out)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+// Package metrics keeps counters, gauges and histograms and writes them in the
+// Prometheus text exposition format
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ContentType is the content type of the text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Registry holds the metric families written on each scrape
+type Registry struct {
+	mu       sync.Mutex
+	families []family
+	sink     atomic.Pointer[sinkHolder]
+}
+
+// Sink receives the updates of counters and histograms as they happen, and the samples
+// of gauges when collected, to push the metrics to another system such as StatsD
+type Sink interface {
+	Count(name string, labels, values []string, delta float64)
+	Observe(name string, labels, values []string, value float64)
+	Gauge(name string, labels, values []string, value float64)
+}
+
+// sinkHolder holds the sink of a registry, as atomic.Pointer needs a concrete type
+type sinkHolder struct {
+	Sink
+}
+
+// family is a metric family that can write itself in the text format
+type family interface {
+	write(w *bufio.Writer)
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// register adds a family, written after those registered before it
+func (r *Registry) register(f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.families = append(r.families, f)
+}
+
+// SetSink sets the sink the registry's metrics are pushed to besides being scraped
+func (r *Registry) SetSink(sink Sink) {
+	r.sink.Store(&sinkHolder{sink})
+}
+
+// getSink returns the registry's sink, nil if none is set
+func (r *Registry) getSink() Sink {
+	if h := r.sink.Load(); h != nil {
+		return h.Sink
+	}
+	return nil
+}
+
+// CollectGauges sends the current samples of every gauge to the sink
+func (r *Registry) CollectGauges() {
+	sink := r.getSink()
+	if sink == nil {
+		return
+	}
+	r.mu.Lock()
+	families := slices.Clone(r.families)
+	r.mu.Unlock()
+	for _, f := range families {
+		if g, ok := f.(*GaugeFunc); ok {
+			g.collect(func(value float64, values ...string) {
+				sink.Gauge(g.name, g.labels, values, value)
+			})
+		}
+	}
+}
+
+// WriteTo writes every metric family in the text exposition format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	families := slices.Clone(r.families)
+	r.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, f := range families {
+		f.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// desc names and describes a metric family and its labels
+type desc struct {
+	name   string
+	help   string
+	kind   string // "counter", "gauge" or "histogram"
+	labels []string
+}
+
+// writeHeader writes the HELP and TYPE lines of the family
+func (d desc) writeHeader(w *bufio.Writer) {
+	w.WriteString("# HELP " + d.name + " " + escapeHelp(d.help) + "\n")
+	w.WriteString("# TYPE " + d.name + " " + d.kind + "\n")
+}
+
+// labelKey joins label values into a map key
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// writeSample writes one sample line: name{labels} value
+func writeSample(w *bufio.Writer, name string, labels, values []string, extra string, value float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extra != "" {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(label + `="` + escapeLabel(values[i]) + `"`)
+		}
+		if extra != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(extra)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatValue(value))
+	w.WriteByte('\n')
+}
+
+// formatValue formats a sample value, with +Inf, -Inf and NaN spelt as Prometheus expects
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+
+// sortedKeys returns the keys of a series map in order, so scrapes are stable
+func sortedKeys[V any](series map[string]V) []string {
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CounterVec is a counter per combination of label values
+type CounterVec struct {
+	desc
+	registry *Registry
+	mu       sync.Mutex
+	series   map[string]*counterSeries
+}
+
+type counterSeries struct {
+	values []string
+	value  float64
+}
+
+// NewCounterVec creates a counter family and registers it
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{desc: desc{name: name, help: help, kind: "counter", labels: labels}, registry: r, series: make(map[string]*counterSeries)}
+	r.register(c)
+	return c
+}
+
+// Inc adds one to the counter of the label values
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds v, which must not be negative, to the counter of the label values
+func (c *CounterVec) Add(v float64, values ...string) {
+	if v < 0 {
+		return
+	}
+	key := labelKey(values)
+	c.mu.Lock()
+	s, ok := c.series[key]
+	if !ok {
+		s = &counterSeries{values: slices.Clone(values)}
+		c.series[key] = s
+	}
+	s.value += v
+	c.mu.Unlock()
+	if sink := c.registry.getSink(); sink != nil {
+		sink.Count(c.name, c.labels, values, v)
+	}
+}
+
+// Value returns the counter of the label values
+func (c *CounterVec) Value(values ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s, ok := c.series[labelKey(values)]; ok {
+		return s.value
+	}
+	return 0
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeHeader(w)
+	for _, key := range sortedKeys(c.series) {
+		s := c.series[key]
+		writeSample(w, c.name, c.labels, s.values, "", s.value)
+	}
+}
+
+// HistogramVec is a histogram per combination of label values
+type HistogramVec struct {
+	desc
+	registry *Registry
+	buckets  []float64 // Upper bounds, ascending; +Inf is implied
+	mu       sync.Mutex
+	series   map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	values []string
+	counts []uint64 // Observations per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec creates a histogram family with the given bucket upper bounds and
+// registers it
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+	h := &HistogramVec{
+		desc:     desc{name: name, help: help, kind: "histogram", labels: labels},
+		registry: r,
+		buckets:  buckets,
+		series:   make(map[string]*histogramSeries),
+	}
+	r.register(h)
+	return h
+}
+
+// Observe adds an observation to the histogram of the label values
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	key := labelKey(values)
+	h.mu.Lock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{values: slices.Clone(values), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	if i, _ := slices.BinarySearch(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += v
+	h.mu.Unlock()
+	if sink := h.registry.getSink(); sink != nil {
+		sink.Observe(h.name, h.labels, values, v)
+	}
+}
+
+// Count returns the number of observations in the histogram of the label values
+func (h *HistogramVec) Count(values ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.series[labelKey(values)]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.writeHeader(w)
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			writeSample(w, h.name+"_bucket", h.labels, s.values, `le="`+formatValue(bound)+`"`, float64(cumulative))
+		}
+		writeSample(w, h.name+"_bucket", h.labels, s.values, `le="+Inf"`, float64(s.count))
+		writeSample(w, h.name+"_sum", h.labels, s.values, "", s.sum)
+		writeSample(w, h.name+"_count", h.labels, s.values, "", float64(s.count))
+	}
+}
+
+// GaugeFunc is a gauge family whose samples are collected on each scrape, for values
+// kept elsewhere such as requests in flight
+type GaugeFunc struct {
+	desc
+	collect func(emit func(value float64, values ...string))
+}
+
+// NewGaugeFunc creates a gauge family that calls collect on each scrape and registers
+// it. collect calls emit once per sample.
+func (r *Registry) NewGaugeFunc(name, help string, collect func(emit func(value float64, values ...string)), labels ...string) *GaugeFunc {
+	g := &GaugeFunc{desc: desc{name: name, help: help, kind: "gauge", labels: labels}, collect: collect}
+	r.register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	g.writeHeader(w)
+	g.collect(func(value float64, values ...string) {
+		writeSample(w, g.name, g.labels, values, "", value)
+	})
+}
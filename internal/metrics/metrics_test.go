@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("test_requests_total", "Requests served.", "path", "status")
+	latency := r.NewHistogramVec("test_latency_seconds", "Request latency.", []float64{1, 0.5}, "backend")
+	r.NewGaugeFunc("test_in_flight", "Requests in flight.", func(emit func(float64, ...string)) {
+		emit(3, "a")
+		emit(0, `b"\`)
+	}, "backend")
+
+	requests.Inc("/v1/models", "200")
+	requests.Add(2, "/health", "200")
+	requests.Add(-1, "/health", "200")
+	latency.Observe(0.5, "local/llama3")
+	latency.Observe(0.75, "local/llama3")
+	latency.Observe(3, "local/llama3")
+
+	var out strings.Builder
+	n, err := r.WriteTo(&out)
+	require.NoError(t, err)
+	assert.Equal(t, int64(out.Len()), n)
+	assert.Equal(t, `# HELP test_requests_total Requests served.
+# TYPE test_requests_total counter
+test_requests_total{path="/health",status="200"} 2
+test_requests_total{path="/v1/models",status="200"} 1
+# HELP test_latency_seconds Request latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{backend="local/llama3",le="0.5"} 1
+test_latency_seconds_bucket{backend="local/llama3",le="1"} 2
+test_latency_seconds_bucket{backend="local/llama3",le="+Inf"} 3
+test_latency_seconds_sum{backend="local/llama3"} 4.25
+test_latency_seconds_count{backend="local/llama3"} 3
+# HELP test_in_flight Requests in flight.
+# TYPE test_in_flight gauge
+test_in_flight{backend="a"} 3
+test_in_flight{backend="b\"\\"} 0
+`, out.String())
+
+	assert.Equal(t, float64(2), requests.Value("/health", "200"))
+	assert.Equal(t, uint64(3), latency.Count("local/llama3"))
+	assert.Zero(t, latency.Count("other"))
+}
+
+// recordingSink records what a registry pushes to it
+type recordingSink struct {
+	updates []string
+}
+
+func (s *recordingSink) Count(name string, labels, values []string, delta float64) {
+	s.updates = append(s.updates, "count "+name+" "+strings.Join(values, ",")+" "+formatValue(delta))
+}
+
+func (s *recordingSink) Observe(name string, labels, values []string, value float64) {
+	s.updates = append(s.updates, "observe "+name+" "+strings.Join(values, ",")+" "+formatValue(value))
+}
+
+func (s *recordingSink) Gauge(name string, labels, values []string, value float64) {
+	s.updates = append(s.updates, "gauge "+name+" "+strings.Join(values, ",")+" "+formatValue(value))
+}
+
+func TestRegistry_Sink(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("test_requests_total", "Requests served.", "path")
+	latency := r.NewHistogramVec("test_latency_seconds", "Request latency.", []float64{1}, "backend")
+	r.NewGaugeFunc("test_in_flight", "Requests in flight.", func(emit func(float64, ...string)) {
+		emit(3, "a")
+	}, "backend")
+
+	// Updates before a sink is set are only scraped
+	requests.Inc("/health")
+	r.CollectGauges()
+
+	sink := &recordingSink{}
+	r.SetSink(sink)
+	requests.Add(2, "/v1/models")
+	requests.Add(-1, "/v1/models")
+	latency.Observe(0.25, "local/llama3")
+	r.CollectGauges()
+
+	assert.Equal(t, []string{
+		"count test_requests_total /v1/models 2",
+		"observe test_latency_seconds local/llama3 0.25",
+		"gauge test_in_flight a 3",
+	}, sink.updates)
+	assert.Equal(t, float64(1), requests.Value("/health"))
+}
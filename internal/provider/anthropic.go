@@ -0,0 +1,215 @@
+// Package provider defines the provider interface and implementations
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/macedot/openmodel/internal/api/anthropic"
+	"github.com/macedot/openmodel/internal/api/openai"
+	"github.com/macedot/openmodel/internal/endpoints"
+)
+
+// anthropicAPIVersion is the anthropic-version sent to the Anthropic API unless the
+// request carries its own
+const anthropicAPIVersion = "2023-06-01"
+
+// TypeAnthropic is the provider type of the native Anthropic API
+const TypeAnthropic = "anthropic"
+
+// AnthropicProvider implements Provider for the native Anthropic Messages API. It
+// authenticates with x-api-key. Raw requests are forwarded as they are, the server
+// having converted them to the Messages format (api_mode "anthropic"); the typed chat
+// methods convert OpenAI chats to Messages requests and the responses and SSE events back.
+type AnthropicProvider struct {
+	*OpenAIProvider
+}
+
+// NewAnthropicProvider creates a new Anthropic provider
+func NewAnthropicProvider(name, baseURL, apiKey string) *AnthropicProvider {
+	return NewAnthropicProviderWithConfig(name, baseURL, apiKey, DefaultHTTPConfig())
+}
+
+// NewAnthropicProviderWithConfig creates a new Anthropic provider with custom HTTP config
+func NewAnthropicProviderWithConfig(name, baseURL, apiKey string, httpConfig HTTPConfig) *AnthropicProvider {
+	p := NewOpenAIProviderWithConfig(name, baseURL, apiKey, "anthropic", httpConfig)
+	p.anthropicAuth = true
+	// The Messages API has no embeddings and no response_format
+	p.capabilities.Embeddings = false
+	p.capabilities.JSONMode = false
+	return &AnthropicProvider{OpenAIProvider: p}
+}
+
+// DoRequest forwards a raw Messages request
+func (p *AnthropicProvider) DoRequest(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+	return p.OpenAIProvider.DoRequest(ctx, endpoint, body, p.withoutClientAuth(headers))
+}
+
+// DoMethodRequest forwards a raw request using the given HTTP method
+func (p *AnthropicProvider) DoMethodRequest(ctx context.Context, method, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+	return p.OpenAIProvider.DoMethodRequest(ctx, method, endpoint, body, p.withoutClientAuth(headers))
+}
+
+// DoStreamRequest forwards a raw streaming Messages request and returns its SSE lines
+func (p *AnthropicProvider) DoStreamRequest(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+	return p.OpenAIProvider.DoStreamRequest(ctx, endpoint, body, p.withoutClientAuth(headers))
+}
+
+// withoutClientAuth drops a client Authorization header forwarded by the server, which
+// would otherwise be sent to Anthropic alongside the provider's x-api-key
+func (p *AnthropicProvider) withoutClientAuth(headers map[string]string) map[string]string {
+	if _, ok := headers["Authorization"]; !ok || p.key() == "" {
+		return headers
+	}
+	filtered := make(map[string]string, len(headers))
+	for key, value := range headers {
+		if key != "Authorization" {
+			filtered[key] = value
+		}
+	}
+	return filtered
+}
+
+// ListModels lists the models available through the Anthropic API
+func (p *AnthropicProvider) ListModels(ctx context.Context) (*openai.ModelList, error) {
+	body, err := p.DoMethodRequest(ctx, "GET", endpoints.V1Models, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var page struct {
+		Data []struct {
+			ID        string    `json:"id"`
+			CreatedAt time.Time `json:"created_at"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &page); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	list := &openai.ModelList{Object: "list", Data: make([]openai.Model, 0, len(page.Data))}
+	for _, m := range page.Data {
+		model := openai.NewModel(m.ID, "anthropic")
+		model.Created = m.CreatedAt.Unix()
+		list.Data = append(list.Data, model)
+	}
+	return list, nil
+}
+
+// messagesRequest renders an OpenAI chat as a Messages request body: system messages
+// become the system prompt and the options map to their Messages equivalents
+func messagesRequest(model string, messages []openai.ChatCompletionMessage, opts *openai.ChatCompletionRequest, stream bool) ([]byte, error) {
+	req := openai.ChatCompletionRequest{
+		Model:    model,
+		Messages: messages,
+	}
+	copyRequestOptions(opts, &req, stream)
+
+	msgReq := anthropic.OpenAIToAnthropicRequest(&req)
+	msgReq.System = strings.TrimSuffix(msgReq.System, "\n")
+	body, err := json.Marshal(msgReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	return body, nil
+}
+
+// Chat sends a chat as a Messages request and returns the response in OpenAI format
+func (p *AnthropicProvider) Chat(ctx context.Context, model string, messages []openai.ChatCompletionMessage, opts *openai.ChatCompletionRequest) (*openai.ChatCompletionResponse, error) {
+	body, err := messagesRequest(model, messages, opts, false)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := p.DoRequest(ctx, endpoints.V1Messages, body, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var msgResp anthropic.MessagesResponse
+	if err := json.Unmarshal(respBody, &msgResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w (raw response: %s)", err, string(respBody))
+	}
+	return anthropic.AnthropicToOpenAIResponse(&msgResp), nil
+}
+
+// StreamChatRaw streams a chat as a Messages request, converting the SSE events to
+// OpenAI chat.completion.chunk lines ending with "data: [DONE]"
+func (p *AnthropicProvider) StreamChatRaw(ctx context.Context, model string, messages []openai.ChatCompletionMessage, opts *openai.ChatCompletionRequest) (<-chan []byte, error) {
+	body, err := messagesRequest(model, messages, opts, true)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := p.DoStreamRequest(ctx, endpoints.V1Messages, body, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	includeUsage := opts != nil && opts.StreamOptions != nil && opts.StreamOptions.IncludeUsage
+	id := fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano())
+	metrics := &anthropic.StreamMetrics{}
+
+	ch := make(chan []byte, 10)
+	go func() {
+		defer close(ch)
+		for event := range events {
+			line := string(event)
+			// Event names are repeated in the data
+			if !strings.HasPrefix(line, "data:") {
+				continue
+			}
+			converted := anthropic.ConvertAnthropicStreamToOpenAIWithMetrics(line, model, id, metrics, includeUsage)
+			if converted == line {
+				continue // ping and other events without an OpenAI equivalent
+			}
+			for _, out := range strings.Split(converted, "\n") {
+				if !strings.HasPrefix(out, "data: ") {
+					continue
+				}
+				select {
+				case ch <- []byte(out):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// StreamChat streams a chat as a Messages request, returning OpenAI chunks
+func (p *AnthropicProvider) StreamChat(ctx context.Context, model string, messages []openai.ChatCompletionMessage, opts *openai.ChatCompletionRequest) (<-chan openai.ChatCompletionResponse, error) {
+	lines, err := p.StreamChatRaw(ctx, model, messages, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseChatLines(ctx, lines), nil
+}
+
+// Complete is not supported: the Anthropic API has no legacy completions
+func (p *AnthropicProvider) Complete(ctx context.Context, model string, req *openai.CompletionRequest) (*openai.CompletionResponse, error) {
+	return nil, fmt.Errorf("provider %q: completions: %w", p.name, ErrUnsupported)
+}
+
+// StreamComplete is not supported: the Anthropic API has no legacy completions
+func (p *AnthropicProvider) StreamComplete(ctx context.Context, model string, req *openai.CompletionRequest) (<-chan openai.CompletionResponse, error) {
+	return nil, fmt.Errorf("provider %q: completions: %w", p.name, ErrUnsupported)
+}
+
+// Embed is not supported: the Anthropic API has no embeddings
+func (p *AnthropicProvider) Embed(ctx context.Context, model string, input []string) (*openai.EmbeddingResponse, error) {
+	return nil, fmt.Errorf("provider %q: embeddings: %w", p.name, ErrUnsupported)
+}
+
+// Moderate is not supported: the Anthropic API has no moderation endpoint
+func (p *AnthropicProvider) Moderate(ctx context.Context, input string) (*openai.ModerationResponse, error) {
+	return nil, fmt.Errorf("provider %q: moderation: %w", p.name, ErrUnsupported)
+}
+
+// Interface assertion
+var _ Provider = (*AnthropicProvider)(nil)
@@ -0,0 +1,195 @@
+// Package provider provides tests for the provider implementations
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/macedot/openmodel/internal/api/anthropic"
+	"github.com/macedot/openmodel/internal/api/openai"
+)
+
+// newTestAnthropicProvider creates an Anthropic provider pointing to a test server
+func newTestAnthropicProvider(serverURL string) *AnthropicProvider {
+	provider := NewAnthropicProvider("claude", serverURL, "test-api-key")
+	transport := &testTransport{}
+	provider.httpClient = &http.Client{Transport: transport, Timeout: provider.httpClient.Timeout}
+	provider.cachedStreamClient = &http.Client{Transport: transport}
+	return provider
+}
+
+// checkAnthropicHeaders fails the test unless the request authenticates like the Anthropic API
+func checkAnthropicHeaders(t *testing.T, r *http.Request) {
+	t.Helper()
+	if got := r.Header.Get("x-api-key"); got != "test-api-key" {
+		t.Errorf("expected x-api-key test-api-key, got %q", got)
+	}
+	if got := r.Header.Get("anthropic-version"); got != anthropicAPIVersion {
+		t.Errorf("expected anthropic-version %s, got %q", anthropicAPIVersion, got)
+	}
+	if got := r.Header.Get("Authorization"); got != "" {
+		t.Errorf("expected no Authorization header, got %q", got)
+	}
+}
+
+func TestAnthropicChat(t *testing.T) {
+	server := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checkAnthropicHeaders(t, r)
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("expected /v1/messages path, got %s", r.URL.Path)
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		var req anthropic.MessagesRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		if req.System != "Be brief." {
+			t.Errorf("expected system prompt %q, got %q", "Be brief.", req.System)
+		}
+		if len(req.Messages) != 1 || req.Messages[0].Role != "user" {
+			t.Errorf("expected the system message lifted out of messages, got %+v", req.Messages)
+		}
+		if req.MaxTokens != 256 {
+			t.Errorf("expected max_tokens 256, got %d", req.MaxTokens)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4","content":[{"type":"text","text":"Hello"},{"type":"text","text":" there"}],"stop_reason":"end_turn","usage":{"input_tokens":12,"output_tokens":3}}`))
+	}))
+	defer server.Close()
+
+	maxTokens := 256
+	resp, err := newTestAnthropicProvider(server.URL).Chat(context.Background(), "claude-sonnet-4", []openai.ChatCompletionMessage{
+		{Role: "system", Content: "Be brief."},
+		{Role: "user", Content: "Hi"},
+	}, &openai.ChatCompletionRequest{MaxTokens: &maxTokens})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Choices) != 1 || resp.Choices[0].Message.Content != "Hello there" {
+		t.Errorf("expected content blocks joined, got %+v", resp.Choices)
+	}
+	if resp.Usage == nil || resp.Usage.TotalTokens != 15 {
+		t.Errorf("expected 15 total tokens, got %+v", resp.Usage)
+	}
+}
+
+func TestAnthropicStreamChat(t *testing.T) {
+	server := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checkAnthropicHeaders(t, r)
+		body, _ := io.ReadAll(r.Body)
+		var req anthropic.MessagesRequest
+		json.Unmarshal(body, &req)
+		if !req.Stream {
+			t.Error("expected streaming request")
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		events := []string{
+			"event: message_start",
+			`data: {"type":"message_start","message":{"id":"msg_1","usage":{"input_tokens":5}}}`,
+			"",
+			"event: ping",
+			`data: {"type":"ping"}`,
+			"",
+			`data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+			`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hel"}}`,
+			`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"lo"}}`,
+			`data: {"type":"content_block_stop","index":0}`,
+			`data: {"type":"message_delta","delta":{"stop_reason":"max_tokens"},"usage":{"output_tokens":2}}`,
+			`data: {"type":"message_stop"}`,
+		}
+		for _, event := range events {
+			w.Write([]byte(event + "\n"))
+		}
+	}))
+	defer server.Close()
+
+	ch, err := newTestAnthropicProvider(server.URL).StreamChat(context.Background(), "claude-sonnet-4",
+		[]openai.ChatCompletionMessage{{Role: "user", Content: "Hi"}}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var content, finishReason string
+	chunks := 0
+	for chunk := range ch {
+		chunks++
+		for _, c := range chunk.Choices {
+			if c.Delta != nil {
+				content += c.Delta.Content
+			}
+			if c.FinishReason != "" {
+				finishReason = c.FinishReason
+			}
+		}
+	}
+	if chunks != 4 {
+		t.Errorf("expected 4 chunks (role, 2 deltas, finish), got %d", chunks)
+	}
+	if content != "Hello" {
+		t.Errorf("expected content Hello, got %q", content)
+	}
+	if finishReason != "length" {
+		t.Errorf("expected finish reason length, got %q", finishReason)
+	}
+}
+
+func TestAnthropicListModels(t *testing.T) {
+	server := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checkAnthropicHeaders(t, r)
+		if r.Method != "GET" || r.URL.Path != "/v1/models" {
+			t.Errorf("expected GET /v1/models, got %s %s", r.Method, r.URL.Path)
+		}
+		w.Write([]byte(`{"data":[{"type":"model","id":"claude-sonnet-4","display_name":"Claude Sonnet 4","created_at":"2025-05-22T00:00:00Z"}],"has_more":false}`))
+	}))
+	defer server.Close()
+
+	list, err := newTestAnthropicProvider(server.URL).ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(list.Data) != 1 || list.Data[0].ID != "claude-sonnet-4" || list.Data[0].OwnedBy != "anthropic" {
+		t.Fatalf("unexpected models: %+v", list.Data)
+	}
+	if list.Data[0].Created != 1747872000 {
+		t.Errorf("expected created 1747872000, got %d", list.Data[0].Created)
+	}
+}
+
+func TestAnthropicDoRequest_DropsClientAuthorization(t *testing.T) {
+	server := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checkAnthropicHeaders(t, r)
+		if got := r.Header.Get("anthropic-beta"); got != "tools-2024" {
+			t.Errorf("expected forwarded anthropic-beta header, got %q", got)
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	_, err := newTestAnthropicProvider(server.URL).DoRequest(context.Background(), "/v1/messages", []byte(`{}`), map[string]string{
+		"Authorization":  "Bearer client-token",
+		"anthropic-beta": "tools-2024",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestAnthropicUnsupported(t *testing.T) {
+	p := NewAnthropicProvider("claude", "http://unused", "key")
+	if _, err := p.Embed(context.Background(), "m", []string{"x"}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported from Embed, got %v", err)
+	}
+	if _, err := p.Complete(context.Background(), "m", &openai.CompletionRequest{}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported from Complete, got %v", err)
+	}
+	if p.APIMode() != "anthropic" {
+		t.Errorf("expected api mode anthropic, got %q", p.APIMode())
+	}
+}
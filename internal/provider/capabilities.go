@@ -0,0 +1,81 @@
+// Package provider defines the provider interface and implementations
+package provider
+
+// Capability names, as used in the capabilities config setting
+const (
+	CapabilityTools      = "tools"
+	CapabilityVision     = "vision"
+	CapabilityJSONMode   = "json_mode"
+	CapabilityEmbeddings = "embeddings"
+)
+
+// Capabilities describes what a provider's models support: its type's defaults unless
+// configured (see Spec.Capabilities)
+type Capabilities struct {
+	Tools      bool // Function/tool calling
+	Vision     bool // Image inputs
+	JSONMode   bool // response_format json_object/json_schema
+	Embeddings bool // Embedding requests
+	Streaming  bool // Streamed responses
+	MaxContext int  // Context window in tokens, 0 when unknown
+}
+
+// AllCapabilities returns capabilities with every feature supported and no known context window
+func AllCapabilities() Capabilities {
+	return Capabilities{Tools: true, Vision: true, JSONMode: true, Embeddings: true, Streaming: true}
+}
+
+// Names returns the names of the supported capabilities, in the order of the Capability*
+// constants. Streaming has no name: every request can be served without it.
+func (c Capabilities) Names() []string {
+	names := []string{}
+	for _, capability := range []struct {
+		name      string
+		supported bool
+	}{
+		{CapabilityTools, c.Tools},
+		{CapabilityVision, c.Vision},
+		{CapabilityJSONMode, c.JSONMode},
+		{CapabilityEmbeddings, c.Embeddings},
+	} {
+		if capability.supported {
+			names = append(names, capability.name)
+		}
+	}
+	return names
+}
+
+// withNames returns c with the named capabilities supported and the others not
+func (c Capabilities) withNames(names []string) Capabilities {
+	c.Tools, c.Vision, c.JSONMode, c.Embeddings = false, false, false, false
+	for _, name := range names {
+		switch name {
+		case CapabilityTools:
+			c.Tools = true
+		case CapabilityVision:
+			c.Vision = true
+		case CapabilityJSONMode:
+			c.JSONMode = true
+		case CapabilityEmbeddings:
+			c.Embeddings = true
+		}
+	}
+	return c
+}
+
+// capabilitiesSetter is implemented by providers whose capabilities can be configured
+type capabilitiesSetter interface {
+	setCapabilities(capabilities Capabilities)
+}
+
+// configuredCapabilities applies the capabilities and context window of spec to the
+// defaults of a provider type
+func configuredCapabilities(defaults Capabilities, spec Spec) Capabilities {
+	if spec.Capabilities != nil {
+		defaults = defaults.withNames(spec.Capabilities)
+	}
+	if spec.MaxContext > 0 {
+		defaults.MaxContext = spec.MaxContext
+	}
+	return defaults
+}
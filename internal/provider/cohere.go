@@ -0,0 +1,256 @@
+// Package provider defines the provider interface and implementations
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/macedot/openmodel/internal/api/cohere"
+	"github.com/macedot/openmodel/internal/api/openai"
+	"github.com/macedot/openmodel/internal/endpoints"
+)
+
+// TypeCohere is the provider type of the native Cohere v2 API
+const TypeCohere = "cohere"
+
+// CohereProvider implements Provider for the Cohere v2 chat and embed APIs. It speaks
+// OpenAI to the server (api_mode "openai"): chat completion and embedding requests are
+// translated to /v2/chat and /v2/embed, and the responses and stream events back.
+type CohereProvider struct {
+	*OpenAIProvider
+}
+
+// NewCohereProvider creates a new Cohere provider
+func NewCohereProvider(name, baseURL, apiKey string) *CohereProvider {
+	return NewCohereProviderWithConfig(name, baseURL, apiKey, DefaultHTTPConfig())
+}
+
+// NewCohereProviderWithConfig creates a new Cohere provider with custom HTTP config
+func NewCohereProviderWithConfig(name, baseURL, apiKey string, httpConfig HTTPConfig) *CohereProvider {
+	p := NewOpenAIProviderWithConfig(name, baseURL, apiKey, "openai", httpConfig)
+	// Image content parts are not translated to Cohere's chat format
+	p.capabilities.Vision = false
+	return &CohereProvider{OpenAIProvider: p}
+}
+
+// DoRequest translates an OpenAI chat completion or embedding request
+func (p *CohereProvider) DoRequest(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+	var (
+		resp any
+		err  error
+	)
+	switch endpoint {
+	case endpoints.V1ChatCompletions:
+		var req *openai.ChatCompletionRequest
+		if req, err = openai.ParseChatCompletionRequest(body); err != nil {
+			return nil, fmt.Errorf("failed to parse request: %w", err)
+		}
+		resp, err = p.chat(ctx, req, headers)
+	case endpoints.V1Embeddings:
+		var req struct {
+			openai.EmbeddingRequest
+			InputType string `json:"input_type"` // Cohere extension, search_document by default
+		}
+		if err = json.Unmarshal(body, &req); err != nil {
+			return nil, fmt.Errorf("failed to parse request: %w", err)
+		}
+		texts, ok := embeddingTexts(req.Input)
+		if !ok {
+			return nil, fmt.Errorf("provider %q: embedding input must be text", p.name)
+		}
+		resp, err = p.embed(ctx, cohere.OpenAIToCohereEmbed(req.Model, texts, req.InputType, req.Dimensions), headers)
+	default:
+		return nil, fmt.Errorf("provider %q: %s: %w", p.name, endpoint, ErrUnsupported)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(resp)
+}
+
+// DoStreamRequest translates a streaming OpenAI chat completion request, returning the
+// stream as chat.completion.chunk SSE lines ending with "data: [DONE]"
+func (p *CohereProvider) DoStreamRequest(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+	if endpoint != endpoints.V1ChatCompletions {
+		return nil, fmt.Errorf("provider %q: %s: %w", p.name, endpoint, ErrUnsupported)
+	}
+	req, err := openai.ParseChatCompletionRequest(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse request: %w", err)
+	}
+	cohereReq := cohere.OpenAIToCohereRequest(req)
+	cohereReq.Stream = true
+	cohereBody, err := json.Marshal(cohereReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	events, err := p.OpenAIProvider.DoStreamRequest(ctx, endpoints.V2Chat, cohereBody, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan []byte, 10)
+	go func() {
+		defer close(ch)
+		state := &cohere.StreamState{Model: req.Model}
+		send := func(line string) bool {
+			select {
+			case ch <- []byte(line):
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		for event := range events {
+			data := strings.TrimSpace(string(event))
+			if data == "" || strings.HasPrefix(data, "event:") {
+				continue
+			}
+			data = strings.TrimSpace(strings.TrimPrefix(data, "data:"))
+			chunks, done := cohere.ConvertStreamEvent(data, state)
+			for _, chunk := range chunks {
+				encoded, err := json.Marshal(chunk)
+				if err != nil {
+					continue
+				}
+				if !send("data: "+string(encoded)) || !send("") {
+					return
+				}
+			}
+			if done {
+				send("data: [DONE]")
+				send("")
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// chat sends a chat to /v2/chat
+func (p *CohereProvider) chat(ctx context.Context, req *openai.ChatCompletionRequest, headers map[string]string) (*openai.ChatCompletionResponse, error) {
+	cohereReq := cohere.OpenAIToCohereRequest(req)
+	cohereReq.Stream = false
+	body, err := json.Marshal(cohereReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	respBody, err := p.OpenAIProvider.DoRequest(ctx, endpoints.V2Chat, body, headers)
+	if err != nil {
+		return nil, err
+	}
+	var resp cohere.ChatResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w (raw response: %s)", err, string(respBody))
+	}
+	return cohere.CohereToOpenAIResponse(&resp, req.Model), nil
+}
+
+// embed sends an embed request to /v2/embed
+func (p *CohereProvider) embed(ctx context.Context, req *cohere.EmbedRequest, headers map[string]string) (*openai.EmbeddingResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	respBody, err := p.OpenAIProvider.DoRequest(ctx, endpoints.V2Embed, body, headers)
+	if err != nil {
+		return nil, err
+	}
+	var resp cohere.EmbedResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return cohere.CohereToOpenAIEmbed(&resp, req.Model), nil
+}
+
+// embeddingTexts returns the texts of an OpenAI embedding input, false for token arrays
+func embeddingTexts(input any) ([]string, bool) {
+	switch v := input.(type) {
+	case string:
+		return []string{v}, true
+	case []any:
+		texts := make([]string, 0, len(v))
+		for _, item := range v {
+			text, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			texts = append(texts, text)
+		}
+		return texts, true
+	}
+	return nil, false
+}
+
+// ListModels lists the models available through the Cohere API
+func (p *CohereProvider) ListModels(ctx context.Context) (*openai.ModelList, error) {
+	body, err := p.DoMethodRequest(ctx, "GET", endpoints.V1Models, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var models cohere.ModelList
+	if err := json.Unmarshal(body, &models); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	list := &openai.ModelList{Object: "list", Data: make([]openai.Model, 0, len(models.Models))}
+	for _, m := range models.Models {
+		list.Data = append(list.Data, openai.NewModel(m.Name, "cohere"))
+	}
+	return list, nil
+}
+
+// Chat sends a chat to /v2/chat and returns the response in OpenAI format
+func (p *CohereProvider) Chat(ctx context.Context, model string, messages []openai.ChatCompletionMessage, opts *openai.ChatCompletionRequest) (*openai.ChatCompletionResponse, error) {
+	req := &openai.ChatCompletionRequest{Model: model, Messages: messages}
+	copyRequestOptions(opts, req, false)
+	return p.chat(ctx, req, nil)
+}
+
+// StreamChatRaw streams a chat from /v2/chat as OpenAI chat.completion.chunk SSE lines
+func (p *CohereProvider) StreamChatRaw(ctx context.Context, model string, messages []openai.ChatCompletionMessage, opts *openai.ChatCompletionRequest) (<-chan []byte, error) {
+	req := openai.ChatCompletionRequest{Model: model, Messages: messages}
+	copyRequestOptions(opts, &req, true)
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	return p.DoStreamRequest(ctx, endpoints.V1ChatCompletions, body, nil)
+}
+
+// StreamChat streams a chat from /v2/chat, returning OpenAI chunks
+func (p *CohereProvider) StreamChat(ctx context.Context, model string, messages []openai.ChatCompletionMessage, opts *openai.ChatCompletionRequest) (<-chan openai.ChatCompletionResponse, error) {
+	lines, err := p.StreamChatRaw(ctx, model, messages, opts)
+	if err != nil {
+		return nil, err
+	}
+	return parseChatLines(ctx, lines), nil
+}
+
+// Embed embeds texts as search documents
+func (p *CohereProvider) Embed(ctx context.Context, model string, input []string) (*openai.EmbeddingResponse, error) {
+	return p.embed(ctx, cohere.OpenAIToCohereEmbed(model, input, "", 0), nil)
+}
+
+// Complete is not supported: the Cohere v2 API has no legacy completions
+func (p *CohereProvider) Complete(ctx context.Context, model string, req *openai.CompletionRequest) (*openai.CompletionResponse, error) {
+	return nil, fmt.Errorf("provider %q: completions: %w", p.name, ErrUnsupported)
+}
+
+// StreamComplete is not supported: the Cohere v2 API has no legacy completions
+func (p *CohereProvider) StreamComplete(ctx context.Context, model string, req *openai.CompletionRequest) (<-chan openai.CompletionResponse, error) {
+	return nil, fmt.Errorf("provider %q: completions: %w", p.name, ErrUnsupported)
+}
+
+// Moderate is not supported: the Cohere API has no moderation endpoint
+func (p *CohereProvider) Moderate(ctx context.Context, input string) (*openai.ModerationResponse, error) {
+	return nil, fmt.Errorf("provider %q: moderation: %w", p.name, ErrUnsupported)
+}
+
+// Interface assertion
+var _ Provider = (*CohereProvider)(nil)
@@ -0,0 +1,147 @@
+// Package provider provides tests for the provider implementations
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/macedot/openmodel/internal/api/cohere"
+	"github.com/macedot/openmodel/internal/api/openai"
+	"github.com/macedot/openmodel/internal/endpoints"
+)
+
+// newTestCohereProvider creates a Cohere provider pointing to a test server
+func newTestCohereProvider(serverURL string) *CohereProvider {
+	provider := NewCohereProvider("cohere", serverURL, "test-api-key")
+	transport := &testTransport{}
+	provider.httpClient = &http.Client{Transport: transport, Timeout: provider.httpClient.Timeout}
+	provider.cachedStreamClient = &http.Client{Transport: transport}
+	return provider
+}
+
+func TestCohereDoRequest_Chat(t *testing.T) {
+	server := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/chat" {
+			t.Errorf("expected /v2/chat path, got %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer test-api-key" {
+			t.Errorf("expected bearer auth, got %q", got)
+		}
+		body, _ := io.ReadAll(r.Body)
+		var req cohere.ChatRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		if req.Model != "command-r" || len(req.Messages) != 2 || req.Messages[0].Role != "system" {
+			t.Errorf("unexpected request: %s", body)
+		}
+		if req.P == nil || *req.P != 0.5 {
+			t.Errorf("expected top_p sent as p, got %s", body)
+		}
+		w.Write([]byte(`{"id":"c1","finish_reason":"COMPLETE","message":{"role":"assistant","content":[{"type":"text","text":"Hello"}]},"usage":{"tokens":{"input_tokens":5,"output_tokens":1}}}`))
+	}))
+	defer server.Close()
+
+	body := `{"model":"command-r","top_p":0.5,"messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"Hi"}]}`
+	respBody, err := newTestCohereProvider(server.URL).DoRequest(context.Background(), endpoints.V1ChatCompletions, []byte(body), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var resp openai.ChatCompletionResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Object != "chat.completion" || len(resp.Choices) != 1 || resp.Choices[0].Message.Content != "Hello" {
+		t.Errorf("unexpected response: %s", respBody)
+	}
+	if resp.Usage == nil || resp.Usage.TotalTokens != 6 {
+		t.Errorf("expected 6 total tokens, got %s", respBody)
+	}
+}
+
+func TestCohereDoStreamRequest(t *testing.T) {
+	server := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), `"stream":true`) {
+			t.Errorf("expected streaming request, got %s", body)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		events := []string{
+			"event: message-start",
+			`data: {"type":"message-start","id":"c1","delta":{"message":{"role":"assistant"}}}`,
+			"",
+			"event: content-delta",
+			`data: {"type":"content-delta","index":0,"delta":{"message":{"content":{"text":"Hel"}}}}`,
+			"",
+			`data: {"type":"content-delta","index":0,"delta":{"message":{"content":{"text":"lo"}}}}`,
+			`data: {"type":"content-end","index":0}`,
+			`data: {"type":"message-end","delta":{"finish_reason":"COMPLETE","usage":{"tokens":{"input_tokens":5,"output_tokens":2}}}}`,
+		}
+		for _, event := range events {
+			w.Write([]byte(event + "\n"))
+		}
+	}))
+	defer server.Close()
+
+	lines, err := newTestCohereProvider(server.URL).DoStreamRequest(context.Background(), endpoints.V1ChatCompletions,
+		[]byte(`{"model":"command-r","stream":true,"messages":[{"role":"user","content":"Hi"}]}`), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got []string
+	for line := range lines {
+		if len(line) > 0 {
+			got = append(got, string(line))
+		}
+	}
+	if len(got) != 5 || got[len(got)-1] != "data: [DONE]" {
+		t.Fatalf("expected 4 chunks and [DONE], got %q", got)
+	}
+	if !strings.Contains(got[1], `"content":"Hel"`) || !strings.Contains(got[3], `"finish_reason":"stop"`) || !strings.Contains(got[3], `"total_tokens":7`) {
+		t.Errorf("unexpected chunks: %q", got)
+	}
+}
+
+func TestCohereEmbed(t *testing.T) {
+	server := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/embed" {
+			t.Errorf("expected /v2/embed path, got %s", r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		var req cohere.EmbedRequest
+		json.Unmarshal(body, &req)
+		if req.InputType != "search_query" || len(req.Texts) != 2 {
+			t.Errorf("unexpected request: %s", body)
+		}
+		w.Write([]byte(`{"id":"e1","embeddings":{"float":[[0.1],[0.2]]},"meta":{"billed_units":{"input_tokens":4}}}`))
+	}))
+	defer server.Close()
+
+	p := newTestCohereProvider(server.URL)
+	respBody, err := p.DoRequest(context.Background(), endpoints.V1Embeddings,
+		[]byte(`{"model":"embed-v4.0","input":["a","b"],"input_type":"search_query"}`), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var resp openai.EmbeddingResponse
+	json.Unmarshal(respBody, &resp)
+	if len(resp.Data) != 2 || resp.Data[1].Embedding[0] != 0.2 || resp.Usage.PromptTokens != 4 {
+		t.Errorf("unexpected response: %s", respBody)
+	}
+
+	_, err = p.DoRequest(context.Background(), endpoints.V1Embeddings, []byte(`{"model":"embed-v4.0","input":[[1,2]]}`), nil)
+	if err == nil {
+		t.Error("expected an error for token array input")
+	}
+	_, err = p.DoRequest(context.Background(), endpoints.V1Completions, []byte(`{}`), nil)
+	if !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported for completions, got %v", err)
+	}
+}
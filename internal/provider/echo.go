@@ -0,0 +1,285 @@
+// Package provider defines the provider interface and implementations
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/macedot/openmodel/internal/api/openai"
+	"github.com/macedot/openmodel/internal/endpoints"
+)
+
+// TypeEcho is the provider type answering with the prompt, for smoke tests and demos
+const TypeEcho = "echo"
+
+// EchoConfig sets the artificial latency of an echo provider
+type EchoConfig struct {
+	Delay      time.Duration // Before the response, or its first token
+	TokenDelay time.Duration // Between streamed tokens
+}
+
+// EchoProvider implements Provider without a backend: chat completions answer with the
+// last user message and completions with the prompt, streamed one word per chunk, for
+// any model. Token counts are word counts. Other endpoints are not served.
+type EchoProvider struct {
+	rawMethods
+	name         string
+	config       EchoConfig
+	capabilities Capabilities
+	nextID       atomic.Uint64
+}
+
+// NewEchoProvider creates an echo provider; the spec's URL and HTTP settings do not apply
+func NewEchoProvider(spec Spec, config EchoConfig) *EchoProvider {
+	p := &EchoProvider{
+		name:   spec.Name,
+		config: config,
+		// Tools and images are accepted and ignored
+		capabilities: configuredCapabilities(Capabilities{Tools: true, Vision: true, JSONMode: true, Streaming: true}, spec),
+	}
+	p.rawMethods = rawMethods{raw: p}
+	return p
+}
+
+// Name returns the provider name
+func (p *EchoProvider) Name() string {
+	return p.name
+}
+
+// BaseURL returns an empty URL: there is no backend
+func (p *EchoProvider) BaseURL() string {
+	return ""
+}
+
+// APIMode returns "openai": requests are answered in the OpenAI format
+func (p *EchoProvider) APIMode() string {
+	return "openai"
+}
+
+// Capabilities returns what the provider supports: everything but embeddings unless configured
+func (p *EchoProvider) Capabilities() Capabilities {
+	return p.capabilities
+}
+
+// Close does nothing: there are no connections
+func (p *EchoProvider) Close() error {
+	return nil
+}
+
+// echoRequest holds the fields of chat and completion requests the echo provider reads
+type echoRequest struct {
+	Model    string `json:"model"`
+	Messages []struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	} `json:"messages"`
+	Prompt        json.RawMessage       `json:"prompt"`
+	StreamOptions *openai.StreamOptions `json:"stream_options"`
+}
+
+// text returns what the request is answered with: the text of the last user message, or
+// the prompt (the first one of a list)
+func (r echoRequest) text() string {
+	for i := len(r.Messages) - 1; i >= 0; i-- {
+		if r.Messages[i].Role == "user" {
+			return contentText(r.Messages[i].Content)
+		}
+	}
+	var prompt string
+	if json.Unmarshal(r.Prompt, &prompt) == nil {
+		return prompt
+	}
+	var prompts []string
+	if json.Unmarshal(r.Prompt, &prompts) == nil && len(prompts) > 0 {
+		return prompts[0]
+	}
+	return ""
+}
+
+// promptText returns all the text the request sends, for its token count
+func (r echoRequest) promptText() string {
+	if len(r.Messages) == 0 {
+		return r.text()
+	}
+	texts := make([]string, 0, len(r.Messages))
+	for _, msg := range r.Messages {
+		texts = append(texts, contentText(msg.Content))
+	}
+	return strings.Join(texts, " ")
+}
+
+// contentText returns the text of message content: a string or a list of parts
+func contentText(content json.RawMessage) string {
+	var text string
+	if json.Unmarshal(content, &text) == nil {
+		return text
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	_ = json.Unmarshal(content, &parts)
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, " ")
+}
+
+// parse reads a chat or completion request body
+func (p *EchoProvider) parse(endpoint string, body []byte) (echoRequest, error) {
+	var req echoRequest
+	if endpoint != endpoints.V1ChatCompletions && endpoint != endpoints.V1Completions {
+		return req, &StatusError{
+			StatusCode: http.StatusNotFound,
+			Err:        &openai.ErrorResponse{Err: &openai.ErrorDetail{Message: fmt.Sprintf("echo provider does not serve %s", endpoint), Type: "not_found_error"}},
+		}
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return req, &StatusError{
+			StatusCode: http.StatusBadRequest,
+			Err:        &openai.ErrorResponse{Err: &openai.ErrorDetail{Message: "invalid request body: " + err.Error(), Type: "invalid_request_error"}},
+		}
+	}
+	return req, nil
+}
+
+// sleepContext sleeps for d unless ctx is done first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// usage counts the words of the prompt and the answer
+func (r echoRequest) usage() *openai.Usage {
+	prompt, completion := len(strings.Fields(r.promptText())), len(strings.Fields(r.text()))
+	return &openai.Usage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion}
+}
+
+// DoRequest answers a chat or completion request with its prompt
+func (p *EchoProvider) DoRequest(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+	req, err := p.parse(endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	if err := sleepContext(ctx, p.config.Delay); err != nil {
+		return nil, err
+	}
+
+	id, created := fmt.Sprintf("echo-%d", p.nextID.Add(1)), time.Now().Unix()
+	if endpoint == endpoints.V1Completions {
+		return json.Marshal(openai.CompletionResponse{
+			ID: id, Object: "text_completion", Created: created, Model: req.Model,
+			Choices: []openai.CompletionChoice{{Text: req.text(), FinishReason: "stop"}},
+			Usage:   req.usage(),
+		})
+	}
+	return json.Marshal(openai.ChatCompletionResponse{
+		ID: id, Object: "chat.completion", Created: created, Model: req.Model,
+		Choices: []openai.ChatCompletionChoice{{Message: &openai.ChatCompletionMessage{Role: "assistant", Content: req.text()}, FinishReason: "stop"}},
+		Usage:   req.usage(),
+	})
+}
+
+// DoMethodRequest serves GET /v1/models, listing an "echo" model; other requests are
+// answered like DoRequest
+func (p *EchoProvider) DoMethodRequest(ctx context.Context, method, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+	if method == http.MethodGet && endpoint == endpoints.V1Models {
+		return json.Marshal(openai.ModelList{Object: "list", Data: []openai.Model{openai.NewModel("echo", p.name)}})
+	}
+	return p.DoRequest(ctx, endpoint, body, headers)
+}
+
+// DoStreamRequest streams the prompt of a chat or completion request one word per chunk
+func (p *EchoProvider) DoStreamRequest(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+	req, err := p.parse(endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+
+	id, created := fmt.Sprintf("echo-%d", p.nextID.Add(1)), time.Now().Unix()
+	chunk := func(text string, finishReason *string, usage *openai.Usage) any {
+		if endpoint == endpoints.V1Completions {
+			resp := openai.CompletionResponse{ID: id, Object: "text_completion", Created: created, Model: req.Model, Usage: usage, Choices: []openai.CompletionChoice{}}
+			if usage == nil {
+				reason := ""
+				if finishReason != nil {
+					reason = *finishReason
+				}
+				resp.Choices = append(resp.Choices, openai.CompletionChoice{Text: text, FinishReason: reason})
+			}
+			return resp
+		}
+		resp := openai.ChatCompletionChunk{ID: id, Object: "chat.completion.chunk", Created: created, Model: req.Model, Usage: usage, Choices: []openai.ChatCompletionChunkChoice{}}
+		if usage == nil {
+			resp.Choices = append(resp.Choices, openai.ChatCompletionChunkChoice{Delta: openai.ChatCompletionDelta{Content: text}, FinishReason: finishReason})
+		}
+		return resp
+	}
+
+	// Words keep their trailing whitespace, so the chunks add up to the prompt
+	var tokens []string
+	for _, word := range strings.SplitAfter(req.text(), " ") {
+		if word != "" {
+			tokens = append(tokens, word)
+		}
+	}
+	stop := "stop"
+	chunks := make([]any, 0, len(tokens)+3)
+	if endpoint == endpoints.V1ChatCompletions {
+		role := chunk("", nil, nil).(openai.ChatCompletionChunk)
+		role.Choices[0].Delta.Role = "assistant"
+		chunks = append(chunks, role)
+	}
+	first := len(chunks)
+	for _, token := range tokens {
+		chunks = append(chunks, chunk(token, nil, nil))
+	}
+	chunks = append(chunks, chunk("", &stop, nil))
+	if req.StreamOptions != nil && req.StreamOptions.IncludeUsage {
+		chunks = append(chunks, chunk("", nil, req.usage()))
+	}
+
+	ch := make(chan []byte, 10)
+	go func() {
+		defer close(ch)
+		send := func(line string) bool {
+			select {
+			case ch <- []byte(line):
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		if sleepContext(ctx, p.config.Delay) != nil {
+			return
+		}
+		for i, c := range chunks {
+			if i > first && i < first+len(tokens) && sleepContext(ctx, p.config.TokenDelay) != nil {
+				return
+			}
+			data, err := json.Marshal(c)
+			if err != nil || !send("data: "+string(data)) || !send("") {
+				return
+			}
+		}
+		send("data: [DONE]")
+	}()
+	return ch, nil
+}
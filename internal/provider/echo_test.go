@@ -0,0 +1,119 @@
+// Package provider provides tests for the provider implementations
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/macedot/openmodel/internal/api/openai"
+	"github.com/macedot/openmodel/internal/endpoints"
+)
+
+func TestEchoProvider(t *testing.T) {
+	p := NewEchoProvider(Spec{Name: "echo"}, EchoConfig{})
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		endpoint string
+		body     string
+		want     string
+	}{
+		{"last user message", endpoints.V1ChatCompletions, `{"model":"m","messages":[{"role":"user","content":"first"},{"role":"assistant","content":"x"},{"role":"user","content":"Hello world"}]}`, "Hello world"},
+		{"content parts", endpoints.V1ChatCompletions, `{"model":"m","messages":[{"role":"user","content":[{"type":"text","text":"Look"},{"type":"image_url","image_url":{"url":"data:"}},{"type":"text","text":"here"}]}]}`, "Look here"},
+		{"completion prompt", endpoints.V1Completions, `{"model":"m","prompt":"Once upon"}`, "Once upon"},
+		{"completion prompt list", endpoints.V1Completions, `{"model":"m","prompt":["a time","b"]}`, "a time"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := p.DoRequest(ctx, tt.endpoint, []byte(tt.body), nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var resp struct {
+				Model   string `json:"model"`
+				Choices []struct {
+					Text    string                       `json:"text"`
+					Message openai.ChatCompletionMessage `json:"message"`
+				} `json:"choices"`
+				Usage openai.Usage `json:"usage"`
+			}
+			if err := json.Unmarshal(body, &resp); err != nil {
+				t.Fatalf("invalid response %s: %v", body, err)
+			}
+			if got := resp.Choices[0].Text + resp.Choices[0].Message.Content; got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+			if resp.Model != "m" || resp.Usage.CompletionTokens != len(strings.Fields(tt.want)) {
+				t.Errorf("unexpected model or usage: %s", body)
+			}
+		})
+	}
+
+	if _, err := p.DoRequest(ctx, endpoints.V1Embeddings, []byte(`{}`), nil); StatusCodeOf(err) != http.StatusNotFound {
+		t.Errorf("expected a 404 for embeddings, got %v", err)
+	}
+	list, err := p.ListModels(ctx)
+	if err != nil || len(list.Data) != 1 || list.Data[0].ID != "echo" {
+		t.Errorf("expected the echo model listed, got %+v (%v)", list, err)
+	}
+}
+
+func TestEchoProvider_Stream(t *testing.T) {
+	p := NewEchoProvider(Spec{Name: "echo"}, EchoConfig{Delay: 20 * time.Millisecond, TokenDelay: 10 * time.Millisecond})
+	start := time.Now()
+	lines, err := p.DoStreamRequest(context.Background(), endpoints.V1ChatCompletions,
+		[]byte(`{"model":"m","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"one two three"}]}`), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var deltas []string
+	var usage *openai.Usage
+	var last string
+	for line := range lines {
+		data, ok := strings.CutPrefix(string(line), "data: ")
+		if !ok {
+			continue
+		}
+		last = data
+		if data == "[DONE]" {
+			continue
+		}
+		var chunk openai.ChatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("invalid chunk %s: %v", data, err)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content != "" {
+				deltas = append(deltas, choice.Delta.Content)
+			}
+		}
+	}
+
+	if strings.Join(deltas, "|") != "one |two |three" {
+		t.Errorf("expected one chunk per word, got %q", deltas)
+	}
+	if usage == nil || usage.CompletionTokens != 3 {
+		t.Errorf("expected a usage chunk, got %+v", usage)
+	}
+	if last != "[DONE]" {
+		t.Errorf("expected the stream to end with [DONE], got %s", last)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("expected the delays applied, took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := p.DoRequest(ctx, endpoints.V1ChatCompletions, []byte(`{"model":"m"}`), nil); err == nil {
+		t.Error("expected the delay to end with the context")
+	}
+}
@@ -0,0 +1,86 @@
+// Package provider defines the provider interface and implementations
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/macedot/openmodel/internal/api/openai"
+)
+
+// ErrUnsupported is returned for operations a provider's API does not offer
+var ErrUnsupported = errors.New("operation not supported by provider")
+
+// StatusError is returned when a provider answers with a non-200 HTTP status
+type StatusError struct {
+	StatusCode int
+	RetryAfter time.Duration // Parsed Retry-After header, 0 when absent
+	Body       []byte        // Response body as the provider sent it
+	Err        error
+}
+
+// Error implements the error interface
+func (e *StatusError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error (an *openai.ErrorResponse when the body was parseable)
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// newStatusError builds a StatusError from a non-200 response and its (already read) body
+func newStatusError(resp *http.Response, body []byte) error {
+	var err error
+	if er := openai.ParseErrorResponse(body); er != nil {
+		err = er
+	} else {
+		err = fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+	return &StatusError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		Body:       body,
+		Err:        err,
+	}
+}
+
+// StatusCodeOf returns the HTTP status carried by err, or 0 if it has none
+func StatusCodeOf(err error) int {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.StatusCode
+	}
+	return 0
+}
+
+// RetryAfterOf returns the Retry-After delay carried by err, or 0 if it has none
+func RetryAfterOf(err error) time.Duration {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.RetryAfter
+	}
+	return 0
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -4,44 +4,72 @@ package provider
 import (
 	"bytes"
 	"context"
-	"fmt"
 	"io"
 	"net/http"
 	"strings"
 
-	"github.com/macedot/openmodel/internal/api/openai"
+	"github.com/macedot/openmodel/internal/tracing"
 )
 
 // maxResponseBodySize defines the maximum size of response body to read for error handling
 const maxResponseBodySize = 1024 * 1024 // 1MB
 
+// maxBinaryResponseSize defines the maximum size of a binary (e.g. audio) response body
+const maxBinaryResponseSize = 50 * 1024 * 1024 // 50MB
+
 // buildRequest creates an HTTP request with proper headers
 func (p *OpenAIProvider) buildRequest(ctx context.Context, body []byte, path string) (*http.Request, error) {
+	return p.buildMethodRequest(ctx, http.MethodPost, body, path)
+}
+
+// buildMethodRequest creates an HTTP request with the given method to the provider endpoint
+func (p *OpenAIProvider) buildMethodRequest(ctx context.Context, method string, body []byte, path string) (*http.Request, error) {
 	// Combine baseURL with path, avoiding /v1/v1 duplication
 	fullURL := p.baseURL
 	// If baseURL ends with /v1 and path starts with /v1, remove one /v1
 	if strings.HasSuffix(p.baseURL, "/v1") && strings.HasPrefix(path, "/v1") {
 		fullURL = p.baseURL + path[3:] // Remove /v1 from path
+	} else if strings.HasSuffix(p.baseURL, "/v1") && strings.HasPrefix(path, "/api/") {
+		fullURL = strings.TrimSuffix(p.baseURL, "/v1") + path // Ollama native API lives at the server root
 	} else if strings.HasPrefix(path, "/") {
 		fullURL = p.baseURL + path
 	} else {
 		fullURL = p.baseURL + "/" + path
 	}
-	req, err := http.NewRequest("POST", fullURL, bytes.NewReader(body))
+	req, err := http.NewRequest(method, fullURL, bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	if p.apiKey != "" {
-		req.Header.Set("Authorization", "Bearer "+p.apiKey)
-	}
-	// Propagate request ID for distributed tracing
+	p.setProviderHeaders(req.Header)
+	// Propagate request ID and trace context for distributed tracing
 	if requestID := RequestIDFromContext(ctx); requestID != "" {
 		req.Header.Set("X-Request-ID", requestID)
 	}
+	if traceparent := tracing.Traceparent(ctx); traceparent != "" {
+		req.Header.Set(tracing.HeaderTraceparent, traceparent)
+	}
 	return req.WithContext(ctx), nil
 }
 
+// setProviderHeaders adds the provider's credentials (a bearer token, or the x-api-key and
+// anthropic-version headers of the Anthropic API) and its configured extra headers, which
+// take precedence so a gateway can use its own auth scheme
+func (p *OpenAIProvider) setProviderHeaders(h http.Header) {
+	key := p.key()
+	if p.anthropicAuth {
+		h.Set("anthropic-version", anthropicAPIVersion)
+		if key != "" {
+			h.Set("x-api-key", key)
+		}
+	} else if key != "" {
+		h.Set("Authorization", "Bearer "+key)
+	}
+	for key, value := range p.headers {
+		h.Set(key, value)
+	}
+}
+
 // doRequest executes an HTTP request
 func (p *OpenAIProvider) doRequest(ctx context.Context, req *http.Request) (*http.Response, error) {
 	resp, err := p.httpClient.Do(req.WithContext(ctx))
@@ -59,10 +87,7 @@ func (p *OpenAIProvider) handleHTTPResponse(resp *http.Response, closeBody bool)
 		if closeBody {
 			resp.Body.Close()
 		}
-		if er := openai.ParseErrorResponse(respBody); er != nil {
-			return er
-		}
-		return fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(respBody))
+		return newStatusError(resp, respBody)
 	}
 	return nil
 }
@@ -35,6 +35,16 @@ type RawRequester interface {
 	DoStreamRequest(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error)
 }
 
+// MethodRequester forwards raw requests that need an HTTP method other than POST
+type MethodRequester interface {
+	DoMethodRequest(ctx context.Context, method, endpoint string, body []byte, headers map[string]string) ([]byte, error)
+}
+
+// BinaryRequester forwards raw requests with non-JSON payloads (e.g. audio)
+type BinaryRequester interface {
+	DoBinaryRequest(ctx context.Context, endpoint, contentType string, body []byte, headers map[string]string) ([]byte, string, error)
+}
+
 // CompletionProvider handles legacy completion operations
 type CompletionProvider interface {
 	Complete(ctx context.Context, model string, req *openai.CompletionRequest) (*openai.CompletionResponse, error)
@@ -51,6 +61,11 @@ type APIModeProvider interface {
 	APIMode() string
 }
 
+// CapabilityProvider describes what the provider's models support
+type CapabilityProvider interface {
+	Capabilities() Capabilities
+}
+
 // Provider is the full interface combining all capabilities.
 // Kept for backward compatibility - OpenAIProvider implements this.
 type Provider interface {
@@ -61,6 +76,7 @@ type Provider interface {
 	ChatProvider
 	RawRequester
 	CompletionProvider
+	CapabilityProvider
 	Embed(ctx context.Context, model string, input []string) (*openai.EmbeddingResponse, error)
 	Moderate(ctx context.Context, input string) (*openai.ModerationResponse, error)
 
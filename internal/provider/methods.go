@@ -20,6 +20,9 @@ func copyRequestOptions(src *openai.ChatCompletionRequest, dst *openai.ChatCompl
 	if src == nil {
 		return
 	}
+	if stream {
+		dst.StreamOptions = src.StreamOptions
+	}
 	dst.Temperature = src.Temperature
 	dst.TopP = src.TopP
 	dst.N = src.N
@@ -33,6 +36,7 @@ func copyRequestOptions(src *openai.ChatCompletionRequest, dst *openai.ChatCompl
 	dst.Seed = src.Seed
 	dst.Tools = src.Tools
 	dst.ToolChoice = src.ToolChoice
+	dst.ParallelToolCalls = src.ParallelToolCalls
 	// Copy extra fields for provider-specific parameters
 	if len(src.Extra) > 0 {
 		dst.Extra = make(map[string]any, len(src.Extra))
@@ -69,9 +73,7 @@ func (p *OpenAIProvider) ListModels(ctx context.Context) (*openai.ModelList, err
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
-	if p.apiKey != "" {
-		req.Header.Set("Authorization", "Bearer "+p.apiKey)
-	}
+	p.setProviderHeaders(req.Header)
 
 	resp, err := p.httpClient.Do(req.WithContext(ctx))
 	if err != nil {
@@ -163,36 +165,37 @@ func (p *OpenAIProvider) StreamChat(ctx context.Context, model string, messages
 		return nil, err
 	}
 
-	// Parse function for chat streaming
-	parseChat := func(data string) (openai.ChatCompletionResponse, error) {
-		chunk, err := openai.StreamResponseToChunk([]byte(data))
-		if err != nil {
-			return openai.ChatCompletionResponse{}, err
-		}
+	ch := streamResponse(ctx, resp, parseChatChunk, openai.IsStreamDone)
 
-		chatResp := openai.ChatCompletionResponse{
-			ID:      chunk.ID,
-			Object:  chunk.Object,
-			Created: chunk.Created,
-			Model:   chunk.Model,
-		}
-		for _, c := range chunk.Choices {
-			finishReason := ""
-			if c.FinishReason != nil {
-				finishReason = *c.FinishReason
-			}
-			chatResp.Choices = append(chatResp.Choices, openai.ChatCompletionChoice{
-				Index:        c.Index,
-				Delta:        &c.Delta,
-				FinishReason: finishReason,
-			})
-		}
-		return chatResp, nil
-	}
+	return ch, nil
+}
 
-	ch := streamResponse(ctx, resp, parseChat, openai.IsStreamDone)
+// parseChatChunk parses the data of a chat.completion.chunk stream line
+func parseChatChunk(data string) (openai.ChatCompletionResponse, error) {
+	chunk, err := openai.StreamResponseToChunk([]byte(data))
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
 
-	return ch, nil
+	chatResp := openai.ChatCompletionResponse{
+		ID:      chunk.ID,
+		Object:  chunk.Object,
+		Created: chunk.Created,
+		Model:   chunk.Model,
+		Usage:   chunk.Usage,
+	}
+	for _, c := range chunk.Choices {
+		finishReason := ""
+		if c.FinishReason != nil {
+			finishReason = *c.FinishReason
+		}
+		chatResp.Choices = append(chatResp.Choices, openai.ChatCompletionChoice{
+			Index:        c.Index,
+			Delta:        &c.Delta,
+			FinishReason: finishReason,
+		})
+	}
+	return chatResp, nil
 }
 
 // StreamChatRaw streams chat completions as raw bytes for transparent proxying.
@@ -0,0 +1,110 @@
+// Package provider defines the provider interface and implementations
+package provider
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/macedot/openmodel/internal/endpoints"
+)
+
+// TypeMistral is the provider type of Mistral's La Plateforme API
+const TypeMistral = "mistral"
+
+// mistralToolCallIDLength is the length of the [a-zA-Z0-9] tool call ids Mistral accepts
+const mistralToolCallIDLength = 9
+
+// mistralUnsupportedFields are OpenAI chat fields Mistral rejects
+var mistralUnsupportedFields = []string{"user", "logit_bias", "logprobs", "top_logprobs", "store", "metadata", "service_tier"}
+
+// MistralProvider implements Provider for Mistral's La Plateforme. The API is OpenAI
+// compatible but strict: chat requests are rewritten before forwarding (see mistralChatBody).
+type MistralProvider struct {
+	*rewritingProvider
+}
+
+// NewMistralProvider creates a new Mistral provider
+func NewMistralProvider(name, baseURL, apiKey string) *MistralProvider {
+	return NewMistralProviderWithConfig(name, baseURL, apiKey, DefaultHTTPConfig())
+}
+
+// NewMistralProviderWithConfig creates a new Mistral provider with custom HTTP config
+func NewMistralProviderWithConfig(name, baseURL, apiKey string, httpConfig HTTPConfig) *MistralProvider {
+	return &MistralProvider{newRewritingProvider(name, baseURL, apiKey, httpConfig, func(endpoint string, body []byte) []byte {
+		if endpoint != endpoints.V1ChatCompletions {
+			return body
+		}
+		return mistralChatBody(body)
+	})}
+}
+
+// mistralChatBody rewrites an OpenAI chat completion request for Mistral:
+//   - names are dropped from all but tool messages
+//   - safe_mode (the old name) becomes safe_prompt, seed becomes random_seed and
+//     max_completion_tokens becomes max_tokens
+//   - tool_choice "required" becomes "any"
+//   - tool call ids become the 9 alphanumeric characters Mistral requires
+//   - fields Mistral rejects (user, logit_bias, ...) are dropped
+//
+// Bodies that are not JSON objects are returned as is.
+func mistralChatBody(body []byte) []byte {
+	return rewriteJSON(body, func(req map[string]any) {
+		for _, field := range mistralUnsupportedFields {
+			delete(req, field)
+		}
+		renameField(req, "safe_mode", "safe_prompt")
+		renameField(req, "seed", "random_seed")
+		renameField(req, "max_completion_tokens", "max_tokens")
+		if req["tool_choice"] == "required" {
+			req["tool_choice"] = "any"
+		}
+
+		messages, _ := req["messages"].([]any)
+		for _, m := range messages {
+			msg, ok := m.(map[string]any)
+			if !ok {
+				continue
+			}
+			if msg["role"] != "tool" {
+				delete(msg, "name")
+			}
+			if id, ok := msg["tool_call_id"].(string); ok {
+				msg["tool_call_id"] = mistralToolCallID(id)
+			}
+			calls, _ := msg["tool_calls"].([]any)
+			for _, c := range calls {
+				if call, ok := c.(map[string]any); ok {
+					if id, ok := call["id"].(string); ok {
+						call["id"] = mistralToolCallID(id)
+					}
+				}
+			}
+		}
+	})
+}
+
+// mistralToolCallID maps a tool call id to one Mistral accepts. Ids Mistral issued are kept;
+// others (e.g. OpenAI's call_...) are hashed, so a call and its result keep matching.
+func mistralToolCallID(id string) string {
+	if isMistralToolCallID(id) {
+		return id
+	}
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])[:mistralToolCallIDLength]
+}
+
+// isMistralToolCallID reports whether id is 9 alphanumeric characters
+func isMistralToolCallID(id string) bool {
+	if len(id) != mistralToolCallIDLength {
+		return false
+	}
+	for _, r := range id {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// Interface assertion
+var _ Provider = (*MistralProvider)(nil)
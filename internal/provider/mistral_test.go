@@ -0,0 +1,99 @@
+// Package provider provides tests for the provider implementations
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/macedot/openmodel/internal/api/openai"
+)
+
+func TestMistralChatBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "names dropped except on tool messages",
+			body: `{"messages":[{"role":"user","content":"hi","name":"alice"},{"role":"tool","content":"42","name":"calc","tool_call_id":"abc123XYZ"}]}`,
+			want: `{"messages":[{"content":"hi","role":"user"},{"content":"42","name":"calc","role":"tool","tool_call_id":"abc123XYZ"}]}`,
+		},
+		{
+			name: "renamed fields",
+			body: `{"safe_mode":true,"seed":7,"max_completion_tokens":100,"user":"u1","logit_bias":{"1":2}}`,
+			want: `{"max_tokens":100,"random_seed":7,"safe_prompt":true}`,
+		},
+		{
+			name: "explicit target wins",
+			body: `{"max_completion_tokens":100,"max_tokens":50}`,
+			want: `{"max_tokens":50}`,
+		},
+		{
+			name: "tool choice required",
+			body: `{"tool_choice":"required"}`,
+			want: `{"tool_choice":"any"}`,
+		},
+		{
+			name: "not json",
+			body: `not json`,
+			want: `not json`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(mistralChatBody([]byte(tt.body))); got != tt.want {
+				t.Errorf("mistralChatBody() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMistralToolCallID(t *testing.T) {
+	if got := mistralToolCallID("D681PevKs"); got != "D681PevKs" {
+		t.Errorf("expected a Mistral id kept, got %q", got)
+	}
+	id := mistralToolCallID("call_abc123")
+	if !isMistralToolCallID(id) {
+		t.Errorf("expected a 9 character alphanumeric id, got %q", id)
+	}
+	if mistralToolCallID("call_abc123") != id {
+		t.Error("expected the same id for a call and its result")
+	}
+}
+
+func TestMistralChat(t *testing.T) {
+	server := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req map[string]any
+		json.Unmarshal(body, &req)
+		if _, ok := req["user"]; ok {
+			t.Errorf("expected user dropped, got %s", body)
+		}
+		msg := req["messages"].([]any)[1].(map[string]any)
+		if _, ok := msg["name"]; ok {
+			t.Errorf("expected message name dropped, got %s", body)
+		}
+		if id := msg["tool_calls"].([]any)[0].(map[string]any)["id"].(string); !isMistralToolCallID(id) {
+			t.Errorf("expected a Mistral tool call id, got %q", id)
+		}
+		w.Write([]byte(`{"id":"m1","object":"chat.completion","model":"mistral-large","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	p := NewMistralProvider("mistral", server.URL, "key")
+	p.httpClient = &http.Client{Transport: &testTransport{}}
+	resp, err := p.Chat(context.Background(), "mistral-large", []openai.ChatCompletionMessage{
+		{Role: "user", Content: "hi"},
+		{Role: "assistant", Name: "bot", ToolCalls: []openai.ToolCall{{ID: "call_1", Type: "function", Function: openai.ToolCallFunction{Name: "f", Arguments: "{}"}}}},
+	}, &openai.ChatCompletionRequest{User: "u1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Choices[0].Message.Content != "ok" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
@@ -0,0 +1,429 @@
+// Package provider defines the provider interface and implementations
+package provider
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// pluginStopTimeout is how long a plugin may take to exit once its stdin is closed
+const pluginStopTimeout = 2 * time.Second
+
+// maxPluginMessageSize bounds one line of plugin output
+const maxPluginMessageSize = 16 * 1024 * 1024 // 16MB
+
+// PluginConfig describes an exec-based provider plugin
+type PluginConfig struct {
+	Command []string          // Executable and arguments
+	Env     map[string]string // Extra environment variables
+}
+
+// pluginRequest is a request line written to the plugin's stdin. A cancel line
+// ({"id":N,"cancel":true}) tells the plugin the client went away.
+type pluginRequest struct {
+	ID        uint64            `json:"id"`
+	Cancel    bool              `json:"cancel,omitempty"`
+	Method    string            `json:"method,omitempty"`
+	Endpoint  string            `json:"endpoint,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Body      json.RawMessage   `json:"body,omitempty"`
+	Stream    bool              `json:"stream,omitempty"`
+	APIKey    string            `json:"api_key,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+}
+
+// pluginMessage is a line the plugin writes to stdout about request ID: the response
+// (status and body), one SSE line of a stream (data), the end of a stream (done), or a
+// failure (error, with an optional status)
+type pluginMessage struct {
+	ID     uint64          `json:"id"`
+	Status int             `json:"status,omitempty"`
+	Body   json.RawMessage `json:"body,omitempty"`
+	Data   *string         `json:"data,omitempty"`
+	Done   bool            `json:"done,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// err returns the error a message reports, nil for a successful one
+func (m pluginMessage) err() error {
+	if m.Status >= http.StatusMultipleChoices {
+		body := []byte(m.Body)
+		if m.Error != "" && len(body) == 0 {
+			body = []byte(m.Error)
+		}
+		return newStatusError(&http.Response{StatusCode: m.Status, Header: http.Header{}}, body)
+	}
+	if m.Error != "" {
+		return errors.New(m.Error)
+	}
+	return nil
+}
+
+// PluginProvider implements Provider with an external process speaking the plugin
+// protocol: openmodel writes one JSON request per line to its stdin (see pluginRequest)
+// and it answers with JSON lines on stdout (see pluginMessage), in any order, so requests
+// run concurrently. The process gets OPENMODEL_PROVIDER_NAME and OPENMODEL_PROVIDER_URL
+// in its environment, is started on the first request and restarted on the next one if
+// it exits. Plugins speak the OpenAI API (api_mode "openai").
+type PluginProvider struct {
+	rawMethods
+	name         string
+	baseURL      string
+	apiKey       string
+	keySource    KeySource
+	capabilities Capabilities
+	config       PluginConfig
+	nextID       atomic.Uint64
+
+	mu     sync.Mutex
+	proc   *pluginProcess
+	closed bool
+}
+
+// NewPluginProvider creates a provider backed by a plugin process; the spec's HTTP
+// settings do not apply
+func NewPluginProvider(spec Spec, config PluginConfig) *PluginProvider {
+	p := &PluginProvider{name: spec.Name, baseURL: spec.BaseURL, apiKey: spec.APIKey, keySource: spec.APIKeySource, capabilities: configuredCapabilities(AllCapabilities(), spec), config: config}
+	p.rawMethods = rawMethods{raw: p}
+	return p
+}
+
+// Name returns the provider name
+func (p *PluginProvider) Name() string {
+	return p.name
+}
+
+// BaseURL returns the provider base URL, passed to the plugin
+func (p *PluginProvider) BaseURL() string {
+	return p.baseURL
+}
+
+// APIMode returns "openai": plugins speak the OpenAI API
+func (p *PluginProvider) APIMode() string {
+	return "openai"
+}
+
+// Capabilities returns what the plugin's models support: everything unless configured
+func (p *PluginProvider) Capabilities() Capabilities {
+	return p.capabilities
+}
+
+// key returns the API key, from the key source when there is one
+func (p *PluginProvider) key() string {
+	if p.keySource != nil {
+		return p.keySource.Value()
+	}
+	return p.apiKey
+}
+
+// Close stops the plugin process
+func (p *PluginProvider) Close() error {
+	p.mu.Lock()
+	proc := p.proc
+	p.proc = nil
+	p.closed = true
+	p.mu.Unlock()
+	if proc != nil {
+		proc.stop()
+	}
+	return nil
+}
+
+// process returns the running plugin process, starting one if needed
+func (p *PluginProvider) process() (*pluginProcess, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, fmt.Errorf("provider %q: plugin is closed", p.name)
+	}
+	if p.proc != nil && !p.proc.exited() {
+		return p.proc, nil
+	}
+	proc, err := startPlugin(p.name, p.baseURL, p.config)
+	if err != nil {
+		return nil, fmt.Errorf("provider %q: failed to start plugin: %w", p.name, err)
+	}
+	p.proc = proc
+	return proc, nil
+}
+
+// send starts a request and returns the channel of its messages
+func (p *PluginProvider) send(ctx context.Context, method, endpoint string, body []byte, headers map[string]string, stream bool) (*pluginProcess, uint64, <-chan pluginMessage, error) {
+	if len(body) > 0 && !json.Valid(body) {
+		return nil, 0, nil, fmt.Errorf("provider %q: plugin requests need a JSON body", p.name)
+	}
+	proc, err := p.process()
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	req := pluginRequest{
+		ID:        p.nextID.Add(1),
+		Method:    method,
+		Endpoint:  endpoint,
+		Headers:   headers,
+		Body:      body,
+		Stream:    stream,
+		APIKey:    p.key(),
+		RequestID: RequestIDFromContext(ctx),
+	}
+	messages, err := proc.send(ctx, req)
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("provider %q: %w", p.name, err)
+	}
+	return proc, req.ID, messages, nil
+}
+
+// do sends a request and waits for its response body
+func (p *PluginProvider) do(ctx context.Context, method, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+	proc, id, messages, err := p.send(ctx, method, endpoint, body, headers, false)
+	if err != nil {
+		return nil, err
+	}
+	defer proc.forget(id)
+
+	select {
+	case msg, ok := <-messages:
+		if !ok {
+			return nil, fmt.Errorf("provider %q: %w", p.name, proc.exitErr())
+		}
+		if err := msg.err(); err != nil {
+			return nil, err
+		}
+		return msg.Body, nil
+	case <-ctx.Done():
+		proc.cancel(id)
+		return nil, ctx.Err()
+	}
+}
+
+// DoRequest forwards a raw request to the plugin
+func (p *PluginProvider) DoRequest(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+	return p.do(ctx, http.MethodPost, endpoint, body, headers)
+}
+
+// DoMethodRequest forwards a raw request using the given HTTP method
+func (p *PluginProvider) DoMethodRequest(ctx context.Context, method, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+	return p.do(ctx, method, endpoint, body, headers)
+}
+
+// DoStreamRequest forwards a raw streaming request and returns the SSE lines the plugin
+// sends. A failure reported before the first line fails the request, like an HTTP status.
+func (p *PluginProvider) DoStreamRequest(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+	proc, id, messages, err := p.send(ctx, http.MethodPost, endpoint, body, headers, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var first pluginMessage
+	select {
+	case msg, ok := <-messages:
+		if !ok {
+			proc.forget(id)
+			return nil, fmt.Errorf("provider %q: %w", p.name, proc.exitErr())
+		}
+		if err := msg.err(); err != nil {
+			proc.forget(id)
+			return nil, err
+		}
+		first = msg
+	case <-ctx.Done():
+		proc.cancel(id)
+		proc.forget(id)
+		return nil, ctx.Err()
+	}
+
+	ch := make(chan []byte, 10)
+	go func() {
+		defer close(ch)
+		defer proc.forget(id)
+		msg, ok := first, true
+		for ok && msg.Data != nil {
+			select {
+			case ch <- []byte(*msg.Data):
+			case <-ctx.Done():
+				proc.cancel(id)
+				return
+			}
+			select {
+			case msg, ok = <-messages:
+			case <-ctx.Done():
+				proc.cancel(id)
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// pluginProcess is a running plugin and the requests waiting on it
+type pluginProcess struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[uint64]*pluginCall
+	done    chan struct{} // Closed once the process exited
+	err     error         // Why it exited
+}
+
+// pluginCall routes the messages of one request
+type pluginCall struct {
+	ctx      context.Context
+	messages chan pluginMessage
+}
+
+// startPlugin starts a plugin process and the goroutine reading its output
+func startPlugin(name, baseURL string, config PluginConfig) (*pluginProcess, error) {
+	if len(config.Command) == 0 {
+		return nil, errors.New("no command configured")
+	}
+	cmd := exec.Command(config.Command[0], config.Command[1:]...)
+	cmd.Env = append(os.Environ(), "OPENMODEL_PROVIDER_NAME="+name, "OPENMODEL_PROVIDER_URL="+baseURL)
+	for key, value := range config.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	proc := &pluginProcess{cmd: cmd, stdin: stdin, pending: make(map[uint64]*pluginCall), done: make(chan struct{})}
+	go proc.read(stdout)
+	return proc, nil
+}
+
+// read dispatches the plugin's output lines until it exits, then fails pending requests
+func (pp *pluginProcess) read(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), maxPluginMessageSize)
+	for scanner.Scan() {
+		var msg pluginMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+		pp.mu.Lock()
+		call := pp.pending[msg.ID]
+		pp.mu.Unlock()
+		if call == nil {
+			continue
+		}
+		select {
+		case call.messages <- msg:
+		case <-call.ctx.Done():
+		}
+	}
+
+	err := pp.cmd.Wait()
+	if err == nil {
+		err = scanner.Err()
+	}
+	pp.mu.Lock()
+	if err != nil {
+		pp.err = fmt.Errorf("plugin exited: %w", err)
+	} else {
+		pp.err = errors.New("plugin exited")
+	}
+	for id, call := range pp.pending {
+		close(call.messages)
+		delete(pp.pending, id)
+	}
+	close(pp.done)
+	pp.mu.Unlock()
+}
+
+// send registers a request and writes it to the plugin
+func (pp *pluginProcess) send(ctx context.Context, req pluginRequest) (<-chan pluginMessage, error) {
+	line, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	call := &pluginCall{ctx: ctx, messages: make(chan pluginMessage, 10)}
+	pp.mu.Lock()
+	if pp.exited() {
+		pp.mu.Unlock()
+		return nil, pp.exitErr()
+	}
+	pp.pending[req.ID] = call
+	pp.mu.Unlock()
+
+	if err := pp.write(line); err != nil {
+		pp.forget(req.ID)
+		return nil, fmt.Errorf("failed to write to plugin: %w", err)
+	}
+	return call.messages, nil
+}
+
+// write writes one line to the plugin's stdin
+func (pp *pluginProcess) write(line []byte) error {
+	pp.writeMu.Lock()
+	defer pp.writeMu.Unlock()
+	_, err := pp.stdin.Write(append(line, '\n'))
+	return err
+}
+
+// cancel tells the plugin a request's client went away
+func (pp *pluginProcess) cancel(id uint64) {
+	if line, err := json.Marshal(pluginRequest{ID: id, Cancel: true}); err == nil {
+		_ = pp.write(line)
+	}
+}
+
+// forget drops a finished request; later messages about it are discarded
+func (pp *pluginProcess) forget(id uint64) {
+	pp.mu.Lock()
+	delete(pp.pending, id)
+	pp.mu.Unlock()
+}
+
+// exited reports whether the process has exited
+func (pp *pluginProcess) exited() bool {
+	select {
+	case <-pp.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// exitErr returns why the process exited
+func (pp *pluginProcess) exitErr() error {
+	<-pp.done
+	return pp.err
+}
+
+// stop closes the plugin's stdin and kills it if it does not exit in time
+func (pp *pluginProcess) stop() {
+	pp.stdin.Close()
+	select {
+	case <-pp.done:
+	case <-time.After(pluginStopTimeout):
+		_ = pp.cmd.Process.Kill()
+		<-pp.done
+	}
+}
+
+// Interface assertions
+var (
+	_ Provider        = (*PluginProvider)(nil)
+	_ MethodRequester = (*PluginProvider)(nil)
+)
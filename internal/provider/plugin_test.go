@@ -0,0 +1,120 @@
+// Package provider provides tests for the provider implementations
+package provider
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/macedot/openmodel/internal/api/openai"
+	"github.com/macedot/openmodel/internal/endpoints"
+)
+
+// TestPluginHelperProcess is not a test: it is the plugin process of the tests below
+func TestPluginHelperProcess(t *testing.T) {
+	if os.Getenv("OPENMODEL_TEST_PLUGIN") != "1" {
+		return
+	}
+	out := json.NewEncoder(os.Stdout)
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var req pluginRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil || req.Cancel {
+			continue
+		}
+		switch {
+		case req.Endpoint == "/exit":
+			os.Exit(3)
+		case req.Endpoint == "/fail":
+			out.Encode(pluginMessage{ID: req.ID, Status: 429, Body: json.RawMessage(`{"error":{"message":"slow down","type":"rate_limit"}}`)})
+		case req.Method == "GET" && req.Endpoint == endpoints.V1Models:
+			out.Encode(pluginMessage{ID: req.ID, Status: 200, Body: json.RawMessage(`{"object":"list","data":[{"id":"exotic-1","object":"model","owned_by":"` + os.Getenv("OPENMODEL_PROVIDER_NAME") + `"}]}`)})
+		case req.Stream:
+			for _, line := range []string{`data: {"id":"c1","choices":[{"index":0,"delta":{"content":"Hel"}}]}`, "", `data: {"id":"c1","choices":[{"index":0,"delta":{"content":"lo"}}]}`, "", "data: [DONE]"} {
+				out.Encode(pluginMessage{ID: req.ID, Data: &line})
+			}
+			out.Encode(pluginMessage{ID: req.ID, Done: true})
+		default:
+			content := req.APIKey + " " + req.RequestID
+			body, _ := json.Marshal(openai.ChatCompletionResponse{ID: "c1", Choices: []openai.ChatCompletionChoice{{Message: &openai.ChatCompletionMessage{Role: "assistant", Content: content}}}})
+			out.Encode(pluginMessage{ID: req.ID, Body: body})
+		}
+	}
+	os.Exit(0)
+}
+
+// newTestPluginProvider creates a plugin provider running TestPluginHelperProcess
+func newTestPluginProvider(t *testing.T) *PluginProvider {
+	t.Helper()
+	p := NewPluginProvider(Spec{Name: "exotic", BaseURL: "http://exotic", APIKey: "test-api-key"}, PluginConfig{
+		Command: []string{os.Args[0], "-test.run=^TestPluginHelperProcess$"},
+		Env:     map[string]string{"OPENMODEL_TEST_PLUGIN": "1"},
+	})
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+func TestPluginProvider(t *testing.T) {
+	p := newTestPluginProvider(t)
+	ctx := WithRequestMetadata(context.Background(), "req-1", "")
+
+	list, err := p.ListModels(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(list.Data) != 1 || list.Data[0].ID != "exotic-1" || list.Data[0].OwnedBy != "exotic" {
+		t.Errorf("unexpected models: %+v", list.Data)
+	}
+
+	resp, err := p.Chat(ctx, "exotic-1", []openai.ChatCompletionMessage{{Role: "user", Content: "Hi"}}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := resp.Choices[0].Message.Content; got != "test-api-key req-1" {
+		t.Errorf("expected the api key and request id passed to the plugin, got %q", got)
+	}
+
+	ch, err := p.StreamChat(ctx, "exotic-1", []openai.ChatCompletionMessage{{Role: "user", Content: "Hi"}}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var content string
+	for chunk := range ch {
+		content += chunk.Choices[0].Delta.Content
+	}
+	if content != "Hello" {
+		t.Errorf("expected streamed content Hello, got %q", content)
+	}
+
+	_, err = p.DoRequest(ctx, "/fail", []byte(`{}`), nil)
+	if StatusCodeOf(err) != 429 {
+		t.Errorf("expected a 429 status error, got %v", err)
+	}
+	var errResp *openai.ErrorResponse
+	if !errors.As(err, &errResp) {
+		t.Errorf("expected the error body parsed, got %v", err)
+	}
+
+	if _, err := p.DoRequest(ctx, endpoints.V1ChatCompletions, []byte("not json"), nil); err == nil {
+		t.Error("expected an error for a non-JSON body")
+	}
+}
+
+func TestPluginProvider_Restart(t *testing.T) {
+	p := newTestPluginProvider(t)
+
+	if _, err := p.DoRequest(context.Background(), "/exit", []byte(`{}`), nil); err == nil {
+		t.Fatal("expected an error when the plugin exits")
+	}
+	if _, err := p.ListModels(context.Background()); err != nil {
+		t.Errorf("expected the plugin restarted, got %v", err)
+	}
+
+	p.Close()
+	if _, err := p.ListModels(context.Background()); err == nil {
+		t.Error("expected an error from a closed plugin")
+	}
+}
@@ -2,8 +2,10 @@
 package provider
 
 import (
+	"errors"
 	"net"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 )
@@ -13,7 +15,11 @@ type OpenAIProvider struct {
 	name               string
 	baseURL            string
 	apiKey             string
+	keySource          KeySource // Supplies the API key in place of apiKey when set
 	apiMode            string
+	anthropicAuth      bool              // Authenticate like the Anthropic API (x-api-key, anthropic-version)
+	headers            map[string]string // Extra headers sent on every request
+	capabilities       Capabilities
 	httpClient         *http.Client
 	transport          *http.Transport // Store transport for both clients
 	cachedStreamClient *http.Client    // Cached streaming client (no timeout)
@@ -28,6 +34,10 @@ type HTTPConfig struct {
 	DialTimeoutSeconds           int
 	TLSHandshakeTimeoutSeconds   int
 	ResponseHeaderTimeoutSeconds int
+	KeepAliveSeconds             int               // TCP keep-alive interval (-1 disables)
+	DisableKeepAlives            bool              // New connection for every request
+	Headers                      map[string]string // Extra headers sent on every request
+	Proxy                        string            // Outbound proxy URL (http, https, socks5); empty for a direct connection
 }
 
 // DefaultHTTPConfig returns the default HTTP configuration
@@ -40,6 +50,7 @@ func DefaultHTTPConfig() HTTPConfig {
 		DialTimeoutSeconds:           10,
 		TLSHandshakeTimeoutSeconds:   10,
 		ResponseHeaderTimeoutSeconds: 30,
+		KeepAliveSeconds:             30,
 	}
 }
 
@@ -51,14 +62,17 @@ func NewOpenAIProvider(name, baseURL, apiKey, apiMode string) *OpenAIProvider {
 // NewOpenAIProviderWithConfig creates a new OpenAI-compatible provider with custom HTTP config
 func NewOpenAIProviderWithConfig(name, baseURL, apiKey, apiMode string, httpConfig HTTPConfig) *OpenAIProvider {
 	transport := &http.Transport{
+		Proxy:               proxyFunc(httpConfig.Proxy),
 		MaxIdleConns:        httpConfig.MaxIdleConns,
 		MaxIdleConnsPerHost: httpConfig.MaxIdleConnsPerHost,
 		IdleConnTimeout:     time.Duration(httpConfig.IdleConnTimeoutSeconds) * time.Second,
 		DialContext: (&net.Dialer{
-			Timeout: time.Duration(httpConfig.DialTimeoutSeconds) * time.Second,
+			Timeout:   time.Duration(httpConfig.DialTimeoutSeconds) * time.Second,
+			KeepAlive: time.Duration(httpConfig.KeepAliveSeconds) * time.Second,
 		}).DialContext,
 		TLSHandshakeTimeout:   time.Duration(httpConfig.TLSHandshakeTimeoutSeconds) * time.Second,
 		ResponseHeaderTimeout: time.Duration(httpConfig.ResponseHeaderTimeoutSeconds) * time.Second,
+		DisableKeepAlives:     httpConfig.DisableKeepAlives,
 	}
 
 	streamingClient := &http.Client{
@@ -71,6 +85,9 @@ func NewOpenAIProviderWithConfig(name, baseURL, apiKey, apiMode string, httpConf
 		baseURL: strings.TrimSuffix(baseURL, "/"),
 		apiKey:  apiKey,
 		apiMode: apiMode,
+		headers: httpConfig.Headers,
+		// Types with backends that lack some features narrow these down
+		capabilities: AllCapabilities(),
 		httpClient: &http.Client{
 			Timeout:   time.Duration(httpConfig.TimeoutSeconds) * time.Second,
 			Transport: transport,
@@ -80,6 +97,44 @@ func NewOpenAIProviderWithConfig(name, baseURL, apiKey, apiMode string, httpConf
 	}
 }
 
+// proxyFunc returns the Transport proxy function of a proxy URL, nil for a direct
+// connection. An invalid URL fails every request instead of silently bypassing the proxy.
+func proxyFunc(proxy string) func(*http.Request) (*url.URL, error) {
+	if proxy == "" {
+		return nil
+	}
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		// Not wrapped: the parse error would echo the URL and any credentials in it
+		err = errors.New("invalid proxy URL")
+		return func(*http.Request) (*url.URL, error) { return nil, err }
+	}
+	return http.ProxyURL(proxyURL)
+}
+
+// setKeySource makes the provider take its API key from source
+func (p *OpenAIProvider) setKeySource(source KeySource) {
+	p.keySource = source
+}
+
+// setCapabilities replaces the provider's capabilities with configured ones
+func (p *OpenAIProvider) setCapabilities(capabilities Capabilities) {
+	p.capabilities = capabilities
+}
+
+// Capabilities returns what the provider's models support
+func (p *OpenAIProvider) Capabilities() Capabilities {
+	return p.capabilities
+}
+
+// key returns the API key, from the key source when there is one
+func (p *OpenAIProvider) key() string {
+	if p.keySource != nil {
+		return p.keySource.Value()
+	}
+	return p.apiKey
+}
+
 // Name returns the provider name
 func (p *OpenAIProvider) Name() string {
 	return p.name
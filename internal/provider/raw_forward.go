@@ -9,12 +9,16 @@ import (
 	"io"
 	"net/http"
 
-	"github.com/macedot/openmodel/internal/api/openai"
 	applogger "github.com/macedot/openmodel/internal/logger"
 )
 
 // DoRequest forwards a raw request body to the provider endpoint
 func (p *OpenAIProvider) DoRequest(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+	return p.DoMethodRequest(ctx, http.MethodPost, endpoint, body, headers)
+}
+
+// DoMethodRequest forwards a raw request body to the provider endpoint using the given HTTP method
+func (p *OpenAIProvider) DoMethodRequest(ctx context.Context, method, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
 	// Get request ID and original URL from context
 	requestID := RequestIDFromContext(ctx)
 	if requestID == "" {
@@ -32,7 +36,7 @@ func (p *OpenAIProvider) DoRequest(ctx context.Context, endpoint string, body []
 			p.name, originalURL, endpoint, p.baseURL+endpoint, headersJSON, body)
 	}
 
-	req, err := p.buildRequest(ctx, body, endpoint)
+	req, err := p.buildMethodRequest(ctx, method, body, endpoint)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -61,15 +65,44 @@ func (p *OpenAIProvider) DoRequest(ctx context.Context, endpoint string, body []
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		if er := openai.ParseErrorResponse(respBody); er != nil {
-			return nil, er
-		}
-		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(respBody))
+		return nil, newStatusError(resp, respBody)
 	}
 
 	return respBody, nil
 }
 
+// DoBinaryRequest forwards a raw request body with the given content type (e.g. multipart
+// form data) and returns the response body along with its content type. It is used for
+// non-JSON payloads such as audio uploads and synthesized speech.
+func (p *OpenAIProvider) DoBinaryRequest(ctx context.Context, endpoint, contentType string, body []byte, headers map[string]string) ([]byte, string, error) {
+	req, err := p.buildRequest(ctx, body, endpoint)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := p.doRequest(ctx, req)
+	if err != nil {
+		return nil, "", fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := p.handleHTTPResponse(resp, false); err != nil {
+		return nil, "", err
+	}
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxBinaryResponseSize))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read response: %w", err)
+	}
+
+	return respBody, resp.Header.Get("Content-Type"), nil
+}
+
 // DoStreamRequest forwards a raw streaming request and returns SSE channel
 func (p *OpenAIProvider) DoStreamRequest(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
 	// Get request ID and original URL from context
@@ -119,10 +152,7 @@ func (p *OpenAIProvider) DoStreamRequest(ctx context.Context, endpoint string, b
 			traceFile.Close()
 		}
 		resp.Body.Close()
-		if er := openai.ParseErrorResponse(respBody); er != nil {
-			return nil, er
-		}
-		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(respBody))
+		return nil, newStatusError(resp, respBody)
 	}
 
 	// Return raw SSE channel
@@ -159,6 +189,10 @@ func (p *OpenAIProvider) DoStreamRequest(ctx context.Context, endpoint string, b
 				return
 			}
 		}
+		// The channel is closed either way; the server detects the missing end marker
+		if err := scanner.Err(); err != nil && ctx.Err() == nil {
+			applogger.Warn("provider_stream_error", "request_id", requestID, "provider", p.name, "error", err.Error())
+		}
 	}()
 
 	return ch, nil
@@ -0,0 +1,132 @@
+// Package provider defines the provider interface and implementations
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/macedot/openmodel/internal/api/openai"
+	"github.com/macedot/openmodel/internal/endpoints"
+)
+
+// rawRequester forwards raw requests with any HTTP method
+type rawRequester interface {
+	RawRequester
+	MethodRequester
+}
+
+// rawMethods implements the typed provider methods with raw OpenAI API requests, for
+// providers that only forward raw requests (see PluginProvider, ReplayProvider)
+type rawMethods struct {
+	raw rawRequester
+}
+
+// ListModels lists the models the provider serves
+func (p rawMethods) ListModels(ctx context.Context) (*openai.ModelList, error) {
+	body, err := p.raw.DoMethodRequest(ctx, http.MethodGet, endpoints.V1Models, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var models openai.ModelList
+	if err := json.Unmarshal(body, &models); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &models, nil
+}
+
+// Chat sends a chat completion request
+func (p rawMethods) Chat(ctx context.Context, model string, messages []openai.ChatCompletionMessage, opts *openai.ChatCompletionRequest) (*openai.ChatCompletionResponse, error) {
+	body, err := chatRequestBody(model, messages, opts, false)
+	if err != nil {
+		return nil, err
+	}
+	var resp openai.ChatCompletionResponse
+	if err := p.call(ctx, endpoints.V1ChatCompletions, body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// StreamChatRaw streams chat completions as raw SSE lines
+func (p rawMethods) StreamChatRaw(ctx context.Context, model string, messages []openai.ChatCompletionMessage, opts *openai.ChatCompletionRequest) (<-chan []byte, error) {
+	body, err := chatRequestBody(model, messages, opts, true)
+	if err != nil {
+		return nil, err
+	}
+	return p.raw.DoStreamRequest(ctx, endpoints.V1ChatCompletions, body, nil)
+}
+
+// StreamChat streams chat completions
+func (p rawMethods) StreamChat(ctx context.Context, model string, messages []openai.ChatCompletionMessage, opts *openai.ChatCompletionRequest) (<-chan openai.ChatCompletionResponse, error) {
+	lines, err := p.StreamChatRaw(ctx, model, messages, opts)
+	if err != nil {
+		return nil, err
+	}
+	return parseChatLines(ctx, lines), nil
+}
+
+// Complete sends a legacy completion request
+func (p rawMethods) Complete(ctx context.Context, model string, req *openai.CompletionRequest) (*openai.CompletionResponse, error) {
+	body, err := completionRequestBody(model, req, false)
+	if err != nil {
+		return nil, err
+	}
+	var resp openai.CompletionResponse
+	if err := p.call(ctx, endpoints.V1Completions, body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// StreamComplete streams a legacy completion
+func (p rawMethods) StreamComplete(ctx context.Context, model string, req *openai.CompletionRequest) (<-chan openai.CompletionResponse, error) {
+	body, err := completionRequestBody(model, req, true)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := p.raw.DoStreamRequest(ctx, endpoints.V1Completions, body, nil)
+	if err != nil {
+		return nil, err
+	}
+	return parseCompletionLines(ctx, lines), nil
+}
+
+// Embed creates embeddings
+func (p rawMethods) Embed(ctx context.Context, model string, input []string) (*openai.EmbeddingResponse, error) {
+	body, err := json.Marshal(openai.EmbeddingRequest{Model: model, Input: input})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	var resp openai.EmbeddingResponse
+	if err := p.call(ctx, endpoints.V1Embeddings, body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Moderate classifies content
+func (p rawMethods) Moderate(ctx context.Context, input string) (*openai.ModerationResponse, error) {
+	body, err := json.Marshal(openai.ModerationRequest{Input: input})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	var resp openai.ModerationResponse
+	if err := p.call(ctx, endpoints.V1Moderations, body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// call sends a request and decodes its response into resp
+func (p rawMethods) call(ctx context.Context, endpoint string, body []byte, resp any) error {
+	respBody, err := p.raw.DoRequest(ctx, endpoint, body, nil)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(respBody, resp); err != nil {
+		return fmt.Errorf("failed to decode response: %w (raw response: %s)", err, string(respBody))
+	}
+	return nil
+}
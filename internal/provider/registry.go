@@ -0,0 +1,113 @@
+// Package provider defines the provider interface and implementations
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// TypeOpenAI is the provider type of OpenAI-compatible APIs, used when no type is configured
+const TypeOpenAI = "openai"
+
+// Spec describes a configured provider to create
+type Spec struct {
+	Name    string
+	BaseURL string
+	APIKey  string
+	APIMode string // API format of an OpenAI-compatible provider; native types have their own
+	HTTP    HTTPConfig
+	// APIKeySource supplies the API key in place of APIKey, e.g. one refreshed from a
+	// secret manager (optional)
+	APIKeySource KeySource
+	// Capabilities names the capabilities the provider's models support in place of its
+	// type's defaults (optional); see Capability*
+	Capabilities []string
+	// MaxContext is the context window of the provider's models in tokens (optional)
+	MaxContext int
+}
+
+// KeySource supplies an API key that may change while the provider is in use
+type KeySource interface {
+	Value() string
+}
+
+// keySourceSetter is implemented by providers that accept a KeySource
+type keySourceSetter interface {
+	setKeySource(source KeySource)
+}
+
+// Factory creates a provider from its spec
+type Factory func(spec Spec) Provider
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]Factory{
+		TypeOpenAI: func(s Spec) Provider {
+			return NewOpenAIProviderWithConfig(s.Name, s.BaseURL, s.APIKey, s.APIMode, s.HTTP)
+		},
+		TypeAnthropic: func(s Spec) Provider {
+			return NewAnthropicProviderWithConfig(s.Name, s.BaseURL, s.APIKey, s.HTTP)
+		},
+		TypeCohere: func(s Spec) Provider {
+			return NewCohereProviderWithConfig(s.Name, s.BaseURL, s.APIKey, s.HTTP)
+		},
+		TypeMistral: func(s Spec) Provider {
+			return NewMistralProviderWithConfig(s.Name, s.BaseURL, s.APIKey, s.HTTP)
+		},
+		TypeVLLM: func(s Spec) Provider {
+			return NewVLLMProviderWithConfig(s.Name, s.BaseURL, s.APIKey, s.HTTP)
+		},
+		TypeTGI: func(s Spec) Provider {
+			return NewTGIProviderWithConfig(s.Name, s.BaseURL, s.APIKey, s.HTTP)
+		},
+	}
+)
+
+// Register adds or replaces the factory of a provider type
+func Register(providerType string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	factories[providerType] = factory
+}
+
+// Types returns the registered provider types, sorted
+func Types() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	types := make([]string, 0, len(factories))
+	for t := range factories {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// New creates a provider of the given type; an empty type is TypeOpenAI
+func New(providerType string, spec Spec) (Provider, error) {
+	if providerType == "" {
+		providerType = TypeOpenAI
+	}
+	factoriesMu.RLock()
+	factory, ok := factories[providerType]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("provider %q: unknown type %q", spec.Name, providerType)
+	}
+	p := factory(spec)
+	if spec.APIKeySource != nil {
+		setter, ok := p.(keySourceSetter)
+		if !ok {
+			return nil, fmt.Errorf("provider %q: type %q does not support an api key source", spec.Name, providerType)
+		}
+		setter.setKeySource(spec.APIKeySource)
+	}
+	if spec.Capabilities != nil || spec.MaxContext > 0 {
+		setter, ok := p.(capabilitiesSetter)
+		if !ok {
+			return nil, fmt.Errorf("provider %q: type %q does not support configured capabilities", spec.Name, providerType)
+		}
+		setter.setCapabilities(configuredCapabilities(p.Capabilities(), spec))
+	}
+	return p, nil
+}
@@ -0,0 +1,149 @@
+// Package provider provides tests for the provider implementations
+package provider
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		providerType string
+		wantMode     string
+		check        func(p Provider) bool
+	}{
+		{"", "openai", func(p Provider) bool { _, ok := p.(*OpenAIProvider); return ok }},
+		{TypeOpenAI, "", func(p Provider) bool { _, ok := p.(*OpenAIProvider); return ok }},
+		{TypeAnthropic, "anthropic", func(p Provider) bool { _, ok := p.(*AnthropicProvider); return ok }},
+		{TypeCohere, "openai", func(p Provider) bool { _, ok := p.(*CohereProvider); return ok }},
+		{TypeMistral, "openai", func(p Provider) bool { _, ok := p.(*MistralProvider); return ok }},
+		{TypeVLLM, "openai", func(p Provider) bool { _, ok := p.(*VLLMProvider); return ok }},
+		{TypeTGI, "openai", func(p Provider) bool { _, ok := p.(*TGIProvider); return ok }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.providerType, func(t *testing.T) {
+			apiMode := "openai"
+			if tt.providerType == TypeOpenAI {
+				apiMode = "" // passthrough
+			}
+			p, err := New(tt.providerType, Spec{Name: "p", BaseURL: "http://p", APIMode: apiMode, HTTP: DefaultHTTPConfig()})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer p.Close()
+			if !tt.check(p) {
+				t.Errorf("unexpected implementation %T", p)
+			}
+			if p.APIMode() != tt.wantMode {
+				t.Errorf("expected api mode %q, got %q", tt.wantMode, p.APIMode())
+			}
+		})
+	}
+
+	if _, err := New("gemini", Spec{Name: "p"}); err == nil {
+		t.Error("expected an error for an unknown type")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("custom", func(s Spec) Provider {
+		return NewOpenAIProviderWithConfig(s.Name, s.BaseURL, s.APIKey, "anthropic", s.HTTP)
+	})
+	defer func() {
+		factoriesMu.Lock()
+		delete(factories, "custom")
+		factoriesMu.Unlock()
+	}()
+
+	if !slices.Contains(Types(), "custom") {
+		t.Errorf("expected custom in %v", Types())
+	}
+	p, err := New("custom", Spec{Name: "c", HTTP: DefaultHTTPConfig()})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.Name() != "c" || p.APIMode() != "anthropic" {
+		t.Errorf("unexpected provider %s (%s)", p.Name(), p.APIMode())
+	}
+}
+
+// rotatingKey is a KeySource whose key changes between requests
+type rotatingKey struct{ key string }
+
+func (k *rotatingKey) Value() string { return k.key }
+
+func TestNew_APIKeySource(t *testing.T) {
+	source := &rotatingKey{key: "sk-1"}
+	p, err := New(TypeAnthropic, Spec{Name: "p", BaseURL: "http://p", APIKey: "ignored", HTTP: DefaultHTTPConfig(), APIKeySource: source})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	anthropic := p.(*AnthropicProvider)
+
+	for _, key := range []string{"sk-1", "sk-2"} {
+		source.key = key
+		h := http.Header{}
+		anthropic.setProviderHeaders(h)
+		if got := h.Get("x-api-key"); got != key {
+			t.Errorf("expected x-api-key %s from the source, got %q", key, got)
+		}
+	}
+
+	Register("foreign", func(s Spec) Provider { return struct{ Provider }{anthropic} })
+	defer func() {
+		factoriesMu.Lock()
+		delete(factories, "foreign")
+		factoriesMu.Unlock()
+	}()
+	if _, err := New("foreign", Spec{Name: "p", APIKeySource: source}); err == nil {
+		t.Error("expected an error for a type without key source support")
+	}
+}
+
+func TestNew_Capabilities(t *testing.T) {
+	tests := []struct {
+		providerType string
+		spec         Spec
+		want         []string
+		wantContext  int
+	}{
+		{TypeOpenAI, Spec{}, []string{CapabilityTools, CapabilityVision, CapabilityJSONMode, CapabilityEmbeddings}, 0},
+		{TypeAnthropic, Spec{}, []string{CapabilityTools, CapabilityVision}, 0},
+		{TypeCohere, Spec{}, []string{CapabilityTools, CapabilityJSONMode, CapabilityEmbeddings}, 0},
+		{TypeTGI, Spec{}, []string{CapabilityTools, CapabilityVision, CapabilityJSONMode}, 0},
+		{TypeVLLM, Spec{Capabilities: []string{CapabilityTools}}, []string{CapabilityTools}, 0},
+		{TypeMistral, Spec{Capabilities: []string{}, MaxContext: 32768}, []string{}, 32768},
+		{TypeAnthropic, Spec{MaxContext: 200000}, []string{CapabilityTools, CapabilityVision}, 200000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.providerType, func(t *testing.T) {
+			tt.spec.Name, tt.spec.BaseURL, tt.spec.HTTP = "p", "http://p", DefaultHTTPConfig()
+			p, err := New(tt.providerType, tt.spec)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer p.Close()
+			got := p.Capabilities()
+			if !slices.Equal(got.Names(), tt.want) {
+				t.Errorf("expected capabilities %v, got %v", tt.want, got.Names())
+			}
+			if got.MaxContext != tt.wantContext {
+				t.Errorf("expected max context %d, got %d", tt.wantContext, got.MaxContext)
+			}
+			if !got.Streaming {
+				t.Error("expected streaming support")
+			}
+		})
+	}
+
+	Register("fixed", func(s Spec) Provider { return struct{ Provider }{NewOpenAIProvider(s.Name, s.BaseURL, "", "openai")} })
+	defer func() {
+		factoriesMu.Lock()
+		delete(factories, "fixed")
+		factoriesMu.Unlock()
+	}()
+	if _, err := New("fixed", Spec{Name: "p", MaxContext: 4096}); err == nil {
+		t.Error("expected an error for a type without configurable capabilities")
+	}
+}
@@ -0,0 +1,332 @@
+// Package provider defines the provider interface and implementations
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/macedot/openmodel/internal/api/openai"
+	"github.com/macedot/openmodel/internal/endpoints"
+	applogger "github.com/macedot/openmodel/internal/logger"
+)
+
+// TypeReplay is the provider type answering from fixture files instead of a backend
+const TypeReplay = "replay"
+
+// ReplayConfig describes the fixtures of a replay provider
+type ReplayConfig struct {
+	Fixtures string // Directory of fixture files
+	Record   bool   // Forward requests no fixture matches to the provider URL and save the responses
+}
+
+// replayFixture is a canned response. Fixture files are JSON files of the fixtures
+// directory holding one fixture or a list of them.
+type replayFixture struct {
+	Method   string          `json:"method,omitempty"`  // HTTP method; POST when empty
+	Endpoint string          `json:"endpoint"`          // e.g. /v1/chat/completions
+	Request  map[string]any  `json:"request,omitempty"` // Fields a request body must have to match; any body when empty
+	Status   int             `json:"status,omitempty"`  // Response status; 200 when empty
+	Response json.RawMessage `json:"response,omitempty"`
+	Stream   []string        `json:"stream,omitempty"` // SSE lines of a streamed response
+}
+
+// failed reports whether the fixture answers with an error status
+func (f replayFixture) failed() bool {
+	return f.Status >= http.StatusMultipleChoices
+}
+
+// matches reports whether a request is answered by the fixture
+func (f replayFixture) matches(method, endpoint string, req map[string]any, stream bool) bool {
+	fixtureMethod := f.Method
+	if fixtureMethod == "" {
+		fixtureMethod = http.MethodPost
+	}
+	if !strings.EqualFold(fixtureMethod, method) || f.Endpoint != endpoint {
+		return false
+	}
+	// Error fixtures answer streamed and plain requests alike
+	if !f.failed() && (len(f.Stream) > 0) != stream {
+		return false
+	}
+	for field, want := range f.Request {
+		if !reflect.DeepEqual(want, req[field]) {
+			return false
+		}
+	}
+	return true
+}
+
+// response returns the fixture's response body, or its error status
+func (f replayFixture) response() ([]byte, error) {
+	if f.failed() {
+		return nil, newStatusError(&http.Response{StatusCode: f.Status, Header: http.Header{}}, f.Response)
+	}
+	return f.Response, nil
+}
+
+// ReplayProvider implements Provider with canned responses read from fixture files, so
+// applications can be tested without a real backend. A request gets the response of the
+// fixture of its method and endpoint whose request fields its body has, the one with the
+// most fields when several match; streaming requests only match fixtures with stream
+// lines. Without a fixture for GET /v1/models, the models the fixtures ask for are
+// listed. In record mode, requests no fixture matches are forwarded to the provider URL
+// and the responses saved as new fixtures.
+type ReplayProvider struct {
+	rawMethods
+	name         string
+	baseURL      string
+	apiMode      string
+	config       ReplayConfig
+	upstream     *OpenAIProvider // Recorded backend, nil unless recording
+	capabilities Capabilities
+
+	mu       sync.RWMutex
+	fixtures []replayFixture
+}
+
+// NewReplayProvider creates a replay provider with the fixtures of its directory, which
+// need not exist yet in record mode
+func NewReplayProvider(spec Spec, config ReplayConfig) (*ReplayProvider, error) {
+	fixtures, err := loadReplayFixtures(config.Fixtures)
+	if err != nil && !(config.Record && errors.Is(err, fs.ErrNotExist)) {
+		return nil, fmt.Errorf("provider %q: %w", spec.Name, err)
+	}
+	p := &ReplayProvider{
+		name:         spec.Name,
+		baseURL:      spec.BaseURL,
+		apiMode:      spec.APIMode,
+		config:       config,
+		capabilities: configuredCapabilities(AllCapabilities(), spec),
+		fixtures:     fixtures,
+	}
+	if config.Record {
+		p.upstream = NewOpenAIProviderWithConfig(spec.Name, spec.BaseURL, spec.APIKey, spec.APIMode, spec.HTTP)
+		p.upstream.keySource = spec.APIKeySource
+	}
+	p.rawMethods = rawMethods{raw: p}
+	return p, nil
+}
+
+// loadReplayFixtures reads the fixture files of dir, in file name order
+func loadReplayFixtures(dir string) ([]replayFixture, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixtures: %w", err)
+	}
+	var fixtures []replayFixture
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fixture: %w", err)
+		}
+		data = bytes.TrimSpace(data)
+		if len(data) > 0 && data[0] == '[' {
+			var list []replayFixture
+			if err := json.Unmarshal(data, &list); err != nil {
+				return nil, fmt.Errorf("invalid fixture file %s: %w", entry.Name(), err)
+			}
+			fixtures = append(fixtures, list...)
+			continue
+		}
+		var fixture replayFixture
+		if err := json.Unmarshal(data, &fixture); err != nil {
+			return nil, fmt.Errorf("invalid fixture file %s: %w", entry.Name(), err)
+		}
+		fixtures = append(fixtures, fixture)
+	}
+	return fixtures, nil
+}
+
+// Name returns the provider name
+func (p *ReplayProvider) Name() string {
+	return p.name
+}
+
+// BaseURL returns the URL of the recorded backend
+func (p *ReplayProvider) BaseURL() string {
+	return p.baseURL
+}
+
+// APIMode returns the configured API mode; fixtures hold requests of that format
+func (p *ReplayProvider) APIMode() string {
+	return p.apiMode
+}
+
+// Capabilities returns what the provider's models support: everything unless configured
+func (p *ReplayProvider) Capabilities() Capabilities {
+	return p.capabilities
+}
+
+// Close releases the connections of the recorded backend
+func (p *ReplayProvider) Close() error {
+	if p.upstream != nil {
+		return p.upstream.Close()
+	}
+	return nil
+}
+
+// match returns the fixture answering a request
+func (p *ReplayProvider) match(method, endpoint string, body []byte, stream bool) (replayFixture, bool) {
+	// Bodies that are not JSON objects only match fixtures without request fields
+	var req map[string]any
+	_ = json.Unmarshal(body, &req)
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	best, found := replayFixture{}, false
+	for _, f := range p.fixtures {
+		if f.matches(method, endpoint, req, stream) && (!found || len(f.Request) > len(best.Request)) {
+			best, found = f, true
+		}
+	}
+	return best, found
+}
+
+// errNoFixture is the 404 answered to requests no fixture matches
+func errNoFixture(method, endpoint string) error {
+	return &StatusError{
+		StatusCode: http.StatusNotFound,
+		Err: &openai.ErrorResponse{Err: &openai.ErrorDetail{
+			Message: fmt.Sprintf("no replay fixture matches %s %s", method, endpoint),
+			Type:    "not_found_error",
+		}},
+	}
+}
+
+// DoRequest answers a raw request from the fixtures
+func (p *ReplayProvider) DoRequest(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+	return p.DoMethodRequest(ctx, http.MethodPost, endpoint, body, headers)
+}
+
+// DoMethodRequest answers a raw request using the given HTTP method from the fixtures
+func (p *ReplayProvider) DoMethodRequest(ctx context.Context, method, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+	if f, ok := p.match(method, endpoint, body, false); ok {
+		return f.response()
+	}
+	if p.upstream != nil {
+		resp, err := p.upstream.DoMethodRequest(ctx, method, endpoint, body, headers)
+		if err != nil {
+			return nil, err
+		}
+		p.record(replayFixture{Method: method, Endpoint: endpoint, Response: resp}, body)
+		return resp, nil
+	}
+	if method == http.MethodGet && endpoint == endpoints.V1Models {
+		return json.Marshal(p.fixtureModels())
+	}
+	return nil, errNoFixture(method, endpoint)
+}
+
+// DoStreamRequest answers a raw streaming request with the stream lines of a fixture
+func (p *ReplayProvider) DoStreamRequest(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+	f, ok := p.match(http.MethodPost, endpoint, body, true)
+	if !ok && p.upstream != nil {
+		return p.recordStream(ctx, endpoint, body, headers)
+	}
+	if !ok {
+		return nil, errNoFixture(http.MethodPost, endpoint)
+	}
+	if f.failed() {
+		return nil, newStatusError(&http.Response{StatusCode: f.Status, Header: http.Header{}}, f.Response)
+	}
+
+	ch := make(chan []byte, 10)
+	go func() {
+		defer close(ch)
+		for _, line := range f.Stream {
+			select {
+			case ch <- []byte(line):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// recordStream forwards a streaming request to the recorded backend and saves its lines
+// once the stream is complete
+func (p *ReplayProvider) recordStream(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+	lines, err := p.upstream.DoStreamRequest(ctx, endpoint, body, headers)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan []byte, 10)
+	go func() {
+		defer close(ch)
+		var recorded []string
+		for line := range lines {
+			recorded = append(recorded, string(line))
+			select {
+			case ch <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if ctx.Err() == nil {
+			p.record(replayFixture{Method: http.MethodPost, Endpoint: endpoint, Stream: recorded}, body)
+		}
+	}()
+	return ch, nil
+}
+
+// record saves a response of the recorded backend as a fixture of the request body,
+// named after the endpoint and a hash of the request
+func (p *ReplayProvider) record(f replayFixture, body []byte) {
+	if f.Method == http.MethodPost {
+		f.Method = ""
+	}
+	_ = json.Unmarshal(body, &f.Request)
+
+	err := func() error {
+		data, err := json.MarshalIndent(f, "", "  ")
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(append([]byte(f.Method+" "+f.Endpoint+" "+fmt.Sprint(len(f.Stream) > 0)+" "), body...))
+		name := strings.Trim(strings.ReplaceAll(f.Endpoint, "/", "_"), "_") + "-" + hex.EncodeToString(sum[:6]) + ".json"
+		if err := os.MkdirAll(p.config.Fixtures, 0o755); err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(p.config.Fixtures, name), append(data, '\n'), 0o644)
+	}()
+	if err != nil {
+		applogger.Warn("replay_record_failed", "provider", p.name, "endpoint", f.Endpoint, "error", err.Error())
+		return
+	}
+
+	p.mu.Lock()
+	p.fixtures = append(p.fixtures, f)
+	p.mu.Unlock()
+}
+
+// fixtureModels lists the models the fixtures ask for, in fixture order
+func (p *ReplayProvider) fixtureModels() openai.ModelList {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	list := openai.ModelList{Object: "list", Data: []openai.Model{}}
+	seen := make(map[string]bool)
+	for _, f := range p.fixtures {
+		model, _ := f.Request["model"].(string)
+		if model != "" && !seen[model] {
+			seen[model] = true
+			list.Data = append(list.Data, openai.NewModel(model, p.name))
+		}
+	}
+	return list
+}
@@ -0,0 +1,171 @@
+// Package provider provides tests for the provider implementations
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/macedot/openmodel/internal/api/openai"
+	"github.com/macedot/openmodel/internal/endpoints"
+)
+
+// writeFixture writes a fixture file to dir
+func writeFixture(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplayProvider(t *testing.T) {
+	dir := t.TempDir()
+	writeFixture(t, dir, "any.json", `{"endpoint":"/v1/chat/completions","request":{"model":"gpt-4"},"response":{"id":"any","choices":[{"index":0,"message":{"role":"assistant","content":"Anything"}}]}}`)
+	writeFixture(t, dir, "hello.json", `{"endpoint":"/v1/chat/completions","request":{"model":"gpt-4","messages":[{"role":"user","content":"Hello"}]},"response":{"id":"hello","choices":[{"index":0,"message":{"role":"assistant","content":"Hi there"}}]}}`)
+	writeFixture(t, dir, "more.json", `[
+		{"endpoint":"/v1/chat/completions","request":{"model":"gpt-4","stream":true},"stream":["data: {\"id\":\"s\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Str\"}}]}","","data: {\"id\":\"s\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"eam\"}}]}","","data: [DONE]"]},
+		{"endpoint":"/v1/embeddings","request":{"model":"limited"},"status":429,"response":{"error":{"message":"slow down","type":"rate_limit"}}}
+	]`)
+	writeFixture(t, dir, "notes.txt", "not a fixture")
+
+	p, err := NewReplayProvider(Spec{Name: "replay", APIMode: "openai"}, ReplayConfig{Fixtures: dir})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer p.Close()
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"most specific fixture", "Hello", "Hi there"},
+		{"fallback fixture", "Something else", "Anything"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := p.Chat(ctx, "gpt-4", []openai.ChatCompletionMessage{{Role: "user", Content: tt.content}}, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := resp.Choices[0].Message.Content; got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	ch, err := p.StreamChat(ctx, "gpt-4", []openai.ChatCompletionMessage{{Role: "user", Content: "Hello"}}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var content string
+	for chunk := range ch {
+		content += chunk.Choices[0].Delta.Content
+	}
+	if content != "Stream" {
+		t.Errorf("expected streamed content Stream, got %q", content)
+	}
+
+	if _, err := p.Embed(ctx, "limited", []string{"hi"}); StatusCodeOf(err) != 429 {
+		t.Errorf("expected the fixture's 429, got %v", err)
+	}
+	if _, err := p.Chat(ctx, "gpt-3.5", nil, nil); StatusCodeOf(err) != 404 || !strings.Contains(err.Error(), "no replay fixture") {
+		t.Errorf("expected a 404 for an unmatched request, got %v", err)
+	}
+
+	list, err := p.ListModels(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var ids []string
+	for _, m := range list.Data {
+		ids = append(ids, m.ID)
+	}
+	if strings.Join(ids, ",") != "gpt-4,limited" {
+		t.Errorf("expected the fixtures' models listed, got %v", ids)
+	}
+
+	if _, err := NewReplayProvider(Spec{Name: "replay"}, ReplayConfig{Fixtures: filepath.Join(dir, "missing")}); err == nil {
+		t.Error("expected an error for a missing fixtures directory")
+	}
+	writeFixture(t, dir, "broken.json", "{")
+	if _, err := NewReplayProvider(Spec{Name: "replay"}, ReplayConfig{Fixtures: dir}); err == nil || !strings.Contains(err.Error(), "broken.json") {
+		t.Errorf("expected an error naming the invalid fixture, got %v", err)
+	}
+}
+
+func TestReplayProvider_Record(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), `"stream":true`) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "data: {\"id\":\"s\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Live\"}}]}\n\ndata: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"live","choices":[{"index":0,"message":{"role":"assistant","content":"Live"}}]}`)
+	}))
+	defer server.Close()
+
+	dir := filepath.Join(t.TempDir(), "fixtures")
+	p, err := NewReplayProvider(Spec{Name: "replay", BaseURL: server.URL, APIMode: "openai", HTTP: DefaultHTTPConfig()}, ReplayConfig{Fixtures: dir, Record: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer p.Close()
+	ctx := context.Background()
+	body := []byte(`{"model":"gpt-4","messages":[{"role":"user","content":"Hi"}]}`)
+
+	for range 2 {
+		resp, err := p.DoRequest(ctx, endpoints.V1ChatCompletions, body, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(string(resp), `"Live"`) {
+			t.Errorf("unexpected response %s", resp)
+		}
+	}
+	lines, err := p.DoStreamRequest(ctx, endpoints.V1ChatCompletions, []byte(`{"model":"gpt-4","stream":true}`), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for range lines {
+	}
+	if calls != 2 {
+		t.Errorf("expected the repeated request replayed, got %d upstream calls", calls)
+	}
+
+	// The recordings replay without the backend
+	replay, err := NewReplayProvider(Spec{Name: "replay", APIMode: "openai"}, ReplayConfig{Fixtures: dir})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp, err := replay.DoRequest(ctx, endpoints.V1ChatCompletions, body, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var chat openai.ChatCompletionResponse
+	if err := json.Unmarshal(resp, &chat); err != nil || chat.ID != "live" {
+		t.Errorf("expected the recorded response, got %s (%v)", resp, err)
+	}
+	stream, err := replay.DoStreamRequest(ctx, endpoints.V1ChatCompletions, []byte(`{"stream":true,"model":"gpt-4"}`), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var recorded []string
+	for line := range stream {
+		recorded = append(recorded, string(line))
+	}
+	if len(recorded) != 4 || recorded[2] != "data: [DONE]" {
+		t.Errorf("expected the recorded stream lines, got %q", recorded)
+	}
+}
@@ -0,0 +1,109 @@
+// Package provider defines the provider interface and implementations
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/macedot/openmodel/internal/api/openai"
+	"github.com/macedot/openmodel/internal/endpoints"
+)
+
+// rewritingProvider is an OpenAI-compatible provider whose backend needs request bodies
+// adapted before forwarding (see MistralProvider, VLLMProvider, TGIProvider). The typed
+// chat methods go through the same rewrite as raw requests.
+type rewritingProvider struct {
+	*OpenAIProvider
+	rewrite func(endpoint string, body []byte) []byte
+}
+
+// newRewritingProvider creates an OpenAI-mode provider applying rewrite to request bodies
+func newRewritingProvider(name, baseURL, apiKey string, httpConfig HTTPConfig, rewrite func(endpoint string, body []byte) []byte) *rewritingProvider {
+	return &rewritingProvider{
+		OpenAIProvider: NewOpenAIProviderWithConfig(name, baseURL, apiKey, "openai", httpConfig),
+		rewrite:        rewrite,
+	}
+}
+
+// DoRequest forwards a raw request with its body rewritten for the backend
+func (p *rewritingProvider) DoRequest(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+	return p.OpenAIProvider.DoRequest(ctx, endpoint, p.rewrite(endpoint, body), headers)
+}
+
+// DoStreamRequest forwards a raw streaming request with its body rewritten for the backend
+func (p *rewritingProvider) DoStreamRequest(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+	return p.OpenAIProvider.DoStreamRequest(ctx, endpoint, p.rewrite(endpoint, body), headers)
+}
+
+// Chat sends a chat completion request
+func (p *rewritingProvider) Chat(ctx context.Context, model string, messages []openai.ChatCompletionMessage, opts *openai.ChatCompletionRequest) (*openai.ChatCompletionResponse, error) {
+	body, err := chatRequestBody(model, messages, opts, false)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := p.DoRequest(ctx, endpoints.V1ChatCompletions, body, nil)
+	if err != nil {
+		return nil, err
+	}
+	var resp openai.ChatCompletionResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w (raw response: %s)", err, string(respBody))
+	}
+	return &resp, nil
+}
+
+// StreamChatRaw streams chat completions as raw SSE lines
+func (p *rewritingProvider) StreamChatRaw(ctx context.Context, model string, messages []openai.ChatCompletionMessage, opts *openai.ChatCompletionRequest) (<-chan []byte, error) {
+	body, err := chatRequestBody(model, messages, opts, true)
+	if err != nil {
+		return nil, err
+	}
+	return p.DoStreamRequest(ctx, endpoints.V1ChatCompletions, body, nil)
+}
+
+// StreamChat streams chat completions
+func (p *rewritingProvider) StreamChat(ctx context.Context, model string, messages []openai.ChatCompletionMessage, opts *openai.ChatCompletionRequest) (<-chan openai.ChatCompletionResponse, error) {
+	lines, err := p.StreamChatRaw(ctx, model, messages, opts)
+	if err != nil {
+		return nil, err
+	}
+	return parseChatLines(ctx, lines), nil
+}
+
+// chatRequestBody renders a chat completion request body
+func chatRequestBody(model string, messages []openai.ChatCompletionMessage, opts *openai.ChatCompletionRequest, stream bool) ([]byte, error) {
+	req := openai.ChatCompletionRequest{Model: model, Messages: messages}
+	copyRequestOptions(opts, &req, stream)
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	return body, nil
+}
+
+// rewriteJSON applies fn to a JSON object body; other bodies are returned as is
+func rewriteJSON(body []byte, fn func(req map[string]any)) []byte {
+	var req map[string]any
+	if err := json.Unmarshal(body, &req); err != nil {
+		return body
+	}
+	fn(req)
+	result, err := json.Marshal(req)
+	if err != nil {
+		return body
+	}
+	return result
+}
+
+// renameField moves a request field to another name unless that one is already set
+func renameField(req map[string]any, from, to string) {
+	value, ok := req[from]
+	if !ok {
+		return
+	}
+	delete(req, from)
+	if _, exists := req[to]; !exists {
+		req[to] = value
+	}
+}
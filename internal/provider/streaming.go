@@ -4,9 +4,12 @@ package provider
 import (
 	"bufio"
 	"context"
+	"encoding/json"
 	"net/http"
 	"strings"
 	"sync"
+
+	"github.com/macedot/openmodel/internal/api/openai"
 )
 
 // maxTokenSize defines the maximum token size for streaming buffer
@@ -71,3 +74,54 @@ func streamResponse[T any](ctx context.Context, resp *http.Response, parseFunc f
 	}()
 	return ch
 }
+
+// parseChatLines parses the chat.completion.chunk lines of a converted stream
+func parseChatLines(ctx context.Context, lines <-chan []byte) <-chan openai.ChatCompletionResponse {
+	ch := make(chan openai.ChatCompletionResponse, 10)
+	go func() {
+		defer close(ch)
+		for line := range lines {
+			data, ok := strings.CutPrefix(string(line), "data: ")
+			if !ok {
+				continue
+			}
+			if openai.IsStreamDone(data) {
+				continue
+			}
+			chunk, err := parseChatChunk(data)
+			if err != nil {
+				continue
+			}
+			select {
+			case ch <- chunk:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// parseCompletionLines parses the text_completion lines of a converted stream
+func parseCompletionLines(ctx context.Context, lines <-chan []byte) <-chan openai.CompletionResponse {
+	ch := make(chan openai.CompletionResponse, 10)
+	go func() {
+		defer close(ch)
+		for line := range lines {
+			data, ok := strings.CutPrefix(string(line), "data: ")
+			if !ok || openai.IsStreamDone(data) {
+				continue
+			}
+			var chunk openai.CompletionResponse
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				continue
+			}
+			select {
+			case ch <- chunk:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
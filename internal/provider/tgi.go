@@ -0,0 +1,217 @@
+// Package provider defines the provider interface and implementations
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/macedot/openmodel/internal/api/openai"
+	"github.com/macedot/openmodel/internal/api/tgi"
+	"github.com/macedot/openmodel/internal/endpoints"
+)
+
+// TypeTGI is the provider type of HuggingFace Text Generation Inference
+const TypeTGI = "tgi"
+
+// tgiUnsupportedFields are vLLM extensions TGI's chat API has no equivalent for
+var tgiUnsupportedFields = []string{"best_of", "min_p", "guided_choice", "guided_grammar", "guided_decoding_backend", "guided_whitespace_pattern"}
+
+// TGIProvider implements Provider for HuggingFace Text Generation Inference. Chat goes to
+// TGI's OpenAI-compatible Messages API with structured output translated to TGI grammars
+// (see tgiChatBody); legacy completions are translated to the native /generate and
+// /generate_stream endpoints.
+type TGIProvider struct {
+	*rewritingProvider
+}
+
+// NewTGIProvider creates a new TGI provider
+func NewTGIProvider(name, baseURL, apiKey string) *TGIProvider {
+	return NewTGIProviderWithConfig(name, baseURL, apiKey, DefaultHTTPConfig())
+}
+
+// NewTGIProviderWithConfig creates a new TGI provider with custom HTTP config
+func NewTGIProviderWithConfig(name, baseURL, apiKey string, httpConfig HTTPConfig) *TGIProvider {
+	p := newRewritingProvider(name, baseURL, apiKey, httpConfig, func(endpoint string, body []byte) []byte {
+		if endpoint != endpoints.V1ChatCompletions {
+			return body
+		}
+		return tgiChatBody(body)
+	})
+	// TGI serves text generation only (embeddings come from a separate TEI server)
+	p.capabilities.Embeddings = false
+	return &TGIProvider{p}
+}
+
+// tgiChatBody rewrites a chat request for TGI:
+//   - guided_json and guided_regex (vLLM), and json_schema and json_object response formats
+//     (OpenAI), become a response_format grammar of type "json" or "regex"
+//   - other vLLM extensions are dropped
+//
+// Bodies that are not JSON objects are returned as is.
+func tgiChatBody(body []byte) []byte {
+	return rewriteJSON(body, func(req map[string]any) {
+		guidedRegex, _ := req["guided_regex"].(string)
+		if grammar := tgi.GrammarFromGuided(req["guided_json"], guidedRegex); grammar != nil {
+			req["response_format"] = grammar
+		} else if format, ok := req["response_format"].(map[string]any); ok {
+			switch format["type"] {
+			case "json_schema":
+				schema, _ := format["json_schema"].(map[string]any)
+				req["response_format"] = tgi.Grammar{Type: "json", Value: schema["schema"]}
+			case "json_object":
+				req["response_format"] = tgi.Grammar{Type: "json", Value: map[string]any{"type": "object"}}
+			}
+		}
+		delete(req, "guided_json")
+		delete(req, "guided_regex")
+		for _, field := range tgiUnsupportedFields {
+			delete(req, field)
+		}
+	})
+}
+
+// DoRequest forwards a raw request; completions are translated to /generate
+func (p *TGIProvider) DoRequest(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+	if endpoint != endpoints.V1Completions {
+		return p.rewritingProvider.DoRequest(ctx, endpoint, body, headers)
+	}
+	req, genBody, err := generateRequestBody(body, false)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := p.OpenAIProvider.DoRequest(ctx, endpoints.TGIGenerate, genBody, headers)
+	if err != nil {
+		return nil, err
+	}
+	var resp tgi.GenerateResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w (raw response: %s)", err, string(respBody))
+	}
+	return json.Marshal(tgi.GenerateToOpenAIResponse(&resp, req.Model, completionID(), time.Now().Unix()))
+}
+
+// DoStreamRequest forwards a raw streaming request; completions are translated to
+// /generate_stream and returned as text_completion SSE lines ending with "data: [DONE]"
+func (p *TGIProvider) DoStreamRequest(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+	if endpoint != endpoints.V1Completions {
+		return p.rewritingProvider.DoStreamRequest(ctx, endpoint, body, headers)
+	}
+	req, genBody, err := generateRequestBody(body, true)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := p.OpenAIProvider.DoStreamRequest(ctx, endpoints.TGIGenerateStream, genBody, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	id, created := completionID(), time.Now().Unix()
+	ch := make(chan []byte, 10)
+	go func() {
+		defer close(ch)
+		send := func(line string) bool {
+			select {
+			case ch <- []byte(line):
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		for event := range events {
+			data, ok := strings.CutPrefix(string(event), "data:")
+			if !ok {
+				continue
+			}
+			chunk, done, ok := tgi.ConvertStreamResponse(strings.TrimSpace(data), req.Model, id, created)
+			if !ok {
+				continue
+			}
+			encoded, err := json.Marshal(chunk)
+			if err != nil {
+				continue
+			}
+			if !send("data: "+string(encoded)) || !send("") {
+				return
+			}
+			if done {
+				send("data: [DONE]")
+				send("")
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// generateRequestBody converts a raw OpenAI completion request to a generate request body
+func generateRequestBody(body []byte, stream bool) (*tgi.CompletionRequest, []byte, error) {
+	var req tgi.CompletionRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse request: %w", err)
+	}
+	req.Stream = stream
+	genReq, err := tgi.OpenAIToGenerateRequest(&req)
+	if err != nil {
+		return nil, nil, err
+	}
+	genBody, err := json.Marshal(genReq)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	return &req, genBody, nil
+}
+
+// completionID returns an id for a completion translated from a native API
+func completionID() string {
+	return fmt.Sprintf("cmpl-%d", time.Now().UnixNano())
+}
+
+// Complete sends a completion request to /generate
+func (p *TGIProvider) Complete(ctx context.Context, model string, req *openai.CompletionRequest) (*openai.CompletionResponse, error) {
+	body, err := completionRequestBody(model, req, false)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := p.DoRequest(ctx, endpoints.V1Completions, body, nil)
+	if err != nil {
+		return nil, err
+	}
+	var resp openai.CompletionResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &resp, nil
+}
+
+// StreamComplete streams a completion from /generate_stream
+func (p *TGIProvider) StreamComplete(ctx context.Context, model string, req *openai.CompletionRequest) (<-chan openai.CompletionResponse, error) {
+	body, err := completionRequestBody(model, req, true)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := p.DoStreamRequest(ctx, endpoints.V1Completions, body, nil)
+	if err != nil {
+		return nil, err
+	}
+	return parseCompletionLines(ctx, lines), nil
+}
+
+// completionRequestBody renders a completion request body for model
+func completionRequestBody(model string, req *openai.CompletionRequest, stream bool) ([]byte, error) {
+	r := *req
+	r.Model = model
+	r.Stream = stream
+	body, err := json.Marshal(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	return body, nil
+}
+
+// Interface assertion
+var _ Provider = (*TGIProvider)(nil)
@@ -0,0 +1,122 @@
+// Package provider provides tests for the provider implementations
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/macedot/openmodel/internal/api/openai"
+	"github.com/macedot/openmodel/internal/api/tgi"
+	"github.com/macedot/openmodel/internal/endpoints"
+)
+
+// newTestTGIProvider creates a TGI provider pointing to a test server
+func newTestTGIProvider(serverURL string) *TGIProvider {
+	provider := NewTGIProvider("tgi", serverURL, "")
+	transport := &testTransport{}
+	provider.httpClient = &http.Client{Transport: transport, Timeout: provider.httpClient.Timeout}
+	provider.cachedStreamClient = &http.Client{Transport: transport}
+	return provider
+}
+
+func TestTGIChatBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "guided json",
+			body: `{"guided_json":{"type":"object"},"min_p":0.1}`,
+			want: `{"response_format":{"type":"json","value":{"type":"object"}}}`,
+		},
+		{
+			name: "guided regex",
+			body: `{"guided_regex":"[a-z]+"}`,
+			want: `{"response_format":{"type":"regex","value":"[a-z]+"}}`,
+		},
+		{
+			name: "openai json schema",
+			body: `{"response_format":{"type":"json_schema","json_schema":{"name":"x","schema":{"type":"object"}}}}`,
+			want: `{"response_format":{"type":"json","value":{"type":"object"}}}`,
+		},
+		{
+			name: "tgi grammar kept",
+			body: `{"response_format":{"type":"regex","value":"a+"}}`,
+			want: `{"response_format":{"type":"regex","value":"a+"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(tgiChatBody([]byte(tt.body))); got != tt.want {
+				t.Errorf("tgiChatBody() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTGIDoRequest_Completion(t *testing.T) {
+	server := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/generate" {
+			t.Errorf("expected /generate path, got %s", r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		var req tgi.GenerateRequest
+		json.Unmarshal(body, &req)
+		if req.Inputs != "Once upon" || req.Parameters.MaxNewTokens == nil || *req.Parameters.MaxNewTokens != 16 {
+			t.Errorf("unexpected request: %s", body)
+		}
+		w.Write([]byte(`{"generated_text":" a time","details":{"finish_reason":"length","generated_tokens":16}}`))
+	}))
+	defer server.Close()
+
+	respBody, err := newTestTGIProvider(server.URL).DoRequest(context.Background(), endpoints.V1Completions,
+		[]byte(`{"model":"llama","prompt":"Once upon","max_tokens":16}`), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var resp openai.CompletionResponse
+	json.Unmarshal(respBody, &resp)
+	if resp.Model != "llama" || resp.Choices[0].Text != " a time" || resp.Choices[0].FinishReason != "length" {
+		t.Errorf("unexpected response: %s", respBody)
+	}
+}
+
+func TestTGIStreamComplete(t *testing.T) {
+	server := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/generate_stream" {
+			t.Errorf("expected /generate_stream path, got %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range []string{
+			`data:{"index":1,"token":{"id":1,"text":" a","special":false},"generated_text":null,"details":null}`,
+			"",
+			`data:{"index":2,"token":{"id":2,"text":" time","special":false},"generated_text":" a time","details":{"finish_reason":"eos_token","generated_tokens":2}}`,
+			"",
+		} {
+			w.Write([]byte(event + "\n"))
+		}
+	}))
+	defer server.Close()
+
+	ch, err := newTestTGIProvider(server.URL).StreamComplete(context.Background(), "llama", &openai.CompletionRequest{Prompt: "Once upon"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var text strings.Builder
+	var last openai.CompletionResponse
+	for chunk := range ch {
+		text.WriteString(chunk.Choices[0].Text)
+		last = chunk
+	}
+	if text.String() != " a time" {
+		t.Errorf("expected streamed text %q, got %q", " a time", text.String())
+	}
+	if last.Choices[0].FinishReason != "stop" || last.Usage == nil || last.Usage.CompletionTokens != 2 {
+		t.Errorf("unexpected last chunk: %+v", last)
+	}
+}
@@ -0,0 +1,64 @@
+// Package provider defines the provider interface and implementations
+package provider
+
+import (
+	"github.com/macedot/openmodel/internal/endpoints"
+)
+
+// TypeVLLM is the provider type of vLLM's OpenAI-compatible server
+const TypeVLLM = "vllm"
+
+// VLLMProvider implements Provider for vLLM's OpenAI-compatible server. vLLM extensions
+// (best_of, top_k, min_p, repetition_penalty, guided_json, guided_regex, guided_choice,
+// guided_grammar, ...) are forwarded; TGI's grammar is translated to guided decoding so the
+// same request works against either server (see vllmBody).
+type VLLMProvider struct {
+	*rewritingProvider
+}
+
+// NewVLLMProvider creates a new vLLM provider
+func NewVLLMProvider(name, baseURL, apiKey string) *VLLMProvider {
+	return NewVLLMProviderWithConfig(name, baseURL, apiKey, DefaultHTTPConfig())
+}
+
+// NewVLLMProviderWithConfig creates a new vLLM provider with custom HTTP config
+func NewVLLMProviderWithConfig(name, baseURL, apiKey string, httpConfig HTTPConfig) *VLLMProvider {
+	return &VLLMProvider{newRewritingProvider(name, baseURL, apiKey, httpConfig, func(endpoint string, body []byte) []byte {
+		if endpoint != endpoints.V1ChatCompletions && endpoint != endpoints.V1Completions {
+			return body
+		}
+		return vllmBody(body)
+	})}
+}
+
+// vllmBody rewrites a chat or completion request for vLLM:
+//   - a TGI grammar, given as grammar or as a response_format of type "json" or "regex",
+//     becomes guided_json or guided_regex
+//   - best_of is dropped from streaming requests, which vLLM rejects
+//
+// Bodies that are not JSON objects are returned as is.
+func vllmBody(body []byte) []byte {
+	return rewriteJSON(body, func(req map[string]any) {
+		grammar, _ := req["grammar"].(map[string]any)
+		delete(req, "grammar")
+		if format, ok := req["response_format"].(map[string]any); ok && (format["type"] == "json" || format["type"] == "regex") {
+			grammar = format
+			delete(req, "response_format")
+		}
+		if grammar != nil {
+			switch grammar["type"] {
+			case "json", "json_object":
+				req["guided_json"] = grammar["value"]
+			case "regex":
+				req["guided_regex"] = grammar["value"]
+			}
+		}
+
+		if stream, _ := req["stream"].(bool); stream {
+			delete(req, "best_of")
+		}
+	})
+}
+
+// Interface assertion
+var _ Provider = (*VLLMProvider)(nil)
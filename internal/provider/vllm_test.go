@@ -0,0 +1,45 @@
+// Package provider provides tests for the provider implementations
+package provider
+
+import "testing"
+
+func TestVLLMBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "extensions forwarded",
+			body: `{"best_of":3,"guided_choice":["a","b"],"top_k":5}`,
+			want: `{"best_of":3,"guided_choice":["a","b"],"top_k":5}`,
+		},
+		{
+			name: "tgi grammar",
+			body: `{"grammar":{"type":"regex","value":"[0-9]+"}}`,
+			want: `{"guided_regex":"[0-9]+"}`,
+		},
+		{
+			name: "tgi response format",
+			body: `{"response_format":{"type":"json","value":{"type":"object"}}}`,
+			want: `{"guided_json":{"type":"object"}}`,
+		},
+		{
+			name: "openai response format kept",
+			body: `{"response_format":{"type":"json_object"}}`,
+			want: `{"response_format":{"type":"json_object"}}`,
+		},
+		{
+			name: "best_of dropped when streaming",
+			body: `{"best_of":3,"stream":true}`,
+			want: `{"stream":true}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(vllmBody([]byte(tt.body))); got != tt.want {
+				t.Errorf("vllmBody() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
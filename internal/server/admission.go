@@ -0,0 +1,226 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	applogger "github.com/macedot/openmodel/internal/logger"
+	"github.com/macedot/openmodel/internal/provider"
+)
+
+// Admission errors; both are answered with 429 and Retry-After
+var (
+	errAdmissionQueueFull = errors.New("too many requests queued for this model")
+	errAdmissionTimeout   = errors.New("timed out waiting for a free slot on this model")
+)
+
+// admissionQueue limits the requests a model serves at once. Waiting requests are kept
+// in a heap so a freed slot goes to the highest priority, then the longest waiting.
+type admissionQueue struct {
+	mu      sync.Mutex
+	active  int
+	seq     uint64
+	waiting waiterHeap
+}
+
+// admissionWaiter is a request waiting for a slot
+type admissionWaiter struct {
+	priority int
+	seq      uint64
+	index    int           // Position in the heap, -1 once granted or removed
+	ready    chan struct{} // Closed when the waiter is granted a slot
+}
+
+// waiterHeap orders waiters by priority (highest first), then arrival
+type waiterHeap []*admissionWaiter
+
+func (h waiterHeap) Len() int { return len(h) }
+func (h waiterHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+func (h waiterHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+func (h *waiterHeap) Push(x any) {
+	w := x.(*admissionWaiter)
+	w.index = len(*h)
+	*h = append(*h, w)
+}
+func (h *waiterHeap) Pop() any {
+	old := *h
+	w := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	w.index = -1
+	return w
+}
+
+// acquire takes a slot, waiting up to timeout behind at most maxQueue other requests
+func (q *admissionQueue) acquire(ctx context.Context, maxConcurrent, maxQueue, priority int, timeout time.Duration) error {
+	q.mu.Lock()
+	if q.active < maxConcurrent && q.waiting.Len() == 0 {
+		q.active++
+		q.mu.Unlock()
+		return nil
+	}
+	if q.waiting.Len() >= maxQueue {
+		q.mu.Unlock()
+		return errAdmissionQueueFull
+	}
+	q.seq++
+	w := &admissionWaiter{priority: priority, seq: q.seq, ready: make(chan struct{})}
+	heap.Push(&q.waiting, w)
+	q.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-w.ready:
+		return nil
+	case <-timer.C:
+		err = errAdmissionTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if w.index < 0 {
+		// Granted while giving up: hand the slot on
+		q.releaseLocked(maxConcurrent)
+		return err
+	}
+	heap.Remove(&q.waiting, w.index)
+	return err
+}
+
+// release frees a slot, granting it to the next waiter while under maxConcurrent
+func (q *admissionQueue) release(maxConcurrent int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.releaseLocked(maxConcurrent)
+}
+
+func (q *admissionQueue) releaseLocked(maxConcurrent int) {
+	q.active--
+	for q.active < maxConcurrent && q.waiting.Len() > 0 {
+		w := heap.Pop(&q.waiting).(*admissionWaiter)
+		q.active++
+		close(w.ready)
+	}
+}
+
+// admissionTicket is a granted slot. It is released once every holder is done, so a
+// streaming response can keep the slot after its handler returns.
+type admissionTicket struct {
+	refs    atomic.Int32
+	release func()
+}
+
+// done drops the handler's hold on the slot
+func (t *admissionTicket) done() {
+	if t != nil && t.refs.Add(-1) == 0 {
+		t.release()
+	}
+}
+
+// hold keeps the slot until the returned func is called
+func (t *admissionTicket) hold() func() {
+	if t == nil {
+		return func() {}
+	}
+	t.refs.Add(1)
+	return t.done
+}
+
+type admissionTicketKey struct{}
+
+// admissionFromContext returns the request's admission ticket, nil if not admission controlled
+func admissionFromContext(ctx context.Context) *admissionTicket {
+	t, _ := ctx.Value(admissionTicketKey{}).(*admissionTicket)
+	return t
+}
+
+// admit applies the model's admission control: it returns at once when a slot is free and
+// otherwise queues the request by priority. The returned context carries the ticket; call
+// its done when the handler ends. Models without admission control get a nil ticket.
+func (s *Server) admit(ctx context.Context, model string, header func(string) string) (context.Context, *admissionTicket, error) {
+	admission := s.GetConfig().Models[model].Admission
+	if admission == nil || admission.MaxConcurrent <= 0 {
+		return ctx, nil, nil
+	}
+
+	q := s.admissionQueue(model)
+	priority := requestPriority(admission, header)
+	if err := q.acquire(ctx, admission.MaxConcurrent, admission.MaxQueue, priority, admission.GetQueueTimeout()); err != nil {
+		applogger.Warn("admission_rejected", "request_id", provider.RequestIDFromContext(ctx), "model", model, "priority", priority, "error", err.Error())
+		return ctx, nil, err
+	}
+
+	ticket := &admissionTicket{release: func() {
+		// Re-read the limit so a reload that raises it frees waiters straight away
+		maxConcurrent := admission.MaxConcurrent
+		if current := s.GetConfig().Models[model].Admission; current != nil && current.MaxConcurrent > 0 {
+			maxConcurrent = current.MaxConcurrent
+		}
+		q.release(maxConcurrent)
+	}}
+	ticket.refs.Store(1)
+	return context.WithValue(ctx, admissionTicketKey{}, ticket), ticket, nil
+}
+
+// admissionQueue returns the queue of a model, creating it on first use
+func (s *Server) admissionQueue(model string) *admissionQueue {
+	s.admissionMu.Lock()
+	defer s.admissionMu.Unlock()
+	if s.admissionQueues == nil {
+		s.admissionQueues = make(map[string]*admissionQueue)
+	}
+	q, ok := s.admissionQueues[model]
+	if !ok {
+		q = &admissionQueue{}
+		s.admissionQueues[model] = q
+	}
+	return q
+}
+
+// requestPriority returns the priority of a request: its API key tier if configured,
+// otherwise the integer in the priority header, otherwise 0
+func requestPriority(admission *config.AdmissionConfig, header func(string) string) int {
+	if priority, ok := admission.KeyPriority(requestAPIKey(header)); ok {
+		return priority
+	}
+	priority, _ := strconv.Atoi(strings.TrimSpace(header(admission.GetPriorityHeader())))
+	return priority
+}
+
+// requestAPIKey returns the client API key of a request: the Authorization bearer token
+// or, for Anthropic clients, the x-api-key header
+func requestAPIKey(header func(string) string) string {
+	key, _ := strings.CutPrefix(header(fiber.HeaderAuthorization), "Bearer ")
+	if key == "" {
+		key = header("x-api-key")
+	}
+	return key
+}
+
+// admissionRetryAfter is the Retry-After, in seconds, sent with an admission rejection
+func (s *Server) admissionRetryAfter(model string) int {
+	timeout := s.GetConfig().Models[model].Admission.GetQueueTimeout()
+	return max(1, int(math.Ceil(timeout.Seconds())))
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/endpoints"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// waitForQueued blocks until n requests wait in q
+func waitForQueued(t *testing.T, q *admissionQueue, n int) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return q.waiting.Len() == n
+	}, time.Second, time.Millisecond)
+}
+
+func TestAdmissionQueue_PriorityOrder(t *testing.T) {
+	q := &admissionQueue{}
+	ctx := context.Background()
+	require.NoError(t, q.acquire(ctx, 1, 10, 0, time.Second))
+
+	var (
+		mu    sync.Mutex
+		order []int
+		wg    sync.WaitGroup
+	)
+	for i, priority := range []int{0, 5, 1, 5} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := q.acquire(ctx, 1, 10, priority, time.Second); err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			order = append(order, priority)
+			mu.Unlock()
+			q.release(1)
+		}()
+		waitForQueued(t, q, i+1)
+	}
+
+	q.release(1)
+	wg.Wait()
+	assert.Equal(t, []int{5, 5, 1, 0}, order)
+	assert.Equal(t, 0, q.active)
+}
+
+func TestAdmissionQueue_Rejections(t *testing.T) {
+	q := &admissionQueue{}
+	ctx := context.Background()
+	require.NoError(t, q.acquire(ctx, 1, 1, 0, time.Second))
+
+	// One waiter fills the queue; it gives up after its timeout
+	errs := make(chan error, 1)
+	go func() { errs <- q.acquire(ctx, 1, 1, 0, 20*time.Millisecond) }()
+	waitForQueued(t, q, 1)
+	assert.ErrorIs(t, q.acquire(ctx, 1, 1, 9, time.Second), errAdmissionQueueFull)
+	assert.ErrorIs(t, <-errs, errAdmissionTimeout)
+	waitForQueued(t, q, 0)
+
+	q.release(1)
+	assert.Equal(t, 0, q.active)
+}
+
+func TestAdmissionTicket_Hold(t *testing.T) {
+	released := 0
+	ticket := &admissionTicket{release: func() { released++ }}
+	ticket.refs.Store(1)
+
+	done := ticket.hold()
+	ticket.done()
+	assert.Equal(t, 0, released, "slot kept while the stream holds it")
+	done()
+	assert.Equal(t, 1, released)
+
+	var none *admissionTicket
+	none.hold()()
+	none.done()
+}
+
+func TestRequestPriority(t *testing.T) {
+	t.Setenv("OPENMODEL_TEST_GOLD_KEY", "sk-gold")
+	admission := &config.AdmissionConfig{KeyPriorities: map[string]int{"${OPENMODEL_TEST_GOLD_KEY}": 10, "sk-bronze": 1}}
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{name: "none", want: 0},
+		{name: "header", headers: map[string]string{"X-Priority": " 3 "}, want: 3},
+		{name: "invalid header", headers: map[string]string{"X-Priority": "high"}, want: 0},
+		{name: "bearer tier beats header", headers: map[string]string{"Authorization": "Bearer sk-gold", "X-Priority": "3"}, want: 10},
+		{name: "x-api-key tier", headers: map[string]string{"x-api-key": "sk-bronze"}, want: 1},
+		{name: "unknown key uses header", headers: map[string]string{"Authorization": "Bearer sk-other", "X-Priority": "2"}, want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range tt.headers {
+				h.Set(k, v)
+			}
+			assert.Equal(t, tt.want, requestPriority(admission, h.Get))
+		})
+	}
+}
+
+func TestHandleV1ChatCompletions_AdmissionLimit(t *testing.T) {
+	started, unblock := make(chan struct{}), make(chan struct{})
+	prov := &stubProvider{
+		name: "ollama",
+		doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+			close(started)
+			<-unblock
+			return []byte(`{"id":"c1","object":"chat.completion","choices":[]}`), nil
+		},
+	}
+	srv := newStreamingTestServer(prov)
+	modelConfig := srv.config.Models["gpt-4"]
+	modelConfig.Admission = &config.AdmissionConfig{MaxConcurrent: 1, QueueTimeoutMs: 1500}
+	srv.config.Models["gpt-4"] = modelConfig
+
+	app := fiber.New()
+	app.Post(endpoints.V1ChatCompletions, srv.handleV1ChatCompletions)
+	send := func() *http.Response {
+		req := httptest.NewRequest("POST", endpoints.V1ChatCompletions, strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		require.NoError(t, err)
+		return resp
+	}
+
+	first := make(chan int)
+	go func() { first <- send().StatusCode }()
+	<-started
+
+	resp := send()
+	assert.Equal(t, fiber.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get("Retry-After"))
+
+	close(unblock)
+	assert.Equal(t, fiber.StatusOK, <-first)
+	assert.Equal(t, 0, srv.admissionQueue("gpt-4").active, "slot released after the response")
+}
@@ -0,0 +1,163 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/audit"
+	"github.com/macedot/openmodel/internal/config"
+	applogger "github.com/macedot/openmodel/internal/logger"
+	"github.com/macedot/openmodel/internal/usage"
+)
+
+// auditActorClient is the audit actor of requests to the model APIs
+const auditActorClient = "client"
+
+// Anthropic error types of API key failures
+const (
+	anthropicAuthenticationError = "authentication_error"
+	anthropicPermissionError     = "permission_error"
+)
+
+// apiKeysMiddleware requires requests to the model APIs to present a configured or issued
+// API key, a JWT or a client certificate that may use their endpoint group, when any of
+// them is set up, and holds keys to their quotas and rates. It reads the current config, so a
+// reload applies at once.
+func (s *Server) apiKeysMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		cfg := s.GetConfig()
+		group := endpointGroup(c.Path())
+		if !s.apiKeysEnabled(cfg) || !config.IsAPIKeyEndpointGroup(group) {
+			return c.Next()
+		}
+		key, id, ok := s.lookupClientCert(c, cfg)
+		if !ok {
+			key, id, ok = s.lookupAPIKey(c.UserContext(), cfg, requestAPIKey(requestHeader(c)))
+		}
+		if !ok {
+			err := fmt.Errorf("invalid api key")
+			s.recordAudit(c, auditActorClient, audit.ActionAuthFailure, c.Path(), "", err)
+			return apiKeyError(c, group, err.Error(), fiber.StatusUnauthorized)
+		}
+		if !key.AllowsEndpoints(group) {
+			requestID, _ := c.Locals("request_id").(string)
+			applogger.Warn("api_key_denied", "request_id", requestID, "key", key.Name, "endpoints", group)
+			return apiKeyError(c, group, fmt.Sprintf("api key %q may not use the %s endpoints", key.Name, group), fiber.StatusForbidden)
+		}
+		c.Locals("api_key", key.Name)
+		c.SetUserContext(withClientKey(c.UserContext(), key, id))
+		if !s.enforceQuota(c, group, id, key) {
+			return nil
+		}
+		return s.limitKey(c, group, id, key)
+	}
+}
+
+// apiKeyError writes an API key failure in the format of the endpoint group
+func apiKeyError(c *fiber.Ctx, group, message string, statusCode int) error {
+	if group != config.EndpointsAnthropic {
+		return handleError(c, message, statusCode)
+	}
+	errType := anthropicPermissionError
+	if statusCode == fiber.StatusUnauthorized {
+		errType = anthropicAuthenticationError
+	}
+	return handleAnthropicError(c, message, errType, statusCode)
+}
+
+// authorizeModel checks that the tenant and the API key of a request may use a requested
+// model name. Requests need no key when the config has none and the key store is disabled.
+func (s *Server) authorizeModel(ctx context.Context, header func(string) string, model string) error {
+	if tenant, ok := tenantFromContext(ctx); ok && !tenant.AllowsModel(model) {
+		applogger.Warn("tenant_denied", "tenant", tenant.Name, "model", model)
+		return fmt.Errorf("tenant %q may not use model %q", tenant.Name, model)
+	}
+	cfg := s.GetConfig()
+	if !s.apiKeysEnabled(cfg) {
+		return nil
+	}
+	key, _, ok := clientKeyFromContext(ctx)
+	if !ok {
+		key, _, ok = s.lookupAPIKey(ctx, cfg, requestAPIKey(header))
+	}
+	if !ok {
+		return fmt.Errorf("invalid api key")
+	}
+	if !key.AllowsModel(model) {
+		applogger.Warn("api_key_denied", "key", key.Name, "model", model)
+		return fmt.Errorf("api key %q may not use model %q", key.Name, model)
+	}
+	return nil
+}
+
+// modelListFilter returns whether the tenant and the API key of a request may use each
+// model it lists
+func (s *Server) modelListFilter(c *fiber.Ctx) func(name string) bool {
+	cfg := s.GetConfig()
+	tenant, _ := tenantFromContext(c.UserContext())
+	if !s.apiKeysEnabled(cfg) {
+		return tenant.AllowsModel
+	}
+	key, _, ok := clientKeyFromContext(c.UserContext())
+	if !ok {
+		key, _, ok = s.lookupAPIKey(c.UserContext(), cfg, requestAPIKey(requestHeader(c)))
+	}
+	return func(name string) bool { return ok && tenant.AllowsModel(name) && key.AllowsModel(name) }
+}
+
+// apiKeysEnabled reports whether clients of the model APIs must authenticate: when the
+// config has API keys or client certificates, the key store is open or JWTs are accepted
+func (s *Server) apiKeysEnabled(cfg *config.Config) bool {
+	return len(cfg.APIKeys) > 0 || len(cfg.ClientCerts) > 0 || s.keys != nil || s.jwtEnabled(cfg)
+}
+
+// lookupAPIKey returns the API key a client presented and its id: a configured key, one
+// issued through the key store or a JWT. A failing store is logged and accepts no key.
+func (s *Server) lookupAPIKey(ctx context.Context, cfg *config.Config, secret string) (config.APIKey, string, bool) {
+	if key, id, ok := s.lookupJWT(ctx, cfg, secret); ok {
+		return key, id, true
+	}
+	if key, ok := cfg.LookupAPIKey(secret); ok {
+		return key, usage.KeyID(secret), true
+	}
+	issued, ok, err := s.keys.Lookup(ctx, secret)
+	if err != nil {
+		applogger.Warn("api_key_lookup_failed", "error", err)
+		return config.APIKey{}, "", false
+	}
+	if !ok {
+		return config.APIKey{}, "", false
+	}
+	return apiKeyFromLimits(issued.Name, issued.Limits), usage.KeyID(secret), true
+}
+
+// clientKeyKey carries the API key a request was authenticated with in its context
+type clientKeyKey struct{}
+
+// clientKey is the API key a request was authenticated with and its id
+type clientKey struct {
+	key config.APIKey
+	id  string
+}
+
+// withClientKey attaches the API key a request was authenticated with
+func withClientKey(ctx context.Context, key config.APIKey, id string) context.Context {
+	return context.WithValue(ctx, clientKeyKey{}, clientKey{key: key, id: id})
+}
+
+// clientKeyFromContext returns the API key a request was authenticated with and its id
+func clientKeyFromContext(ctx context.Context) (config.APIKey, string, bool) {
+	ck, ok := ctx.Value(clientKeyKey{}).(clientKey)
+	return ck.key, ck.id, ok
+}
+
+// clientKeyID returns the id of the API key of a request: the one it was authenticated
+// with, or else that of the key it presents
+func clientKeyID(ctx context.Context, header func(string) string) string {
+	if _, id, ok := clientKeyFromContext(ctx); ok {
+		return id
+	}
+	return usage.KeyID(requestAPIKey(header))
+}
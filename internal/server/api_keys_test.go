@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/api/openai"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeys(t *testing.T) {
+	prov := &stubProvider{
+		name: "ollama",
+		doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+			if endpoint == EndpointV1Embeddings {
+				return []byte(`{"object":"list","data":[{"object":"embedding","index":0,"embedding":[0.1]}],"model":"text-embedding-3-small"}`), nil
+			}
+			return []byte(`{"id":"c1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}]}`), nil
+		},
+	}
+	srv := newStreamingTestServer(prov)
+	srv.config.Models["text-embedding-3-small"] = config.ModelConfig{Strategy: "fallback", Providers: []config.ModelProvider{{Provider: "ollama", Model: "text-embedding-3-small"}}}
+	srv.config.APIKeys = []config.APIKey{
+		{Name: "chat", Key: "sk-chat"},
+		{Name: "embeddings", Key: "sk-embed", Models: []string{"text-embedding-*"}, Endpoints: []string{config.EndpointsOpenAI}},
+	}
+	app := fiber.New()
+	app.Use(srv.apiKeysMiddleware())
+	srv.registerRoutes(app)
+
+	chat := `{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`
+	messages := `{"model":"gpt-4","max_tokens":10,"messages":[{"role":"user","content":"hello"}]}`
+	embeddings := `{"model":"text-embedding-3-small","input":"hello"}`
+	tests := []struct {
+		name      string
+		path      string
+		body      string
+		bearer    string
+		xAPIKey   string
+		want      int
+		wantError string
+	}{
+		{name: "no key", path: EndpointV1ChatCompletions, body: chat, want: fiber.StatusUnauthorized},
+		{name: "unknown key", path: EndpointV1ChatCompletions, body: chat, bearer: "sk-other", want: fiber.StatusUnauthorized},
+		{name: "chat key", path: EndpointV1ChatCompletions, body: chat, bearer: "sk-chat", want: fiber.StatusOK},
+		{name: "chat key embeddings", path: EndpointV1Embeddings, body: embeddings, bearer: "sk-chat", want: fiber.StatusOK},
+		{name: "chat key anthropic", path: EndpointV1Messages, body: messages, xAPIKey: "sk-chat", want: fiber.StatusOK},
+		{name: "embeddings key", path: EndpointV1Embeddings, body: embeddings, bearer: "sk-embed", want: fiber.StatusOK},
+		{name: "embeddings key chat model", path: EndpointV1ChatCompletions, body: chat, bearer: "sk-embed", want: fiber.StatusForbidden, wantError: "may not use model"},
+		{name: "embeddings key anthropic", path: EndpointV1Messages, body: messages, xAPIKey: "sk-embed", want: fiber.StatusForbidden, wantError: "permission_error"},
+		{name: "anthropic no key", path: EndpointV1Messages, body: messages, want: fiber.StatusUnauthorized, wantError: "authentication_error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("anthropic-version", "2023-06-01")
+			if tt.bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			if tt.xAPIKey != "" {
+				req.Header.Set("x-api-key", tt.xAPIKey)
+			}
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			data, _ := io.ReadAll(resp.Body)
+			assert.Equal(t, tt.want, resp.StatusCode, string(data))
+			assert.Contains(t, string(data), tt.wantError)
+		})
+	}
+
+	// Health endpoints need no key
+	resp, err := app.Test(httptest.NewRequest("GET", EndpointHealth, nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	// Clients see only the models their key may use
+	listModels := func(key string) []string {
+		req := httptest.NewRequest("GET", EndpointV1Models, nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+		var list openai.ModelList
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+		var names []string
+		for _, m := range list.Data {
+			names = append(names, m.ID)
+		}
+		return names
+	}
+	assert.ElementsMatch(t, []string{"gpt-4", "text-embedding-3-small"}, listModels("sk-chat"))
+	assert.Equal(t, []string{"text-embedding-3-small"}, listModels("sk-embed"))
+
+	req := httptest.NewRequest("GET", "/v1/models/gpt-4", nil)
+	req.Header.Set("Authorization", "Bearer sk-embed")
+	resp, err = app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+}
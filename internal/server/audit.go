@@ -0,0 +1,54 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/audit"
+)
+
+// Actors of actions taken through the HTTP API
+const (
+	auditActorAdmin   = "admin"
+	auditActorMetrics = "metrics"
+)
+
+// SetAuditLog sets the log administrative actions and failed authentications are recorded
+// to. A nil log, the default, records nothing.
+func (s *Server) SetAuditLog(l *audit.Logger) {
+	s.audit = l
+}
+
+// recordAudit records an action taken through the HTTP API by actor, identified by the id
+// of the bearer token it presented and its address. A non-nil err records a failure.
+func (s *Server) recordAudit(c *fiber.Ctx, actor, action, target, detail string, err error) {
+	s.audit.Record(auditEvent(audit.Event{
+		Action:     action,
+		Actor:      actor,
+		KeyID:      clientKeyID(c.UserContext(), requestHeader(c)),
+		RemoteAddr: c.IP(),
+		Target:     target,
+		Detail:     detail,
+	}, err))
+}
+
+// RecordConfigReload records a reload of the config not requested through the admin API:
+// by actor audit.ActorSignal or audit.ActorWatcher, with what changed. It is audited and
+// counted in openmodel_config_reloads_total.
+func (s *Server) RecordConfigReload(actor, detail string, err error) {
+	s.metrics.observeConfigReload(err)
+	s.audit.Record(auditEvent(audit.Event{
+		Action: audit.ActionConfigReload,
+		Actor:  actor,
+		Detail: detail,
+	}, err))
+}
+
+// auditEvent sets the outcome of e from err
+func auditEvent(e audit.Event, err error) audit.Event {
+	e.Outcome = audit.OutcomeSuccess
+	if err != nil {
+		e.Outcome = audit.OutcomeFailure
+		e.Error = err.Error()
+	}
+	return e
+}
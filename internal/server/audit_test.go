@@ -0,0 +1,66 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/audit"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/usage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := audit.OpenFile(path)
+	require.NoError(t, err)
+	srv, app := newAdminTestServer(&config.AdminConfig{Enabled: true, Token: "s3cret"})
+	srv.SetAuditLog(l)
+
+	for _, tt := range []struct {
+		method, path, token string
+		want                int
+	}{
+		{"GET", EndpointAdminBackends, "wrong", fiber.StatusUnauthorized},
+		{"POST", EndpointAdminBackends + "/canary/gpt-4o/disable", "s3cret", fiber.StatusOK},
+		{"DELETE", "/admin/weights/chat", "s3cret", fiber.StatusOK},
+		// Reads are not audited
+		{"GET", EndpointAdminBackends, "s3cret", fiber.StatusOK},
+	} {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, tt.want, resp.StatusCode, tt.path)
+	}
+	srv.RecordConfigReload(audit.ActorSignal, "", assert.AnError)
+	require.NoError(t, l.Close())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	var events []audit.Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e audit.Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		assert.NotEmpty(t, e.Time)
+		e.Time = ""
+		events = append(events, e)
+	}
+	assert.Equal(t, []audit.Event{
+		{Action: audit.ActionAuthFailure, Outcome: audit.OutcomeFailure, Actor: "admin", KeyID: usage.KeyID("wrong"),
+			RemoteAddr: "0.0.0.0", Target: EndpointAdminBackends, Error: "invalid admin token"},
+		{Action: audit.ActionBackendDisable, Outcome: audit.OutcomeSuccess, Actor: "admin", KeyID: usage.KeyID("s3cret"),
+			RemoteAddr: "0.0.0.0", Target: "canary/gpt-4o"},
+		{Action: audit.ActionWeightsReset, Outcome: audit.OutcomeSuccess, Actor: "admin", KeyID: usage.KeyID("s3cret"),
+			RemoteAddr: "0.0.0.0", Target: "chat"},
+		{Action: audit.ActionConfigReload, Outcome: audit.OutcomeFailure, Actor: audit.ActorSignal, Error: assert.AnError.Error()},
+	}, events)
+}
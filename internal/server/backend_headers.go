@@ -0,0 +1,68 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// servedBy records the backend attempts of a request: how many were made, counting
+// retries and failovers, and which backend answered in how long
+type servedBy struct {
+	mu       sync.Mutex
+	attempts int
+	backend  string
+	latency  time.Duration
+}
+
+type servedByKey struct{}
+
+// servedByFromContext returns the request's backend attempts, nil if they are not recorded
+func servedByFromContext(ctx context.Context) *servedBy {
+	r, _ := ctx.Value(servedByKey{}).(*servedBy)
+	return r
+}
+
+// record counts an attempt of backend providerKey that took latency, which served the
+// request unless it failed
+func (r *servedBy) record(providerKey string, latency time.Duration, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts++
+	if err == nil {
+		r.backend, r.latency = providerKey, latency
+	}
+}
+
+// backendHeadersMiddleware tells the client which backend served a request when the
+// server's backend_headers is set: X-OpenModel-Backend, X-OpenModel-Attempts and
+// X-OpenModel-Latency. Streamed responses send their headers before the stream is opened,
+// so they only carry the backend tried first.
+func (s *Server) backendHeadersMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !s.GetConfig().Server.BackendHeaders {
+			return c.Next()
+		}
+		r := &servedBy{}
+		c.SetUserContext(context.WithValue(c.UserContext(), servedByKey{}, r))
+		err := c.Next()
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.backend != "" {
+			c.Set(HeaderXOpenModelBackend, r.backend)
+			c.Set(HeaderXOpenModelAttempts, strconv.Itoa(r.attempts))
+			c.Set(HeaderXOpenModelLatency, strconv.FormatInt(r.latency.Milliseconds(), 10))
+		} else if backend, ok := c.Locals("provider").(string); ok && c.Response().IsBodyStream() {
+			c.Set(HeaderXOpenModelBackend, backend)
+		}
+		return err
+	}
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/provider"
+	"github.com/macedot/openmodel/internal/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackendHeaders(t *testing.T) {
+	failing := &stubProvider{
+		name: "primary",
+		doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+			return nil, &provider.StatusError{StatusCode: 500, Err: fmt.Errorf("boom")}
+		},
+	}
+	healthy := &stubProvider{
+		name: "backup",
+		doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+			return []byte(`{"id":"c1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}]}`), nil
+		},
+		doStreamReqFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+			return streamOf(`data: {"id":"c1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"hi"},"finish_reason":"stop"}]}`, SSEDataDone), nil
+		},
+	}
+	cfg := &config.Config{
+		Models: map[string]config.ModelConfig{
+			"gpt-4":  {Strategy: config.StrategyFallback, Providers: []config.ModelProvider{{Provider: "primary", Model: "gpt-4o"}, {Provider: "backup", Model: "gpt-4o-mini"}}},
+			"stream": {Strategy: config.StrategyFallback, Providers: []config.ModelProvider{{Provider: "backup", Model: "gpt-4o-mini"}}},
+		},
+		Thresholds: config.ThresholdsConfig{FailuresBeforeSwitch: 3, InitialTimeout: 1000, MaxTimeout: 10000},
+	}
+	srv := &Server{config: cfg, providers: providerMap{"primary": failing, "backup": healthy}, state: state.New()}
+	app := fiber.New()
+	app.Use(srv.backendHeadersMiddleware())
+	srv.registerRoutes(app)
+
+	send := func(body string) http.Header {
+		req := httptest.NewRequest("POST", EndpointV1ChatCompletions, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+		return resp.Header
+	}
+
+	cfg.Server.BackendHeaders = true
+	// The primary fails once, then the backup serves
+	header := send(`{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`)
+	assert.Equal(t, "backup/gpt-4o-mini", header.Get(HeaderXOpenModelBackend))
+	assert.Equal(t, "2", header.Get(HeaderXOpenModelAttempts))
+	assert.NotEmpty(t, header.Get(HeaderXOpenModelLatency))
+
+	header = send(`{"model":"stream","stream":true,"messages":[{"role":"user","content":"hello"}]}`)
+	assert.Equal(t, "backup/gpt-4o-mini", header.Get(HeaderXOpenModelBackend))
+	assert.Empty(t, header.Get(HeaderXOpenModelAttempts))
+
+	cfg.Server.BackendHeaders = false
+	header = send(`{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`)
+	assert.Empty(t, header.Get(HeaderXOpenModelBackend))
+}
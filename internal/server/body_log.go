@@ -0,0 +1,104 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"slices"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/bodylog"
+	"github.com/macedot/openmodel/internal/config"
+)
+
+// bodyLogGroups are the endpoint groups whose requests are body logged
+var bodyLogGroups = []string{config.EndpointsOpenAI, config.EndpointsAnthropic, config.EndpointsOllama}
+
+// bodyLogRequest is the body log entry of a request in progress
+type bodyLogRequest struct {
+	entry     bodylog.Entry
+	start     time.Time
+	streaming bool              // the entry is written once the stream ends
+	text      bodylog.Assembler // streamed output written to the client
+}
+
+// SetBodyLog sets the log request and response bodies are written to
+func (s *Server) SetBodyLog(l *bodylog.Logger) {
+	s.bodyLog = l
+}
+
+// bodyLogFromLocals returns the body log entry of a request, nil if it is not logged
+func bodyLogFromLocals(c *fiber.Ctx) *bodyLogRequest {
+	req, _ := c.Locals("body_log").(*bodyLogRequest)
+	return req
+}
+
+// add adds a chunk of the stream written to the client
+func (r *bodyLogRequest) add(chunk string) {
+	if r != nil {
+		r.text.Add(chunk)
+	}
+}
+
+// stream hands the entry over to the stream writer of the response, which writes it once
+// the stream ends
+func (r *bodyLogRequest) stream(requestID, model string) {
+	if r != nil {
+		r.streaming = true
+		r.entry.Time = r.start.UTC().Format(time.RFC3339Nano)
+		r.entry.RequestID, r.entry.Model = requestID, model
+		r.entry.Status, r.entry.Stream = fiber.StatusOK, true
+	}
+}
+
+// bodyLogMiddleware logs the bodies of API requests and their responses. A streamed
+// response is logged by its stream writer when the stream ends.
+func (s *Server) bodyLogMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Method() != fiber.MethodPost || !slices.Contains(bodyLogGroups, endpointGroup(c.Path())) {
+			return c.Next()
+		}
+		headers := make(map[string]string)
+		c.Request().Header.VisitAll(func(k, v []byte) {
+			headers[string(k)] = string(v)
+		})
+		req := &bodyLogRequest{start: time.Now()}
+		req.entry = bodylog.Entry{
+			Method:         c.Method(),
+			Path:           c.Path(),
+			RequestHeaders: s.bodyLog.Headers(headers),
+			Request:        s.bodyLog.Body(c.Body(), string(c.Request().Header.ContentType())),
+		}
+		c.Locals("body_log", req)
+
+		err := c.Next()
+
+		// The stream writer has the entry of a streamed response
+		if req.streaming {
+			return err
+		}
+		req.entry.Time = req.start.UTC().Format(time.RFC3339Nano)
+		req.entry.RequestID, _ = c.Locals("request_id").(string)
+		req.entry.Model, _ = c.Locals("model").(string)
+		req.entry.Backend, _ = c.Locals("provider").(string)
+		req.entry.Status = c.Response().StatusCode()
+		if c.Response().IsBodyStream() {
+			req.entry.Stream = true
+		} else {
+			req.entry.Response = s.bodyLog.Body(c.Response().Body(), string(c.Response().Header.ContentType()))
+		}
+		s.writeBodyLog(req)
+		return err
+	}
+}
+
+// writeBodyLog writes the entry of a request once its response is complete
+func (s *Server) writeBodyLog(req *bodyLogRequest) {
+	if req == nil {
+		return
+	}
+	req.entry.DurationMs = time.Since(req.start).Milliseconds()
+	if req.streaming {
+		req.entry.ResponseText = s.bodyLog.Text(req.text.String())
+	}
+	s.bodyLog.Write(req.entry)
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/bodylog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBodyLog(t *testing.T) {
+	prov := &stubProvider{
+		name: "ollama",
+		doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+			return []byte(`{"id":"c1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"write to jane@example.com"}}]}`), nil
+		},
+		doStreamReqFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+			return streamOf(
+				`data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4","choices":[{"index":0,"delta":{"content":"mail "},"finish_reason":null}]}`,
+				`data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4","choices":[{"index":0,"delta":{"content":"jane@example.com"},"finish_reason":"stop"}]}`,
+				SSEDataDone,
+			), nil
+		},
+	}
+	srv := newStreamingTestServer(prov)
+	path := filepath.Join(t.TempDir(), "bodies.jsonl")
+	l, err := bodylog.Open(path, bodylog.Options{Patterns: []string{`[\w.+-]+@[\w-]+\.[\w.]+`}})
+	require.NoError(t, err)
+	defer l.Close()
+	srv.SetBodyLog(l)
+
+	app := fiber.New()
+	app.Use(srv.bodyLogMiddleware())
+	srv.registerRoutes(app)
+
+	for _, stream := range []bool{false, true} {
+		reqBody := `{"model":"gpt-4","user":"u-42","messages":[{"role":"user","content":"hello"}],"stream":` + strconv.FormatBool(stream) + `}`
+		req := httptest.NewRequest("POST", EndpointV1ChatCompletions, strings.NewReader(reqBody))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer sk-secret")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+		_, err = io.ReadAll(resp.Body)
+		require.NoError(t, err)
+	}
+	// Requests outside the API endpoint groups are not logged
+	resp, err := app.Test(httptest.NewRequest("GET", EndpointV1Models, nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "sk-secret")
+	assert.NotContains(t, string(data), "jane@example.com")
+	assert.NotContains(t, string(data), "u-42")
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+
+	var entries [2]bodylog.Entry
+	for i, line := range lines {
+		require.NoError(t, json.Unmarshal([]byte(line), &entries[i]))
+		assert.Equal(t, EndpointV1ChatCompletions, entries[i].Path)
+		assert.Equal(t, fiber.StatusOK, entries[i].Status)
+		assert.Equal(t, "gpt-4", entries[i].Model)
+		assert.Equal(t, "ollama/gpt-4", entries[i].Backend)
+		assert.Equal(t, bodylog.Redacted, entries[i].RequestHeaders["Authorization"])
+		assert.Equal(t, bodylog.Redacted, entries[i].Request.(map[string]any)["user"])
+	}
+	assert.False(t, entries[0].Stream)
+	assert.Equal(t, "write to "+bodylog.Redacted, entries[0].Response.(map[string]any)["choices"].([]any)[0].(map[string]any)["message"].(map[string]any)["content"])
+	assert.True(t, entries[1].Stream)
+	assert.Nil(t, entries[1].Response)
+	assert.Equal(t, "mail "+bodylog.Redacted, entries[1].ResponseText)
+}
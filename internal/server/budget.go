@@ -0,0 +1,203 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/macedot/openmodel/internal/api/openai"
+	applogger "github.com/macedot/openmodel/internal/logger"
+)
+
+// spendTracker accumulates what each provider, or anything else spend is added up by, has
+// cost in the current UTC day and month. Spend is kept in memory, so it starts over when
+// the server restarts.
+type spendTracker struct {
+	mu    sync.Mutex
+	spend map[string]periodSpend
+}
+
+// periodSpend is spend in its current periods
+type periodSpend struct {
+	Day     string  `json:"day"`   // "2006-01-02"
+	Month   string  `json:"month"` // "2006-01"
+	Daily   float64 `json:"daily"`
+	Monthly float64 `json:"monthly"`
+}
+
+// rolled returns the spend with periods that ended before now started over
+func (p periodSpend) rolled(now time.Time) periodSpend {
+	now = now.UTC()
+	if day := now.Format(time.DateOnly); p.Day != day {
+		p.Day, p.Daily = day, 0
+	}
+	if month := now.Format("2006-01"); p.Month != month {
+		p.Month, p.Monthly = month, 0
+	}
+	return p
+}
+
+// current returns a provider's spend in the periods containing now
+func (t *spendTracker) current(provider string, now time.Time) periodSpend {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.spend[provider].rolled(now)
+}
+
+// add records cost against a provider, returning its spend before and after
+func (t *spendTracker) add(provider string, cost float64, now time.Time) (before, after periodSpend) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.spend == nil {
+		t.spend = make(map[string]periodSpend)
+	}
+	before = t.spend[provider].rolled(now)
+	after = before
+	after.Daily += cost
+	after.Monthly += cost
+	t.spend[provider] = after
+	return before, after
+}
+
+// all returns the spend of everything tracked in the periods containing now
+func (t *spendTracker) all(now time.Time) map[string]periodSpend {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	spend := make(map[string]periodSpend, len(t.spend))
+	for key, p := range t.spend {
+		spend[key] = p.rolled(now)
+	}
+	return spend
+}
+
+// recordSpend prices a request's token usage with the provider's configured pricing and
+// adds it to the provider's spend, returning the cost (0 for unpriced backends). Reaching
+// a budget takes the provider out of routing (see budgetExhausted) until the period ends.
+func (s *Server) recordSpend(ctx context.Context, providerKey string, usage openai.Usage) float64 {
+	providerName, model, _ := strings.Cut(providerKey, "/")
+	providerCfg := s.GetConfig().Providers[providerName]
+	price, ok := providerCfg.PriceFor(model)
+	if !ok || usage.PromptTokens+usage.CompletionTokens == 0 {
+		return 0
+	}
+
+	cost := price.Cost(usage.PromptTokens, usage.CompletionTokens)
+	now := time.Now()
+	before, after := s.spend.add(providerName, cost, now)
+	b := providerCfg.Budget
+	if !b.Exceeded(before.Daily, before.Monthly) && b.Exceeded(after.Daily, after.Monthly) {
+		applogger.Warn("budget_exhausted", "provider", providerName,
+			"daily_spend", after.Daily, "daily_budget", b.Daily,
+			"monthly_spend", after.Monthly, "monthly_budget", b.Monthly)
+	}
+	s.recordCost(ctx, providerKey, cost, now, spendChange{before, after})
+	return cost
+}
+
+// budgetExhausted reports whether a provider has reached its daily or monthly budget.
+// The caller must hold providersMu.
+func (s *Server) budgetExhausted(providerName string) bool {
+	b := s.config.Providers[providerName].Budget
+	if b == nil {
+		return false
+	}
+	spend := s.spend.current(providerName, time.Now())
+	return b.Exceeded(spend.Daily, spend.Monthly)
+}
+
+// providerSpendReport is one provider in the spend listing
+type providerSpendReport struct {
+	Provider      string  `json:"provider"`
+	Daily         float64 `json:"daily"`
+	Monthly       float64 `json:"monthly"`
+	DailyBudget   float64 `json:"daily_budget,omitempty"`
+	MonthlyBudget float64 `json:"monthly_budget,omitempty"`
+	Exhausted     bool    `json:"exhausted"`
+}
+
+// spendReport lists the current spend of every provider with pricing
+func (s *Server) spendReport() []providerSpendReport {
+	cfg := s.GetConfig()
+	now := time.Now()
+	report := []providerSpendReport{}
+	for name, providerCfg := range cfg.Providers {
+		if len(providerCfg.Pricing) == 0 {
+			continue
+		}
+		spend := s.spend.current(name, now)
+		entry := providerSpendReport{Provider: name, Daily: spend.Daily, Monthly: spend.Monthly}
+		if b := providerCfg.Budget; b != nil {
+			entry.DailyBudget, entry.MonthlyBudget = b.Daily, b.Monthly
+			entry.Exhausted = b.Exceeded(spend.Daily, spend.Monthly)
+		}
+		report = append(report, entry)
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].Provider < report[j].Provider })
+	return report
+}
+
+// responseUsage extracts token usage from a non-streaming OpenAI or Anthropic response
+func responseUsage(resp []byte) openai.Usage {
+	var body struct {
+		Usage *tokenCounts `json:"usage"`
+	}
+	if json.Unmarshal(resp, &body) != nil || body.Usage == nil {
+		return openai.Usage{}
+	}
+	return body.Usage.usage()
+}
+
+// observeUpstreamUsage records token usage reported in one upstream SSE line of either
+// format: an OpenAI chunk with usage, or Anthropic message_start/message_delta events
+func observeUpstreamUsage(line string, usage *openai.Usage) {
+	data, ok := strings.CutPrefix(line, SSEDataPrefix)
+	if !ok || !strings.Contains(data, `"usage"`) {
+		return
+	}
+	var event struct {
+		Usage   *tokenCounts `json:"usage"`
+		Message *struct {
+			Usage *tokenCounts `json:"usage"`
+		} `json:"message"`
+	}
+	if json.Unmarshal([]byte(data), &event) != nil {
+		return
+	}
+	counts := event.Usage
+	if counts == nil && event.Message != nil {
+		counts = event.Message.Usage
+	}
+	if counts == nil {
+		return
+	}
+	// Anthropic reports input on message_start and cumulative output on message_delta
+	u := counts.usage()
+	if u.PromptTokens > 0 {
+		usage.PromptTokens = u.PromptTokens
+	}
+	if u.CompletionTokens > 0 {
+		usage.CompletionTokens = u.CompletionTokens
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+}
+
+// tokenCounts decodes the usage object of either API format
+type tokenCounts struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	InputTokens      int `json:"input_tokens"`
+	OutputTokens     int `json:"output_tokens"`
+}
+
+func (t tokenCounts) usage() openai.Usage {
+	u := openai.Usage{
+		PromptTokens:     t.PromptTokens + t.InputTokens,
+		CompletionTokens: t.CompletionTokens + t.OutputTokens,
+	}
+	u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	return u
+}
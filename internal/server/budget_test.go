@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/api/openai"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/endpoints"
+	"github.com/macedot/openmodel/internal/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBudget_ExhaustedProviderFallsThrough(t *testing.T) {
+	var served []string
+	newProv := func(name string) *stubProvider {
+		return &stubProvider{
+			name: name,
+			doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+				served = append(served, name)
+				return []byte(`{"id":"c1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}],"usage":{"prompt_tokens":600000,"completion_tokens":100000,"total_tokens":700000}}`), nil
+			},
+		}
+	}
+	cfg := &config.Config{
+		Providers: map[string]config.ProviderConfig{
+			"paid": {
+				Pricing: map[string]config.ModelPrice{"*": {InputPerMillion: 1, OutputPerMillion: 4}},
+				Budget:  &config.BudgetConfig{Daily: 1},
+			},
+		},
+		Models: map[string]config.ModelConfig{
+			"gpt-4": {Strategy: config.StrategyFallback, Providers: []config.ModelProvider{
+				{Provider: "paid", Model: "gpt-4o"},
+				{Provider: "free", Model: "llama3"},
+			}},
+		},
+		Thresholds: config.ThresholdsConfig{FailuresBeforeSwitch: 3, InitialTimeout: 1000, MaxTimeout: 10000},
+	}
+	srv := &Server{config: cfg, providers: providerMap{"paid": newProv("paid"), "free": newProv("free")}, state: state.New()}
+
+	app := fiber.New()
+	app.Post(endpoints.V1ChatCompletions, srv.handleV1ChatCompletions)
+	for range 3 {
+		req := httptest.NewRequest("POST", endpoints.V1ChatCompletions, strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	}
+
+	// Each request costs 0.6 + 0.4 = 1.0, so the first one uses up the daily budget
+	assert.Equal(t, []string{"paid", "free", "free"}, served)
+	report := srv.spendReport()
+	require.Len(t, report, 1)
+	assert.Equal(t, providerSpendReport{Provider: "paid", Daily: 1, Monthly: 1, DailyBudget: 1, Exhausted: true}, report[0])
+	assert.True(t, srv.state.Allow("paid/gpt-4o", srv.breakerPolicy("paid/gpt-4o")), "budget cutoff is not a failure")
+}
+
+func TestSpendTracker_PeriodsRoll(t *testing.T) {
+	var tracker spendTracker
+	day1 := time.Date(2026, 3, 31, 23, 0, 0, 0, time.UTC)
+	tracker.add("paid", 2, day1)
+	tracker.add("paid", 3, day1.Add(30*time.Minute))
+
+	assert.Equal(t, periodSpend{Day: "2026-03-31", Month: "2026-03", Daily: 5, Monthly: 5}, tracker.current("paid", day1))
+	assert.Equal(t, periodSpend{Day: "2026-04-01", Month: "2026-04"}, tracker.current("paid", day1.Add(2*time.Hour)))
+
+	before, after := tracker.add("paid", 1, time.Date(2026, 3, 31, 23, 59, 0, 0, time.UTC))
+	assert.Equal(t, 5.0, before.Daily)
+	assert.Equal(t, 6.0, after.Monthly)
+}
+
+func TestObserveUpstreamUsage(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  openai.Usage
+	}{
+		{
+			name:  "openai usage chunk",
+			lines: []string{`data: {"choices":[{"delta":{"content":"hi"}}]}`, `data: {"choices":[],"usage":{"prompt_tokens":3,"completion_tokens":5,"total_tokens":8}}`, SSEDataDone},
+			want:  openai.Usage{PromptTokens: 3, CompletionTokens: 5, TotalTokens: 8},
+		},
+		{
+			name: "anthropic events",
+			lines: []string{
+				`data: {"type":"message_start","message":{"id":"m1","usage":{"input_tokens":10,"output_tokens":1}}}`,
+				`data: {"type":"content_block_delta","delta":{"type":"text_delta","text":"hi"}}`,
+				`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":7}}`,
+			},
+			want: openai.Usage{PromptTokens: 10, CompletionTokens: 7, TotalTokens: 17},
+		},
+		{name: "no usage", lines: []string{`data: {"choices":[{"delta":{"content":"hi"}}],"usage":null}`, "event: ping"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var usage openai.Usage
+			for _, line := range tt.lines {
+				observeUpstreamUsage(line, &usage)
+			}
+			assert.Equal(t, tt.want, usage)
+		})
+	}
+}
+
+func TestResponseUsage(t *testing.T) {
+	assert.Equal(t, openai.Usage{PromptTokens: 2, CompletionTokens: 3, TotalTokens: 5},
+		responseUsage([]byte(`{"usage":{"prompt_tokens":2,"completion_tokens":3,"total_tokens":5}}`)))
+	assert.Equal(t, openai.Usage{PromptTokens: 4, CompletionTokens: 6, TotalTokens: 10},
+		responseUsage([]byte(`{"type":"message","usage":{"input_tokens":4,"output_tokens":6}}`)))
+	assert.Equal(t, openai.Usage{}, responseUsage([]byte(`{"id":"x"}`)))
+}
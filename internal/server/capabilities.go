@@ -0,0 +1,105 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/provider"
+)
+
+// capabilitiesCtxKey carries the capabilities a request needs in its context
+type capabilitiesCtxKey struct{}
+
+// withRequiredCapabilities records the capabilities backends need to serve the request
+func withRequiredCapabilities(ctx context.Context, required []string) context.Context {
+	if len(required) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, capabilitiesCtxKey{}, required)
+}
+
+// requiredCapabilitiesFromContext returns the capabilities the request needs
+func requiredCapabilitiesFromContext(ctx context.Context) []string {
+	required, _ := ctx.Value(capabilitiesCtxKey{}).([]string)
+	return required
+}
+
+// requestCapabilities detects what a chat request (OpenAI or Anthropic format) needs:
+// tools or functions, image inputs, and JSON response formats
+func requestCapabilities(body []byte) []string {
+	var req struct {
+		Tools          []json.RawMessage `json:"tools"`
+		Functions      []json.RawMessage `json:"functions"`
+		ResponseFormat *struct {
+			Type string `json:"type"`
+		} `json:"response_format"`
+		Messages []struct {
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil
+	}
+
+	var required []string
+	if len(req.Tools) > 0 || len(req.Functions) > 0 {
+		required = append(required, config.CapabilityTools)
+	}
+	if hasImageContent(req.Messages) {
+		required = append(required, config.CapabilityVision)
+	}
+	if req.ResponseFormat != nil && (req.ResponseFormat.Type == "json_object" || req.ResponseFormat.Type == "json_schema") {
+		required = append(required, config.CapabilityJSONMode)
+	}
+	return required
+}
+
+// hasImageContent reports whether any message carries an image content part
+func hasImageContent(messages []struct {
+	Content json.RawMessage `json:"content"`
+}) bool {
+	for _, msg := range messages {
+		var parts []struct {
+			Type string `json:"type"`
+		}
+		if json.Unmarshal(msg.Content, &parts) != nil {
+			continue // Plain string content
+		}
+		for _, part := range parts {
+			switch part.Type {
+			case "image_url", "image", "input_image":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// backendCapabilities returns the capabilities of a backend: those declared for it, else
+// those its provider reports (configured, or its type's defaults). Callers hold providersMu.
+func (s *Server) backendCapabilities(mp config.ModelProvider) []string {
+	if mp.Capabilities != nil {
+		return mp.Capabilities
+	}
+	if prov, ok := s.providers[mp.Provider].(provider.CapabilityProvider); ok {
+		return prov.Capabilities().Names()
+	}
+	return s.config.BackendCapabilities(mp)
+}
+
+// supportsCapabilities reports whether a backend with the declared capabilities can
+// serve a request; backends that declare nothing are assumed to support everything
+func supportsCapabilities(declared, required []string) bool {
+	if declared == nil {
+		return true
+	}
+	for _, name := range required {
+		if !slices.Contains(declared, name) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,127 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/macedot/openmodel/internal/config"
+	applogger "github.com/macedot/openmodel/internal/logger"
+	"github.com/macedot/openmodel/internal/provider"
+)
+
+// chaosInjectors holds the failure injector of each backend with a chaos config, so a
+// seeded sequence of failures carries over from one request to the next
+type chaosInjectors struct {
+	mu    sync.Mutex
+	byKey map[string]*chaosInjector
+}
+
+// chaosInjector decides which requests of a backend fail
+type chaosInjector struct {
+	config config.ChaosConfig
+	mu     sync.Mutex
+	rng    *rand.Rand
+}
+
+// wrap returns prov with failures injected as configured for the backend. A reload that
+// changes the config restarts its sequence.
+func (c *chaosInjectors) wrap(providerKey string, cfg config.ChaosConfig, prov requestProvider) requestProvider {
+	c.mu.Lock()
+	injector, ok := c.byKey[providerKey]
+	if !ok || injector.config != cfg {
+		seed := cfg.Seed
+		if seed == 0 {
+			seed = rand.Uint64()
+		}
+		injector = &chaosInjector{config: cfg, rng: rand.New(rand.NewPCG(seed, seed))}
+		if c.byKey == nil {
+			c.byKey = make(map[string]*chaosInjector)
+		}
+		c.byKey[providerKey] = injector
+	}
+	c.mu.Unlock()
+	return &chaosProvider{requestProvider: prov, providerKey: providerKey, injector: injector}
+}
+
+// roll reports whether an event of the given rate happens
+func (i *chaosInjector) roll(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.rng.Float64() < rate
+}
+
+// before delays a request and decides whether it fails
+func (i *chaosInjector) before(ctx context.Context, providerKey string) error {
+	if i.config.LatencyMs > 0 {
+		timer := time.NewTimer(time.Duration(i.config.LatencyMs) * time.Millisecond)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+	if !i.roll(i.config.ErrorRate) {
+		return nil
+	}
+	status := i.config.GetErrorStatus()
+	applogger.Info("chaos_injected", "provider", providerKey, "failure", "error", "status", status)
+	return &provider.StatusError{StatusCode: status, Err: fmt.Errorf("chaos: injected %d error", status)}
+}
+
+// chaosProvider is a backend's provider with failures injected into its requests
+type chaosProvider struct {
+	requestProvider
+	providerKey string
+	injector    *chaosInjector
+}
+
+// DoRequest forwards a request unless it is chosen to fail
+func (p *chaosProvider) DoRequest(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+	if err := p.injector.before(ctx, p.providerKey); err != nil {
+		return nil, err
+	}
+	return p.requestProvider.DoRequest(ctx, endpoint, body, headers)
+}
+
+// DoStreamRequest forwards a streaming request unless it is chosen to fail, and cuts the
+// stream off after stream_drop_after lines when it is chosen to drop
+func (p *chaosProvider) DoStreamRequest(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+	if err := p.injector.before(ctx, p.providerKey); err != nil {
+		return nil, err
+	}
+	lines, err := p.requestProvider.DoStreamRequest(ctx, endpoint, body, headers)
+	if err != nil || !p.injector.roll(p.injector.config.StreamDropRate) {
+		return lines, err
+	}
+
+	applogger.Info("chaos_injected", "provider", p.providerKey, "failure", "stream_drop", "after_lines", p.injector.config.StreamDropAfter)
+	ch := make(chan []byte)
+	go func() {
+		// Drain the rest so the upstream stream is not left blocked
+		defer func() {
+			for range lines {
+			}
+		}()
+		defer close(ch)
+		for n := 0; n < p.injector.config.StreamDropAfter; n++ {
+			line, ok := <-lines
+			if !ok {
+				return
+			}
+			select {
+			case ch <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
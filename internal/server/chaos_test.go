@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/endpoints"
+	"github.com/macedot/openmodel/internal/provider"
+	"github.com/macedot/openmodel/internal/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChaosInjectors_Seeded(t *testing.T) {
+	prov := &stubProvider{
+		name: "local",
+		doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+			return []byte(`{}`), nil
+		},
+	}
+	cfg := config.ChaosConfig{ErrorRate: 0.5, ErrorStatus: 429, Seed: 42}
+	outcomes := func(injectors *chaosInjectors) []int {
+		var statuses []int
+		for range 20 {
+			_, err := injectors.wrap("local/llama3", cfg, prov).DoRequest(context.Background(), endpoints.V1ChatCompletions, nil, nil)
+			statuses = append(statuses, provider.StatusCodeOf(err))
+		}
+		return statuses
+	}
+
+	first := outcomes(&chaosInjectors{})
+	assert.Equal(t, first, outcomes(&chaosInjectors{}), "the same seed injects the same failures")
+	assert.Contains(t, first, 429)
+	assert.Contains(t, first, 0)
+}
+
+func TestHandleV1ChatCompletions_Chaos(t *testing.T) {
+	tokenChunk := func(text string) string {
+		return `data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4","choices":[{"index":0,"delta":{"content":"` + text + `"},"finish_reason":null}]}`
+	}
+	newProv := func(name string, called *[]string) *stubProvider {
+		return &stubProvider{
+			name: name,
+			doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+				*called = append(*called, name)
+				return []byte(`{"id":"` + name + `","object":"chat.completion","choices":[]}`), nil
+			},
+			doStreamReqFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+				*called = append(*called, name)
+				return streamOf(`data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4","choices":[{"index":0,"delta":{"role":"assistant"},"finish_reason":null}]}`, tokenChunk(name), SSEDataDone), nil
+			},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		chaos       *config.ChaosConfig
+		stream      bool
+		wantCalled  []string
+		wantContent string
+	}{
+		{name: "no chaos", wantCalled: []string{"primary"}, wantContent: `"id":"primary"`},
+		{name: "injected error fails over", chaos: &config.ChaosConfig{ErrorRate: 1}, wantCalled: []string{"backup"}, wantContent: `"id":"backup"`},
+		{name: "dropped stream fails over", chaos: &config.ChaosConfig{StreamDropRate: 1, StreamDropAfter: 1}, stream: true, wantCalled: []string{"primary", "backup"}, wantContent: `"content":"backup"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var called []string
+			cfg := &config.Config{
+				Models: map[string]config.ModelConfig{
+					"gpt-4": {Providers: []config.ModelProvider{{Provider: "primary", Model: "gpt-4", Chaos: tt.chaos}, {Provider: "backup", Model: "gpt-4"}}},
+				},
+				Thresholds: config.ThresholdsConfig{FailuresBeforeSwitch: 1, InitialTimeout: 1000, MaxTimeout: 10000},
+			}
+			srv := &Server{config: cfg, providers: providerMap{"primary": newProv("primary", &called), "backup": newProv("backup", &called)}, state: state.New()}
+
+			app := fiber.New()
+			app.Post(endpoints.V1ChatCompletions, srv.handleV1ChatCompletions)
+			body := `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`
+			if tt.stream {
+				body = `{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"hi"}]}`
+			}
+			req := httptest.NewRequest("POST", endpoints.V1ChatCompletions, strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			out, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+			assert.Equal(t, tt.wantCalled, called)
+			assert.Contains(t, string(out), tt.wantContent)
+			assert.Equal(t, tt.chaos == nil, srv.state.IsAvailable("primary/gpt-4", 1), "injected failures count against the backend")
+		})
+	}
+}
@@ -0,0 +1,55 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"crypto/x509"
+	"net"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/usage"
+)
+
+// lookupClientCert returns the API key and key id of a client authenticated by the
+// certificate it presented to a listener verifying client certificates
+func (s *Server) lookupClientCert(c *fiber.Ctx, cfg *config.Config) (config.APIKey, string, bool) {
+	if len(cfg.ClientCerts) == 0 {
+		return config.APIKey{}, "", false
+	}
+	cert := peerCertificate(c.Context().Conn())
+	if cert == nil {
+		return config.APIKey{}, "", false
+	}
+	cc, ok := cfg.LookupClientCert(certificateNames(cert))
+	if !ok {
+		return config.APIKey{}, "", false
+	}
+	key := cc.APIKey()
+	return key, usage.KeyID(key.Name), true
+}
+
+// peerCertificate returns the client certificate of a connection, nil unless the client
+// presented one that was verified against the listener's client CAs
+func peerCertificate(conn net.Conn) *x509.Certificate {
+	tlsConn, ok := conn.(*tlsListenerConn)
+	if !ok {
+		return nil
+	}
+	state := tlsConn.ConnectionState()
+	if len(state.VerifiedChains) == 0 || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	return state.PeerCertificates[0]
+}
+
+// certificateNames returns the names of a certificate: its common name and subject
+// alternative names
+func certificateNames(cert *x509.Certificate) []string {
+	names := []string{cert.Subject.CommonName}
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	return names
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/endpoints"
+	"github.com/macedot/openmodel/internal/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrackInFlight_MaxConcurrency(t *testing.T) {
+	srv := &Server{
+		config: &config.Config{Providers: map[string]config.ProviderConfig{"local": {MaxConcurrency: 2}}},
+		state:  state.New(),
+	}
+
+	// The limit covers every model of the provider
+	first, err := srv.trackInFlight("local/llama3")
+	require.NoError(t, err)
+	second, err := srv.trackInFlight("local/qwen")
+	require.NoError(t, err)
+	_, err = srv.trackInFlight("local/llama3")
+	assert.ErrorIs(t, err, errProviderSaturated)
+	assert.Equal(t, errorClassSaturated, classifyError(err))
+
+	first()
+	third, err := srv.trackInFlight("local/llama3")
+	require.NoError(t, err)
+	second()
+	third()
+
+	unlimited, err := srv.trackInFlight("hosted/gpt-4o")
+	require.NoError(t, err)
+	unlimited()
+}
+
+func TestHandleV1ChatCompletions_SpillsOverSaturatedProvider(t *testing.T) {
+	started, unblock := make(chan struct{}), make(chan struct{})
+	local := &stubProvider{
+		name: "local",
+		doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+			close(started)
+			<-unblock
+			return []byte(`{"id":"local","object":"chat.completion","choices":[]}`), nil
+		},
+	}
+	hosted := &stubProvider{
+		name: "hosted",
+		doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+			return []byte(`{"id":"hosted","object":"chat.completion","choices":[]}`), nil
+		},
+	}
+	cfg := &config.Config{
+		Providers: map[string]config.ProviderConfig{"local": {MaxConcurrency: 1}, "hosted": {}},
+		Models: map[string]config.ModelConfig{
+			"gpt-4": {Strategy: config.StrategyFallback, Providers: []config.ModelProvider{
+				{Provider: "local", Model: "llama3"},
+				{Provider: "hosted", Model: "gpt-4o"},
+			}},
+		},
+		Thresholds: config.ThresholdsConfig{FailuresBeforeSwitch: 1, InitialTimeout: 1000, MaxTimeout: 10000},
+	}
+	srv := &Server{config: cfg, providers: providerMap{"local": local, "hosted": hosted}, state: state.New()}
+
+	app := fiber.New()
+	app.Post(endpoints.V1ChatCompletions, srv.handleV1ChatCompletions)
+	send := func() string {
+		req := httptest.NewRequest("POST", endpoints.V1ChatCompletions, strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	first := make(chan string)
+	go func() { first <- send() }()
+	<-started
+
+	assert.Contains(t, send(), `"id":"hosted"`, "saturated local provider spills over")
+	close(unblock)
+	assert.Contains(t, <-first, `"id":"local"`)
+	assert.True(t, srv.state.Allow("local/llama3", srv.breakerPolicy("local/llama3")), "saturation is not a failure")
+}
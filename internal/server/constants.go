@@ -9,12 +9,14 @@ import (
 
 // HTTP Server defaults
 const (
-	DefaultReadTimeout    = 30 * time.Second
-	DefaultWriteTimeout   = 120 * time.Second
-	DefaultIdleTimeout    = 120 * time.Second
-	DefaultMaxHeaderBytes = 1 << 20 // 1MB
+	// DefaultShutdownTimeout bounds closing connections once requests in flight are done
+	DefaultShutdownTimeout = 5 * time.Second
 )
 
+// statusClientClosedRequest is the nginx status of a request its client closed before it
+// was answered
+const statusClientClosedRequest = 499
+
 // Request/Response size limits
 const (
 	DefaultMaxRequestBody = 50 * 1024 * 1024 // 50MB
@@ -42,6 +44,30 @@ const (
 	HeaderXRateLimitLimit     = "X-RateLimit-Limit"
 	HeaderXRateLimitRemaining = "X-RateLimit-Remaining"
 	HeaderAnthropicVersion    = "anthropic-version"
+
+	// Rate limits of the client's API key, as OpenAI sends them
+	HeaderXRateLimitLimitRequests     = "X-RateLimit-Limit-Requests"
+	HeaderXRateLimitRemainingRequests = "X-RateLimit-Remaining-Requests"
+	HeaderXRateLimitResetRequests     = "X-RateLimit-Reset-Requests"
+	HeaderXRateLimitLimitTokens       = "X-RateLimit-Limit-Tokens"
+	HeaderXRateLimitRemainingTokens   = "X-RateLimit-Remaining-Tokens"
+	HeaderXRateLimitResetTokens       = "X-RateLimit-Reset-Tokens"
+
+	// Monthly quota of the client's API key
+	HeaderXOpenModelQuotaLimitTokens     = "X-OpenModel-Quota-Limit-Tokens"
+	HeaderXOpenModelQuotaRemainingTokens = "X-OpenModel-Quota-Remaining-Tokens"
+	HeaderXOpenModelQuotaLimitBudget     = "X-OpenModel-Quota-Limit-Budget"
+	HeaderXOpenModelQuotaRemainingBudget = "X-OpenModel-Quota-Remaining-Budget"
+	HeaderXOpenModelQuotaReset           = "X-OpenModel-Quota-Reset"
+
+	HeaderXModerationCategories = "X-Moderation-Categories"
+	HeaderXOpenModelGuardrail   = "X-OpenModel-Guardrail"
+	HeaderXOpenModelCache       = "X-OpenModel-Cache"
+	HeaderXExperiment           = "X-Experiment"
+	HeaderXExperimentArm        = "X-Experiment-Arm"
+	HeaderXOpenModelBackend     = "X-OpenModel-Backend"
+	HeaderXOpenModelAttempts    = "X-OpenModel-Attempts"
+	HeaderXOpenModelLatency     = "X-OpenModel-Latency"
 )
 
 // Anthropic API constants
@@ -51,8 +77,9 @@ const (
 
 // Content types
 const (
-	ContentTypeJSON = "application/json"
-	ContentTypeSSE  = "text/event-stream"
+	ContentTypeJSON   = "application/json"
+	ContentTypeSSE    = "text/event-stream"
+	ContentTypeNDJSON = "application/x-ndjson"
 )
 
 // SSE stream markers
@@ -67,7 +94,13 @@ const (
 // OpenAI endpoints
 const (
 	EndpointV1ChatCompletions = endpoints.V1ChatCompletions
+	EndpointV1Completions     = endpoints.V1Completions
 	EndpointV1Models          = endpoints.V1Models
+	EndpointV1Model           = endpoints.V1Models + "/*" // Wildcard: model IDs may contain "/"
+	EndpointV1Embeddings      = endpoints.V1Embeddings
+	EndpointV1Moderations     = endpoints.V1Moderations
+	EndpointV1AudioTranscript = endpoints.V1AudioTranscriptions
+	EndpointV1AudioSpeech     = endpoints.V1AudioSpeech
 )
 
 // Anthropic endpoints
@@ -75,8 +108,46 @@ const (
 	EndpointV1Messages = endpoints.V1Messages
 )
 
+// WebSocket endpoints
+const (
+	EndpointWSV1Chat = endpoints.WSV1Chat
+)
+
+// Ollama model management endpoints
+const (
+	EndpointAPICreate = endpoints.APICreate
+	EndpointAPICopy   = endpoints.APICopy
+	EndpointAPIDelete = endpoints.APIDelete
+	EndpointAPIPrefix = "/api/" // Every model management endpoint is under this path
+)
+
+// Admin endpoints
+const (
+	EndpointAdminWeights       = endpoints.AdminWeights + "/*" // Wildcard: model name, may contain "/"
+	EndpointAdminSpend         = endpoints.AdminSpend
+	EndpointAdminUsage         = endpoints.AdminUsage
+	EndpointAdminKeys          = endpoints.AdminKeys
+	EndpointAdminKey           = endpoints.AdminKeys + "/:id"        // Key id
+	EndpointAdminKeyRotate     = endpoints.AdminKeys + "/:id/rotate" // Key id
+	EndpointAdminQuotas        = endpoints.AdminQuotas
+	EndpointAdminDrain         = endpoints.AdminDrain
+	EndpointAdminReload        = endpoints.AdminReload
+	EndpointAdminConfig        = endpoints.AdminConfig
+	EndpointAdminBackends      = endpoints.AdminBackends
+	EndpointAdminBackendAction = endpoints.AdminBackends + "/*" // Wildcard: backend ("provider/model") and action
+	EndpointAdminState         = endpoints.AdminState
+	EndpointAdminPprof         = endpoints.AdminPprof + "/*" // Wildcard: profile name, empty for the index
+	EndpointAdminRuntime       = endpoints.AdminRuntime
+	EndpointAdminPrefix        = "/admin/" // Every admin endpoint is under this path
+)
+
 // Internal endpoints
 const (
-	EndpointRoot   = endpoints.Root
-	EndpointHealth = endpoints.Health
+	EndpointRoot    = endpoints.Root
+	EndpointHealth  = endpoints.Health
+	EndpointHealthz = endpoints.Healthz
+	EndpointReadyz  = endpoints.Readyz
+	EndpointOpenAPI = endpoints.OpenAPI
+	EndpointDocs    = endpoints.Docs
+	EndpointMetrics = endpoints.Metrics
 )
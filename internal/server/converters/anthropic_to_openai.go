@@ -48,7 +48,7 @@ func (c *AnthropicToOpenAIConverter) ConvertResponse(body []byte) ([]byte, error
 
 // ConvertStreamLine converts OpenAI SSE stream to Anthropic format
 func (c *AnthropicToOpenAIConverter) ConvertStreamLine(line, model, id string, state *StreamState) string {
-	converted := anthropic.ConvertOpenAIStreamToAnthropic(line, model, id, state.IsFirst, state.BlockIdx)
+	converted := anthropic.ConvertOpenAIStreamToAnthropicWithMetrics(line, model, id, state.IsFirst, state.BlockIdx, state.Metrics)
 	if converted == "" {
 		return "" // Skip events that have no Anthropic equivalent
 	}
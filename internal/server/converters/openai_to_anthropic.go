@@ -48,7 +48,7 @@ func (c *OpenAIToAnthropicConverter) ConvertResponse(body []byte) ([]byte, error
 
 // ConvertStreamLine converts Anthropic SSE stream to OpenAI format
 func (c *OpenAIToAnthropicConverter) ConvertStreamLine(line, model, id string, state *StreamState) string {
-	converted := anthropic.ConvertAnthropicStreamToOpenAI(line, model, id)
+	converted := anthropic.ConvertAnthropicStreamToOpenAIWithMetrics(line, model, id, state.Metrics, state.IncludeUsage)
 	if converted == "" {
 		return "" // Skip events that have no OpenAI equivalent
 	}
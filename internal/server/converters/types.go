@@ -1,7 +1,11 @@
 // Package converters provides API format converters
 package converters
 
-import "sync"
+import (
+	"sync"
+
+	"github.com/macedot/openmodel/internal/api/anthropic"
+)
 
 // APIFormat represents an API format type
 type APIFormat string
@@ -25,6 +29,10 @@ const (
 type StreamState struct {
 	IsFirst  *bool
 	BlockIdx *int
+	// Metrics accumulates finish reason and token usage reported by the provider stream (may be nil)
+	Metrics *anthropic.StreamMetrics
+	// IncludeUsage requests a usage chunk before the end of an OpenAI-format stream
+	IncludeUsage bool
 }
 
 // StreamConverter handles streaming line-by-line conversion
@@ -0,0 +1,138 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/macedot/openmodel/internal/config"
+	applogger "github.com/macedot/openmodel/internal/logger"
+)
+
+// spendChange is spend before and after a request's cost was added
+type spendChange struct {
+	before, after periodSpend
+}
+
+// crossed reports whether the change reached threshold in period
+func (c spendChange) crossed(period string, threshold float64) bool {
+	before, after := c.before.Daily, c.after.Daily
+	if period == config.CostPeriodMonth {
+		before, after = c.before.Monthly, c.after.Monthly
+	}
+	return before < threshold && after >= threshold
+}
+
+// costSpendKey keys the spend of what a cost alert scope adds up by in costSpend
+func costSpendKey(scope, id string) string {
+	return scope + ":" + id
+}
+
+// costAlertEvent is the JSON body posted to a cost alert's webhook
+type costAlertEvent struct {
+	Alert     string  `json:"alert,omitempty"`
+	Scope     string  `json:"scope"`
+	Match     string  `json:"match,omitempty"` // Provider, backend or API key id whose spend crossed the threshold
+	Period    string  `json:"period"`
+	Spend     float64 `json:"spend"`
+	Threshold float64 `json:"threshold"`
+	Time      string  `json:"time"`
+}
+
+// recordCost adds the cost of a request to the running spend of all requests, its backend
+// and its API key, counts it in the metrics and fires the cost alerts whose threshold it
+// crosses. provider is the change of the provider's spend, which recordSpend keeps.
+func (s *Server) recordCost(ctx context.Context, providerKey string, cost float64, now time.Time, provider spendChange) {
+	providerName, _, _ := strings.Cut(providerKey, "/")
+	keyID := usageAttributionFromContext(ctx).keyID
+	s.metrics.observeCost(providerKey, keyID, cost)
+
+	ids := map[string]string{
+		config.CostScopeTotal:    "",
+		config.CostScopeProvider: providerName,
+		config.CostScopeBackend:  providerKey,
+		config.CostScopeKey:      keyID,
+	}
+	changes := map[string]spendChange{config.CostScopeProvider: provider}
+	for _, scope := range []string{config.CostScopeTotal, config.CostScopeBackend, config.CostScopeKey} {
+		before, after := s.costSpend.add(costSpendKey(scope, ids[scope]), cost, now)
+		changes[scope] = spendChange{before, after}
+	}
+
+	for _, alert := range s.GetConfig().CostAlerts {
+		id := ids[alert.Scope]
+		if alert.Match != "" && alert.Match != id {
+			continue
+		}
+		change := changes[alert.Scope]
+		if !change.crossed(alert.GetPeriod(), alert.Threshold) {
+			continue
+		}
+		spend := change.after.Daily
+		if alert.GetPeriod() == config.CostPeriodMonth {
+			spend = change.after.Monthly
+		}
+		s.fireCostAlert(alert, costAlertEvent{
+			Alert:     alert.Name,
+			Scope:     alert.Scope,
+			Match:     id,
+			Period:    alert.GetPeriod(),
+			Spend:     spend,
+			Threshold: alert.Threshold,
+			Time:      now.UTC().Format(time.RFC3339),
+		})
+	}
+}
+
+// fireCostAlert logs a cost alert and posts it to the alert's webhook, if any, in the
+// background
+func (s *Server) fireCostAlert(alert config.CostAlert, event costAlertEvent) {
+	applogger.Warn("cost_alert", "alert", event.Alert, "scope", event.Scope, "match", event.Match,
+		"period", event.Period, "spend", event.Spend, "threshold", event.Threshold)
+	webhook := alert.GetWebhook()
+	if webhook == "" {
+		return
+	}
+	go func() {
+		if err := postWebhook(webhook, event); err != nil {
+			applogger.Warn("cost_alert_webhook_failed", "alert", event.Alert, "error", err)
+		}
+	}()
+}
+
+// backendSpendReport is one backend in the spend listing
+type backendSpendReport struct {
+	Backend string  `json:"backend"`
+	Daily   float64 `json:"daily"`
+	Monthly float64 `json:"monthly"`
+}
+
+// keySpendReport is one API key in the spend listing, "" for requests without a key
+type keySpendReport struct {
+	APIKey  string  `json:"api_key"`
+	Daily   float64 `json:"daily"`
+	Monthly float64 `json:"monthly"`
+}
+
+// costReport lists the running spend of all requests, each backend and each API key id in
+// the current UTC day and month
+func (s *Server) costReport() (total periodSpend, backends []backendSpendReport, keys []keySpendReport) {
+	now := time.Now()
+	backends, keys = []backendSpendReport{}, []keySpendReport{}
+	for key, spend := range s.costSpend.all(now) {
+		scope, id, _ := strings.Cut(key, ":")
+		switch scope {
+		case config.CostScopeTotal:
+			total = spend
+		case config.CostScopeBackend:
+			backends = append(backends, backendSpendReport{Backend: id, Daily: spend.Daily, Monthly: spend.Monthly})
+		case config.CostScopeKey:
+			keys = append(keys, keySpendReport{APIKey: id, Daily: spend.Daily, Monthly: spend.Monthly})
+		}
+	}
+	sort.Slice(backends, func(i, j int) bool { return backends[i].Backend < backends[j].Backend })
+	sort.Slice(keys, func(i, j int) bool { return keys[i].APIKey < keys[j].APIKey })
+	return total, backends, keys
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/state"
+	"github.com/macedot/openmodel/internal/usage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCostAlerts(t *testing.T) {
+	alerts := make(chan costAlertEvent, 10)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event costAlertEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		alerts <- event
+	}))
+	defer webhook.Close()
+
+	prov := &stubProvider{
+		name: "paid",
+		doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+			return []byte(`{"id":"c1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}],"usage":{"prompt_tokens":600000,"completion_tokens":100000,"total_tokens":700000}}`), nil
+		},
+	}
+	cfg := &config.Config{
+		Providers: map[string]config.ProviderConfig{
+			"paid": {Pricing: map[string]config.ModelPrice{"*": {InputPerMillion: 1, OutputPerMillion: 4}}},
+		},
+		Models: map[string]config.ModelConfig{
+			"gpt-4": {Strategy: config.StrategyFallback, Providers: []config.ModelProvider{{Provider: "paid", Model: "gpt-4o"}}},
+		},
+		Thresholds: config.ThresholdsConfig{FailuresBeforeSwitch: 3, InitialTimeout: 1000, MaxTimeout: 10000},
+		Admin:      &config.AdminConfig{Enabled: true, Token: "s3cret"},
+		CostAlerts: []config.CostAlert{
+			{Name: "team-a", Scope: config.CostScopeKey, Match: usage.KeyID("sk-team-a"), Threshold: 2, Webhook: webhook.URL},
+			{Name: "backends", Scope: config.CostScopeBackend, Threshold: 2.5, Period: config.CostPeriodMonth, Webhook: webhook.URL},
+			{Name: "logged only", Scope: config.CostScopeTotal, Threshold: 1},
+		},
+	}
+	srv := &Server{config: cfg, providers: providerMap{"paid": prov}, state: state.New()}
+	srv.metrics = newServerMetrics(srv)
+	app := fiber.New()
+	srv.registerRoutes(app)
+
+	// Each request costs 0.6 + 0.4 = 1.0
+	for _, key := range []string{"sk-team-a", "sk-team-b", "sk-team-a", "sk-team-a"} {
+		req := httptest.NewRequest("POST", EndpointV1ChatCompletions, strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	}
+
+	var fired []costAlertEvent
+	for range 2 {
+		select {
+		case event := <-alerts:
+			fired = append(fired, event)
+		case <-time.After(5 * time.Second):
+			t.Fatal("cost alert webhook not called")
+		}
+	}
+	select {
+	case event := <-alerts:
+		t.Fatalf("unexpected alert %+v: alerts fire once per period", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+	byName := map[string]costAlertEvent{fired[0].Alert: fired[0], fired[1].Alert: fired[1]}
+	assert.Equal(t, usage.KeyID("sk-team-a"), byName["team-a"].Match)
+	assert.Equal(t, 2.0, byName["team-a"].Spend)
+	assert.Equal(t, config.CostPeriodDay, byName["team-a"].Period)
+	assert.Equal(t, "paid/gpt-4o", byName["backends"].Match)
+	assert.Equal(t, 3.0, byName["backends"].Spend)
+
+	req := httptest.NewRequest("GET", EndpointAdminSpend, nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	var report struct {
+		Total    struct{ Daily float64 } `json:"total"`
+		Backends []backendSpendReport    `json:"backends"`
+		Keys     []keySpendReport        `json:"keys"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+	assert.Equal(t, 4.0, report.Total.Daily)
+	require.Len(t, report.Backends, 1)
+	assert.Equal(t, backendSpendReport{Backend: "paid/gpt-4o", Daily: 4, Monthly: 4}, report.Backends[0])
+	require.Len(t, report.Keys, 2)
+	assert.Equal(t, 4.0, report.Keys[0].Daily+report.Keys[1].Daily)
+
+	assert.Equal(t, 3.0, srv.metrics.cost.Value("paid/gpt-4o", usage.KeyID("sk-team-a")))
+}
@@ -0,0 +1,167 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/macedot/openmodel/internal/config"
+	applogger "github.com/macedot/openmodel/internal/logger"
+	"github.com/macedot/openmodel/internal/provider"
+)
+
+// discoveryTimeout bounds listing the models of one provider
+const discoveryTimeout = 30 * time.Second
+
+var errNoModelList = errors.New("provider does not list its models")
+
+// modelDiscovery holds the models found for discover entries. The server's configuration
+// is the loaded one (base) with the discovered models added.
+type modelDiscovery struct {
+	mu      sync.Mutex
+	base    *config.Config
+	results map[string]discoveryResult
+	// wake makes the discovery loop refresh at once after a config reload
+	wake chan struct{}
+}
+
+// discoveryResult is the outcome of listing the models of one discover entry
+type discoveryResult struct {
+	discover    config.DiscoverConfig // Settings the models were discovered with
+	models      []string
+	refreshedAt time.Time
+}
+
+// withDiscovered records cfg as the loaded configuration and returns it with the models
+// discovered so far. Callers hold providersMu.
+func (s *Server) withDiscovered(cfg *config.Config) *config.Config {
+	s.discovery.mu.Lock()
+	defer s.discovery.mu.Unlock()
+	s.discovery.base = cfg
+
+	discovered := make(map[string][]string)
+	for name, result := range s.discovery.results {
+		// Results of entries removed or changed by a reload no longer apply
+		if modelConfig, ok := cfg.Models[name]; ok && modelConfig.Discover != nil &&
+			reflect.DeepEqual(*modelConfig.Discover, result.discover) {
+			discovered[name] = result.models
+		}
+	}
+	return cfg.DiscoveredModels(discovered)
+}
+
+// RunModelDiscovery lists the models of the providers of discover entries in the
+// background until ctx is cancelled, each at its refresh interval. The configuration is
+// re-read each round, so discover entries take effect on reload.
+func (s *Server) RunModelDiscovery(ctx context.Context) {
+	for {
+		wait := s.discoverModels(ctx)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-s.discovery.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// discoverModels refreshes the discover entries that are due and returns how long until
+// the next one is
+func (s *Server) discoverModels(ctx context.Context) time.Duration {
+	s.providersMu.RLock()
+	cfg := s.discovery.base
+	if cfg == nil {
+		cfg = s.config
+	}
+	providers := cloneProviderMap(s.providers)
+	s.providersMu.RUnlock()
+
+	now := time.Now()
+	wait := time.Duration(0)
+	updated := make(map[string]discoveryResult)
+	for name, modelConfig := range cfg.Models {
+		d := modelConfig.Discover
+		if d == nil {
+			continue
+		}
+		s.discovery.mu.Lock()
+		previous, found := s.discovery.results[name]
+		s.discovery.mu.Unlock()
+
+		current := found && reflect.DeepEqual(*d, previous.discover)
+		next := d.GetRefresh()
+		if current {
+			next -= now.Sub(previous.refreshedAt)
+		}
+		if !current || next <= 0 {
+			models, err := listModels(ctx, providers[d.Provider], d)
+			if ctx.Err() != nil {
+				return 0
+			}
+			if err != nil {
+				applogger.Warn("model_discovery_failed", "model", name, "provider", d.Provider, "error", err.Error())
+				// Keep serving the last list; retry after another interval
+				if current {
+					models = previous.models
+				}
+			}
+			updated[name] = discoveryResult{discover: *d, models: models, refreshedAt: now}
+			next = d.GetRefresh()
+		}
+		if wait == 0 || next < wait {
+			wait = next
+		}
+	}
+
+	if len(updated) > 0 {
+		s.providersMu.Lock()
+		s.discovery.mu.Lock()
+		if s.discovery.results == nil {
+			s.discovery.results = make(map[string]discoveryResult)
+		}
+		for name, result := range updated {
+			s.discovery.results[name] = result
+		}
+		s.discovery.mu.Unlock()
+		// A reload during the listing already replaced the configuration
+		if base := s.discovery.base; base == nil || base == cfg {
+			s.config = s.withDiscovered(cfg)
+		}
+		s.providersMu.Unlock()
+	}
+
+	if wait == 0 {
+		// No discover entries: look again after the default interval in case a reload adds one
+		wait = (*config.DiscoverConfig)(nil).GetRefresh()
+	}
+	return wait
+}
+
+// listModels returns the models a provider lists that pass the entry's globs
+func listModels(ctx context.Context, prov requestProvider, d *config.DiscoverConfig) ([]string, error) {
+	lister, ok := prov.(provider.ModelLister)
+	if !ok {
+		return nil, errNoModelList
+	}
+	listCtx, cancel := context.WithTimeout(ctx, discoveryTimeout)
+	defer cancel()
+
+	list, err := lister.ListModels(listCtx)
+	if err != nil {
+		return nil, err
+	}
+	var models []string
+	for _, m := range list.Data {
+		if m.ID != "" && d.Matches(m.ID) {
+			models = append(models, m.ID)
+		}
+	}
+	return models, nil
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/api/openai"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listingProvider is a stub provider whose model list can be changed between rounds
+type listingProvider struct {
+	stubProvider
+	models []string
+	err    error
+}
+
+func (p *listingProvider) ListModels(ctx context.Context) (*openai.ModelList, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	list := &openai.ModelList{Object: "list"}
+	for _, id := range p.models {
+		list.Data = append(list.Data, openai.Model{ID: id})
+	}
+	return list, nil
+}
+
+func TestModelDiscovery(t *testing.T) {
+	cfg := &config.Config{
+		Providers: map[string]config.ProviderConfig{"ollama": {URL: "http://ollama"}},
+		Models: map[string]config.ModelConfig{
+			"chat":    {Providers: []config.ModelProvider{{Provider: "ollama", Model: "llama3"}}},
+			"local/*": {Discover: &config.DiscoverConfig{Provider: "ollama", Exclude: []string{"*-embed"}}},
+		},
+		ModelOrder: []string{"chat", "local/*"},
+	}
+	ollama := &listingProvider{stubProvider: stubProvider{name: "ollama"}, models: []string{"llama3", "nomic-embed"}}
+	srv := New(cfg, nil, state.New(), "test")
+	srv.providers = providerMap{"ollama": ollama}
+
+	listModelIDs := func() []string {
+		app := fiber.New()
+		app.Get("/v1/models", srv.handleV1Models)
+		resp, err := app.Test(httptest.NewRequest("GET", "/v1/models", nil))
+		require.NoError(t, err)
+		var list openai.ModelList
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+		var ids []string
+		for _, m := range list.Data {
+			ids = append(ids, m.ID)
+		}
+		return ids
+	}
+
+	assert.Equal(t, []string{"chat"}, listModelIDs())
+	assert.Equal(t, cfg.Models["local/*"].Discover.GetRefresh(), srv.discoverModels(context.Background()))
+	assert.Equal(t, []string{"chat", "local/llama3"}, listModelIDs())
+	resolved, err := srv.resolveModel(context.Background(), "local/llama3")
+	require.NoError(t, err)
+	assert.Equal(t, []config.ModelProvider{{Provider: "ollama", Model: "llama3"}}, srv.GetConfig().Models[resolved].Providers)
+
+	// Not due yet: a new model shows up on the next refresh
+	ollama.models = append(ollama.models, "qwen2")
+	srv.discoverModels(context.Background())
+	assert.Equal(t, []string{"chat", "local/llama3"}, listModelIDs())
+	srv.discovery.results["local/*"] = discoveryResult{discover: *cfg.Models["local/*"].Discover, models: []string{"llama3"}}
+	srv.discoverModels(context.Background())
+	assert.Equal(t, []string{"chat", "local/llama3", "local/qwen2"}, listModelIDs())
+
+	// A failed refresh keeps serving the last list
+	ollama.err = errors.New("connection refused")
+	srv.discovery.results["local/*"] = discoveryResult{discover: *cfg.Models["local/*"].Discover, models: []string{"llama3", "qwen2"}}
+	srv.discoverModels(context.Background())
+	assert.Equal(t, []string{"chat", "local/llama3", "local/qwen2"}, listModelIDs())
+
+	// A reload that changes the entry drops its models until they are rediscovered
+	reloaded := *cfg
+	reloaded.Models = map[string]config.ModelConfig{
+		"chat":    cfg.Models["chat"],
+		"local/*": {Discover: &config.DiscoverConfig{Provider: "ollama", Include: []string{"qwen*"}}},
+	}
+	srv.providersMu.Lock()
+	srv.config = srv.withDiscovered(&reloaded)
+	srv.providersMu.Unlock()
+	assert.Equal(t, []string{"chat"}, listModelIDs())
+	ollama.err = nil
+	srv.discoverModels(context.Background())
+	assert.Equal(t, []string{"chat", "local/qwen2"}, listModelIDs())
+}
@@ -0,0 +1,225 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	applogger "github.com/macedot/openmodel/internal/logger"
+)
+
+// errDrainDeadline cancels the requests still in flight when a drain times out
+var errDrainDeadline = errors.New("server drain deadline reached")
+
+// drainer tracks the requests in flight. While it drains, new requests are turned away
+// and those in flight may finish until the deadline, when they are cancelled.
+type drainer struct {
+	mu       sync.Mutex
+	draining bool
+	stopping bool // Draining for shutdown, which cannot be undone
+	deadline time.Time
+	timer    *time.Timer
+	idle     chan struct{} // Closed once no request is in flight during a drain
+	inFlight map[*inFlightRequest]struct{}
+}
+
+// drainStatus is the response of the drain admin endpoints
+type drainStatus struct {
+	Draining bool       `json:"draining"`
+	Deadline *time.Time `json:"deadline,omitempty"`
+	InFlight int        `json:"in_flight"`
+}
+
+// inFlightRequest is a request counted by the drainer. Like an admission ticket it ends
+// once every holder is done, so a streaming response stays in flight after its handler
+// returns.
+type inFlightRequest struct {
+	refs     atomic.Int32
+	cancel   context.CancelCauseFunc
+	d        *drainer
+	finished chan struct{} // Closed once the request is done
+}
+
+type inFlightRequestKey struct{}
+
+// inFlightFromContext returns the request's in-flight entry, nil if it is not tracked
+func inFlightFromContext(ctx context.Context) *inFlightRequest {
+	r, _ := ctx.Value(inFlightRequestKey{}).(*inFlightRequest)
+	return r
+}
+
+// begin counts a new request in flight, returning a context cancelled if a drain times out
+// before the request is done. It fails while draining.
+func (d *drainer) begin(ctx context.Context) (context.Context, *inFlightRequest, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.draining {
+		return ctx, nil, false
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	r := &inFlightRequest{cancel: cancel, d: d, finished: make(chan struct{})}
+	r.refs.Store(1)
+	if d.inFlight == nil {
+		d.inFlight = make(map[*inFlightRequest]struct{})
+	}
+	d.inFlight[r] = struct{}{}
+	return context.WithValue(ctx, inFlightRequestKey{}, r), r, true
+}
+
+// done drops the handler's hold on the request
+func (r *inFlightRequest) done() {
+	if r == nil || r.refs.Add(-1) != 0 {
+		return
+	}
+	r.cancel(context.Canceled)
+	d := r.d
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.inFlight, r)
+	close(r.finished)
+	if d.draining && len(d.inFlight) == 0 && d.idle != nil {
+		close(d.idle)
+		d.idle = nil
+	}
+}
+
+// hold keeps the request in flight until the returned func is called
+func (r *inFlightRequest) hold() func() {
+	if r == nil {
+		return func() {}
+	}
+	r.refs.Add(1)
+	return r.done
+}
+
+// settled returns a channel closed once the requests now in flight are done, nil if none
+// is. Requests that begin later are not waited for.
+func (d *drainer) settled() <-chan struct{} {
+	d.mu.Lock()
+	pending := make([]*inFlightRequest, 0, len(d.inFlight))
+	for r := range d.inFlight {
+		pending = append(pending, r)
+	}
+	d.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	settled := make(chan struct{})
+	go func() {
+		defer close(settled)
+		for _, r := range pending {
+			<-r.finished
+		}
+	}()
+	return settled
+}
+
+// start begins draining with the given timeout; an ongoing drain keeps its deadline unless
+// this one is earlier. A drain for shutdown cannot be resumed. It returns the deadline and
+// a channel closed once no request is in flight.
+func (d *drainer) start(timeout time.Duration, stopping bool) (time.Time, <-chan struct{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	deadline := time.Now().Add(timeout)
+	if !d.draining || deadline.Before(d.deadline) {
+		if d.timer != nil {
+			d.timer.Stop()
+		}
+		d.deadline = deadline
+		d.timer = time.AfterFunc(timeout, d.cutOff)
+	}
+	if !d.draining {
+		d.draining = true
+		d.idle = make(chan struct{})
+		if len(d.inFlight) == 0 {
+			close(d.idle)
+		}
+	}
+	d.stopping = d.stopping || stopping
+
+	idle := d.idle
+	if idle == nil {
+		closed := make(chan struct{})
+		close(closed)
+		idle = closed
+	}
+	return d.deadline, idle
+}
+
+// resume ends a drain, accepting requests again. It fails once the server is shutting down.
+func (d *drainer) resume() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopping {
+		return false
+	}
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	d.draining = false
+	d.idle = nil
+	return true
+}
+
+// cutOff cancels the requests still in flight at the drain deadline
+func (d *drainer) cutOff() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.draining {
+		return
+	}
+	if len(d.inFlight) > 0 {
+		applogger.Warn("drain_deadline_reached", "in_flight", len(d.inFlight))
+	}
+	for r := range d.inFlight {
+		r.cancel(errDrainDeadline)
+	}
+}
+
+// status reports whether the server is draining and how many requests are in flight
+func (d *drainer) status() drainStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	status := drainStatus{Draining: d.draining, InFlight: len(d.inFlight)}
+	if d.draining {
+		deadline := d.deadline
+		status.Deadline = &deadline
+	}
+	return status
+}
+
+// retryAfter returns the Retry-After seconds for requests turned away: the time left
+// until the drain deadline, at least one second
+func (d *drainer) retryAfter() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return max(1, int(math.Ceil(time.Until(d.deadline).Seconds())))
+}
+
+// drainMiddleware counts requests in flight and turns new ones away with 503 while the
+// server drains. Admin endpoints stay reachable so a drain can be inspected and resumed,
+// and so do /metrics and the probes, which are not counted; /readyz reports the drain.
+func (s *Server) drainMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if strings.HasPrefix(c.Path(), EndpointAdminPrefix) || c.Path() == EndpointMetrics || isProbe(c.Path()) {
+			return c.Next()
+		}
+		ctx, r, ok := s.drain.begin(c.UserContext())
+		if !ok {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(s.drain.retryAfter()))
+			return handleError(c, "server is draining", fiber.StatusServiceUnavailable)
+		}
+		defer r.done()
+		c.SetUserContext(ctx)
+		return c.Next()
+	}
+}
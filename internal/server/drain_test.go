@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrainer_StreamsFinishUntilDeadline(t *testing.T) {
+	var d drainer
+
+	ctx, handler, ok := d.begin(context.Background())
+	require.True(t, ok)
+	releaseStream := inFlightFromContext(ctx).hold()
+	handler.done()
+	assert.Equal(t, 1, d.status().InFlight, "the stream outlives its handler")
+
+	_, idle := d.start(time.Hour, false)
+	_, _, ok = d.begin(context.Background())
+	assert.False(t, ok, "new requests are turned away while draining")
+
+	select {
+	case <-idle:
+		t.Fatal("drained while a stream was in flight")
+	default:
+	}
+	releaseStream()
+	<-idle
+	assert.Equal(t, 0, d.status().InFlight)
+
+	assert.True(t, d.resume())
+	_, r, ok := d.begin(context.Background())
+	assert.True(t, ok, "requests are accepted again after resuming")
+	r.done()
+}
+
+func TestDrainer_DeadlineCancelsRequestsInFlight(t *testing.T) {
+	var d drainer
+	ctx, r, ok := d.begin(context.Background())
+	require.True(t, ok)
+	defer r.done()
+
+	d.start(20*time.Millisecond, true)
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("request not cancelled at the drain deadline")
+	}
+	assert.Equal(t, errDrainDeadline, context.Cause(ctx))
+	assert.False(t, d.resume(), "a shutdown drain cannot be resumed")
+}
+
+func TestAdminDrain(t *testing.T) {
+	srv, _ := newAdminTestServer(&config.AdminConfig{Enabled: true, Token: "s3cret"})
+	app := fiber.New()
+	app.Use(srv.drainMiddleware())
+	srv.registerRoutes(app)
+
+	send := func(method, path, token, body string) (int, string, drainStatus) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		var status drainStatus
+		if strings.HasPrefix(path, EndpointAdminPrefix) && resp.StatusCode == fiber.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+		}
+		return resp.StatusCode, resp.Header.Get(fiber.HeaderRetryAfter), status
+	}
+
+	code, _, _ := send("POST", EndpointAdminDrain, "", "")
+	assert.Equal(t, fiber.StatusUnauthorized, code)
+	code, _, _ = send("POST", EndpointAdminDrain, "s3cret", `{"timeout_ms": -1}`)
+	assert.Equal(t, fiber.StatusBadRequest, code)
+
+	code, _, status := send("POST", EndpointAdminDrain, "s3cret", `{"timeout_ms": 90000}`)
+	require.Equal(t, fiber.StatusOK, code)
+	assert.True(t, status.Draining)
+	require.NotNil(t, status.Deadline)
+	assert.WithinDuration(t, time.Now().Add(90*time.Second), *status.Deadline, 5*time.Second)
+
+	code, retryAfter, _ := send("GET", EndpointHealth, "", "")
+	assert.Equal(t, fiber.StatusServiceUnavailable, code)
+	assert.Equal(t, "90", retryAfter)
+
+	code, _, status = send("GET", EndpointAdminDrain, "s3cret", "")
+	assert.Equal(t, fiber.StatusOK, code, "admin endpoints stay reachable while draining")
+	assert.True(t, status.Draining)
+
+	code, _, status = send("DELETE", EndpointAdminDrain, "s3cret", "")
+	assert.Equal(t, fiber.StatusOK, code)
+	assert.False(t, status.Draining)
+	code, _, _ = send("GET", EndpointHealth, "", "")
+	assert.Equal(t, fiber.StatusOK, code)
+}
@@ -0,0 +1,265 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/macedot/openmodel/internal/api/openai"
+)
+
+// cacheEmbeddings names the embedding cache in the cache metrics
+const cacheEmbeddings = "embeddings"
+
+// embeddingCache keeps embeddings as JSON float arrays by cache key, evicting the least
+// recently used beyond its limit
+type embeddingCache struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   list.List // Of *embeddingCacheEntry, most recently used first
+}
+
+// embeddingCacheEntry is a cached embedding
+type embeddingCacheEntry struct {
+	key       string
+	embedding json.RawMessage
+	expires   time.Time
+}
+
+// get returns the unexpired embedding cached under key
+func (c *embeddingCache) get(key string, now time.Time) (json.RawMessage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*embeddingCacheEntry)
+	if now.After(entry.expires) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return entry.embedding, true
+}
+
+// put caches an embedding under key, evicting the least recently used beyond maxEntries
+func (c *embeddingCache) put(key string, embedding json.RawMessage, expires time.Time, maxEntries int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]*list.Element)
+	}
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*embeddingCacheEntry)
+		entry.embedding, entry.expires = embedding, expires
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&embeddingCacheEntry{key: key, embedding: embedding, expires: expires})
+	for c.order.Len() > maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*embeddingCacheEntry).key)
+	}
+}
+
+// embeddingCacheKey identifies the embedding of an input by a configured model with the
+// given parameters
+func embeddingCacheKey(model, params string, input json.RawMessage) string {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, input); err != nil {
+		compact.Reset()
+		compact.Write(input)
+	}
+	sum := sha256.Sum256([]byte(params + "\x00" + compact.String()))
+	return model + "\x00" + hex.EncodeToString(sum[:])
+}
+
+// embeddingParams returns the parameters of an embeddings request that change its
+// embeddings, such as dimensions, encoded alike for equal parameters
+func embeddingParams(req map[string]json.RawMessage) string {
+	params := make(map[string]json.RawMessage, len(req))
+	for k, v := range req {
+		switch k {
+		case "model", "input", "encoding_format", "user":
+		default:
+			params[k] = v
+		}
+	}
+	// Maps marshal with sorted keys and raw values compacted
+	encoded, _ := json.Marshal(params)
+	return string(encoded)
+}
+
+// splitEmbeddingInput returns the inputs of an embeddings request: the items of an array
+// of strings or token arrays, or else the input itself
+func splitEmbeddingInput(input json.RawMessage) ([]json.RawMessage, bool) {
+	input = bytes.TrimSpace(input)
+	if len(input) == 0 {
+		return nil, false
+	}
+	if input[0] != '[' {
+		return []json.RawMessage{input}, true
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(input, &items); err != nil || len(items) == 0 {
+		return nil, false
+	}
+	// An array of numbers is a single tokenized input
+	if first := bytes.TrimSpace(items[0]); len(first) > 0 && first[0] != '"' && first[0] != '[' {
+		return []json.RawMessage{input}, true
+	}
+	return items, true
+}
+
+// embeddingBatch is an embeddings request split into its inputs: those answered by the
+// embedding cache, and the distinct others, each sent to a backend once
+type embeddingBatch struct {
+	req      map[string]json.RawMessage
+	keys     []string                   // Cache key of each input, in request order
+	inputs   map[string]json.RawMessage // Input of each key
+	embedded map[string]json.RawMessage // Embedding of each key, cached or from the backend
+	pending  []string                   // Keys of the distinct inputs not cached, in request order
+	hits     int                        // Distinct inputs answered by the cache
+}
+
+// newEmbeddingBatch splits an embeddings request to a configured model, looking its
+// inputs up in the embedding cache when it is enabled. It returns false for inputs it
+// cannot split, which are sent to a backend as they are.
+func (s *Server) newEmbeddingBatch(model string, body []byte) (*embeddingBatch, bool) {
+	var req map[string]json.RawMessage
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, false
+	}
+	items, ok := splitEmbeddingInput(req["input"])
+	if !ok {
+		return nil, false
+	}
+	cacheEnabled := s.GetConfig().EmbeddingCache != nil
+	params := embeddingParams(req)
+	now := time.Now()
+	b := &embeddingBatch{
+		req:      req,
+		inputs:   make(map[string]json.RawMessage, len(items)),
+		embedded: make(map[string]json.RawMessage, len(items)),
+	}
+	for _, item := range items {
+		key := embeddingCacheKey(model, params, item)
+		b.keys = append(b.keys, key)
+		if _, seen := b.inputs[key]; seen {
+			continue
+		}
+		b.inputs[key] = item
+		if cacheEnabled {
+			embedding, hit := s.embeddingCache.get(key, now)
+			s.metrics.observeCacheLookup(cacheEmbeddings, model, hit)
+			if hit {
+				b.embedded[key] = embedding
+				b.hits++
+				continue
+			}
+		}
+		b.pending = append(b.pending, key)
+	}
+	return b, true
+}
+
+// reduced reports whether fewer inputs are sent to a backend than the request has
+func (b *embeddingBatch) reduced() bool {
+	return len(b.pending) < len(b.keys)
+}
+
+// cacheResult describes how the embedding cache answered the request: "hit" for all of
+// its inputs, "partial" for some, "miss" for none
+func (b *embeddingBatch) cacheResult() string {
+	switch {
+	case len(b.pending) == 0:
+		return "hit"
+	case b.hits > 0:
+		return "partial"
+	}
+	return "miss"
+}
+
+// forwardBody returns the request for the pending inputs, the original body when all of
+// them are pending
+func (b *embeddingBatch) forwardBody(body []byte) []byte {
+	if !b.reduced() {
+		return body
+	}
+	inputs := make([]json.RawMessage, len(b.pending))
+	for i, key := range b.pending {
+		inputs[i] = b.inputs[key]
+	}
+	req := make(map[string]json.RawMessage, len(b.req))
+	for k, v := range b.req {
+		req[k] = v
+	}
+	req["input"], _ = json.Marshal(inputs)
+	out, _ := json.Marshal(req)
+	return out
+}
+
+// complete takes the embeddings of the pending inputs from a backend response, and
+// returns a response with the embedding of every input of the request, in float encoding.
+// Without pending inputs resp is nil, and the response reports no usage.
+func (b *embeddingBatch) complete(resp []byte, model string) ([]byte, error) {
+	out := map[string]json.RawMessage{
+		"object": json.RawMessage(`"list"`),
+		"usage":  json.RawMessage(`{"prompt_tokens":0,"total_tokens":0}`),
+	}
+	out["model"], _ = json.Marshal(model)
+	if len(b.pending) > 0 {
+		floats, err := openai.ConvertEmbeddingEncoding(resp, openai.EncodingFormatFloat)
+		if err != nil {
+			return nil, err
+		}
+		var data []struct {
+			Index     int             `json:"index"`
+			Embedding json.RawMessage `json:"embedding"`
+		}
+		if err := json.Unmarshal(floats, &out); err != nil {
+			return nil, fmt.Errorf("failed to parse embedding response: %w", err)
+		}
+		if err := json.Unmarshal(out["data"], &data); err != nil {
+			return nil, fmt.Errorf("failed to parse embedding response data: %w", err)
+		}
+		if len(data) != len(b.pending) {
+			return nil, fmt.Errorf("backend returned %d embeddings for %d inputs", len(data), len(b.pending))
+		}
+		sort.SliceStable(data, func(i, j int) bool { return data[i].Index < data[j].Index })
+		for i, d := range data {
+			b.embedded[b.pending[i]] = d.Embedding
+		}
+	}
+
+	data := make([]map[string]any, len(b.keys))
+	for i, key := range b.keys {
+		data[i] = map[string]any{"object": "embedding", "index": i, "embedding": b.embedded[key]}
+	}
+	out["data"], _ = json.Marshal(data)
+	return json.Marshal(out)
+}
+
+// storeEmbeddings caches the embeddings a backend returned for a batch
+func (s *Server) storeEmbeddings(b *embeddingBatch) {
+	ec := s.GetConfig().EmbeddingCache
+	if ec == nil {
+		return
+	}
+	expires := time.Now().Add(ec.GetTTL())
+	for _, key := range b.pending {
+		if embedding, ok := b.embedded[key]; ok {
+			s.embeddingCache.put(key, embedding, expires, ec.GetMaxEntries())
+		}
+	}
+}
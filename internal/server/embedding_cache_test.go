@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddingCache(t *testing.T) {
+	var cache embeddingCache
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	cache.put("a", json.RawMessage(`[1]`), now.Add(time.Minute), 2)
+	cache.put("b", json.RawMessage(`[2]`), now.Add(time.Hour), 2)
+
+	embedding, ok := cache.get("a", now)
+	require.True(t, ok)
+	assert.JSONEq(t, `[1]`, string(embedding))
+
+	// The least recently used entry is evicted: b, as a was just read
+	cache.put("c", json.RawMessage(`[3]`), now.Add(time.Hour), 2)
+	_, ok = cache.get("b", now)
+	assert.False(t, ok)
+	_, ok = cache.get("c", now)
+	assert.True(t, ok)
+
+	// Expired entries are dropped when read
+	_, ok = cache.get("a", now.Add(2*time.Minute))
+	assert.False(t, ok)
+	assert.Equal(t, 1, cache.order.Len())
+}
+
+func TestSplitEmbeddingInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"string", `"hello"`, []string{`"hello"`}},
+		{"strings", `["a", "b", "a"]`, []string{`"a"`, `"b"`, `"a"`}},
+		{"tokens", `[1, 2, 3]`, []string{`[1, 2, 3]`}},
+		{"token arrays", `[[1, 2], [3]]`, []string{`[1, 2]`, `[3]`}},
+		{"empty array", `[]`, nil},
+		{"missing", ``, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, ok := splitEmbeddingInput(json.RawMessage(tt.input))
+			assert.Equal(t, tt.want != nil, ok)
+			var got []string
+			for _, item := range items {
+				got = append(got, string(item))
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHandleV1Embeddings_DeduplicatesAndCaches(t *testing.T) {
+	var sent [][]string
+	prov := &stubProvider{
+		name: "local",
+		doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+			var req struct {
+				Input []string `json:"input"`
+			}
+			require.NoError(t, json.Unmarshal(body, &req))
+			sent = append(sent, req.Input)
+			// Each input embeds to its length, answered out of order
+			var data []string
+			for i := len(req.Input) - 1; i >= 0; i-- {
+				data = append(data, `{"object":"embedding","index":`+strconv.Itoa(i)+`,"embedding":[`+strconv.Itoa(len(req.Input[i]))+`]}`)
+			}
+			return []byte(`{"object":"list","data":[` + strings.Join(data, ",") + `],"model":"nomic-embed-text","usage":{"prompt_tokens":5,"total_tokens":5}}`), nil
+		},
+	}
+	cfg := &config.Config{
+		Models:     map[string]config.ModelConfig{"embed": {Providers: []config.ModelProvider{{Provider: "local", Model: "nomic-embed-text"}}}},
+		Thresholds: config.ThresholdsConfig{FailuresBeforeSwitch: 1},
+	}
+	srv := &Server{config: cfg, providers: providerMap{"local": prov}, state: state.New()}
+	app := fiber.New()
+	app.Post(EndpointV1Embeddings, srv.handleV1Embeddings)
+	send := func(body string) (string, []any) {
+		req := httptest.NewRequest("POST", EndpointV1Embeddings, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+		var out struct {
+			Data []struct {
+				Index     int `json:"index"`
+				Embedding any `json:"embedding"`
+			} `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&out))
+		embeddings := make([]any, len(out.Data))
+		for _, d := range out.Data {
+			embeddings[d.Index] = d.Embedding
+		}
+		return resp.Header.Get(HeaderXOpenModelCache), embeddings
+	}
+
+	// Identical inputs are sent once and expanded back in request order
+	result, embeddings := send(`{"model":"embed","input":["a","bb","a","ccc","bb"]}`)
+	assert.Empty(t, result)
+	assert.Equal(t, [][]string{{"a", "bb", "ccc"}}, sent)
+	assert.Equal(t, []any{[]any{1.0}, []any{2.0}, []any{1.0}, []any{3.0}, []any{2.0}}, embeddings)
+
+	// Without the cache, nothing is kept between requests
+	sent = nil
+	send(`{"model":"embed","input":["a","bb"]}`)
+	assert.Equal(t, [][]string{{"a", "bb"}}, sent)
+
+	// With it, only the inputs never embedded reach the backend
+	cfg.EmbeddingCache = &config.EmbeddingCacheConfig{}
+	sent = nil
+	result, _ = send(`{"model":"embed","input":["a","bb"]}`)
+	assert.Equal(t, "miss", result)
+	result, embeddings = send(`{"model":"embed","input":["dddd","a","bb"]}`)
+	assert.Equal(t, "partial", result)
+	assert.Equal(t, []any{[]any{4.0}, []any{1.0}, []any{2.0}}, embeddings)
+	result, embeddings = send(`{"model":"embed","input":["bb","dddd"],"encoding_format":"base64"}`)
+	assert.Equal(t, "hit", result)
+	assert.Equal(t, []any{"AAAAQA==", "AACAQA=="}, embeddings)
+	assert.Equal(t, [][]string{{"a", "bb"}, {"dddd"}}, sent)
+
+	// Other parameters are embedded apart
+	sent = nil
+	result, _ = send(`{"model":"embed","input":["a"],"dimensions":256}`)
+	assert.Equal(t, "miss", result)
+	assert.Equal(t, [][]string{{"a"}}, sent)
+}
@@ -0,0 +1,39 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+)
+
+// endpointGroup returns the group of the endpoint at path, or "" for those always served
+func endpointGroup(path string) string {
+	switch {
+	case strings.HasPrefix(path, EndpointAdminPrefix):
+		return config.EndpointsAdmin
+	case strings.HasPrefix(path, EndpointAPIPrefix):
+		return config.EndpointsOllama
+	case path == EndpointV1Messages:
+		return config.EndpointsAnthropic
+	case strings.HasPrefix(path, "/v1/"), path == EndpointWSV1Chat:
+		return config.EndpointsOpenAI
+	case path == EndpointOpenAPI, path == EndpointDocs:
+		return config.EndpointsDocs
+	default:
+		return ""
+	}
+}
+
+// endpointGroupsMiddleware answers 404 to requests for endpoint groups the config
+// disables. It reads the current config, so a reload applies at once.
+func (s *Server) endpointGroupsMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		group := endpointGroup(c.Path())
+		if group != "" && !s.GetConfig().Server.EndpointsEnabled(group) {
+			return handleError(c, "not found", fiber.StatusNotFound)
+		}
+		return c.Next()
+	}
+}
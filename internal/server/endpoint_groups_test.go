@@ -0,0 +1,42 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEndpointGroupsMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		disabled []string
+		path     string
+		want     int
+	}{
+		{name: "nothing disabled", path: EndpointV1ChatCompletions, want: fiber.StatusOK},
+		{name: "openai disabled", disabled: []string{config.EndpointsOpenAI}, path: EndpointV1ChatCompletions, want: fiber.StatusNotFound},
+		{name: "openai websocket disabled", disabled: []string{config.EndpointsOpenAI}, path: EndpointWSV1Chat, want: fiber.StatusNotFound},
+		{name: "openai disabled keeps anthropic", disabled: []string{config.EndpointsOpenAI}, path: EndpointV1Messages, want: fiber.StatusOK},
+		{name: "anthropic disabled", disabled: []string{config.EndpointsAnthropic}, path: EndpointV1Messages, want: fiber.StatusNotFound},
+		{name: "ollama disabled", disabled: []string{config.EndpointsOllama}, path: EndpointAPIDelete, want: fiber.StatusNotFound},
+		{name: "admin disabled", disabled: []string{config.EndpointsAdmin}, path: EndpointAdminConfig, want: fiber.StatusNotFound},
+		{name: "docs disabled", disabled: []string{config.EndpointsDocs}, path: EndpointOpenAPI, want: fiber.StatusNotFound},
+		{name: "health always served", disabled: []string{config.EndpointsOpenAI, config.EndpointsAnthropic, config.EndpointsOllama, config.EndpointsAdmin, config.EndpointsDocs}, path: EndpointHealth, want: fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &Server{config: &config.Config{Server: config.ServerConfig{DisabledEndpoints: tt.disabled}}}
+			app := fiber.New()
+			app.Use(srv.endpointGroupsMiddleware())
+			app.Use(func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+			resp, err := app.Test(httptest.NewRequest("GET", tt.path, nil))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, resp.StatusCode)
+		})
+	}
+}
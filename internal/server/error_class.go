@@ -0,0 +1,129 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/api/openai"
+	"github.com/macedot/openmodel/internal/provider"
+)
+
+// errorClass groups provider errors that call for the same failure policy
+type errorClass int
+
+const (
+	errorClassOther       errorClass = iota // Anything unrecognised
+	errorClassAuth                          // 401/403: bad or missing credentials
+	errorClassNotFound                      // 404 for a model the backend does not have
+	errorClassUnsupported                   // Other 404: the backend does not serve the endpoint
+	errorClassClient                        // 400/413/415/422: the request itself is at fault
+	errorClassRateLimit                     // 429: rate limited
+	errorClassTimeout                       // Deadline exceeded or network timeout
+	errorClassServer                        // 5xx or connection failure
+	errorClassSaturated                     // Provider at its max_concurrency; not a failure
+	errorClassCanceled                      // Client went away mid-attempt; not a failure
+)
+
+// String returns the name used in logs
+func (c errorClass) String() string {
+	switch c {
+	case errorClassAuth:
+		return "auth"
+	case errorClassNotFound:
+		return "not_found"
+	case errorClassUnsupported:
+		return "unsupported"
+	case errorClassClient:
+		return "client_error"
+	case errorClassRateLimit:
+		return "rate_limit"
+	case errorClassTimeout:
+		return "timeout"
+	case errorClassServer:
+		return "server_error"
+	case errorClassSaturated:
+		return "saturated"
+	case errorClassCanceled:
+		return "canceled"
+	default:
+		return "other"
+	}
+}
+
+// classifyError determines the class of a provider error
+func classifyError(err error) errorClass {
+	if errors.Is(err, errProviderSaturated) {
+		return errorClassSaturated
+	}
+	switch status := provider.StatusCodeOf(err); {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return errorClassAuth
+	case status == http.StatusNotFound && isModelNotFound(err):
+		return errorClassNotFound
+	case status == http.StatusNotFound:
+		return errorClassUnsupported
+	case status == http.StatusBadRequest || status == http.StatusRequestEntityTooLarge ||
+		status == http.StatusUnsupportedMediaType || status == http.StatusUnprocessableEntity:
+		return errorClassClient
+	case status == http.StatusTooManyRequests:
+		return errorClassRateLimit
+	case status >= 500:
+		return errorClassServer
+	case status != 0:
+		return errorClassOther
+	}
+
+	// A cancelled call surfaces as a *url.Error, which is a net.Error, so it is told apart first
+	if errors.Is(err, context.Canceled) {
+		return errorClassCanceled
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errorClassTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return errorClassTimeout
+		}
+		return errorClassServer
+	}
+	return errorClassOther
+}
+
+// isModelNotFound reports whether a 404 says the model does not exist, as OpenAI's
+// model_not_found code, Anthropic's not_found_error for the model or Ollama's "model not
+// found" do, rather than that the path does not
+func isModelNotFound(err error) bool {
+	var er *openai.ErrorResponse
+	if errors.As(err, &er) && er.Err != nil && er.Err.Code == "model_not_found" {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "model") && (strings.Contains(msg, "not found") || strings.Contains(msg, "not_found") || strings.Contains(msg, "does not exist"))
+}
+
+// relayClientError answers the client with a backend's refusal of its request as the
+// backend sent it
+func relayClientError(c *fiber.Ctx, status int, body []byte) error {
+	if !json.Valid(body) {
+		return handleError(c, strings.TrimSpace(string(body)), status)
+	}
+	c.Set(HeaderContentType, ContentTypeJSON)
+	return c.Status(status).Send(body)
+}
+
+// clientErrorOf returns the status and body of a backend's answer the request itself is
+// at fault for. It is relayed to the client: another backend would refuse it the same way.
+func clientErrorOf(err error) (int, []byte, bool) {
+	var se *provider.StatusError
+	if classifyError(err) != errorClassClient || !errors.As(err, &se) {
+		return 0, nil, false
+	}
+	return se.StatusCode, se.Body, true
+}
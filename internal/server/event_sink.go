@@ -0,0 +1,120 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/api/openai"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/eventsink"
+	applogger "github.com/macedot/openmodel/internal/logger"
+)
+
+// usageEventGroups are the endpoint groups whose requests publish a usage event
+var usageEventGroups = []string{config.EndpointsOpenAI, config.EndpointsAnthropic}
+
+// newEventSink creates the sink of the event_sink config, nil when it is disabled
+func newEventSink(cfg *config.Config) *eventsink.Sink {
+	if !cfg.EventSink.IsEnabled() {
+		return nil
+	}
+	sink, err := eventsink.New(eventsink.Config{
+		Type:     cfg.EventSink.Type,
+		Brokers:  cfg.EventSink.GetBrokers(),
+		URL:      cfg.EventSink.GetURL(),
+		Token:    cfg.EventSink.GetToken(),
+		Topic:    cfg.EventSink.GetTopic(),
+		TLS:      cfg.EventSink.TLS,
+		Username: cfg.EventSink.GetUsername(),
+		Password: cfg.EventSink.GetPassword(),
+	})
+	if err != nil {
+		applogger.Warn("event_sink_init_failed", "type", cfg.EventSink.Type, "error", err)
+		return nil
+	}
+	return sink
+}
+
+// usageEventRequest is the usage event of a request in progress
+type usageEventRequest struct {
+	event     eventsink.Event
+	start     time.Time
+	streaming bool // the event is published once the stream ends
+}
+
+type usageEventKey struct{}
+
+// usageEventFromContext returns the usage event of a request, nil if it publishes none
+func usageEventFromContext(ctx context.Context) *usageEventRequest {
+	r, _ := ctx.Value(usageEventKey{}).(*usageEventRequest)
+	return r
+}
+
+// stream hands the event over to the stream writer of the response, which publishes it
+// once the stream ends
+func (r *usageEventRequest) stream(requestID, model string) {
+	if r != nil {
+		r.streaming = true
+		r.event.RequestID, r.event.Model = requestID, model
+		r.event.Status, r.event.Stream = fiber.StatusOK, true
+	}
+}
+
+// setUsage records the backend that served and the tokens and cost it reported
+func (r *usageEventRequest) setUsage(providerKey string, u openai.Usage, cost float64) {
+	if r != nil {
+		r.event.Backend = providerKey
+		r.event.PromptTokens = u.PromptTokens
+		r.event.CompletionTokens = u.CompletionTokens
+		r.event.TotalTokens = u.PromptTokens + u.CompletionTokens
+		r.event.Cost = cost
+	}
+}
+
+// usageEventMiddleware publishes a usage event for each OpenAI and Anthropic API request.
+// A streamed response is published by its stream writer when the stream ends.
+func (s *Server) usageEventMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Method() != fiber.MethodPost || !slices.Contains(usageEventGroups, endpointGroup(c.Path())) {
+			return c.Next()
+		}
+		// The event outlives the request, whose buffers fiber reuses
+		req := &usageEventRequest{
+			event: eventsink.Event{
+				Endpoint: strings.Clone(c.Path()),
+				KeyID:    clientKeyID(c.UserContext(), requestHeader(c)),
+			},
+			start: time.Now(),
+		}
+		c.SetUserContext(context.WithValue(c.UserContext(), usageEventKey{}, req))
+
+		err := c.Next()
+
+		// The stream writer has the event of a streamed response
+		if req.streaming {
+			return err
+		}
+		req.event.RequestID, _ = c.Locals("request_id").(string)
+		req.event.Model, _ = c.Locals("model").(string)
+		if req.event.Backend == "" {
+			req.event.Backend, _ = c.Locals("provider").(string)
+		}
+		req.event.Status = c.Response().StatusCode()
+		s.publishUsageEvent(req)
+		return err
+	}
+}
+
+// publishUsageEvent publishes the usage event of a request once its response is complete
+func (s *Server) publishUsageEvent(req *usageEventRequest) {
+	if req == nil {
+		return
+	}
+	req.event.Time = time.Now()
+	req.event.LatencyMs = req.event.Time.Sub(req.start).Milliseconds()
+	s.eventSink.Publish(req.event)
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNATS starts a minimal NATS server sending the payloads published to it on a channel
+func fakeNATS(t *testing.T) (string, chan []byte) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	published := make(chan []byte, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.WriteString(conn, "INFO {}\r\n")
+				rd := bufio.NewReader(conn)
+				for {
+					line, err := rd.ReadString('\n')
+					if err != nil {
+						return
+					}
+					fields := strings.Fields(line)
+					switch {
+					case len(fields) == 3 && fields[0] == "PUB":
+						size, _ := strconv.Atoi(fields[2])
+						payload := make([]byte, size+2)
+						if _, err := io.ReadFull(rd, payload); err != nil {
+							return
+						}
+						published <- payload[:size]
+					case len(fields) == 1 && fields[0] == "PING":
+						io.WriteString(conn, "PONG\r\n")
+					}
+				}
+			}()
+		}
+	}()
+	return "nats://" + ln.Addr().String(), published
+}
+
+func TestUsageEvents(t *testing.T) {
+	natsURL, published := fakeNATS(t)
+
+	prov := &stubProvider{
+		name: "ollama",
+		doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+			return []byte(`{"id":"c1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}],"usage":{"prompt_tokens":5,"completion_tokens":1,"total_tokens":6}}`), nil
+		},
+		doStreamReqFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+			return streamOf(
+				`data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4","choices":[{"index":0,"delta":{"content":"streamed"},"finish_reason":null}]}`,
+				`data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4","choices":[{"index":0,"delta":{},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`,
+				SSEDataDone,
+			), nil
+		},
+	}
+	srv := newStreamingTestServer(prov)
+	srv.config.EventSink = &config.EventSinkConfig{Enabled: true, Type: config.EventSinkNATS, URL: natsURL}
+	srv.eventSink = newEventSink(srv.config)
+	require.NotNil(t, srv.eventSink)
+	app := fiber.New()
+	app.Use(srv.usageEventMiddleware())
+	srv.registerRoutes(app)
+
+	for _, body := range []string{
+		`{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`,
+		`{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"hello"}]}`,
+	} {
+		req := httptest.NewRequest("POST", EndpointV1ChatCompletions, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer sk-client")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+		io.ReadAll(resp.Body)
+	}
+	// Requests to other endpoints publish no event
+	resp, err := app.Test(httptest.NewRequest("GET", EndpointV1Models, nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	require.NoError(t, srv.eventSink.Shutdown(context.Background()))
+	close(published)
+	var events []map[string]any
+	for payload := range published {
+		var event map[string]any
+		require.NoError(t, json.Unmarshal(payload, &event))
+		events = append(events, event)
+	}
+	require.Len(t, events, 2)
+	for _, event := range events {
+		assert.Equal(t, EndpointV1ChatCompletions, event["endpoint"])
+		assert.Equal(t, "gpt-4", event["model"])
+		assert.Equal(t, "ollama/gpt-4", event["backend"])
+		assert.Equal(t, 200.0, event["status"])
+		assert.NotEmpty(t, event["key_id"])
+		assert.Contains(t, event, "latency_ms")
+	}
+	assert.Equal(t, 6.0, events[0]["total_tokens"])
+	assert.Equal(t, false, events[0]["stream"])
+	assert.Equal(t, 5.0, events[1]["total_tokens"])
+	assert.Equal(t, 2.0, events[1]["completion_tokens"])
+	assert.Equal(t, true, events[1]["stream"])
+}
@@ -0,0 +1,116 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"context"
+	"hash/fnv"
+	"math/rand/v2"
+	"time"
+
+	"github.com/macedot/openmodel/internal/api/openai"
+	"github.com/macedot/openmodel/internal/config"
+	applogger "github.com/macedot/openmodel/internal/logger"
+	"github.com/macedot/openmodel/internal/provider"
+)
+
+// experimentAssignment is the experiment arm a request was assigned to
+type experimentAssignment struct {
+	experiment string
+	arm        string
+	model      string    // Model whose backend chain serves the arm
+	start      time.Time // When the request was assigned, for the latency in the usage log
+}
+
+type experimentCtxKey struct{}
+
+// withExperiment records the request's experiment arm in its context
+func withExperiment(ctx context.Context, assignment *experimentAssignment) context.Context {
+	if assignment == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, experimentCtxKey{}, assignment)
+}
+
+// experimentFromContext returns the request's experiment arm, nil when not in an experiment
+func experimentFromContext(ctx context.Context) *experimentAssignment {
+	assignment, _ := ctx.Value(experimentCtxKey{}).(*experimentAssignment)
+	return assignment
+}
+
+// assignExperiment places a chat request for model in an arm of the model's experiment,
+// if it has one, and returns the model that serves the request with the assignment (nil
+// outside experiments). Requests carrying a user (OpenAI user or Anthropic
+// metadata.user_id) always land in the same arm; others are assigned at random by weight.
+func (s *Server) assignExperiment(model string, body []byte) (string, *experimentAssignment) {
+	exp, ok := s.GetConfig().ExperimentFor(model)
+	if !ok || len(exp.Arms) == 0 {
+		return model, nil
+	}
+	arm := pickArm(exp, parseRequestAttributes(body).user)
+	return arm.Model, &experimentAssignment{experiment: exp.Name, arm: arm.Name, model: arm.Model, start: time.Now()}
+}
+
+// pickArm chooses an arm by weight, deterministically for a non-empty user
+func pickArm(exp *config.ExperimentConfig, user string) config.ExperimentArm {
+	total := 0
+	for _, arm := range exp.Arms {
+		total += arm.GetWeight()
+	}
+
+	var n int
+	if user != "" {
+		h := fnv.New64a()
+		h.Write([]byte(exp.Name))
+		h.Write([]byte{0})
+		h.Write([]byte(user))
+		n = int(h.Sum64() % uint64(total))
+	} else {
+		n = rand.IntN(total)
+	}
+	for _, arm := range exp.Arms {
+		n -= arm.GetWeight()
+		if n < 0 {
+			return arm
+		}
+	}
+	return exp.Arms[len(exp.Arms)-1]
+}
+
+// tagExperiment adds the experiment and arm response headers
+func tagExperiment(header func(key, value string), assignment *experimentAssignment) {
+	if assignment == nil {
+		return
+	}
+	header(HeaderXExperiment, assignment.experiment)
+	header(HeaderXExperimentArm, assignment.arm)
+}
+
+// recordUsage accounts for the token usage of a completed request: it is added to the
+// provider's spend, the token metrics, the usage store, the client key's tokens per
+// minute, the monthly quotas of the key and the tenant and the exported generation and,
+// for requests in an experiment, logged with the arm so the arms can be compared offline
+func (s *Server) recordUsage(ctx context.Context, providerKey string, usage openai.Usage) {
+	cost := s.recordSpend(ctx, providerKey, usage)
+	s.metrics.observeUsage(providerKey, usage)
+	s.accountUsage(ctx, providerKey, usage, cost)
+	attribution := usageAttributionFromContext(ctx)
+	s.keyLimits.consume(attribution.keyID, usage.PromptTokens+usage.CompletionTokens)
+	s.quotas.add(attribution.keyID, int64(usage.PromptTokens+usage.CompletionTokens), cost, time.Now())
+	if attribution.tenant != "" {
+		s.quotas.add(tenantQuotaID(attribution.tenant), int64(usage.PromptTokens+usage.CompletionTokens), cost, time.Now())
+	}
+	llmExportFromContext(ctx).setUsage(usage)
+	usageEventFromContext(ctx).setUsage(providerKey, usage, cost)
+
+	if assignment := experimentFromContext(ctx); assignment != nil {
+		applogger.Info("experiment_usage",
+			"request_id", provider.RequestIDFromContext(ctx),
+			"experiment", assignment.experiment,
+			"arm", assignment.arm,
+			"model", assignment.model,
+			"provider", providerKey,
+			"latency_ms", time.Since(assignment.start).Milliseconds(),
+			"prompt_tokens", usage.PromptTokens,
+			"completion_tokens", usage.CompletionTokens)
+	}
+}
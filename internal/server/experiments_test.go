@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/endpoints"
+	"github.com/macedot/openmodel/internal/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPickArm(t *testing.T) {
+	exp := &config.ExperimentConfig{Name: "ab", Model: "chat", Arms: []config.ExperimentArm{
+		{Name: "control", Model: "chat", Weight: 1},
+		{Name: "candidate", Model: "chat-b", Weight: 3},
+	}}
+
+	t.Run("same user, same arm", func(t *testing.T) {
+		first := pickArm(exp, "alice")
+		for range 20 {
+			assert.Equal(t, first.Name, pickArm(exp, "alice").Name)
+		}
+	})
+
+	t.Run("split by weight", func(t *testing.T) {
+		counts := map[string]int{}
+		for range 4000 {
+			counts[pickArm(exp, "").Name]++
+		}
+		assert.InDelta(t, 1000, counts["control"], 200)
+		assert.InDelta(t, 3000, counts["candidate"], 200)
+	})
+
+	t.Run("zero weight arms still get traffic", func(t *testing.T) {
+		even := &config.ExperimentConfig{Name: "even", Arms: []config.ExperimentArm{{Name: "a"}, {Name: "b"}}}
+		counts := map[string]int{}
+		for range 1000 {
+			counts[pickArm(even, "").Name]++
+		}
+		assert.Positive(t, counts["a"])
+		assert.Positive(t, counts["b"])
+	})
+}
+
+func TestHandleV1ChatCompletions_Experiment(t *testing.T) {
+	respond := func(id string) func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+		return func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+			return []byte(`{"id":"` + id + `","object":"chat.completion","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":5,"total_tokens":8}}`), nil
+		}
+	}
+	cfg := &config.Config{
+		Models: map[string]config.ModelConfig{
+			"gpt-4":   {Strategy: config.StrategyFallback, Providers: []config.ModelProvider{{Provider: "control", Model: "gpt-4o"}}},
+			"gpt-4-b": {Strategy: config.StrategyFallback, Providers: []config.ModelProvider{{Provider: "candidate", Model: "llama3"}}},
+		},
+		Experiments: []config.ExperimentConfig{{Name: "llama-trial", Model: "gpt-4", Arms: []config.ExperimentArm{
+			{Name: "control", Model: "gpt-4"},
+			{Name: "candidate", Model: "gpt-4-b"},
+		}}},
+		Thresholds: config.ThresholdsConfig{FailuresBeforeSwitch: 1, InitialTimeout: 1000, MaxTimeout: 10000},
+	}
+	srv := &Server{config: cfg, state: state.New(), providers: providerMap{
+		"control":   &stubProvider{name: "control", doRequestFn: respond("control")},
+		"candidate": &stubProvider{name: "candidate", doRequestFn: respond("candidate")},
+	}}
+
+	app := fiber.New()
+	app.Post(endpoints.V1ChatCompletions, srv.handleV1ChatCompletions)
+	for _, user := range []string{"alice", "bob", "carol", "dave", "erin"} {
+		req := httptest.NewRequest("POST", endpoints.V1ChatCompletions, strings.NewReader(`{"model":"gpt-4","user":"`+user+`","messages":[{"role":"user","content":"hello"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		arm := pickArm(&cfg.Experiments[0], user).Name
+		assert.Equal(t, "llama-trial", resp.Header.Get(HeaderXExperiment))
+		assert.Equal(t, arm, resp.Header.Get(HeaderXExperimentArm))
+		assert.Contains(t, string(body), `"id":"`+arm+`"`, "the arm's backend chain serves the request")
+	}
+}
@@ -3,11 +3,19 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/macedot/openmodel/internal/config"
 	applogger "github.com/macedot/openmodel/internal/logger"
+	"github.com/macedot/openmodel/internal/provider"
+	"github.com/macedot/openmodel/internal/state"
+	"github.com/macedot/openmodel/internal/tracing"
 )
 
 // providerResult holds a provider with its metadata
@@ -15,10 +23,11 @@ type providerResult struct {
 	provider      requestProvider
 	providerKey   string
 	providerModel string
+	weight        int
 }
 
-// handleAllProvidersFailedFiber handles when all providers have failed
-func (s *Server) handleAllProvidersFailedFiber(c *fiber.Ctx, lastErr error) {
+// handleAllProvidersFailedFiber handles when all providers of a model have failed
+func (s *Server) handleAllProvidersFailedFiber(c *fiber.Ctx, model string, lastErr error) {
 	errMsg := "all providers failed"
 	if lastErr != nil {
 		errMsg = lastErr.Error()
@@ -26,49 +35,210 @@ func (s *Server) handleAllProvidersFailedFiber(c *fiber.Ctx, lastErr error) {
 	requestID, _ := c.Locals("request_id").(string)
 	applogger.Error("all_providers_failed", "request_id", requestID, "error", errMsg)
 
+	// Tell the client when the earliest provider is expected back, in header and body
+	retryAfter := int(math.Ceil(s.retryAfterForModel(model).Seconds()))
+	c.Set("Retry-After", fmt.Sprintf("%d", retryAfter))
+	c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": errMsg, "retry_after": retryAfter})
+}
+
+// retryAfterForModel estimates when a model can be served again: the shortest remaining
+// cooldown among its providers, at least one second and at most max_timeout_ms
+func (s *Server) retryAfterForModel(model string) time.Duration {
 	cfg := s.GetConfig()
-	timeout := s.state.GetProgressiveTimeout()
-	s.state.IncrementTimeout(cfg.Thresholds.MaxTimeout)
+	wait := cfg.Thresholds.GetMaxCooldown()
+	found := false
+	for _, p := range cfg.Models[model].Providers {
+		remaining, ok := s.state.RetryAfter(formatProviderKey(p))
+		if ok && (!found || remaining < wait) {
+			wait, found = remaining, true
+		}
+	}
+	return max(wait, time.Second)
+}
+
+// defaultRateLimitCooldown suspends a rate-limited provider that sent no Retry-After
+const defaultRateLimitCooldown = 5 * time.Second
+
+// handleProviderError handles a provider error by recording failure. The request is not
+// routed to the backend again.
+func (s *Server) handleProviderError(ctx context.Context, providerKey string, err error) {
+	routeAttemptsFromContext(ctx).fail(providerKey)
+	switch classifyError(err) {
+	case errorClassSaturated:
+		applogger.Debug("provider_saturated", "provider", providerKey)
+		return
+	case errorClassCanceled:
+		applogger.Debug("provider_attempt_canceled", "provider", providerKey)
+		return
+	}
+	applogger.Warn("provider_failed", "provider", providerKey, "error_class", classifyError(err).String(), "error", err.Error())
+	s.recordProviderFailure(providerKey, err)
+}
+
+// recordProviderFailure applies the failure policy for the error's class: bad credentials
+// and unknown models disable the backend, a provider that sent Retry-After is parked
+// until then, rate limits without one get a short cooldown, and everything else counts
+// towards the failure threshold. A saturated provider is healthy and records nothing, nor
+// does a backend refusing a bad request or not serving an endpoint, and an attempt
+// cancelled by the client says nothing about the backend at all.
+func (s *Server) recordProviderFailure(providerKey string, err error) {
+	class := classifyError(err)
+	if class == errorClassCanceled {
+		return
+	}
+	retryAfter := provider.RetryAfterOf(err)
+	s.metrics.observeBackendError(providerKey, class)
+	switch {
+	case class == errorClassSaturated || class == errorClassClient || class == errorClassUnsupported:
+		return
+	case class == errorClassAuth || class == errorClassNotFound:
+		applogger.Error("provider_disabled", "provider", providerKey, "error_class", class.String())
+		s.state.Disable(providerKey)
+		s.backendDown(providerKey, class.String(), err)
+	case retryAfter > 0:
+		applogger.Info("provider_parked", "provider", providerKey, "retry_after_ms", retryAfter.Milliseconds())
+		s.state.Suspend(providerKey, retryAfter)
+	case class == errorClassRateLimit:
+		s.state.Suspend(providerKey, defaultRateLimitCooldown)
+	default:
+		s.state.RecordFailure(providerKey, s.breakerPolicy(providerKey))
+		if s.state.Circuit(providerKey) != state.CircuitClosed {
+			s.backendDown(providerKey, class.String(), err)
+		}
+	}
+}
 
-	c.Set("Retry-After", fmt.Sprintf("%d", timeout/1000))
-	handleError(c, errMsg, fiber.StatusServiceUnavailable)
+// breakerPolicy returns the failure policy for a backend key ("provider/model")
+func (s *Server) breakerPolicy(providerKey string) state.Policy {
+	t := s.GetConfig().GetBackendThresholds(providerKey)
+	policy := state.Policy{
+		Threshold:   t.FailuresBeforeSwitch,
+		Window:      t.GetFailureWindow(),
+		Cooldown:    t.GetCooldown(),
+		MaxCooldown: t.GetMaxCooldown(),
+	}
+	if t.ErrorRate.IsEnabled() {
+		policy.ErrorRate = t.ErrorRate.Percent / 100
+		policy.RateRequests = t.ErrorRate.GetRequests()
+		policy.RateMinRequests = t.ErrorRate.GetMinRequests()
+		policy.RateWindow = t.ErrorRate.GetWindow()
+	}
+	return policy
 }
 
-// handleProviderError handles a provider error by recording failure
-func (s *Server) handleProviderError(providerKey string, err error, threshold int) {
-	applogger.Warn("provider_failed", "provider", providerKey, "error", err.Error())
-	s.state.RecordFailure(providerKey, threshold)
+// recordSuccess records a successful request to a backend key ("provider/model")
+func (s *Server) recordSuccess(providerKey string) {
+	s.state.RecordSuccess(providerKey, s.breakerPolicy(providerKey))
+	if s.notifiedDown(providerKey) && s.state.Circuit(providerKey) == state.CircuitClosed {
+		s.backendUp(providerKey)
+	}
 }
 
-// findProviderWithFailover finds an available provider for a model
-func (s *Server) findProviderWithFailover(model string, providerName string) (requestProvider, string, string, error) {
+// findProviderWithFailover finds an available provider for a model, traced as a routing span
+func (s *Server) findProviderWithFailover(ctx context.Context, model string) (prov requestProvider, providerKey, providerModel string, err error) {
+	_, span := s.tracer.Start(ctx, "route "+model, tracing.SpanKindInternal)
+	span.SetAttribute(spanAttrModel, model)
+	defer func() {
+		span.SetAttribute(spanAttrBackend, providerKey)
+		span.SetError(err)
+		span.End()
+	}()
+
 	cfg := s.GetConfig()
 	modelConfig, exists := cfg.Models[model]
 	if !exists {
 		return nil, "", "", fmt.Errorf("model %q not found", model)
 	}
 
-	providers := modelConfig.Providers
-	strategy := modelConfig.Strategy
-	if strategy == "" {
-		strategy = config.StrategyFallback
-	}
+	strategy := config.NormalizeStrategy(modelConfig.Strategy)
 
-	threshold := cfg.GetThresholds(providerName).FailuresBeforeSwitch
-
-	// Find all available providers
-	available := s.findAvailableProvidersForModel(providers, threshold)
+	// Find all available providers that can serve the request
+	required := requiredCapabilitiesFromContext(ctx)
+	available := s.findAvailableProvidersForModel(modelConfig.Providers, required)
+	attempts := routeAttemptsFromContext(ctx)
+	available = slices.DeleteFunc(available, func(p providerResult) bool { return attempts.hasFailed(p.providerKey) })
 	if len(available) == 0 {
+		if len(required) > 0 {
+			return nil, "", "", fmt.Errorf("no available providers for model %q supporting %s", model, strings.Join(required, ", "))
+		}
 		return nil, "", "", fmt.Errorf("no available providers for model %q", model)
 	}
 
-	// Select based on strategy
+	return s.claimProvider(ctx, model, strategy, available, stickyKeyFromContext(ctx))
+}
+
+// findAudioProviderWithFailover finds an available audio-capable provider for a model
+func (s *Server) findAudioProviderWithFailover(ctx context.Context, model string) (requestProvider, string, string, error) {
+	cfg := s.GetConfig()
+	modelConfig, exists := cfg.Models[model]
+	if !exists {
+		return nil, "", "", fmt.Errorf("model %q not found", model)
+	}
+
+	strategy := config.NormalizeStrategy(modelConfig.Strategy)
+
+	attempts := routeAttemptsFromContext(ctx)
+	var audio []providerResult
+	for _, p := range s.findAvailableProvidersForModel(modelConfig.Providers, nil) {
+		if pc, ok := cfg.Providers[p.provider.Name()]; ok && pc.Audio && !attempts.hasFailed(p.providerKey) {
+			audio = append(audio, p)
+		}
+	}
+	if len(audio) == 0 {
+		return nil, "", "", fmt.Errorf("no available audio providers for model %q", model)
+	}
+
+	return s.claimProvider(ctx, model, strategy, audio, "")
+}
+
+// claimProvider picks one of the available providers according to the model strategy and
+// lets its circuit breaker admit the request, which takes the probe of a half-open
+// backend. A backend whose probe another request took meanwhile is passed over, and one
+// the request was routed to before is not asked again.
+func (s *Server) claimProvider(ctx context.Context, model, strategy string, available []providerResult, stickyKey string) (requestProvider, string, string, error) {
+	attempts := routeAttemptsFromContext(ctx)
+	for len(available) > 0 {
+		prov, providerKey, providerModel, err := s.selectProvider(model, strategy, available, stickyKey)
+		if err != nil {
+			return nil, "", "", err
+		}
+		if attempts.claim(providerKey, func() bool { return s.state.Allow(providerKey, s.breakerPolicy(providerKey)) }) {
+			return prov, providerKey, providerModel, nil
+		}
+		available = slices.DeleteFunc(slices.Clone(available), func(p providerResult) bool { return p.providerKey == providerKey })
+	}
+	return nil, "", "", fmt.Errorf("no available providers for model %q", model)
+}
+
+// selectProvider picks one of the available providers according to the model strategy.
+// stickyKey is only used by the sticky strategy.
+func (s *Server) selectProvider(model, strategy string, available []providerResult, stickyKey string) (requestProvider, string, string, error) {
 	switch strategy {
 	case config.StrategyRoundRobin:
 		idx := s.state.NextRoundRobin(model, len(available))
 		p := available[idx]
 		return p.provider, p.providerKey, p.providerModel, nil
 
+	case config.StrategyWeighted:
+		candidates, weights := s.weightedCandidates(model, available)
+		p := candidates[s.state.GetWeightedIndex(weights)]
+		return p.provider, p.providerKey, p.providerModel, nil
+
+	case config.StrategyLeastBusy:
+		// Ties keep configuration order, so an idle chain behaves like fallback
+		best, bestLoad := 0, s.state.InFlight(available[0].providerKey)
+		for i := 1; i < len(available); i++ {
+			if load := s.state.InFlight(available[i].providerKey); load < bestLoad {
+				best, bestLoad = i, load
+			}
+		}
+		p := available[best]
+		return p.provider, p.providerKey, p.providerModel, nil
+
+	case config.StrategySticky:
+		p := selectSticky(stickyKey, available)
+		return p.provider, p.providerKey, p.providerModel, nil
+
 	case config.StrategyRandom:
 		idx := s.state.GetRandomIndex(len(available))
 		p := available[idx]
@@ -82,16 +252,96 @@ func (s *Server) findProviderWithFailover(model string, providerName string) (re
 	}
 }
 
-// findAvailableProvidersForModel returns available providers for a model
-func (s *Server) findAvailableProvidersForModel(providers []config.ModelProvider, threshold int) []providerResult {
+// weightedCandidates returns the providers eligible for weighted selection with their
+// weights. Runtime overrides (set through the admin API) replace configured weights, and
+// a backend overridden to 0 receives no traffic unless every available backend is at 0.
+func (s *Server) weightedCandidates(model string, available []providerResult) ([]providerResult, []int) {
+	overrides := s.state.Weights(model)
+	var (
+		candidates []providerResult
+		weights    []int
+	)
+	for _, p := range available {
+		w := p.weight
+		if override, ok := overrides[p.providerKey]; ok {
+			w = override
+		}
+		if w > 0 {
+			candidates = append(candidates, p)
+			weights = append(weights, w)
+		}
+	}
+	if len(candidates) > 0 {
+		return candidates, weights
+	}
+
+	weights = make([]int, len(available))
+	for i, p := range available {
+		weights[i] = p.weight
+	}
+	return available, weights
+}
+
+// errProviderSaturated is returned for a call to a provider already serving its
+// max_concurrency requests; the request moves on to the next provider
+var errProviderSaturated = errors.New("provider is at its max_concurrency")
+
+// trackInFlight marks a request to providerKey as in flight, taking one of the provider's
+// concurrency slots; call the returned func when it ends. It fails with
+// errProviderSaturated when the provider has no free slot.
+func (s *Server) trackInFlight(providerKey string) (func(), error) {
+	providerName, _, _ := strings.Cut(providerKey, "/")
+	limit := s.GetConfig().Providers[providerName].MaxConcurrency
+
+	s.providerLoadMu.Lock()
+	if limit > 0 && s.providerLoad[providerName] >= limit {
+		s.providerLoadMu.Unlock()
+		return nil, errProviderSaturated
+	}
+	if s.providerLoad == nil {
+		s.providerLoad = make(map[string]int)
+	}
+	s.providerLoad[providerName]++
+	s.providerLoadMu.Unlock()
+
+	s.state.AcquireInFlight(providerKey)
+	return func() {
+		s.state.ReleaseInFlight(providerKey)
+		s.providerLoadMu.Lock()
+		s.providerLoad[providerName]--
+		s.providerLoadMu.Unlock()
+	}, nil
+}
+
+// providerSaturated reports whether a provider is serving its max_concurrency requests.
+// The caller must hold providersMu.
+func (s *Server) providerSaturated(providerName string) bool {
+	limit := s.config.Providers[providerName].MaxConcurrency
+	if limit <= 0 {
+		return false
+	}
+	s.providerLoadMu.Lock()
+	defer s.providerLoadMu.Unlock()
+	return s.providerLoad[providerName] >= limit
+}
+
+// findAvailableProvidersForModel returns available providers for a model that declare the
+// required capabilities, are within their schedule and budget and have a free concurrency
+// slot. Other backends are skipped, and none has its circuit breaker's half-open probe
+// taken: that is left to claimProvider for the one backend a request goes to.
+func (s *Server) findAvailableProvidersForModel(providers []config.ModelProvider, required []string) []providerResult {
 	s.providersMu.RLock()
 	defer s.providersMu.RUnlock()
 
 	var results []providerResult
 	for _, p := range providers {
 		providerKey := formatProviderKey(p)
+		if s.routingSkipReason(p, required) != "" {
+			continue
+		}
 
-		if !s.state.IsAvailable(providerKey, threshold) {
+		// Failed providers are skipped until their cooldown allows a probe request
+		if !s.state.Admits(providerKey, s.breakerPolicy(providerKey)) {
 			continue
 		}
 
@@ -99,22 +349,63 @@ func (s *Server) findAvailableProvidersForModel(providers []config.ModelProvider
 		if !exists {
 			continue
 		}
+		if p.Chaos != nil {
+			prov = s.chaos.wrap(providerKey, *p.Chaos, prov)
+		}
 
 		results = append(results, providerResult{
 			provider:      prov,
 			providerKey:   providerKey,
 			providerModel: p.Model,
+			weight:        p.GetWeight(),
 		})
 	}
 	return results
 }
 
-// executeWithFailoverFiber handles non-streaming requests with failover
+// Reasons routing passes a backend over, reported by /admin/state
+const (
+	skipCapabilities = "missing_capabilities"
+	skipDisabled     = "disabled"
+	skipSchedule     = "outside_schedule"
+	skipBudget       = "over_budget"
+	skipSaturated    = "saturated"
+	skipCircuitOpen  = "circuit_open"
+	skipProbing      = "probe_in_flight"
+	skipNotLoaded    = "provider_not_loaded"
+)
+
+// routingSkipReason returns why routing passes a backend over before consulting its
+// circuit breaker, or "" when it does not. Callers hold providersMu for reading.
+func (s *Server) routingSkipReason(p config.ModelProvider, required []string) string {
+	switch {
+	case !supportsCapabilities(s.backendCapabilities(p), required):
+		return skipCapabilities
+	// Backends disabled through the admin API are skipped until enabled again
+	case !s.state.Enabled(formatProviderKey(p)):
+		return skipDisabled
+	// Backends are skipped outside the hours of their schedule
+	case p.Schedule != nil && !p.Schedule.Active(time.Now()):
+		return skipSchedule
+	// Providers over budget are skipped until the budget period ends
+	case s.budgetExhausted(p.Provider):
+		return skipBudget
+	// Saturated providers spill requests over to the rest of the chain
+	case s.providerSaturated(p.Provider):
+		return skipSaturated
+	}
+	return ""
+}
+
+// executeWithFailoverFiber handles non-streaming requests with failover. It is a request
+// of its own as far as routing is concerned, also when made on behalf of another. A
+// backend's refusal of the request is returned as it is, for clientErrorOf.
 func (s *Server) executeWithFailoverFiber(ctx context.Context, model string, body []byte, headers map[string]string, endpoint string) (any, string, error) {
+	ctx = withRouteAttempts(ctx)
 	var triedProviders []string
 
 	for {
-		prov, providerKey, providerModel, err := s.findProviderWithFailover(model, "")
+		prov, providerKey, providerModel, err := s.findProviderWithFailover(ctx, model)
 		if err != nil {
 			requestID, _ := ctx.Value("request_id").(string)
 			applogger.Error("all_providers_failed",
@@ -126,18 +417,29 @@ func (s *Server) executeWithFailoverFiber(ctx context.Context, model string, bod
 		}
 
 		triedProviders = append(triedProviders, providerKey)
-		threshold := s.GetConfig().GetThresholds(providerKey).FailuresBeforeSwitch
 
 		// Log request processing
 		requestID, _ := ctx.Value("request_id").(string)
 		applogger.Debug("PROCESSING", "request_id", requestID, "provider", providerKey, "model", model)
 
-		// Replace model name in body
-		provBody := replaceModelInBody(body, providerModel)
+		// Replace model name in body and apply the backend's option rules
+		provBody := s.rewriteOptions(model, providerKey, replaceModelInBody(body, providerModel))
 
-		resp, err := prov.DoRequest(ctx, endpoint, provBody, headers)
+		var resp []byte
+		err = s.callProvider(ctx, model, providerKey, func(ctx context.Context) (err error) {
+			resp, err = prov.DoRequest(ctx, endpoint, provBody, headers)
+			return err
+		})
 		if err != nil {
-			s.handleProviderError(providerKey, err, threshold)
+			// A request its client cancelled is not failed over, nor held against the backend
+			if ctx.Err() != nil {
+				return nil, "", fmt.Errorf("request cancelled: %w", ctx.Err())
+			}
+			s.handleProviderError(ctx, providerKey, err)
+			// Another backend would refuse the request the same way
+			if _, _, ok := clientErrorOf(err); ok {
+				return nil, "", err
+			}
 			continue
 		}
 
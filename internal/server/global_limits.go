@@ -0,0 +1,168 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	applogger "github.com/macedot/openmodel/internal/logger"
+)
+
+// Global limit errors; all are answered with 429 and Retry-After
+var (
+	errServerBusy          = errors.New("server is serving its maximum of concurrent requests")
+	errServerQueueFull     = errors.New("too many requests queued on the server")
+	errServerQueueTimeout  = errors.New("timed out waiting for the server to accept the request")
+	errServerRateExceeded  = errors.New("server request rate exceeded")
+	errServerRateQueueFull = errors.New("too many requests queued for the server request rate")
+)
+
+// rateGate starts requests at a steady rate with a token bucket. A request that finds the
+// bucket empty reserves the next token and waits for it, so waiting requests start in
+// arrival order. The zero value is ready to use.
+type rateGate struct {
+	mu      sync.Mutex
+	rate    int
+	burst   int
+	tokens  float64
+	last    time.Time
+	waiting int
+}
+
+// wait takes a token, waiting for it behind at most maxQueue other requests when the
+// bucket is empty. It fails when the wait would exceed timeout.
+func (g *rateGate) wait(ctx context.Context, rate, burst, maxQueue int, timeout time.Duration) error {
+	g.mu.Lock()
+	now := time.Now()
+	if g.rate != rate || g.burst != burst {
+		// A new or changed rate, as after a config reload, starts a full bucket
+		g.rate, g.burst, g.tokens, g.last = rate, burst, float64(burst), now
+	}
+	g.tokens = minf(g.tokens+now.Sub(g.last).Seconds()*float64(rate), float64(burst))
+	g.last = now
+	if g.tokens >= 1 {
+		g.tokens--
+		g.mu.Unlock()
+		return nil
+	}
+	delay := time.Duration((1 - g.tokens) / float64(rate) * float64(time.Second))
+	switch {
+	case maxQueue <= 0:
+		g.mu.Unlock()
+		return errServerRateExceeded
+	case g.waiting >= maxQueue:
+		g.mu.Unlock()
+		return errServerRateQueueFull
+	case delay > timeout:
+		g.mu.Unlock()
+		return errServerQueueTimeout
+	}
+	g.tokens--
+	g.waiting++
+	g.mu.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.waiting--
+	if err != nil {
+		// Hand the reserved token back to the requests behind
+		g.tokens++
+	}
+	return err
+}
+
+// retryAfter returns the seconds until a token is free, at least one
+func (g *rateGate) retryAfter() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.rate <= 0 || g.tokens >= 1 {
+		return 1
+	}
+	return max(1, int(math.Ceil((1-g.tokens)/float64(g.rate))))
+}
+
+type globalTicketKey struct{}
+
+// globalTicketFromContext returns the request's slot under the global concurrency limit,
+// nil if the limit is not set
+func globalTicketFromContext(ctx context.Context) *admissionTicket {
+	t, _ := ctx.Value(globalTicketKey{}).(*admissionTicket)
+	return t
+}
+
+// globalLimitsMiddleware holds requests to the model APIs to the server-wide request rate
+// and concurrency, queueing the excess up to max_queue and rejecting the rest with 429.
+// It reads the current config, so a reload applies at once.
+func (s *Server) globalLimitsMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		limits := s.GetConfig().GlobalLimits
+		group := endpointGroup(c.Path())
+		if !limits.IsEnabled() || !config.IsAPIKeyEndpointGroup(group) {
+			return c.Next()
+		}
+
+		ctx := c.UserContext()
+		if limits.RequestsPerSecond > 0 {
+			if err := s.globalRate.wait(ctx, limits.RequestsPerSecond, limits.GetBurst(), limits.MaxQueue, limits.GetQueueTimeout()); err != nil {
+				return s.rejectGlobal(c, group, err, s.globalRate.retryAfter())
+			}
+		}
+		if limits.MaxConcurrent > 0 {
+			if err := s.globalQueue.acquire(ctx, limits.MaxConcurrent, limits.MaxQueue, 0, limits.GetQueueTimeout()); err != nil {
+				return s.rejectGlobal(c, group, globalQueueError(err, limits.MaxQueue), max(1, int(math.Ceil(limits.GetQueueTimeout().Seconds()))))
+			}
+			ticket := &admissionTicket{release: func() {
+				// Re-read the limit so a reload that raises it frees waiters straight away
+				maxConcurrent := limits.MaxConcurrent
+				if current := s.GetConfig().GlobalLimits; current != nil && current.MaxConcurrent > 0 {
+					maxConcurrent = current.MaxConcurrent
+				}
+				s.globalQueue.release(maxConcurrent)
+			}}
+			ticket.refs.Store(1)
+			defer ticket.done()
+			c.SetUserContext(context.WithValue(ctx, globalTicketKey{}, ticket))
+		}
+		return c.Next()
+	}
+}
+
+// globalQueueError words an admission queue error for the global concurrency limit
+func globalQueueError(err error, maxQueue int) error {
+	switch {
+	case errors.Is(err, errAdmissionQueueFull) && maxQueue <= 0:
+		return errServerBusy
+	case errors.Is(err, errAdmissionQueueFull):
+		return errServerQueueFull
+	case errors.Is(err, errAdmissionTimeout):
+		return errServerQueueTimeout
+	}
+	return err
+}
+
+// rejectGlobal answers a request turned away by the global limits with 429, in the
+// Anthropic error format on the Anthropic endpoints
+func (s *Server) rejectGlobal(c *fiber.Ctx, group string, err error, retryAfter int) error {
+	requestID, _ := c.Locals("request_id").(string)
+	applogger.Warn("global_limit_rejected", "request_id", requestID, "path", c.Path(), "error", err.Error())
+	c.Set(HeaderRetryAfter, strconv.Itoa(retryAfter))
+	if group == config.EndpointsAnthropic {
+		return handleAnthropicError(c, err.Error(), anthropicRateLimitError, fiber.StatusTooManyRequests)
+	}
+	return handleError(c, err.Error(), fiber.StatusTooManyRequests)
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateGate(t *testing.T) {
+	ctx := context.Background()
+
+	// Without a queue, requests beyond the burst are rejected at once
+	var g rateGate
+	require.NoError(t, g.wait(ctx, 1, 2, 0, time.Second))
+	require.NoError(t, g.wait(ctx, 1, 2, 0, time.Second))
+	assert.ErrorIs(t, g.wait(ctx, 1, 2, 0, time.Second), errServerRateExceeded)
+	assert.Equal(t, 1, g.retryAfter())
+
+	// With a queue, they wait for the next token
+	g = rateGate{}
+	require.NoError(t, g.wait(ctx, 50, 1, 1, time.Second))
+	start := time.Now()
+	require.NoError(t, g.wait(ctx, 50, 1, 1, time.Second))
+	assert.GreaterOrEqual(t, time.Since(start), 15*time.Millisecond)
+
+	// A wait longer than the timeout is rejected
+	g = rateGate{}
+	require.NoError(t, g.wait(ctx, 1, 1, 5, time.Second))
+	assert.ErrorIs(t, g.wait(ctx, 1, 1, 5, 100*time.Millisecond), errServerQueueTimeout)
+
+	// A full queue is rejected, and a cancelled wait hands its token back
+	g = rateGate{}
+	require.NoError(t, g.wait(ctx, 1, 1, 1, 5*time.Second))
+	cancelled, cancel := context.WithCancel(ctx)
+	errs := make(chan error, 1)
+	go func() { errs <- g.wait(cancelled, 1, 1, 1, 5*time.Second) }()
+	require.Eventually(t, func() bool {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		return g.waiting == 1
+	}, time.Second, time.Millisecond)
+	assert.ErrorIs(t, g.wait(ctx, 1, 1, 1, 5*time.Second), errServerRateQueueFull)
+	cancel()
+	assert.ErrorIs(t, <-errs, context.Canceled)
+	g.mu.Lock()
+	assert.Zero(t, g.waiting)
+	assert.Greater(t, g.tokens, -0.5)
+	g.mu.Unlock()
+}
+
+func TestGlobalLimitsMiddleware(t *testing.T) {
+	started, unblock := make(chan struct{}, 2), make(chan struct{})
+	prov := &stubProvider{
+		name: "ollama",
+		doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+			started <- struct{}{}
+			<-unblock
+			return []byte(`{"id":"c1","object":"chat.completion","choices":[]}`), nil
+		},
+	}
+	srv := newStreamingTestServer(prov)
+	srv.config.GlobalLimits = &config.GlobalLimitsConfig{MaxConcurrent: 1, QueueTimeoutMs: 1500}
+	app := fiber.New()
+	app.Use(srv.globalLimitsMiddleware())
+	srv.registerRoutes(app)
+
+	send := func(path, body string) *http.Response {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("anthropic-version", "2023-06-01")
+		resp, err := app.Test(req, -1)
+		require.NoError(t, err)
+		return resp
+	}
+	chat := `{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`
+
+	first := make(chan int)
+	go func() { first <- send(EndpointV1ChatCompletions, chat).StatusCode }()
+	<-started
+
+	// Without a queue, a request over the limit is rejected at once, whatever the model
+	resp := send(EndpointV1ChatCompletions, chat)
+	assert.Equal(t, fiber.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get(HeaderRetryAfter))
+	data, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(data), errServerBusy.Error())
+	resp = send(EndpointV1Messages, `{"model":"gpt-4","max_tokens":10,"messages":[{"role":"user","content":"hello"}]}`)
+	assert.Equal(t, fiber.StatusTooManyRequests, resp.StatusCode)
+	data, _ = io.ReadAll(resp.Body)
+	assert.Contains(t, string(data), anthropicRateLimitError)
+
+	// Other endpoints are not limited
+	req := httptest.NewRequest("GET", EndpointHealth, nil)
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	// With a queue, the request waits for the slot; a reload applies at once
+	srv.config.GlobalLimits = &config.GlobalLimitsConfig{MaxConcurrent: 1, MaxQueue: 1, QueueTimeoutMs: 1500}
+	second := make(chan int)
+	go func() { second <- send(EndpointV1ChatCompletions, chat).StatusCode }()
+	require.Eventually(t, func() bool {
+		srv.globalQueue.mu.Lock()
+		defer srv.globalQueue.mu.Unlock()
+		return srv.globalQueue.waiting.Len() == 1
+	}, time.Second, time.Millisecond)
+
+	close(unblock)
+	assert.Equal(t, fiber.StatusOK, <-first)
+	assert.Equal(t, fiber.StatusOK, <-second)
+	assert.Equal(t, 0, srv.globalQueue.active, "slot released after the response")
+}
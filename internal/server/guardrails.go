@@ -0,0 +1,284 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	applogger "github.com/macedot/openmodel/internal/logger"
+	"github.com/macedot/openmodel/internal/provider"
+)
+
+// Guardrails that can turn a request away, the code of its policy violation error
+const (
+	guardrailMaxPromptChars = "max_prompt_chars"
+	guardrailDeny           = "deny"
+	guardrailClassifier     = "classifier"
+)
+
+// defaultClassifierPrompt is the system prompt of a chat classifier without one
+const defaultClassifierPrompt = "You check messages sent to an AI assistant against its usage policy. " +
+	"Answer \"safe\" if the user's message is allowed. Otherwise answer \"unsafe\" followed, on the next line, " +
+	"by the comma-separated categories of the policy it breaks."
+
+// errGuardrailUnavailable is returned when a fail-closed classifier cannot judge a prompt
+var errGuardrailUnavailable = errors.New("the prompt could not be checked against the guardrails; try again later")
+
+// guardrailViolation is a request that breaks a guardrail policy
+type guardrailViolation struct {
+	guardrail  string   // Guardrail that turned it away
+	rule       string   // Deny pattern it matched
+	categories []string // Categories the classifier flagged
+	message    string
+}
+
+func (v *guardrailViolation) Error() string {
+	return v.message
+}
+
+// guardrailPatterns caches the compiled deny patterns by expression, so a reload that
+// changes them takes effect at once. The zero value is ready to use.
+type guardrailPatterns struct {
+	compiled sync.Map // pattern -> *regexp.Regexp
+}
+
+// get returns a compiled pattern; patterns were checked when the config was loaded
+func (p *guardrailPatterns) get(pattern string) (*regexp.Regexp, error) {
+	if re, ok := p.compiled.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	p.compiled.Store(pattern, re)
+	return re, nil
+}
+
+// applyGuardrails checks the prompt of a request for a requested model against the
+// guardrails. It returns the body with redacted text rewritten, or a *guardrailViolation
+// for a prompt breaking a policy and errGuardrailUnavailable when a fail-closed classifier
+// fails.
+func (s *Server) applyGuardrails(ctx context.Context, requested string, body []byte, headers map[string]string) ([]byte, error) {
+	g := s.GetConfig().Guardrails
+	if !g.AppliesTo(requested) {
+		return body, nil
+	}
+	var req map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	// Numbers are kept as written when the body is rewritten
+	decoder.UseNumber()
+	if err := decoder.Decode(&req); err != nil {
+		return body, nil
+	}
+
+	text := promptText(req)
+	redacted := false
+	for _, p := range g.Deny {
+		re, err := s.guardrailPatterns.get(p.Pattern)
+		if err != nil || !re.MatchString(text) {
+			continue
+		}
+		if p.GetAction() == config.GuardrailActionReject {
+			return nil, &guardrailViolation{guardrail: guardrailDeny, rule: p.Name, message: fmt.Sprintf("the prompt matches the denied pattern %q", p.Name)}
+		}
+		rewritePromptText(req, func(s string) string { return re.ReplaceAllString(s, p.GetReplacement()) })
+		redacted = true
+	}
+	if redacted {
+		rewritten, err := json.Marshal(req)
+		if err != nil {
+			return nil, err
+		}
+		body, text = rewritten, promptText(req)
+	}
+
+	if g.MaxPromptChars > 0 {
+		if n := utf8.RuneCountInString(text); n > g.MaxPromptChars {
+			return nil, &guardrailViolation{guardrail: guardrailMaxPromptChars, message: fmt.Sprintf("the prompt has %d characters, more than the limit of %d", n, g.MaxPromptChars)}
+		}
+	}
+
+	if cl := g.Classifier; cl != nil && text != "" {
+		categories, err := s.classifyPrompt(ctx, cl, text, headers)
+		if err != nil {
+			applogger.Warn("guardrail_classifier_failed", "request_id", provider.RequestIDFromContext(ctx), "model", cl.Model, "error", err.Error())
+			if cl.FailClosed {
+				return nil, errGuardrailUnavailable
+			}
+		} else if len(categories) > 0 {
+			return nil, &guardrailViolation{guardrail: guardrailClassifier, categories: categories, message: "the prompt was flagged by the classifier: " + strings.Join(categories, ", ")}
+		}
+	}
+	return body, nil
+}
+
+// guardPrompt applies the guardrails to the request of a fiber handler, replacing its body
+// by the rewritten one so the body log and exports see what the backend gets
+func (s *Server) guardPrompt(c *fiber.Ctx, requested string, body []byte) ([]byte, error) {
+	ctx, _ := buildRequestContext(c)
+	guarded, err := s.applyGuardrails(ctx, requested, body, extractForwardHeaders(c))
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(guarded, body) {
+		c.Request().SetBody(guarded)
+	}
+	return guarded, nil
+}
+
+// classifyPrompt asks the classifier model about a prompt and returns the categories of
+// the policy it breaks, none when it is allowed
+func (s *Server) classifyPrompt(ctx context.Context, cl *config.GuardrailClassifier, text string, headers map[string]string) ([]string, error) {
+	if cl.GetMode() == config.GuardrailModeModeration {
+		body, _ := json.Marshal(map[string]string{"model": cl.Model, "input": text})
+		resp, providerKey, err := s.executeWithFailoverFiber(ctx, cl.Model, body, headers, EndpointV1Moderations)
+		if err != nil {
+			return nil, err
+		}
+		s.recordSuccess(providerKey)
+		var modResp struct {
+			Results []moderationResult `json:"results"`
+		}
+		if err := json.Unmarshal(resp.([]byte), &modResp); err != nil {
+			return nil, fmt.Errorf("invalid moderation response: %w", err)
+		}
+		return trippedCategories(modResp.Results, cl.Thresholds), nil
+	}
+
+	prompt := cl.Prompt
+	if prompt == "" {
+		prompt = defaultClassifierPrompt
+	}
+	body, _ := json.Marshal(map[string]any{
+		"model": cl.Model,
+		"messages": []map[string]string{
+			{"role": "system", "content": prompt},
+			{"role": "user", "content": text},
+		},
+		"temperature": 0,
+		"max_tokens":  50,
+	})
+	resp, providerKey, err := s.executeWithFailoverFiber(ctx, cl.Model, body, headers, EndpointV1ChatCompletions)
+	if err != nil {
+		return nil, err
+	}
+	s.recordSuccess(providerKey)
+	var chatResp struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(resp.([]byte), &chatResp); err != nil || len(chatResp.Choices) == 0 {
+		return nil, fmt.Errorf("invalid classifier response")
+	}
+	return classifierVerdict(chatResp.Choices[0].Message.Content), nil
+}
+
+// classifierVerdict reads the answer of a chat classifier: "safe", or "unsafe" followed
+// by the categories broken, as Llama Guard answers
+func classifierVerdict(answer string) []string {
+	verdict, rest, _ := strings.Cut(strings.TrimSpace(answer), "\n")
+	if !strings.HasPrefix(strings.ToLower(strings.TrimSpace(verdict)), "unsafe") {
+		return nil
+	}
+	var categories []string
+	for _, category := range strings.FieldsFunc(rest, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if category = strings.TrimSpace(category); category != "" {
+			categories = append(categories, category)
+		}
+	}
+	if len(categories) == 0 {
+		return []string{"unsafe"}
+	}
+	return categories
+}
+
+// promptText joins the text a client sends in a chat or completion request: message
+// contents, the Anthropic system prompt and the legacy prompt
+func promptText(req map[string]any) string {
+	var parts []string
+	rewritePromptText(req, func(s string) string {
+		parts = append(parts, s)
+		return s
+	})
+	return strings.Join(parts, "\n")
+}
+
+// rewritePromptText replaces each piece of prompt text in a request by rewrite(text)
+func rewritePromptText(req map[string]any, rewrite func(string) string) {
+	rewriteText(req, "system", rewrite)
+	rewriteText(req, "prompt", rewrite)
+	messages, _ := req["messages"].([]any)
+	for _, msg := range messages {
+		if m, ok := msg.(map[string]any); ok {
+			rewriteText(m, "content", rewrite)
+		}
+	}
+}
+
+// rewriteText rewrites the text of a field holding a string, a list of strings or a list
+// of content blocks
+func rewriteText(m map[string]any, field string, rewrite func(string) string) {
+	switch v := m[field].(type) {
+	case string:
+		m[field] = rewrite(v)
+	case []any:
+		for i, item := range v {
+			switch item := item.(type) {
+			case string:
+				v[i] = rewrite(item)
+			case map[string]any:
+				if text, ok := item["text"].(string); ok {
+					item["text"] = rewrite(text)
+				}
+			}
+		}
+	}
+}
+
+// guardrailError answers a request turned away by the guardrails: 400 with a policy
+// violation error, in the Anthropic error format on the Anthropic endpoints, or 503 when
+// the prompt could not be checked
+func guardrailError(c *fiber.Ctx, group string, err error) error {
+	requestID, _ := c.Locals("request_id").(string)
+	var violation *guardrailViolation
+	if !errors.As(err, &violation) {
+		applogger.Warn("guardrail_rejected", "request_id", requestID, "error", err.Error())
+		if group == config.EndpointsAnthropic {
+			return handleAnthropicError(c, err.Error(), anthropicAPIError, fiber.StatusServiceUnavailable)
+		}
+		return handleError(c, err.Error(), fiber.StatusServiceUnavailable)
+	}
+
+	applogger.Warn("guardrail_violation", "request_id", requestID, "guardrail", violation.guardrail, "rule", violation.rule, "categories", violation.categories)
+	c.Set(HeaderXOpenModelGuardrail, violation.guardrail)
+	message := "request blocked by guardrails: " + violation.message
+	if group == config.EndpointsAnthropic {
+		return handleAnthropicError(c, message, anthropicInvalidRequestError, fiber.StatusBadRequest)
+	}
+	details := fiber.Map{
+		"message": message,
+		"type":    "policy_violation",
+		"param":   nil,
+		"code":    violation.guardrail,
+	}
+	if violation.rule != "" {
+		details["rule"] = violation.rule
+	}
+	if len(violation.categories) > 0 {
+		details["categories"] = violation.categories
+	}
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": details})
+}
@@ -0,0 +1,512 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"cmp"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/audit"
+	"github.com/macedot/openmodel/internal/config"
+	applogger "github.com/macedot/openmodel/internal/logger"
+	"github.com/macedot/openmodel/internal/state"
+)
+
+// Actions of POST /admin/backends/{backend}/{action}
+const (
+	backendActionDisable = "disable"
+	backendActionEnable  = "enable"
+	backendActionReset   = "reset"
+)
+
+// adminBackendWeight is one backend in a model's weight listing
+type adminBackendWeight struct {
+	Backend          string  `json:"backend"`
+	ConfiguredWeight int     `json:"configured_weight"`
+	Weight           int     `json:"weight"`
+	Percent          float64 `json:"percent"`
+}
+
+// adminWeights is the response of the model weights admin endpoints
+type adminWeights struct {
+	Model    string               `json:"model"`
+	Strategy string               `json:"strategy"`
+	Backends []adminBackendWeight `json:"backends"`
+}
+
+// handleAdminGetWeights handles GET /admin/weights/{model}
+func (s *Server) handleAdminGetWeights(c *fiber.Ctx) error {
+	model, modelCfg, status, err := s.adminModel(c)
+	if err != nil {
+		return handleError(c, err.Error(), status)
+	}
+	return c.JSON(s.modelWeights(model, modelCfg))
+}
+
+// handleAdminSetWeights handles PUT /admin/weights/{model}. The body maps backends
+// ("provider/model") to weights; backends left out keep their configured weight. Weights
+// are relative, so 95 and 5 send 95% and 5% of the traffic to each backend.
+func (s *Server) handleAdminSetWeights(c *fiber.Ctx) error {
+	model, modelCfg, status, err := s.adminModel(c)
+	if err != nil {
+		return handleError(c, err.Error(), status)
+	}
+	if config.NormalizeStrategy(modelCfg.Strategy) != config.StrategyWeighted {
+		return handleError(c, fmt.Sprintf("model %q does not use the weighted strategy", model), fiber.StatusConflict)
+	}
+
+	var req struct {
+		Weights map[string]int `json:"weights"`
+	}
+	if err := json.Unmarshal(c.Body(), &req); err != nil || len(req.Weights) == 0 {
+		return handleError(c, "body must be {\"weights\": {\"provider/model\": weight}}", fiber.StatusBadRequest)
+	}
+
+	backends := make(map[string]bool, len(modelCfg.Providers))
+	for _, p := range modelCfg.Providers {
+		backends[formatProviderKey(p)] = true
+	}
+	var errs []string
+	for backend, w := range req.Weights {
+		if !backends[backend] {
+			errs = append(errs, fmt.Sprintf("backend %q is not part of model %q", backend, model))
+		} else if w < 0 {
+			errs = append(errs, fmt.Sprintf("backend %q weight %d must not be negative", backend, w))
+		}
+	}
+	if len(errs) > 0 {
+		return handleError(c, strings.Join(errs, "; "), fiber.StatusBadRequest)
+	}
+
+	s.state.SetWeights(model, req.Weights)
+	weights := s.modelWeights(model, modelCfg)
+	applogger.Info("weights_updated", "model", model, "weights", req.Weights)
+	s.recordAudit(c, auditActorAdmin, audit.ActionWeightsSet, model, fmt.Sprint(req.Weights), nil)
+	return c.JSON(weights)
+}
+
+// handleAdminResetWeights handles DELETE /admin/weights/{model}, restoring configured weights
+func (s *Server) handleAdminResetWeights(c *fiber.Ctx) error {
+	model, modelCfg, status, err := s.adminModel(c)
+	if err != nil {
+		return handleError(c, err.Error(), status)
+	}
+	s.state.ClearWeights(model)
+	applogger.Info("weights_reset", "model", model)
+	s.recordAudit(c, auditActorAdmin, audit.ActionWeightsReset, model, "", nil)
+	return c.JSON(s.modelWeights(model, modelCfg))
+}
+
+// adminBackendTimeouts are the effective timeouts of a backend for one model using it
+type adminBackendTimeouts struct {
+	Model        string `json:"model"`
+	ConnectMs    int    `json:"connect_ms"`
+	FirstTokenMs int    `json:"first_token_ms"`
+	TotalMs      int    `json:"total_ms"`
+}
+
+// adminBackend is one backend in the backend listing
+type adminBackend struct {
+	Backend         string                 `json:"backend"`
+	Provider        string                 `json:"provider"`
+	Circuit         string                 `json:"circuit"`
+	Failures        int                    `json:"failures"`
+	RetryAfterMs    int64                  `json:"retry_after_ms,omitempty"` // Until the next probe when the circuit is open
+	HealthCheckDown bool                   `json:"health_check_down"`
+	Disabled        bool                   `json:"disabled"`
+	InFlight        int                    `json:"in_flight"`
+	Timeouts        []adminBackendTimeouts `json:"timeouts"`
+}
+
+// handleAdminBackends handles GET /admin/backends, listing each backend with its circuit
+// breaker and health check state, requests in flight and timeouts
+func (s *Server) handleAdminBackends(c *fiber.Ctx) error {
+	if status, err := s.authorizeAdmin(c); err != nil {
+		return handleError(c, err.Error(), status)
+	}
+	backends := s.adminBackends()
+	list := make([]adminBackend, 0, len(backends))
+	for _, b := range backends {
+		list = append(list, b)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Backend < list[j].Backend })
+	return c.JSON(fiber.Map{
+		"in_flight": s.drain.status().InFlight,
+		"backends":  list,
+	})
+}
+
+// handleAdminBackendAction handles POST /admin/backends/{backend}/{action}: disable takes
+// the backend out of rotation until enabled again, enable puts it back and reset forgets
+// its failures, closing its circuit. It responds with the backend's new state.
+func (s *Server) handleAdminBackendAction(c *fiber.Ctx) error {
+	if status, err := s.authorizeAdmin(c); err != nil {
+		return handleError(c, err.Error(), status)
+	}
+	path, err := url.PathUnescape(c.Params("*"))
+	if err != nil {
+		return handleError(c, "invalid backend id", fiber.StatusBadRequest)
+	}
+	key, action, _ := cutLast(path, "/")
+	if _, exists := s.adminBackends()[key]; !exists {
+		return handleError(c, fmt.Sprintf("backend %q not found", key), fiber.StatusNotFound)
+	}
+
+	switch action {
+	case backendActionDisable:
+		s.state.SetEnabled(key, false)
+	case backendActionEnable:
+		s.state.SetEnabled(key, true)
+	case backendActionReset:
+		s.state.ResetModel(key)
+		s.backendUp(key)
+	default:
+		return handleError(c, fmt.Sprintf("unknown action %q: use disable, enable or reset", action), fiber.StatusNotFound)
+	}
+	applogger.Info("backend_"+action, "backend", key)
+	s.recordAudit(c, auditActorAdmin, "backend."+action, key, "", nil)
+	return c.JSON(s.adminBackends()[key])
+}
+
+// adminBackends reports the state of every backend of the configured models, by backend
+func (s *Server) adminBackends() map[string]adminBackend {
+	cfg := s.GetConfig()
+	models := make([]string, 0, len(cfg.Models))
+	for model := range cfg.Models {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+
+	backends := make(map[string]adminBackend)
+	for _, model := range models {
+		modelCfg := cfg.Models[model]
+		for _, p := range modelCfg.Providers {
+			key := formatProviderKey(p)
+			b, seen := backends[key]
+			if !seen {
+				b = adminBackend{
+					Backend:         key,
+					Provider:        p.Provider,
+					Circuit:         s.state.Circuit(key),
+					Failures:        s.state.Failures(key),
+					HealthCheckDown: s.healthMarked(key),
+					Disabled:        !s.state.Enabled(key),
+					InFlight:        s.state.InFlight(key),
+					Timeouts:        []adminBackendTimeouts{},
+				}
+				if b.Circuit != state.CircuitClosed {
+					if wait, ok := s.state.RetryAfter(key); ok {
+						b.RetryAfterMs = wait.Milliseconds()
+					}
+				}
+			}
+			t := modelCfg.BackendTimeouts(p)
+			b.Timeouts = append(b.Timeouts, adminBackendTimeouts{
+				Model:        model,
+				ConnectMs:    int(t.GetConnect().Milliseconds()),
+				FirstTokenMs: int(t.GetFirstToken().Milliseconds()),
+				TotalMs:      int(t.GetTotal().Milliseconds()),
+			})
+			backends[key] = b
+		}
+	}
+	return backends
+}
+
+// adminErrorRate is a backend's rolling sample under the error-rate policy
+type adminErrorRate struct {
+	Requests     int     `json:"requests"`
+	Failed       int     `json:"failed"`
+	LimitPercent float64 `json:"limit_percent"` // Failure share above which the circuit opens
+}
+
+// adminBackendState is one backend's circuit breaker state in /admin/state
+type adminBackendState struct {
+	Backend           string          `json:"backend"`
+	Circuit           string          `json:"circuit"`
+	Available         bool            `json:"available"` // Circuit closed and below the failure threshold
+	Failures          int             `json:"failures"`
+	Threshold         int             `json:"threshold,omitempty"` // Failures that open the circuit, unless error_rate is set
+	ErrorRate         *adminErrorRate `json:"error_rate,omitempty"`
+	LastFailure       *time.Time      `json:"last_failure,omitempty"`
+	OpenedAt          *time.Time      `json:"opened_at,omitempty"`
+	CooldownMs        int64           `json:"cooldown_ms,omitempty"`         // Current progressive cooldown
+	CooldownExpiresAt *time.Time      `json:"cooldown_expires_at,omitempty"` // Absent when it does not recover on its own
+	Probing           bool            `json:"probing,omitempty"`             // A half-open probe is in flight
+}
+
+// adminRouteBackend is a backend in a model's chain and whether routing would use it
+type adminRouteBackend struct {
+	Backend  string `json:"backend"`
+	Routable bool   `json:"routable"`
+	Reason   string `json:"reason,omitempty"` // Why routing passes it over
+}
+
+// adminRouteState is a model's backend chain in /admin/state, in configured order
+type adminRouteState struct {
+	Model    string              `json:"model"`
+	Strategy string              `json:"strategy"`
+	Backends []adminRouteBackend `json:"backends"`
+}
+
+// handleAdminState handles GET /admin/state, reporting each backend's failure count,
+// availability, current cooldown and when it ends, and for each model which of its
+// backends routing would consider and why it passes the others over
+func (s *Server) handleAdminState(c *fiber.Ctx) error {
+	if status, err := s.authorizeAdmin(c); err != nil {
+		return handleError(c, err.Error(), status)
+	}
+	cfg := s.GetConfig()
+	models := make([]string, 0, len(cfg.Models))
+	for model := range cfg.Models {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+
+	backends := []adminBackendState{}
+	routes := make([]adminRouteState, 0, len(models))
+	seen := make(map[string]bool)
+	for _, model := range models {
+		modelCfg := cfg.Models[model]
+		for _, p := range modelCfg.Providers {
+			if key := formatProviderKey(p); !seen[key] {
+				seen[key] = true
+				backends = append(backends, s.backendState(key))
+			}
+		}
+		routes = append(routes, adminRouteState{
+			Model:    model,
+			Strategy: config.NormalizeStrategy(modelCfg.Strategy),
+			Backends: s.routeState(modelCfg.Providers),
+		})
+	}
+	sort.Slice(backends, func(i, j int) bool { return backends[i].Backend < backends[j].Backend })
+	return c.JSON(fiber.Map{"backends": backends, "models": routes})
+}
+
+// backendState reports a backend's circuit breaker state
+func (s *Server) backendState(key string) adminBackendState {
+	snap := s.state.Snapshot(key)
+	policy := s.breakerPolicy(key)
+	b := adminBackendState{
+		Backend:   key,
+		Circuit:   snap.Circuit,
+		Available: snap.Circuit == state.CircuitClosed && (policy.ErrorRate > 0 || snap.Failures < policy.Threshold),
+		Failures:  snap.Failures,
+		Probing:   snap.Probing,
+	}
+	if policy.ErrorRate > 0 {
+		b.ErrorRate = &adminErrorRate{Requests: snap.Requests, Failed: snap.FailedRequests, LimitPercent: 100 * policy.ErrorRate}
+	} else {
+		b.Threshold = policy.Threshold
+	}
+	if !snap.LastFailure.IsZero() {
+		b.LastFailure = &snap.LastFailure
+	}
+	if !snap.OpenedAt.IsZero() {
+		b.OpenedAt = &snap.OpenedAt
+		if snap.Cooldown > 0 {
+			b.CooldownMs = snap.Cooldown.Milliseconds()
+			expires := snap.OpenedAt.Add(snap.Cooldown)
+			b.CooldownExpiresAt = &expires
+		}
+	}
+	return b
+}
+
+// routeState reports which backends of a chain routing would consider for a request
+// without required capabilities, without probing any
+func (s *Server) routeState(providers []config.ModelProvider) []adminRouteBackend {
+	// Breaker policies read the config, so circuits are looked at before locking
+	circuits := make([]string, len(providers))
+	for i, p := range providers {
+		key := formatProviderKey(p)
+		snap, policy := s.state.Snapshot(key), s.breakerPolicy(key)
+		switch {
+		case snap.Circuit == state.CircuitOpen:
+			circuits[i] = skipCircuitOpen
+		case snap.Circuit == state.CircuitHalfOpen && snap.Probing:
+			circuits[i] = skipProbing
+		case snap.Circuit == state.CircuitClosed && policy.ErrorRate == 0 && snap.Failures >= policy.Threshold:
+			circuits[i] = skipCircuitOpen
+		}
+	}
+
+	s.providersMu.RLock()
+	defer s.providersMu.RUnlock()
+	result := make([]adminRouteBackend, 0, len(providers))
+	for i, p := range providers {
+		reason := cmp.Or(s.routingSkipReason(p, nil), circuits[i])
+		if _, exists := s.providers[p.Provider]; reason == "" && !exists {
+			reason = skipNotLoaded
+		}
+		result = append(result, adminRouteBackend{Backend: formatProviderKey(p), Routable: reason == "", Reason: reason})
+	}
+	return result
+}
+
+// cutLast slices s around the last instance of sep
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// handleAdminSpend handles GET /admin/spend, listing provider spend against budgets and
+// the running spend of all requests, each backend and each API key
+func (s *Server) handleAdminSpend(c *fiber.Ctx) error {
+	if status, err := s.authorizeAdmin(c); err != nil {
+		return handleError(c, err.Error(), status)
+	}
+	total, backends, keys := s.costReport()
+	return c.JSON(fiber.Map{
+		"providers": s.spendReport(),
+		"total":     fiber.Map{"daily": total.Daily, "monthly": total.Monthly},
+		"backends":  backends,
+		"keys":      keys,
+	})
+}
+
+// handleAdminDrain handles GET /admin/drain, reporting the drain state
+func (s *Server) handleAdminDrain(c *fiber.Ctx) error {
+	if status, err := s.authorizeAdmin(c); err != nil {
+		return handleError(c, err.Error(), status)
+	}
+	return c.JSON(s.drain.status())
+}
+
+// handleAdminStartDrain handles POST /admin/drain. New requests get 503 while requests in
+// flight may finish until the deadline: {"timeout_ms": N} or the server drain_timeout_ms.
+func (s *Server) handleAdminStartDrain(c *fiber.Ctx) error {
+	if status, err := s.authorizeAdmin(c); err != nil {
+		return handleError(c, err.Error(), status)
+	}
+	timeout := s.GetConfig().Server.GetDrainTimeout()
+	if len(c.Body()) > 0 {
+		var req struct {
+			TimeoutMs int `json:"timeout_ms"`
+		}
+		if err := json.Unmarshal(c.Body(), &req); err != nil || req.TimeoutMs < 0 {
+			return handleError(c, "body must be {\"timeout_ms\": N} with N >= 0", fiber.StatusBadRequest)
+		}
+		if req.TimeoutMs > 0 {
+			timeout = time.Duration(req.TimeoutMs) * time.Millisecond
+		}
+	}
+	deadline, _ := s.drain.start(timeout, false)
+	applogger.Info("drain_started", "deadline", deadline, "in_flight", s.drain.status().InFlight)
+	s.recordAudit(c, auditActorAdmin, audit.ActionDrainStart, "", "timeout "+timeout.String(), nil)
+	return c.JSON(s.drain.status())
+}
+
+// handleAdminResumeDrain handles DELETE /admin/drain, accepting new requests again
+func (s *Server) handleAdminResumeDrain(c *fiber.Ctx) error {
+	if status, err := s.authorizeAdmin(c); err != nil {
+		return handleError(c, err.Error(), status)
+	}
+	if !s.drain.resume() {
+		return handleError(c, "server is shutting down", fiber.StatusConflict)
+	}
+	applogger.Info("drain_resumed")
+	s.recordAudit(c, auditActorAdmin, audit.ActionDrainResume, "", "", nil)
+	return c.JSON(s.drain.status())
+}
+
+// handleAdminReload handles POST /admin/reload, re-reading and validating the config file
+// and swapping it in. It responds with what changed; an invalid file changes nothing.
+func (s *Server) handleAdminReload(c *fiber.Ctx) error {
+	if status, err := s.authorizeAdmin(c); err != nil {
+		return handleError(c, err.Error(), status)
+	}
+	diff, err := s.ReloadFromFile()
+	s.metrics.observeConfigReload(err)
+	if err != nil {
+		applogger.Error("config_reload_failed", "source", "admin", "error", err)
+		s.recordAudit(c, auditActorAdmin, audit.ActionConfigReload, "", "", err)
+		return handleError(c, err.Error(), fiber.StatusUnprocessableEntity)
+	}
+	s.recordAudit(c, auditActorAdmin, audit.ActionConfigReload, "", diff.String(), nil)
+	return c.JSON(diff)
+}
+
+// handleAdminConfig handles GET /admin/config, returning the effective config with
+// secrets redacted
+func (s *Server) handleAdminConfig(c *fiber.Ctx) error {
+	if status, err := s.authorizeAdmin(c); err != nil {
+		return handleError(c, err.Error(), status)
+	}
+	redacted, err := s.GetConfig().Redacted()
+	if err != nil {
+		return handleError(c, err.Error(), fiber.StatusInternalServerError)
+	}
+	return c.JSON(redacted)
+}
+
+// authorizeAdmin checks that the admin API is enabled and the request carries its token,
+// returning the status to respond with on failure
+func (s *Server) authorizeAdmin(c *fiber.Ctx) (int, error) {
+	cfg := s.GetConfig()
+	if !cfg.Admin.IsEnabled() {
+		return fiber.StatusForbidden, fmt.Errorf("admin API is disabled")
+	}
+	token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Admin.GetToken())) != 1 {
+		err := fmt.Errorf("invalid admin token")
+		s.recordAudit(c, auditActorAdmin, audit.ActionAuthFailure, c.Path(), "", err)
+		return fiber.StatusUnauthorized, err
+	}
+	return 0, nil
+}
+
+// adminModel authorizes an admin request and looks up the model named in its path,
+// returning the status to respond with on failure
+func (s *Server) adminModel(c *fiber.Ctx) (string, config.ModelConfig, int, error) {
+	if status, err := s.authorizeAdmin(c); err != nil {
+		return "", config.ModelConfig{}, status, err
+	}
+
+	cfg := s.GetConfig()
+	model, err := url.PathUnescape(c.Params("*"))
+	if err != nil || model == "" {
+		return "", config.ModelConfig{}, fiber.StatusBadRequest, fmt.Errorf("invalid model id")
+	}
+	modelCfg, exists := cfg.Models[model]
+	if !exists {
+		return "", config.ModelConfig{}, fiber.StatusNotFound, fmt.Errorf("model %q not found", model)
+	}
+	return model, modelCfg, 0, nil
+}
+
+// modelWeights lists the configured and effective weight of each backend of a model
+func (s *Server) modelWeights(model string, modelCfg config.ModelConfig) adminWeights {
+	overrides := s.state.Weights(model)
+	result := adminWeights{
+		Model:    model,
+		Strategy: config.NormalizeStrategy(modelCfg.Strategy),
+		Backends: make([]adminBackendWeight, 0, len(modelCfg.Providers)),
+	}
+
+	total := 0
+	for _, p := range modelCfg.Providers {
+		key := formatProviderKey(p)
+		w := p.GetWeight()
+		if override, ok := overrides[key]; ok {
+			w = override
+		}
+		total += w
+		result.Backends = append(result.Backends, adminBackendWeight{Backend: key, ConfiguredWeight: p.GetWeight(), Weight: w})
+	}
+	if total > 0 {
+		for i := range result.Backends {
+			result.Backends[i].Percent = 100 * float64(result.Backends[i].Weight) / float64(total)
+		}
+	}
+	return result
+}
@@ -0,0 +1,166 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+
+	"github.com/gofiber/fiber/v2"
+	applogger "github.com/macedot/openmodel/internal/logger"
+	"github.com/macedot/openmodel/internal/provider"
+)
+
+// handleV1AudioTranscriptions handles POST /v1/audio/transcriptions (multipart upload)
+func (s *Server) handleV1AudioTranscriptions(c *fiber.Ctx) error {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return handleError(c, "invalid multipart form: "+err.Error(), fiber.StatusBadRequest)
+	}
+
+	model := ""
+	if values := form.Value["model"]; len(values) > 0 {
+		model = values[0]
+	}
+	if model == "" {
+		return handleError(c, "model is required", fiber.StatusBadRequest)
+	}
+	if len(form.File["file"]) == 0 {
+		return handleError(c, "file is required", fiber.StatusBadRequest)
+	}
+
+	return s.forwardAudioRequest(c, model, EndpointV1AudioTranscript, func(providerModel string) ([]byte, string, error) {
+		return buildMultipartBody(form, providerModel)
+	})
+}
+
+// handleV1AudioSpeech handles POST /v1/audio/speech (JSON request, audio response)
+func (s *Server) handleV1AudioSpeech(c *fiber.Ctx) error {
+	body := c.Body()
+
+	model := extractModelFromRequestBody(body)
+	if model == "" {
+		return handleError(c, "model is required", fiber.StatusBadRequest)
+	}
+
+	return s.forwardAudioRequest(c, model, EndpointV1AudioSpeech, func(providerModel string) ([]byte, string, error) {
+		return replaceModelInBody(body, providerModel), ContentTypeJSON, nil
+	})
+}
+
+// forwardAudioRequest sends an audio request to the audio-capable providers of a model with failover.
+// buildBody renders the request body (and its content type) for the selected provider model.
+func (s *Server) forwardAudioRequest(c *fiber.Ctx, model, endpoint string, buildBody func(providerModel string) ([]byte, string, error)) error {
+	if err := s.authorizeModel(c.UserContext(), requestHeader(c), model); err != nil {
+		return handleError(c, err.Error(), fiber.StatusForbidden)
+	}
+	model, err := s.resolveModel(c.UserContext(), model)
+	if err != nil {
+		return handleError(c, err.Error(), fiber.StatusNotFound)
+	}
+
+	ctx, requestID := buildRequestContext(c)
+	forwardHeaders := extractForwardHeaders(c)
+
+	attemptedProviders := 0
+	for {
+		prov, providerKey, providerModel, err := s.findAudioProviderWithFailover(ctx, model)
+		if err != nil {
+			if attemptedProviders > 0 {
+				s.handleAllProvidersFailedFiber(c, model, fmt.Errorf("model %q temporarily unavailable: all providers failed", model))
+				return nil
+			}
+			return handleError(c, err.Error(), fiber.StatusNotFound)
+		}
+		attemptedProviders++
+
+		requester, ok := prov.(provider.BinaryRequester)
+		if !ok {
+			return handleError(c, fmt.Sprintf("provider %q does not support audio requests", prov.Name()), fiber.StatusNotImplemented)
+		}
+
+		applogger.Debug("ROUTING", "request_id", requestID, "provider", providerKey, "model", providerModel, "endpoint", endpoint)
+
+		body, contentType, err := buildBody(providerModel)
+		if err != nil {
+			return handleError(c, "failed to build request: "+err.Error(), fiber.StatusBadRequest)
+		}
+		if contentType == ContentTypeJSON {
+			body = s.rewriteOptions(model, providerKey, body)
+		}
+
+		var resp []byte
+		var respContentType string
+		err = s.callProvider(ctx, model, providerKey, func(ctx context.Context) (err error) {
+			resp, respContentType, err = requester.DoBinaryRequest(ctx, endpoint, contentType, body, forwardHeaders)
+			return err
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return handleError(c, "request cancelled", statusClientClosedRequest)
+			}
+			s.handleProviderError(ctx, providerKey, err)
+			if status, body, ok := clientErrorOf(err); ok {
+				return relayClientError(c, status, body)
+			}
+			continue
+		}
+
+		s.recordSuccess(providerKey)
+		if respContentType != "" {
+			c.Set(HeaderContentType, respContentType)
+		}
+		return c.Send(resp)
+	}
+}
+
+// buildMultipartBody re-encodes a parsed multipart form with the model field set to providerModel
+func buildMultipartBody(form *multipart.Form, providerModel string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	for name, values := range form.Value {
+		if name == "model" {
+			values = []string{providerModel}
+		}
+		for _, value := range values {
+			if err := writer.WriteField(name, value); err != nil {
+				return nil, "", fmt.Errorf("write field %q: %w", name, err)
+			}
+		}
+	}
+
+	for name, files := range form.File {
+		for _, fh := range files {
+			header := make(textproto.MIMEHeader)
+			header.Set("Content-Disposition", multipart.FileContentDisposition(name, fh.Filename))
+			if ct := fh.Header.Get("Content-Type"); ct != "" {
+				header.Set("Content-Type", ct)
+			} else {
+				header.Set("Content-Type", "application/octet-stream")
+			}
+
+			part, err := writer.CreatePart(header)
+			if err != nil {
+				return nil, "", fmt.Errorf("create part %q: %w", name, err)
+			}
+			src, err := fh.Open()
+			if err != nil {
+				return nil, "", fmt.Errorf("open upload %q: %w", fh.Filename, err)
+			}
+			_, err = io.Copy(part, src)
+			src.Close()
+			if err != nil {
+				return nil, "", fmt.Errorf("copy upload %q: %w", fh.Filename, err)
+			}
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, "", fmt.Errorf("close multipart writer: %w", err)
+	}
+	return buf.Bytes(), writer.FormDataContentType(), nil
+}
@@ -2,9 +2,15 @@
 package server
 
 import (
+	"context"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/api/anthropic"
+	"github.com/macedot/openmodel/internal/config"
 	applogger "github.com/macedot/openmodel/internal/logger"
 	"github.com/macedot/openmodel/internal/server/converters"
 )
@@ -14,44 +20,69 @@ func (s *Server) handleV1Messages(c *fiber.Ctx) error {
 	// Validate required headers (anthropic-version is required)
 	anthropicVersion := c.Get(HeaderAnthropicVersion)
 	if anthropicVersion == "" {
-		return handleError(c, "anthropic-version header is required", fiber.StatusBadRequest)
+		return handleAnthropicError(c, "anthropic-version header is required", anthropicInvalidRequestError, fiber.StatusBadRequest)
 	}
 
 	// Read request body
 	body := c.Body()
 
+	// Validate request shape (model, messages, roles, max_tokens)
+	if err := anthropic.ValidateMessagesRequest(body); err != nil {
+		return handleAnthropicError(c, err.Error(), anthropicInvalidRequestError, fiber.StatusBadRequest)
+	}
+
 	// Extract model name from request body
 	model := extractModelFromRequestBody(body)
 	if model == "" {
-		return handleError(c, "model is required", fiber.StatusBadRequest)
+		return handleAnthropicError(c, "model is required", anthropicInvalidRequestError, fiber.StatusBadRequest)
 	}
 
 	// Check if model exists in config
-	if err := s.validateModel(model); err != nil {
-		c.Set("Content-Type", "application/json")
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"type": "error",
-			"error": fiber.Map{
-				"type":    "invalid_request_error",
-				"message": "model not found",
-			},
-		})
+	requested := model
+	if err := s.authorizeModel(c.UserContext(), requestHeader(c), requested); err != nil {
+		return handleAnthropicError(c, err.Error(), anthropicPermissionError, fiber.StatusForbidden)
+	}
+	model, err := s.resolveModel(c.UserContext(), model)
+	if err != nil {
+		return handleAnthropicError(c, "model not found", anthropicNotFoundError, fiber.StatusNotFound)
 	}
+	body, err = s.guardPrompt(c, requested, body)
+	if err != nil {
+		return guardrailError(c, config.EndpointsAnthropic, err)
+	}
+	model = s.applyRoutingRules(requested, model, body, requestHeader(c))
+	model, experiment := s.assignExperiment(model, body)
+	tagExperiment(func(key, value string) { c.Set(key, value) }, experiment)
 
 	ctx, requestID := buildRequestContext(c)
+	ctx = withExperiment(ctx, experiment)
+	ctx = s.withStickyKey(ctx, model, body, requestHeader(c))
+	ctx = withRequiredCapabilities(ctx, requestCapabilities(body))
+	ctx = withUsageAttribution(ctx, model, requestHeader(c))
+
+	ctx, ticket, err := s.admit(ctx, model, requestHeader(c))
+	if err != nil {
+		c.Set("Retry-After", strconv.Itoa(s.admissionRetryAfter(model)))
+		return handleAnthropicError(c, err.Error(), anthropicRateLimitError, fiber.StatusTooManyRequests)
+	}
+	defer ticket.done()
+
+	if categories := s.preflightModeration(ctx, body, map[string]string{}); s.applyModerationVerdict(c, categories) {
+		return handleAnthropicError(c, "request blocked by moderation: "+strings.Join(categories, ", "), anthropicInvalidRequestError, fiber.StatusBadRequest)
+	}
 
 	isStreaming := isStreamingRequest(body)
 
 	attemptedProviders := 0
 	for {
 		// Find provider first to determine api_mode
-		prov, providerKey, providerModel, err := s.findProviderWithFailover(model, "")
+		prov, providerKey, providerModel, err := s.findProviderWithFailover(ctx, model)
 		if err != nil {
 			if attemptedProviders > 0 {
-				s.handleAllProvidersFailedFiber(c, fmt.Errorf("model %q temporarily unavailable: all providers failed", model))
+				s.handleAllProvidersFailedFiber(c, model, fmt.Errorf("model %q temporarily unavailable: all providers failed", model))
 				return nil
 			}
-			return handleError(c, err.Error(), fiber.StatusNotFound)
+			return handleAnthropicError(c, err.Error(), anthropicNotFoundError, fiber.StatusNotFound)
 		}
 		attemptedProviders++
 
@@ -60,7 +91,7 @@ func (s *Server) handleV1Messages(c *fiber.Ctx) error {
 
 		plan, err := buildRoutingPlan(converters.APIFormatAnthropic, EndpointV1Messages, prov.APIMode())
 		if err != nil {
-			return handleError(c, err.Error(), fiber.StatusInternalServerError)
+			return handleAnthropicError(c, err.Error(), anthropicAPIError, fiber.StatusInternalServerError)
 		}
 
 		// Build headers for Claude API
@@ -74,41 +105,90 @@ func (s *Server) handleV1Messages(c *fiber.Ctx) error {
 
 		forwardBody, attemptHeaders, err := prepareForwardRequest(body, forwardHeaders, providerModel, plan)
 		if err != nil {
-			return handleError(c, "failed to convert request: "+err.Error(), fiber.StatusBadRequest)
+			return handleAnthropicError(c, "failed to convert request: "+err.Error(), anthropicInvalidRequestError, fiber.StatusBadRequest)
 		}
 
 		if isStreaming {
-			return s.streamWithFailover(c, model, forwardBody, attemptHeaders, ctx, converters.APIFormatAnthropic, plan.targetFormat)
+			return s.streamWithFailover(c, model, EndpointV1Messages, forwardBody, attemptHeaders, ctx, converters.APIFormatAnthropic, plan.targetFormat, false)
 		}
+		forwardBody = s.rewriteOptions(model, providerKey, forwardBody)
 
-		resp, err := prov.DoRequest(ctx, plan.forwardEndpoint, forwardBody, attemptHeaders)
+		start := time.Now()
+		var resp []byte
+		err = s.callProvider(ctx, model, providerKey, func(ctx context.Context) (err error) {
+			resp, err = prov.DoRequest(ctx, plan.forwardEndpoint, forwardBody, attemptHeaders)
+			return err
+		})
 		if err != nil {
-			threshold := s.GetConfig().GetThresholds(providerKey).FailuresBeforeSwitch
-			s.handleProviderError(providerKey, err, threshold)
+			if ctx.Err() != nil {
+				return handleError(c, "request cancelled", statusClientClosedRequest)
+			}
+			s.handleProviderError(ctx, providerKey, err)
+			if status, body, ok := clientErrorOf(err); ok {
+				if plan.converter != nil {
+					return handleAnthropicError(c, err.Error(), anthropicInvalidRequestError, status)
+				}
+				return relayClientError(c, status, body)
+			}
 			continue
 		}
 
+		// Store provider in context for logging
+		c.Locals("provider", providerKey)
+		c.Locals("model", model)
+
+		s.recordUsage(ctx, providerKey, responseUsage(resp))
+
 		var finalResp []byte
 		if plan.converter != nil {
 			finalResp, err = plan.converter.ConvertResponse(resp)
 			if err != nil {
-				return handleError(c, "failed to convert response", fiber.StatusInternalServerError)
+				return handleAnthropicError(c, "failed to convert response", anthropicAPIError, fiber.StatusInternalServerError)
 			}
 		} else {
 			finalResp = resp
 		}
 
 		// Response is in Claude format
-		s.state.ResetModel(providerKey)
+		s.recordSuccess(providerKey)
+		s.mirrorRequest(ctx, model, converters.APIFormatAnthropic, EndpointV1Messages, body, forwardHeaders,
+			mirrorPrimary{providerKey: providerKey, latency: time.Since(start), response: finalResp})
 		c.Set("Content-Type", "application/json")
 		return c.Send(finalResp)
 	}
 }
 
-// validateModel checks if a model exists in the configuration
-func (s *Server) validateModel(model string) error {
-	if _, exists := s.GetConfig().Models[model]; !exists {
-		return fmt.Errorf("model %q not found", model)
+// Anthropic error types used in error responses on the Messages API surface
+const (
+	anthropicInvalidRequestError = "invalid_request_error"
+	anthropicNotFoundError       = "not_found_error"
+	anthropicAPIError            = "api_error"
+	anthropicRateLimitError      = "rate_limit_error"
+)
+
+// handleAnthropicError writes an error response in the Anthropic Messages API format
+func handleAnthropicError(c *fiber.Ctx, message, errType string, statusCode int) error {
+	return c.Status(statusCode).JSON(fiber.Map{
+		"type": "error",
+		"error": fiber.Map{
+			"type":    errType,
+			"message": message,
+		},
+	})
+}
+
+// resolveModel returns the configured model that serves a requested name: the one the
+// chains of the request's tenant map it to, or else the model itself or the wildcard
+// entry (e.g. "gpt-*" or a catch-all "*") that matches it
+func (s *Server) resolveModel(ctx context.Context, model string) (string, error) {
+	if tenant, ok := tenantFromContext(ctx); ok {
+		if chain, ok := tenant.Chain(model); ok {
+			return chain, nil
+		}
+	}
+	resolved, ok := s.GetConfig().ResolveModel(model)
+	if !ok {
+		return "", fmt.Errorf("model %q not found", model)
 	}
-	return nil
+	return resolved, nil
 }
@@ -0,0 +1,117 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"errors"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+)
+
+// pprofHandlers serve the pprof endpoints that are not named profiles
+var pprofHandlers = map[string]fiber.Handler{
+	"":        adaptor.HTTPHandlerFunc(pprof.Index),
+	"cmdline": adaptor.HTTPHandlerFunc(pprof.Cmdline),
+	"profile": adaptor.HTTPHandlerFunc(pprof.Profile),
+	"symbol":  adaptor.HTTPHandlerFunc(pprof.Symbol),
+	"trace":   adaptor.HTTPHandlerFunc(pprof.Trace),
+}
+
+// authorizeDebug authorizes an admin request for a debug endpoint, which are hidden
+// unless admin.debug is set
+func (s *Server) authorizeDebug(c *fiber.Ctx) (int, error) {
+	if status, err := s.authorizeAdmin(c); err != nil {
+		return status, err
+	}
+	if !s.GetConfig().Admin.IsDebugEnabled() {
+		return fiber.StatusNotFound, errors.New("not found")
+	}
+	return 0, nil
+}
+
+// handleAdminPprof handles GET and POST /admin/debug/pprof/*: the pprof index, CPU
+// profile, execution trace and named profiles such as heap and goroutine
+func (s *Server) handleAdminPprof(c *fiber.Ctx) error {
+	if status, err := s.authorizeDebug(c); err != nil {
+		return handleError(c, err.Error(), status)
+	}
+	name := c.Params("*")
+	if handler, ok := pprofHandlers[name]; ok {
+		return handler(c)
+	}
+	return adaptor.HTTPHandler(pprof.Handler(name))(c)
+}
+
+// adminRuntime is the Go runtime's state reported by /admin/debug/runtime
+type adminRuntime struct {
+	GoVersion  string             `json:"go_version"`
+	NumCPU     int                `json:"num_cpu"`
+	GOMAXPROCS int                `json:"gomaxprocs"`
+	Goroutines int                `json:"goroutines"`
+	Memory     adminRuntimeMemory `json:"memory"`
+	GC         adminRuntimeGC     `json:"gc"`
+}
+
+// adminRuntimeMemory is the memory allocated by the process, in bytes
+type adminRuntimeMemory struct {
+	Sys          uint64 `json:"sys"`           // Obtained from the OS
+	HeapAlloc    uint64 `json:"heap_alloc"`    // Live heap objects
+	HeapInuse    uint64 `json:"heap_inuse"`    // Heap spans in use
+	HeapIdle     uint64 `json:"heap_idle"`     // Heap spans unused, released or not
+	HeapReleased uint64 `json:"heap_released"` // Returned to the OS
+	HeapObjects  uint64 `json:"heap_objects"`
+	StackInuse   uint64 `json:"stack_inuse"`
+	TotalAlloc   uint64 `json:"total_alloc"` // Allocated since the start, freed or not
+	Mallocs      uint64 `json:"mallocs"`
+	Frees        uint64 `json:"frees"`
+}
+
+// adminRuntimeGC is the garbage collector's activity since the start
+type adminRuntimeGC struct {
+	NumGC        uint32     `json:"num_gc"`
+	PauseTotalMs float64    `json:"pause_total_ms"`
+	LastGC       *time.Time `json:"last_gc,omitempty"`
+	NextGC       uint64     `json:"next_gc"` // Heap size the next collection starts at
+	CPUFraction  float64    `json:"cpu_fraction"`
+}
+
+// handleAdminRuntime handles GET /admin/debug/runtime
+func (s *Server) handleAdminRuntime(c *fiber.Ctx) error {
+	if status, err := s.authorizeDebug(c); err != nil {
+		return handleError(c, err.Error(), status)
+	}
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	report := adminRuntime{
+		GoVersion:  runtime.Version(),
+		NumCPU:     runtime.NumCPU(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		Goroutines: runtime.NumGoroutine(),
+		Memory: adminRuntimeMemory{
+			Sys:          m.Sys,
+			HeapAlloc:    m.HeapAlloc,
+			HeapInuse:    m.HeapInuse,
+			HeapIdle:     m.HeapIdle,
+			HeapReleased: m.HeapReleased,
+			HeapObjects:  m.HeapObjects,
+			StackInuse:   m.StackInuse,
+			TotalAlloc:   m.TotalAlloc,
+			Mallocs:      m.Mallocs,
+			Frees:        m.Frees,
+		},
+		GC: adminRuntimeGC{
+			NumGC:        m.NumGC,
+			PauseTotalMs: float64(m.PauseTotalNs) / float64(time.Millisecond),
+			NextGC:       m.NextGC,
+			CPUFraction:  m.GCCPUFraction,
+		},
+	}
+	if m.LastGC != 0 {
+		last := time.Unix(0, int64(m.LastGC)).UTC()
+		report.GC.LastGC = &last
+	}
+	return c.JSON(report)
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/endpoints"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminDebug(t *testing.T) {
+	tests := []struct {
+		name       string
+		admin      *config.AdminConfig
+		path       string
+		token      string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "debug disabled", admin: &config.AdminConfig{Enabled: true, Token: "s3cret"}, path: endpoints.AdminRuntime, token: "s3cret", wantStatus: fiber.StatusNotFound},
+		{name: "admin disabled", admin: &config.AdminConfig{Token: "s3cret", Debug: true}, path: endpoints.AdminRuntime, token: "s3cret", wantStatus: fiber.StatusForbidden},
+		{name: "bad token", admin: &config.AdminConfig{Enabled: true, Token: "s3cret", Debug: true}, path: endpoints.AdminPprof + "/heap", token: "wrong", wantStatus: fiber.StatusUnauthorized},
+		{name: "runtime", admin: &config.AdminConfig{Enabled: true, Token: "s3cret", Debug: true}, path: endpoints.AdminRuntime, token: "s3cret", wantStatus: fiber.StatusOK, wantBody: `"goroutines"`},
+		{name: "pprof index", admin: &config.AdminConfig{Enabled: true, Token: "s3cret", Debug: true}, path: endpoints.AdminPprof + "/", token: "s3cret", wantStatus: fiber.StatusOK, wantBody: "goroutine?debug=1"},
+		{name: "named profile", admin: &config.AdminConfig{Enabled: true, Token: "s3cret", Debug: true}, path: endpoints.AdminPprof + "/goroutine?debug=1", token: "s3cret", wantStatus: fiber.StatusOK, wantBody: "goroutine profile:"},
+		{name: "unknown profile", admin: &config.AdminConfig{Enabled: true, Token: "s3cret", Debug: true}, path: endpoints.AdminPprof + "/leaks", token: "s3cret", wantStatus: fiber.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, app := newAdminTestServer(tt.admin)
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Contains(t, string(body), tt.wantBody)
+		})
+	}
+
+	_, app := newAdminTestServer(&config.AdminConfig{Enabled: true, Token: "s3cret", Debug: true})
+	req := httptest.NewRequest("GET", endpoints.AdminRuntime, nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	var report adminRuntime
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+	assert.Positive(t, report.Goroutines)
+	assert.Positive(t, report.NumCPU)
+	assert.Positive(t, report.Memory.HeapAlloc)
+}
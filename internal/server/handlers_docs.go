@@ -0,0 +1,49 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	_ "embed"
+	"encoding/json"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// openAPISpec is the OpenAPI 3 document describing the routes in registerRoutes
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// swaggerUIPage renders Swagger UI (loaded from a CDN) against /openapi.json
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>openmodel API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.onload = () => { window.ui = SwaggerUIBundle({ url: "` + EndpointOpenAPI + `", dom_id: "#swagger-ui" }); };
+  </script>
+</body>
+</html>`
+
+// handleOpenAPI handles GET /openapi.json
+func (s *Server) handleOpenAPI(c *fiber.Ctx) error {
+	var spec map[string]any
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		return handleError(c, "invalid embedded OpenAPI document", fiber.StatusInternalServerError)
+	}
+	if info, ok := spec["info"].(map[string]any); ok && s.version != "" {
+		info["version"] = s.version
+	}
+	return c.JSON(spec)
+}
+
+// handleDocs handles GET /docs
+func (s *Server) handleDocs(c *fiber.Ctx) error {
+	c.Set(HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return c.SendString(swaggerUIPage)
+}
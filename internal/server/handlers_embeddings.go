@@ -0,0 +1,87 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"encoding/json"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/api/openai"
+	"github.com/macedot/openmodel/internal/config"
+	applogger "github.com/macedot/openmodel/internal/logger"
+)
+
+// handleV1Embeddings handles POST /v1/embeddings. The request, dimensions and
+// encoding_format included, is forwarded to backends with the embeddings capability, and
+// the embeddings are returned in the requested encoding whatever the backend answered in.
+// Identical inputs are sent once and inputs found in the embedding cache not at all, and
+// the embeddings are expanded back to every input of the request.
+func (s *Server) handleV1Embeddings(c *fiber.Ctx) error {
+	body := c.Body()
+	if err := openai.ValidateEmbeddingRequest(body); err != nil {
+		return handleError(c, err.Error(), fiber.StatusBadRequest)
+	}
+
+	var req struct {
+		Model          string `json:"model"`
+		EncodingFormat string `json:"encoding_format"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return handleError(c, "invalid JSON body", fiber.StatusBadRequest)
+	}
+	if err := s.authorizeModel(c.UserContext(), requestHeader(c), req.Model); err != nil {
+		return handleError(c, err.Error(), fiber.StatusForbidden)
+	}
+	model, err := s.resolveModel(c.UserContext(), req.Model)
+	if err != nil {
+		return handleError(c, err.Error(), fiber.StatusNotFound)
+	}
+
+	ctx, requestID := buildRequestContext(c)
+	ctx = withRequiredCapabilities(ctx, []string{config.CapabilityEmbeddings})
+	batch, split := s.newEmbeddingBatch(model, body)
+	if split && s.GetConfig().EmbeddingCache != nil {
+		c.Set(HeaderXOpenModelCache, batch.cacheResult())
+	}
+	var resp []byte
+	providerKey := ""
+	if !split || len(batch.pending) > 0 {
+		forward := body
+		if split {
+			forward = batch.forwardBody(body)
+		}
+		r, key, err := s.executeWithFailoverFiber(ctx, model, forward, extractForwardHeaders(c), EndpointV1Embeddings)
+		if status, body, ok := clientErrorOf(err); ok {
+			return relayClientError(c, status, body)
+		}
+		if err != nil {
+			s.handleAllProvidersFailedFiber(c, model, err)
+			return nil
+		}
+		s.recordSuccess(key)
+		resp, providerKey = r.([]byte), key
+	}
+
+	if split {
+		// Re-expand the distinct inputs sent to the backend to every input of the request
+		expanded, err := batch.complete(resp, req.Model)
+		switch {
+		case err == nil:
+			s.storeEmbeddings(batch)
+			if batch.reduced() {
+				resp = expanded
+			}
+		case batch.reduced():
+			applogger.Warn("embedding_expand_failed", "request_id", requestID, "provider", providerKey, "error", err.Error())
+			return handleError(c, "invalid embeddings response from backend: "+err.Error(), fiber.StatusBadGateway)
+		}
+	}
+
+	out, err := openai.ConvertEmbeddingEncoding(resp, req.EncodingFormat)
+	if err != nil {
+		// Pass through a response that is not a recognizable embedding list
+		applogger.Warn("embedding_encoding_failed", "request_id", requestID, "provider", providerKey, "error", err.Error())
+		out = resp
+	}
+	c.Set(HeaderContentType, ContentTypeJSON)
+	return c.Send(out)
+}
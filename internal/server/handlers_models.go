@@ -0,0 +1,146 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"net/url"
+	"sort"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/api/openai"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/provider"
+)
+
+// handleV1Models handles GET /v1/models. Wildcard entries and models the client's API
+// key may not use are not listed.
+func (s *Server) handleV1Models(c *fiber.Ctx) error {
+	cfg := s.GetConfig()
+	allowed := s.modelListFilter(c)
+
+	// The names a tenant's chains add are listed after the configured ones
+	tenant, _ := tenantFromContext(c.UserContext())
+	names := orderedModelNames(cfg)
+	var chained []string
+	for name := range tenant.Chains {
+		if _, ok := cfg.Models[name]; !ok && !config.IsModelPattern(name) {
+			chained = append(chained, name)
+		}
+	}
+	sort.Strings(chained)
+	names = append(names, chained...)
+
+	list := openai.ModelList{Object: "list", Data: make([]openai.Model, 0, len(names))}
+	for _, name := range names {
+		if config.IsModelPattern(name) || !allowed(name) {
+			continue
+		}
+		modelCfg := cfg.Models[name]
+		if chain, ok := tenant.Chain(name); ok {
+			modelCfg = cfg.Models[chain]
+		}
+		list.Data = append(list.Data, s.buildModelObject(name, modelCfg))
+	}
+	return c.JSON(list)
+}
+
+// handleV1Model handles GET /v1/models/{model}
+func (s *Server) handleV1Model(c *fiber.Ctx) error {
+	name, err := url.PathUnescape(c.Params("*"))
+	if err != nil || name == "" {
+		return handleError(c, "invalid model id", fiber.StatusBadRequest)
+	}
+
+	cfg := s.GetConfig()
+	resolved, err := s.resolveModel(c.UserContext(), name)
+	if err != nil || !s.modelListFilter(c)(name) {
+		return handleError(c, "model \""+name+"\" not found", fiber.StatusNotFound)
+	}
+	return c.JSON(s.buildModelObject(name, cfg.Models[resolved]))
+}
+
+// buildModelObject converts a configured model into an OpenAI model object,
+// including the backend chain it routes to, what its backends support and the
+// metadata declared for it
+func (s *Server) buildModelObject(name string, modelCfg config.ModelConfig) openai.Model {
+	strategy := config.NormalizeStrategy(modelCfg.Strategy)
+
+	backends := make([]string, 0, len(modelCfg.Providers))
+	for _, p := range modelCfg.Providers {
+		backends = append(backends, formatProviderKey(p))
+	}
+
+	capabilities, contextLength := s.modelCapabilities(modelCfg)
+	model := openai.Model{
+		ID:            name,
+		Object:        "model",
+		OwnedBy:       "openmodel",
+		Strategy:      strategy,
+		Backends:      backends,
+		Capabilities:  capabilities,
+		ContextLength: contextLength,
+	}
+	if metadata := modelCfg.Metadata; metadata != nil {
+		model.Description = metadata.Description
+		model.Family = metadata.Family
+		model.ParameterSize = metadata.ParameterSize
+		if metadata.ContextWindow > 0 {
+			model.ContextLength = metadata.ContextWindow
+		}
+		if metadata.Pricing != nil {
+			model.Pricing = &openai.ModelPricing{InputPerMillion: metadata.Pricing.InputPerMillion, OutputPerMillion: metadata.Pricing.OutputPerMillion}
+		}
+	}
+	return model
+}
+
+// modelCapabilities returns the capabilities any backend of a model supports and the
+// largest context window its providers report (0 when none does)
+func (s *Server) modelCapabilities(modelCfg config.ModelConfig) ([]string, int) {
+	s.providersMu.RLock()
+	defer s.providersMu.RUnlock()
+
+	all := provider.AllCapabilities().Names()
+	supported := make(map[string]bool, len(all))
+	contextLength := 0
+	for _, p := range modelCfg.Providers {
+		declared := s.backendCapabilities(p)
+		if declared == nil {
+			declared = all
+		}
+		for _, name := range declared {
+			supported[name] = true
+		}
+		if prov, ok := s.providers[p.Provider].(provider.CapabilityProvider); ok {
+			contextLength = max(contextLength, prov.Capabilities().MaxContext)
+		}
+	}
+
+	var capabilities []string
+	for _, name := range all {
+		if supported[name] {
+			capabilities = append(capabilities, name)
+		}
+	}
+	return capabilities, contextLength
+}
+
+// orderedModelNames returns configured model names in config file order,
+// followed by any models not tracked in ModelOrder
+func orderedModelNames(cfg *config.Config) []string {
+	names := make([]string, 0, len(cfg.Models))
+	seen := make(map[string]bool, len(cfg.Models))
+	for _, name := range cfg.ModelOrder {
+		if _, ok := cfg.Models[name]; ok && !seen[name] {
+			names = append(names, name)
+			seen[name] = true
+		}
+	}
+	var rest []string
+	for name := range cfg.Models {
+		if !seen[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	return append(names, rest...)
+}
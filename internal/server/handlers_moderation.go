@@ -0,0 +1,179 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	applogger "github.com/macedot/openmodel/internal/logger"
+)
+
+// handleV1Moderations handles POST /v1/moderations
+func (s *Server) handleV1Moderations(c *fiber.Ctx) error {
+	body := c.Body()
+
+	var req struct {
+		Input any    `json:"input"`
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return handleError(c, "invalid JSON body", fiber.StatusBadRequest)
+	}
+	if req.Input == nil {
+		return handleError(c, "input is required", fiber.StatusBadRequest)
+	}
+
+	// Fall back to the configured moderation model when the client omits one
+	model := req.Model
+	if model == "" {
+		if modCfg := s.GetConfig().Moderation; modCfg != nil {
+			model = modCfg.Model
+		}
+	}
+	if model == "" {
+		return handleError(c, "model is required", fiber.StatusBadRequest)
+	}
+	if err := s.authorizeModel(c.UserContext(), requestHeader(c), model); err != nil {
+		return handleError(c, err.Error(), fiber.StatusForbidden)
+	}
+	model, err := s.resolveModel(c.UserContext(), model)
+	if err != nil {
+		return handleError(c, err.Error(), fiber.StatusNotFound)
+	}
+
+	ctx, _ := buildRequestContext(c)
+	resp, providerKey, err := s.executeWithFailoverFiber(ctx, model, body, extractForwardHeaders(c), EndpointV1Moderations)
+	if status, body, ok := clientErrorOf(err); ok {
+		return relayClientError(c, status, body)
+	}
+	if err != nil {
+		s.handleAllProvidersFailedFiber(c, model, err)
+		return nil
+	}
+
+	s.recordSuccess(providerKey)
+	c.Set(HeaderContentType, ContentTypeJSON)
+	return c.Send(resp.([]byte))
+}
+
+// moderationResult is a category-agnostic view of a moderation result, so that
+// categories added upstream can be matched against configured thresholds.
+type moderationResult struct {
+	Flagged        bool               `json:"flagged"`
+	Categories     map[string]bool    `json:"categories"`
+	CategoryScores map[string]float64 `json:"category_scores"`
+}
+
+// preflightModeration runs the configured moderation model over the user text of a
+// chat request body and returns the categories that tripped. Moderation failures are
+// logged and treated as a pass so an unavailable moderation backend cannot block traffic.
+func (s *Server) preflightModeration(ctx context.Context, body []byte, headers map[string]string) []string {
+	modCfg := s.GetConfig().Moderation
+	if modCfg == nil || !modCfg.Preflight || modCfg.Model == "" {
+		return nil
+	}
+
+	input := extractUserText(body)
+	if input == "" {
+		return nil
+	}
+
+	requestID, _ := ctx.Value("request_id").(string)
+	modBody, _ := json.Marshal(map[string]string{"model": modCfg.Model, "input": input})
+	resp, providerKey, err := s.executeWithFailoverFiber(ctx, modCfg.Model, modBody, headers, EndpointV1Moderations)
+	if err != nil {
+		applogger.Warn("moderation_failed", "request_id", requestID, "error", err.Error())
+		return nil
+	}
+	s.recordSuccess(providerKey)
+
+	var modResp struct {
+		Results []moderationResult `json:"results"`
+	}
+	if err := json.Unmarshal(resp.([]byte), &modResp); err != nil {
+		applogger.Warn("moderation_failed", "request_id", requestID, "error", fmt.Sprintf("invalid moderation response: %v", err))
+		return nil
+	}
+
+	categories := trippedCategories(modResp.Results, modCfg.Thresholds)
+	if len(categories) > 0 {
+		applogger.Info("moderation_tripped", "request_id", requestID, "categories", categories, "action", modCfg.GetAction())
+	}
+	return categories
+}
+
+// trippedCategories returns the sorted categories that exceed their configured threshold.
+// Without thresholds, the categories flagged by the moderation model are used.
+func trippedCategories(results []moderationResult, thresholds map[string]float64) []string {
+	tripped := make(map[string]bool)
+	for _, r := range results {
+		if len(thresholds) == 0 {
+			for category, flagged := range r.Categories {
+				if flagged {
+					tripped[category] = true
+				}
+			}
+			continue
+		}
+		for category, threshold := range thresholds {
+			if score, ok := r.CategoryScores[category]; ok && score >= threshold {
+				tripped[category] = true
+			}
+		}
+	}
+
+	categories := make([]string, 0, len(tripped))
+	for category := range tripped {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+// applyModerationVerdict blocks or annotates a request according to the moderation action.
+// It returns true when the request was blocked and the caller should stop processing.
+func (s *Server) applyModerationVerdict(c *fiber.Ctx, categories []string) bool {
+	if len(categories) == 0 {
+		return false
+	}
+	c.Set(HeaderXModerationCategories, strings.Join(categories, ","))
+	return s.GetConfig().Moderation.GetAction() == config.ModerationActionBlock
+}
+
+// extractUserText concatenates the text of user messages in an OpenAI or Anthropic chat body
+func extractUserText(body []byte) string {
+	var req struct {
+		Messages []struct {
+			Role    string `json:"role"`
+			Content any    `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return ""
+	}
+
+	var parts []string
+	for _, msg := range req.Messages {
+		if msg.Role != "user" {
+			continue
+		}
+		switch content := msg.Content.(type) {
+		case string:
+			parts = append(parts, content)
+		case []any:
+			for _, block := range content {
+				if m, ok := block.(map[string]any); ok {
+					if text, ok := m["text"].(string); ok && text != "" {
+						parts = append(parts, text)
+					}
+				}
+			}
+		}
+	}
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,144 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	applogger "github.com/macedot/openmodel/internal/logger"
+	"github.com/macedot/openmodel/internal/provider"
+)
+
+// handleAPICreate handles POST /api/create
+func (s *Server) handleAPICreate(c *fiber.Ctx) error {
+	prov, err := s.managedProvider()
+	if err != nil {
+		return handleError(c, err.Error(), fiber.StatusForbidden)
+	}
+
+	body := c.Body()
+	if !json.Valid(body) {
+		return handleError(c, "invalid JSON body", fiber.StatusBadRequest)
+	}
+
+	// Ollama streams progress by default; honor an explicit "stream": false
+	if !isManagementStreaming(body) {
+		return s.forwardManagementRequest(c, prov, fiber.MethodPost, EndpointAPICreate, body)
+	}
+
+	ctx, requestID := buildRequestContext(c)
+	stream, err := prov.DoStreamRequest(ctx, EndpointAPICreate, body, extractForwardHeaders(c))
+	if err != nil {
+		return handleError(c, applogger.Scrub(err.Error()), fiber.StatusBadGateway)
+	}
+
+	useSSE := prefersSSE(c)
+	if useSSE {
+		c.Set(HeaderContentType, ContentTypeSSE)
+	} else {
+		c.Set(HeaderContentType, ContentTypeNDJSON)
+	}
+	c.Set("Cache-Control", "no-cache")
+	c.Set("X-Accel-Buffering", "no")
+	releaseInFlight := inFlightFromContext(ctx).hold()
+	releaseGlobal := globalTicketFromContext(ctx).hold()
+	deadline := s.newStreamDeadline(c.Context().Conn())
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer releaseInFlight()
+		defer releaseGlobal()
+		defer deadline.flush(w)
+		for line := range stream {
+			if len(line) == 0 {
+				continue
+			}
+			var err error
+			if useSSE {
+				_, err = fmt.Fprintf(w, "%s%s%s", SSEDataPrefix, line, SSEDataSuffix)
+			} else {
+				_, err = fmt.Fprintf(w, "%s\n", line)
+			}
+			if err != nil {
+				applogger.Info("client_disconnected", "request_id", requestID, "provider", prov.Name())
+				return
+			}
+			deadline.flush(w)
+		}
+	})
+	return nil
+}
+
+// handleAPICopy handles POST /api/copy
+func (s *Server) handleAPICopy(c *fiber.Ctx) error {
+	prov, err := s.managedProvider()
+	if err != nil {
+		return handleError(c, err.Error(), fiber.StatusForbidden)
+	}
+	return s.forwardManagementRequest(c, prov, fiber.MethodPost, EndpointAPICopy, c.Body())
+}
+
+// handleAPIDelete handles DELETE /api/delete
+func (s *Server) handleAPIDelete(c *fiber.Ctx) error {
+	prov, err := s.managedProvider()
+	if err != nil {
+		return handleError(c, err.Error(), fiber.StatusForbidden)
+	}
+	return s.forwardManagementRequest(c, prov, fiber.MethodDelete, EndpointAPIDelete, c.Body())
+}
+
+// managedProvider returns the provider configured to receive model management requests
+func (s *Server) managedProvider() (requestProvider, error) {
+	cfg := s.GetConfig()
+	if cfg.Management == nil || !cfg.Management.Enabled {
+		return nil, fmt.Errorf("model management is disabled")
+	}
+	prov, ok := s.GetProviders()[cfg.Management.Provider]
+	if !ok {
+		return nil, fmt.Errorf("managed provider %q not found", cfg.Management.Provider)
+	}
+	return prov, nil
+}
+
+// forwardManagementRequest forwards a non-streaming management request and relays the response
+func (s *Server) forwardManagementRequest(c *fiber.Ctx, prov requestProvider, method, endpoint string, body []byte) error {
+	if !json.Valid(body) {
+		return handleError(c, "invalid JSON body", fiber.StatusBadRequest)
+	}
+
+	requester, ok := prov.(provider.MethodRequester)
+	if !ok {
+		return handleError(c, fmt.Sprintf("provider %q does not support model management", prov.Name()), fiber.StatusNotImplemented)
+	}
+
+	ctx, requestID := buildRequestContext(c)
+	resp, err := requester.DoMethodRequest(ctx, method, endpoint, body, extractForwardHeaders(c))
+	if err != nil {
+		applogger.Warn("management_request_failed", "request_id", requestID, "provider", prov.Name(), "endpoint", endpoint, "error", err.Error())
+		return handleError(c, applogger.Scrub(err.Error()), fiber.StatusBadGateway)
+	}
+
+	if len(resp) == 0 {
+		return c.SendStatus(fiber.StatusOK)
+	}
+	c.Set(HeaderContentType, ContentTypeJSON)
+	return c.Send(resp)
+}
+
+// isManagementStreaming reports whether a management request wants streamed progress.
+// Unlike OpenAI requests, Ollama defaults "stream" to true when omitted.
+func isManagementStreaming(body []byte) bool {
+	var req struct {
+		Stream *bool `json:"stream"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil || req.Stream == nil {
+		return true
+	}
+	return *req.Stream
+}
+
+// prefersSSE reports whether the client negotiated Server-Sent Events over the
+// default NDJSON framing for Ollama-style streaming responses
+func prefersSSE(c *fiber.Ctx) bool {
+	return c.Accepts(ContentTypeNDJSON, ContentTypeSSE) == ContentTypeSSE
+}
@@ -2,10 +2,15 @@
 package server
 
 import (
+	"context"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/macedot/openmodel/internal/api/openai"
+	"github.com/macedot/openmodel/internal/config"
 	applogger "github.com/macedot/openmodel/internal/logger"
 	"github.com/macedot/openmodel/internal/server/converters"
 )
@@ -27,24 +32,72 @@ func (s *Server) handleV1ChatCompletions(c *fiber.Ctx) error {
 	}
 
 	// Check if model exists in config
-	if err := s.validateModel(model); err != nil {
+	requested := model
+	if err := s.authorizeModel(c.UserContext(), requestHeader(c), requested); err != nil {
+		return handleError(c, err.Error(), fiber.StatusForbidden)
+	}
+	model, err := s.resolveModel(c.UserContext(), model)
+	if err != nil {
 		return handleError(c, err.Error(), fiber.StatusNotFound)
 	}
+	body, err = s.guardPrompt(c, requested, body)
+	if err != nil {
+		return guardrailError(c, config.EndpointsOpenAI, err)
+	}
+	model = s.applyRoutingRules(requested, model, body, requestHeader(c))
+	model, experiment := s.assignExperiment(model, body)
+	tagExperiment(func(key, value string) { c.Set(key, value) }, experiment)
 
 	ctx, requestID := buildRequestContext(c)
+	ctx = withExperiment(ctx, experiment)
+	ctx = s.withStickyKey(ctx, model, body, requestHeader(c))
+	ctx = withRequiredCapabilities(ctx, requestCapabilities(body))
+	ctx = withUsageAttribution(ctx, model, requestHeader(c))
+
+	ctx, ticket, err := s.admit(ctx, model, requestHeader(c))
+	if err != nil {
+		c.Set("Retry-After", strconv.Itoa(s.admissionRetryAfter(model)))
+		return handleError(c, err.Error(), fiber.StatusTooManyRequests)
+	}
+	defer ticket.done()
 
 	// Extract headers to forward
 	forwardHeaders := extractForwardHeaders(c)
 
+	if categories := s.preflightModeration(ctx, body, forwardHeaders); s.applyModerationVerdict(c, categories) {
+		return handleError(c, "request blocked by moderation: "+strings.Join(categories, ", "), fiber.StatusBadRequest)
+	}
+
 	isStreaming := isStreamingRequest(body)
+	includeUsage := isStreaming && openai.IncludeUsageRequested(body)
+
+	// Only non-streaming completions are served from, and stored in, the semantic cache
+	var cacheKey *semanticCacheKey
+	if !isStreaming {
+		var cached []byte
+		if cached, cacheKey = s.lookupSemanticCache(ctx, model, body, forwardHeaders); cached != nil {
+			c.Locals("model", model)
+			c.Set(HeaderXOpenModelCache, "hit")
+			c.Set("Content-Type", "application/json")
+			return c.Send(cached)
+		}
+		if cacheKey != nil {
+			c.Set(HeaderXOpenModelCache, "miss")
+		}
+	}
+
+	// Structured outputs are validated (and retried) for non-streaming responses only
+	schema, validateOutput := openai.StructuredOutputSchema(body)
+	validateOutput = validateOutput && !isStreaming
+	invalidOutputs := 0
 
 	attemptedProviders := 0
 	for {
 		// Find provider first to determine api_mode
-		prov, providerKey, providerModel, err := s.findProviderWithFailover(model, "")
+		prov, providerKey, providerModel, err := s.findProviderWithFailover(ctx, model)
 		if err != nil {
 			if attemptedProviders > 0 {
-				s.handleAllProvidersFailedFiber(c, fmt.Errorf("model %q temporarily unavailable: all providers failed", model))
+				s.handleAllProvidersFailedFiber(c, model, fmt.Errorf("model %q temporarily unavailable: all providers failed", model))
 				return nil
 			}
 			return handleError(c, err.Error(), fiber.StatusNotFound)
@@ -65,16 +118,36 @@ func (s *Server) handleV1ChatCompletions(c *fiber.Ctx) error {
 		}
 
 		if isStreaming {
-			return s.streamWithFailover(c, model, forwardBody, attemptHeaders, ctx, converters.APIFormatOpenAI, plan.targetFormat)
+			return s.streamWithFailover(c, model, EndpointV1ChatCompletions, forwardBody, attemptHeaders, ctx, converters.APIFormatOpenAI, plan.targetFormat, includeUsage)
 		}
+		forwardBody = s.rewriteOptions(model, providerKey, forwardBody)
 
-		resp, err := prov.DoRequest(ctx, plan.forwardEndpoint, forwardBody, attemptHeaders)
+		start := time.Now()
+		var resp []byte
+		err = s.callProvider(ctx, model, providerKey, func(ctx context.Context) (err error) {
+			resp, err = prov.DoRequest(ctx, plan.forwardEndpoint, forwardBody, attemptHeaders)
+			return err
+		})
 		if err != nil {
-			threshold := s.GetConfig().GetThresholds(providerKey).FailuresBeforeSwitch
-			s.handleProviderError(providerKey, err, threshold)
+			if ctx.Err() != nil {
+				return handleError(c, "request cancelled", statusClientClosedRequest)
+			}
+			s.handleProviderError(ctx, providerKey, err)
+			if status, body, ok := clientErrorOf(err); ok {
+				if plan.converter != nil {
+					return handleError(c, err.Error(), status)
+				}
+				return relayClientError(c, status, body)
+			}
 			continue
 		}
 
+		// Store provider in context for logging
+		c.Locals("provider", providerKey)
+		c.Locals("model", model)
+
+		s.recordUsage(ctx, providerKey, responseUsage(resp))
+
 		var finalResp []byte
 		if plan.converter != nil {
 			finalResp, err = plan.converter.ConvertResponse(resp)
@@ -85,8 +158,112 @@ func (s *Server) handleV1ChatCompletions(c *fiber.Ctx) error {
 			finalResp = resp
 		}
 
-		s.state.ResetModel(providerKey)
+		s.recordSuccess(providerKey)
+
+		if validateOutput {
+			if err := openai.ValidateStructuredOutput(schema, finalResp); err != nil {
+				invalidOutputs++
+				applogger.Warn("structured_output_invalid", "request_id", requestID, "provider", providerKey, "attempt", invalidOutputs, "error", err.Error())
+				if invalidOutputs <= s.GetConfig().GetStructuredOutputRetries() {
+					continue
+				}
+				return handleError(c, "model output does not match response_format json_schema: "+err.Error(), fiber.StatusBadGateway)
+			}
+		}
+
+		s.mirrorRequest(ctx, model, converters.APIFormatOpenAI, EndpointV1ChatCompletions, body, forwardHeaders,
+			mirrorPrimary{providerKey: providerKey, latency: time.Since(start), response: finalResp})
+		s.storeSemanticCache(cacheKey, finalResp)
+
 		c.Set("Content-Type", "application/json")
 		return c.Send(finalResp)
 	}
 }
+
+// handleV1Completions handles POST /v1/completions (legacy completions, including
+// fill-in-the-middle requests that carry a suffix)
+func (s *Server) handleV1Completions(c *fiber.Ctx) error {
+	body := c.Body()
+
+	if err := openai.ValidateCompletionRequest(body); err != nil {
+		return handleError(c, err.Error(), fiber.StatusBadRequest)
+	}
+
+	model := extractModelFromRequestBody(body)
+	if err := s.authorizeModel(c.UserContext(), requestHeader(c), model); err != nil {
+		return handleError(c, err.Error(), fiber.StatusForbidden)
+	}
+	body, err := s.guardPrompt(c, model, body)
+	if err != nil {
+		return guardrailError(c, config.EndpointsOpenAI, err)
+	}
+	model, err = s.resolveModel(c.UserContext(), model)
+	if err != nil {
+		return handleError(c, err.Error(), fiber.StatusNotFound)
+	}
+
+	ctx, requestID := buildRequestContext(c)
+	ctx = s.withStickyKey(ctx, model, body, requestHeader(c))
+	ctx = withUsageAttribution(ctx, model, requestHeader(c))
+
+	ctx, ticket, err := s.admit(ctx, model, requestHeader(c))
+	if err != nil {
+		c.Set("Retry-After", strconv.Itoa(s.admissionRetryAfter(model)))
+		return handleError(c, err.Error(), fiber.StatusTooManyRequests)
+	}
+	defer ticket.done()
+
+	forwardHeaders := extractForwardHeaders(c)
+
+	isStreaming := isStreamingRequest(body)
+	includeUsage := isStreaming && openai.IncludeUsageRequested(body)
+
+	attemptedProviders := 0
+	for {
+		prov, providerKey, providerModel, err := s.findProviderWithFailover(ctx, model)
+		if err != nil {
+			if attemptedProviders > 0 {
+				s.handleAllProvidersFailedFiber(c, model, fmt.Errorf("model %q temporarily unavailable: all providers failed", model))
+				return nil
+			}
+			return handleError(c, err.Error(), fiber.StatusNotFound)
+		}
+		attemptedProviders++
+
+		// Legacy completions have no Anthropic equivalent
+		if prov.APIMode() == string(converters.APIFormatAnthropic) {
+			return handleError(c, fmt.Sprintf("provider %q does not support %s", prov.Name(), EndpointV1Completions), fiber.StatusBadRequest)
+		}
+
+		applogger.Debug("ROUTING", "request_id", requestID, "provider", providerKey, "model", providerModel, "api_mode", prov.APIMode())
+
+		if isStreaming {
+			return s.streamWithFailover(c, model, EndpointV1Completions, body, forwardHeaders, ctx, converters.APIFormatOpenAI, converters.APIFormatOpenAI, includeUsage)
+		}
+
+		var resp []byte
+		err = s.callProvider(ctx, model, providerKey, func(ctx context.Context) (err error) {
+			resp, err = prov.DoRequest(ctx, EndpointV1Completions, s.rewriteOptions(model, providerKey, replaceModelInBody(body, providerModel)), forwardHeaders)
+			return err
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return handleError(c, "request cancelled", statusClientClosedRequest)
+			}
+			s.handleProviderError(ctx, providerKey, err)
+			if status, body, ok := clientErrorOf(err); ok {
+				return relayClientError(c, status, body)
+			}
+			continue
+		}
+
+		// Store provider in context for logging
+		c.Locals("provider", providerKey)
+		c.Locals("model", model)
+
+		s.recordSuccess(providerKey)
+		s.recordUsage(ctx, providerKey, responseUsage(resp))
+		c.Set("Content-Type", "application/json")
+		return c.Send(resp)
+	}
+}
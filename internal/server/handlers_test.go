@@ -2,13 +2,18 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/macedot/openmodel/internal/api/openai"
@@ -27,6 +32,8 @@ type stubProvider struct {
 	closeFn       func() error
 	doRequestFn   func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error)
 	doStreamReqFn func(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error)
+	doMethodReqFn func(ctx context.Context, method, endpoint string, body []byte, headers map[string]string) ([]byte, error)
+	doBinaryReqFn func(ctx context.Context, endpoint, contentType string, body []byte, headers map[string]string) ([]byte, string, error)
 }
 
 func (p *stubProvider) Name() string { return p.name }
@@ -72,6 +79,20 @@ func (p *stubProvider) Moderate(ctx context.Context, input string) (*openai.Mode
 	return nil, nil
 }
 
+func (p *stubProvider) DoMethodRequest(ctx context.Context, method, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+	if p.doMethodReqFn != nil {
+		return p.doMethodReqFn(ctx, method, endpoint, body, headers)
+	}
+	return nil, nil
+}
+
+func (p *stubProvider) DoBinaryRequest(ctx context.Context, endpoint, contentType string, body []byte, headers map[string]string) ([]byte, string, error) {
+	if p.doBinaryReqFn != nil {
+		return p.doBinaryReqFn(ctx, endpoint, contentType, body, headers)
+	}
+	return nil, "", nil
+}
+
 func (p *stubProvider) DoRequest(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
 	if p.doRequestFn != nil {
 		return p.doRequestFn(ctx, endpoint, body, headers)
@@ -323,13 +344,14 @@ func TestBuildRoutingPlan(t *testing.T) {
 	})
 }
 
-// TestValidateModel tests model validation
-func TestValidateModel(t *testing.T) {
+// TestResolveModel tests model validation and wildcard resolution
+func TestResolveModel(t *testing.T) {
 	cfg := &config.Config{
 		Models: map[string]config.ModelConfig{
 			"gpt-4":    {Strategy: "fallback"},
 			"gpt-3.5":  {Strategy: "fallback"},
 			"claude-3": {Strategy: "fallback"},
+			"claude-*": {Strategy: "fallback"},
 		},
 	}
 
@@ -338,17 +360,23 @@ func TestValidateModel(t *testing.T) {
 	tests := []struct {
 		name        string
 		model       string
+		want        string
 		expectError bool
 	}{
 		{
-			name:        "existing model",
-			model:       "gpt-4",
-			expectError: false,
+			name:  "existing model",
+			model: "gpt-4",
+			want:  "gpt-4",
+		},
+		{
+			name:  "exact match wins over wildcard",
+			model: "claude-3",
+			want:  "claude-3",
 		},
 		{
-			name:        "another existing model",
-			model:       "claude-3",
-			expectError: false,
+			name:  "wildcard match",
+			model: "claude-3-5-sonnet",
+			want:  "claude-*",
 		},
 		{
 			name:        "non-existent model",
@@ -364,12 +392,13 @@ func TestValidateModel(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := srv.validateModel(tt.model)
+			got, err := srv.resolveModel(context.Background(), tt.model)
 			if tt.expectError {
 				assert.Error(t, err)
 				assert.Contains(t, err.Error(), "not found")
 			} else {
 				assert.NoError(t, err)
+				assert.Equal(t, tt.want, got)
 			}
 		})
 	}
@@ -578,7 +607,7 @@ func TestHandleV1ChatCompletions_FailsOverToNextProvider(t *testing.T) {
 				},
 			},
 		},
-		state: state.New(1000),
+		state: state.New(),
 	}
 
 	app := fiber.New()
@@ -594,3 +623,1365 @@ func TestHandleV1ChatCompletions_FailsOverToNextProvider(t *testing.T) {
 	assert.Equal(t, 1, firstCalls)
 	assert.Equal(t, 1, secondCalls)
 }
+
+func TestHandleV1Messages_InvalidRequestUsesAnthropicErrorShape(t *testing.T) {
+	cfg := &config.Config{
+		Models: map[string]config.ModelConfig{
+			"claude-3": {Strategy: "fallback", Providers: []config.ModelProvider{{Provider: "anthropic", Model: "claude-3"}}},
+		},
+	}
+	srv := &Server{config: cfg, providers: providerMap{}}
+
+	app := fiber.New()
+	app.Post(endpoints.V1Messages, srv.handleV1Messages)
+
+	reqBody := `{"model": "claude-3", "messages": [{"role": "system", "content": "hello"}]}`
+	req := httptest.NewRequest("POST", endpoints.V1Messages, strings.NewReader(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderAnthropicVersion, AnthropicAPIVersion)
+
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+
+	var result struct {
+		Type  string `json:"type"`
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	assert.Equal(t, "error", result.Type)
+	assert.Equal(t, "invalid_request_error", result.Error.Type)
+	assert.Contains(t, result.Error.Message, "messages[0].role")
+}
+
+// streamOf returns a closed channel pre-filled with the given SSE lines
+func streamOf(lines ...string) <-chan []byte {
+	ch := make(chan []byte, len(lines))
+	for _, line := range lines {
+		ch <- []byte(line)
+	}
+	close(ch)
+	return ch
+}
+
+func newStreamingTestServer(prov *stubProvider) *Server {
+	cfg := &config.Config{
+		Models: map[string]config.ModelConfig{
+			"gpt-4": {Strategy: "fallback", Providers: []config.ModelProvider{{Provider: prov.name, Model: "gpt-4"}}},
+		},
+		Thresholds: config.ThresholdsConfig{FailuresBeforeSwitch: 1, InitialTimeout: 1000, MaxTimeout: 10000},
+	}
+	return &Server{config: cfg, providers: providerMap{prov.name: prov}, state: state.New()}
+}
+
+func TestHandleV1ChatCompletions_StreamIncludeUsage(t *testing.T) {
+	prov := &stubProvider{
+		name: "ollama",
+		doStreamReqFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+			return streamOf(
+				`data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4","choices":[{"index":0,"delta":{"content":"hi"},"finish_reason":null}]}`,
+				`data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4","choices":[{"index":0,"delta":{},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":1,"total_tokens":4}}`,
+				SSEDataDone,
+			), nil
+		},
+	}
+	srv := newStreamingTestServer(prov)
+
+	app := fiber.New()
+	app.Post(endpoints.V1ChatCompletions, srv.handleV1ChatCompletions)
+
+	reqBody := `{"model":"gpt-4","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"hello"}]}`
+	req := httptest.NewRequest("POST", endpoints.V1ChatCompletions, strings.NewReader(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	out := string(body)
+	assert.Equal(t, 1, strings.Count(out, SSEDataDone), "exactly one [DONE] marker")
+	usageIdx := strings.Index(out, `"choices":[],"usage":{"prompt_tokens":3,"completion_tokens":1,"total_tokens":4}`)
+	require.GreaterOrEqual(t, usageIdx, 0, "usage-only chunk expected")
+	assert.Less(t, usageIdx, strings.Index(out, SSEDataDone))
+}
+
+// TestHandleV1Model tests single model retrieval
+func TestHandleV1Model(t *testing.T) {
+	cfg := &config.Config{
+		Models: map[string]config.ModelConfig{
+			"gpt-4": {Providers: []config.ModelProvider{{Provider: "openai", Model: "gpt-4"}, {Provider: "azure", Model: "gpt-4o"}}},
+			"org/coder": {Strategy: config.StrategyRoundRobin, Providers: []config.ModelProvider{{Provider: "local", Model: "coder"}}, Metadata: &config.ModelMetadata{
+				Description: "Local coding model", Family: "qwen", ParameterSize: "32B", ContextWindow: 32768,
+				Pricing: &config.ModelPrice{InputPerMillion: 0.5, OutputPerMillion: 1.5},
+			}},
+		},
+	}
+	srv := &Server{config: cfg}
+
+	app := fiber.New()
+	app.Get(EndpointV1Models, srv.handleV1Models)
+	app.Get(EndpointV1Model, srv.handleV1Model)
+
+	tests := []struct {
+		name         string
+		path         string
+		expectedCode int
+		expected     openai.Model
+	}{
+		{
+			name:         "known model",
+			path:         "/v1/models/gpt-4",
+			expectedCode: fiber.StatusOK,
+			expected:     openai.Model{ID: "gpt-4", Object: "model", OwnedBy: "openmodel", Strategy: "fallback", Backends: []string{"openai/gpt-4", "azure/gpt-4o"}, Capabilities: []string{"tools", "vision", "json_mode", "embeddings"}},
+		},
+		{
+			name:         "model id with slash and metadata",
+			path:         "/v1/models/org/coder",
+			expectedCode: fiber.StatusOK,
+			expected: openai.Model{ID: "org/coder", Object: "model", OwnedBy: "openmodel", Strategy: "round-robin", Backends: []string{"local/coder"}, Capabilities: []string{"tools", "vision", "json_mode", "embeddings"},
+				ContextLength: 32768, Description: "Local coding model", Family: "qwen", ParameterSize: "32B", Pricing: &openai.ModelPricing{InputPerMillion: 0.5, OutputPerMillion: 1.5}},
+		},
+		{
+			name:         "unknown model",
+			path:         "/v1/models/missing",
+			expectedCode: fiber.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest("GET", tt.path, nil))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedCode, resp.StatusCode)
+
+			if tt.expectedCode == fiber.StatusOK {
+				var model openai.Model
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&model))
+				assert.Equal(t, tt.expected, model)
+			}
+		})
+	}
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/v1/models", nil))
+	require.NoError(t, err)
+	var list openai.ModelList
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+	assert.Equal(t, "list", list.Object)
+	assert.Len(t, list.Data, 2)
+}
+
+func TestHandleOllamaManagement(t *testing.T) {
+	var gotMethod, gotEndpoint string
+	prov := &stubProvider{
+		name: "ollama",
+		doMethodReqFn: func(ctx context.Context, method, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+			gotMethod, gotEndpoint = method, endpoint
+			return nil, nil
+		},
+		doStreamReqFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+			return streamOf(`{"status":"creating model"}`, `{"status":"success"}`), nil
+		},
+	}
+
+	tests := []struct {
+		name           string
+		management     *config.ManagementConfig
+		method         string
+		path           string
+		body           string
+		accept         string
+		expectedCode   int
+		expectedMethod string
+		expectedBody   string
+	}{
+		{
+			name:         "disabled by default",
+			method:       "POST",
+			path:         EndpointAPICopy,
+			body:         `{"source":"a","destination":"b"}`,
+			expectedCode: fiber.StatusForbidden,
+		},
+		{
+			name:           "copy forwarded",
+			management:     &config.ManagementConfig{Enabled: true, Provider: "ollama"},
+			method:         "POST",
+			path:           EndpointAPICopy,
+			body:           `{"source":"a","destination":"b"}`,
+			expectedCode:   fiber.StatusOK,
+			expectedMethod: "POST",
+		},
+		{
+			name:           "delete forwarded with DELETE",
+			management:     &config.ManagementConfig{Enabled: true, Provider: "ollama"},
+			method:         "DELETE",
+			path:           EndpointAPIDelete,
+			body:           `{"model":"a"}`,
+			expectedCode:   fiber.StatusOK,
+			expectedMethod: "DELETE",
+		},
+		{
+			name:         "create streams status",
+			management:   &config.ManagementConfig{Enabled: true, Provider: "ollama"},
+			method:       "POST",
+			path:         EndpointAPICreate,
+			body:         `{"model":"a","from":"llama3"}`,
+			expectedCode: fiber.StatusOK,
+			expectedBody: "{\"status\":\"creating model\"}\n{\"status\":\"success\"}\n",
+		},
+		{
+			name:         "create streams SSE when negotiated",
+			management:   &config.ManagementConfig{Enabled: true, Provider: "ollama"},
+			method:       "POST",
+			path:         EndpointAPICreate,
+			body:         `{"model":"a","from":"llama3"}`,
+			accept:       "text/event-stream",
+			expectedCode: fiber.StatusOK,
+			expectedBody: "data: {\"status\":\"creating model\"}\n\ndata: {\"status\":\"success\"}\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotMethod, gotEndpoint = "", ""
+			cfg := &config.Config{Management: tt.management}
+			srv := &Server{config: cfg, providers: providerMap{prov.name: prov}}
+
+			app := fiber.New()
+			srv.registerRoutes(app)
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedCode, resp.StatusCode)
+
+			if tt.expectedMethod != "" {
+				assert.Equal(t, tt.expectedMethod, gotMethod)
+				assert.Equal(t, tt.path, gotEndpoint)
+			}
+			if tt.expectedBody != "" {
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectedBody, string(body))
+			}
+		})
+	}
+}
+
+func TestHandleV1AudioTranscriptions_RoutesToAudioProvider(t *testing.T) {
+	textOnly := &stubProvider{
+		name: "text",
+		doBinaryReqFn: func(ctx context.Context, endpoint, contentType string, body []byte, headers map[string]string) ([]byte, string, error) {
+			t.Fatal("non-audio provider must not receive audio requests")
+			return nil, "", nil
+		},
+	}
+	var gotModel, gotFile string
+	audio := &stubProvider{
+		name: "audio",
+		doBinaryReqFn: func(ctx context.Context, endpoint, contentType string, body []byte, headers map[string]string) ([]byte, string, error) {
+			assert.Equal(t, EndpointV1AudioTranscript, endpoint)
+			_, params, err := mime.ParseMediaType(contentType)
+			require.NoError(t, err)
+			form, err := multipart.NewReader(bytes.NewReader(body), params["boundary"]).ReadForm(1 << 20)
+			require.NoError(t, err)
+			gotModel = form.Value["model"][0]
+			f, err := form.File["file"][0].Open()
+			require.NoError(t, err)
+			data, _ := io.ReadAll(f)
+			gotFile = string(data)
+			return []byte(`{"text":"hello"}`), "application/json", nil
+		},
+	}
+
+	cfg := &config.Config{
+		Providers: map[string]config.ProviderConfig{
+			"text":  {},
+			"audio": {Audio: true},
+		},
+		Models: map[string]config.ModelConfig{
+			"whisper": {Providers: []config.ModelProvider{{Provider: "text", Model: "whisper-1"}, {Provider: "audio", Model: "whisper-large-v3"}}},
+		},
+		Thresholds: config.ThresholdsConfig{FailuresBeforeSwitch: 1, InitialTimeout: 1000, MaxTimeout: 10000},
+	}
+	srv := &Server{config: cfg, providers: providerMap{"text": textOnly, "audio": audio}, state: state.New()}
+
+	app := fiber.New()
+	app.Post(EndpointV1AudioTranscript, srv.handleV1AudioTranscriptions)
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	require.NoError(t, writer.WriteField("model", "whisper"))
+	part, err := writer.CreateFormFile("file", "clip.wav")
+	require.NoError(t, err)
+	_, _ = part.Write([]byte("RIFF-audio"))
+	require.NoError(t, writer.Close())
+
+	req := httptest.NewRequest("POST", EndpointV1AudioTranscript, &buf)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.JSONEq(t, `{"text":"hello"}`, string(body))
+	assert.Equal(t, "whisper-large-v3", gotModel)
+	assert.Equal(t, "RIFF-audio", gotFile)
+}
+
+func TestHandleV1ChatCompletions_PreflightModeration(t *testing.T) {
+	tests := []struct {
+		name           string
+		action         string
+		thresholds     map[string]float64
+		expectedCode   int
+		expectedHeader string
+		expectForward  bool
+	}{
+		{
+			name:           "block on flagged category",
+			action:         config.ModerationActionBlock,
+			expectedCode:   fiber.StatusBadRequest,
+			expectedHeader: "violence",
+		},
+		{
+			name:           "annotate on flagged category",
+			action:         config.ModerationActionAnnotate,
+			expectedCode:   fiber.StatusOK,
+			expectedHeader: "violence",
+			expectForward:  true,
+		},
+		{
+			name:          "below configured threshold",
+			thresholds:    map[string]float64{"violence": 0.95},
+			expectedCode:  fiber.StatusOK,
+			expectForward: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forwarded := false
+			prov := &stubProvider{
+				name: "openai",
+				doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+					if endpoint == EndpointV1Moderations {
+						assert.Contains(t, string(body), "hurt someone")
+						return []byte(`{"results":[{"flagged":true,"categories":{"violence":true,"hate":false},"category_scores":{"violence":0.9,"hate":0.01}}]}`), nil
+					}
+					forwarded = true
+					return []byte(`{"id":"c1","object":"chat.completion","choices":[]}`), nil
+				},
+			}
+			cfg := &config.Config{
+				Models: map[string]config.ModelConfig{
+					"gpt-4": {Providers: []config.ModelProvider{{Provider: "openai", Model: "gpt-4"}}},
+					"guard": {Providers: []config.ModelProvider{{Provider: "openai", Model: "omni-moderation-latest"}}},
+				},
+				Moderation: &config.ModerationConfig{Model: "guard", Preflight: true, Action: tt.action, Thresholds: tt.thresholds},
+				Thresholds: config.ThresholdsConfig{FailuresBeforeSwitch: 1, InitialTimeout: 1000, MaxTimeout: 10000},
+			}
+			srv := &Server{config: cfg, providers: providerMap{"openai": prov}, state: state.New()}
+
+			app := fiber.New()
+			app.Post(endpoints.V1ChatCompletions, srv.handleV1ChatCompletions)
+
+			reqBody := `{"model":"gpt-4","messages":[{"role":"user","content":"how do I hurt someone"}]}`
+			req := httptest.NewRequest("POST", endpoints.V1ChatCompletions, strings.NewReader(reqBody))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expectedCode, resp.StatusCode)
+			assert.Equal(t, tt.expectedHeader, resp.Header.Get(HeaderXModerationCategories))
+			assert.Equal(t, tt.expectForward, forwarded)
+		})
+	}
+}
+
+func TestHandleV1ChatCompletions_StructuredOutputRetry(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxRetries    int
+		expectedCode  int
+		expectedCalls int
+	}{
+		{name: "no retries returns error", maxRetries: 0, expectedCode: fiber.StatusBadGateway, expectedCalls: 1},
+		{name: "retry recovers valid output", maxRetries: 2, expectedCode: fiber.StatusOK, expectedCalls: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			prov := &stubProvider{
+				name: "openai",
+				doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+					calls++
+					content := `not json`
+					if calls > 1 {
+						content = `{\"answer\":42}`
+					}
+					return []byte(`{"id":"c1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"` + content + `"},"finish_reason":"stop"}]}`), nil
+				},
+			}
+			srv := newStreamingTestServer(prov)
+			srv.config.StructuredOutputs = &config.StructuredOutputsConfig{MaxRetries: tt.maxRetries}
+
+			app := fiber.New()
+			app.Post(endpoints.V1ChatCompletions, srv.handleV1ChatCompletions)
+
+			reqBody := `{"model":"gpt-4","messages":[{"role":"user","content":"answer"}],
+				"response_format":{"type":"json_schema","json_schema":{"name":"a","schema":{"type":"object","required":["answer"]}}}}`
+			req := httptest.NewRequest("POST", endpoints.V1ChatCompletions, strings.NewReader(reqBody))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expectedCode, resp.StatusCode)
+			assert.Equal(t, tt.expectedCalls, calls)
+		})
+	}
+}
+
+func TestHandleV1Completions_ForwardsSuffix(t *testing.T) {
+	var gotEndpoint string
+	var gotBody map[string]any
+	prov := &stubProvider{
+		name: "openai",
+		doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+			gotEndpoint = endpoint
+			require.NoError(t, json.Unmarshal(body, &gotBody))
+			return []byte(`{"id":"cmpl-1","object":"text_completion","choices":[{"index":0,"text":"a, b = 0, 1"}]}`), nil
+		},
+	}
+	srv := newStreamingTestServer(prov)
+
+	app := fiber.New()
+	app.Post(EndpointV1Completions, srv.handleV1Completions)
+
+	reqBody := `{"model":"gpt-4","prompt":"def fib(n):\n","suffix":"\n    return a"}`
+	req := httptest.NewRequest("POST", EndpointV1Completions, strings.NewReader(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Equal(t, EndpointV1Completions, gotEndpoint)
+	assert.Equal(t, "\n    return a", gotBody["suffix"])
+}
+
+func TestHandleV1Embeddings(t *testing.T) {
+	var called []string
+	var gotBody map[string]any
+	newProv := func(name string) *stubProvider {
+		return &stubProvider{
+			name: name,
+			doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+				called = append(called, name)
+				assert.Equal(t, EndpointV1Embeddings, endpoint)
+				require.NoError(t, json.Unmarshal(body, &gotBody))
+				// 1.0 and -0.5 as little-endian float32, whatever encoding was asked for
+				return []byte(`{"object":"list","data":[{"object":"embedding","index":0,"embedding":"AACAPwAAAL8="}],"model":"embed"}`), nil
+			},
+		}
+	}
+	cfg := &config.Config{
+		Providers: map[string]config.ProviderConfig{"chat": {Capabilities: []string{config.CapabilityTools}}},
+		Models: map[string]config.ModelConfig{
+			"embed": {Providers: []config.ModelProvider{{Provider: "chat", Model: "llama3"}, {Provider: "local", Model: "nomic-embed-text"}}},
+		},
+		Thresholds: config.ThresholdsConfig{FailuresBeforeSwitch: 1},
+	}
+	srv := &Server{config: cfg, providers: providerMap{"chat": newProv("chat"), "local": newProv("local")}, state: state.New()}
+
+	app := fiber.New()
+	app.Post(EndpointV1Embeddings, srv.handleV1Embeddings)
+	send := func(body string) (int, map[string]any) {
+		req := httptest.NewRequest("POST", EndpointV1Embeddings, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		var out map[string]any
+		json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+
+	status, out := send(`{"model":"embed","input":"hello","dimensions":256}`)
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, []string{"local"}, called, "backends without the embeddings capability are skipped")
+	assert.Equal(t, "nomic-embed-text", gotBody["model"])
+	assert.Equal(t, 256.0, gotBody["dimensions"])
+	assert.Equal(t, []any{1.0, -0.5}, out["data"].([]any)[0].(map[string]any)["embedding"])
+
+	status, out = send(`{"model":"embed","input":"hello","encoding_format":"base64"}`)
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, "base64", gotBody["encoding_format"])
+	assert.Equal(t, "AACAPwAAAL8=", out["data"].([]any)[0].(map[string]any)["embedding"])
+
+	status, _ = send(`{"model":"embed","input":"hello","encoding_format":"int8"}`)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+}
+
+// TestHandleOpenAPI_DocumentsAllRoutes keeps openapi.json in sync with registerRoutes
+func TestHandleOpenAPI_DocumentsAllRoutes(t *testing.T) {
+	srv := &Server{config: &config.Config{}, version: "1.2.3"}
+	app := fiber.New()
+	srv.registerRoutes(app)
+
+	resp, err := app.Test(httptest.NewRequest("GET", EndpointOpenAPI, nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var spec struct {
+		Info struct {
+			Version string `json:"version"`
+		} `json:"info"`
+		Paths map[string]map[string]any `json:"paths"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&spec))
+	assert.Equal(t, "1.2.3", spec.Info.Version)
+
+	for _, route := range app.GetRoutes(true) {
+		if route.Method == fiber.MethodHead {
+			continue
+		}
+		path := route.Path
+		switch path {
+		case EndpointV1Model:
+			path = EndpointV1Models + "/{model}"
+		case EndpointAdminWeights:
+			path = endpoints.AdminWeights + "/{model}"
+		case EndpointAdminBackendAction:
+			path = endpoints.AdminBackends + "/{backend}/{action}"
+		case EndpointAdminPprof:
+			path = endpoints.AdminPprof + "/{profile}"
+		case EndpointAdminKey:
+			path = endpoints.AdminKeys + "/{id}"
+		case EndpointAdminKeyRotate:
+			path = endpoints.AdminKeys + "/{id}/rotate"
+		}
+		methods, ok := spec.Paths[path]
+		if assert.True(t, ok, "route %s missing from openapi.json", path) {
+			assert.Contains(t, methods, strings.ToLower(route.Method), "method %s %s missing from openapi.json", route.Method, path)
+		}
+	}
+}
+
+func TestFindProviderWithFailover_LeastBusy(t *testing.T) {
+	cfg := &config.Config{
+		Models: map[string]config.ModelConfig{
+			"mixed": {Strategy: "least_busy", Providers: []config.ModelProvider{
+				{Provider: "local", Model: "llama3"},
+				{Provider: "hosted", Model: "gpt-4"},
+			}},
+		},
+		Thresholds: config.ThresholdsConfig{FailuresBeforeSwitch: 3, InitialTimeout: 1000, MaxTimeout: 10000},
+	}
+	srv := &Server{
+		config:    cfg,
+		providers: providerMap{"local": &stubProvider{name: "local"}, "hosted": &stubProvider{name: "hosted"}},
+		state:     state.New(),
+	}
+
+	// Idle chain keeps configuration order
+	_, key, _, err := srv.findProviderWithFailover(context.Background(), "mixed")
+	require.NoError(t, err)
+	assert.Equal(t, "local/llama3", key)
+
+	release, err := srv.trackInFlight("local/llama3")
+	require.NoError(t, err)
+	_, key, _, err = srv.findProviderWithFailover(context.Background(), "mixed")
+	require.NoError(t, err)
+	assert.Equal(t, "hosted/gpt-4", key)
+
+	release()
+	_, key, _, err = srv.findProviderWithFailover(context.Background(), "mixed")
+	require.NoError(t, err)
+	assert.Equal(t, "local/llama3", key)
+}
+
+func TestFindProviderWithFailover_Sticky(t *testing.T) {
+	cfg := &config.Config{
+		Models: map[string]config.ModelConfig{
+			"chat": {Strategy: "sticky", StickyHeader: "X-Session-ID", Providers: []config.ModelProvider{
+				{Provider: "a", Model: "m"},
+				{Provider: "b", Model: "m"},
+				{Provider: "c", Model: "m"},
+			}},
+		},
+		Thresholds: config.ThresholdsConfig{FailuresBeforeSwitch: 1, CooldownMs: -1},
+	}
+	srv := &Server{
+		config:    cfg,
+		providers: providerMap{"a": &stubProvider{name: "a"}, "b": &stubProvider{name: "b"}, "c": &stubProvider{name: "c"}},
+		state:     state.New(),
+	}
+	noHeader := func(string) string { return "" }
+	route := func(ctx context.Context) string {
+		_, key, _, err := srv.findProviderWithFailover(ctx, "chat")
+		require.NoError(t, err)
+		return key
+	}
+
+	// Each user keeps a provider, and users spread across providers
+	pinned := map[string]string{}
+	used := map[string]bool{}
+	for i := range 20 {
+		user := fmt.Sprintf("user-%d", i)
+		ctx := srv.withStickyKey(context.Background(), "chat", []byte(`{"user":"`+user+`"}`), noHeader)
+		pinned[user] = route(ctx)
+		assert.Equal(t, pinned[user], route(ctx))
+		used[pinned[user]] = true
+	}
+	assert.Greater(t, len(used), 1)
+
+	// The session header takes precedence over the user field
+	byHeader := srv.withStickyKey(context.Background(), "chat", []byte(`{"user":"user-0"}`), func(string) string { return "user-1" })
+	assert.Equal(t, pinned["user-1"], route(byHeader))
+
+	// Only users of a failed provider move
+	srv.handleProviderError(context.Background(), pinned["user-0"], fmt.Errorf("boom"))
+	for user, key := range pinned {
+		ctx := srv.withStickyKey(context.Background(), "chat", []byte(`{"user":"`+user+`"}`), noHeader)
+		if key == pinned["user-0"] {
+			assert.NotEqual(t, key, route(ctx), user)
+		} else {
+			assert.Equal(t, key, route(ctx), user)
+		}
+	}
+
+	// Without a key the first available provider is used
+	first := "a/m"
+	if pinned["user-0"] == first {
+		first = "b/m"
+	}
+	assert.Equal(t, first, route(context.Background()))
+}
+
+func TestFindProviderWithFailover_HalfOpenProbe(t *testing.T) {
+	cfg := &config.Config{
+		Models: map[string]config.ModelConfig{
+			"chat": {Providers: []config.ModelProvider{
+				{Provider: "a", Model: "m"},
+				{Provider: "b", Model: "m"},
+			}},
+		},
+		Thresholds: config.ThresholdsConfig{FailuresBeforeSwitch: 1, CooldownMs: 20},
+	}
+	srv := &Server{
+		config:    cfg,
+		providers: providerMap{"a": &stubProvider{name: "a"}, "b": &stubProvider{name: "b"}},
+		state:     state.New(),
+	}
+	for _, key := range []string{"a/m", "b/m"} {
+		srv.state.RecordFailure(key, srv.breakerPolicy(key))
+	}
+	time.Sleep(20 * time.Millisecond)
+	before := srv.state.Snapshot("b/m")
+
+	// Only the backend tried takes its probe
+	_, key, _, err := srv.findProviderWithFailover(context.Background(), "chat")
+	require.NoError(t, err)
+	assert.Equal(t, "a/m", key)
+	assert.True(t, srv.state.Snapshot("a/m").Probing)
+	after := srv.state.Snapshot("b/m")
+	assert.False(t, after.Probing)
+	assert.Equal(t, before.OpenedAt, after.OpenedAt)
+	assert.Equal(t, state.CircuitHalfOpen, after.Circuit)
+
+	// The next request probes the other backend
+	_, key, _, err = srv.findProviderWithFailover(context.Background(), "chat")
+	require.NoError(t, err)
+	assert.Equal(t, "b/m", key)
+	_, _, _, err = srv.findProviderWithFailover(context.Background(), "chat")
+	assert.Error(t, err)
+}
+
+func TestRequestCapabilities(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{name: "plain chat", body: `{"messages":[{"role":"user","content":"hi"}]}`},
+		{name: "tools", body: `{"tools":[{"type":"function","function":{"name":"f"}}],"messages":[]}`, want: []string{"tools"}},
+		{name: "empty tools", body: `{"tools":[],"messages":[]}`},
+		{name: "openai image", body: `{"messages":[{"role":"user","content":[{"type":"text","text":"?"},{"type":"image_url","image_url":{"url":"data:"}}]}]}`, want: []string{"vision"}},
+		{name: "anthropic image", body: `{"messages":[{"role":"user","content":[{"type":"image","source":{}}]}]}`, want: []string{"vision"}},
+		{name: "json mode", body: `{"response_format":{"type":"json_object"},"messages":[]}`, want: []string{"json_mode"}},
+		{name: "text format", body: `{"response_format":{"type":"text"},"messages":[]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, requestCapabilities([]byte(tt.body)))
+		})
+	}
+}
+
+func TestHandleV1ChatCompletions_SkipsIncapableBackends(t *testing.T) {
+	var called []string
+	newProv := func(name string) *stubProvider {
+		return &stubProvider{
+			name: name,
+			doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+				called = append(called, name)
+				return []byte(`{"id":"ok","object":"chat.completion","choices":[]}`), nil
+			},
+		}
+	}
+	cfg := &config.Config{
+		Providers: map[string]config.ProviderConfig{"small": {Capabilities: []string{}}},
+		Models: map[string]config.ModelConfig{
+			"gpt-4": {Providers: []config.ModelProvider{{Provider: "small", Model: "phi"}, {Provider: "big", Model: "gpt-4"}}},
+		},
+		Thresholds: config.ThresholdsConfig{FailuresBeforeSwitch: 1},
+	}
+	srv := &Server{config: cfg, providers: providerMap{"small": newProv("small"), "big": newProv("big")}, state: state.New()}
+
+	app := fiber.New()
+	app.Post(endpoints.V1ChatCompletions, srv.handleV1ChatCompletions)
+	send := func(body string) int {
+		req := httptest.NewRequest("POST", endpoints.V1ChatCompletions, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, fiber.StatusOK, send(`{"model":"gpt-4","tools":[{"type":"function","function":{"name":"f"}}],"messages":[{"role":"user","content":"hi"}]}`))
+	assert.Equal(t, fiber.StatusOK, send(`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`))
+	assert.Equal(t, []string{"big", "small"}, called)
+	assert.True(t, srv.state.IsAvailable("small/phi", 1), "skipping a backend is not a failure")
+}
+
+// capableProvider is a stub provider reporting capabilities
+type capableProvider struct {
+	stubProvider
+	capabilities provider.Capabilities
+}
+
+func (p *capableProvider) Capabilities() provider.Capabilities { return p.capabilities }
+
+func TestProviderCapabilities(t *testing.T) {
+	local := &capableProvider{stubProvider: stubProvider{name: "local"}, capabilities: provider.Capabilities{Tools: true, Streaming: true, MaxContext: 8192}}
+	hosted := &capableProvider{stubProvider: stubProvider{name: "hosted"}, capabilities: provider.AllCapabilities()}
+	hosted.capabilities.MaxContext = 128000
+	cfg := &config.Config{
+		Models: map[string]config.ModelConfig{
+			"small":    {Providers: []config.ModelProvider{{Provider: "local", Model: "phi"}}},
+			"mixed":    {Providers: []config.ModelProvider{{Provider: "local", Model: "phi"}, {Provider: "hosted", Model: "gpt-4o"}}},
+			"override": {Providers: []config.ModelProvider{{Provider: "hosted", Model: "gpt-4o", Capabilities: []string{config.CapabilityVision}}}},
+		}, Thresholds: config.ThresholdsConfig{FailuresBeforeSwitch: 1},
+	}
+	srv := &Server{config: cfg, providers: providerMap{"local": local, "hosted": hosted}, state: state.New()}
+
+	tests := []struct {
+		model             string
+		wantCapabilities  []string
+		wantContextLength int
+		required          []string
+		wantBackends      []string
+	}{
+		{"small", []string{"tools"}, 8192, []string{config.CapabilityTools}, []string{"local/phi"}},
+		{"small", []string{"tools"}, 8192, []string{config.CapabilityVision}, nil},
+		{"mixed", []string{"tools", "vision", "json_mode", "embeddings"}, 128000, []string{config.CapabilityVision}, []string{"hosted/gpt-4o"}},
+		{"override", []string{"vision"}, 128000, []string{config.CapabilityTools}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model+" "+strings.Join(tt.required, ","), func(t *testing.T) {
+			model := srv.buildModelObject(tt.model, cfg.Models[tt.model])
+			assert.Equal(t, tt.wantCapabilities, model.Capabilities)
+			assert.Equal(t, tt.wantContextLength, model.ContextLength)
+
+			var backends []string
+			for _, result := range srv.findAvailableProvidersForModel(cfg.Models[tt.model].Providers, tt.required) {
+				backends = append(backends, result.providerKey)
+			}
+			assert.Equal(t, tt.wantBackends, backends)
+		})
+	}
+}
+
+func TestFindAvailableProviders_SkipsBackendsOutsideSchedule(t *testing.T) {
+	always := &config.ScheduleConfig{}
+	never := &config.ScheduleConfig{Off: []config.TimeWindow{{}}}
+	cfg := &config.Config{
+		Models: map[string]config.ModelConfig{
+			"gpt-4": {Providers: []config.ModelProvider{
+				{Provider: "hosted", Model: "gpt-4", Schedule: never},
+				{Provider: "local", Model: "llama3", Schedule: always},
+				{Provider: "backup", Model: "gpt-4"},
+			}},
+		},
+		Thresholds: config.ThresholdsConfig{FailuresBeforeSwitch: 1},
+	}
+	srv := &Server{config: cfg, providers: providerMap{
+		"hosted": &stubProvider{name: "hosted"}, "local": &stubProvider{name: "local"}, "backup": &stubProvider{name: "backup"},
+	}, state: state.New()}
+
+	var backends []string
+	for _, result := range srv.findAvailableProvidersForModel(cfg.Models["gpt-4"].Providers, nil) {
+		backends = append(backends, result.providerKey)
+	}
+	assert.Equal(t, []string{"local/llama3", "backup/gpt-4"}, backends)
+}
+
+func TestCheckProviders_MarksOutagesAndRecovers(t *testing.T) {
+	var healthErr error
+	var endpoint string
+	prov := &stubProvider{
+		name: "openai",
+		doMethodReqFn: func(ctx context.Context, method, ep string, body []byte, headers map[string]string) ([]byte, error) {
+			endpoint = method + " " + ep
+			return nil, healthErr
+		},
+	}
+	srv := newStreamingTestServer(prov)
+	srv.config.HealthCheck = &config.HealthCheckConfig{Enabled: true, IntervalMs: 60000}
+	ctx := context.Background()
+
+	// Endpoints the provider lacks are not an outage
+	healthErr = &provider.StatusError{StatusCode: 404, Err: fmt.Errorf("not found")}
+	srv.checkProviders(ctx, srv.config)
+	assert.Equal(t, "GET /v1/models", endpoint)
+	assert.True(t, srv.state.IsAvailable("openai/gpt-4", 1))
+
+	healthErr = &provider.StatusError{StatusCode: 502, Err: fmt.Errorf("bad gateway")}
+	srv.checkProviders(ctx, srv.config)
+	assert.False(t, srv.state.IsAvailable("openai/gpt-4", 1))
+	wait, ok := srv.state.RetryAfter("openai/gpt-4")
+	assert.True(t, ok)
+	assert.InDelta(t, 60, wait.Seconds(), 1)
+
+	healthErr = nil
+	srv.checkProviders(ctx, srv.config)
+	assert.True(t, srv.state.IsAvailable("openai/gpt-4", 1))
+
+	// A backend taken out by request failures is left to its own cooldown
+	srv.handleProviderError(context.Background(), "openai/gpt-4", &provider.StatusError{StatusCode: 500, Err: fmt.Errorf("boom")})
+	srv.checkProviders(ctx, srv.config)
+	assert.False(t, srv.state.IsAvailable("openai/gpt-4", 1))
+}
+
+func TestStreamWithFailover_HedgesSlowProvider(t *testing.T) {
+	primaryCancelled := make(chan struct{})
+	slow := &stubProvider{
+		name: "slow",
+		doStreamReqFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+			ch := make(chan []byte)
+			go func() {
+				defer close(ch)
+				<-ctx.Done()
+				close(primaryCancelled)
+			}()
+			return ch, nil
+		},
+	}
+	fast := &stubProvider{
+		name: "fast",
+		doStreamReqFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+			assert.Contains(t, string(body), `"model":"gpt-4o"`)
+			return streamOf(
+				`data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"fast"},"finish_reason":"stop"}]}`,
+				SSEDataDone,
+			), nil
+		},
+	}
+	cfg := &config.Config{
+		Models: map[string]config.ModelConfig{
+			"gpt-4": {HedgeAfterMs: 20, Providers: []config.ModelProvider{
+				{Provider: "slow", Model: "gpt-4"},
+				{Provider: "fast", Model: "gpt-4o"},
+			}},
+		},
+		Thresholds: config.ThresholdsConfig{FailuresBeforeSwitch: 1, InitialTimeout: 1000, MaxTimeout: 10000},
+	}
+	srv := &Server{config: cfg, providers: providerMap{"slow": slow, "fast": fast}, state: state.New()}
+
+	app := fiber.New()
+	app.Post(endpoints.V1ChatCompletions, srv.handleV1ChatCompletions)
+
+	reqBody := `{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"hello"}]}`
+	req := httptest.NewRequest("POST", endpoints.V1ChatCompletions, strings.NewReader(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Contains(t, string(body), `"content":"fast"`)
+	assert.Equal(t, 1, strings.Count(string(body), SSEDataDone))
+
+	select {
+	case <-primaryCancelled:
+	case <-time.After(time.Second):
+		t.Fatal("losing provider was not cancelled")
+	}
+	assert.Eventually(t, func() bool {
+		return srv.state.InFlight("slow/gpt-4") == 0 && srv.state.InFlight("fast/gpt-4o") == 0
+	}, time.Second, 10*time.Millisecond)
+	assert.True(t, srv.state.IsAvailable("slow/gpt-4", 1), "losing a hedge race is not a failure")
+}
+
+func TestStreamWithFailover_HedgesSlowFirstToken(t *testing.T) {
+	chunk := func(model, delta string) string {
+		return `data: {"id":"c1","object":"chat.completion.chunk","model":"` + model + `","choices":[{"index":0,"delta":` + delta + `,"finish_reason":null}]}`
+	}
+	primaryCancelled := make(chan struct{})
+	slow := &stubProvider{
+		name: "slow",
+		doStreamReqFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+			ch := make(chan []byte, 1)
+			// The role chunk comes at once, the first token never before the hedge
+			ch <- []byte(chunk("gpt-4", `{"role":"assistant"}`))
+			go func() {
+				defer close(ch)
+				select {
+				case <-ctx.Done():
+					close(primaryCancelled)
+				case <-time.After(5 * time.Second):
+					ch <- []byte(chunk("gpt-4", `{"content":"slow"}`))
+				}
+			}()
+			return ch, nil
+		},
+	}
+	fast := &stubProvider{
+		name: "fast",
+		doStreamReqFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+			return streamOf(chunk("gpt-4o", `{"role":"assistant"}`), chunk("gpt-4o", `{"content":"fast"}`), SSEDataDone), nil
+		},
+	}
+	cfg := &config.Config{
+		Models: map[string]config.ModelConfig{
+			"gpt-4": {HedgeAfterMs: 20, Providers: []config.ModelProvider{
+				{Provider: "slow", Model: "gpt-4"},
+				{Provider: "fast", Model: "gpt-4o"},
+			}},
+		},
+		Thresholds: config.ThresholdsConfig{FailuresBeforeSwitch: 1, InitialTimeout: 1000, MaxTimeout: 10000},
+	}
+	srv := &Server{config: cfg, providers: providerMap{"slow": slow, "fast": fast}, state: state.New()}
+
+	app := fiber.New()
+	app.Post(endpoints.V1ChatCompletions, srv.handleV1ChatCompletions)
+
+	req := httptest.NewRequest("POST", endpoints.V1ChatCompletions, strings.NewReader(`{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"hello"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, 2000)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Contains(t, string(body), `"content":"fast"`)
+	assert.Equal(t, 1, strings.Count(string(body), `"role":"assistant"`), "the role chunk of the loser is not relayed")
+	select {
+	case <-primaryCancelled:
+	case <-time.After(time.Second):
+		t.Fatal("the provider whose first token was slow was not cancelled")
+	}
+}
+
+func TestHandleV1ChatCompletions_RetriesTransientErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantCalls  int
+		wantStatus int
+	}{
+		{name: "retries 503 on same provider", err: &provider.StatusError{StatusCode: 503, Err: fmt.Errorf("unavailable")}, wantCalls: 3, wantStatus: fiber.StatusOK},
+		{name: "does not retry 400", err: &provider.StatusError{StatusCode: 400, Err: fmt.Errorf("bad request")}, wantCalls: 1, wantStatus: fiber.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			prov := &stubProvider{
+				name: "openai",
+				doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+					calls++
+					if calls < 3 {
+						return nil, tt.err
+					}
+					return []byte(`{"id":"ok","object":"chat.completion","choices":[]}`), nil
+				},
+			}
+			srv := newStreamingTestServer(prov)
+			model := srv.config.Models["gpt-4"]
+			model.Retry = &config.RetryConfig{MaxAttempts: 3, BackoffMs: 1}
+			srv.config.Models["gpt-4"] = model
+
+			app := fiber.New()
+			app.Post(endpoints.V1ChatCompletions, srv.handleV1ChatCompletions)
+
+			req := httptest.NewRequest("POST", endpoints.V1ChatCompletions, strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantCalls, calls)
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.True(t, srv.state.IsAvailable("openai/gpt-4", 1))
+		})
+	}
+}
+
+func TestHandleProviderError_ClassPolicies(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		wantClass     errorClass
+		wantAvailable bool
+		wantRecovers  bool
+		maxWait       time.Duration
+	}{
+		{name: "auth disables", err: &provider.StatusError{StatusCode: 401, Err: fmt.Errorf("unauthorized")}, wantClass: errorClassAuth},
+		{name: "forbidden disables", err: &provider.StatusError{StatusCode: 403, Err: fmt.Errorf("forbidden")}, wantClass: errorClassAuth},
+		{name: "not found disables", err: &provider.StatusError{StatusCode: 404, Err: fmt.Errorf("model not found")}, wantClass: errorClassNotFound},
+		{name: "unknown path fails over without counting", err: &provider.StatusError{StatusCode: 404, Err: fmt.Errorf("404 page not found")}, wantClass: errorClassUnsupported, wantAvailable: true, wantRecovers: true},
+		{name: "bad request records nothing", err: &provider.StatusError{StatusCode: 400, Err: fmt.Errorf("invalid messages")}, wantClass: errorClassClient, wantAvailable: true, wantRecovers: true},
+		{name: "unprocessable records nothing", err: &provider.StatusError{StatusCode: 422, Err: fmt.Errorf("bad schema")}, wantClass: errorClassClient, wantAvailable: true, wantRecovers: true},
+		{name: "rate limit honours Retry-After", err: &provider.StatusError{StatusCode: 429, RetryAfter: 2 * time.Second, Err: fmt.Errorf("slow down")}, wantClass: errorClassRateLimit, wantRecovers: true, maxWait: 2 * time.Second},
+		{name: "rate limit without Retry-After", err: &provider.StatusError{StatusCode: 429, Err: fmt.Errorf("slow down")}, wantClass: errorClassRateLimit, wantRecovers: true, maxWait: defaultRateLimitCooldown},
+		{name: "unavailable with Retry-After parks", err: &provider.StatusError{StatusCode: 503, RetryAfter: 30 * time.Second, Err: fmt.Errorf("overloaded")}, wantClass: errorClassServer, wantRecovers: true, maxWait: 30 * time.Second},
+		{name: "server error counts", err: &provider.StatusError{StatusCode: 502, Err: fmt.Errorf("bad gateway")}, wantClass: errorClassServer, wantAvailable: true, wantRecovers: true},
+		{name: "timeout counts", err: fmt.Errorf("request failed: %w", context.DeadlineExceeded), wantClass: errorClassTimeout, wantAvailable: true, wantRecovers: true},
+		{name: "client cancellation records nothing", err: &url.Error{Op: "Post", URL: "http://backend/v1/chat/completions", Err: context.Canceled}, wantClass: errorClassCanceled, wantAvailable: true, wantRecovers: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newStreamingTestServer(&stubProvider{name: "openai"})
+			srv.config.Thresholds.FailuresBeforeSwitch = 2
+
+			assert.Equal(t, tt.wantClass, classifyError(tt.err))
+			srv.handleProviderError(context.Background(), "openai/gpt-4", tt.err)
+
+			assert.Equal(t, tt.wantAvailable, srv.state.IsAvailable("openai/gpt-4", 2))
+			wait, ok := srv.state.RetryAfter("openai/gpt-4")
+			assert.Equal(t, tt.wantRecovers, ok)
+			if tt.maxWait > 0 {
+				assert.InDelta(t, tt.maxWait.Seconds(), wait.Seconds(), 0.5)
+			}
+		})
+	}
+}
+
+func TestStreamWithFailover_MidStreamFailure(t *testing.T) {
+	roleChunk := `data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4","choices":[{"index":0,"delta":{"role":"assistant"},"finish_reason":null}]}`
+	tokenChunk := func(text string) string {
+		return `data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4","choices":[{"index":0,"delta":{"content":"` + text + `"},"finish_reason":null}]}`
+	}
+
+	tests := []struct {
+		name        string
+		primary     []string
+		wantBackup  bool
+		contains    []string
+		notContains []string
+	}{
+		{
+			name:        "dies before first token fails over",
+			primary:     []string{roleChunk},
+			wantBackup:  true,
+			contains:    []string{`"content":"backup"`, SSEDataDone},
+			notContains: []string{"stream_interrupted"},
+		},
+		{
+			name:        "dies after tokens emits error event",
+			primary:     []string{roleChunk, tokenChunk("partial")},
+			contains:    []string{`"content":"partial"`, `"code":"stream_interrupted"`},
+			notContains: []string{`"content":"backup"`, SSEDataDone},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backupCalled := false
+			primary := &stubProvider{
+				name: "primary",
+				doStreamReqFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+					return streamOf(tt.primary...), nil
+				},
+			}
+			backup := &stubProvider{
+				name: "backup",
+				doStreamReqFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+					backupCalled = true
+					return streamOf(roleChunk, tokenChunk("backup"), SSEDataDone), nil
+				},
+			}
+			cfg := &config.Config{
+				Models: map[string]config.ModelConfig{
+					"gpt-4": {Providers: []config.ModelProvider{{Provider: "primary", Model: "gpt-4"}, {Provider: "backup", Model: "gpt-4"}}},
+				},
+				Thresholds: config.ThresholdsConfig{FailuresBeforeSwitch: 1, InitialTimeout: 1000, MaxTimeout: 10000},
+			}
+			srv := &Server{config: cfg, providers: providerMap{"primary": primary, "backup": backup}, state: state.New()}
+
+			app := fiber.New()
+			app.Post(endpoints.V1ChatCompletions, srv.handleV1ChatCompletions)
+
+			req := httptest.NewRequest("POST", endpoints.V1ChatCompletions, strings.NewReader(`{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantBackup, backupCalled)
+			for _, want := range tt.contains {
+				assert.Contains(t, string(body), want)
+			}
+			for _, unwanted := range tt.notContains {
+				assert.NotContains(t, string(body), unwanted)
+			}
+			assert.Equal(t, 1, strings.Count(string(body), `"role":"assistant"`), "held-back output of a failed attempt is discarded")
+			assert.False(t, srv.state.IsAvailable("primary/gpt-4", 1), "truncated stream counts as a failure")
+		})
+	}
+}
+
+func TestExecuteWithFailover_ClientCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var calls []string
+	newProv := func(name string) *stubProvider {
+		return &stubProvider{
+			name: name,
+			doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+				calls = append(calls, name)
+				// The client goes away while the backend is answering
+				cancel()
+				<-ctx.Done()
+				return nil, &url.Error{Op: "Post", URL: "http://" + name + "/v1/chat/completions", Err: ctx.Err()}
+			},
+		}
+	}
+	cfg := &config.Config{
+		Models: map[string]config.ModelConfig{
+			"gpt-4": {Providers: []config.ModelProvider{{Provider: "primary", Model: "gpt-4"}, {Provider: "backup", Model: "gpt-4"}}},
+		},
+		Thresholds: config.ThresholdsConfig{FailuresBeforeSwitch: 1, InitialTimeout: 1000, MaxTimeout: 10000},
+	}
+	srv := &Server{config: cfg, providers: providerMap{"primary": newProv("primary"), "backup": newProv("backup")}, state: state.New()}
+
+	_, _, err := srv.executeWithFailoverFiber(ctx, "gpt-4", []byte(`{"model":"gpt-4"}`), nil, EndpointV1ChatCompletions)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []string{"primary"}, calls, "a cancelled request is not failed over")
+	for _, backend := range []string{"primary/gpt-4", "backup/gpt-4"} {
+		assert.Equal(t, state.CircuitClosed, srv.state.Circuit(backend), backend)
+		assert.True(t, srv.state.IsAvailable(backend, 1), backend)
+	}
+}
+
+func TestFailover_TriesEachBackendOnce(t *testing.T) {
+	var calls []string
+	newProv := func(name string, fail bool) *stubProvider {
+		return &stubProvider{
+			name: name,
+			doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+				calls = append(calls, name)
+				if fail {
+					return nil, &provider.StatusError{StatusCode: 500, Err: fmt.Errorf("boom")}
+				}
+				return []byte(`{"id":"c1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}]}`), nil
+			},
+		}
+	}
+	tests := []struct {
+		name       string
+		thresholds config.ThresholdsConfig
+	}{
+		{"failure count", config.ThresholdsConfig{FailuresBeforeSwitch: 3}},
+		// Under the error-rate policy a backend stays admitted until its sample trips
+		{"error rate", config.ThresholdsConfig{FailuresBeforeSwitch: 3, ErrorRate: &config.ErrorRateConfig{Percent: 50}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Models: map[string]config.ModelConfig{
+					"gpt-4": {Providers: []config.ModelProvider{{Provider: "bad", Model: "gpt-4"}, {Provider: "good", Model: "gpt-4"}}},
+					"solo":  {Providers: []config.ModelProvider{{Provider: "bad", Model: "gpt-4"}}},
+				},
+				Thresholds: tt.thresholds,
+			}
+			srv := &Server{config: cfg, providers: providerMap{"bad": newProv("bad", true), "good": newProv("good", false)}, state: state.New()}
+			app := fiber.New()
+			srv.registerRoutes(app)
+			send := func(model string) int {
+				req := httptest.NewRequest("POST", EndpointV1ChatCompletions, strings.NewReader(`{"model":"`+model+`","messages":[{"role":"user","content":"hello"}]}`))
+				req.Header.Set("Content-Type", "application/json")
+				resp, err := app.Test(req)
+				require.NoError(t, err)
+				return resp.StatusCode
+			}
+
+			calls = nil
+			assert.Equal(t, fiber.StatusOK, send("gpt-4"))
+			assert.Equal(t, []string{"bad", "good"}, calls)
+
+			calls = nil
+			assert.Equal(t, fiber.StatusServiceUnavailable, send("solo"))
+			assert.Equal(t, []string{"bad"}, calls)
+			assert.Equal(t, state.CircuitClosed, srv.state.Circuit("bad/gpt-4"), "one failure per request")
+
+			calls = nil
+			_, _, err := srv.executeWithFailoverFiber(context.Background(), "solo", []byte(`{"model":"solo"}`), nil, EndpointV1ChatCompletions)
+			assert.Error(t, err)
+			assert.Equal(t, []string{"bad"}, calls)
+		})
+	}
+}
+
+func TestFailover_BackendClientErrors(t *testing.T) {
+	const refusal = `{"error":{"message":"messages: too long","type":"invalid_request_error"}}`
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantBody   string
+		wantCalls  []string
+	}{
+		{
+			name:       "422 is relayed unchanged",
+			err:        &provider.StatusError{StatusCode: 422, Body: []byte(refusal), Err: fmt.Errorf("messages: too long")},
+			wantStatus: fiber.StatusUnprocessableEntity,
+			wantBody:   refusal,
+			wantCalls:  []string{"first"},
+		},
+		{
+			name:       "unknown endpoint fails over",
+			err:        &provider.StatusError{StatusCode: 404, Body: []byte("404 page not found"), Err: fmt.Errorf("404 page not found")},
+			wantStatus: fiber.StatusOK,
+			wantBody:   `"content":"hi"`,
+			wantCalls:  []string{"first", "second"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			first := &stubProvider{
+				name: "first",
+				doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+					calls = append(calls, "first")
+					return nil, tt.err
+				},
+			}
+			second := &stubProvider{
+				name: "second",
+				doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+					calls = append(calls, "second")
+					return []byte(`{"id":"c1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}]}`), nil
+				},
+			}
+			cfg := &config.Config{
+				Models: map[string]config.ModelConfig{
+					"gpt-4": {Providers: []config.ModelProvider{{Provider: "first", Model: "gpt-4"}, {Provider: "second", Model: "gpt-4"}}},
+				},
+				Thresholds: config.ThresholdsConfig{FailuresBeforeSwitch: 1},
+			}
+			srv := &Server{config: cfg, providers: providerMap{"first": first, "second": second}, state: state.New()}
+			app := fiber.New()
+			srv.registerRoutes(app)
+
+			req := httptest.NewRequest("POST", EndpointV1ChatCompletions, strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.Contains(t, string(body), tt.wantBody)
+			assert.Equal(t, tt.wantCalls, calls)
+			assert.True(t, srv.state.IsAvailable("first/gpt-4", 1), "the backend is not blamed")
+		})
+	}
+}
+
+func TestRecordProviderFailure_BackendThresholds(t *testing.T) {
+	cfg := &config.Config{
+		Models: map[string]config.ModelConfig{
+			"chat": {
+				Thresholds: &config.ThresholdsConfig{FailuresBeforeSwitch: 2},
+				Providers: []config.ModelProvider{
+					{Provider: "free", Model: "llama3", Thresholds: &config.ThresholdsConfig{FailuresBeforeSwitch: 1}},
+					{Provider: "paid", Model: "gpt-4o"},
+				},
+			},
+		},
+		Thresholds: config.ThresholdsConfig{FailuresBeforeSwitch: 5, InitialTimeout: 1000, MaxTimeout: 10000},
+	}
+	srv := &Server{config: cfg, state: state.New()}
+
+	tests := []struct {
+		backend  string
+		failures int
+	}{
+		{backend: "free/llama3", failures: 1},
+		{backend: "paid/gpt-4o", failures: 2},
+		{backend: "other/model", failures: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.backend, func(t *testing.T) {
+			for i := 1; i <= tt.failures; i++ {
+				assert.True(t, srv.state.Allow(tt.backend, srv.breakerPolicy(tt.backend)), "available before failure %d", i)
+				srv.handleProviderError(context.Background(), tt.backend, fmt.Errorf("boom"))
+			}
+			assert.False(t, srv.state.Allow(tt.backend, srv.breakerPolicy(tt.backend)))
+		})
+	}
+}
+
+func TestHandleAllProvidersFailed_RetryAfterFromModelChain(t *testing.T) {
+	cfg := &config.Config{
+		Models: map[string]config.ModelConfig{
+			"gpt-4":  {Providers: []config.ModelProvider{{Provider: "openai", Model: "gpt-4"}, {Provider: "azure", Model: "gpt-4"}}},
+			"claude": {Providers: []config.ModelProvider{{Provider: "anthropic", Model: "claude"}}},
+		},
+		Thresholds: config.ThresholdsConfig{FailuresBeforeSwitch: 1, MaxTimeout: 300000},
+		Providers: map[string]config.ProviderConfig{
+			"openai":    {Thresholds: &config.ThresholdsConfig{FailuresBeforeSwitch: 1, CooldownMs: 5000}},
+			"azure":     {Thresholds: &config.ThresholdsConfig{FailuresBeforeSwitch: 1, CooldownMs: 20000}},
+			"anthropic": {Thresholds: &config.ThresholdsConfig{FailuresBeforeSwitch: 1, CooldownMs: 120000}},
+		},
+	}
+	srv := &Server{config: cfg, state: state.New()}
+	srv.handleProviderError(context.Background(), "openai/gpt-4", &provider.StatusError{StatusCode: 503, RetryAfter: 3 * time.Second, Err: fmt.Errorf("boom")})
+	srv.handleProviderError(context.Background(), "azure/gpt-4", fmt.Errorf("boom"))
+	srv.handleProviderError(context.Background(), "anthropic/claude", fmt.Errorf("boom"))
+
+	app := fiber.New()
+	app.Get("/:model", func(c *fiber.Ctx) error {
+		srv.handleAllProvidersFailedFiber(c, c.Params("model"), nil)
+		return nil
+	})
+
+	tests := []struct {
+		model      string
+		retryAfter string
+	}{
+		{model: "gpt-4", retryAfter: "3"},
+		{model: "claude", retryAfter: "120"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest("GET", "/"+tt.model, nil))
+			require.NoError(t, err)
+			assert.Equal(t, fiber.StatusServiceUnavailable, resp.StatusCode)
+			assert.Equal(t, tt.retryAfter, resp.Header.Get("Retry-After"))
+
+			var body map[string]any
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+			assert.Equal(t, tt.retryAfter, fmt.Sprint(body["retry_after"]))
+		})
+	}
+}
@@ -45,9 +45,12 @@ func extractForwardHeaders(c *fiber.Ctx) map[string]string {
 	return headers
 }
 
+// buildRequestContext returns the context of a request to the backends, recording the
+// backends it is routed to, and its request id
 func buildRequestContext(c *fiber.Ctx) (context.Context, string) {
 	requestID, _ := c.Locals("request_id").(string)
-	return provider.WithRequestMetadata(c.UserContext(), requestID, c.OriginalURL()), requestID
+	ctx := provider.WithRequestMetadata(c.UserContext(), requestID, c.OriginalURL())
+	return withRouteAttempts(ctx), requestID
 }
 
 func isStreamingRequest(body []byte) bool {
@@ -0,0 +1,290 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/api/anthropic"
+	"github.com/macedot/openmodel/internal/api/openai"
+	applogger "github.com/macedot/openmodel/internal/logger"
+	"github.com/macedot/openmodel/internal/provider"
+	"github.com/macedot/openmodel/internal/server/converters"
+)
+
+// WebSocket credentials of browser clients, which cannot set headers on the handshake
+const (
+	wsSubprotocol             = "openmodel"         // Subprotocol echoed to clients that offer it
+	wsBearerSubprotocolPrefix = "openmodel.bearer." // Subprotocol carrying an API key or JWT
+	wsAPIKeyQueryParam        = "api_key"           // Query parameter carrying an API key or JWT
+)
+
+// wsEvent is a control frame sent to WebSocket clients alongside chat.completion.chunk frames
+type wsEvent struct {
+	Type       string `json:"type"`                 // "done" | "error"
+	Error      string `json:"error,omitempty"`      // Error message when Type is "error"
+	Experiment string `json:"experiment,omitempty"` // Experiment the request was part of, on "done"
+	Arm        string `json:"arm,omitempty"`        // Experiment arm that served the request, on "done"
+}
+
+// websocketCredentialsMiddleware lets clients of /ws/v1/chat that cannot set headers, such
+// as browsers, present their API key or JWT as an "openmodel.bearer.<key>" subprotocol or
+// an api_key query parameter. The key becomes the Authorization header of a handshake that
+// has none, before the API keys middleware reads it; the query parameter is removed from
+// the URL so it is not logged.
+func websocketCredentialsMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Path() != EndpointWSV1Chat {
+			return c.Next()
+		}
+		key := c.Query(wsAPIKeyQueryParam)
+		if key != "" {
+			args := c.Request().URI().QueryArgs()
+			args.Del(wsAPIKeyQueryParam)
+			uri := c.Path()
+			if query := args.String(); query != "" {
+				uri += "?" + query
+			}
+			c.Request().SetRequestURI(uri)
+		}
+		for _, protocol := range websocketSubprotocols(c) {
+			if bearer, ok := strings.CutPrefix(protocol, wsBearerSubprotocolPrefix); ok && bearer != "" {
+				key = bearer
+				break
+			}
+		}
+		if key != "" && requestAPIKey(requestHeader(c)) == "" {
+			c.Request().Header.Set(fiber.HeaderAuthorization, "Bearer "+key)
+		}
+		return c.Next()
+	}
+}
+
+// websocketSubprotocols returns the subprotocols a handshake offers
+func websocketSubprotocols(c *fiber.Ctx) []string {
+	var protocols []string
+	for _, protocol := range strings.Split(c.Get(fiber.HeaderSecWebSocketProtocol), ",") {
+		if protocol = strings.TrimSpace(protocol); protocol != "" {
+			protocols = append(protocols, protocol)
+		}
+	}
+	return protocols
+}
+
+// handleWSChat handles GET /ws/v1/chat. After the WebSocket upgrade, each text message
+// is a chat completion request; the response is streamed back as one JSON frame per
+// chat.completion.chunk, followed by {"type":"done"} (or {"type":"error"} on failure).
+// Clients offering the "openmodel" subprotocol are answered with it, as browsers require
+// of a handshake that offers subprotocols.
+func (s *Server) handleWSChat(c *fiber.Ctx) error {
+	if !strings.EqualFold(c.Get("Upgrade"), "websocket") || !strings.Contains(strings.ToLower(c.Get("Connection")), "upgrade") {
+		return handleError(c, "websocket upgrade required", fiber.StatusUpgradeRequired)
+	}
+	key := c.Get("Sec-WebSocket-Key")
+	if key == "" || c.Get("Sec-WebSocket-Version") != "13" {
+		return handleError(c, "invalid websocket handshake", fiber.StatusBadRequest)
+	}
+
+	requestID, _ := c.Locals("request_id").(string)
+	originalURL := c.OriginalURL()
+	forwardHeaders := extractForwardHeaders(c)
+	// Header values outlive the handshake for sticky routing of every message
+	requestHeaders := http.Header(c.GetReqHeaders())
+	clientKey, clientKeyID, authenticated := clientKeyFromContext(c.UserContext())
+	tenant, hasTenant := tenantFromContext(c.UserContext())
+
+	c.Set("Upgrade", "websocket")
+	c.Set("Connection", "Upgrade")
+	c.Set("Sec-WebSocket-Accept", websocketAcceptKey(key))
+	if slices.Contains(websocketSubprotocols(c), wsSubprotocol) {
+		c.Set(fiber.HeaderSecWebSocketProtocol, wsSubprotocol)
+	}
+	c.Status(fiber.StatusSwitchingProtocols)
+
+	c.Context().Hijack(func(conn net.Conn) {
+		// Server read/write timeouts do not apply to long-lived sockets
+		_ = conn.SetDeadline(time.Time{})
+
+		ctx, cancel := context.WithCancel(provider.WithRequestMetadata(context.Background(), requestID, originalURL))
+		defer cancel()
+		if authenticated {
+			ctx = withClientKey(ctx, clientKey, clientKeyID)
+		}
+		if hasTenant {
+			ctx = withTenant(ctx, tenant)
+		}
+
+		ws := newWSConn(conn, DefaultMaxRequestBody)
+		defer conn.Close()
+
+		applogger.Debug("websocket_connected", "request_id", requestID)
+		for {
+			opcode, msg, err := ws.readMessage()
+			if err != nil {
+				applogger.Debug("websocket_closed", "request_id", requestID, "reason", err.Error())
+				return
+			}
+			if opcode != wsOpText {
+				s.writeWSEvent(ws, wsEvent{Type: "error", Error: "expected a text message with a chat completion request"})
+				continue
+			}
+			if err := s.streamChatOverWS(ctx, ws, msg, forwardHeaders, requestHeaders.Get); err != nil {
+				applogger.Info("client_disconnected", "request_id", requestID, "error", err.Error())
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// streamChatOverWS routes one chat completion request with failover and streams it to ws.
+// It returns an error only when writing to the socket fails or the client went away.
+func (s *Server) streamChatOverWS(ctx context.Context, ws *wsConn, body []byte, headers map[string]string, header func(string) string) error {
+	requestID := provider.RequestIDFromContext(ctx)
+
+	// Each message is a request in flight of its own; the socket is not
+	ctx, inFlight, ok := s.drain.begin(withRouteAttempts(ctx))
+	if !ok {
+		return s.writeWSEvent(ws, wsEvent{Type: "error", Error: "server is draining"})
+	}
+	defer inFlight.done()
+
+	if err := openai.ValidateChatCompletionRequest(body); err != nil {
+		return s.writeWSEvent(ws, wsEvent{Type: "error", Error: err.Error()})
+	}
+	requested := extractModelFromRequestBody(body)
+	if err := s.authorizeModel(ctx, header, requested); err != nil {
+		return s.writeWSEvent(ws, wsEvent{Type: "error", Error: err.Error()})
+	}
+	model, err := s.resolveModel(ctx, requested)
+	if err != nil {
+		return s.writeWSEvent(ws, wsEvent{Type: "error", Error: err.Error()})
+	}
+	body, err = s.applyGuardrails(ctx, requested, body, headers)
+	if err != nil {
+		return s.writeWSEvent(ws, wsEvent{Type: "error", Error: "request blocked by guardrails: " + err.Error()})
+	}
+	model = s.applyRoutingRules(requested, model, body, header)
+	model, experiment := s.assignExperiment(model, body)
+	ctx = withExperiment(ctx, experiment)
+	body = forceStreaming(body)
+	ctx = s.withStickyKey(ctx, model, body, header)
+	ctx = withRequiredCapabilities(ctx, requestCapabilities(body))
+	ctx = withUsageAttribution(ctx, model, header)
+
+	ctx, ticket, err := s.admit(ctx, model, header)
+	if err != nil {
+		return s.writeWSEvent(ws, wsEvent{Type: "error", Error: err.Error()})
+	}
+	defer ticket.done()
+
+	// Cancelling on return stops the upstream stream if the client goes away mid-response
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for {
+		prov, providerKey, providerModel, err := s.findProviderWithFailover(ctx, model)
+		if err != nil {
+			return s.writeWSEvent(ws, wsEvent{Type: "error", Error: fmt.Sprintf("model %q temporarily unavailable: %v", model, err)})
+		}
+
+		plan, err := buildRoutingPlan(converters.APIFormatOpenAI, EndpointV1ChatCompletions, prov.APIMode())
+		if err != nil {
+			return s.writeWSEvent(ws, wsEvent{Type: "error", Error: err.Error()})
+		}
+		forwardBody, attemptHeaders, err := prepareForwardRequest(body, headers, providerModel, plan)
+		if err != nil {
+			return s.writeWSEvent(ws, wsEvent{Type: "error", Error: "failed to convert request: " + err.Error()})
+		}
+		forwardBody = s.rewriteOptions(model, providerKey, forwardBody)
+
+		applogger.Debug("ROUTING", "request_id", requestID, "provider", providerKey, "model", providerModel, "transport", "websocket")
+
+		release, err := s.trackInFlight(providerKey)
+		if err != nil {
+			s.handleProviderError(ctx, providerKey, err)
+			continue
+		}
+		var stream <-chan []byte
+		err = s.withRetry(ctx, model, providerKey, func() (err error) {
+			stream, err = s.openTimedStream(ctx, model, providerKey, plan.targetFormat, func(ctx context.Context) (<-chan []byte, error) {
+				return prov.DoStreamRequest(ctx, plan.forwardEndpoint, forwardBody, attemptHeaders)
+			})
+			return err
+		})
+		if err != nil {
+			release()
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			s.handleProviderError(ctx, providerKey, err)
+			if _, _, ok := clientErrorOf(err); ok {
+				return s.writeWSEvent(ws, wsEvent{Type: "error", Error: err.Error()})
+			}
+			continue
+		}
+
+		streamID := fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano())
+		isFirst := true
+		blockIdx := 0
+		state := &converters.StreamState{IsFirst: &isFirst, BlockIdx: &blockIdx, Metrics: &anthropic.StreamMetrics{}}
+
+		var usage openai.Usage
+		for line := range stream {
+			out := string(line)
+			observeUpstreamUsage(out, &usage)
+			if plan.converter != nil {
+				out = plan.converter.ConvertStreamLine(out, model, streamID, state)
+			}
+			for _, l := range strings.Split(out, "\n") {
+				data, ok := strings.CutPrefix(l, SSEDataPrefix)
+				if !ok || data == "[DONE]" || data == "" {
+					continue
+				}
+				if err := ws.writeText([]byte(data)); err != nil {
+					release()
+					return err
+				}
+			}
+		}
+		release()
+
+		s.recordSuccess(providerKey)
+		s.recordUsage(ctx, providerKey, usage)
+		done := wsEvent{Type: "done"}
+		if experiment != nil {
+			done.Experiment, done.Arm = experiment.experiment, experiment.arm
+		}
+		return s.writeWSEvent(ws, done)
+	}
+}
+
+// writeWSEvent sends a control event frame
+func (s *Server) writeWSEvent(ws *wsConn, event wsEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return ws.writeText(data)
+}
+
+// forceStreaming sets "stream": true on a JSON request body
+func forceStreaming(body []byte) []byte {
+	var req map[string]any
+	if err := json.Unmarshal(body, &req); err != nil {
+		return body
+	}
+	req["stream"] = true
+	result, err := json.Marshal(req)
+	if err != nil {
+		return body
+	}
+	return result
+}
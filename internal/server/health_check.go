@@ -0,0 +1,126 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	applogger "github.com/macedot/openmodel/internal/logger"
+	"github.com/macedot/openmodel/internal/provider"
+)
+
+// RunHealthChecks probes every provider in the background until ctx is cancelled. The
+// configuration is re-read each round, so enabling health_check takes effect on reload.
+func (s *Server) RunHealthChecks(ctx context.Context) {
+	for {
+		cfg := s.GetConfig()
+		if cfg.HealthCheck.IsEnabled() {
+			s.checkProviders(ctx, cfg)
+		}
+
+		timer := time.NewTimer(cfg.HealthCheck.GetInterval())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// checkProviders runs one health check against every provider used by a model
+func (s *Server) checkProviders(ctx context.Context, cfg *config.Config) {
+	backends := make(map[string][]string)
+	seen := make(map[string]bool)
+	for _, modelConfig := range cfg.Models {
+		for _, p := range modelConfig.Providers {
+			if key := formatProviderKey(p); !seen[key] {
+				seen[key] = true
+				backends[p.Provider] = append(backends[p.Provider], key)
+			}
+		}
+	}
+
+	providers := s.GetProviders()
+	var wg sync.WaitGroup
+	for name, keys := range backends {
+		prov, ok := providers[name]
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.checkProvider(ctx, cfg.HealthCheck, prov, keys)
+		}()
+	}
+	wg.Wait()
+}
+
+// checkProvider requests the health check endpoint of one provider. When the provider is
+// unreachable, times out or answers with a server error, its backends are taken out of
+// rotation until the next check; once it answers again, the backends it took out are
+// restored. Other errors (e.g. 404 for an endpoint the provider lacks) are not an outage.
+func (s *Server) checkProvider(ctx context.Context, hc *config.HealthCheckConfig, prov requestProvider, backends []string) {
+	requester, ok := prov.(provider.MethodRequester)
+	if !ok {
+		return
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, hc.GetTimeout())
+	defer cancel()
+
+	_, err := requester.DoMethodRequest(checkCtx, fiber.MethodGet, hc.GetEndpoint(), nil, nil)
+	if ctx.Err() != nil {
+		return
+	}
+
+	if err != nil {
+		if class := classifyError(err); class == errorClassServer || class == errorClassTimeout {
+			applogger.Warn("health_check_failed", "provider", prov.Name(), "error_class", class.String(), "error", err.Error())
+			for _, key := range backends {
+				// Backends already out of rotation for other failures keep their cooldown
+				if s.state.IsAvailable(key, s.breakerPolicy(key).Threshold) || s.healthMarked(key) {
+					s.healthMark(key, true)
+					s.state.Suspend(key, hc.GetInterval())
+					s.backendDown(key, notifyReasonHealthCheck, err)
+				}
+			}
+			return
+		}
+	}
+
+	for _, key := range backends {
+		if s.healthMark(key, false) {
+			applogger.Info("health_check_recovered", "provider", prov.Name(), "backend", key)
+			s.state.ResetModel(key)
+			s.backendUp(key)
+		}
+	}
+}
+
+// healthMarked reports whether a health check took a backend out of rotation
+func (s *Server) healthMarked(backend string) bool {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	return s.healthDown[backend]
+}
+
+// healthMark records whether a health check took a backend out of rotation and
+// reports whether it had been marked before
+func (s *Server) healthMark(backend string, down bool) bool {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	if s.healthDown == nil {
+		s.healthDown = make(map[string]bool)
+	}
+	was := s.healthDown[backend]
+	if down {
+		s.healthDown[backend] = true
+	} else {
+		delete(s.healthDown, backend)
+	}
+	return was
+}
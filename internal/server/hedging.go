@@ -0,0 +1,215 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"context"
+	"time"
+
+	applogger "github.com/macedot/openmodel/internal/logger"
+	"github.com/macedot/openmodel/internal/provider"
+	"github.com/macedot/openmodel/internal/server/converters"
+)
+
+// streamOpener starts a streaming request against one provider
+type streamOpener func(ctx context.Context, p providerResult) (<-chan []byte, error)
+
+// hedgeResult is the outcome of one stream attempt up to its first content token
+type hedgeResult struct {
+	attempt  providerResult
+	ctx      context.Context
+	stream   <-chan []byte
+	buffered [][]byte // Lines read up to and including the first content token
+	cancel   context.CancelFunc
+	err      error
+}
+
+// openStream starts a stream on primary. When the model has hedging enabled and primary
+// produces no content token within the hedge delay, the same request is also sent to the
+// next available provider with the same API mode; the first to produce a token, or to end
+// its stream, wins and the other is cancelled. Lines such as a role chunk sent before the
+// first token do not decide the race. format is that of the upstream stream. It returns
+// the winning provider, its stream and a func that must be called once the stream has
+// been consumed.
+func (s *Server) openStream(ctx context.Context, model string, primary providerResult, format converters.APIFormat, open streamOpener) (providerResult, <-chan []byte, func(), error) {
+	delay := s.GetConfig().Models[model].GetHedgeDelay()
+	if delay <= 0 {
+		release, err := s.trackInFlight(primary.providerKey)
+		if err != nil {
+			return primary, nil, nil, err
+		}
+		var stream <-chan []byte
+		err = s.withRetry(ctx, model, primary.providerKey, func() (err error) {
+			stream, err = open(ctx, primary)
+			return err
+		})
+		if err != nil {
+			release()
+			s.recordStreamFailure(ctx, primary.providerKey, err)
+			return primary, nil, nil, err
+		}
+		return primary, stream, release, nil
+	}
+
+	results := make(chan hedgeResult, 2)
+	cancels := make(map[string]context.CancelFunc, 2)
+	start := func(p providerResult) {
+		attemptCtx, cancel := context.WithCancel(ctx)
+		cancels[p.providerKey] = cancel
+		release, err := s.trackInFlight(p.providerKey)
+		if err != nil {
+			cancel()
+			results <- hedgeResult{attempt: p, err: err}
+			return
+		}
+		go func() {
+			var stream <-chan []byte
+			err := s.withRetry(attemptCtx, model, p.providerKey, func() (err error) {
+				stream, err = open(attemptCtx, p)
+				return err
+			})
+			if err != nil {
+				release()
+				cancel()
+				results <- hedgeResult{attempt: p, err: err}
+				return
+			}
+			var buffered [][]byte
+			for line := range stream {
+				buffered = append(buffered, line)
+				if carriesToken(string(line), format) {
+					break
+				}
+			}
+			results <- hedgeResult{attempt: p, ctx: attemptCtx, stream: stream, buffered: buffered, cancel: func() {
+				cancel()
+				release()
+			}}
+		}()
+	}
+
+	start(primary)
+	pending := 1
+	hedged := false
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var lastErr error
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			if hedged {
+				continue
+			}
+			if backup, ok := s.nextProviderCandidate(ctx, model, primary, map[string]bool{primary.providerKey: true}); ok {
+				applogger.Info("hedged_request",
+					"request_id", provider.RequestIDFromContext(ctx),
+					"model", model,
+					"primary", primary.providerKey,
+					"backup", backup.providerKey)
+				hedged = true
+				pending++
+				start(backup)
+			}
+
+		case res := <-results:
+			pending--
+			if res.err != nil {
+				s.recordStreamFailure(ctx, res.attempt.providerKey, res.err)
+				lastErr = res.err
+				// Hedge right away when the primary fails before the delay elapses
+				if !hedged && pending == 0 {
+					if backup, ok := s.nextProviderCandidate(ctx, model, primary, map[string]bool{primary.providerKey: true}); ok {
+						hedged = true
+						pending++
+						start(backup)
+					}
+				}
+				continue
+			}
+			if pending > 0 {
+				for key, cancel := range cancels {
+					if key != res.attempt.providerKey {
+						cancel()
+					}
+				}
+				go discardLoser(results)
+			}
+			return res.attempt, prependLines(res), res.cancel, nil
+		}
+	}
+	return primary, nil, nil, lastErr
+}
+
+// nextProviderCandidate returns the next available provider for model that accepts the
+// same request format as like, is not in exclude, has not failed the request, and that
+// its circuit breaker admits
+func (s *Server) nextProviderCandidate(ctx context.Context, model string, like providerResult, exclude map[string]bool) (providerResult, bool) {
+	cfg := s.GetConfig()
+	modelConfig, ok := cfg.Models[model]
+	if !ok {
+		return providerResult{}, false
+	}
+	attempts := routeAttemptsFromContext(ctx)
+	for _, p := range s.findAvailableProvidersForModel(modelConfig.Providers, requiredCapabilitiesFromContext(ctx)) {
+		if exclude[p.providerKey] || attempts.hasFailed(p.providerKey) || p.provider.APIMode() != like.provider.APIMode() {
+			continue
+		}
+		if attempts.claim(p.providerKey, func() bool { return s.state.Allow(p.providerKey, s.breakerPolicy(p.providerKey)) }) {
+			return p, true
+		}
+	}
+	return providerResult{}, false
+}
+
+// recordStreamFailure logs a failed stream attempt and counts it against the provider.
+// The request is not routed to the provider again.
+func (s *Server) recordStreamFailure(ctx context.Context, providerKey string, err error) {
+	routeAttemptsFromContext(ctx).fail(providerKey)
+	switch classifyError(err) {
+	case errorClassSaturated:
+		applogger.Debug("provider_saturated", "provider", providerKey)
+		return
+	case errorClassCanceled:
+		applogger.Debug("provider_attempt_canceled", "provider", providerKey)
+		return
+	}
+	applogger.Warn("provider_stream_failed",
+		"request_id", provider.RequestIDFromContext(ctx),
+		"provider", providerKey,
+		"error_class", classifyError(err).String(),
+		"error", err.Error())
+	s.recordProviderFailure(providerKey, err)
+}
+
+// discardLoser waits for the cancelled attempt that lost the race, releases it and drains its stream
+func discardLoser(results <-chan hedgeResult) {
+	res := <-results
+	if res.err != nil {
+		return
+	}
+	res.cancel()
+	for range res.stream {
+	}
+}
+
+// prependLines returns a stream that yields the lines already read before the rest. Once
+// the attempt is cancelled the remaining upstream lines are drained and dropped.
+func prependLines(res hedgeResult) <-chan []byte {
+	out := make(chan []byte, len(res.buffered))
+	for _, line := range res.buffered {
+		out <- line
+	}
+	go func() {
+		defer close(out)
+		for line := range res.stream {
+			select {
+			case out <- line:
+			case <-res.ctx.Done():
+				for range res.stream {
+				}
+				return
+			}
+		}
+	}()
+	return out
+}
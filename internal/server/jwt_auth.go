@@ -0,0 +1,58 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"context"
+
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/jwtauth"
+	applogger "github.com/macedot/openmodel/internal/logger"
+	"github.com/macedot/openmodel/internal/usage"
+)
+
+// jwtKeyPrefix starts the API key name of a client authenticated with a JWT, followed by
+// its identity
+const jwtKeyPrefix = "jwt:"
+
+// newJWTVerifier creates the verifier of the jwt config, nil when it is disabled
+func newJWTVerifier(cfg *config.Config) *jwtauth.Verifier {
+	if !cfg.JWT.IsEnabled() {
+		return nil
+	}
+	return jwtauth.New(jwtauth.Config{
+		Issuer:   cfg.JWT.Issuer,
+		Audience: cfg.JWT.Audience,
+		JWKSURL:  cfg.JWT.JWKSURL,
+	})
+}
+
+// jwtEnabled reports whether clients may present a JWT
+func (s *Server) jwtEnabled(cfg *config.Config) bool {
+	return s.jwt != nil && cfg.JWT.IsEnabled()
+}
+
+// lookupJWT returns the API key and key id of a client presenting a JWT: the limits of the
+// first role its claims match, under the name and id of its identity, so its quotas and
+// rates hold across the tokens it is issued. Rejected tokens are logged.
+func (s *Server) lookupJWT(ctx context.Context, cfg *config.Config, token string) (config.APIKey, string, bool) {
+	if !s.jwtEnabled(cfg) || !jwtauth.LooksLikeJWT(token) {
+		return config.APIKey{}, "", false
+	}
+	claims, err := s.jwt.Verify(ctx, token)
+	if err != nil {
+		applogger.Warn("jwt_rejected", "error", err)
+		return config.APIKey{}, "", false
+	}
+	identity := claims.Strings(cfg.JWT.GetIdentityClaim())
+	if len(identity) == 0 || identity[0] == "" {
+		applogger.Warn("jwt_rejected", "error", "no "+cfg.JWT.GetIdentityClaim()+" claim")
+		return config.APIKey{}, "", false
+	}
+	name := jwtKeyPrefix + identity[0]
+	role, ok := cfg.JWT.MatchRole(claims.Strings)
+	if !ok {
+		applogger.Warn("jwt_rejected", "key", name, "error", "no role matches the token")
+		return config.APIKey{}, "", false
+	}
+	return role.APIKey(name), usage.KeyID(name), true
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestIssuer serves the JWKS of a signing key and returns a function issuing tokens
+// signed with it
+func newTestIssuer(t *testing.T) (*httptest.Server, func(claims map[string]any) string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwks := map[string]any{"keys": []map[string]string{{
+		"kty": "RSA", "kid": "k1", "n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes()),
+	}}}
+	issuer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jwks)
+	}))
+	t.Cleanup(issuer.Close)
+
+	sign := func(claims map[string]any) string {
+		claims["iss"] = issuer.URL
+		claims["aud"] = "openmodel"
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+		header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1"})
+		payload, _ := json.Marshal(claims)
+		signed := b64(header) + "." + b64(payload)
+		digest := sha256.Sum256([]byte(signed))
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+		return signed + "." + b64(signature)
+	}
+	return issuer, sign
+}
+
+func TestAPIKeys_JWT(t *testing.T) {
+	prov := &stubProvider{
+		name: "ollama",
+		doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+			return []byte(`{"id":"c1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}]}`), nil
+		},
+	}
+	issuer, sign := newTestIssuer(t)
+	srv := newStreamingTestServer(prov)
+	srv.config.APIKeys = []config.APIKey{{Name: "static", Key: "sk-static"}}
+	srv.config.JWT = &config.JWTConfig{
+		Issuer:   issuer.URL,
+		Audience: "openmodel",
+		JWKSURL:  issuer.URL,
+		Roles: []config.JWTRole{
+			{Name: "dev", Claim: "groups", Value: "dev", Models: []string{"gpt-4"}, RPM: 1},
+			{Name: "ops", Claim: "groups", Value: "ops", Models: []string{"ops-*"}},
+		},
+	}
+	srv.jwt = newJWTVerifier(srv.config)
+	app := fiber.New()
+	app.Use(srv.apiKeysMiddleware())
+	srv.registerRoutes(app)
+
+	do := func(key string) (*http.Response, string) {
+		req := httptest.NewRequest("POST", EndpointV1ChatCompletions, strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		data, _ := io.ReadAll(resp.Body)
+		return resp, string(data)
+	}
+
+	resp, body := do(sign(map[string]any{"sub": "alice", "groups": []string{"staff", "dev"}}))
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode, body)
+	assert.Equal(t, "1", resp.Header.Get(HeaderXRateLimitLimitRequests))
+
+	// Rates hold per identity, across the tokens it is issued
+	resp, _ = do(sign(map[string]any{"sub": "alice", "groups": "dev", "jti": "2"}))
+	assert.Equal(t, fiber.StatusTooManyRequests, resp.StatusCode)
+	resp, _ = do(sign(map[string]any{"sub": "bob", "groups": "dev"}))
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	// Roles limit the models
+	resp, body = do(sign(map[string]any{"sub": "carol", "groups": "ops"}))
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+	assert.Contains(t, body, `api key \"jwt:carol\" may not use model \"gpt-4\"`)
+
+	// Tokens matching no role, without an identity or from another audience are refused
+	for _, claims := range []map[string]any{
+		{"sub": "dave", "groups": "guests"},
+		{"groups": "dev"},
+	} {
+		resp, _ = do(sign(claims))
+		assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+	}
+	srv.config.JWT.Audience = "other"
+	srv.jwt = newJWTVerifier(srv.config)
+	resp, _ = do(sign(map[string]any{"sub": "erin", "groups": "dev"}))
+	assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+
+	// Configured keys keep working
+	resp, _ = do("sk-static")
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+}
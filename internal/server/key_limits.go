@@ -0,0 +1,198 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	applogger "github.com/macedot/openmodel/internal/logger"
+)
+
+// keyLimitIdle is how long the buckets of an unused key are kept once they are full
+const keyLimitIdle = 2 * time.Minute
+
+// keyLimiter enforces the requests and tokens per minute of API keys with a token bucket
+// per key and limit. The tokens of a request are only known once it completes, so they
+// are taken from the bucket afterwards and may overdraw it: the key is then refused
+// until the bucket has refilled. The zero value is ready to use.
+type keyLimiter struct {
+	mu          sync.Mutex
+	buckets     map[string]*keyBuckets
+	lastCleanup time.Time
+}
+
+// keyBuckets are the buckets of one API key
+type keyBuckets struct {
+	requests minuteBucket
+	tokens   minuteBucket
+	lastSeen time.Time
+}
+
+// minuteBucket holds up to limit tokens and refills at limit tokens per minute
+type minuteBucket struct {
+	limit  int
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens earned since the last refill. A new or changed limit, as after
+// a config reload, starts a full bucket.
+func (b *minuteBucket) refill(limit int, now time.Time) {
+	if b.limit != limit {
+		*b = minuteBucket{limit: limit, tokens: float64(limit), last: now}
+		return
+	}
+	b.tokens = minf(b.tokens+now.Sub(b.last).Minutes()*float64(limit), float64(limit))
+	b.last = now
+}
+
+// until is the time until the bucket holds n tokens
+func (b *minuteBucket) until(n float64) time.Duration {
+	if b.limit <= 0 || b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / float64(b.limit) * float64(time.Minute))
+}
+
+// keyLimitStatus is the state of a key's limits after a request was checked
+type keyLimitStatus struct {
+	allowed  bool
+	exceeded string // "requests" or "tokens" when the request was refused
+	requests limitState
+	tokens   limitState
+}
+
+// limitState is what the rate limit headers report of one limit
+type limitState struct {
+	limit     int
+	remaining int
+	reset     time.Duration // Until the bucket is full again
+	wait      time.Duration // Until the next request fits
+}
+
+func newLimitState(b *minuteBucket) limitState {
+	return limitState{
+		limit:     b.limit,
+		remaining: max(int(math.Floor(b.tokens)), 0),
+		reset:     b.until(float64(b.limit)),
+		wait:      b.until(1),
+	}
+}
+
+// allow takes a request from the buckets of the key with the given id, limited to rpm
+// requests and tpm tokens per minute (0: unlimited)
+func (l *keyLimiter) allow(id string, rpm, tpm int) keyLimitStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.buckets == nil {
+		l.buckets = make(map[string]*keyBuckets)
+	}
+	if now.Sub(l.lastCleanup) > keyLimitIdle {
+		l.cleanup(now)
+	}
+	b, ok := l.buckets[id]
+	if !ok {
+		b = &keyBuckets{}
+		l.buckets[id] = b
+	}
+	b.lastSeen = now
+	b.requests.refill(rpm, now)
+	b.tokens.refill(tpm, now)
+
+	status := keyLimitStatus{allowed: true}
+	switch {
+	case rpm > 0 && b.requests.tokens < 1:
+		status.allowed, status.exceeded = false, "requests"
+	case tpm > 0 && b.tokens.tokens < 1:
+		status.allowed, status.exceeded = false, "tokens"
+	case rpm > 0:
+		b.requests.tokens--
+	}
+	status.requests = newLimitState(&b.requests)
+	status.tokens = newLimitState(&b.tokens)
+	return status
+}
+
+// consume takes the tokens a completed request used from the bucket of its key
+func (l *keyLimiter) consume(id string, tokens int) {
+	if id == "" || tokens <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.buckets[id]; ok && b.tokens.limit > 0 {
+		b.tokens.refill(b.tokens.limit, time.Now())
+		b.tokens.tokens -= float64(tokens)
+	}
+}
+
+// cleanup removes the buckets of keys that have been unused long enough to be full
+func (l *keyLimiter) cleanup(now time.Time) {
+	for id, b := range l.buckets {
+		b.requests.refill(b.requests.limit, now)
+		b.tokens.refill(b.tokens.limit, now)
+		if now.Sub(b.lastSeen) > keyLimitIdle && b.requests.until(float64(b.requests.limit)) == 0 && b.tokens.until(float64(b.tokens.limit)) == 0 {
+			delete(l.buckets, id)
+		}
+	}
+	l.lastCleanup = now
+}
+
+// limitKey checks a request against the rate limits of its API key, setting the rate
+// limit headers, and answers 429 when the key is over a limit
+func (s *Server) limitKey(c *fiber.Ctx, group, id string, key config.APIKey) error {
+	if key.RPM <= 0 && key.TPM <= 0 {
+		return c.Next()
+	}
+	status := s.keyLimits.allow(id, key.RPM, key.TPM)
+	if key.RPM > 0 {
+		setLimitHeaders(c, status.requests, HeaderXRateLimitLimitRequests, HeaderXRateLimitRemainingRequests, HeaderXRateLimitResetRequests)
+	}
+	if key.TPM > 0 {
+		setLimitHeaders(c, status.tokens, HeaderXRateLimitLimitTokens, HeaderXRateLimitRemainingTokens, HeaderXRateLimitResetTokens)
+	}
+	if status.allowed {
+		return c.Next()
+	}
+
+	state, limit := status.requests, key.RPM
+	if status.exceeded == "tokens" {
+		state, limit = status.tokens, key.TPM
+	}
+	requestID, _ := c.Locals("request_id").(string)
+	applogger.Warn("api_key_rate_limited", "request_id", requestID, "key", key.Name, "limit", status.exceeded)
+	c.Set(HeaderRetryAfter, strconv.Itoa(int(math.Ceil(state.wait.Seconds()))))
+	message := fmt.Sprintf("Rate limit reached for api key %q on %s per minute: Limit %d. Please try again in %s.",
+		key.Name, status.exceeded, limit, state.wait.Round(time.Millisecond))
+	return keyLimitError(c, group, message, status.exceeded, "rate_limit_exceeded")
+}
+
+// keyLimitError answers 429 for a key over a limit: an OpenAI error with the given type
+// and code, or an Anthropic rate limit error on the Anthropic endpoints
+func keyLimitError(c *fiber.Ctx, group, message, errType, code string) error {
+	if group == config.EndpointsAnthropic {
+		return handleAnthropicError(c, message, anthropicRateLimitError, fiber.StatusTooManyRequests)
+	}
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"error": fiber.Map{
+			"message": message,
+			"type":    errType,
+			"param":   nil,
+			"code":    code,
+		},
+	})
+}
+
+// setLimitHeaders sets the rate limit headers of one limit
+func setLimitHeaders(c *fiber.Ctx, state limitState, limitHeader, remainingHeader, resetHeader string) {
+	c.Set(limitHeader, strconv.Itoa(state.limit))
+	c.Set(remainingHeader, strconv.Itoa(state.remaining))
+	c.Set(resetHeader, state.reset.Round(time.Millisecond).String())
+}
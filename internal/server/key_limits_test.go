@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyLimiter(t *testing.T) {
+	var l keyLimiter
+
+	// Requests per minute
+	for range 3 {
+		assert.True(t, l.allow("a", 3, 0).allowed)
+	}
+	status := l.allow("a", 3, 0)
+	assert.False(t, status.allowed)
+	assert.Equal(t, "requests", status.exceeded)
+	assert.Zero(t, status.requests.remaining)
+	assert.InDelta(t, 20*time.Second, status.requests.wait, float64(time.Second))
+	// The bucket refills at rpm per minute
+	l.buckets["a"].requests.last = l.buckets["a"].requests.last.Add(-20 * time.Second)
+	assert.True(t, l.allow("a", 3, 0).allowed)
+	// Other keys have their own buckets
+	assert.True(t, l.allow("b", 3, 0).allowed)
+
+	// Tokens per minute are taken once a request completes and may overdraw the bucket
+	status = l.allow("c", 0, 1000)
+	assert.True(t, status.allowed)
+	assert.Equal(t, 1000, status.tokens.remaining)
+	l.consume("c", 1500)
+	status = l.allow("c", 0, 1000)
+	assert.False(t, status.allowed)
+	assert.Equal(t, "tokens", status.exceeded)
+	assert.InDelta(t, 30*time.Second, status.tokens.wait, float64(time.Second))
+	assert.InDelta(t, 90*time.Second, status.tokens.reset, float64(time.Second))
+
+	// A changed limit starts a full bucket
+	assert.True(t, l.allow("c", 0, 2000).allowed)
+	// Usage of keys without a bucket is ignored
+	l.consume("unknown", 10)
+	l.consume("", 10)
+}
+
+func TestAPIKeys_RateLimit(t *testing.T) {
+	prov := &stubProvider{
+		name: "ollama",
+		doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+			return []byte(`{"id":"c1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}],"usage":{"prompt_tokens":60,"completion_tokens":50,"total_tokens":110}}`), nil
+		},
+	}
+	srv := newStreamingTestServer(prov)
+	srv.config.APIKeys = []config.APIKey{
+		{Name: "rpm", Key: "sk-rpm", RPM: 1},
+		{Name: "tpm", Key: "sk-tpm", TPM: 100},
+		{Name: "free", Key: "sk-free"},
+	}
+	app := fiber.New()
+	app.Use(srv.apiKeysMiddleware())
+	srv.registerRoutes(app)
+
+	do := func(path, key, body string) (*http.Response, []byte) {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("anthropic-version", "2023-06-01")
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		data, _ := io.ReadAll(resp.Body)
+		return resp, data
+	}
+	chat := `{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`
+
+	resp, data := do(EndpointV1ChatCompletions, "sk-rpm", chat)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode, string(data))
+	assert.Equal(t, "1", resp.Header.Get(HeaderXRateLimitLimitRequests))
+	assert.Equal(t, "0", resp.Header.Get(HeaderXRateLimitRemainingRequests))
+	assert.NotEmpty(t, resp.Header.Get(HeaderXRateLimitResetRequests))
+	assert.Empty(t, resp.Header.Get(HeaderXRateLimitLimitTokens))
+
+	resp, data = do(EndpointV1ChatCompletions, "sk-rpm", chat)
+	assert.Equal(t, fiber.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "60", resp.Header.Get(HeaderRetryAfter))
+	var body struct {
+		Error struct {
+			Message string `json:"message"`
+			Type    string `json:"type"`
+			Code    string `json:"code"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(data, &body))
+	assert.Equal(t, "requests", body.Error.Type)
+	assert.Equal(t, "rate_limit_exceeded", body.Error.Code)
+	assert.Contains(t, body.Error.Message, "Rate limit reached")
+
+	// Anthropic clients get an Anthropic error
+	resp, data = do(EndpointV1Messages, "sk-rpm", `{"model":"gpt-4","max_tokens":10,"messages":[{"role":"user","content":"hello"}]}`)
+	assert.Equal(t, fiber.StatusTooManyRequests, resp.StatusCode)
+	assert.Contains(t, string(data), anthropicRateLimitError)
+
+	// The tokens of a completed request count against the key's tokens per minute
+	resp, data = do(EndpointV1ChatCompletions, "sk-tpm", chat)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Equal(t, "100", resp.Header.Get(HeaderXRateLimitRemainingTokens))
+	resp, data = do(EndpointV1ChatCompletions, "sk-tpm", chat)
+	assert.Equal(t, fiber.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "0", resp.Header.Get(HeaderXRateLimitRemainingTokens))
+	assert.Contains(t, string(data), `"type":"tokens"`)
+
+	// Keys without rates are not limited and get no rate limit headers
+	for range 3 {
+		resp, _ = do(EndpointV1ChatCompletions, "sk-free", chat)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get(HeaderXRateLimitLimitRequests))
+	}
+}
@@ -0,0 +1,243 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	applogger "github.com/macedot/openmodel/internal/logger"
+	"github.com/macedot/openmodel/internal/usage"
+)
+
+// quotaTracker adds up the tokens and cost of each API key and tenant with a quota in the
+// current UTC month. A key's month starts from the usage store, when usage accounting is
+// enabled, so quotas survive restarts; otherwise it starts over with the server.
+type quotaTracker struct {
+	mu    sync.Mutex
+	usage map[string]monthUsage
+}
+
+// monthUsage is what a key has used in a month
+type monthUsage struct {
+	Month  string // "2006-01"
+	Tokens int64
+	Cost   float64
+}
+
+// quotaMonth returns the UTC month containing now and the time it ends
+func quotaMonth(now time.Time) (string, time.Time) {
+	now = now.UTC()
+	return now.Format("2006-01"), time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// current returns what the key with the given id has used in the month containing now,
+// loading it with load the first time the key is seen in the month
+func (t *quotaTracker) current(id string, now time.Time, load func(month string) monthUsage) monthUsage {
+	month, _ := quotaMonth(now)
+	t.mu.Lock()
+	u, ok := t.usage[id]
+	t.mu.Unlock()
+	if ok && u.Month == month {
+		return u
+	}
+
+	loaded := load(month)
+	loaded.Month = month
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.usage == nil {
+		t.usage = make(map[string]monthUsage)
+	}
+	// A request that completed while loading was already added
+	if u, ok := t.usage[id]; ok && u.Month == month {
+		return u
+	}
+	t.usage[id] = loaded
+	return loaded
+}
+
+// add records the tokens and cost of a completed request against a tracked key
+func (t *quotaTracker) add(id string, tokens int64, cost float64, now time.Time) {
+	month, _ := quotaMonth(now)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u, ok := t.usage[id]
+	if !ok || u.Month != month {
+		return
+	}
+	u.Tokens += tokens
+	u.Cost += cost
+	t.usage[id] = u
+}
+
+// tenantQuotaID is the id a tenant's usage is tracked by, apart from the key ids
+func tenantQuotaID(name string) string {
+	return "tenant:" + name
+}
+
+// loadQuotaUsage returns the usage matching filter since the start of month according to
+// the usage store. A failing store is logged and counts as no usage.
+func (s *Server) loadQuotaUsage(ctx context.Context, id, month string, filter usage.Filter) monthUsage {
+	filter.From = month + "-01"
+	records, err := s.usage.Query(ctx, filter)
+	if err != nil {
+		applogger.Warn("quota_usage_load_failed", "key_id", id, "error", err)
+		return monthUsage{}
+	}
+	var u monthUsage
+	for _, r := range records {
+		u.Tokens += r.TotalTokens
+		u.Cost += r.Cost
+	}
+	return u
+}
+
+// keyQuota is the state of the monthly quota of a key or a tenant
+type keyQuota struct {
+	Name            string    `json:"name"`
+	ID              string    `json:"id,omitempty"` // Unset for tenants
+	MonthlyTokens   int64     `json:"monthly_tokens,omitempty"`
+	UsedTokens      int64     `json:"used_tokens"`
+	RemainingTokens *int64    `json:"remaining_tokens,omitempty"`
+	MonthlyBudget   float64   `json:"monthly_budget,omitempty"`
+	UsedCost        float64   `json:"used_cost"`
+	RemainingBudget *float64  `json:"remaining_budget,omitempty"`
+	ResetsAt        time.Time `json:"resets_at"`
+	Exhausted       bool      `json:"exhausted"`
+}
+
+// quota returns the state of the monthly quota of a key with the given id
+func (s *Server) quota(ctx context.Context, id string, key config.APIKey) keyQuota {
+	filter := usage.Filter{APIKey: id, GroupBy: []string{usage.ColumnAPIKey}}
+	q := s.monthlyQuota(ctx, id, filter, key.MonthlyTokens, key.MonthlyBudget)
+	q.Name = key.Name
+	q.ID = id
+	return q
+}
+
+// tenantQuota returns the state of the monthly quota of a tenant
+func (s *Server) tenantQuota(ctx context.Context, tenant config.Tenant) keyQuota {
+	filter := usage.Filter{Tenant: tenant.Name, GroupBy: []string{usage.ColumnTenant}}
+	q := s.monthlyQuota(ctx, tenantQuotaID(tenant.Name), filter, tenant.MonthlyTokens, tenant.MonthlyBudget)
+	q.Name = tenant.Name
+	return q
+}
+
+// monthlyQuota returns the state of a quota of tokens and cost over the usage tracked by
+// id, loaded from the usage matching filter
+func (s *Server) monthlyQuota(ctx context.Context, id string, filter usage.Filter, tokens int64, budget float64) keyQuota {
+	now := time.Now()
+	used := s.quotas.current(id, now, func(month string) monthUsage { return s.loadQuotaUsage(ctx, id, month, filter) })
+	_, resets := quotaMonth(now)
+	q := keyQuota{
+		MonthlyTokens: tokens,
+		UsedTokens:    used.Tokens,
+		MonthlyBudget: budget,
+		UsedCost:      used.Cost,
+		ResetsAt:      resets,
+	}
+	if tokens > 0 {
+		remaining := max(tokens-used.Tokens, 0)
+		q.RemainingTokens = &remaining
+		q.Exhausted = remaining == 0
+	}
+	if budget > 0 {
+		remaining := max(budget-used.Cost, 0)
+		q.RemainingBudget = &remaining
+		q.Exhausted = q.Exhausted || remaining == 0
+	}
+	return q
+}
+
+// enforceQuota checks a request against the monthly quota of its API key, setting the
+// quota headers. It returns false, having answered 429, when the quota is used up.
+func (s *Server) enforceQuota(c *fiber.Ctx, group, id string, key config.APIKey) bool {
+	if !key.HasQuota() {
+		return true
+	}
+	return s.enforceMonthlyQuota(c, group, s.quota(c.UserContext(), id, key), fmt.Sprintf("api key %q", key.Name), true)
+}
+
+// enforceMonthlyQuota checks a request against the quota of what it is accounted to,
+// described by subject, setting the quota headers if asked to. It returns false, having
+// answered 429, when the quota is used up.
+func (s *Server) enforceMonthlyQuota(c *fiber.Ctx, group string, q keyQuota, subject string, headers bool) bool {
+	if headers {
+		if q.RemainingTokens != nil {
+			c.Set(HeaderXOpenModelQuotaLimitTokens, strconv.FormatInt(q.MonthlyTokens, 10))
+			c.Set(HeaderXOpenModelQuotaRemainingTokens, strconv.FormatInt(*q.RemainingTokens, 10))
+		}
+		if q.RemainingBudget != nil {
+			c.Set(HeaderXOpenModelQuotaLimitBudget, strconv.FormatFloat(q.MonthlyBudget, 'f', -1, 64))
+			c.Set(HeaderXOpenModelQuotaRemainingBudget, strconv.FormatFloat(*q.RemainingBudget, 'f', 6, 64))
+		}
+		c.Set(HeaderXOpenModelQuotaReset, q.ResetsAt.Format(time.RFC3339))
+	}
+	if !q.Exhausted {
+		return true
+	}
+
+	requestID, _ := c.Locals("request_id").(string)
+	event := "tenant_quota_exhausted"
+	if q.ID != "" {
+		event = "api_key_quota_exhausted"
+	}
+	applogger.Warn(event, "request_id", requestID, "name", q.Name, "used_tokens", q.UsedTokens, "used_cost", q.UsedCost)
+	c.Set(HeaderRetryAfter, strconv.Itoa(max(1, int(time.Until(q.ResetsAt).Seconds()))))
+	message := fmt.Sprintf("%s has used its monthly quota of %s; it resets at %s",
+		subject, quotaDescription(q), q.ResetsAt.Format(time.RFC3339))
+	keyLimitError(c, group, message, "insufficient_quota", "insufficient_quota")
+	return false
+}
+
+// quotaDescription describes a monthly quota
+func quotaDescription(q keyQuota) string {
+	switch {
+	case q.MonthlyTokens > 0 && q.MonthlyBudget > 0:
+		return fmt.Sprintf("%d tokens or %g in cost", q.MonthlyTokens, q.MonthlyBudget)
+	case q.MonthlyTokens > 0:
+		return fmt.Sprintf("%d tokens", q.MonthlyTokens)
+	}
+	return fmt.Sprintf("%g in cost", q.MonthlyBudget)
+}
+
+// handleAdminQuotas handles GET /admin/quotas, reporting the monthly quota of every
+// configured and issued API key and every tenant that has one
+func (s *Server) handleAdminQuotas(c *fiber.Ctx) error {
+	if status, err := s.authorizeAdmin(c); err != nil {
+		return handleError(c, err.Error(), status)
+	}
+	cfg := s.GetConfig()
+	quotas := []keyQuota{}
+	for _, key := range cfg.APIKeys {
+		if key.HasQuota() {
+			quotas = append(quotas, s.quota(c.UserContext(), usage.KeyID(key.GetKey()), key))
+		}
+	}
+	if s.keys != nil {
+		issued, err := s.keys.List(c.UserContext(), false)
+		if err != nil {
+			return handleError(c, err.Error(), fiber.StatusInternalServerError)
+		}
+		for _, k := range issued {
+			if key := apiKeyFromLimits(k.Name, k.Limits); key.HasQuota() {
+				quotas = append(quotas, s.quota(c.UserContext(), k.ID, key))
+			}
+		}
+	}
+	sort.Slice(quotas, func(i, j int) bool { return quotas[i].Name < quotas[j].Name })
+	tenants := []keyQuota{}
+	for _, tenant := range cfg.Tenants {
+		if tenant.HasQuota() {
+			tenants = append(tenants, s.tenantQuota(c.UserContext(), tenant))
+		}
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].Name < tenants[j].Name })
+	return c.JSON(fiber.Map{"quotas": quotas, "tenants": tenants})
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/usage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuotaTracker(t *testing.T) {
+	var tracker quotaTracker
+	now := time.Date(2026, 3, 31, 23, 0, 0, 0, time.UTC)
+	loads := 0
+	load := func(month string) monthUsage {
+		loads++
+		return monthUsage{Tokens: 100, Cost: 1}
+	}
+
+	// A key's month is loaded once, then counted in memory
+	assert.Equal(t, monthUsage{Month: "2026-03", Tokens: 100, Cost: 1}, tracker.current("a", now, load))
+	tracker.add("a", 50, 0.5, now)
+	assert.Equal(t, monthUsage{Month: "2026-03", Tokens: 150, Cost: 1.5}, tracker.current("a", now, load))
+	assert.Equal(t, 1, loads)
+
+	// Keys that were never checked are not tracked
+	tracker.add("b", 50, 0.5, now)
+	_, tracked := tracker.usage["b"]
+	assert.False(t, tracked)
+
+	// A new month starts over
+	next := now.Add(2 * time.Hour)
+	tracker.add("a", 50, 0.5, next)
+	assert.Equal(t, "2026-04", tracker.current("a", next, func(string) monthUsage { return monthUsage{} }).Month)
+	assert.Zero(t, tracker.current("a", next, load).Tokens)
+
+	month, resets := quotaMonth(now)
+	assert.Equal(t, "2026-03", month)
+	assert.Equal(t, time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC), resets)
+}
+
+func TestAPIKeys_Quota(t *testing.T) {
+	prov := &stubProvider{
+		name: "ollama",
+		doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+			return []byte(`{"id":"c1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}],"usage":{"prompt_tokens":60,"completion_tokens":50,"total_tokens":110}}`), nil
+		},
+	}
+	srv, _ := newAdminTestServer(&config.AdminConfig{Enabled: true, Token: "s3cret"})
+	srv.providers = providerMap{"ollama": prov}
+	srv.config.Models["gpt-4"] = config.ModelConfig{Strategy: "fallback", Providers: []config.ModelProvider{{Provider: "ollama", Model: "gpt-4"}}}
+	srv.config.Providers = map[string]config.ProviderConfig{"ollama": {Pricing: map[string]config.ModelPrice{"*": {InputPerMillion: 1e4, OutputPerMillion: 1e4}}}}
+	srv.config.APIKeys = []config.APIKey{
+		{Name: "tokens", Key: "sk-tokens", MonthlyTokens: 150},
+		{Name: "budget", Key: "sk-budget", MonthlyBudget: 1},
+		{Name: "free", Key: "sk-free"},
+	}
+	store, err := usage.Open(filepath.Join(t.TempDir(), "usage.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	srv.SetUsageStore(store)
+	// Usage recorded earlier in the month, as before a restart, counts against the quota
+	require.NoError(t, store.Add(context.Background(), "gpt-4", "ollama/gpt-4", usage.KeyID("sk-tokens"), "", 80, 0, 0))
+
+	app := fiber.New()
+	app.Use(srv.apiKeysMiddleware())
+	srv.registerRoutes(app)
+	do := func(key string) (*http.Response, []byte) {
+		req := httptest.NewRequest("POST", EndpointV1ChatCompletions, strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		data, _ := io.ReadAll(resp.Body)
+		return resp, data
+	}
+
+	resp, data := do("sk-tokens")
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode, string(data))
+	assert.Equal(t, "150", resp.Header.Get(HeaderXOpenModelQuotaLimitTokens))
+	assert.Equal(t, "70", resp.Header.Get(HeaderXOpenModelQuotaRemainingTokens))
+	assert.NotEmpty(t, resp.Header.Get(HeaderXOpenModelQuotaReset))
+	resp, data = do("sk-tokens")
+	assert.Equal(t, fiber.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "0", resp.Header.Get(HeaderXOpenModelQuotaRemainingTokens))
+	assert.NotEmpty(t, resp.Header.Get(HeaderRetryAfter))
+	var body struct {
+		Error struct {
+			Message string `json:"message"`
+			Code    string `json:"code"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(data, &body))
+	assert.Equal(t, "insufficient_quota", body.Error.Code)
+	assert.Contains(t, body.Error.Message, "monthly quota of 150 tokens")
+
+	// Cost quotas count the priced cost of each request: 110 tokens cost 1.1 here
+	resp, _ = do("sk-budget")
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Equal(t, "1", resp.Header.Get(HeaderXOpenModelQuotaLimitBudget))
+	resp, _ = do("sk-budget")
+	assert.Equal(t, fiber.StatusTooManyRequests, resp.StatusCode)
+
+	// Keys without a quota get no quota headers
+	resp, _ = do("sk-free")
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get(HeaderXOpenModelQuotaReset))
+
+	req := httptest.NewRequest("GET", EndpointAdminQuotas, nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	resp, err = app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	var report struct {
+		Quotas []keyQuota `json:"quotas"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+	require.Len(t, report.Quotas, 2)
+	assert.Equal(t, "budget", report.Quotas[0].Name)
+	assert.True(t, report.Quotas[0].Exhausted)
+	assert.Equal(t, "tokens", report.Quotas[1].Name)
+	assert.Equal(t, usage.KeyID("sk-tokens"), report.Quotas[1].ID)
+	assert.Equal(t, int64(190), report.Quotas[1].UsedTokens)
+	require.NotNil(t, report.Quotas[1].RemainingTokens)
+	assert.Zero(t, *report.Quotas[1].RemainingTokens)
+}
@@ -0,0 +1,134 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/audit"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/keys"
+	applogger "github.com/macedot/openmodel/internal/logger"
+)
+
+// issuedKey is a key as it is returned once, when it is created or rotated
+type issuedKey struct {
+	keys.Key
+	Secret string `json:"key"`
+}
+
+// SetKeyStore sets the store of API keys issued at runtime
+func (s *Server) SetKeyStore(store *keys.Store) {
+	s.keys = store
+}
+
+// handleAdminListKeys handles GET /admin/keys, listing issued keys without the keys
+// themselves; all=true includes the revoked ones
+func (s *Server) handleAdminListKeys(c *fiber.Ctx) error {
+	if status, err := s.authorizeKeyStore(c); err != nil {
+		return handleError(c, err.Error(), status)
+	}
+	list, err := s.keys.List(c.UserContext(), c.QueryBool("all"))
+	if err != nil {
+		return handleError(c, err.Error(), fiber.StatusInternalServerError)
+	}
+	return c.JSON(fiber.Map{"keys": list})
+}
+
+// handleAdminCreateKey handles POST /admin/keys, issuing a key to an application. The
+// response is the only time the key is shown.
+func (s *Server) handleAdminCreateKey(c *fiber.Ctx) error {
+	if status, err := s.authorizeKeyStore(c); err != nil {
+		return handleError(c, err.Error(), status)
+	}
+	var req struct {
+		Name string `json:"name"`
+		keys.Limits
+	}
+	if err := json.Unmarshal(c.Body(), &req); err != nil || req.Name == "" {
+		return handleError(c, `body must be {"name": "...", "models": [...], "endpoints": [...], "rpm": 0, "tpm": 0, "monthly_tokens": 0, "monthly_budget": 0, "tenant": "..."}`, fiber.StatusBadRequest)
+	}
+	if errs := apiKeyFromLimits(req.Name, req.Limits).LimitErrors(); len(errs) > 0 {
+		return handleError(c, "key has "+strings.Join(errs, "; "), fiber.StatusBadRequest)
+	}
+	if _, ok := s.GetConfig().LookupTenant(req.Tenant); req.Tenant != "" && !ok {
+		return handleError(c, fmt.Sprintf("unknown tenant %q", req.Tenant), fiber.StatusBadRequest)
+	}
+
+	k, secret, err := s.keys.Create(c.UserContext(), req.Name, req.Limits)
+	if err != nil {
+		return handleError(c, err.Error(), fiber.StatusInternalServerError)
+	}
+	applogger.Info("api_key_created", "id", k.ID, "name", k.Name)
+	s.recordAudit(c, auditActorAdmin, audit.ActionKeyCreate, k.ID, k.Name, nil)
+	return c.Status(fiber.StatusCreated).JSON(issuedKey{Key: k, Secret: secret})
+}
+
+// handleAdminRevokeKey handles DELETE /admin/keys/{id}; the key stops working at once
+func (s *Server) handleAdminRevokeKey(c *fiber.Ctx) error {
+	if status, err := s.authorizeKeyStore(c); err != nil {
+		return handleError(c, err.Error(), status)
+	}
+	id := c.Params("id")
+	k, err := s.keys.Revoke(c.UserContext(), id)
+	if err != nil {
+		s.recordAudit(c, auditActorAdmin, audit.ActionKeyRevoke, id, "", err)
+		return handleError(c, err.Error(), keyStoreErrorStatus(err))
+	}
+	applogger.Info("api_key_revoked", "id", k.ID, "name", k.Name)
+	s.recordAudit(c, auditActorAdmin, audit.ActionKeyRevoke, k.ID, k.Name, nil)
+	return c.JSON(k)
+}
+
+// handleAdminRotateKey handles POST /admin/keys/{id}/rotate, replacing a key by a new
+// one with the same name and limits. The old key stops working at once.
+func (s *Server) handleAdminRotateKey(c *fiber.Ctx) error {
+	if status, err := s.authorizeKeyStore(c); err != nil {
+		return handleError(c, err.Error(), status)
+	}
+	id := c.Params("id")
+	k, secret, err := s.keys.Rotate(c.UserContext(), id)
+	if err != nil {
+		s.recordAudit(c, auditActorAdmin, audit.ActionKeyRotate, id, "", err)
+		return handleError(c, err.Error(), keyStoreErrorStatus(err))
+	}
+	applogger.Info("api_key_rotated", "id", id, "new_id", k.ID, "name", k.Name)
+	s.recordAudit(c, auditActorAdmin, audit.ActionKeyRotate, id, "rotated to "+k.ID, nil)
+	return c.JSON(issuedKey{Key: k, Secret: secret})
+}
+
+// authorizeKeyStore authorizes an admin request and checks that the key store is enabled
+func (s *Server) authorizeKeyStore(c *fiber.Ctx) (int, error) {
+	if status, err := s.authorizeAdmin(c); err != nil {
+		return status, err
+	}
+	if s.keys == nil {
+		return fiber.StatusNotFound, fmt.Errorf("key store is disabled")
+	}
+	return 0, nil
+}
+
+// apiKeyFromLimits is an issued key as the config would define it
+func apiKeyFromLimits(name string, limits keys.Limits) config.APIKey {
+	return config.APIKey{
+		Name:          name,
+		Models:        limits.Models,
+		Endpoints:     limits.Endpoints,
+		RPM:           limits.RPM,
+		TPM:           limits.TPM,
+		MonthlyTokens: limits.MonthlyTokens,
+		MonthlyBudget: limits.MonthlyBudget,
+		Tenant:        limits.Tenant,
+	}
+}
+
+// keyStoreErrorStatus is the status to respond with on a key store error
+func keyStoreErrorStatus(err error) int {
+	if errors.Is(err, keys.ErrNotFound) {
+		return fiber.StatusNotFound
+	}
+	return fiber.StatusInternalServerError
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/keys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminKeys(t *testing.T) {
+	srv, _ := newAdminTestServer(&config.AdminConfig{Enabled: true, Token: "s3cret"})
+	store, err := keys.Open(filepath.Join(t.TempDir(), "keys.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	app := fiber.New()
+	app.Use(srv.endpointGroupsMiddleware())
+	app.Use(srv.apiKeysMiddleware())
+	srv.registerRoutes(app)
+
+	do := func(method, path, token, body string) (int, map[string]any) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		var out map[string]any
+		json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+
+	// The key management API needs the key store
+	status, _ := do("GET", EndpointAdminKeys, "s3cret", "")
+	assert.Equal(t, fiber.StatusNotFound, status)
+	srv.SetKeyStore(store)
+
+	status, _ = do("POST", EndpointAdminKeys, "wrong", `{"name":"indexer"}`)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	status, _ = do("POST", EndpointAdminKeys, "s3cret", `{"models":["chat"]}`)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	status, _ = do("POST", EndpointAdminKeys, "s3cret", `{"name":"indexer","endpoints":["admin"]}`)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	status, _ = do("POST", EndpointAdminKeys, "s3cret", `{"name":"indexer","rpm":-1}`)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+
+	status, created := do("POST", EndpointAdminKeys, "s3cret", `{"name":"indexer","models":["ordered"],"endpoints":["openai"],"rpm":60}`)
+	require.Equal(t, fiber.StatusCreated, status)
+	assert.EqualValues(t, 60, created["rpm"])
+	secret, _ := created["key"].(string)
+	id, _ := created["id"].(string)
+	require.True(t, strings.HasPrefix(secret, keys.Prefix), created)
+
+	// Issued keys are required and limited like configured ones
+	status, _ = do("GET", EndpointV1Models, "", "")
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	status, list := do("GET", EndpointV1Models, secret, "")
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Len(t, list["data"], 1)
+	status, _ = do("POST", EndpointV1ChatCompletions, secret, `{"model":"chat","messages":[{"role":"user","content":"hi"}]}`)
+	assert.Equal(t, fiber.StatusForbidden, status)
+
+	status, listed := do("GET", EndpointAdminKeys, "s3cret", "")
+	assert.Equal(t, fiber.StatusOK, status)
+	require.Len(t, listed["keys"], 1)
+	assert.NotContains(t, listed["keys"].([]any)[0], "key")
+
+	// Rotation hands out a new key and retires the old one
+	status, rotated := do("POST", EndpointAdminKeys+"/"+id+"/rotate", "s3cret", "")
+	require.Equal(t, fiber.StatusOK, status)
+	newSecret, _ := rotated["key"].(string)
+	status, _ = do("GET", EndpointV1Models, secret, "")
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	status, _ = do("GET", EndpointV1Models, newSecret, "")
+	assert.Equal(t, fiber.StatusOK, status)
+
+	status, _ = do("DELETE", EndpointAdminKeys+"/"+rotated["id"].(string), "s3cret", "")
+	assert.Equal(t, fiber.StatusOK, status)
+	status, _ = do("GET", EndpointV1Models, newSecret, "")
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	status, _ = do("DELETE", EndpointAdminKeys+"/"+rotated["id"].(string), "s3cret", "")
+	assert.Equal(t, fiber.StatusNotFound, status)
+
+	status, listed = do("GET", EndpointAdminKeys+"?all=true", "s3cret", "")
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Len(t, listed["keys"], 2)
+}
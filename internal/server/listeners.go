@@ -0,0 +1,229 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+)
+
+// openListeners opens every address the server accepts requests on. Nothing is left open
+// when one of them fails.
+func openListeners(configs []config.ListenerConfig) ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, len(configs))
+	for _, lc := range configs {
+		ln, err := openListener(lc)
+		if err != nil {
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, nil
+}
+
+// openListener opens a listener's address. A unix socket file left behind by a previous
+// run is replaced.
+func openListener(lc config.ListenerConfig) (net.Listener, error) {
+	network, address := "tcp", lc.Address
+	path, unix := lc.UnixSocket()
+	if unix {
+		network, address = "unix", path
+		if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(path)
+		}
+	}
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", lc.Address, err)
+	}
+	if mode := lc.GetSocketMode(); unix && mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("failed to set the mode of %s: %w", path, err)
+		}
+	}
+	tlsConfig, err := listenerTLSConfig(lc.TLS)
+	if err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to set up tls on %s: %w", lc.Address, err)
+	}
+	return &taggedListener{Listener: ln, config: lc, tls: tlsConfig}, nil
+}
+
+// listenerTLSConfig loads the certificates of a TLS listener, nil without TLS
+func listenerTLSConfig(t *config.ListenerTLSConfig) (*tls.Config, error) {
+	if t == nil {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if t.ClientCAFile == "" {
+		return tlsConfig, nil
+	}
+	pem, err := os.ReadFile(t.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.ClientCAs = x509.NewCertPool()
+	if !tlsConfig.ClientCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates in %s", t.ClientCAFile)
+	}
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	if t.GetClientAuth() == config.ClientAuthOptional {
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
+
+// taggedListener tags the connections it accepts with its config, serving them over TLS
+// when it has a TLS config
+type taggedListener struct {
+	net.Listener
+	config config.ListenerConfig
+	tls    *tls.Config
+}
+
+// listenerConn is a connection accepted by a taggedListener
+type listenerConn struct {
+	net.Conn
+	config config.ListenerConfig
+}
+
+// tlsListenerConn is a TLS connection accepted by a taggedListener. It exposes the
+// connection state, so fiber knows requests on it are secure.
+type tlsListenerConn struct {
+	*tls.Conn
+	config config.ListenerConfig
+}
+
+// Accept waits for the next connection and tags it. The TLS handshake happens on the
+// first read, in the goroutine serving the connection.
+func (l *taggedListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if l.tls != nil {
+		return &tlsListenerConn{Conn: tls.Server(conn, l.tls), config: l.config}, nil
+	}
+	return &listenerConn{Conn: conn, config: l.config}, nil
+}
+
+// connListener returns the config of the listener that accepted a connection
+func connListener(conn net.Conn) (config.ListenerConfig, bool) {
+	switch conn := conn.(type) {
+	case *listenerConn:
+		return conn.config, true
+	case *tlsListenerConn:
+		return conn.config, true
+	}
+	return config.ListenerConfig{}, false
+}
+
+// listenerMiddleware answers 404 to requests for endpoints the listener they came in on
+// does not serve, e.g. the admin API or metrics on a public address. Every listener
+// serves the probes.
+func listenerMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		listener, ok := connListener(c.Context().Conn())
+		if !ok || isProbe(c.Path()) {
+			return c.Next()
+		}
+		endpoints := config.ListenerEndpointsAPI
+		if strings.HasPrefix(c.Path(), EndpointAdminPrefix) || c.Path() == EndpointMetrics {
+			endpoints = config.ListenerEndpointsAdmin
+		}
+		if !listener.Serves(endpoints) {
+			return handleError(c, "not found", fiber.StatusNotFound)
+		}
+		return c.Next()
+	}
+}
+
+// multiListener accepts the connections of several listeners, so a single server serves
+// them all
+type multiListener struct {
+	listeners []net.Listener
+	conns     chan net.Conn
+	errs      chan error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// newMultiListener starts accepting the connections of listeners
+func newMultiListener(listeners []net.Listener) *multiListener {
+	m := &multiListener{
+		listeners: listeners,
+		conns:     make(chan net.Conn),
+		errs:      make(chan error),
+		done:      make(chan struct{}),
+	}
+	for _, ln := range listeners {
+		go m.accept(ln)
+	}
+	return m
+}
+
+// accept forwards the connections of a listener until it fails or is closed
+func (m *multiListener) accept(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case m.errs <- err:
+			case <-m.done:
+			}
+			return
+		}
+		select {
+		case m.conns <- conn:
+		case <-m.done:
+			conn.Close()
+			return
+		}
+	}
+}
+
+// Accept waits for the next connection of any listener
+func (m *multiListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-m.conns:
+		return conn, nil
+	case err := <-m.errs:
+		return nil, err
+	case <-m.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close closes every listener
+func (m *multiListener) Close() error {
+	var err error
+	m.closeOnce.Do(func() {
+		close(m.done)
+		for _, ln := range m.listeners {
+			if closeErr := ln.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+	})
+	return err
+}
+
+// Addr returns the address of the first listener
+func (m *multiListener) Addr() net.Addr {
+	return m.listeners[0].Addr()
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/provider"
+	"github.com/macedot/openmodel/internal/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStart_Listeners(t *testing.T) {
+	dir := t.TempDir()
+	publicSocket := filepath.Join(dir, "public.sock")
+	adminSocket := filepath.Join(dir, "admin.sock")
+	cfg := &config.Config{
+		Server: config.ServerConfig{Listeners: []config.ListenerConfig{
+			{Address: "unix:" + publicSocket, Endpoints: []string{config.ListenerEndpointsAPI}},
+			{Address: "unix:" + adminSocket, Endpoints: []string{config.ListenerEndpointsAdmin}, SocketMode: "0600"},
+		}},
+		Providers: map[string]config.ProviderConfig{},
+		Models:    map[string]config.ModelConfig{},
+		Admin:     &config.AdminConfig{Enabled: true, Token: "s3cret"},
+	}
+	srv := New(cfg, map[string]provider.Provider{}, state.New(), "test")
+	started := make(chan error, 1)
+	go func() { started <- srv.Start() }()
+	t.Cleanup(func() {
+		require.NoError(t, srv.Stop(context.Background()))
+		assert.NoError(t, <-started)
+	})
+
+	client := func(socket string) *http.Client {
+		return &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+		}}
+	}
+	get := func(socket, path string) int {
+		var resp *http.Response
+		require.Eventually(t, func() bool {
+			req, err := http.NewRequest("GET", "http://openmodel"+path, nil)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer s3cret")
+			resp, err = client(socket).Do(req)
+			return err == nil
+		}, 2*time.Second, 10*time.Millisecond)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, get(publicSocket, EndpointHealth))
+	assert.Equal(t, http.StatusNotFound, get(publicSocket, EndpointAdminConfig))
+	assert.Equal(t, http.StatusOK, get(adminSocket, EndpointAdminConfig))
+	assert.Equal(t, http.StatusNotFound, get(adminSocket, EndpointHealth))
+	if info, err := os.Stat(adminSocket); assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+}
+
+func TestOpenListeners_FailsAsAWhole(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer taken.Close()
+
+	socket := filepath.Join(t.TempDir(), "openmodel.sock")
+	_, err = openListeners([]config.ListenerConfig{{Address: "unix:" + socket}, {Address: taken.Addr().String()}})
+	require.Error(t, err)
+
+	// The socket opened before the failure was closed again
+	ln, err := openListener(config.ListenerConfig{Address: "unix:" + socket})
+	require.NoError(t, err)
+	ln.Close()
+}
+
+// testCA issues certificates for TLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	dir  string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	ca := &testCA{dir: t.TempDir()}
+	ca.cert, ca.key = ca.issue(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	})
+	return ca
+}
+
+// issue signs a certificate from template, self-signed for the CA itself
+func (ca *testCA) issue(t *testing.T, template *x509.Certificate) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Minute)
+	template.NotAfter = time.Now().Add(time.Hour)
+	parent, signer := template, key
+	if ca.cert != nil {
+		parent, signer = ca.cert, ca.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
+
+// files writes a certificate and its key as PEM files and returns their paths
+func (ca *testCA) files(t *testing.T, name string, cert *x509.Certificate, key *ecdsa.PrivateKey) (string, string) {
+	t.Helper()
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	certFile, keyFile := filepath.Join(ca.dir, name+".crt"), filepath.Join(ca.dir, name+".key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+// client returns a TLS client certificate for a common name and URIs
+func (ca *testCA) client(t *testing.T, cn string) tls.Certificate {
+	t.Helper()
+	cert, key := ca.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: cn},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key, Leaf: cert}
+}
+
+func TestStart_MutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert, serverKey := ca.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "openmodel"},
+		DNSNames:    []string{"openmodel"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	certFile, keyFile := ca.files(t, "server", serverCert, serverKey)
+	caFile, _ := ca.files(t, "ca", ca.cert, ca.key)
+
+	socket := filepath.Join(t.TempDir(), "openmodel.sock")
+	cfg := &config.Config{
+		Server: config.ServerConfig{Listeners: []config.ListenerConfig{{
+			Address: "unix:" + socket,
+			TLS:     &config.ListenerTLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile},
+		}}},
+		Providers: map[string]config.ProviderConfig{},
+		Models: map[string]config.ModelConfig{
+			"gpt-4":            {},
+			"text-embedding-3": {},
+		},
+		ClientCerts: []config.ClientCert{
+			{Name: "indexer", Subjects: []string{"*.indexer.internal"}, Models: []string{"text-embedding-*"}},
+		},
+	}
+	srv := New(cfg, map[string]provider.Provider{}, state.New(), "test")
+	started := make(chan error, 1)
+	go func() { started <- srv.Start() }()
+	t.Cleanup(func() {
+		require.NoError(t, srv.Stop(context.Background()))
+		assert.NoError(t, <-started)
+	})
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(certs ...tls.Certificate) (int, string, error) {
+		client := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+			TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: "openmodel", Certificates: certs},
+		}}
+		resp, err := client.Get("https://openmodel" + EndpointV1Models)
+		if err != nil {
+			return 0, "", err
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body), nil
+	}
+
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(socket)
+		return err == nil
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// A mapped certificate authenticates the client, holding it to its models
+	status, body, err := get(ca.client(t, "a.indexer.internal"))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, "text-embedding-3")
+	assert.NotContains(t, body, "gpt-4")
+
+	// A verified certificate that maps to no client is not a credential
+	status, _, err = get(ca.client(t, "someone.else"))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	// Clients without a certificate, or with one from another CA, fail the handshake
+	_, _, err = get()
+	assert.Error(t, err)
+	_, _, err = get(newTestCA(t).client(t, "a.indexer.internal"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,133 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/api/openai"
+	"github.com/macedot/openmodel/internal/bodylog"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/llmexport"
+	applogger "github.com/macedot/openmodel/internal/logger"
+)
+
+// llmExportGroups are the endpoint groups whose requests are exported
+var llmExportGroups = []string{config.EndpointsOpenAI, config.EndpointsAnthropic}
+
+// newLLMExporter creates the exporter of the llm_export config, nil when it is disabled
+func newLLMExporter(cfg *config.Config) *llmexport.Exporter {
+	if !cfg.LLMExport.IsEnabled() {
+		return nil
+	}
+	exporter, err := llmexport.New(llmexport.Config{
+		Platform:   cfg.LLMExport.Platform,
+		Endpoint:   cfg.LLMExport.GetEndpoint(),
+		PublicKey:  cfg.LLMExport.GetPublicKey(),
+		SecretKey:  cfg.LLMExport.GetSecretKey(),
+		APIKey:     cfg.LLMExport.GetAPIKey(),
+		Project:    cfg.LLMExport.GetProject(),
+		SampleRate: cfg.LLMExport.GetSampleRate(),
+	})
+	if err != nil {
+		applogger.Warn("llm_export_init_failed", "platform", cfg.LLMExport.Platform, "error", err)
+		return nil
+	}
+	return exporter
+}
+
+// llmExportRequest is the generation of a request in progress
+type llmExportRequest struct {
+	generation llmexport.Generation
+	streaming  bool              // the generation is exported once the stream ends
+	text       bodylog.Assembler // streamed output written to the client
+}
+
+type llmExportKey struct{}
+
+// llmExportFromContext returns the generation of a request, nil if it is not exported
+func llmExportFromContext(ctx context.Context) *llmExportRequest {
+	r, _ := ctx.Value(llmExportKey{}).(*llmExportRequest)
+	return r
+}
+
+// add adds a chunk of the stream written to the client
+func (r *llmExportRequest) add(chunk string) {
+	if r != nil {
+		r.text.Add(chunk)
+	}
+}
+
+// stream hands the generation over to the stream writer of the response, which exports
+// it once the stream ends
+func (r *llmExportRequest) stream(requestID, model string) {
+	if r != nil {
+		r.streaming = true
+		r.generation.RequestID, r.generation.Model = requestID, model
+		r.generation.Status, r.generation.Stream = fiber.StatusOK, true
+	}
+}
+
+// setUsage records the tokens the backend reported
+func (r *llmExportRequest) setUsage(usage openai.Usage) {
+	if r != nil {
+		r.generation.PromptTokens = usage.PromptTokens
+		r.generation.CompletionTokens = usage.CompletionTokens
+	}
+}
+
+// llmExportMiddleware exports the sampled OpenAI and Anthropic API requests with a JSON
+// body. A streamed response is exported by its stream writer when the stream ends.
+func (s *Server) llmExportMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Method() != fiber.MethodPost || !slices.Contains(llmExportGroups, endpointGroup(c.Path())) || !s.llmExport.Sampled() {
+			return c.Next()
+		}
+		var input any
+		if err := json.Unmarshal(c.Body(), &input); err != nil {
+			return c.Next()
+		}
+		// The generation outlives the request, whose buffers fiber reuses
+		req := &llmExportRequest{generation: llmexport.Generation{
+			Name:  strings.Clone(c.Path()),
+			Input: input,
+			Start: time.Now(),
+		}}
+		c.SetUserContext(context.WithValue(c.UserContext(), llmExportKey{}, req))
+
+		err := c.Next()
+
+		// The stream writer has the generation of a streamed response
+		if req.streaming {
+			return err
+		}
+		req.generation.RequestID, _ = c.Locals("request_id").(string)
+		req.generation.Model, _ = c.Locals("model").(string)
+		req.generation.Backend, _ = c.Locals("provider").(string)
+		req.generation.Status = c.Response().StatusCode()
+		if !c.Response().IsBodyStream() {
+			var output any
+			if json.Unmarshal(c.Response().Body(), &output) == nil {
+				req.generation.Output = output
+			}
+		}
+		s.exportGeneration(req)
+		return err
+	}
+}
+
+// exportGeneration exports the generation of a request once its response is complete
+func (s *Server) exportGeneration(req *llmExportRequest) {
+	if req == nil {
+		return
+	}
+	req.generation.End = time.Now()
+	if req.streaming {
+		req.generation.Output = req.text.String()
+	}
+	s.llmExport.Export(req.generation)
+}
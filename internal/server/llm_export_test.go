@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLLMExport(t *testing.T) {
+	var runs []map[string]any
+	platform := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		var batch struct {
+			Post []map[string]any `json:"post"`
+		}
+		if err := json.Unmarshal(data, &batch); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		runs = append(runs, batch.Post...)
+	}))
+	defer platform.Close()
+
+	prov := &stubProvider{
+		name: "ollama",
+		doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+			return []byte(`{"id":"c1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}],"usage":{"prompt_tokens":5,"completion_tokens":1,"total_tokens":6}}`), nil
+		},
+		doStreamReqFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+			return streamOf(
+				`data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4","choices":[{"index":0,"delta":{"content":"streamed"},"finish_reason":null}]}`,
+				`data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4","choices":[{"index":0,"delta":{},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`,
+				SSEDataDone,
+			), nil
+		},
+	}
+	srv := newStreamingTestServer(prov)
+	srv.config.LLMExport = &config.LLMExportConfig{Enabled: true, Platform: config.LLMExportLangSmith, Endpoint: platform.URL, APIKey: "key", Project: "test"}
+	srv.llmExport = newLLMExporter(srv.config)
+	require.NotNil(t, srv.llmExport)
+	app := fiber.New()
+	app.Use(srv.llmExportMiddleware())
+	srv.registerRoutes(app)
+
+	for _, body := range []string{
+		`{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`,
+		`{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"hello"}]}`,
+	} {
+		req := httptest.NewRequest("POST", EndpointV1ChatCompletions, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+		io.ReadAll(resp.Body)
+	}
+	// Requests to other endpoints are not exported
+	resp, err := app.Test(httptest.NewRequest("GET", EndpointV1Models, nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	require.NoError(t, srv.llmExport.Shutdown(context.Background()))
+	require.Len(t, runs, 2)
+	for _, run := range runs {
+		assert.Equal(t, EndpointV1ChatCompletions, run["name"])
+		assert.Equal(t, "test", run["session_name"])
+		metadata := run["extra"].(map[string]any)["metadata"].(map[string]any)
+		assert.Equal(t, "gpt-4", metadata["ls_model_name"])
+		assert.Equal(t, "ollama/gpt-4", metadata["backend"])
+		assert.Contains(t, run["inputs"], "messages")
+	}
+
+	outputs := runs[0]["outputs"].(map[string]any)
+	assert.Contains(t, outputs, "choices")
+	assert.Equal(t, map[string]any{"input_tokens": 5.0, "output_tokens": 1.0, "total_tokens": 6.0}, outputs["usage_metadata"])
+
+	outputs = runs[1]["outputs"].(map[string]any)
+	assert.Equal(t, "streamed", outputs["output"])
+	assert.Equal(t, map[string]any{"input_tokens": 3.0, "output_tokens": 2.0, "total_tokens": 5.0}, outputs["usage_metadata"])
+	assert.Equal(t, true, runs[1]["extra"].(map[string]any)["metadata"].(map[string]any)["stream"])
+}
@@ -0,0 +1,236 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/api/openai"
+	"github.com/macedot/openmodel/internal/audit"
+	"github.com/macedot/openmodel/internal/metrics"
+	"github.com/macedot/openmodel/internal/state"
+)
+
+// Histogram buckets: durations in seconds, speeds in tokens per second
+var (
+	backendLatencyBuckets  = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+	firstTokenBuckets      = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+	tokensPerSecondBuckets = []float64{5, 10, 20, 35, 50, 75, 100, 150, 250, 500}
+)
+
+// circuitStates are the circuit breaker states reported for each backend
+var circuitStates = []string{state.CircuitClosed, state.CircuitHalfOpen, state.CircuitOpen}
+
+// serverMetrics are the Prometheus metrics served at /metrics. Its methods do nothing on
+// a nil receiver, so servers built without New record nothing.
+type serverMetrics struct {
+	registry       *metrics.Registry
+	requests       *metrics.CounterVec   // endpoint, status
+	backendErrors  *metrics.CounterVec   // backend, class
+	backendLatency *metrics.HistogramVec // backend
+	firstToken     *metrics.HistogramVec // backend
+	tokensPerSec   *metrics.HistogramVec // backend
+	tokens         *metrics.CounterVec   // backend, direction
+	cost           *metrics.CounterVec   // backend, api_key
+	cacheLookups   *metrics.CounterVec   // cache, model, result
+	configReloads  *metrics.CounterVec   // result
+}
+
+// newServerMetrics creates the server's metrics. Gauges are read from s on each scrape.
+func newServerMetrics(s *Server) *serverMetrics {
+	r := metrics.NewRegistry()
+	m := &serverMetrics{
+		registry: r,
+		requests: r.NewCounterVec("openmodel_requests_total",
+			"Requests served, by endpoint and HTTP status.", "endpoint", "status"),
+		backendErrors: r.NewCounterVec("openmodel_backend_errors_total",
+			"Failed backend requests counted against the backend, by error class.", "backend", "class"),
+		backendLatency: r.NewHistogramVec("openmodel_backend_request_duration_seconds",
+			"Duration of backend attempts, to the end of the response or stream.", backendLatencyBuckets, "backend"),
+		firstToken: r.NewHistogramVec("openmodel_stream_first_token_seconds",
+			"Time from opening a backend stream to its first content token.", firstTokenBuckets, "backend"),
+		tokensPerSec: r.NewHistogramVec("openmodel_stream_tokens_per_second",
+			"Output tokens per second of complete backend streams, from the first token to the end.", tokensPerSecondBuckets, "backend"),
+		tokens: r.NewCounterVec("openmodel_tokens_total",
+			"Tokens reported by backends, by direction (input or output).", "backend", "direction"),
+		cost: r.NewCounterVec("openmodel_cost_total",
+			"Cost of requests from the configured pricing, by backend and API key id.", "backend", "api_key"),
+		cacheLookups: r.NewCounterVec("openmodel_cache_lookups_total",
+			"Cache lookups, by cache, model and result (hit or miss).", "cache", "model", "result"),
+		configReloads: r.NewCounterVec("openmodel_config_reloads_total",
+			"Config reloads, by result (success or failure). A failed reload keeps the running config.", "result"),
+	}
+	r.NewGaugeFunc("openmodel_requests_in_flight", "Requests being served, streams included.",
+		func(emit func(float64, ...string)) {
+			emit(float64(s.drain.status().InFlight))
+		})
+	r.NewGaugeFunc("openmodel_backend_requests_in_flight", "Requests in flight to each backend.",
+		func(emit func(float64, ...string)) {
+			for _, backend := range s.metricsBackends() {
+				emit(float64(s.state.InFlight(backend)), backend)
+			}
+		}, "backend")
+	r.NewGaugeFunc("openmodel_backend_circuit_state", "Circuit breaker state of each backend: 1 for its current state.",
+		func(emit func(float64, ...string)) {
+			for _, backend := range s.metricsBackends() {
+				current := s.state.Circuit(backend)
+				for _, st := range circuitStates {
+					value := 0.0
+					if st == current {
+						value = 1
+					}
+					emit(value, backend, st)
+				}
+			}
+		}, "backend", "state")
+	return m
+}
+
+// metricsBackends returns the backends ("provider/model") of the configured models
+func (s *Server) metricsBackends() []string {
+	var backends []string
+	for _, modelCfg := range s.GetConfig().Models {
+		for _, p := range modelCfg.Providers {
+			backends = append(backends, formatProviderKey(p))
+		}
+	}
+	slices.Sort(backends)
+	return slices.Compact(backends)
+}
+
+// observeRequest counts a request served by endpoint
+func (m *serverMetrics) observeRequest(endpoint string, status int) {
+	if m == nil {
+		return
+	}
+	m.requests.Inc(endpoint, strconv.Itoa(status))
+}
+
+// observeBackendError counts a failure against a backend
+func (m *serverMetrics) observeBackendError(backend string, class errorClass) {
+	if m == nil {
+		return
+	}
+	m.backendErrors.Inc(backend, class.String())
+}
+
+// observeAttempt records how long a backend attempt took
+func (m *serverMetrics) observeAttempt(backend string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.backendLatency.Observe(d.Seconds(), backend)
+}
+
+// observeFirstToken records how long a backend stream took to produce its first token
+func (m *serverMetrics) observeFirstToken(backend string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.firstToken.Observe(d.Seconds(), backend)
+}
+
+// observeTokensPerSecond records the output speed of a complete backend stream; 0, for
+// a backend that reported no usage, records nothing
+func (m *serverMetrics) observeTokensPerSecond(backend string, rate float64) {
+	if m == nil || rate <= 0 {
+		return
+	}
+	m.tokensPerSec.Observe(rate, backend)
+}
+
+// observeUsage counts the tokens of a completed request
+func (m *serverMetrics) observeUsage(backend string, usage openai.Usage) {
+	if m == nil {
+		return
+	}
+	m.tokens.Add(float64(usage.PromptTokens), backend, "input")
+	m.tokens.Add(float64(usage.CompletionTokens), backend, "output")
+}
+
+// observeCost counts the cost of a completed request
+func (m *serverMetrics) observeCost(backend, keyID string, cost float64) {
+	if m == nil {
+		return
+	}
+	m.cost.Add(cost, backend, keyID)
+}
+
+// observeCacheLookup counts a lookup in a cache for a model
+func (m *serverMetrics) observeCacheLookup(cache, model string, hit bool) {
+	if m == nil {
+		return
+	}
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.cacheLookups.Inc(cache, model, result)
+}
+
+// observeConfigReload counts a reload of the config by its outcome
+func (m *serverMetrics) observeConfigReload(err error) {
+	if m == nil {
+		return
+	}
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	m.configReloads.Inc(result)
+}
+
+// metricsMiddleware counts requests by the route that served them and their status
+func (s *Server) metricsMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+		s.metrics.observeRequest(servedRoute(c), responseStatus(c, err))
+		return err
+	}
+}
+
+// responseStatus returns the status of the response to a request whose handlers returned
+// err, which the error handler only turns into a response later
+func responseStatus(c *fiber.Ctx, err error) int {
+	if err == nil {
+		return c.Response().StatusCode()
+	}
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return fiberErr.Code
+	}
+	return fiber.StatusInternalServerError
+}
+
+// servedRoute returns the route that served a request, or "other" for unknown paths, so
+// metric labels and span names have a bounded set of values
+func servedRoute(c *fiber.Ctx) string {
+	// Requests no route matches end on the middleware, registered at "/"
+	if path := c.Route().Path; path != EndpointRoot || c.Path() == EndpointRoot {
+		return path
+	}
+	return "other"
+}
+
+// handleMetrics handles GET /metrics, serving the metrics in the Prometheus text format
+func (s *Server) handleMetrics(c *fiber.Ctx) error {
+	cfg := s.GetConfig()
+	if !cfg.Metrics.IsEnabled() || s.metrics == nil {
+		return handleError(c, "not found", fiber.StatusNotFound)
+	}
+	if want := cfg.Metrics.GetToken(); want != "" {
+		token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(want)) != 1 {
+			s.recordAudit(c, auditActorMetrics, audit.ActionAuthFailure, c.Path(), "", errors.New("invalid metrics token"))
+			return handleError(c, "invalid metrics token", fiber.StatusUnauthorized)
+		}
+	}
+	c.Set(fiber.HeaderContentType, metrics.ContentType)
+	_, err := s.metrics.registry.WriteTo(c)
+	return err
+}
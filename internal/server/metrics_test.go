@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/audit"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	prov := &stubProvider{
+		name: "ollama",
+		doStreamReqFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+			return streamOf(
+				`data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4","choices":[{"index":0,"delta":{"content":"hi"},"finish_reason":null}]}`,
+				`data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4","choices":[{"index":0,"delta":{},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":1,"total_tokens":4}}`,
+				SSEDataDone,
+			), nil
+		},
+	}
+	srv := newStreamingTestServer(prov)
+	srv.metrics = newServerMetrics(srv)
+	srv.config.Metrics = &config.MetricsConfig{Enabled: true, Token: "scrape"}
+
+	app := fiber.New()
+	app.Use(srv.metricsMiddleware())
+	srv.registerRoutes(app)
+	send := func(method, path, token, body string) (int, string) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(data)
+	}
+
+	status, _ := send("POST", EndpointV1ChatCompletions, "", `{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+	require.Equal(t, fiber.StatusOK, status)
+	send("GET", "/nowhere", "", "")
+	srv.recordProviderFailure("ollama/gpt-4", &provider.StatusError{StatusCode: 503, Err: errors.New("overloaded")})
+	srv.RecordConfigReload(audit.ActorWatcher, "", nil)
+	srv.RecordConfigReload(audit.ActorWatcher, "", errors.New("failed to get credentials"))
+	srv.RecordConfigReload(audit.ActorSignal, "", errors.New("invalid config"))
+
+	status, _ = send("GET", EndpointMetrics, "", "")
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+
+	status, body := send("GET", EndpointMetrics, "scrape", "")
+	require.Equal(t, fiber.StatusOK, status)
+	for _, line := range []string{
+		`openmodel_requests_total{endpoint="/v1/chat/completions",status="200"} 1`,
+		`openmodel_requests_total{endpoint="other",status="404"} 1`,
+		`openmodel_requests_total{endpoint="/metrics",status="401"} 1`,
+		`openmodel_backend_errors_total{backend="ollama/gpt-4",class="server_error"} 1`,
+		`openmodel_backend_request_duration_seconds_count{backend="ollama/gpt-4"} 1`,
+		`openmodel_stream_first_token_seconds_count{backend="ollama/gpt-4"} 1`,
+		`openmodel_tokens_total{backend="ollama/gpt-4",direction="input"} 3`,
+		`openmodel_tokens_total{backend="ollama/gpt-4",direction="output"} 1`,
+		`openmodel_config_reloads_total{result="success"} 1`,
+		`openmodel_config_reloads_total{result="failure"} 2`,
+		`openmodel_requests_in_flight 0`,
+		`openmodel_backend_requests_in_flight{backend="ollama/gpt-4"} 0`,
+		`openmodel_backend_circuit_state{backend="ollama/gpt-4",state="open"} 1`,
+		`openmodel_backend_circuit_state{backend="ollama/gpt-4",state="closed"} 0`,
+	} {
+		assert.Contains(t, body, line+"\n")
+	}
+
+	srv.config.Metrics = nil
+	status, _ = send("GET", EndpointMetrics, "scrape", "")
+	assert.Equal(t, fiber.StatusNotFound, status, "metrics are off unless enabled")
+}
@@ -0,0 +1,138 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/macedot/openmodel/internal/config"
+	applogger "github.com/macedot/openmodel/internal/logger"
+	"github.com/macedot/openmodel/internal/provider"
+	"github.com/macedot/openmodel/internal/server/converters"
+)
+
+// mirrorTimeout bounds a shadow request, which no longer has a client waiting on it
+const mirrorTimeout = 2 * time.Minute
+
+// mirrorPrimary describes the response the client received, for comparison
+type mirrorPrimary struct {
+	providerKey string
+	latency     time.Duration
+	response    []byte // In the client's API format
+}
+
+// mirrorRequest sends a copy of a non-streaming request to the model's mirror target,
+// if one is configured and the request is sampled. The shadow call runs in the
+// background, does not count towards the target's failure state, and its result is only
+// logged next to the primary response.
+func (s *Server) mirrorRequest(ctx context.Context, model string, sourceFormat converters.APIFormat, endpoint string, body []byte, headers map[string]string, primary mirrorPrimary) {
+	mirror := s.GetConfig().Models[model].Mirror
+	if mirror == nil || !sampleMirror(mirror.Percent) {
+		return
+	}
+	providerName, targetModel, ok := mirror.TargetBackend()
+	if !ok {
+		return
+	}
+
+	s.providersMu.RLock()
+	prov, exists := s.providers[providerName]
+	s.providersMu.RUnlock()
+	if !exists {
+		return
+	}
+
+	// The request body belongs to fasthttp and is reused once the handler returns
+	go s.runMirror(context.WithoutCancel(ctx), model, mirror, prov, targetModel, sourceFormat, endpoint, bytes.Clone(body), copyHeaders(headers), primary)
+}
+
+// runMirror performs one shadow request and logs how it compares with the primary
+func (s *Server) runMirror(ctx context.Context, model string, mirror *config.MirrorConfig, prov requestProvider, targetModel string, sourceFormat converters.APIFormat, endpoint string, body []byte, headers map[string]string, primary mirrorPrimary) {
+	ctx, cancel := context.WithTimeout(ctx, mirrorTimeout)
+	defer cancel()
+
+	fields := []any{
+		"request_id", provider.RequestIDFromContext(ctx),
+		"model", model,
+		"target", mirror.Target,
+		"primary", primary.providerKey,
+		"primary_ms", primary.latency.Milliseconds(),
+	}
+
+	plan, err := buildRoutingPlan(sourceFormat, endpoint, prov.APIMode())
+	if err != nil {
+		applogger.Warn("mirror_result", append(fields, "error", err.Error())...)
+		return
+	}
+	if plan.targetFormat == converters.APIFormatAnthropic && plan.converter == nil && headers[HeaderAnthropicVersion] == "" {
+		headers[HeaderAnthropicVersion] = AnthropicAPIVersion
+	}
+	forwardBody, forwardHeaders, err := prepareForwardRequest(body, headers, targetModel, plan)
+	if err != nil {
+		applogger.Warn("mirror_result", append(fields, "error", err.Error())...)
+		return
+	}
+	forwardBody = s.rewriteOptions(model, mirror.Target, forwardBody)
+
+	start := time.Now()
+	resp, err := prov.DoRequest(ctx, plan.forwardEndpoint, forwardBody, forwardHeaders)
+	fields = append(fields, "mirror_ms", time.Since(start).Milliseconds())
+	if err == nil && plan.converter != nil {
+		resp, err = plan.converter.ConvertResponse(resp)
+	}
+	if err != nil {
+		applogger.Warn("mirror_result", append(fields, "error_class", classifyError(err).String(), "error", err.Error())...)
+		return
+	}
+
+	primaryText, primaryOK := responseText(sourceFormat, primary.response)
+	mirrorText, mirrorOK := responseText(sourceFormat, resp)
+	fields = append(fields, "primary_chars", len(primaryText), "mirror_chars", len(mirrorText))
+	if primaryOK && mirrorOK {
+		fields = append(fields, "same_output", primaryText == mirrorText)
+	}
+	applogger.Info("mirror_result", fields...)
+}
+
+// sampleMirror reports whether a request falls within the mirrored percentage
+func sampleMirror(percent float64) bool {
+	return percent > 0 && rand.Float64()*100 < percent
+}
+
+// responseText extracts the generated text of a non-streaming chat response
+func responseText(format converters.APIFormat, resp []byte) (string, bool) {
+	if format == converters.APIFormatAnthropic {
+		var msg struct {
+			Content []struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"content"`
+		}
+		if err := json.Unmarshal(resp, &msg); err != nil {
+			return "", false
+		}
+		var sb strings.Builder
+		for _, block := range msg.Content {
+			if block.Type == "text" {
+				sb.WriteString(block.Text)
+			}
+		}
+		return sb.String(), true
+	}
+
+	var completion struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(resp, &completion); err != nil || len(completion.Choices) == 0 {
+		return "", false
+	}
+	return completion.Choices[0].Message.Content, true
+}
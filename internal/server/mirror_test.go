@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/endpoints"
+	"github.com/macedot/openmodel/internal/server/converters"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleV1ChatCompletions_Mirror(t *testing.T) {
+	tests := []struct {
+		name       string
+		percent    float64
+		wantMirror bool
+	}{
+		{name: "mirrored", percent: 100, wantMirror: true},
+		{name: "disabled", percent: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary := &stubProvider{
+				name: "primary",
+				doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+					return []byte(`{"id":"c1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`), nil
+				},
+			}
+			mirrored := make(chan []byte, 1)
+			shadow := &stubProvider{
+				name: "shadow",
+				doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+					mirrored <- body
+					return nil, errors.New("shadow unavailable")
+				},
+			}
+			srv := newStreamingTestServer(primary)
+			srv.providers["shadow"] = shadow
+			modelConfig := srv.config.Models["gpt-4"]
+			modelConfig.Mirror = &config.MirrorConfig{Target: "shadow/gpt-4o-mini", Percent: tt.percent}
+			srv.config.Models["gpt-4"] = modelConfig
+
+			app := fiber.New()
+			app.Post(endpoints.V1ChatCompletions, srv.handleV1ChatCompletions)
+			req := httptest.NewRequest("POST", endpoints.V1ChatCompletions, strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, fiber.StatusOK, resp.StatusCode, "the shadow's failure never reaches the client")
+
+			select {
+			case body := <-mirrored:
+				assert.True(t, tt.wantMirror, "request mirrored with percent %v", tt.percent)
+				assert.Contains(t, string(body), `"model":"gpt-4o-mini"`)
+			case <-time.After(200 * time.Millisecond):
+				assert.False(t, tt.wantMirror, "mirror request not sent")
+			}
+			assert.True(t, srv.state.Allow("shadow/gpt-4o-mini", srv.breakerPolicy("shadow/gpt-4o-mini")),
+				"mirror failures do not count against the target")
+		})
+	}
+}
+
+func TestResponseText(t *testing.T) {
+	tests := []struct {
+		name   string
+		format converters.APIFormat
+		resp   string
+		want   string
+		wantOK bool
+	}{
+		{name: "openai", format: converters.APIFormatOpenAI, resp: `{"choices":[{"message":{"content":"hi"}}]}`, want: "hi", wantOK: true},
+		{name: "openai without choices", format: converters.APIFormatOpenAI, resp: `{"choices":[]}`},
+		{name: "anthropic", format: converters.APIFormatAnthropic, resp: `{"content":[{"type":"text","text":"a"},{"type":"tool_use"},{"type":"text","text":"b"}]}`, want: "ab", wantOK: true},
+		{name: "invalid json", format: converters.APIFormatAnthropic, resp: `{`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := responseText(tt.format, []byte(tt.resp))
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantOK, ok)
+		})
+	}
+}
@@ -0,0 +1,202 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/macedot/openmodel/internal/config"
+	applogger "github.com/macedot/openmodel/internal/logger"
+	"github.com/macedot/openmodel/internal/state"
+)
+
+// webhookTimeout bounds posting a cost alert or notification to a webhook
+const webhookTimeout = 10 * time.Second
+
+// webhookClient posts cost alerts and notifications to webhooks
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// Reason a health check took a backend down, next to the error classes of failed requests
+const notifyReasonHealthCheck = "health_check"
+
+// notifier remembers the backends and models reported down, so an outage is notified
+// once and a recovery only after an outage
+type notifier struct {
+	mu       sync.Mutex
+	backends map[string]bool
+	models   map[string]bool
+}
+
+// setDown records in set whether a backend or model is down and reports whether that
+// changed. The caller holds the notifier's lock.
+func (n *notifier) setDown(set map[string]bool, name string, down bool) bool {
+	if set[name] == down {
+		return false
+	}
+	if down {
+		set[name] = true
+	} else {
+		delete(set, name)
+	}
+	return true
+}
+
+// notificationEvent is the JSON body posted to notification webhooks
+type notificationEvent struct {
+	Event   string `json:"event"`
+	Backend string `json:"backend,omitempty"`
+	Model   string `json:"model,omitempty"`
+	Reason  string `json:"reason,omitempty"` // Why a backend went down: the error class or health_check
+	Error   string `json:"error,omitempty"`
+	Time    string `json:"time"`
+}
+
+// message describes the event in a sentence, for chat webhooks
+func (e notificationEvent) message() string {
+	switch e.Event {
+	case config.NotifyBackendDown:
+		msg := fmt.Sprintf("openmodel: backend %s is down (%s)", e.Backend, e.Reason)
+		if e.Error != "" {
+			msg += ": " + e.Error
+		}
+		return msg
+	case config.NotifyBackendUp:
+		return fmt.Sprintf("openmodel: backend %s recovered", e.Backend)
+	case config.NotifyModelDown:
+		return fmt.Sprintf("openmodel: model %s is down, none of its backends is in rotation", e.Model)
+	default:
+		return fmt.Sprintf("openmodel: model %s recovered", e.Model)
+	}
+}
+
+// payload returns the body posted in a webhook format
+func (e notificationEvent) payload(format string) any {
+	switch format {
+	case config.NotifyFormatSlack:
+		return map[string]string{"text": e.message()}
+	case config.NotifyFormatDiscord:
+		return map[string]string{"content": e.message()}
+	default:
+		return e
+	}
+}
+
+// backendDown notifies that a backend was taken out of rotation, once per outage, and
+// that the models it serves are down when none of their backends is left in rotation
+func (s *Server) backendDown(backend, reason string, cause error) {
+	var down []notificationEvent
+	now := time.Now().UTC().Format(time.RFC3339)
+	s.notifier.mu.Lock()
+	if s.notifier.backends == nil {
+		s.notifier.backends, s.notifier.models = make(map[string]bool), make(map[string]bool)
+	}
+	if s.notifier.setDown(s.notifier.backends, backend, true) {
+		event := notificationEvent{Event: config.NotifyBackendDown, Backend: backend, Reason: reason, Time: now}
+		if cause != nil {
+			event.Error = cause.Error()
+		}
+		down = append(down, event)
+	}
+	for model, modelCfg := range s.GetConfig().Models {
+		if !servesBackend(modelCfg, backend) || s.notifier.models[model] || s.modelInRotation(modelCfg) {
+			continue
+		}
+		s.notifier.setDown(s.notifier.models, model, true)
+		down = append(down, notificationEvent{Event: config.NotifyModelDown, Model: model, Time: now})
+	}
+	s.notifier.mu.Unlock()
+	for _, event := range down {
+		s.notify(event)
+	}
+}
+
+// backendUp notifies that a backend reported down is back in rotation, and that the
+// models reported down it serves recovered
+func (s *Server) backendUp(backend string) {
+	var up []notificationEvent
+	now := time.Now().UTC().Format(time.RFC3339)
+	s.notifier.mu.Lock()
+	if !s.notifier.backends[backend] {
+		s.notifier.mu.Unlock()
+		return
+	}
+	s.notifier.setDown(s.notifier.backends, backend, false)
+	up = append(up, notificationEvent{Event: config.NotifyBackendUp, Backend: backend, Time: now})
+	for model, modelCfg := range s.GetConfig().Models {
+		if servesBackend(modelCfg, backend) && s.notifier.setDown(s.notifier.models, model, false) {
+			up = append(up, notificationEvent{Event: config.NotifyModelUp, Model: model, Time: now})
+		}
+	}
+	s.notifier.mu.Unlock()
+	for _, event := range up {
+		s.notify(event)
+	}
+}
+
+// notifiedDown reports whether a backend was reported down and has not recovered since
+func (s *Server) notifiedDown(backend string) bool {
+	s.notifier.mu.Lock()
+	defer s.notifier.mu.Unlock()
+	return s.notifier.backends[backend]
+}
+
+// servesBackend reports whether backend is in the model's chain
+func servesBackend(modelCfg config.ModelConfig, backend string) bool {
+	for _, p := range modelCfg.Providers {
+		if formatProviderKey(p) == backend {
+			return true
+		}
+	}
+	return false
+}
+
+// modelInRotation reports whether a backend of the model is enabled with its circuit closed
+func (s *Server) modelInRotation(modelCfg config.ModelConfig) bool {
+	for _, p := range modelCfg.Providers {
+		key := formatProviderKey(p)
+		if s.state.Enabled(key) && s.state.Circuit(key) == state.CircuitClosed {
+			return true
+		}
+	}
+	return false
+}
+
+// notify logs an event and posts it to the webhooks that want it, in the background
+func (s *Server) notify(event notificationEvent) {
+	if event.Event == config.NotifyBackendDown || event.Event == config.NotifyModelDown {
+		applogger.Warn(event.Event, "backend", event.Backend, "model", event.Model, "reason", event.Reason)
+	} else {
+		applogger.Info(event.Event, "backend", event.Backend, "model", event.Model)
+	}
+	for _, n := range s.GetConfig().Notifications {
+		if !n.Wants(event.Event) {
+			continue
+		}
+		go func() {
+			if err := postWebhook(n.GetWebhook(), event.payload(n.GetFormat())); err != nil {
+				applogger.Warn("notification_webhook_failed", "notification", n.Name, "event", event.Event, "error", err)
+			}
+		}()
+	}
+}
+
+// postWebhook posts a JSON body to a webhook
+func postWebhook(webhook string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := webhookClient.Post(webhook, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/provider"
+	"github.com/macedot/openmodel/internal/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifications(t *testing.T) {
+	type posted struct {
+		path string
+		body map[string]any
+	}
+	posts := make(chan posted, 20)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		posts <- posted{r.URL.Path, body}
+	}))
+	defer webhook.Close()
+
+	var failing atomic.Bool
+	failing.Store(true)
+	prov := &stubProvider{
+		name: "primary",
+		doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+			if failing.Load() {
+				return nil, &provider.StatusError{StatusCode: 503, Err: errors.New("overloaded")}
+			}
+			return []byte(`{"id":"c1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}]}`), nil
+		},
+	}
+	cfg := &config.Config{
+		Models: map[string]config.ModelConfig{
+			"gpt-4": {Strategy: config.StrategyFallback, Providers: []config.ModelProvider{{Provider: "primary", Model: "gpt-4"}}},
+		},
+		Thresholds: config.ThresholdsConfig{FailuresBeforeSwitch: 1, CooldownMs: 20, MaxTimeout: 10000},
+		Notifications: []config.Notification{
+			{Webhook: webhook.URL + "/json"},
+			{Webhook: webhook.URL + "/slack", Format: config.NotifyFormatSlack, Events: []string{config.NotifyModelDown}},
+		},
+	}
+	srv := &Server{config: cfg, providers: providerMap{"primary": prov}, state: state.New()}
+	app := fiber.New()
+	srv.registerRoutes(app)
+
+	chat := func() int {
+		req := httptest.NewRequest("POST", EndpointV1ChatCompletions, strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp.StatusCode
+	}
+	collect := func(n int) map[string]map[string]any {
+		t.Helper()
+		got := make(map[string]map[string]any)
+		for range n {
+			select {
+			case p := <-posts:
+				key := p.path
+				if event, ok := p.body["event"].(string); ok {
+					key += " " + event
+				}
+				got[key] = p.body
+			case <-time.After(5 * time.Second):
+				t.Fatalf("got %d of %d notifications: %v", len(got), n, got)
+			}
+		}
+		select {
+		case p := <-posts:
+			t.Fatalf("unexpected notification %+v", p)
+		case <-time.After(50 * time.Millisecond):
+		}
+		return got
+	}
+
+	assert.Equal(t, fiber.StatusServiceUnavailable, chat())
+	got := collect(3)
+	require.Contains(t, got, "/json backend_down")
+	assert.Equal(t, "primary/gpt-4", got["/json backend_down"]["backend"])
+	assert.Equal(t, "server_error", got["/json backend_down"]["reason"])
+	assert.Equal(t, "gpt-4", got["/json model_down"]["model"])
+	assert.Equal(t, map[string]any{"text": "openmodel: model gpt-4 is down, none of its backends is in rotation"}, got["/slack"])
+
+	// The outage is notified once, however many requests fail
+	assert.Equal(t, fiber.StatusServiceUnavailable, chat())
+	collect(0)
+
+	// The probe after the cooldown succeeds
+	failing.Store(false)
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, fiber.StatusOK, chat())
+	got = collect(2)
+	assert.Equal(t, "primary/gpt-4", got["/json backend_up"]["backend"])
+	assert.Equal(t, "gpt-4", got["/json model_up"]["model"])
+}
+
+func TestNotificationEvent_Payload(t *testing.T) {
+	event := notificationEvent{Event: config.NotifyBackendDown, Backend: "openai/gpt-4o", Reason: "timeout", Error: "backend total timeout after 30s"}
+	assert.Equal(t, map[string]string{"content": "openmodel: backend openai/gpt-4o is down (timeout): backend total timeout after 30s"}, event.payload(config.NotifyFormatDiscord))
+	assert.Equal(t, event, event.payload(config.NotifyFormatJSON))
+}
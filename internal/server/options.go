@@ -0,0 +1,121 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/macedot/openmodel/internal/config"
+)
+
+// rewriteOptions applies the option rules of the backend providerKey of model to a JSON
+// request body about to be forwarded to it. Backends outside the model's chain (e.g. a
+// mirror target) get their provider's rules.
+func (s *Server) rewriteOptions(model, providerKey string, body []byte) []byte {
+	cfg := s.GetConfig()
+	backend, ok := s.modelBackend(model, providerKey)
+	if !ok {
+		backend.Provider, backend.Model, _ = strings.Cut(providerKey, "/")
+	}
+	return applyOptionRules(body, cfg.BackendOptions(backend))
+}
+
+// modelBackend returns the backend providerKey in model's chain
+func (s *Server) modelBackend(model, providerKey string) (config.ModelProvider, bool) {
+	for _, p := range s.GetConfig().Models[model].Providers {
+		if formatProviderKey(p) == providerKey {
+			return p, true
+		}
+	}
+	return config.ModelProvider{}, false
+}
+
+// applyOptionRules rewrites the options of a JSON request body with each set of rules in
+// turn. Bodies that are not JSON objects are returned as is.
+func applyOptionRules(body []byte, rules []*config.OptionRules) []byte {
+	if len(rules) == 0 || len(body) == 0 {
+		return body
+	}
+	var req map[string]any
+	if err := json.Unmarshal(body, &req); err != nil {
+		return body
+	}
+
+	for _, r := range rules {
+		for _, name := range r.Strip {
+			deleteOption(req, name)
+		}
+		for from, to := range r.Rename {
+			if value, ok := lookupOption(req, from); ok {
+				deleteOption(req, from)
+				setOption(req, to, value)
+			}
+		}
+		for name, rng := range r.Clamp {
+			value, ok := lookupOption(req, name)
+			n, isNumber := value.(float64)
+			if !ok || !isNumber {
+				continue
+			}
+			if rng.Min != nil && n < *rng.Min {
+				setOption(req, name, *rng.Min)
+			} else if rng.Max != nil && n > *rng.Max {
+				setOption(req, name, *rng.Max)
+			}
+		}
+		for name, value := range r.Defaults {
+			if _, ok := lookupOption(req, name); !ok {
+				setOption(req, name, value)
+			}
+		}
+	}
+
+	result, err := json.Marshal(req)
+	if err != nil {
+		return body
+	}
+	return result
+}
+
+// lookupOption returns the value of a dotted option path
+func lookupOption(req map[string]any, name string) (any, bool) {
+	parent, key, ok := optionParent(req, name, false)
+	if !ok {
+		return nil, false
+	}
+	value, ok := parent[key]
+	return value, ok
+}
+
+// setOption sets a dotted option path, creating the objects leading to it
+func setOption(req map[string]any, name string, value any) {
+	if parent, key, ok := optionParent(req, name, true); ok {
+		parent[key] = value
+	}
+}
+
+// deleteOption removes a dotted option path
+func deleteOption(req map[string]any, name string) {
+	if parent, key, ok := optionParent(req, name, false); ok {
+		delete(parent, key)
+	}
+}
+
+// optionParent walks a dotted option path to the object holding its last field. With
+// create, missing objects on the way are added; a non-object on the way fails.
+func optionParent(req map[string]any, name string, create bool) (map[string]any, string, bool) {
+	parts := strings.Split(name, ".")
+	current := req
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]any)
+		if !ok {
+			if _, exists := current[part]; exists || !create {
+				return nil, "", false
+			}
+			next = make(map[string]any)
+			current[part] = next
+		}
+		current = next
+	}
+	return current, parts[len(parts)-1], true
+}
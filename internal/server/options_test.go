@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/endpoints"
+	"github.com/macedot/openmodel/internal/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyOptionRules(t *testing.T) {
+	one, zero := 1.0, 0.0
+	tests := []struct {
+		name  string
+		body  string
+		rules []*config.OptionRules
+		want  string
+	}{
+		{
+			name: "no rules",
+			body: `{"temperature":1.5}`,
+			want: `{"temperature":1.5}`,
+		},
+		{
+			name:  "strip nested",
+			body:  `{"model":"m","options":{"num_ctx":8192,"seed":1}}`,
+			rules: []*config.OptionRules{{Strip: []string{"options.num_ctx", "missing.field"}}},
+			want:  `{"model":"m","options":{"seed":1}}`,
+		},
+		{
+			name:  "rename",
+			body:  `{"max_tokens":100}`,
+			rules: []*config.OptionRules{{Rename: map[string]string{"max_tokens": "max_completion_tokens"}}},
+			want:  `{"max_completion_tokens":100}`,
+		},
+		{
+			name:  "clamp above and below",
+			body:  `{"temperature":1.7,"top_p":-0.5,"presence_penalty":"high"}`,
+			rules: []*config.OptionRules{{Clamp: map[string]config.OptionRange{"temperature": {Max: &one}, "top_p": {Min: &zero, Max: &one}, "presence_penalty": {Max: &one}}}},
+			want:  `{"presence_penalty":"high","temperature":1,"top_p":0}`,
+		},
+		{
+			name:  "defaults only fill gaps",
+			body:  `{"temperature":0.2}`,
+			rules: []*config.OptionRules{{Defaults: map[string]any{"temperature": 0.7, "options.num_ctx": 4096.0}}},
+			want:  `{"options":{"num_ctx":4096},"temperature":0.2}`,
+		},
+		{
+			name: "provider then backend rules",
+			body: `{"temperature":1.5}`,
+			rules: []*config.OptionRules{
+				{Clamp: map[string]config.OptionRange{"temperature": {Max: &one}}},
+				{Rename: map[string]string{"temperature": "temp"}},
+			},
+			want: `{"temp":1}`,
+		},
+		{
+			name:  "not json",
+			body:  `--boundary`,
+			rules: []*config.OptionRules{{Strip: []string{"temperature"}}},
+			want:  `--boundary`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, string(applyOptionRules([]byte(tt.body), tt.rules)))
+		})
+	}
+}
+
+func TestHandleV1ChatCompletions_OptionRulesPerBackend(t *testing.T) {
+	one := 1.0
+	var bodies []string
+	record := func(fail bool) func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+		return func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+			bodies = append(bodies, string(body))
+			if fail {
+				return nil, errors.New("upstream error")
+			}
+			return []byte(`{"id":"ok","object":"chat.completion","choices":[]}`), nil
+		}
+	}
+	cfg := &config.Config{
+		Providers: map[string]config.ProviderConfig{
+			"local": {Options: &config.OptionRules{Strip: []string{"temperature"}}},
+		},
+		Models: map[string]config.ModelConfig{
+			"gpt-4": {Strategy: config.StrategyFallback, Providers: []config.ModelProvider{
+				{Provider: "local", Model: "llama3", Options: &config.OptionRules{Defaults: map[string]any{"options.num_ctx": 8192}}},
+				{Provider: "hosted", Model: "gpt-4o", Options: &config.OptionRules{Clamp: map[string]config.OptionRange{"temperature": {Max: &one}}}},
+			}},
+		},
+		Thresholds: config.ThresholdsConfig{FailuresBeforeSwitch: 1, InitialTimeout: 1000, MaxTimeout: 10000},
+	}
+	srv := &Server{config: cfg, state: state.New(), providers: providerMap{
+		"local":  &stubProvider{name: "local", doRequestFn: record(true)},
+		"hosted": &stubProvider{name: "hosted", doRequestFn: record(false)},
+	}}
+
+	app := fiber.New()
+	app.Post(endpoints.V1ChatCompletions, srv.handleV1ChatCompletions)
+	req := httptest.NewRequest("POST", endpoints.V1ChatCompletions, strings.NewReader(`{"model":"gpt-4","temperature":1.8,"messages":[{"role":"user","content":"hello"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	require.NoError(t, err)
+	_, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	require.Len(t, bodies, 2)
+	assert.NotContains(t, bodies[0], "temperature")
+	assert.Contains(t, bodies[0], `"options":{"num_ctx":8192}`)
+	assert.Contains(t, bodies[1], `"temperature":1}`, "the next backend gets the original options under its own rules")
+	assert.NotContains(t, bodies[1], "num_ctx")
+}
@@ -0,0 +1,107 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/state"
+)
+
+// readinessCheck is one check of the readiness probe
+type readinessCheck struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// isProbe reports whether path is a liveness or readiness probe, which every listener
+// serves and a drain does not turn away
+func isProbe(path string) bool {
+	return path == EndpointHealthz || path == EndpointReadyz
+}
+
+// handleHealthz handles GET /healthz, the liveness probe: the process is up and serving
+func (s *Server) handleHealthz(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+// handleReadyz handles GET /readyz, the readiness probe. The server is ready to take
+// traffic when its config is valid, it is not draining and each critical model has a
+// backend in rotation; otherwise it responds 503 with the checks that failed.
+func (s *Server) handleReadyz(c *fiber.Ctx) error {
+	checks := s.readinessChecks()
+	status, code := "ready", fiber.StatusOK
+	for _, check := range checks {
+		if !check.OK {
+			status, code = "not_ready", fiber.StatusServiceUnavailable
+			break
+		}
+	}
+	return c.Status(code).JSON(fiber.Map{"status": status, "checks": checks})
+}
+
+// readinessChecks runs the checks of the readiness probe
+func (s *Server) readinessChecks() []readinessCheck {
+	cfg := s.GetConfig()
+	check := func(name string, err error) readinessCheck {
+		if err != nil {
+			return readinessCheck{Name: name, Error: err.Error()}
+		}
+		return readinessCheck{Name: name, OK: true}
+	}
+
+	var configErr error
+	if cfg == nil {
+		configErr = fmt.Errorf("no config loaded")
+	} else {
+		configErr = cfg.Validate()
+	}
+	checks := []readinessCheck{check("config", configErr)}
+
+	var drainErr error
+	if s.drain.status().Draining {
+		drainErr = fmt.Errorf("server is draining")
+	}
+	checks = append(checks, check("drain", drainErr))
+
+	if cfg == nil {
+		return checks
+	}
+	for _, model := range cfg.Readiness.GetCriticalModels() {
+		var modelErr error
+		if !s.modelReady(cfg.Models[model]) {
+			modelErr = fmt.Errorf("no backend of model %q is in rotation", model)
+		}
+		checks = append(checks, check("model "+model, modelErr))
+	}
+	return checks
+}
+
+// modelReady reports whether a backend of the model is in rotation: enabled, its circuit
+// closed, within its schedule and its provider under budget. Unlike routing it does not
+// let a probe request through.
+func (s *Server) modelReady(modelCfg config.ModelConfig) bool {
+	s.providersMu.RLock()
+	defer s.providersMu.RUnlock()
+	now := time.Now()
+	for _, p := range modelCfg.Providers {
+		key := formatProviderKey(p)
+		if _, exists := s.providers[p.Provider]; !exists {
+			continue
+		}
+		if !s.state.Enabled(key) || s.state.Circuit(key) != state.CircuitClosed {
+			continue
+		}
+		if p.Schedule != nil && !p.Schedule.Active(now) {
+			continue
+		}
+		if s.budgetExhausted(p.Provider) {
+			continue
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbes(t *testing.T) {
+	srv, _ := newAdminTestServer(nil)
+	srv.config.Providers = map[string]config.ProviderConfig{"stable": {URL: "http://stable:8080"}, "canary": {URL: "http://canary:8080"}}
+	srv.config.Readiness = &config.ReadinessConfig{CriticalModels: []string{"ordered"}}
+	app := fiber.New()
+	app.Use(srv.drainMiddleware())
+	srv.registerRoutes(app)
+
+	probe := func(path string) (int, []readinessCheck) {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+		require.NoError(t, err)
+		var body struct {
+			Checks []readinessCheck `json:"checks"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		return resp.StatusCode, body.Checks
+	}
+
+	code, checks := probe(EndpointReadyz)
+	assert.Equal(t, fiber.StatusOK, code)
+	assert.Equal(t, []readinessCheck{{Name: "config", OK: true}, {Name: "drain", OK: true}, {Name: "model ordered", OK: true}}, checks)
+
+	// The only backend of a critical model is out of rotation
+	srv.state.SetEnabled("stable/gpt-4o", false)
+	code, checks = probe(EndpointReadyz)
+	assert.Equal(t, fiber.StatusServiceUnavailable, code)
+	assert.Equal(t, readinessCheck{Name: "model ordered", Error: `no backend of model "ordered" is in rotation`}, checks[2])
+	srv.state.SetEnabled("stable/gpt-4o", true)
+
+	srv.state.Disable("stable/gpt-4o")
+	code, _ = probe(EndpointReadyz)
+	assert.Equal(t, fiber.StatusServiceUnavailable, code)
+	srv.state.ResetModel("stable/gpt-4o")
+
+	// A draining server is alive but not ready
+	srv.drain.start(time.Minute, false)
+	code, _ = probe(EndpointHealthz)
+	assert.Equal(t, fiber.StatusOK, code)
+	code, checks = probe(EndpointReadyz)
+	assert.Equal(t, fiber.StatusServiceUnavailable, code)
+	assert.Equal(t, readinessCheck{Name: "drain", Error: "server is draining"}, checks[1])
+	srv.drain.resume()
+
+	// A config that fails validation, e.g. swapped in without it
+	srv.config.Readiness.CriticalModels = []string{"missing"}
+	code, checks = probe(EndpointReadyz)
+	assert.Equal(t, fiber.StatusServiceUnavailable, code)
+	assert.False(t, checks[0].OK)
+	assert.Contains(t, checks[0].Error, `critical model "missing"`)
+}
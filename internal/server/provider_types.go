@@ -1,6 +1,14 @@
 package server
 
-import "github.com/macedot/openmodel/internal/provider"
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/credentials"
+	"github.com/macedot/openmodel/internal/provider"
+)
 
 type requestProvider interface {
 	provider.RawRequester
@@ -30,3 +38,74 @@ func asProviderMap(providers map[string]provider.Provider) providerMap {
 }
 
 var _ requestProvider = provider.Provider(nil)
+
+// NewProvider creates a configured provider: of a built-in type, a configured plugin,
+// replaying fixtures, or echoing prompts
+func NewProvider(cfg *config.Config, name string, pc config.ProviderConfig) (provider.Provider, error) {
+	spec, err := providerSpec(cfg, name, pc)
+	if err != nil {
+		return nil, err
+	}
+	if plugin, ok := cfg.Plugins[pc.Type]; ok {
+		return provider.NewPluginProvider(spec, provider.PluginConfig{Command: plugin.Command, Env: plugin.Env}), nil
+	}
+	if pc.Type == provider.TypeReplay && pc.Replay != nil {
+		p, err := provider.NewReplayProvider(spec, provider.ReplayConfig{Fixtures: pc.Replay.Fixtures, Record: pc.Replay.Record})
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+	if pc.Type == provider.TypeEcho {
+		var echo provider.EchoConfig
+		if pc.Echo != nil {
+			echo.Delay = time.Duration(pc.Echo.DelayMs) * time.Millisecond
+			echo.TokenDelay = time.Duration(pc.Echo.TokenDelayMs) * time.Millisecond
+		}
+		return provider.NewEchoProvider(spec, echo), nil
+	}
+	return provider.New(pc.Type, spec)
+}
+
+// providerSpec builds the provider.Spec of a configured provider, with its HTTP client
+// settings (see config.ProviderHTTP) and headers. A key from an api_key_source is fetched
+// here, so a source that fails fails the provider.
+func providerSpec(cfg *config.Config, name string, pc config.ProviderConfig) (provider.Spec, error) {
+	h := cfg.ProviderHTTP(name)
+	spec := provider.Spec{
+		Name:         name,
+		BaseURL:      pc.URL,
+		APIKey:       pc.APIKey,
+		APIMode:      pc.ApiMode,
+		Capabilities: pc.Capabilities,
+		MaxContext:   pc.MaxContext,
+		HTTP: provider.HTTPConfig{
+			TimeoutSeconds:               h.TimeoutSeconds,
+			MaxIdleConns:                 h.MaxIdleConns,
+			MaxIdleConnsPerHost:          h.MaxIdleConnsPerHost,
+			IdleConnTimeoutSeconds:       h.IdleConnTimeoutSeconds,
+			DialTimeoutSeconds:           h.DialTimeoutSeconds,
+			TLSHandshakeTimeoutSeconds:   h.TLSHandshakeTimeoutSeconds,
+			ResponseHeaderTimeoutSeconds: h.ResponseHeaderTimeoutSeconds,
+			KeepAliveSeconds:             h.KeepAliveSeconds,
+			DisableKeepAlives:            h.DisableKeepAlives,
+			Headers:                      pc.GetHeaders(),
+			Proxy:                        h.Proxy,
+		},
+	}
+	if src := pc.APIKeySource; src != nil {
+		secret, err := credentials.Load(context.Background(), credentials.Source{
+			File:      src.File,
+			Command:   src.Command,
+			Vault:     src.Vault,
+			AWSSecret: src.AWSSecret,
+			GCPSecret: src.GCPSecret,
+			Refresh:   time.Duration(src.RefreshSeconds) * time.Second,
+		})
+		if err != nil {
+			return provider.Spec{}, fmt.Errorf("provider %q: %w", name, err)
+		}
+		spec.APIKeySource = secret
+	}
+	return spec, nil
+}
@@ -2,12 +2,20 @@
 package server
 
 import (
+	"context"
+	"fmt"
 	"net"
 	"strings"
 	"sync"
 	"time"
+
+	applogger "github.com/macedot/openmodel/internal/logger"
+	"github.com/macedot/openmodel/internal/state"
 )
 
+// sharedRateLimitTimeout bounds the store round trip of a cluster-wide rate limit check
+const sharedRateLimitTimeout = 200 * time.Millisecond
+
 // RateLimiter implements a token bucket rate limiter per IP address
 type RateLimiter struct {
 	mu             sync.RWMutex
@@ -17,6 +25,7 @@ type RateLimiter struct {
 	cleanup        time.Duration // cleanup interval
 	lastCleanup    time.Time
 	trustedProxies []*net.IPNet // CIDR networks that are trusted to send X-Forwarded-For headers
+	shared         state.Store  // Counts requests cluster-wide when set
 }
 
 // tokenBucket represents a token bucket for rate limiting
@@ -94,8 +103,23 @@ func NewDefaultRateLimiter() *RateLimiter {
 	return NewRateLimiter(DefaultRequestsPerSecond, DefaultBurst, DefaultCleanupInterval)
 }
 
+// SetSharedStore counts requests in a store shared by all instances, allowing up to
+// max(rate, burst) requests per IP in each one-second window. The local token bucket
+// is used while the store is unreachable.
+func (rl *RateLimiter) SetSharedStore(store state.Store) {
+	rl.shared = store
+}
+
 // Allow checks if a request from the given IP is allowed
 func (rl *RateLimiter) Allow(ip string) bool {
+	if rl.shared != nil {
+		allowed, err := rl.allowShared(ip)
+		if err == nil {
+			return allowed
+		}
+		applogger.Debug("shared_rate_limit_failed", "error", err.Error())
+	}
+
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
@@ -131,6 +155,18 @@ func (rl *RateLimiter) Allow(ip string) bool {
 	return false
 }
 
+// allowShared counts the request in the current one-second window of the shared store
+func (rl *RateLimiter) allowShared(ip string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), sharedRateLimitTimeout)
+	defer cancel()
+	key := fmt.Sprintf("ratelimit:%s:%d", ip, time.Now().Unix())
+	n, err := rl.shared.Incr(ctx, key, 2*time.Second)
+	if err != nil {
+		return false, err
+	}
+	return n <= int64(max(rl.rate, rl.burst)), nil
+}
+
 // cleanupOldBuckets removes buckets that haven't been used recently
 func (rl *RateLimiter) cleanupOldBuckets() {
 	threshold := time.Now().Add(-rl.cleanup * 2)
@@ -2,9 +2,13 @@
 package server
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 
+	"github.com/macedot/openmodel/internal/state"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -285,3 +289,37 @@ func TestRateLimiterStats(t *testing.T) {
 	assert.Equal(t, 2, count)
 	assert.Equal(t, 10, rate)
 }
+
+// counterStore is a state.Store that only counts, optionally failing every call
+type counterStore struct {
+	state.Store
+	counts map[string]int64
+	err    error
+}
+
+func (c *counterStore) Incr(_ context.Context, key string, _ time.Duration) (int64, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	c.counts[key]++
+	return c.counts[key], nil
+}
+
+func TestRateLimiter_SharedStore(t *testing.T) {
+	store := &counterStore{counts: make(map[string]int64)}
+	rl := NewRateLimiter(2, 3, time.Minute)
+	rl.SetSharedStore(store)
+
+	// Another instance already used most of this second's (and the next second's) allowance
+	now := time.Now().Unix()
+	store.counts[fmt.Sprintf("ratelimit:10.0.0.1:%d", now)] = 2
+	store.counts[fmt.Sprintf("ratelimit:10.0.0.1:%d", now+1)] = 2
+	assert.True(t, rl.Allow("10.0.0.1"))
+	assert.False(t, rl.Allow("10.0.0.1"), "shared count exceeds the burst")
+	assert.Empty(t, rl.buckets, "local buckets unused while the store is reachable")
+
+	// Unreachable store falls back to the local token bucket
+	store.err = errors.New("connection refused")
+	assert.True(t, rl.Allow("10.0.0.1"))
+	assert.Len(t, rl.buckets, 1)
+}
@@ -0,0 +1,137 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/macedot/openmodel/internal/config"
+)
+
+// ConfigDiff lists what a configuration reload changed
+type ConfigDiff struct {
+	Providers NameDiff `json:"providers"`
+	Models    NameDiff `json:"models"`
+	// Settings are the other top-level sections that changed, by their config key
+	Settings []string `json:"settings"`
+}
+
+// NameDiff lists the named entries a reload added, removed or changed, sorted by name
+type NameDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []string `json:"changed"`
+}
+
+// Empty reports whether the reload changed nothing
+func (d ConfigDiff) Empty() bool {
+	return d.Providers.empty() && d.Models.empty() && len(d.Settings) == 0
+}
+
+func (d NameDiff) empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// String summarizes the diff for logs, e.g. "providers +ollama ~openai; settings thresholds"
+func (d ConfigDiff) String() string {
+	if d.Empty() {
+		return "no changes"
+	}
+	var parts []string
+	for _, section := range []struct {
+		name string
+		diff NameDiff
+	}{{"providers", d.Providers}, {"models", d.Models}} {
+		if section.diff.empty() {
+			continue
+		}
+		var names []string
+		for _, change := range []struct {
+			sign  string
+			names []string
+		}{{"+", section.diff.Added}, {"-", section.diff.Removed}, {"~", section.diff.Changed}} {
+			for _, name := range change.names {
+				names = append(names, change.sign+name)
+			}
+		}
+		parts = append(parts, section.name+" "+strings.Join(names, " "))
+	}
+	if len(d.Settings) > 0 {
+		parts = append(parts, "settings "+strings.Join(d.Settings, " "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// diffConfig compares two configurations as loaded from the file
+func diffConfig(old, cfg *config.Config) ConfigDiff {
+	diff := ConfigDiff{
+		Providers: diffNamed(old.Providers, cfg.Providers),
+		Models:    diffNamed(old.Models, cfg.Models),
+		Settings:  []string{},
+	}
+	oldValue, newValue := reflect.ValueOf(*old), reflect.ValueOf(*cfg)
+	for i := range oldValue.NumField() {
+		field := oldValue.Type().Field(i)
+		key, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || key == "-" || key == "providers" || key == "models" {
+			continue
+		}
+		if !reflect.DeepEqual(oldValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+			diff.Settings = append(diff.Settings, key)
+		}
+	}
+	return diff
+}
+
+// diffNamed compares two sets of named entries
+func diffNamed[V any](old, cfg map[string]V) NameDiff {
+	diff := NameDiff{Added: []string{}, Removed: []string{}, Changed: []string{}}
+	for name, value := range cfg {
+		oldValue, ok := old[name]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, name)
+		case !reflect.DeepEqual(oldValue, value):
+			diff.Changed = append(diff.Changed, name)
+		}
+	}
+	for name := range old {
+		if _, ok := cfg[name]; !ok {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	slices.Sort(diff.Added)
+	slices.Sort(diff.Removed)
+	slices.Sort(diff.Changed)
+	return diff
+}
+
+// loadedConfig returns the configuration as loaded from the file, without discovered models
+func (s *Server) loadedConfig() *config.Config {
+	s.discovery.mu.Lock()
+	base := s.discovery.base
+	s.discovery.mu.Unlock()
+	if base == nil {
+		return s.GetConfig()
+	}
+	return base
+}
+
+// ReloadFromFile re-reads the configuration file the server was started with, validates
+// it and swaps it in, returning what changed. On error the configuration is unchanged.
+func (s *Server) ReloadFromFile() (ConfigDiff, error) {
+	path := s.GetConfig().GetConfigPath()
+	if path == "" {
+		return ConfigDiff{}, fmt.Errorf("configuration was not loaded from a file")
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		return ConfigDiff{}, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return ConfigDiff{}, err
+	}
+	return s.swapConfig(cfg)
+}
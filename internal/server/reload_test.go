@@ -0,0 +1,144 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/provider"
+	"github.com/macedot/openmodel/internal/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffConfig(t *testing.T) {
+	base := func() *config.Config {
+		return &config.Config{
+			Providers: map[string]config.ProviderConfig{
+				"openai": {URL: "https://api.openai.com/v1", ApiMode: "openai"},
+				"ollama": {URL: "http://localhost:11434/v1", ApiMode: "openai"},
+			},
+			Models: map[string]config.ModelConfig{
+				"gpt-4": {Providers: []config.ModelProvider{{Provider: "openai", Model: "gpt-4"}}},
+			},
+			Thresholds: config.ThresholdsConfig{FailuresBeforeSwitch: 3},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(cfg *config.Config)
+		want   string
+	}{
+		{name: "unchanged", change: func(cfg *config.Config) {}, want: "no changes"},
+		{
+			name: "providers",
+			change: func(cfg *config.Config) {
+				delete(cfg.Providers, "ollama")
+				cfg.Providers["azure"] = config.ProviderConfig{URL: "https://azure", ApiMode: "openai"}
+				cfg.Providers["openai"] = config.ProviderConfig{URL: "https://proxy/v1", ApiMode: "openai"}
+			},
+			want: "providers +azure -ollama ~openai",
+		},
+		{
+			name: "models and settings",
+			change: func(cfg *config.Config) {
+				cfg.Models["gpt-4"] = config.ModelConfig{Providers: []config.ModelProvider{{Provider: "ollama", Model: "llama3"}}}
+				cfg.Thresholds.FailuresBeforeSwitch = 5
+				cfg.LogLevel = "debug"
+			},
+			want: "models ~gpt-4; settings log_level thresholds",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := base()
+			tt.change(cfg)
+			diff := diffConfig(base(), cfg)
+			assert.Equal(t, tt.want, diff.String())
+			assert.Equal(t, tt.want == "no changes", diff.Empty())
+		})
+	}
+}
+
+func TestHandleAdminReload(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	writeConfig := func(content string) {
+		require.NoError(t, os.WriteFile(configPath, []byte(content), 0644))
+	}
+	writeConfig(`{
+		"$schema": "https://raw.githubusercontent.com/macedot/openmodel/master/openmodel.schema.json",
+		"server": {"port": 12345, "host": "localhost"},
+		"admin": {"enabled": true, "token": "s3cret"},
+		"providers": {"local": {"url": "http://localhost:11434/v1", "api_mode": "openai"}},
+		"models": {"llama3": {"providers": ["local/llama3"]}}
+	}`)
+	cfg, err := config.Load(configPath)
+	require.NoError(t, err)
+	srv := New(cfg, map[string]provider.Provider{}, state.New(), "test")
+	app := fiber.New()
+	srv.registerRoutes(app)
+
+	reload := func(token string) (int, ConfigDiff) {
+		req := httptest.NewRequest("POST", EndpointAdminReload, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		var diff ConfigDiff
+		if resp.StatusCode == fiber.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&diff))
+		}
+		return resp.StatusCode, diff
+	}
+
+	status, _ := reload("guess")
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+
+	writeConfig(`{
+		"$schema": "https://raw.githubusercontent.com/macedot/openmodel/master/openmodel.schema.json",
+		"server": {"port": 12345, "host": "localhost"},
+		"admin": {"enabled": true, "token": "s3cret"},
+		"providers": {"local": {"url": "http://localhost:11434/v1", "api_mode": "openai"}},
+		"models": {"llama3": {"providers": ["local/llama3"]}, "qwen": {"providers": ["local/qwen"]}},
+		"thresholds": {"failures_before_switch": 5}
+	}`)
+	status, diff := reload("s3cret")
+	require.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, []string{"qwen"}, diff.Models.Added)
+	assert.Empty(t, diff.Providers.Changed)
+	assert.Equal(t, []string{"thresholds"}, diff.Settings)
+	assert.Contains(t, srv.GetConfig().Models, "qwen")
+	assert.Contains(t, srv.GetProviders(), "local")
+
+	// An invalid file is rejected and the running config kept
+	writeConfig(`{"models": {"broken": {"providers": ["missing/model"]}}}`)
+	status, _ = reload("s3cret")
+	assert.Equal(t, fiber.StatusUnprocessableEntity, status)
+	assert.Contains(t, srv.GetConfig().Models, "qwen")
+}
+
+func TestReloadConfig_KeepsOverrides(t *testing.T) {
+	fileConfig := func() *config.Config {
+		return &config.Config{
+			Server:    config.ServerConfig{Host: "localhost", Port: 12345},
+			Providers: map[string]config.ProviderConfig{},
+			Models:    map[string]config.ModelConfig{},
+			LogLevel:  "info",
+		}
+	}
+	overrides := config.Overrides{Port: 8080, LogLevel: "debug"}
+	cfg := fileConfig()
+	overrides.Apply(cfg)
+	srv := New(cfg, map[string]provider.Provider{}, state.New(), "test")
+	srv.SetOverrides(overrides)
+
+	diff, err := srv.swapConfig(fileConfig())
+	require.NoError(t, err)
+	assert.True(t, diff.Empty(), "the overridden settings are not reported as changed: %s", diff)
+	assert.Equal(t, 8080, srv.GetConfig().Server.Port)
+	assert.Equal(t, "debug", srv.GetConfig().LogLevel)
+}
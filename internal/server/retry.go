@@ -0,0 +1,95 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"time"
+
+	"github.com/macedot/openmodel/internal/config"
+	applogger "github.com/macedot/openmodel/internal/logger"
+	"github.com/macedot/openmodel/internal/provider"
+)
+
+// withRetry runs attempt against one provider, retrying transient failures according to
+// the model's retry policy. The last error is returned so the caller can fail over.
+func (s *Server) withRetry(ctx context.Context, model, providerKey string, attempt func() error) error {
+	policy := s.GetConfig().Models[model].GetRetryPolicy()
+
+	for n := 1; ; n++ {
+		err := attempt()
+		if err == nil || n >= policy.MaxAttempts || !isRetryable(ctx, policy, err) {
+			return err
+		}
+
+		delay := retryDelay(policy, n, err)
+		applogger.Info("provider_retry",
+			"request_id", provider.RequestIDFromContext(ctx),
+			"provider", providerKey,
+			"attempt", n,
+			"delay_ms", delay.Milliseconds(),
+			"error", err.Error())
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// callProvider runs a non-streaming provider call with retries, counting it as in flight.
+// Each attempt gets its own context bounded by the backend's connect and total timeouts.
+func (s *Server) callProvider(ctx context.Context, model, providerKey string, call func(ctx context.Context) error) error {
+	return s.withRetry(ctx, model, providerKey, func() error {
+		release, err := s.trackInFlight(providerKey)
+		if err != nil {
+			return err
+		}
+		defer release()
+		attempt := s.startAttempt(ctx, model, providerKey, false)
+		defer attempt.end()
+		err = attempt.err(call(attempt.ctx))
+		attempt.fail(err)
+		servedByFromContext(ctx).record(providerKey, time.Since(attempt.start), err)
+		return err
+	})
+}
+
+// isRetryable reports whether err is transient under policy: a retry_on status,
+// a timeout, or a connection error. Cancellation by the client is never retried.
+func isRetryable(ctx context.Context, policy config.RetryConfig, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if status := provider.StatusCodeOf(err); status != 0 {
+		return policy.RetriesStatus(status)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr)
+}
+
+// retryDelay returns the backoff before retry n, honouring a provider Retry-After
+// (capped at the policy maximum) and applying jitter
+func retryDelay(policy config.RetryConfig, n int, err error) time.Duration {
+	delay := policy.Backoff(n)
+	if retryAfter := provider.RetryAfterOf(err); retryAfter > delay {
+		delay = min(retryAfter, time.Duration(policy.MaxBackoffMs)*time.Millisecond)
+	}
+	if policy.Jitter > 0 && delay > 0 {
+		spread := float64(delay) * policy.Jitter
+		delay += time.Duration((rand.Float64()*2 - 1) * spread)
+	}
+	return max(delay, 0)
+}
@@ -0,0 +1,73 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"context"
+	"sync"
+)
+
+// routeAttemptsCtxKey is the context key of the backends a request was routed to
+type routeAttemptsCtxKey struct{}
+
+// routeAttempts records the backends one request was routed to, so the failover loops do
+// not send it again to a backend that already failed it, and a backend's circuit breaker
+// admits it once however often routing picks that backend for it
+type routeAttempts struct {
+	mu      sync.Mutex
+	claimed map[string]bool // Admitted by their circuit breaker
+	failed  map[string]bool // Failed the request
+}
+
+// withRouteAttempts returns a context recording the backends its request is routed to,
+// replacing those of an enclosing request
+func withRouteAttempts(ctx context.Context) context.Context {
+	return context.WithValue(ctx, routeAttemptsCtxKey{}, &routeAttempts{
+		claimed: make(map[string]bool),
+		failed:  make(map[string]bool),
+	})
+}
+
+// routeAttemptsFromContext returns the backends the request was routed to, nil when they
+// are not recorded
+func routeAttemptsFromContext(ctx context.Context) *routeAttempts {
+	a, _ := ctx.Value(routeAttemptsCtxKey{}).(*routeAttempts)
+	return a
+}
+
+// hasFailed reports whether a backend failed the request
+func (a *routeAttempts) hasFailed(providerKey string) bool {
+	if a == nil {
+		return false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.failed[providerKey]
+}
+
+// fail records that a backend failed the request
+func (a *routeAttempts) fail(providerKey string) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.failed[providerKey] = true
+}
+
+// claim reports whether the request may be sent to a backend: when admit, its circuit
+// breaker, lets it through, which is asked only the first time
+func (a *routeAttempts) claim(providerKey string, admit func() bool) bool {
+	if a == nil {
+		return admit()
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.claimed[providerKey] {
+		return true
+	}
+	if !admit() {
+		return false
+	}
+	a.claimed[providerKey] = true
+	return true
+}
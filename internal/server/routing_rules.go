@@ -0,0 +1,118 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"encoding/json"
+	"slices"
+
+	"github.com/macedot/openmodel/internal/config"
+	applogger "github.com/macedot/openmodel/internal/logger"
+)
+
+// requestAttributes are the properties of a chat request that routing rules match on
+type requestAttributes struct {
+	messages    int
+	promptChars int
+	tools       bool
+	images      bool
+	user        string
+}
+
+// parseRequestAttributes extracts the routing attributes of a chat request body in
+// OpenAI or Anthropic format
+func parseRequestAttributes(body []byte) requestAttributes {
+	var req struct {
+		Tools     []json.RawMessage `json:"tools"`
+		Functions []json.RawMessage `json:"functions"`
+		System    json.RawMessage   `json:"system"`
+		User      string            `json:"user"`
+		Metadata  struct {
+			UserID string `json:"user_id"`
+		} `json:"metadata"`
+		Messages []struct {
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return requestAttributes{}
+	}
+
+	attrs := requestAttributes{
+		messages:    len(req.Messages),
+		promptChars: contentChars(req.System),
+		tools:       len(req.Tools) > 0 || len(req.Functions) > 0,
+		images:      hasImageContent(req.Messages),
+		user:        req.User,
+	}
+	if attrs.user == "" {
+		attrs.user = req.Metadata.UserID
+	}
+	for _, msg := range req.Messages {
+		attrs.promptChars += contentChars(msg.Content)
+	}
+	return attrs
+}
+
+// contentChars counts the characters of message content: a plain string or the text
+// of its text parts
+func contentChars(content json.RawMessage) int {
+	var text string
+	if json.Unmarshal(content, &text) == nil {
+		return len([]rune(text))
+	}
+	var parts []struct {
+		Text string `json:"text"`
+	}
+	if json.Unmarshal(content, &parts) != nil {
+		return 0
+	}
+	n := 0
+	for _, part := range parts {
+		n += len([]rune(part.Text))
+	}
+	return n
+}
+
+// ruleMatches reports whether a request satisfies every condition of a rule
+func ruleMatches(m config.RuleMatch, requested string, attrs requestAttributes, header func(string) string) bool {
+	switch {
+	case !m.MatchesModel(requested):
+		return false
+	case attrs.messages < m.MinMessages, m.MaxMessages > 0 && attrs.messages > m.MaxMessages:
+		return false
+	case attrs.promptChars < m.MinPromptChars, m.MaxPromptChars > 0 && attrs.promptChars > m.MaxPromptChars:
+		return false
+	case m.HasTools != nil && *m.HasTools != attrs.tools:
+		return false
+	case m.HasImages != nil && *m.HasImages != attrs.images:
+		return false
+	case len(m.Users) > 0 && !slices.Contains(m.Users, attrs.user):
+		return false
+	}
+	for name, want := range m.Headers {
+		got := header(name)
+		if got == "" || (want != "*" && got != want) {
+			return false
+		}
+	}
+	return true
+}
+
+// applyRoutingRules returns the model whose backend chain serves a chat request: the
+// target of the first rule the request matches, otherwise model, the one it resolved to.
+// Rules match on the model name the client requested.
+func (s *Server) applyRoutingRules(requested, model string, body []byte, header func(string) string) string {
+	rules := s.GetConfig().Rules
+	if len(rules) == 0 {
+		return model
+	}
+	attrs := parseRequestAttributes(body)
+	for i, rule := range rules {
+		if !ruleMatches(rule.Match, requested, attrs, header) {
+			continue
+		}
+		applogger.Debug("routing_rule_matched", "rule", rule.Name, "index", i, "requested", requested, "model", rule.Model)
+		return rule.Model
+	}
+	return model
+}
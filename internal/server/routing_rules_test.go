@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/endpoints"
+	"github.com/macedot/openmodel/internal/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRequestAttributes(t *testing.T) {
+	openAI := parseRequestAttributes([]byte(`{"model":"gpt-4","user":"u1","tools":[{"type":"function"}],"messages":[
+		{"role":"system","content":"be brief"},
+		{"role":"user","content":[{"type":"text","text":"what is this?"},{"type":"image_url","image_url":{"url":"https://x/y.png"}}]}
+	]}`))
+	assert.Equal(t, requestAttributes{messages: 2, promptChars: 21, tools: true, images: true, user: "u1"}, openAI)
+
+	anthropic := parseRequestAttributes([]byte(`{"model":"claude","system":"héllo","metadata":{"user_id":"u2"},"messages":[{"role":"user","content":"hi"}]}`))
+	assert.Equal(t, requestAttributes{messages: 1, promptChars: 7, user: "u2"}, anthropic)
+}
+
+func TestRuleMatches(t *testing.T) {
+	yes, no := true, false
+	attrs := requestAttributes{messages: 4, promptChars: 1200, tools: true, user: "alice"}
+	headers := map[string]string{"X-Tier": "free"}
+	header := func(name string) string { return headers[name] }
+
+	tests := []struct {
+		name  string
+		match config.RuleMatch
+		want  bool
+	}{
+		{name: "empty rule", want: true},
+		{name: "model pattern", match: config.RuleMatch{Models: []string{"gpt-*"}}, want: true},
+		{name: "other model", match: config.RuleMatch{Models: []string{"claude"}}, want: false},
+		{name: "message bounds", match: config.RuleMatch{MinMessages: 2, MaxMessages: 4}, want: true},
+		{name: "too few messages", match: config.RuleMatch{MinMessages: 5}, want: false},
+		{name: "long prompt", match: config.RuleMatch{MinPromptChars: 1000}, want: true},
+		{name: "prompt too long", match: config.RuleMatch{MaxPromptChars: 1000}, want: false},
+		{name: "has tools", match: config.RuleMatch{HasTools: &yes}, want: true},
+		{name: "no images", match: config.RuleMatch{HasImages: &no}, want: true},
+		{name: "needs images", match: config.RuleMatch{HasImages: &yes}, want: false},
+		{name: "user", match: config.RuleMatch{Users: []string{"bob", "alice"}}, want: true},
+		{name: "other user", match: config.RuleMatch{Users: []string{"bob"}}, want: false},
+		{name: "header value", match: config.RuleMatch{Headers: map[string]string{"X-Tier": "free"}}, want: true},
+		{name: "header any value", match: config.RuleMatch{Headers: map[string]string{"X-Tier": "*"}}, want: true},
+		{name: "missing header", match: config.RuleMatch{Headers: map[string]string{"X-Team": "*"}}, want: false},
+		{name: "all conditions must hold", match: config.RuleMatch{HasTools: &yes, Users: []string{"bob"}}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ruleMatches(tt.match, "gpt-4o", attrs, header))
+		})
+	}
+}
+
+func TestHandleV1ChatCompletions_RoutingRules(t *testing.T) {
+	respond := func(id string) func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+		return func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+			return []byte(`{"id":"` + id + `","object":"chat.completion","choices":[]}`), nil
+		}
+	}
+	yes := true
+	cfg := &config.Config{
+		Models: map[string]config.ModelConfig{
+			"gpt-4":  {Strategy: config.StrategyFallback, Providers: []config.ModelProvider{{Provider: "text", Model: "llama3"}}},
+			"vision": {Strategy: config.StrategyFallback, Providers: []config.ModelProvider{{Provider: "eyes", Model: "llava"}}},
+		},
+		Rules:      []config.RoutingRule{{Name: "images", Match: config.RuleMatch{HasImages: &yes}, Model: "vision"}},
+		Thresholds: config.ThresholdsConfig{FailuresBeforeSwitch: 1, InitialTimeout: 1000, MaxTimeout: 10000},
+	}
+	srv := &Server{config: cfg, state: state.New(), providers: providerMap{
+		"text": &stubProvider{name: "text", doRequestFn: respond("text")},
+		"eyes": &stubProvider{name: "eyes", doRequestFn: respond("eyes")},
+	}}
+
+	app := fiber.New()
+	app.Post(endpoints.V1ChatCompletions, srv.handleV1ChatCompletions)
+	send := func(body string) string {
+		req := httptest.NewRequest("POST", endpoints.V1ChatCompletions, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		require.NoError(t, err)
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	assert.Contains(t, send(`{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`), `"id":"text"`)
+	assert.Contains(t, send(`{"model":"gpt-4","messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"https://x/y.png"}}]}]}`), `"id":"eyes"`)
+}
@@ -0,0 +1,207 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/macedot/openmodel/internal/config"
+	applogger "github.com/macedot/openmodel/internal/logger"
+	"github.com/macedot/openmodel/internal/provider"
+)
+
+// cacheSemantic names the semantic cache in the cache metrics
+const cacheSemantic = "semantic"
+
+// semanticCache keeps the completions of chat requests with the embeddings of their
+// prompts, by partition: requests only match others of the same tenant, model and
+// parameters besides the messages
+type semanticCache struct {
+	mu      sync.Mutex
+	entries map[string][]semanticCacheEntry // Oldest first
+}
+
+// semanticCacheEntry is a cached completion
+type semanticCacheEntry struct {
+	embedding []float64
+	response  []byte
+	expires   time.Time
+}
+
+// semanticCacheKey is where the completion of a request that missed the cache is stored
+type semanticCacheKey struct {
+	partition string
+	embedding []float64
+}
+
+// lookup returns the unexpired completion of a partition whose prompt is the most similar
+// to embedding, if it is at least threshold similar, and its similarity
+func (c *semanticCache) lookup(partition string, embedding []float64, threshold float64, now time.Time) ([]byte, float64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var best []byte
+	bestSimilarity := threshold
+	for _, entry := range c.entries[partition] {
+		if now.After(entry.expires) {
+			continue
+		}
+		if similarity := cosineSimilarity(entry.embedding, embedding); similarity >= bestSimilarity {
+			best, bestSimilarity = entry.response, similarity
+		}
+	}
+	return best, bestSimilarity, best != nil
+}
+
+// store adds a completion to a partition, dropping the expired ones and the oldest beyond
+// maxEntries
+func (c *semanticCache) store(partition string, entry semanticCacheEntry, maxEntries int, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string][]semanticCacheEntry)
+	}
+	kept := c.entries[partition][:0]
+	for _, e := range c.entries[partition] {
+		if !now.After(e.expires) {
+			kept = append(kept, e)
+		}
+	}
+	kept = append(kept, entry)
+	if len(kept) > maxEntries {
+		kept = kept[len(kept)-maxEntries:]
+	}
+	c.entries[partition] = kept
+}
+
+// cosineSimilarity returns the cosine similarity of two vectors, 0 when their lengths
+// differ or one of them is zero
+func cosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+// lookupSemanticCache returns the cached completion of a non-streaming chat request to a
+// configured model that uses the semantic cache. On a miss it returns the key to store
+// the completion under, nil when the request is not cached: the model does not use the
+// cache, or its prompt could not be embedded.
+func (s *Server) lookupSemanticCache(ctx context.Context, model string, body []byte, headers map[string]string) ([]byte, *semanticCacheKey) {
+	cfg := s.GetConfig()
+	threshold, ok := cfg.SemanticCacheThreshold(model)
+	if !ok {
+		return nil, nil
+	}
+	var req map[string]any
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, nil
+	}
+	text := conversationText(req)
+	if text == "" {
+		return nil, nil
+	}
+	embedding, err := s.embedText(ctx, cfg.SemanticCache.EmbeddingModel, text, headers)
+	if err != nil {
+		applogger.Warn("semantic_cache_embed_failed", "request_id", provider.RequestIDFromContext(ctx), "model", cfg.SemanticCache.EmbeddingModel, "error", err.Error())
+		return nil, nil
+	}
+
+	tenant, _ := tenantFromContext(ctx)
+	key := &semanticCacheKey{partition: semanticCachePartition(tenant.Name, model, req), embedding: embedding}
+	resp, similarity, hit := s.semanticCache.lookup(key.partition, embedding, threshold, time.Now())
+	s.metrics.observeCacheLookup(cacheSemantic, model, hit)
+	if !hit {
+		return nil, key
+	}
+	applogger.Debug("semantic_cache_hit", "request_id", provider.RequestIDFromContext(ctx), "model", model, "similarity", similarity)
+	return resp, nil
+}
+
+// storeSemanticCache caches the completion of a request that missed the semantic cache
+func (s *Server) storeSemanticCache(key *semanticCacheKey, response []byte) {
+	if key == nil {
+		return
+	}
+	sc := s.GetConfig().SemanticCache
+	now := time.Now()
+	s.semanticCache.store(key.partition, semanticCacheEntry{embedding: key.embedding, response: response, expires: now.Add(sc.GetTTL())}, sc.GetMaxEntries(), now)
+}
+
+// embedText returns the embedding of a text by a configured embedding model, from the
+// embedding cache when it has it
+func (s *Server) embedText(ctx context.Context, model, text string, headers map[string]string) ([]float64, error) {
+	body, _ := json.Marshal(map[string]string{"model": model, "input": text})
+	batch, _ := s.newEmbeddingBatch(model, body)
+	if len(batch.pending) > 0 {
+		ctx = withRequiredCapabilities(ctx, []string{config.CapabilityEmbeddings})
+		resp, providerKey, err := s.executeWithFailoverFiber(ctx, model, body, headers, EndpointV1Embeddings)
+		if err != nil {
+			return nil, err
+		}
+		s.recordSuccess(providerKey)
+		if _, err := batch.complete(resp.([]byte), model); err != nil {
+			return nil, fmt.Errorf("invalid embeddings response: %w", err)
+		}
+		s.storeEmbeddings(batch)
+	}
+	var embedding []float64
+	if err := json.Unmarshal(batch.embedded[batch.keys[0]], &embedding); err != nil || len(embedding) == 0 {
+		return nil, fmt.Errorf("invalid embeddings response")
+	}
+	return embedding, nil
+}
+
+// conversationText renders the messages of a chat request as "role: text" lines, so
+// prompts only match when the same roles said the same things
+func conversationText(req map[string]any) string {
+	var lines []string
+	messages, _ := req["messages"].([]any)
+	for _, msg := range messages {
+		m, ok := msg.(map[string]any)
+		if !ok {
+			continue
+		}
+		role, _ := m["role"].(string)
+		var parts []string
+		rewriteText(m, "content", func(s string) string {
+			parts = append(parts, s)
+			return s
+		})
+		lines = append(lines, role+": "+strings.Join(parts, "\n"))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// semanticCachePartition identifies the requests whose completions may answer each
+// other: those of the same tenant to the same model with the same parameters, such as
+// temperature or tools, whatever their messages or streaming options
+func semanticCachePartition(tenant, model string, req map[string]any) string {
+	params := make(map[string]any, len(req))
+	for k, v := range req {
+		switch k {
+		case "messages", "stream", "stream_options", "user":
+		default:
+			params[k] = v
+		}
+	}
+	// Maps marshal with sorted keys, so equal parameters hash the same
+	encoded, _ := json.Marshal(params)
+	sum := sha256.Sum256(encoded)
+	return tenant + "\x00" + model + "\x00" + hex.EncodeToString(sum[:])
+}
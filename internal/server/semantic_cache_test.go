@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSemanticCache(t *testing.T) {
+	var cache semanticCache
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	cache.store("p", semanticCacheEntry{embedding: []float64{1, 0}, response: []byte("a"), expires: now.Add(time.Minute)}, 2, now)
+	cache.store("p", semanticCacheEntry{embedding: []float64{0.6, 0.8}, response: []byte("b"), expires: now.Add(time.Hour)}, 2, now)
+
+	// The most similar prompt above the threshold wins
+	resp, similarity, ok := cache.lookup("p", []float64{0.7, 0.7}, 0.9, now)
+	require.True(t, ok)
+	assert.Equal(t, "b", string(resp))
+	assert.InDelta(t, 0.99, similarity, 0.01)
+	resp, _, ok = cache.lookup("p", []float64{1, 0.1}, 0.9, now)
+	require.True(t, ok)
+	assert.Equal(t, "a", string(resp))
+	_, _, ok = cache.lookup("p", []float64{0, 1}, 0.9, now)
+	assert.False(t, ok)
+
+	// Partitions never match each other
+	_, _, ok = cache.lookup("q", []float64{1, 0}, 0.9, now)
+	assert.False(t, ok)
+
+	// Expired entries are skipped, and dropped on the next store
+	later := now.Add(2 * time.Minute)
+	_, _, ok = cache.lookup("p", []float64{1, 0}, 0.9, later)
+	assert.False(t, ok)
+	cache.store("p", semanticCacheEntry{embedding: []float64{0, 1}, response: []byte("c"), expires: later.Add(time.Hour)}, 2, later)
+	assert.Len(t, cache.entries["p"], 2)
+
+	// The oldest entries are evicted beyond the limit
+	cache.store("p", semanticCacheEntry{embedding: []float64{-1, 0}, response: []byte("d"), expires: later.Add(time.Hour)}, 2, later)
+	require.Len(t, cache.entries["p"], 2)
+	assert.Equal(t, "c", string(cache.entries["p"][0].response))
+	assert.Equal(t, "d", string(cache.entries["p"][1].response))
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float64
+		want float64
+	}{
+		{"same", []float64{1, 2, 3}, []float64{1, 2, 3}, 1},
+		{"scaled", []float64{1, 2}, []float64{2, 4}, 1},
+		{"orthogonal", []float64{1, 0}, []float64{0, 1}, 0},
+		{"opposite", []float64{1, 0}, []float64{-1, 0}, -1},
+		{"lengths differ", []float64{1, 0}, []float64{1, 0, 0}, 0},
+		{"zero", []float64{0, 0}, []float64{1, 0}, 0},
+		{"empty", nil, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.want, cosineSimilarity(tt.a, tt.b), 1e-9)
+		})
+	}
+}
+
+func TestSemanticCache_ChatCompletions(t *testing.T) {
+	var completions, embeddings int
+	prov := &stubProvider{
+		name: "ollama",
+		doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+			if endpoint == EndpointV1Embeddings {
+				embeddings++
+				// Greetings embed close to each other, anything else apart
+				if strings.Contains(string(body), "hello") || strings.Contains(string(body), "hi there") {
+					return []byte(`{"data":[{"embedding":[1,0.05]}]}`), nil
+				}
+				return []byte(`{"data":[{"embedding":[0,1]}]}`), nil
+			}
+			completions++
+			return []byte(`{"id":"c1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}]}`), nil
+		},
+	}
+	srv := newStreamingTestServer(prov)
+	srv.config.Models["gpt-4"] = config.ModelConfig{
+		Strategy:      "fallback",
+		Providers:     []config.ModelProvider{{Provider: prov.name, Model: "gpt-4"}},
+		SemanticCache: &config.ModelSemanticCache{Enabled: true},
+	}
+	srv.config.Models["claude"] = config.ModelConfig{Strategy: "fallback", Providers: []config.ModelProvider{{Provider: prov.name, Model: "claude"}}}
+	srv.config.Models["embed"] = config.ModelConfig{Strategy: "fallback", Providers: []config.ModelProvider{{Provider: prov.name, Model: "embed"}}}
+	srv.config.SemanticCache = &config.SemanticCacheConfig{EmbeddingModel: "embed"}
+	app := fiber.New()
+	srv.registerRoutes(app)
+
+	do := func(model, prompt, params string) (string, string) {
+		body := `{"model":"` + model + `",` + params + `"messages":[{"role":"user","content":"` + prompt + `"}]}`
+		req := httptest.NewRequest("POST", EndpointV1ChatCompletions, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+		data, _ := io.ReadAll(resp.Body)
+		return resp.Header.Get(HeaderXOpenModelCache), string(data)
+	}
+
+	result, first := do("gpt-4", "hello", "")
+	assert.Equal(t, "miss", result)
+	result, second := do("gpt-4", "hi there", "")
+	assert.Equal(t, "hit", result)
+	assert.JSONEq(t, first, second)
+	assert.Equal(t, 1, completions)
+
+	// Dissimilar prompts and other parameters miss
+	result, _ = do("gpt-4", "what is the weather", "")
+	assert.Equal(t, "miss", result)
+	result, _ = do("gpt-4", "hello", `"temperature":0.2,`)
+	assert.Equal(t, "miss", result)
+	assert.Equal(t, 3, completions)
+
+	// Models without the cache embed nothing
+	embeddings = 0
+	result, _ = do("claude", "hello", "")
+	assert.Empty(t, result)
+	assert.Zero(t, embeddings)
+	assert.Equal(t, 4, completions)
+}
@@ -3,17 +3,26 @@ package server
 
 import (
 	"context"
-	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/macedot/openmodel/internal/audit"
+	"github.com/macedot/openmodel/internal/bodylog"
 	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/eventsink"
+	"github.com/macedot/openmodel/internal/jwtauth"
+	"github.com/macedot/openmodel/internal/keys"
+	"github.com/macedot/openmodel/internal/llmexport"
 	applogger "github.com/macedot/openmodel/internal/logger"
 	"github.com/macedot/openmodel/internal/provider"
 	_ "github.com/macedot/openmodel/internal/server/converters"
 	"github.com/macedot/openmodel/internal/state"
+	"github.com/macedot/openmodel/internal/statsd"
+	"github.com/macedot/openmodel/internal/tracing"
+	"github.com/macedot/openmodel/internal/usage"
 	"github.com/sixafter/nanoid"
 )
 
@@ -25,8 +34,66 @@ type Server struct {
 	app       *fiber.App
 	// providersMu protects runtime state swapped during hot reload.
 	providersMu sync.RWMutex
-	limiter     *RateLimiter
-	version     string
+	// reloadMu serializes reloads, so each diff is against the config it replaces
+	reloadMu sync.Mutex
+	// overrides are command-line settings applied to each reloaded config
+	overrides config.Overrides
+	limiter   *RateLimiter
+	version   string
+	// healthDown tracks backends taken out of rotation by background health checks
+	healthMu   sync.Mutex
+	healthDown map[string]bool
+	// spend tracks provider cost against configured budgets
+	spend spendTracker
+	// costSpend tracks the cost of all requests, each backend and each API key for cost alerts
+	costSpend spendTracker
+	// notifier tracks the backends and models reported down to notification webhooks
+	notifier notifier
+	// admissionQueues hold each model's concurrency slots and waiting requests
+	admissionMu     sync.Mutex
+	admissionQueues map[string]*admissionQueue
+	// globalRate and globalQueue hold the model APIs to the global_limits rate and concurrency
+	globalRate  rateGate
+	globalQueue admissionQueue
+	// providerLoad counts requests in flight per provider for max_concurrency
+	providerLoadMu sync.Mutex
+	providerLoad   map[string]int
+	// drain tracks requests in flight and turns new ones away while draining
+	drain drainer
+	// discovery adds the models of discover entries to the configuration
+	discovery modelDiscovery
+	// chaos injects the failures of backends with a chaos config
+	chaos chaosInjectors
+	// metrics are served at /metrics when enabled
+	metrics *serverMetrics
+	// tracer records the spans of requests, nil unless tracing is enabled
+	tracer *tracing.Tracer
+	// statsd receives the metrics, nil unless StatsD is enabled
+	statsd *statsd.Client
+	// usage records token usage, nil unless usage accounting is enabled
+	usage *usage.Store
+	// bodyLog writes request and response bodies, nil unless body logging is enabled
+	bodyLog *bodylog.Logger
+	// llmExport ships generations to Langfuse or LangSmith, nil unless enabled
+	llmExport *llmexport.Exporter
+	// eventSink publishes a usage event per request to Kafka, NATS or a webhook, nil unless enabled
+	eventSink *eventsink.Sink
+	// audit records administrative actions and failed authentications, nil unless enabled
+	audit *audit.Logger
+	// keys holds the API keys issued at runtime, nil unless the key store is enabled
+	keys *keys.Store
+	// jwt verifies the JWTs clients present as API keys, nil unless JWTs are accepted
+	jwt *jwtauth.Verifier
+	// guardrailPatterns caches the compiled deny patterns of the guardrails
+	guardrailPatterns guardrailPatterns
+	// keyLimits enforces the requests and tokens per minute of API keys
+	keyLimits keyLimiter
+	// quotas adds up the monthly tokens and cost of API keys with a quota
+	quotas quotaTracker
+	// semanticCache keeps the chat completions of the models using the semantic cache
+	semanticCache semanticCache
+	// embeddingCache keeps the embeddings of inputs when the embedding cache is enabled
+	embeddingCache embeddingCache
 }
 
 // New creates a new server with the given configuration, providers, and state
@@ -36,25 +103,43 @@ func New(cfg *config.Config, providers map[string]provider.Provider, stateMgr *s
 		providers: asProviderMap(providers),
 		state:     stateMgr,
 		version:   version,
+		discovery: modelDiscovery{base: cfg, wake: make(chan struct{}, 1)},
 	}
 
 	// Initialize rate limiter if enabled
-	if cfg.RateLimit != nil && cfg.RateLimit.Enabled {
-		cleanupInterval := 60 * time.Second
-		if cfg.RateLimit.CleanupIntervalMs > 0 {
-			cleanupInterval = time.Duration(cfg.RateLimit.CleanupIntervalMs) * time.Millisecond
-		}
-		srv.limiter = NewRateLimiterWithTrustedProxies(
-			cfg.RateLimit.RequestsPerSecond,
-			cfg.RateLimit.Burst,
-			cleanupInterval,
-			cfg.RateLimit.TrustedProxies,
-		)
-	}
+	srv.limiter = newRateLimiterFromConfig(cfg, stateMgr.Store())
+	srv.metrics = newServerMetrics(srv)
+	srv.tracer = newTracer(cfg)
+	srv.statsd = newStatsD(cfg, srv.metrics)
+	srv.llmExport = newLLMExporter(cfg)
+	srv.eventSink = newEventSink(cfg)
+	srv.jwt = newJWTVerifier(cfg)
 
 	return srv
 }
 
+// newRateLimiterFromConfig creates the rate limiter, or nil when rate limiting is disabled.
+// With a shared state store the limit applies across all instances.
+func newRateLimiterFromConfig(cfg *config.Config, store state.Store) *RateLimiter {
+	if cfg.RateLimit == nil || !cfg.RateLimit.Enabled {
+		return nil
+	}
+	cleanupInterval := 60 * time.Second
+	if cfg.RateLimit.CleanupIntervalMs > 0 {
+		cleanupInterval = time.Duration(cfg.RateLimit.CleanupIntervalMs) * time.Millisecond
+	}
+	limiter := NewRateLimiterWithTrustedProxies(
+		cfg.RateLimit.RequestsPerSecond,
+		cfg.RateLimit.Burst,
+		cleanupInterval,
+		cfg.RateLimit.TrustedProxies,
+	)
+	if store != nil {
+		limiter.SetSharedStore(store)
+	}
+	return limiter
+}
+
 // generateRequestID generates a short random request ID (alphanumeric only)
 func generateRequestID() string {
 	generator, err := nanoid.NewGenerator(
@@ -71,15 +156,26 @@ func generateRequestID() string {
 	return string(id)
 }
 
-// Start starts the Fiber server
+// Start starts the Fiber server on each of the configured listeners
 func (s *Server) Start() error {
+	cfg := s.GetConfig()
+	listenerConfigs := cfg.Server.GetListeners()
+	listeners, err := openListeners(listenerConfigs)
+	if err != nil {
+		return err
+	}
+
 	s.app = fiber.New(fiber.Config{
-		ReadTimeout:   DefaultReadTimeout,
-		WriteTimeout:  DefaultWriteTimeout,
-		IdleTimeout:   DefaultIdleTimeout,
-		StrictRouting: true,
-		CaseSensitive: true,
-		BodyLimit:     DefaultMaxRequestBody,
+		// Fiber's banner shows a single address; server_starting logs them all
+		DisableStartupMessage: len(listeners) > 1,
+		ReadTimeout:           cfg.Server.GetReadTimeout(),
+		WriteTimeout:          cfg.Server.GetWriteTimeout(),
+		IdleTimeout:           cfg.Server.GetIdleTimeout(),
+		// The read buffer holds the request line and headers, so it bounds their size
+		ReadBufferSize: cfg.Server.GetMaxHeaderBytes(),
+		StrictRouting:  true,
+		CaseSensitive:  true,
+		BodyLimit:      DefaultMaxRequestBody,
 	})
 
 	// Recovery middleware
@@ -109,6 +205,12 @@ func (s *Server) Start() error {
 		// Process request
 		err := c.Next()
 
+		// Reading a streamed body would hold the whole stream back until it ends
+		resSize := -1
+		if !c.Response().IsBodyStream() {
+			resSize = len(c.Response().Body())
+		}
+
 		// Log request completed
 		applogger.Info("RESPONSE",
 			"request_id", requestID,
@@ -118,12 +220,58 @@ func (s *Server) Start() error {
 			"status", c.Response().StatusCode(),
 			"latency", time.Since(start).String(),
 			"req_size", len(c.Body()),
-			"res_size", len(c.Response().Body()),
+			"res_size", resSize,
 		)
 
 		return err
 	})
 
+	// Metrics middleware - counts requests by endpoint and status
+	s.app.Use(s.metricsMiddleware())
+
+	// Tracing middleware - traces requests, continuing the trace of the caller
+	s.app.Use(s.tracingMiddleware())
+
+	// Listener middleware - keeps each listener to the endpoints it serves
+	s.app.Use(listenerMiddleware())
+
+	// Endpoint groups middleware - hides the endpoint groups the config disables
+	s.app.Use(s.endpointGroupsMiddleware())
+
+	// WebSocket credentials middleware - takes the API key of browser WebSocket clients
+	// from the subprotocol or query string
+	s.app.Use(websocketCredentialsMiddleware())
+
+	// API keys middleware - requires clients of the model APIs to present an API key
+	s.app.Use(s.apiKeysMiddleware())
+
+	// Tenants middleware - assigns requests to their tenant and holds tenants to their quotas
+	s.app.Use(s.tenantsMiddleware())
+
+	// Drain middleware - counts requests in flight, rejects new ones while draining
+	s.app.Use(s.drainMiddleware())
+
+	// Global limits middleware - caps the server-wide request rate and concurrency
+	s.app.Use(s.globalLimitsMiddleware())
+
+	// Backend headers middleware - tells clients which backend served their request
+	s.app.Use(s.backendHeadersMiddleware())
+
+	// Body log middleware - writes request and response bodies for debugging
+	if s.bodyLog != nil {
+		s.app.Use(s.bodyLogMiddleware())
+	}
+
+	// LLM export middleware - ships prompts and completions to Langfuse or LangSmith
+	if s.llmExport != nil {
+		s.app.Use(s.llmExportMiddleware())
+	}
+
+	// Usage event middleware - publishes a usage event per request to Kafka, NATS or a webhook
+	if s.eventSink != nil {
+		s.app.Use(s.usageEventMiddleware())
+	}
+
 	// Rate limiting middleware
 	if s.getLimiter() != nil {
 		s.app.Use(s.rateLimitMiddleware())
@@ -132,19 +280,47 @@ func (s *Server) Start() error {
 	// Register routes
 	s.registerRoutes(s.app)
 
-	cfg := s.GetConfig()
-	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
-	applogger.Info("server_starting", "addr", addr, "version", s.version)
-	return s.app.Listen(addr)
+	addrs := make([]string, len(listenerConfigs))
+	for i, lc := range listenerConfigs {
+		addrs[i] = lc.Address
+	}
+	applogger.Info("server_starting", "addr", strings.Join(addrs, ", "), "version", s.version)
+	if len(listeners) == 1 {
+		return s.app.Listener(listeners[0])
+	}
+	return s.app.Listener(newMultiListener(listeners))
 }
 
-// Stop gracefully shuts down the server
+// Stop gracefully shuts down the server. It drains first: new requests get 503 while
+// requests in flight, streams included, may finish until the drain timeout.
 func (s *Server) Stop(ctx context.Context) error {
 	if s.app == nil {
 		return nil
 	}
+	deadline, idle := s.drain.start(s.GetConfig().Server.GetDrainTimeout(), true)
+	applogger.Info("server_draining", "in_flight", s.drain.status().InFlight, "deadline", deadline)
+	// Requests still in flight at the deadline are cancelled and get a moment to end
+	select {
+	case <-idle:
+	case <-ctx.Done():
+	case <-time.After(time.Until(deadline) + DefaultShutdownTimeout):
+	}
 	applogger.Info("server_shutting_down")
-	return s.app.Shutdown()
+	err := s.app.ShutdownWithTimeout(DefaultShutdownTimeout)
+	// Spans of the last requests are exported before exiting
+	flushCtx, cancel := context.WithTimeout(context.Background(), DefaultShutdownTimeout)
+	defer cancel()
+	if flushErr := s.tracer.Shutdown(flushCtx); flushErr != nil {
+		applogger.Warn("trace_flush_failed", "error", flushErr)
+	}
+	if flushErr := s.llmExport.Shutdown(flushCtx); flushErr != nil {
+		applogger.Warn("llm_export_flush_failed", "error", flushErr)
+	}
+	if flushErr := s.eventSink.Shutdown(flushCtx); flushErr != nil {
+		applogger.Warn("event_sink_flush_failed", "error", flushErr)
+	}
+	s.statsd.Close()
+	return err
 }
 
 // rateLimitMiddleware rate limits requests by IP
@@ -179,12 +355,59 @@ func (s *Server) registerRoutes(app *fiber.App) {
 	// Health endpoints
 	app.Get(EndpointRoot, s.handleRoot)
 	app.Get(EndpointHealth, s.handleHealth)
+	app.Get(EndpointHealthz, s.handleHealthz)
+	app.Get(EndpointReadyz, s.handleReadyz)
+
+	// API documentation
+	app.Get(EndpointOpenAPI, s.handleOpenAPI)
+	app.Get(EndpointDocs, s.handleDocs)
+
+	// Prometheus metrics (disabled unless configured)
+	app.Get(EndpointMetrics, s.handleMetrics)
 
 	// OpenAI endpoints
 	app.Post(EndpointV1ChatCompletions, s.handleV1ChatCompletions)
+	app.Post(EndpointV1Completions, s.handleV1Completions)
+	app.Get(EndpointV1Models, s.handleV1Models)
+	app.Get(EndpointV1Model, s.handleV1Model)
+	app.Post(EndpointV1Embeddings, s.handleV1Embeddings)
+	app.Post(EndpointV1Moderations, s.handleV1Moderations)
+	app.Post(EndpointV1AudioTranscript, s.handleV1AudioTranscriptions)
+	app.Post(EndpointV1AudioSpeech, s.handleV1AudioSpeech)
+
+	// WebSocket streaming endpoint
+	app.Get(EndpointWSV1Chat, s.handleWSChat)
 
 	// Anthropic endpoints
 	app.Post(EndpointV1Messages, s.handleV1Messages)
+
+	// Ollama model management endpoints (disabled unless configured)
+	app.Post(EndpointAPICreate, s.handleAPICreate)
+	app.Post(EndpointAPICopy, s.handleAPICopy)
+	app.Delete(EndpointAPIDelete, s.handleAPIDelete)
+
+	// Admin endpoints (disabled unless configured)
+	app.Get(EndpointAdminWeights, s.handleAdminGetWeights)
+	app.Put(EndpointAdminWeights, s.handleAdminSetWeights)
+	app.Delete(EndpointAdminWeights, s.handleAdminResetWeights)
+	app.Get(EndpointAdminSpend, s.handleAdminSpend)
+	app.Get(EndpointAdminUsage, s.handleAdminUsage)
+	app.Get(EndpointAdminKeys, s.handleAdminListKeys)
+	app.Post(EndpointAdminKeys, s.handleAdminCreateKey)
+	app.Delete(EndpointAdminKey, s.handleAdminRevokeKey)
+	app.Post(EndpointAdminKeyRotate, s.handleAdminRotateKey)
+	app.Get(EndpointAdminQuotas, s.handleAdminQuotas)
+	app.Get(EndpointAdminDrain, s.handleAdminDrain)
+	app.Post(EndpointAdminDrain, s.handleAdminStartDrain)
+	app.Delete(EndpointAdminDrain, s.handleAdminResumeDrain)
+	app.Post(EndpointAdminReload, s.handleAdminReload)
+	app.Get(EndpointAdminConfig, s.handleAdminConfig)
+	app.Get(EndpointAdminBackends, s.handleAdminBackends)
+	app.Post(EndpointAdminBackendAction, s.handleAdminBackendAction)
+	app.Get(EndpointAdminState, s.handleAdminState)
+	app.Get(EndpointAdminPprof, s.handleAdminPprof)
+	app.Post(EndpointAdminPprof, s.handleAdminPprof)
+	app.Get(EndpointAdminRuntime, s.handleAdminRuntime)
 }
 
 // handleRoot handles GET /
@@ -203,6 +426,14 @@ func (s *Server) GetConfig() *config.Config {
 	return s.config
 }
 
+// SetOverrides keeps command-line settings over those of configs loaded on reload. They
+// are expected to be applied to the config the server starts with already.
+func (s *Server) SetOverrides(overrides config.Overrides) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	s.overrides = overrides
+}
+
 // GetProviders returns a copy of the current server-facing providers map.
 func (s *Server) GetProviders() providerMap {
 	s.providersMu.RLock()
@@ -212,50 +443,60 @@ func (s *Server) GetProviders() providerMap {
 
 // ReloadConfig atomically reloads the configuration and providers
 // Returns an error if the new config is invalid (config remains unchanged)
+// Circuit-breaker state is kept: it lives in the state manager, which reads the
+// thresholds of the current config on each request.
 func (s *Server) ReloadConfig(cfg *config.Config) error {
-	// Convert config.HTTP to provider.HTTPConfig
-	httpConfig := provider.HTTPConfig{
-		TimeoutSeconds:               cfg.HTTP.TimeoutSeconds,
-		MaxIdleConns:                 cfg.HTTP.MaxIdleConns,
-		MaxIdleConnsPerHost:          cfg.HTTP.MaxIdleConnsPerHost,
-		IdleConnTimeoutSeconds:       cfg.HTTP.IdleConnTimeoutSeconds,
-		DialTimeoutSeconds:           cfg.HTTP.DialTimeoutSeconds,
-		TLSHandshakeTimeoutSeconds:   cfg.HTTP.TLSHandshakeTimeoutSeconds,
-		ResponseHeaderTimeoutSeconds: cfg.HTTP.ResponseHeaderTimeoutSeconds,
-	}
+	_, err := s.swapConfig(cfg)
+	return err
+}
+
+// swapConfig reloads the configuration and providers, returning what changed
+func (s *Server) swapConfig(cfg *config.Config) (ConfigDiff, error) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	s.overrides.Apply(cfg)
 
 	// Create new providers from the config
 	newProviders := make(providerMap)
 	for name, pc := range cfg.Providers {
-		newProviders[name] = provider.NewOpenAIProviderWithConfig(name, pc.URL, pc.APIKey, pc.ApiMode, httpConfig)
-	}
-
-	var newLimiter *RateLimiter
-	if cfg.RateLimit != nil && cfg.RateLimit.Enabled {
-		cleanupInterval := 60 * time.Second
-		if cfg.RateLimit.CleanupIntervalMs > 0 {
-			cleanupInterval = time.Duration(cfg.RateLimit.CleanupIntervalMs) * time.Millisecond
+		p, err := NewProvider(cfg, name, pc)
+		if err != nil {
+			for _, created := range newProviders {
+				created.Close()
+			}
+			return ConfigDiff{}, err
 		}
-		newLimiter = NewRateLimiterWithTrustedProxies(
-			cfg.RateLimit.RequestsPerSecond,
-			cfg.RateLimit.Burst,
-			cleanupInterval,
-			cfg.RateLimit.TrustedProxies,
-		)
+		newProviders[name] = p
 	}
 
+	newLimiter := newRateLimiterFromConfig(cfg, s.state.Store())
+
+	diff := diffConfig(s.loadedConfig(), cfg)
+
+	applogger.SetSecrets("config", cfg.Secrets()...)
+
 	s.providersMu.Lock()
 	oldProviders := s.providers
-	s.config = cfg
+	s.config = s.withDiscovered(cfg)
 	s.providers = newProviders
 	s.limiter = newLimiter
 	s.providersMu.Unlock()
 
-	// Close old providers to release resources after the swap.
-	for _, p := range oldProviders {
-		if err := p.Close(); err != nil {
-			applogger.Warn("provider_close_failed", "provider", p.Name(), "error", err)
-		}
+	// Rediscover at once for new or changed discover entries
+	select {
+	case s.discovery.wake <- struct{}{}:
+	default:
+	}
+
+	// Close old providers to release resources after the swap. Requests in flight keep
+	// the providers they started with, so those are closed once the requests are done.
+	if settled := s.drain.settled(); settled != nil {
+		go func() {
+			<-settled
+			closeProviders(oldProviders)
+		}()
+	} else {
+		closeProviders(oldProviders)
 	}
 
 	// Write trace file if trace level is enabled
@@ -269,9 +510,19 @@ func (s *Server) ReloadConfig(cfg *config.Config) error {
 	applogger.Info("config_reloaded",
 		"config_path", cfg.GetConfigPath(),
 		"providers", len(newProviders),
-		"models", len(cfg.Models))
+		"models", len(cfg.Models),
+		"changes", diff.String())
+
+	return diff, nil
+}
 
-	return nil
+// closeProviders closes providers that are no longer served
+func closeProviders(providers providerMap) {
+	for _, p := range providers {
+		if err := p.Close(); err != nil {
+			applogger.Warn("provider_close_failed", "provider", p.Name(), "error", err)
+		}
+	}
 }
 
 // handleHealth handles GET /health
@@ -3,6 +3,12 @@ package server
 
 import (
 	"context"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -11,6 +17,7 @@ import (
 	"github.com/macedot/openmodel/internal/provider"
 	"github.com/macedot/openmodel/internal/state"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestNewServer tests server creation
@@ -22,7 +29,7 @@ func TestNewServer(t *testing.T) {
 		},
 	}
 	providers := map[string]provider.Provider{}
-	stateMgr := state.New(10000) // 10 second initial timeout
+	stateMgr := state.New()
 
 	srv := New(cfg, providers, stateMgr, "test-version")
 
@@ -48,7 +55,7 @@ func TestNewServer_WithRateLimit(t *testing.T) {
 		},
 	}
 	providers := map[string]provider.Provider{}
-	stateMgr := state.New(10000)
+	stateMgr := state.New()
 
 	srv := New(cfg, providers, stateMgr, "test-version")
 
@@ -72,7 +79,7 @@ func TestNewServer_WithTrustedProxies(t *testing.T) {
 		},
 	}
 	providers := map[string]provider.Provider{}
-	stateMgr := state.New(10000)
+	stateMgr := state.New()
 
 	srv := New(cfg, providers, stateMgr, "test-version")
 
@@ -90,7 +97,7 @@ func TestNewServer_WithoutRateLimit(t *testing.T) {
 		},
 	}
 	providers := map[string]provider.Provider{}
-	stateMgr := state.New(10000)
+	stateMgr := state.New()
 
 	srv := New(cfg, providers, stateMgr, "test-version")
 
@@ -156,7 +163,7 @@ func TestRateLimiterTokenRefill(t *testing.T) {
 }
 
 type closableProvider struct {
-	closed bool
+	closed atomic.Bool
 }
 
 func (p *closableProvider) Name() string    { return "old" }
@@ -193,7 +200,7 @@ func (p *closableProvider) Moderate(ctx context.Context, input string) (*openai.
 	return nil, nil
 }
 func (p *closableProvider) Close() error {
-	p.closed = true
+	p.closed.Store(true)
 	return nil
 }
 
@@ -208,7 +215,7 @@ func TestReloadConfig_ReplacesProvidersAndClosesOldOnes(t *testing.T) {
 			HTTP:   config.DefaultConfig().HTTP,
 		},
 		providers: providerMap{"old": oldProvider},
-		state:     state.New(1000),
+		state:     state.New(),
 	}
 
 	newCfg := &config.Config{
@@ -221,8 +228,108 @@ func TestReloadConfig_ReplacesProvidersAndClosesOldOnes(t *testing.T) {
 
 	err := srv.ReloadConfig(newCfg)
 	assert.NoError(t, err)
-	assert.True(t, oldProvider.closed)
+	assert.True(t, oldProvider.closed.Load())
 	assert.Equal(t, newCfg, srv.GetConfig())
 	assert.Contains(t, srv.GetProviders(), "new")
 	assert.NotContains(t, srv.GetProviders(), "old")
 }
+
+func TestReloadConfig_KeepsProvidersOfRequestsInFlight(t *testing.T) {
+	oldProvider := &closableProvider{}
+	srv := &Server{
+		config: &config.Config{
+			Providers: map[string]config.ProviderConfig{"old": {URL: "http://old", ApiMode: "openai"}},
+			Models:    map[string]config.ModelConfig{},
+			HTTP:      config.DefaultConfig().HTTP,
+		},
+		providers: providerMap{"old": oldProvider},
+		state:     state.New(),
+	}
+	srv.state.RecordFailure("old/gpt-4", state.Policy{Threshold: 1, Cooldown: time.Minute, MaxCooldown: time.Minute})
+
+	_, inFlight, ok := srv.drain.begin(context.Background())
+	require.True(t, ok)
+
+	newCfg := &config.Config{
+		Providers: map[string]config.ProviderConfig{"new": {URL: "http://new", ApiMode: "openai"}},
+		Models:    map[string]config.ModelConfig{},
+		HTTP:      config.DefaultConfig().HTTP,
+	}
+	require.NoError(t, srv.ReloadConfig(newCfg))
+	assert.Contains(t, srv.GetProviders(), "new")
+	assert.False(t, oldProvider.closed.Load(), "a request in flight may still use the old provider")
+	assert.False(t, srv.state.IsAvailable("old/gpt-4", 1), "circuit-breaker state survives the reload")
+
+	inFlight.done()
+	assert.Eventually(t, func() bool { return oldProvider.closed.Load() }, time.Second, 5*time.Millisecond)
+}
+
+func TestStart_StreamWriteTimeout(t *testing.T) {
+	tokenChunk := `data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4","choices":[{"index":0,"delta":{"content":"hi"},"finish_reason":null}]}`
+	tests := []struct {
+		name                 string
+		streamWriteTimeoutMs int
+		wantComplete         bool
+	}{
+		{name: "write timeout cuts the stream off"},
+		{name: "disabled stream write timeout", streamWriteTimeoutMs: -1, wantComplete: true},
+		{name: "longer stream write timeout", streamWriteTimeoutMs: 10000, wantComplete: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prov := &stubProvider{
+				name: "local",
+				doStreamReqFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+					ch := make(chan []byte)
+					go func() {
+						defer close(ch)
+						for range 4 {
+							ch <- []byte(tokenChunk)
+							time.Sleep(100 * time.Millisecond)
+						}
+						ch <- []byte(SSEDataDone)
+					}()
+					return ch, nil
+				},
+			}
+			socket := filepath.Join(t.TempDir(), "openmodel.sock")
+			cfg := &config.Config{
+				Server: config.ServerConfig{
+					Listeners:            []config.ListenerConfig{{Address: "unix:" + socket}},
+					WriteTimeoutMs:       200,
+					StreamWriteTimeoutMs: tt.streamWriteTimeoutMs,
+				},
+				Providers: map[string]config.ProviderConfig{"local": {}},
+				Models: map[string]config.ModelConfig{
+					"gpt-4": {Providers: []config.ModelProvider{{Provider: "local", Model: "gpt-4"}}},
+				},
+				Thresholds: config.ThresholdsConfig{FailuresBeforeSwitch: 1, InitialTimeout: 1000, MaxTimeout: 10000},
+			}
+			srv := New(cfg, map[string]provider.Provider{}, state.New(), "test")
+			srv.providers = providerMap{"local": prov}
+			started := make(chan error, 1)
+			go func() { started <- srv.Start() }()
+			t.Cleanup(func() {
+				require.NoError(t, srv.Stop(context.Background()))
+				assert.NoError(t, <-started)
+			})
+
+			client := &http.Client{Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+				},
+			}}
+			var resp *http.Response
+			require.Eventually(t, func() bool {
+				var err error
+				resp, err = client.Post("http://openmodel"+EndpointV1ChatCompletions, "application/json",
+					strings.NewReader(`{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+				return err == nil
+			}, 2*time.Second, 10*time.Millisecond)
+			defer resp.Body.Close()
+			out, _ := io.ReadAll(resp.Body)
+
+			assert.Equal(t, tt.wantComplete, strings.Contains(string(out), SSEDataDone), "stream output: %s", out)
+		})
+	}
+}
@@ -0,0 +1,74 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"strings"
+	"time"
+
+	"github.com/macedot/openmodel/internal/config"
+	applogger "github.com/macedot/openmodel/internal/logger"
+	"github.com/macedot/openmodel/internal/metrics"
+	"github.com/macedot/openmodel/internal/statsd"
+)
+
+// newStatsD creates the StatsD client of the config and pushes the server's metrics to
+// it, nil when StatsD is disabled or the agent's address does not resolve
+func newStatsD(cfg *config.Config, m *serverMetrics) *statsd.Client {
+	if !cfg.StatsD.IsEnabled() {
+		return nil
+	}
+	client, err := statsd.New(statsd.Config{
+		Address:       cfg.StatsD.GetAddress(),
+		Prefix:        cfg.StatsD.GetPrefix(),
+		Tags:          cfg.StatsD.GetTags(),
+		DogStatsD:     cfg.StatsD.GetFormat() == config.StatsDFormatDogStatsD,
+		FlushInterval: cfg.StatsD.GetFlushInterval(),
+		Collect:       m.registry.CollectGauges,
+	})
+	if err != nil {
+		applogger.Warn("statsd_init_failed", "address", cfg.StatsD.GetAddress(), "error", err)
+		return nil
+	}
+	m.registry.SetSink(statsdSink{client})
+	return client
+}
+
+// statsdSink sends the updates of the Prometheus metrics to StatsD, named without their
+// openmodel_ prefix and unit suffixes: openmodel_backend_request_duration_seconds is the
+// backend_request_duration timing, in milliseconds
+type statsdSink struct {
+	client *statsd.Client
+}
+
+func (k statsdSink) Count(name string, labels, values []string, delta float64) {
+	k.client.Count(statsdName(name), delta, statsdTags(labels, values)...)
+}
+
+func (k statsdSink) Observe(name string, labels, values []string, value float64) {
+	if seconds, ok := strings.CutSuffix(name, "_seconds"); ok {
+		k.client.Timing(statsdName(seconds), time.Duration(value*float64(time.Second)), statsdTags(labels, values)...)
+		return
+	}
+	k.client.Histogram(statsdName(name), value, statsdTags(labels, values)...)
+}
+
+func (k statsdSink) Gauge(name string, labels, values []string, value float64) {
+	k.client.Gauge(statsdName(name), value, statsdTags(labels, values)...)
+}
+
+// statsdName returns the StatsD name of a Prometheus metric
+func statsdName(name string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(name, "openmodel_"), "_total")
+}
+
+// statsdTags pairs label names with their values
+func statsdTags(labels, values []string) []statsd.Tag {
+	tags := make([]statsd.Tag, len(labels))
+	for i, label := range labels {
+		tags[i] = statsd.Tag{Key: label, Value: values[i]}
+	}
+	return tags
+}
+
+// Interface assertion
+var _ metrics.Sink = statsdSink{}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/macedot/openmodel/internal/api/openai"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsD(t *testing.T) {
+	agent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer agent.Close()
+	host, port, err := net.SplitHostPort(agent.LocalAddr().String())
+	require.NoError(t, err)
+	portNum, err := strconv.Atoi(port)
+	require.NoError(t, err)
+
+	cfg := &config.Config{
+		Models: map[string]config.ModelConfig{
+			"gpt-4": {Providers: []config.ModelProvider{{Provider: "openai", Model: "gpt-4o"}}},
+		},
+		StatsD: &config.StatsDConfig{Enabled: true, Host: host, Port: portNum, Tags: []string{"env:test"}, FlushIntervalMs: 3600000},
+	}
+	srv := &Server{config: cfg, state: state.New()}
+	srv.metrics = newServerMetrics(srv)
+	srv.statsd = newStatsD(cfg, srv.metrics)
+	require.NotNil(t, srv.statsd)
+
+	srv.metrics.observeRequest("/v1/chat/completions", 200)
+	srv.metrics.observeAttempt("openai/gpt-4o", 1500*time.Millisecond)
+	srv.metrics.observeUsage("openai/gpt-4o", openai.Usage{PromptTokens: 10, CompletionTokens: 5})
+	// Gauges are sent on each flush, the last one on close
+	require.NoError(t, srv.statsd.Close())
+
+	var lines []string
+	buf := make([]byte, 65536)
+	for !strings.Contains(strings.Join(lines, "\n"), "openmodel.backend_circuit_state") {
+		require.NoError(t, agent.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, _, err := agent.ReadFrom(buf)
+		require.NoError(t, err)
+		lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+	}
+	assert.Contains(t, lines, "openmodel.requests:1|c|#env:test,endpoint:/v1/chat/completions,status:200")
+	assert.Contains(t, lines, "openmodel.backend_request_duration:1500|ms|#env:test,backend:openai/gpt-4o")
+	assert.Contains(t, lines, "openmodel.tokens:10|c|#env:test,backend:openai/gpt-4o,direction:input")
+	assert.Contains(t, lines, "openmodel.tokens:5|c|#env:test,backend:openai/gpt-4o,direction:output")
+	assert.Contains(t, lines, "openmodel.requests_in_flight:0|g|#env:test")
+	assert.Contains(t, lines, "openmodel.backend_circuit_state:1|g|#env:test,backend:openai/gpt-4o,state:closed")
+}
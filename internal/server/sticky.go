@@ -0,0 +1,78 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+)
+
+// stickyKeyCtxKey carries the sticky routing key in a request context
+type stickyKeyCtxKey struct{}
+
+// withStickyKey attaches the key the sticky strategy hashes to a provider: the model's
+// sticky_header when the request has it, otherwise the OpenAI "user" field or the
+// Anthropic metadata.user_id. Other strategies leave ctx unchanged.
+func (s *Server) withStickyKey(ctx context.Context, model string, body []byte, header func(string) string) context.Context {
+	modelConfig := s.GetConfig().Models[model]
+	if config.NormalizeStrategy(modelConfig.Strategy) != config.StrategySticky {
+		return ctx
+	}
+	if modelConfig.StickyHeader != "" {
+		if key := header(modelConfig.StickyHeader); key != "" {
+			return context.WithValue(ctx, stickyKeyCtxKey{}, key)
+		}
+	}
+
+	var req struct {
+		User     string `json:"user"`
+		Metadata struct {
+			UserID string `json:"user_id"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return ctx
+	}
+	key := req.User
+	if key == "" {
+		key = req.Metadata.UserID
+	}
+	if key == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, stickyKeyCtxKey{}, key)
+}
+
+// requestHeader adapts a Fiber request's headers for withStickyKey
+func requestHeader(c *fiber.Ctx) func(string) string {
+	return func(name string) string { return c.Get(name) }
+}
+
+// stickyKeyFromContext returns the sticky routing key, if any
+func stickyKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(stickyKeyCtxKey{}).(string)
+	return key
+}
+
+// selectSticky picks a provider by rendezvous hashing of key: each key keeps its provider
+// while that provider is available and moves to its next choice only when it is not.
+// Requests without a key use the first available provider.
+func selectSticky(key string, available []providerResult) providerResult {
+	if key == "" {
+		return available[0]
+	}
+	best, bestScore := 0, uint64(0)
+	for i, p := range available {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+		h.Write([]byte(p.providerKey))
+		if score := h.Sum64(); i == 0 || score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return available[best]
+}
@@ -0,0 +1,101 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/macedot/openmodel/internal/server/converters"
+)
+
+// sseEventStreamStats is the Anthropic-format event carrying the stream stats
+const sseEventStreamStats = "openmodel_stats"
+
+// streamStats are the time to first token and output speed of a complete backend stream
+type streamStats struct {
+	Backend         string  `json:"backend"`
+	FirstTokenMs    int64   `json:"ttft_ms"`
+	TokensPerSecond float64 `json:"tokens_per_second,omitempty"` // 0 when the backend reported no usage
+	OutputTokens    int     `json:"output_tokens,omitempty"`
+}
+
+// newStreamStats computes the stats of a stream whose first token came after firstToken
+// and whose remaining output took generation
+func newStreamStats(firstToken, generation time.Duration, outputTokens int) streamStats {
+	stats := streamStats{FirstTokenMs: firstToken.Milliseconds(), OutputTokens: outputTokens}
+	if outputTokens > 0 && generation > 0 {
+		stats.TokensPerSecond = math.Round(float64(outputTokens)/generation.Seconds()*10) / 10
+	}
+	return stats
+}
+
+// streamStatsRecorder collects the stats of a request's backend streams, by backend, so
+// the stream writer can report those of the one that answered
+type streamStatsRecorder struct {
+	mu        sync.Mutex
+	byBackend map[string]streamStats
+}
+
+type streamStatsKey struct{}
+
+// withStreamStats returns a context recording the stats of the backend streams opened
+// with it
+func withStreamStats(ctx context.Context) (context.Context, *streamStatsRecorder) {
+	r := &streamStatsRecorder{byBackend: make(map[string]streamStats)}
+	return context.WithValue(ctx, streamStatsKey{}, r), r
+}
+
+// streamStatsFromContext returns the recorder of a request, nil if it records no stats
+func streamStatsFromContext(ctx context.Context) *streamStatsRecorder {
+	r, _ := ctx.Value(streamStatsKey{}).(*streamStatsRecorder)
+	return r
+}
+
+// record keeps the stats of a complete stream of backend providerKey
+func (r *streamStatsRecorder) record(providerKey string, stats streamStats) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats.Backend = providerKey
+	r.byBackend[providerKey] = stats
+}
+
+// get returns the stats recorded for backend providerKey
+func (r *streamStatsRecorder) get(providerKey string) (streamStats, bool) {
+	if r == nil {
+		return streamStats{}, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats, ok := r.byBackend[providerKey]
+	return stats, ok
+}
+
+// writeStats sends the stats of the stream of providerKey in the client's format: an
+// openmodel_stats event for Anthropic clients, a chunk without choices carrying an
+// "openmodel" object for OpenAI clients
+func (r *streamRelay) writeStats(streamID, providerKey string) {
+	stats, ok := r.stats.get(providerKey)
+	if !ok {
+		return
+	}
+	if r.sourceFormat == converters.APIFormatAnthropic {
+		data, _ := json.Marshal(map[string]any{"type": sseEventStreamStats, "openmodel": stats})
+		fmt.Fprintf(r.w, "event: %s\n%s%s%s", sseEventStreamStats, SSEDataPrefix, data, SSEDataSuffix)
+		return
+	}
+	data, _ := json.Marshal(map[string]any{
+		"id":        streamID,
+		"object":    "chat.completion.chunk",
+		"model":     r.model,
+		"choices":   []any{},
+		"openmodel": stats,
+	})
+	fmt.Fprintf(r.w, "%s%s%s", SSEDataPrefix, data, SSEDataSuffix)
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamStats(t *testing.T) {
+	openAIStream := func(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+		return streamOf(
+			`data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4","choices":[{"index":0,"delta":{"content":"hi"},"finish_reason":null}]}`,
+			`data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4","choices":[{"index":0,"delta":{},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`,
+			SSEDataDone,
+		), nil
+	}
+	anthropicStream := func(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+		return streamOf(
+			`data: {"type":"message_start","message":{"id":"m1","type":"message","role":"assistant","model":"gpt-4","content":[],"usage":{"input_tokens":3,"output_tokens":0}}}`,
+			`data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+			`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"hi"}}`,
+			`data: {"type":"content_block_stop","index":0}`,
+			`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":2}}`,
+			`data: {"type":"message_stop"}`,
+		), nil
+	}
+
+	tests := []struct {
+		name     string
+		apiMode  string
+		stream   func(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error)
+		endpoint string
+		body     string
+	}{
+		{name: "openai passthrough", stream: openAIStream, endpoint: EndpointV1ChatCompletions,
+			body: `{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"hello"}]}`},
+		{name: "anthropic upstream to openai client", apiMode: "anthropic", stream: anthropicStream, endpoint: EndpointV1ChatCompletions,
+			body: `{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"hello"}]}`},
+		{name: "openai upstream to anthropic client", stream: openAIStream, endpoint: EndpointV1Messages,
+			body: `{"model":"gpt-4","stream":true,"max_tokens":100,"messages":[{"role":"user","content":"hello"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prov := &stubProvider{name: "ollama", apiMode: tt.apiMode, doStreamReqFn: tt.stream}
+			srv := newStreamingTestServer(prov)
+			srv.config.Server.StreamStats = true
+			srv.metrics = newServerMetrics(srv)
+			app := fiber.New()
+			srv.registerRoutes(app)
+
+			req := httptest.NewRequest("POST", tt.endpoint, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("anthropic-version", "2023-06-01")
+			resp, err := app.Test(req, int(10*time.Second/time.Millisecond))
+			require.NoError(t, err)
+			require.Equal(t, fiber.StatusOK, resp.StatusCode)
+			data, _ := io.ReadAll(resp.Body)
+			lines := strings.FieldsFunc(string(data), func(r rune) bool { return r == '\n' })
+
+			// The stats come last, before the [DONE] marker of OpenAI streams
+			n := len(lines)
+			var last string
+			if tt.endpoint == EndpointV1Messages {
+				require.Equal(t, "event: "+sseEventStreamStats, lines[n-2])
+				last = lines[n-1]
+			} else {
+				require.Equal(t, SSEDataDone, lines[n-1])
+				assert.Equal(t, 1, strings.Count(string(data), SSEDataDone), "a single [DONE] marker")
+				last = lines[n-2]
+			}
+			var event struct {
+				Choices   []any       `json:"choices"`
+				OpenModel streamStats `json:"openmodel"`
+			}
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(last, SSEDataPrefix)), &event), last)
+			assert.Equal(t, "ollama/gpt-4", event.OpenModel.Backend)
+			assert.Equal(t, 2, event.OpenModel.OutputTokens)
+			assert.GreaterOrEqual(t, event.OpenModel.FirstTokenMs, int64(0))
+
+			var metrics bytes.Buffer
+			_, err = srv.metrics.registry.WriteTo(&metrics)
+			require.NoError(t, err)
+			assert.Contains(t, metrics.String(), `openmodel_stream_first_token_seconds_count{backend="ollama/gpt-4"} 1`)
+		})
+	}
+
+	// Without stream_stats, streams end as the backend ended them
+	prov := &stubProvider{name: "ollama", doStreamReqFn: openAIStream}
+	srv := newStreamingTestServer(prov)
+	app := fiber.New()
+	srv.registerRoutes(app)
+	req := httptest.NewRequest("POST", EndpointV1ChatCompletions, strings.NewReader(tests[0].body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	data, _ := io.ReadAll(resp.Body)
+	assert.NotContains(t, string(data), "openmodel")
+}
+
+func TestNewStreamStats(t *testing.T) {
+	stats := newStreamStats(250*time.Millisecond, 2*time.Second, 100)
+	assert.Equal(t, int64(250), stats.FirstTokenMs)
+	assert.Equal(t, 50.0, stats.TokensPerSecond)
+
+	// Backends reporting no usage have no speed
+	assert.Zero(t, newStreamStats(time.Second, time.Second, 0).TokensPerSecond)
+	assert.Zero(t, newStreamStats(time.Second, 0, 10).TokensPerSecond)
+
+	m := newServerMetrics(newStreamingTestServer(&stubProvider{name: "ollama"}))
+	m.observeTokensPerSecond("openai/gpt-4o", 42)
+	m.observeTokensPerSecond("openai/gpt-4o", 0)
+	var out bytes.Buffer
+	_, err := m.registry.WriteTo(&out)
+	require.NoError(t, err)
+	assert.Contains(t, out.String(), `openmodel_stream_tokens_per_second_count{backend="openai/gpt-4o"} 1`)
+	assert.Contains(t, out.String(), `openmodel_stream_tokens_per_second_bucket{backend="openai/gpt-4o",le="50"} 1`)
+}
@@ -4,18 +4,29 @@ package server
 import (
 	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/api/anthropic"
+	"github.com/macedot/openmodel/internal/api/openai"
 	applogger "github.com/macedot/openmodel/internal/logger"
 	"github.com/macedot/openmodel/internal/server/converters"
 )
 
 // streamWithFailover handles streaming requests with failover and format conversion
-func (s *Server) streamWithFailover(c *fiber.Ctx, model string, body []byte, headers map[string]string, ctx context.Context, sourceFormat, targetFormat converters.APIFormat) error {
+// endpoint is the client-facing endpoint; converters may map it to the provider's equivalent.
+// includeUsage requests a final usage chunk (stream_options.include_usage) for OpenAI-format clients.
+func (s *Server) streamWithFailover(c *fiber.Ctx, model string, endpoint string, body []byte, headers map[string]string, ctx context.Context, sourceFormat, targetFormat converters.APIFormat, includeUsage bool) error {
 	var triedProviders []string
 	requestID, _ := c.Locals("request_id").(string)
+	capture := bodyLogFromLocals(c)
+	export := llmExportFromContext(ctx)
+	event := usageEventFromContext(ctx)
 
 	// Get converter if needed
 	var converter converters.StreamConverter
@@ -29,19 +40,18 @@ func (s *Server) streamWithFailover(c *fiber.Ctx, model string, body []byte, hea
 	}
 
 	for {
-		prov, providerKey, providerModel, err := s.findProviderWithFailover(model, "")
+		prov, providerKey, providerModel, err := s.findProviderWithFailover(ctx, model)
 		if err != nil {
 			applogger.Error("all_providers_failed",
 				"request_id", requestID,
 				"model", model,
 				"providers_tried", triedProviders,
 				"error", err.Error())
-			s.handleAllProvidersFailedFiber(c, fmt.Errorf("model %q temporarily unavailable: all providers failed", model))
+			s.handleAllProvidersFailedFiber(c, model, fmt.Errorf("model %q temporarily unavailable: all providers failed", model))
 			return nil
 		}
 
 		triedProviders = append(triedProviders, providerKey)
-		threshold := s.GetConfig().GetThresholds(providerKey).FailuresBeforeSwitch
 
 		// Log request processing
 		applogger.Debug("PROCESSING", "request_id", requestID, "provider", providerKey, "model", model)
@@ -50,9 +60,6 @@ func (s *Server) streamWithFailover(c *fiber.Ctx, model string, body []byte, hea
 		c.Locals("provider", providerKey)
 		c.Locals("model", model)
 
-		// Replace model name in body
-		provBody := replaceModelInBody(body, providerModel)
-
 		// Merge headers from converter if present
 		streamHeaders := headers
 		if hasConverter {
@@ -69,12 +76,9 @@ func (s *Server) streamWithFailover(c *fiber.Ctx, model string, body []byte, hea
 		}
 
 		// Determine endpoint
-		endpoint := EndpointV1ChatCompletions
-		if sourceFormat == converters.APIFormatAnthropic {
-			endpoint = EndpointV1Messages
-		}
+		provEndpoint := endpoint
 		if hasConverter {
-			endpoint = converter.GetEndpoint(endpoint)
+			provEndpoint = converter.GetEndpoint(endpoint)
 		}
 
 		// Set streaming headers
@@ -82,59 +86,346 @@ func (s *Server) streamWithFailover(c *fiber.Ctx, model string, body []byte, hea
 		c.Set("Cache-Control", "no-cache")
 		c.Set("Connection", "keep-alive")
 		c.Set("X-Accel-Buffering", "no")
+		// A streamed response keeps its admission slots, and stays in flight, until the stream ends
+		releaseAdmission := admissionFromContext(ctx).hold()
+		releaseGlobal := globalTicketFromContext(ctx).hold()
+		releaseInFlight := inFlightFromContext(ctx).hold()
+		deadline := s.newStreamDeadline(c.Context().Conn())
+		capture.stream(requestID, model)
+		export.stream(requestID, model)
+		var stats *streamStatsRecorder
+		if s.GetConfig().Server.StreamStats {
+			ctx, stats = withStreamStats(ctx)
+		}
+		event.stream(requestID, model)
 		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
-			defer w.Flush()
-
-			stream, err := prov.DoStreamRequest(ctx, endpoint, provBody, streamHeaders)
-			if err != nil {
-				applogger.Warn("provider_stream_failed",
-					"request_id", requestID,
-					"provider", providerKey,
-					"error", err.Error())
-				s.state.RecordFailure(providerKey, threshold)
-				return
-			}
-
-			// Track state for stream conversion
-			streamID := fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano())
-			isFirst := true
-			blockIdx := 0
+			defer s.writeBodyLog(capture)
+			defer s.exportGeneration(export)
+			defer s.publishUsageEvent(event)
+			defer releaseInFlight()
+			defer releaseAdmission()
+			defer releaseGlobal()
+			defer deadline.flush(w)
 
-			for line := range stream {
-				lineStr := string(line)
+			relay := &streamRelay{
+				w:            w,
+				deadline:     deadline,
+				model:        model,
+				requestID:    requestID,
+				converter:    converter,
+				sourceFormat: sourceFormat,
+				upstream:     targetFormat,
+				includeUsage: includeUsage,
+				capture:      capture,
+				export:       export,
+				stats:        stats,
+			}
+			open := func(ctx context.Context, p providerResult) (<-chan []byte, error) {
+				return s.openTimedStream(ctx, model, p.providerKey, targetFormat, func(ctx context.Context) (<-chan []byte, error) {
+					return p.provider.DoStreamRequest(ctx, provEndpoint, s.rewriteOptions(model, p.providerKey, replaceModelInBody(body, p.providerModel)), streamHeaders)
+				})
+			}
 
-				// Convert stream format if converter is present
-				if hasConverter {
-					state := &converters.StreamState{
-						IsFirst:  &isFirst,
-						BlockIdx: &blockIdx,
-					}
-					converted := converter.ConvertStreamLine(lineStr, model, streamID, state)
-					if converted == "" {
-						continue // Skip events that have no equivalent
-					}
-					if _, err := fmt.Fprintf(w, "%s\n", converted); err != nil {
-						applogger.Info("client_disconnected", "request_id", requestID, "provider", providerKey)
+			next := providerResult{provider: prov, providerKey: providerKey, providerModel: providerModel}
+			tried := make(map[string]bool)
+			for {
+				// Hedging (when enabled for the model) may pick a different provider than next
+				winner, stream, done, err := s.openStream(ctx, model, next, targetFormat, open)
+				tried[next.providerKey] = true
+				var outcome relayOutcome
+				if err == nil {
+					tried[winner.providerKey] = true
+					outcome = relay.relay(stream, winner.providerKey)
+					done()
+					if outcome.complete {
+						s.recordSuccess(winner.providerKey)
+						s.recordUsage(ctx, winner.providerKey, outcome.usage)
 						return
 					}
-				} else {
-					// Passthrough - write line as-is
-					if _, err := fmt.Fprintf(w, "%s\n", lineStr); err != nil {
-						applogger.Info("client_disconnected", "request_id", requestID, "provider", providerKey)
+					if outcome.clientGone {
 						return
 					}
+					s.recordStreamFailure(ctx, winner.providerKey, errStreamTruncated)
+				} else if ctx.Err() != nil {
+					// The client went away before any backend answered
+					return
+				} else if _, _, ok := clientErrorOf(err); ok {
+					// Another backend would refuse the request the same way
+					relay.writeInvalidRequest(err.Error())
+					return
 				}
-				w.Flush()
-			}
 
-			// Write [DONE] marker for OpenAI format streams
-			if sourceFormat == converters.APIFormatOpenAI && targetFormat == converters.APIFormatOpenAI {
-				fmt.Fprintf(w, "data: [DONE]\n\n")
-				w.Flush()
+				// Nothing has reached the client yet, so another provider can answer invisibly
+				if !outcome.emitted {
+					if candidate, ok := s.nextProviderCandidate(ctx, model, next, tried); ok {
+						applogger.Info("stream_failover", "request_id", requestID, "model", model, "from", next.providerKey, "to", candidate.providerKey)
+						next = candidate
+						continue
+					}
+				}
+				relay.writeError(fmt.Sprintf("model %q stream interrupted: upstream ended before completion", model))
+				return
 			}
-
-			s.state.ResetModel(providerKey)
 		})
 		return nil
 	}
 }
+
+// errStreamTruncated is recorded against a provider whose stream ended without its end marker
+var errStreamTruncated = errors.New("upstream stream ended before completion")
+
+// streamDeadline bounds writing a streamed response by the stream write timeout rather
+// than the write timeout. The server sets the write timeout on the connection once the
+// handler returns, after the stream has started, so the deadline is set again on each
+// flush.
+type streamDeadline struct {
+	conn     net.Conn
+	deadline time.Time // zero for no limit
+}
+
+// newStreamDeadline starts the stream write timeout of a response written to conn
+func (s *Server) newStreamDeadline(conn net.Conn) streamDeadline {
+	d := streamDeadline{conn: conn}
+	if timeout := s.GetConfig().Server.GetStreamWriteTimeout(); timeout > 0 {
+		d.deadline = time.Now().Add(timeout)
+	}
+	return d
+}
+
+// flush sets the write deadline and flushes w
+func (d streamDeadline) flush(w *bufio.Writer) error {
+	if d.conn != nil {
+		_ = d.conn.SetWriteDeadline(d.deadline)
+	}
+	return w.Flush()
+}
+
+// streamRelay copies upstream stream lines to the client, converting formats as needed
+type streamRelay struct {
+	w            *bufio.Writer
+	deadline     streamDeadline
+	model        string
+	requestID    string
+	converter    converters.StreamConverter // nil for passthrough
+	sourceFormat converters.APIFormat       // client-facing format
+	upstream     converters.APIFormat       // provider format
+	includeUsage bool
+	capture      *bodyLogRequest      // nil unless the request is body logged
+	export       *llmExportRequest    // nil unless the request is exported
+	stats        *streamStatsRecorder // nil unless stream stats are sent to the client
+}
+
+// relayOutcome describes how one upstream stream ended
+type relayOutcome struct {
+	complete   bool         // upstream sent its end-of-stream marker
+	emitted    bool         // output reached the client
+	clientGone bool         // writing to the client failed
+	usage      openai.Usage // token usage reported by the upstream
+}
+
+// relay forwards one upstream stream. Output is held back until the first content token
+// so that a stream dying before producing anything can be retried on another provider.
+func (r *streamRelay) relay(stream <-chan []byte, providerKey string) relayOutcome {
+	var out relayOutcome
+	if r.capture != nil {
+		r.capture.entry.Backend = providerKey
+	}
+	if r.export != nil {
+		r.export.generation.Backend = providerKey
+	}
+
+	// Track state for stream conversion
+	streamID := fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano())
+	isFirst := true
+	blockIdx := 0
+	metrics := &anthropic.StreamMetrics{}
+	usage := &metrics.Usage
+	state := &converters.StreamState{
+		IsFirst:      &isFirst,
+		BlockIdx:     &blockIdx,
+		Metrics:      metrics,
+		IncludeUsage: r.includeUsage,
+	}
+	openAIPassthrough := r.converter == nil && r.sourceFormat == converters.APIFormatOpenAI
+	usageSeen, usageChunkSent := false, false
+	// The stream stats go before the [DONE] marker a converter writes for OpenAI clients
+	holdDone := r.stats != nil && r.converter != nil && r.sourceFormat == converters.APIFormatOpenAI
+	doneHeld := false
+
+	var pending []string
+	write := func(text string) bool {
+		if !out.emitted {
+			pending = append(pending, text)
+			return true
+		}
+		if _, err := r.w.WriteString(text); err != nil {
+			applogger.Info("client_disconnected", "request_id", r.requestID, "provider", providerKey)
+			out.clientGone = true
+			return false
+		}
+		r.capture.add(text)
+		r.export.add(text)
+		return true
+	}
+	emit := func() bool {
+		out.emitted = true
+		for _, text := range pending {
+			if !write(text) {
+				return false
+			}
+		}
+		pending = nil
+		return true
+	}
+
+	for line := range stream {
+		lineStr := string(line)
+
+		if isStreamTerminator(lineStr, r.upstream) {
+			out.complete = true
+		}
+		observeUpstreamUsage(lineStr, &out.usage)
+		if !out.emitted && carriesToken(lineStr, r.upstream) && !emit() {
+			return out
+		}
+
+		// The [DONE] marker is written once after usage reporting below
+		if openAIPassthrough && lineStr == SSEDataDone {
+			continue
+		}
+		if openAIPassthrough && r.includeUsage {
+			seen, usageOnly := observeStreamUsage(lineStr, usage)
+			usageSeen = usageSeen || seen
+			usageChunkSent = usageChunkSent || usageOnly
+		}
+
+		// Convert stream format if converter is present
+		if r.converter != nil {
+			converted := r.converter.ConvertStreamLine(lineStr, r.model, streamID, state)
+			if converted == "" {
+				continue // Skip events that have no equivalent
+			}
+			lineStr = converted
+			if holdDone {
+				if before, ok := strings.CutSuffix(lineStr, SSEDataDone+SSEDataSuffix); ok {
+					lineStr, doneHeld = before, true
+					if lineStr == "" {
+						continue
+					}
+				}
+			}
+		}
+		if !write(lineStr + "\n") {
+			return out
+		}
+		if out.emitted {
+			r.deadline.flush(r.w)
+		}
+	}
+
+	if !out.complete {
+		return out
+	}
+	// A complete stream without content (e.g. an empty answer) is still delivered
+	if !out.emitted && !emit() {
+		return out
+	}
+
+	// Backends that report usage on their last content chunk (e.g. Ollama)
+	// do not send the dedicated usage chunk clients asked for.
+	if openAIPassthrough && r.includeUsage && usageSeen && !usageChunkSent {
+		if chunk, err := json.Marshal(openai.NewUsageChunk(streamID, r.model, *usage)); err == nil {
+			fmt.Fprintf(r.w, "%s%s%s", SSEDataPrefix, chunk, SSEDataSuffix)
+		}
+	}
+	if r.stats != nil {
+		r.writeStats(streamID, providerKey)
+	}
+	// Write [DONE] marker for OpenAI format streams
+	if openAIPassthrough || doneHeld {
+		fmt.Fprintf(r.w, "%s%s", SSEDataDone, SSEDataSuffix)
+	}
+	r.deadline.flush(r.w)
+	return out
+}
+
+// writeError sends a synthetic error event in the client's format
+func (r *streamRelay) writeError(message string) {
+	if r.sourceFormat == converters.APIFormatAnthropic {
+		r.writeErrorEvent(map[string]string{"type": "api_error", "message": message})
+	} else {
+		r.writeErrorEvent(map[string]string{"type": "server_error", "code": "stream_interrupted", "message": message})
+	}
+}
+
+// writeInvalidRequest sends an error event for a request the backend refused as invalid
+func (r *streamRelay) writeInvalidRequest(message string) {
+	r.writeErrorEvent(map[string]string{"type": "invalid_request_error", "message": message})
+}
+
+// writeErrorEvent sends an error event with the given error object in the client's format
+func (r *streamRelay) writeErrorEvent(detail map[string]string) {
+	if r.sourceFormat == converters.APIFormatAnthropic {
+		data, _ := json.Marshal(map[string]any{"type": "error", "error": detail})
+		fmt.Fprintf(r.w, "event: error\n%s%s%s", SSEDataPrefix, data, SSEDataSuffix)
+	} else {
+		data, _ := json.Marshal(map[string]any{"error": detail})
+		fmt.Fprintf(r.w, "%s%s%s", SSEDataPrefix, data, SSEDataSuffix)
+	}
+	r.deadline.flush(r.w)
+}
+
+// isStreamTerminator reports whether line is the end-of-stream marker of format
+func isStreamTerminator(line string, format converters.APIFormat) bool {
+	if format == converters.APIFormatAnthropic {
+		return strings.HasPrefix(line, SSEDataPrefix) && strings.Contains(line, `"type":"message_stop"`)
+	}
+	return line == SSEDataDone
+}
+
+// carriesToken reports whether an upstream stream line of format contains generated content
+func carriesToken(line string, format converters.APIFormat) bool {
+	data, ok := strings.CutPrefix(line, SSEDataPrefix)
+	if !ok {
+		return false
+	}
+	if format == converters.APIFormatAnthropic {
+		return strings.Contains(data, `"type":"content_block_delta"`)
+	}
+	var chunk struct {
+		Choices []struct {
+			Text  string `json:"text"`
+			Delta struct {
+				Content          string            `json:"content"`
+				ReasoningContent string            `json:"reasoning_content"`
+				Thinking         string            `json:"thinking"`
+				ToolCalls        []json.RawMessage `json:"tool_calls"`
+			} `json:"delta"`
+		} `json:"choices"`
+	}
+	if json.Unmarshal([]byte(data), &chunk) != nil {
+		return false
+	}
+	for _, choice := range chunk.Choices {
+		d := choice.Delta
+		if choice.Text != "" || d.Content != "" || d.ReasoningContent != "" || d.Thinking != "" || len(d.ToolCalls) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// observeStreamUsage inspects an OpenAI SSE line for token usage, copying it into usage.
+// It reports whether usage was present and whether the chunk was a usage-only chunk.
+func observeStreamUsage(line string, usage *openai.Usage) (seen bool, usageOnly bool) {
+	data, ok := strings.CutPrefix(line, SSEDataPrefix)
+	if !ok {
+		return false, false
+	}
+	chunk, err := openai.StreamResponseToChunk([]byte(data))
+	if err != nil || chunk.Usage == nil {
+		return false, false
+	}
+	*usage = *chunk.Usage
+	return true, len(chunk.Choices) == 0
+}
@@ -0,0 +1,72 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	applogger "github.com/macedot/openmodel/internal/logger"
+)
+
+// tenantKey carries the tenant of a request in its context
+type tenantKey struct{}
+
+// withTenant attaches the tenant a request belongs to
+func withTenant(ctx context.Context, tenant config.Tenant) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// tenantFromContext returns the tenant a request belongs to
+func tenantFromContext(ctx context.Context) (config.Tenant, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(config.Tenant)
+	return tenant, ok
+}
+
+// tenantsMiddleware assigns requests to the model APIs to their tenant: that of the API
+// key they were authenticated with or, when the config names a tenant header, the one it
+// names if the key may choose it. Requests without a tenant, for an unknown tenant or one
+// their key may not choose are refused, and those of a tenant that has used its monthly
+// quota get 429. It reads the current config, so a reload applies at once.
+func (s *Server) tenantsMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		cfg := s.GetConfig()
+		group := endpointGroup(c.Path())
+		if len(cfg.Tenants) == 0 || !config.IsAPIKeyEndpointGroup(group) {
+			return c.Next()
+		}
+		requestID, _ := c.Locals("request_id").(string)
+		key, _, hasKey := clientKeyFromContext(c.UserContext())
+		name := key.Tenant
+		if chosen := c.Get(cfg.TenantHeader); cfg.TenantHeader != "" && chosen != "" && chosen != name {
+			if !hasKey || !key.MayChooseTenant(chosen) {
+				applogger.Warn("tenant_denied", "request_id", requestID, "key", key.Name, "tenant", chosen)
+				if !hasKey {
+					return apiKeyError(c, group, fmt.Sprintf("choosing tenant %q requires an api key", chosen), fiber.StatusForbidden)
+				}
+				return apiKeyError(c, group, fmt.Sprintf("api key %q may not choose tenant %q", key.Name, chosen), fiber.StatusForbidden)
+			}
+			name = chosen
+		}
+		if name == "" {
+			applogger.Warn("tenant_missing", "request_id", requestID, "key", key.Name)
+			return apiKeyError(c, group, "the request belongs to no tenant", fiber.StatusForbidden)
+		}
+		tenant, ok := cfg.LookupTenant(name)
+		if !ok {
+			applogger.Warn("tenant_unknown", "request_id", requestID, "tenant", name)
+			return apiKeyError(c, group, fmt.Sprintf("unknown tenant %q", name), fiber.StatusForbidden)
+		}
+		c.Locals("tenant", tenant.Name)
+		c.SetUserContext(withTenant(c.UserContext(), tenant))
+		if tenant.HasQuota() {
+			// The key's own quota headers, when it has a quota, are kept
+			q := s.tenantQuota(c.UserContext(), tenant)
+			if !s.enforceMonthlyQuota(c, group, q, fmt.Sprintf("tenant %q", tenant.Name), !hasKey || !key.HasQuota()) {
+				return nil
+			}
+		}
+		return c.Next()
+	}
+}
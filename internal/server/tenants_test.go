@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/api/openai"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/usage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenants(t *testing.T) {
+	var served []string
+	prov := &stubProvider{
+		name: "ollama",
+		doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+			served = append(served, extractModelFromRequestBody(body))
+			return []byte(`{"id":"c1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}],"usage":{"prompt_tokens":60,"completion_tokens":50,"total_tokens":110}}`), nil
+		},
+	}
+	srv, _ := newAdminTestServer(&config.AdminConfig{Enabled: true, Token: "s3cret"})
+	srv.providers = providerMap{"ollama": prov}
+	srv.config.Models["gpt-4"] = config.ModelConfig{Strategy: "fallback", Providers: []config.ModelProvider{{Provider: "ollama", Model: "gpt-4"}}}
+	srv.config.Models["gpt-4-eu"] = config.ModelConfig{Strategy: "fallback", Providers: []config.ModelProvider{{Provider: "ollama", Model: "gpt-4-eu"}}}
+	srv.config.Models["claude"] = config.ModelConfig{Strategy: "fallback", Providers: []config.ModelProvider{{Provider: "ollama", Model: "claude"}}}
+	srv.config.TenantHeader = "X-Tenant"
+	srv.config.Tenants = []config.Tenant{
+		{Name: "eu", Models: []string{"gpt-*"}, Chains: map[string]string{"gpt-4": "gpt-4-eu", "gpt-4-private": "gpt-4-eu"}},
+		{Name: "research", MonthlyTokens: 150},
+	}
+	srv.config.APIKeys = []config.APIKey{
+		{Name: "eu-app", Key: "sk-eu", Tenant: "eu"},
+		{Name: "shared", Key: "sk-shared"},
+		{Name: "ops", Key: "sk-ops", Tenants: []string{"*"}},
+	}
+	store, err := usage.Open(filepath.Join(t.TempDir(), "usage.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	srv.SetUsageStore(store)
+
+	app := fiber.New()
+	app.Use(srv.apiKeysMiddleware())
+	app.Use(srv.tenantsMiddleware())
+	srv.registerRoutes(app)
+	do := func(method, path, key, tenant, body string) (*http.Response, []byte) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+key)
+		if tenant != "" {
+			req.Header.Set("X-Tenant", tenant)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		data, _ := io.ReadAll(resp.Body)
+		return resp, data
+	}
+	chat := func(model string) string {
+		return `{"model":"` + model + `","messages":[{"role":"user","content":"hello"}]}`
+	}
+
+	// The key's tenant serves its requests, and its chains its models
+	resp, data := do("POST", EndpointV1ChatCompletions, "sk-eu", "", chat("gpt-4"))
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode, string(data))
+	resp, data = do("POST", EndpointV1ChatCompletions, "sk-eu", "eu", chat("gpt-4-private"))
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode, string(data))
+	assert.Equal(t, []string{"gpt-4-eu", "gpt-4-eu"}, served)
+
+	// Only keys allowed to choose a tenant may name another one
+	resp, data = do("POST", EndpointV1ChatCompletions, "sk-eu", "research", chat("gpt-4"))
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+	assert.Contains(t, string(data), `api key \"eu-app\" may not choose tenant \"research\"`)
+	resp, _ = do("POST", EndpointV1ChatCompletions, "sk-shared", "research", chat("gpt-4"))
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+	// Tenants only use their models
+	resp, data = do("POST", EndpointV1ChatCompletions, "sk-eu", "", chat("claude"))
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+	assert.Contains(t, string(data), `tenant \"eu\" may not use model \"claude\"`)
+
+	resp, data = do("GET", EndpointV1Models, "sk-eu", "", "")
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	var list openai.ModelList
+	require.NoError(t, json.Unmarshal(data, &list))
+	var ids []string
+	for _, m := range list.Data {
+		ids = append(ids, m.ID)
+	}
+	assert.ElementsMatch(t, []string{"gpt-4", "gpt-4-eu", "gpt-4-private"}, ids)
+	for _, m := range list.Data {
+		if m.ID == "gpt-4" {
+			assert.Equal(t, []string{"ollama/gpt-4-eu"}, m.Backends)
+		}
+	}
+
+	// A request that ends up in no tenant, or in an unknown one, is refused
+	served = nil
+	resp, data = do("POST", EndpointV1ChatCompletions, "sk-shared", "", chat("gpt-4"))
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+	assert.Contains(t, string(data), "the request belongs to no tenant")
+	resp, _ = do("GET", EndpointV1Models, "sk-ops", "", "")
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+	resp, data = do("POST", EndpointV1ChatCompletions, "sk-ops", "unknown", chat("gpt-4"))
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+	assert.Contains(t, string(data), `unknown tenant \"unknown\"`)
+	assert.Empty(t, served)
+
+	// A tenant's quota counts the requests of all its clients
+	resp, data = do("POST", EndpointV1ChatCompletions, "sk-ops", "research", chat("claude"))
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode, string(data))
+	assert.Equal(t, "150", resp.Header.Get(HeaderXOpenModelQuotaLimitTokens))
+	assert.Equal(t, "150", resp.Header.Get(HeaderXOpenModelQuotaRemainingTokens))
+	resp, _ = do("POST", EndpointV1ChatCompletions, "sk-ops", "research", chat("claude"))
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	resp, data = do("POST", EndpointV1ChatCompletions, "sk-ops", "research", chat("claude"))
+	assert.Equal(t, fiber.StatusTooManyRequests, resp.StatusCode)
+	assert.Contains(t, string(data), `tenant \"research\" has used its monthly quota of 150 tokens`)
+
+	// Usage is accounted to tenants
+	records, err := store.Query(context.Background(), usage.Filter{GroupBy: []string{usage.ColumnTenant}})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "eu", records[0].Tenant)
+	assert.Equal(t, int64(2), records[0].Requests)
+	assert.Equal(t, "research", records[1].Tenant)
+	assert.Equal(t, int64(2), records[1].Requests)
+
+	resp, data = do("GET", EndpointAdminQuotas, "s3cret", "", "")
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	var report struct {
+		Tenants []keyQuota `json:"tenants"`
+	}
+	require.NoError(t, json.Unmarshal(data, &report))
+	require.Len(t, report.Tenants, 1)
+	assert.Equal(t, "research", report.Tenants[0].Name)
+	assert.Empty(t, report.Tenants[0].ID)
+	assert.Equal(t, int64(220), report.Tenants[0].UsedTokens)
+	assert.True(t, report.Tenants[0].Exhausted)
+}
+
+func TestTenants_HeaderWithoutAPIKeys(t *testing.T) {
+	srv, _ := newAdminTestServer(nil)
+	srv.config.Models = map[string]config.ModelConfig{
+		"gpt-4": {Providers: []config.ModelProvider{{Provider: "ollama", Model: "gpt-4"}}},
+	}
+	srv.config.TenantHeader = "X-Tenant"
+	srv.config.Tenants = []config.Tenant{{Name: "eu", Models: []string{"gpt-4"}}}
+
+	app := fiber.New()
+	app.Use(srv.tenantsMiddleware())
+	srv.registerRoutes(app)
+	// Unauthenticated requests may not pick a tenant, and need one once tenants exist
+	for tenant, want := range map[string]string{"eu": `choosing tenant \"eu\" requires an api key`, "": "the request belongs to no tenant"} {
+		req := httptest.NewRequest("GET", EndpointV1Models, nil)
+		req.Header.Set("X-Tenant", tenant)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		data, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, fiber.StatusForbidden, resp.StatusCode, tenant)
+		assert.Contains(t, string(data), want, tenant)
+	}
+}
@@ -0,0 +1,196 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptrace"
+	"time"
+
+	"github.com/macedot/openmodel/internal/api/openai"
+	"github.com/macedot/openmodel/internal/config"
+	applogger "github.com/macedot/openmodel/internal/logger"
+	"github.com/macedot/openmodel/internal/provider"
+	"github.com/macedot/openmodel/internal/server/converters"
+	"github.com/macedot/openmodel/internal/tracing"
+)
+
+// Phases of a backend attempt that can time out
+const (
+	timeoutPhaseConnect    = "connect"
+	timeoutPhaseFirstToken = "first_token"
+	timeoutPhaseTotal      = "total"
+)
+
+// timeoutError reports a backend attempt that exceeded one of its timeouts. It matches
+// context.DeadlineExceeded, so it is classified, retried and failed over as a timeout.
+type timeoutError struct {
+	phase string
+	limit time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("backend %s timeout after %s", e.phase, e.limit)
+}
+
+// Timeout marks the error as a timeout, like net.Error
+func (e *timeoutError) Timeout() bool { return true }
+
+// Is makes errors.Is(err, context.DeadlineExceeded) hold
+func (e *timeoutError) Is(target error) bool { return target == context.DeadlineExceeded }
+
+// backendAttempt is one request to a backend, cancelled when it exceeds a timeout
+type backendAttempt struct {
+	ctx         context.Context
+	cancel      context.CancelCauseFunc
+	timers      []*time.Timer
+	firstToken  *time.Timer // nil unless a streaming attempt has a first-token timeout
+	providerKey string
+	start       time.Time
+	metrics     *serverMetrics
+	span        *tracing.Span
+}
+
+// startAttempt starts a request to a backend of model under the backend's timeouts.
+// The first-token timeout only applies to streaming attempts. Call end once the
+// response has been read.
+func (s *Server) startAttempt(ctx context.Context, model, providerKey string, streaming bool) *backendAttempt {
+	t := s.backendTimeouts(model, providerKey)
+	ctx, span := s.tracer.Start(ctx, "backend "+providerKey, tracing.SpanKindClient)
+	span.SetAttribute(spanAttrModel, model)
+	span.SetAttribute(spanAttrBackend, providerKey)
+	span.SetAttribute("openmodel.stream", streaming)
+	ctx, cancel := context.WithCancelCause(ctx)
+	a := &backendAttempt{ctx: ctx, cancel: cancel, providerKey: providerKey, start: time.Now(), metrics: s.metrics, span: span}
+
+	after := func(phase string, limit time.Duration) *time.Timer {
+		timer := time.AfterFunc(limit, func() { cancel(&timeoutError{phase: phase, limit: limit}) })
+		a.timers = append(a.timers, timer)
+		return timer
+	}
+	if limit := t.GetTotal(); limit > 0 {
+		after(timeoutPhaseTotal, limit)
+	}
+	if limit := t.GetFirstToken(); streaming && limit > 0 {
+		a.firstToken = after(timeoutPhaseFirstToken, limit)
+	}
+	if limit := t.GetConnect(); limit > 0 {
+		// A pooled connection is handed over at once, a new one once dialled and secured
+		connect := after(timeoutPhaseConnect, limit)
+		a.ctx = httptrace.WithClientTrace(a.ctx, &httptrace.ClientTrace{
+			GotConn: func(httptrace.GotConnInfo) { connect.Stop() },
+		})
+	}
+	return a
+}
+
+// end stops the attempt's timers and releases its context, recording its duration
+func (a *backendAttempt) end() {
+	for _, timer := range a.timers {
+		timer.Stop()
+	}
+	a.cancel(context.Canceled)
+	a.metrics.observeAttempt(a.providerKey, time.Since(a.start))
+	a.span.End()
+}
+
+// fail records on the attempt's span why it failed; a nil err records nothing
+func (a *backendAttempt) fail(err error) {
+	if err == nil {
+		return
+	}
+	a.span.SetError(err)
+	a.span.SetAttribute("error.type", classifyError(err).String())
+	if status := provider.StatusCodeOf(err); status != 0 {
+		a.span.SetAttribute("http.response.status_code", status)
+	}
+}
+
+// err returns the timeout that aborted the attempt in place of err, if there was one
+func (a *backendAttempt) err(err error) error {
+	if err == nil {
+		return nil
+	}
+	if timeout, ok := context.Cause(a.ctx).(*timeoutError); ok {
+		return timeout
+	}
+	// Backend errors may quote the request URL or echo its credentials
+	return applogger.ScrubError(err)
+}
+
+// guard relays an attempt's stream, stopping the first-token timer and recording the
+// time to first token at the first content line of the upstream format. A complete stream
+// records its output tokens per second, from the first token to the end marker. The
+// attempt ends with the stream; a stream cut short by a timeout simply ends early, so the
+// caller fails over as for any truncated stream.
+func (a *backendAttempt) guard(stream <-chan []byte, format converters.APIFormat, providerKey string) <-chan []byte {
+	out := make(chan []byte)
+	go func() {
+		defer close(out)
+		defer a.end()
+		var (
+			firstToken, end time.Time
+			usage           openai.Usage
+		)
+		for line := range stream {
+			lineStr := string(line)
+			if firstToken.IsZero() && carriesToken(lineStr, format) {
+				firstToken = time.Now()
+				a.metrics.observeFirstToken(providerKey, firstToken.Sub(a.start))
+				a.span.AddEvent("first_token")
+				if a.firstToken != nil {
+					a.firstToken.Stop()
+					a.firstToken = nil
+				}
+			}
+			observeUpstreamUsage(lineStr, &usage)
+			if end.IsZero() && isStreamTerminator(lineStr, format) {
+				end = time.Now()
+			}
+			select {
+			case out <- line:
+			case <-a.ctx.Done():
+				for range stream {
+				}
+			}
+		}
+		if timeout, ok := context.Cause(a.ctx).(*timeoutError); ok {
+			logTimeout(a.ctx, providerKey, timeout)
+			a.fail(timeout)
+		}
+		if !firstToken.IsZero() && !end.IsZero() && a.ctx.Err() == nil {
+			stats := newStreamStats(firstToken.Sub(a.start), end.Sub(firstToken), usage.CompletionTokens)
+			a.metrics.observeTokensPerSecond(providerKey, stats.TokensPerSecond)
+			streamStatsFromContext(a.ctx).record(providerKey, stats)
+		}
+	}()
+	return out
+}
+
+// openTimedStream opens a stream to a backend of model under the backend's timeouts
+func (s *Server) openTimedStream(ctx context.Context, model, providerKey string, format converters.APIFormat, open func(ctx context.Context) (<-chan []byte, error)) (<-chan []byte, error) {
+	a := s.startAttempt(ctx, model, providerKey, true)
+	stream, err := open(a.ctx)
+	if err != nil {
+		err = a.err(err)
+		a.fail(err)
+		a.end()
+		return nil, err
+	}
+	return a.guard(stream, format, providerKey), nil
+}
+
+// backendTimeouts returns the timeouts of the backend providerKey of model
+func (s *Server) backendTimeouts(model, providerKey string) config.TimeoutsConfig {
+	backend, _ := s.modelBackend(model, providerKey)
+	return s.GetConfig().Models[model].BackendTimeouts(backend)
+}
+
+// logTimeout logs a backend attempt abandoned because of a timeout
+func logTimeout(ctx context.Context, providerKey string, timeout *timeoutError) {
+	applogger.Warn("backend_timeout",
+		"request_id", provider.RequestIDFromContext(ctx),
+		"provider", providerKey,
+		"phase", timeout.phase,
+		"limit_ms", timeout.limit.Milliseconds())
+}
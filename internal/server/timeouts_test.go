@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/endpoints"
+	applogger "github.com/macedot/openmodel/internal/logger"
+	"github.com/macedot/openmodel/internal/provider"
+	"github.com/macedot/openmodel/internal/server/converters"
+	"github.com/macedot/openmodel/internal/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTimeoutTestServer serves model gpt-4 from a hanging local backend, then hosted
+func newTimeoutTestServer(local, hosted *stubProvider, timeouts, localTimeouts *config.TimeoutsConfig) *Server {
+	cfg := &config.Config{
+		Models: map[string]config.ModelConfig{
+			"gpt-4": {Strategy: config.StrategyFallback, Timeouts: timeouts, Providers: []config.ModelProvider{
+				{Provider: "local", Model: "llama3", Timeouts: localTimeouts},
+				{Provider: "hosted", Model: "gpt-4o"},
+			}},
+		},
+		Thresholds: config.ThresholdsConfig{FailuresBeforeSwitch: 1, InitialTimeout: 1000, MaxTimeout: 10000},
+	}
+	return &Server{config: cfg, providers: providerMap{"local": local, "hosted": hosted}, state: state.New()}
+}
+
+func TestHandleV1ChatCompletions_TotalTimeoutFailsOver(t *testing.T) {
+	local := &stubProvider{
+		name: "local",
+		doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+	hosted := &stubProvider{
+		name: "hosted",
+		doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+			return []byte(`{"id":"hosted","object":"chat.completion","choices":[]}`), nil
+		},
+	}
+	srv := newTimeoutTestServer(local, hosted, &config.TimeoutsConfig{TotalMs: 50}, nil)
+
+	app := fiber.New()
+	app.Post(endpoints.V1ChatCompletions, srv.handleV1ChatCompletions)
+	req := httptest.NewRequest("POST", endpoints.V1ChatCompletions, strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), `"id":"hosted"`)
+	assert.False(t, srv.state.Allow("local/llama3", srv.breakerPolicy("local/llama3")), "timeout counts as a failure")
+}
+
+func TestHandleV1ChatCompletions_FirstTokenTimeoutFailsOver(t *testing.T) {
+	local := &stubProvider{
+		name: "local",
+		doStreamReqFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+			ch := make(chan []byte, 1)
+			// A role chunk carries no token, so it does not satisfy the first-token timeout
+			ch <- []byte(`data: {"id":"c1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"role":"assistant"}}]}`)
+			go func() {
+				<-ctx.Done()
+				close(ch)
+			}()
+			return ch, nil
+		},
+	}
+	hosted := &stubProvider{
+		name: "hosted",
+		doStreamReqFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+			return streamOf(
+				`data: {"id":"c2","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"from hosted"}}]}`,
+				SSEDataDone,
+			), nil
+		},
+	}
+	// hosted keeps the generous model-wide limit; local overrides it with a short one
+	srv := newTimeoutTestServer(local, hosted, &config.TimeoutsConfig{FirstTokenMs: 5000}, &config.TimeoutsConfig{FirstTokenMs: 50})
+
+	app := fiber.New()
+	app.Post(endpoints.V1ChatCompletions, srv.handleV1ChatCompletions)
+	req := httptest.NewRequest("POST", endpoints.V1ChatCompletions, strings.NewReader(`{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"hello"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Contains(t, string(body), "from hosted")
+	assert.NotContains(t, string(body), `"c1"`, "nothing from the timed out backend reaches the client")
+}
+
+func TestStartAttempt_Timeouts(t *testing.T) {
+	srv := newTimeoutTestServer(&stubProvider{name: "local"}, &stubProvider{name: "hosted"},
+		&config.TimeoutsConfig{ConnectMs: 20, TotalMs: 5000}, nil)
+
+	t.Run("connect timeout", func(t *testing.T) {
+		a := srv.startAttempt(context.Background(), "gpt-4", "local/llama3", false)
+		defer a.end()
+		<-a.ctx.Done()
+		err := a.err(a.ctx.Err())
+		assert.EqualError(t, err, "backend connect timeout after 20ms")
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+		assert.Equal(t, errorClassTimeout, classifyError(err))
+	})
+
+	t.Run("connection established in time", func(t *testing.T) {
+		a := srv.startAttempt(context.Background(), "gpt-4", "local/llama3", false)
+		defer a.end()
+		httptrace.ContextClientTrace(a.ctx).GotConn(httptrace.GotConnInfo{})
+		select {
+		case <-a.ctx.Done():
+			t.Fatal("attempt cancelled after the connection was established")
+		case <-time.After(60 * time.Millisecond):
+		}
+		assert.Equal(t, io.EOF, a.err(io.EOF), "other errors are returned as is")
+	})
+
+	t.Run("first token only bounds streams", func(t *testing.T) {
+		srv := newTimeoutTestServer(&stubProvider{name: "local"}, &stubProvider{name: "hosted"}, &config.TimeoutsConfig{FirstTokenMs: 10}, nil)
+		a := srv.startAttempt(context.Background(), "gpt-4", "hosted/gpt-4o", false)
+		defer a.end()
+		assert.Nil(t, a.firstToken)
+
+		stream, err := srv.openTimedStream(context.Background(), "gpt-4", "hosted/gpt-4o", converters.APIFormatOpenAI,
+			func(ctx context.Context) (<-chan []byte, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			})
+		assert.Nil(t, stream)
+		assert.EqualError(t, err, "backend first_token timeout after 10ms")
+	})
+}
+
+func TestCallProvider_ScrubsSecrets(t *testing.T) {
+	applogger.SetSecrets("config", "sk-local-0123456789")
+	defer applogger.SetSecrets("config")
+	srv := newTimeoutTestServer(&stubProvider{name: "local"}, &stubProvider{name: "hosted"}, nil, nil)
+
+	err := srv.callProvider(context.Background(), "gpt-4", "local/llama3", func(ctx context.Context) error {
+		return &provider.StatusError{StatusCode: 401, Err: errors.New(`invalid api key "sk-local-0123456789"`)}
+	})
+	assert.EqualError(t, err, `invalid api key "[REDACTED]"`)
+	assert.Equal(t, 401, provider.StatusCodeOf(err), "the scrubbed error wraps the original")
+	assert.Equal(t, errorClassAuth, classifyError(err))
+}
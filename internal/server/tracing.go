@@ -0,0 +1,64 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/tracing"
+)
+
+// Span attributes of the server's spans
+const (
+	spanAttrModel   = "openmodel.model"
+	spanAttrBackend = "openmodel.backend"
+)
+
+// newTracer creates the tracer of the tracing config, nil when tracing is disabled
+func newTracer(cfg *config.Config) *tracing.Tracer {
+	if !cfg.Tracing.IsEnabled() {
+		return nil
+	}
+	return tracing.New(tracing.Config{
+		Endpoint:    cfg.Tracing.GetTracesURL(),
+		Headers:     cfg.Tracing.GetHeaders(),
+		ServiceName: cfg.Tracing.GetServiceName(),
+		SampleRatio: cfg.Tracing.GetSampleRatio(),
+	})
+}
+
+// tracingMiddleware traces each request with a server span, continuing the trace of its
+// traceparent header. Routing and each backend attempt get spans of their own below it,
+// and the trace is propagated to backends. The span covers the handler: the attempt
+// span of a stream ends with the stream.
+func (s *Server) tracingMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if s.tracer == nil {
+			return c.Next()
+		}
+		ctx := c.UserContext()
+		if parent, ok := tracing.ParseTraceparent(c.Get(tracing.HeaderTraceparent)); ok {
+			ctx = tracing.ContextWithRemoteParent(ctx, parent)
+		}
+		ctx, span := s.tracer.Start(ctx, c.Method()+" "+c.Path(), tracing.SpanKindServer)
+		defer span.End()
+		span.SetAttribute("http.request.method", c.Method())
+		span.SetAttribute("url.path", c.Path())
+		if requestID, _ := c.Locals("request_id").(string); requestID != "" {
+			span.SetAttribute("openmodel.request_id", requestID)
+		}
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+		route := servedRoute(c)
+		status := responseStatus(c, err)
+		span.SetName(c.Method() + " " + route)
+		span.SetAttribute("http.route", route)
+		span.SetAttribute("http.response.status_code", status)
+		if status >= fiber.StatusInternalServerError {
+			span.SetError(fmt.Errorf("status %d", status))
+		}
+		return err
+	}
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/provider"
+	"github.com/macedot/openmodel/internal/state"
+	"github.com/macedot/openmodel/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exportedSpan is the part of an OTLP span the tests look at
+type exportedSpan struct {
+	TraceID      string `json:"traceId"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId"`
+	Name         string `json:"name"`
+	Status       struct {
+		Code int `json:"code"`
+	} `json:"status"`
+}
+
+// spanCollector records the spans of the OTLP export requests it receives
+type spanCollector struct {
+	mu    sync.Mutex
+	spans []exportedSpan
+}
+
+func (c *spanCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []exportedSpan `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			c.spans = append(c.spans, ss.Spans...)
+		}
+	}
+}
+
+func TestTracing_FailoverChainIsOneTrace(t *testing.T) {
+	const incoming = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	var propagated []string
+	var mu sync.Mutex
+	record := func(ctx context.Context) {
+		mu.Lock()
+		defer mu.Unlock()
+		propagated = append(propagated, tracing.Traceparent(ctx))
+	}
+	failing := &stubProvider{
+		name: "primary",
+		doStreamReqFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+			record(ctx)
+			return nil, &provider.StatusError{StatusCode: 503, Err: errors.New("overloaded")}
+		},
+	}
+	working := &stubProvider{
+		name: "secondary",
+		doStreamReqFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+			record(ctx)
+			return streamOf(
+				`data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4","choices":[{"index":0,"delta":{"content":"hi"},"finish_reason":"stop"}]}`,
+				SSEDataDone,
+			), nil
+		},
+	}
+	cfg := &config.Config{
+		Models: map[string]config.ModelConfig{
+			"gpt-4": {Strategy: "fallback", Providers: []config.ModelProvider{
+				{Provider: "primary", Model: "gpt-4"},
+				{Provider: "secondary", Model: "gpt-4"},
+			}},
+		},
+		Thresholds: config.ThresholdsConfig{FailuresBeforeSwitch: 1, InitialTimeout: 1000, MaxTimeout: 10000},
+	}
+	coll := &spanCollector{}
+	collector := httptest.NewServer(coll)
+	defer collector.Close()
+	srv := &Server{
+		config:    cfg,
+		providers: providerMap{"primary": failing, "secondary": working},
+		state:     state.New(),
+		tracer:    tracing.New(tracing.Config{Endpoint: collector.URL + "/v1/traces", ServiceName: "openmodel", SampleRatio: 1}),
+	}
+
+	app := fiber.New()
+	app.Use(srv.tracingMiddleware())
+	srv.registerRoutes(app)
+	req := httptest.NewRequest("POST", EndpointV1ChatCompletions,
+		strings.NewReader(`{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(tracing.HeaderTraceparent, incoming)
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	_, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	require.NoError(t, srv.tracer.Shutdown(context.Background()))
+
+	coll.mu.Lock()
+	defer coll.mu.Unlock()
+	byName := map[string][]exportedSpan{}
+	for _, span := range coll.spans {
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.TraceID, span.Name)
+		byName[span.Name] = append(byName[span.Name], span)
+	}
+	require.Len(t, byName["POST /v1/chat/completions"], 1)
+	server := byName["POST /v1/chat/completions"][0]
+	assert.Equal(t, "00f067aa0ba902b7", server.ParentSpanID)
+
+	primary, secondary := byName["backend primary/gpt-4"], byName["backend secondary/gpt-4"]
+	require.Len(t, primary, 1, "one span per backend attempt")
+	require.Len(t, secondary, 1, "one span per backend attempt")
+	assert.Equal(t, 2, primary[0].Status.Code, "the failed attempt is marked as an error")
+	assert.Zero(t, secondary[0].Status.Code)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, propagated, 2)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+primary[0].SpanID+"-01", propagated[0],
+		"backends receive the attempt span as their parent")
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+secondary[0].SpanID+"-01", propagated[1])
+}
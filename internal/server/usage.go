@@ -0,0 +1,106 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/api/openai"
+	applogger "github.com/macedot/openmodel/internal/logger"
+	"github.com/macedot/openmodel/internal/provider"
+	"github.com/macedot/openmodel/internal/usage"
+)
+
+// usageAttributionKey carries the usage attribution of a request in its context
+type usageAttributionKey struct{}
+
+// usageAttribution is what a request's token usage is accounted to besides its backend
+type usageAttribution struct {
+	model  string // Model the request was routed as
+	keyID  string // Id of the client API key, see usage.KeyID
+	tenant string // Tenant of the request, empty if it has none
+}
+
+// withUsageAttribution attaches the model, client API key and tenant the usage of a
+// request is accounted to
+func withUsageAttribution(ctx context.Context, model string, header func(string) string) context.Context {
+	tenant, _ := tenantFromContext(ctx)
+	return context.WithValue(ctx, usageAttributionKey{}, usageAttribution{model: model, keyID: clientKeyID(ctx, header), tenant: tenant.Name})
+}
+
+// SetUsageStore sets the store token usage is recorded in
+func (s *Server) SetUsageStore(store *usage.Store) {
+	s.usage = store
+}
+
+// usageAttributionFromContext returns the usage attribution of a request, empty if it has none
+func usageAttributionFromContext(ctx context.Context) usageAttribution {
+	attribution, _ := ctx.Value(usageAttributionKey{}).(usageAttribution)
+	return attribution
+}
+
+// accountUsage records the token usage and cost of a completed request. Failures are
+// logged: they do not fail the request.
+func (s *Server) accountUsage(ctx context.Context, providerKey string, u openai.Usage, cost float64) {
+	if s.usage == nil {
+		return
+	}
+	attribution := usageAttributionFromContext(ctx)
+	// The response has been produced by now, so a cancelled request is still accounted for
+	if err := s.usage.Add(context.WithoutCancel(ctx), attribution.model, providerKey, attribution.keyID, attribution.tenant, u.PromptTokens, u.CompletionTokens, cost); err != nil {
+		applogger.Warn("usage_record_failed", "request_id", provider.RequestIDFromContext(ctx), "provider", providerKey, "error", err)
+	}
+}
+
+// handleAdminUsage handles GET /admin/usage, reporting token usage as JSON or, with
+// format=csv, as a CSV export. The from, to (days, YYYY-MM-DD), model, backend, api_key
+// (key id) and tenant parameters filter it; group_by lists the columns kept apart.
+func (s *Server) handleAdminUsage(c *fiber.Ctx) error {
+	if status, err := s.authorizeAdmin(c); err != nil {
+		return handleError(c, err.Error(), status)
+	}
+	if s.usage == nil {
+		return handleError(c, "usage accounting is disabled", fiber.StatusNotFound)
+	}
+
+	filter := usage.Filter{
+		From:    c.Query("from"),
+		To:      c.Query("to"),
+		Model:   c.Query("model"),
+		Backend: c.Query("backend"),
+		APIKey:  c.Query("api_key"),
+		Tenant:  c.Query("tenant"),
+	}
+	for _, day := range []string{filter.From, filter.To} {
+		if _, err := time.Parse(usage.DayLayout, day); day != "" && err != nil {
+			return handleError(c, fmt.Sprintf("invalid day %q, expected YYYY-MM-DD", day), fiber.StatusBadRequest)
+		}
+	}
+	if groupBy := c.Query("group_by"); groupBy != "" {
+		filter.GroupBy = strings.Split(groupBy, ",")
+		for _, col := range filter.GroupBy {
+			if !slices.Contains(usage.Columns, col) {
+				return handleError(c, fmt.Sprintf("invalid group_by column %q, expected %s", col, strings.Join(usage.Columns, ", ")), fiber.StatusBadRequest)
+			}
+		}
+	}
+	format := c.Query("format", "json")
+	if format != "json" && format != "csv" {
+		return handleError(c, fmt.Sprintf("invalid format %q, expected json or csv", format), fiber.StatusBadRequest)
+	}
+
+	records, err := s.usage.Query(c.UserContext(), filter)
+	if err != nil {
+		return handleError(c, err.Error(), fiber.StatusInternalServerError)
+	}
+	if format == "csv" {
+		c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+		c.Set(fiber.HeaderContentDisposition, `attachment; filename="usage.csv"`)
+		return usage.WriteCSV(c, records)
+	}
+	return c.JSON(fiber.Map{"usage": records})
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/usage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminUsage(t *testing.T) {
+	prov := &stubProvider{
+		name: "ollama",
+		doRequestFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) ([]byte, error) {
+			return []byte(`{"id":"c1","object":"chat.completion","model":"gpt-4","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`), nil
+		},
+	}
+	srv := newStreamingTestServer(prov)
+	srv.config.Admin = &config.AdminConfig{Enabled: true, Token: "s3cret"}
+	srv.config.Providers = map[string]config.ProviderConfig{"ollama": {Pricing: map[string]config.ModelPrice{"*": {InputPerMillion: 1e6, OutputPerMillion: 2e6}}}}
+	app := fiber.New()
+	srv.registerRoutes(app)
+	send := func(path, token string) (int, http.Header, string) {
+		req := httptest.NewRequest("GET", path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, resp.Header, string(data)
+	}
+
+	status, _, _ := send(EndpointAdminUsage, "s3cret")
+	assert.Equal(t, fiber.StatusNotFound, status, "usage accounting is off unless enabled")
+
+	store, err := usage.Open(filepath.Join(t.TempDir(), "usage.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	srv.SetUsageStore(store)
+
+	for _, key := range []string{"sk-team-a", "sk-team-a", "sk-team-b"} {
+		req := httptest.NewRequest("POST", EndpointV1ChatCompletions, strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	}
+
+	today := time.Now().UTC().Format(usage.DayLayout)
+	status, _, body := send(EndpointAdminUsage+"?from="+today, "s3cret")
+	require.Equal(t, fiber.StatusOK, status)
+	var report struct {
+		Usage []usage.Record `json:"usage"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &report))
+	require.Len(t, report.Usage, 2)
+	for _, r := range report.Usage {
+		assert.Equal(t, "gpt-4", r.Model)
+		assert.Equal(t, "ollama/gpt-4", r.Backend)
+		assert.NotContains(t, r.APIKey, "sk-", "API keys are not stored")
+	}
+	byKey := map[string]usage.Record{report.Usage[0].APIKey: report.Usage[0], report.Usage[1].APIKey: report.Usage[1]}
+	assert.Equal(t, int64(2), byKey[usage.KeyID("sk-team-a")].Requests)
+	assert.Equal(t, int64(10), byKey[usage.KeyID("sk-team-a")].TotalTokens)
+	assert.Equal(t, 14.0, byKey[usage.KeyID("sk-team-a")].Cost)
+	assert.Equal(t, int64(1), byKey[usage.KeyID("sk-team-b")].Requests)
+
+	status, header, body := send(EndpointAdminUsage+"?group_by=model&format=csv", "s3cret")
+	require.Equal(t, fiber.StatusOK, status)
+	assert.Contains(t, header.Get("Content-Type"), "text/csv")
+	assert.Equal(t, "day,model,backend,api_key,tenant,requests,prompt_tokens,completion_tokens,total_tokens,cost\n,gpt-4,,,,3,9,6,15,21\n", body)
+
+	for _, tt := range []struct {
+		name       string
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{name: "no token", path: EndpointAdminUsage, wantStatus: fiber.StatusUnauthorized},
+		{name: "invalid day", path: EndpointAdminUsage + "?from=yesterday", token: "s3cret", wantStatus: fiber.StatusBadRequest},
+		{name: "invalid group", path: EndpointAdminUsage + "?group_by=provider", token: "s3cret", wantStatus: fiber.StatusBadRequest},
+		{name: "invalid format", path: EndpointAdminUsage + "?format=xml", token: "s3cret", wantStatus: fiber.StatusBadRequest},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _, _ := send(tt.path, tt.token)
+			assert.Equal(t, tt.wantStatus, status)
+		})
+	}
+}
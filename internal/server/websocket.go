@@ -0,0 +1,215 @@
+// Package server implements the HTTP server and handlers
+package server
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Minimal RFC 6455 server-side WebSocket support for the streaming chat endpoint.
+// Only what the endpoint needs is implemented: text/binary messages, fragmentation,
+// ping/pong and close. Extensions (e.g. permessage-deflate) are not negotiated.
+
+// websocketGUID is the fixed GUID used to derive Sec-WebSocket-Accept (RFC 6455 section 1.3)
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket opcodes
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+// wsMaxControlPayload is the largest payload of a control frame (RFC 6455 section 5.5)
+const wsMaxControlPayload = 125
+
+// WebSocket close status codes
+const (
+	wsCloseNormal        = 1000
+	wsCloseProtocolError = 1002
+	wsCloseTooBig        = 1009
+)
+
+// errWebSocketClosed is returned by readMessage when the peer closes the connection
+var errWebSocketClosed = errors.New("websocket closed")
+
+// websocketAcceptKey computes the Sec-WebSocket-Accept value for a client key
+func websocketAcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(strings.TrimSpace(key) + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// wsConn is a server-side WebSocket connection
+type wsConn struct {
+	conn       net.Conn
+	reader     *bufio.Reader
+	writeMu    sync.Mutex
+	maxMessage int64
+}
+
+func newWSConn(conn net.Conn, maxMessage int64) *wsConn {
+	return &wsConn{conn: conn, reader: bufio.NewReader(conn), maxMessage: maxMessage}
+}
+
+// readMessage reads the next complete data message, answering pings along the way
+func (ws *wsConn) readMessage() (opcode byte, payload []byte, err error) {
+	var message []byte
+	messageOp := byte(0)
+
+	for {
+		fin, op, data, err := ws.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case wsOpPing:
+			if err := ws.writeFrame(wsOpPong, data); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			_ = ws.writeFrame(wsOpClose, data)
+			return 0, nil, errWebSocketClosed
+		case wsOpText, wsOpBinary:
+			if messageOp != 0 {
+				return 0, nil, ws.fail(wsCloseProtocolError, "unexpected data frame inside fragmented message")
+			}
+			messageOp = op
+		case wsOpContinuation:
+			if messageOp == 0 {
+				return 0, nil, ws.fail(wsCloseProtocolError, "continuation frame without message")
+			}
+		default:
+			return 0, nil, ws.fail(wsCloseProtocolError, fmt.Sprintf("unknown opcode %d", op))
+		}
+
+		if int64(len(message)+len(data)) > ws.maxMessage {
+			return 0, nil, ws.fail(wsCloseTooBig, "message too big")
+		}
+		message = append(message, data...)
+		if fin {
+			return messageOp, message, nil
+		}
+	}
+}
+
+// readFrame reads a single frame and unmasks its payload
+func (ws *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(ws.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = header[0]&0x80 != 0
+	reserved := header[0] & 0x70
+	opcode = header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := int64(header[1] & 0x7F)
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+
+	// Clients must mask every frame (RFC 6455 section 5.1)
+	if !masked {
+		return false, 0, nil, ws.fail(wsCloseProtocolError, "client frames must be masked")
+	}
+	// No extension is negotiated, so the reserved bits must be clear (section 5.2)
+	if reserved != 0 {
+		return false, 0, nil, ws.fail(wsCloseProtocolError, "reserved bits set")
+	}
+	// Control frames are opcodes 0x8 and up, unfragmented and short (section 5.5)
+	if opcode&0x08 != 0 {
+		if !fin {
+			return false, 0, nil, ws.fail(wsCloseProtocolError, "fragmented control frame")
+		}
+		if length > wsMaxControlPayload {
+			return false, 0, nil, ws.fail(wsCloseProtocolError, "control frame too big")
+		}
+	}
+	if length < 0 || length > ws.maxMessage {
+		return false, 0, nil, ws.fail(wsCloseTooBig, "frame too big")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(ws.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(ws.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// writeFrame writes a single unmasked, final frame
+func (ws *wsConn) writeFrame(opcode byte, payload []byte) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+
+	header := make([]byte, 0, 10)
+	header = append(header, 0x80|opcode)
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	if _, err := ws.conn.Write(header); err != nil {
+		return err
+	}
+	_, err := ws.conn.Write(payload)
+	return err
+}
+
+// writeText writes a text message
+func (ws *wsConn) writeText(payload []byte) error {
+	return ws.writeFrame(wsOpText, payload)
+}
+
+// close sends a close frame with the given status and closes the connection
+func (ws *wsConn) close(code int, reason string) error {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	payload = append(payload, reason...)
+	_ = ws.writeFrame(wsOpClose, payload)
+	return ws.conn.Close()
+}
+
+// fail closes the connection with a protocol-level error and returns it
+func (ws *wsConn) fail(code int, reason string) error {
+	_ = ws.close(code, reason)
+	return fmt.Errorf("websocket: %s", reason)
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/macedot/openmodel/internal/config"
+	"github.com/macedot/openmodel/internal/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebsocketAcceptKey(t *testing.T) {
+	// Example from RFC 6455 section 1.3
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", websocketAcceptKey("dGhlIHNhbXBsZSBub25jZQ=="))
+}
+
+// writeClientFrame writes a masked, final client frame
+func writeClientFrame(t *testing.T, w io.Writer, opcode byte, payload []byte) {
+	t.Helper()
+	_, err := w.Write(clientFrame(0x80|opcode, payload))
+	require.NoError(t, err)
+}
+
+// clientFrame returns a masked client frame with the first header byte (FIN, RSV bits and
+// opcode) given
+func clientFrame(first byte, payload []byte) []byte {
+	frame := []byte{first}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, 0x80|byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	mask := make([]byte, 4)
+	_, _ = rand.Read(mask)
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+// readServerFrame reads an unmasked server frame
+func readServerFrame(t *testing.T, r *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	header := make([]byte, 2)
+	_, err := io.ReadFull(r, header)
+	require.NoError(t, err)
+	length := int(header[1] & 0x7F)
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		_, err = io.ReadFull(r, ext)
+		require.NoError(t, err)
+		length = int(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		_, err = io.ReadFull(r, ext)
+		require.NoError(t, err)
+		length = int(binary.BigEndian.Uint64(ext))
+	}
+	payload := make([]byte, length)
+	_, err = io.ReadFull(r, payload)
+	require.NoError(t, err)
+	return header[0] & 0x0F, payload
+}
+
+func TestHandleWSChat_StreamsChunks(t *testing.T) {
+	prov := &stubProvider{
+		name: "openai",
+		doStreamReqFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+			var req map[string]any
+			require.NoError(t, json.Unmarshal(body, &req))
+			assert.Equal(t, true, req["stream"])
+			return streamOf(
+				`data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4","choices":[{"index":0,"delta":{"content":"Hel"},"finish_reason":null}]}`,
+				``,
+				`data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4","choices":[{"index":0,"delta":{"content":"lo"},"finish_reason":"stop"}]}`,
+				SSEDataDone,
+			), nil
+		},
+	}
+	srv := newStreamingTestServer(prov)
+
+	app := fiber.New()
+	app.Get(EndpointWSV1Chat, srv.handleWSChat)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = app.Listener(ln) }()
+	defer func() { _ = app.Shutdown() }()
+
+	conn, err := net.DialTimeout("tcp", ln.Addr().String(), time.Second)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n", EndpointWSV1Chat)
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+
+	writeClientFrame(t, conn, wsOpText, []byte(`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`))
+
+	var content string
+	for {
+		opcode, payload := readServerFrame(t, reader)
+		require.Equal(t, byte(wsOpText), opcode)
+
+		var frame map[string]any
+		require.NoError(t, json.Unmarshal(payload, &frame))
+		if frame["type"] == "done" {
+			break
+		}
+		require.Equal(t, "chat.completion.chunk", frame["object"], string(payload))
+		choice := frame["choices"].([]any)[0].(map[string]any)
+		content += choice["delta"].(map[string]any)["content"].(string)
+	}
+	assert.Equal(t, "Hello", content)
+
+	// Unknown model reports an error event and keeps the socket open
+	writeClientFrame(t, conn, wsOpText, []byte(`{"model":"missing","messages":[{"role":"user","content":"hi"}]}`))
+	_, payload := readServerFrame(t, reader)
+	assert.JSONEq(t, `{"type":"error","error":"model \"missing\" not found"}`, string(payload))
+
+	// Ping is answered with pong
+	writeClientFrame(t, conn, wsOpPing, []byte("p"))
+	opcode, payload := readServerFrame(t, reader)
+	assert.Equal(t, byte(wsOpPong), opcode)
+	assert.Equal(t, "p", string(payload))
+
+	writeClientFrame(t, conn, wsOpClose, binary.BigEndian.AppendUint16(nil, wsCloseNormal))
+	opcode, _ = readServerFrame(t, reader)
+	assert.Equal(t, byte(wsOpClose), opcode)
+}
+
+func TestWSConn_ProtocolErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame []byte
+		want  string
+	}{
+		{name: "reserved bits", frame: clientFrame(0x80|0x40|wsOpText, []byte("hi")), want: "reserved bits set"},
+		{name: "fragmented ping", frame: clientFrame(wsOpPing, []byte("p")), want: "fragmented control frame"},
+		{name: "fragmented close", frame: clientFrame(wsOpClose, nil), want: "fragmented control frame"},
+		{name: "ping too big", frame: clientFrame(0x80|wsOpPing, make([]byte, wsMaxControlPayload+1)), want: "control frame too big"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer client.Close()
+			ws := newWSConn(server, 1024)
+			errs := make(chan error, 1)
+			go func() {
+				_, _, err := ws.readMessage()
+				errs <- err
+			}()
+			// The server stops reading at the error, so the rest of the frame may never be read
+			go func() { _, _ = client.Write(tt.frame) }()
+
+			opcode, payload := readServerFrame(t, bufio.NewReader(client))
+			assert.Equal(t, byte(wsOpClose), opcode)
+			require.GreaterOrEqual(t, len(payload), 2)
+			assert.Equal(t, uint16(wsCloseProtocolError), binary.BigEndian.Uint16(payload))
+			assert.Equal(t, tt.want, string(payload[2:]))
+			assert.EqualError(t, <-errs, "websocket: "+tt.want)
+		})
+	}
+
+	// A ping of the largest control payload is answered
+	server, client := net.Pipe()
+	defer client.Close()
+	go func() { _, _, _ = newWSConn(server, 1024).readMessage() }()
+	go func() { _, _ = client.Write(clientFrame(0x80|wsOpPing, make([]byte, wsMaxControlPayload))) }()
+	opcode, payload := readServerFrame(t, bufio.NewReader(client))
+	assert.Equal(t, byte(wsOpPong), opcode)
+	assert.Len(t, payload, wsMaxControlPayload)
+}
+
+func TestHandleWSChat_Credentials(t *testing.T) {
+	urls := make(chan string, 1)
+	prov := &stubProvider{
+		name: "openai",
+		doStreamReqFn: func(ctx context.Context, endpoint string, body []byte, headers map[string]string) (<-chan []byte, error) {
+			urls <- provider.OriginalURLFromContext(ctx)
+			return streamOf(
+				`data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4","choices":[{"index":0,"delta":{"content":"hi"},"finish_reason":"stop"}]}`,
+				SSEDataDone,
+			), nil
+		},
+	}
+	srv := newStreamingTestServer(prov)
+	srv.config.APIKeys = []config.APIKey{{Name: "browser", Key: "sk-browser"}}
+
+	app := fiber.New()
+	app.Use(websocketCredentialsMiddleware())
+	app.Use(srv.apiKeysMiddleware())
+	app.Get(EndpointWSV1Chat, srv.handleWSChat)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = app.Listener(ln) }()
+	defer func() { _ = app.Shutdown() }()
+
+	tests := []struct {
+		name         string
+		path         string
+		headers      string
+		want         int
+		wantProtocol string
+		wantURL      string
+	}{
+		{name: "no key", path: EndpointWSV1Chat, want: http.StatusUnauthorized},
+		{name: "header", path: EndpointWSV1Chat, headers: "Authorization: Bearer sk-browser\r\n", want: http.StatusSwitchingProtocols, wantURL: EndpointWSV1Chat},
+		{name: "subprotocol", path: EndpointWSV1Chat, headers: "Sec-WebSocket-Protocol: openmodel, openmodel.bearer.sk-browser\r\n",
+			want: http.StatusSwitchingProtocols, wantProtocol: "openmodel", wantURL: EndpointWSV1Chat},
+		{name: "subprotocol unknown key", path: EndpointWSV1Chat, headers: "Sec-WebSocket-Protocol: openmodel, openmodel.bearer.sk-other\r\n", want: http.StatusUnauthorized},
+		{name: "query", path: EndpointWSV1Chat + "?trace=1&api_key=sk-browser", want: http.StatusSwitchingProtocols, wantURL: EndpointWSV1Chat + "?trace=1"},
+		{name: "query unknown key", path: EndpointWSV1Chat + "?api_key=sk-other", want: http.StatusUnauthorized},
+		{name: "header wins over query", path: EndpointWSV1Chat + "?api_key=sk-other", headers: "Authorization: Bearer sk-browser\r\n",
+			want: http.StatusSwitchingProtocols, wantURL: EndpointWSV1Chat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.DialTimeout("tcp", ln.Addr().String(), time.Second)
+			require.NoError(t, err)
+			defer conn.Close()
+			require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+
+			fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+				"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n%s\r\n", tt.path, tt.headers)
+			reader := bufio.NewReader(conn)
+			resp, err := http.ReadResponse(reader, nil)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, resp.StatusCode)
+			if tt.want != http.StatusSwitchingProtocols {
+				return
+			}
+			assert.Equal(t, tt.wantProtocol, resp.Header.Get("Sec-WebSocket-Protocol"))
+
+			writeClientFrame(t, conn, wsOpText, []byte(`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`))
+			for {
+				_, payload := readServerFrame(t, reader)
+				if strings.Contains(string(payload), `"type":"done"`) {
+					break
+				}
+			}
+			assert.Equal(t, tt.wantURL, <-urls, "the api_key query parameter is not passed on")
+		})
+	}
+}
@@ -0,0 +1,426 @@
+// Package state manages failure tracking and model availability
+package state
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// redisDialTimeout bounds connecting to Redis when the caller's context has no deadline
+	redisDialTimeout = 2 * time.Second
+	// redisPoolSize is the most connections open to Redis at once
+	redisPoolSize = 8
+	// redisMinBackoff and redisMaxBackoff bound the wait before reconnecting after a
+	// connection failure, doubling with each failure in a row
+	redisMinBackoff = 500 * time.Millisecond
+	redisMaxBackoff = 30 * time.Second
+)
+
+// errRedisBackoff is returned at once, without contacting Redis, while reconnecting after
+// a failure is backed off, so callers fall back to local state
+var errRedisBackoff = errors.New("redis: unavailable, waiting to reconnect")
+
+// RedisStore is a Store backed by Redis, speaking RESP over a small pool of connections.
+// Counters are plain keys and backend health lives in one hash, all under a prefix.
+type RedisStore struct {
+	addr     string
+	username string
+	password string
+	db       int
+	useTLS   bool
+	prefix   string
+
+	slots chan struct{}   // One per connection in use, bounding the pool
+	idle  chan *redisConn // Open connections ready for reuse
+
+	mu        sync.Mutex // Guards the fields below
+	backoff   time.Duration
+	downUntil time.Time // Calls fail at once until then
+	closed    bool
+}
+
+// redisConn is one connection to Redis
+type redisConn struct {
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+// redisError is an error reply from the server
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// redisHealth is the JSON form of Health stored in the health hash
+type redisHealth struct {
+	OpenedAtMs int64 `json:"opened_at_ms"`
+	CooldownMs int64 `json:"cooldown_ms"`
+}
+
+// NewRedisStore creates a store for a redis:// or rediss:// URL. Connections are made on
+// first use and re-established after errors, backing off while Redis cannot be reached.
+func NewRedisStore(rawURL, prefix string) (*RedisStore, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %w", err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("invalid redis url scheme %q (must be redis or rediss)", u.Scheme)
+	}
+
+	r := &RedisStore{
+		addr:   u.Host,
+		useTLS: u.Scheme == "rediss",
+		prefix: prefix + ":",
+		slots:  make(chan struct{}, redisPoolSize),
+		idle:   make(chan *redisConn, redisPoolSize),
+	}
+	if u.Port() == "" {
+		r.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		r.password, _ = u.User.Password()
+		if r.password == "" {
+			r.password = u.User.Username()
+		} else {
+			r.username = u.User.Username()
+		}
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if r.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid redis database %q: %w", db, err)
+		}
+	}
+	return r, nil
+}
+
+// Incr increments a counter, refreshing its expiry
+func (r *RedisStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	cmds := [][]string{{"INCR", r.prefix + key}}
+	if ttl > 0 {
+		cmds = append(cmds, []string{"PEXPIRE", r.prefix + key, strconv.FormatInt(ttl.Milliseconds(), 10)})
+	}
+	replies, err := r.pipeline(ctx, cmds...)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := replies[0].(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected INCR reply %v", replies[0])
+	}
+	return n, nil
+}
+
+// Delete removes counters
+func (r *RedisStore) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	args := []string{"DEL"}
+	for _, key := range keys {
+		args = append(args, r.prefix+key)
+	}
+	_, err := r.pipeline(ctx, args)
+	return err
+}
+
+// SetHealth publishes a backend's health
+func (r *RedisStore) SetHealth(ctx context.Context, backend string, h Health) error {
+	data, err := json.Marshal(redisHealth{OpenedAtMs: h.OpenedAt.UnixMilli(), CooldownMs: h.Cooldown.Milliseconds()})
+	if err != nil {
+		return fmt.Errorf("failed to encode health: %w", err)
+	}
+	_, err = r.pipeline(ctx, []string{"HSET", r.healthKey(), backend, string(data)})
+	return err
+}
+
+// ClearHealth removes a backend's health
+func (r *RedisStore) ClearHealth(ctx context.Context, backend string) error {
+	_, err := r.pipeline(ctx, []string{"HDEL", r.healthKey(), backend})
+	return err
+}
+
+// Health returns every published backend health
+func (r *RedisStore) Health(ctx context.Context) (map[string]Health, error) {
+	replies, err := r.pipeline(ctx, []string{"HGETALL", r.healthKey()})
+	if err != nil {
+		return nil, err
+	}
+	fields, ok := replies[0].([]any)
+	if !ok || len(fields)%2 != 0 {
+		return nil, fmt.Errorf("redis: unexpected HGETALL reply %v", replies[0])
+	}
+
+	health := make(map[string]Health, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		backend, _ := fields[i].(string)
+		value, _ := fields[i+1].(string)
+		var h redisHealth
+		if err := json.Unmarshal([]byte(value), &h); err != nil {
+			continue // Skip entries written by incompatible versions
+		}
+		health[backend] = Health{
+			OpenedAt: time.UnixMilli(h.OpenedAtMs),
+			Cooldown: time.Duration(h.CooldownMs) * time.Millisecond,
+		}
+	}
+	return health, nil
+}
+
+// Close closes the idle connections; those in use are closed when their call returns
+func (r *RedisStore) Close() error {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+	var err error
+	for {
+		select {
+		case c := <-r.idle:
+			if cerr := c.conn.Close(); err == nil {
+				err = cerr
+			}
+		default:
+			return err
+		}
+	}
+}
+
+// healthKey is the hash holding backend health
+func (r *RedisStore) healthKey() string {
+	return r.prefix + "health"
+}
+
+// pipeline sends commands on a pooled connection and reads one reply per command. Waiting
+// for a connection is bounded by ctx. Error replies are returned as errors; connection
+// errors drop the connection and back off reconnecting, failing calls at once meanwhile.
+func (r *RedisStore) pipeline(ctx context.Context, cmds ...[]string) ([]any, error) {
+	if err := r.checkBackoff(); err != nil {
+		return nil, err
+	}
+	select {
+	case r.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("redis: waiting for a connection: %w", ctx.Err())
+	}
+	defer func() { <-r.slots }()
+
+	c, err := r.get(ctx)
+	if err != nil {
+		r.markDown()
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		c.conn.SetDeadline(deadline)
+	} else {
+		c.conn.SetDeadline(time.Time{})
+	}
+
+	replies, err := c.roundTrip(cmds)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		c.conn.Close()
+		r.markDown()
+		return nil, err
+	}
+	r.markUp()
+	r.put(c)
+	if err != nil {
+		return nil, err
+	}
+	return replies, nil
+}
+
+// checkBackoff fails while reconnecting is backed off
+func (r *RedisStore) checkBackoff() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Now().Before(r.downUntil) {
+		return errRedisBackoff
+	}
+	return nil
+}
+
+// markDown backs off reconnecting after a connection failure, doubling the wait with each
+// failure in a row
+func (r *RedisStore) markDown() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.backoff = min(max(2*r.backoff, redisMinBackoff), redisMaxBackoff)
+	r.downUntil = time.Now().Add(r.backoff)
+}
+
+// markUp resets the backoff after a successful call
+func (r *RedisStore) markUp() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.backoff = 0
+}
+
+// get returns an idle connection, or a new one
+func (r *RedisStore) get(ctx context.Context) (*redisConn, error) {
+	select {
+	case c := <-r.idle:
+		return c, nil
+	default:
+		return r.connect(ctx)
+	}
+}
+
+// put returns a connection to the pool, or closes it once the store is closed
+func (r *RedisStore) put(c *redisConn) {
+	r.mu.Lock()
+	closed := r.closed
+	r.mu.Unlock()
+	if closed {
+		c.conn.Close()
+		return
+	}
+	select {
+	case r.idle <- c:
+	default:
+		c.conn.Close()
+	}
+}
+
+// connect dials Redis, authenticates and selects the database
+func (r *RedisStore) connect(ctx context.Context) (*redisConn, error) {
+	dialer := &net.Dialer{Timeout: redisDialTimeout}
+	var (
+		conn net.Conn
+		err  error
+	)
+	if r.useTLS {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{MinVersion: tls.VersionTLS12}}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", r.addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", r.addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	c := &redisConn{conn: conn, rd: bufio.NewReader(conn)}
+
+	var setup [][]string
+	if r.password != "" {
+		if r.username != "" {
+			setup = append(setup, []string{"AUTH", r.username, r.password})
+		} else {
+			setup = append(setup, []string{"AUTH", r.password})
+		}
+	}
+	if r.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(r.db)})
+	}
+	if len(setup) == 0 {
+		return c, nil
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := c.roundTrip(setup); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to set up redis connection: %w", err)
+	}
+	return c, nil
+}
+
+// roundTrip writes commands and reads their replies
+func (c *redisConn) roundTrip(cmds [][]string) ([]any, error) {
+	var buf strings.Builder
+	for _, args := range cmds {
+		fmt.Fprintf(&buf, "*%d\r\n", len(args))
+		for _, arg := range args {
+			fmt.Fprintf(&buf, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	if _, err := io.WriteString(c.conn, buf.String()); err != nil {
+		return nil, fmt.Errorf("redis write failed: %w", err)
+	}
+
+	replies := make([]any, len(cmds))
+	var firstErr error
+	for i := range cmds {
+		reply, err := readRESP(c.rd)
+		if err != nil {
+			var replyErr redisError
+			if !errors.As(err, &replyErr) {
+				return nil, err
+			}
+			// Keep reading so the connection stays in sync
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		replies[i] = reply
+	}
+	return replies, firstErr
+}
+
+// readRESP reads one reply: simple strings and bulk strings as string, integers as
+// int64, arrays as []any, nil replies as nil, and error replies as redisError
+func readRESP(rd *bufio.Reader) (any, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("redis read failed: %w", err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		n, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid integer reply %q", line)
+		}
+		return n, nil
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid bulk length %q", line)
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(rd, data); err != nil {
+			return nil, fmt.Errorf("redis read failed: %w", err)
+		}
+		return string(data[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid array length %q", line)
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		items := make([]any, count)
+		for i := range items {
+			if items[i], err = readRESP(rd); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
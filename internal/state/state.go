@@ -4,6 +4,7 @@ package state
 import (
 	"math/rand"
 	"sync"
+	"time"
 )
 
 // State manages model failure tracking
@@ -11,31 +12,180 @@ type State struct {
 	mu                sync.RWMutex
 	failureCounts     map[string]int
 	unavailableModels map[string]bool
-	currentTimeout    int
-	cycle             int
-	roundRobinIndex   map[string]int // Tracks round-robin position per model
-	rand              *rand.Rand     // Reusable random generator
+	lastFailure       map[string]time.Time      // When each backend last failed (failure window)
+	openedAt          map[string]time.Time      // When a backend became unavailable or was last probed
+	cooldowns         map[string]time.Duration  // Current progressive cooldown per unavailable backend
+	probing           map[string]bool           // Backends with an outstanding half-open probe
+	roundRobinIndex   map[string]int            // Tracks round-robin position per model
+	inFlight          map[string]int            // Tracks concurrent requests per provider
+	rand              *rand.Rand                // Reusable random generator
+	store             Store                     // Optional store shared with other instances
+	shared            map[string]time.Time      // When each open backend was last known to be in the store
+	weights           map[string]map[string]int // Runtime weight overrides per model, by backend
+	outcomes          map[string][]outcome      // Rolling sample of recent requests (error-rate policy)
+	disabled          map[string]bool           // Backends taken out of rotation by an operator
+}
+
+// outcome is one request in a backend's rolling sample
+type outcome struct {
+	at     time.Time
+	failed bool
+}
+
+// Policy controls failure counting and recovery for one backend
+type Policy struct {
+	Threshold   int           // Failures within Window before the backend is taken out of rotation
+	Window      time.Duration // Failures older than this are forgotten (0 keeps them until reset)
+	Cooldown    time.Duration // First cooldown once unavailable (0 disables recovery)
+	MaxCooldown time.Duration // Cap for cooldowns, which double after each failed probe (0 means no cap)
+
+	// ErrorRate, when above 0, replaces Threshold: the backend is taken out of rotation
+	// when more than this fraction of its last RateRequests requests within RateWindow
+	// failed, once the sample holds at least RateMinRequests requests.
+	ErrorRate       float64
+	RateRequests    int
+	RateMinRequests int
+	RateWindow      time.Duration
 }
 
 // New creates a new State
-func New(initialTimeout int) *State {
+func New() *State {
 	return &State{
 		failureCounts:     make(map[string]int),
 		unavailableModels: make(map[string]bool),
-		currentTimeout:    initialTimeout,
+		lastFailure:       make(map[string]time.Time),
+		openedAt:          make(map[string]time.Time),
+		cooldowns:         make(map[string]time.Duration),
+		probing:           make(map[string]bool),
 		roundRobinIndex:   make(map[string]int),
+		inFlight:          make(map[string]int),
 		rand:              rand.New(rand.NewSource(1)), // Seeded for reproducibility
+		shared:            make(map[string]time.Time),
+		weights:           make(map[string]map[string]int),
+		outcomes:          make(map[string][]outcome),
+		disabled:          make(map[string]bool),
 	}
 }
 
-// RecordFailure records a failure for a model
-func (s *State) RecordFailure(model string, threshold int) {
+// RecordFailure records a failure for a backend. Reaching the policy threshold within
+// its window makes the backend unavailable for the policy cooldown; a failed half-open
+// probe doubles the cooldown up to the policy maximum. With a store the failure counts
+// of all instances are combined.
+func (s *State) RecordFailure(model string, policy Policy) {
+	shared := s.countSharedFailure(model, policy.Window)
+
 	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.failureCounts[model]++
-	if s.failureCounts[model] >= threshold {
-		s.unavailableModels[model] = true
+	opened := s.recordFailureLocked(model, policy, shared)
+	health := Health{OpenedAt: s.openedAt[model], Cooldown: s.cooldowns[model]}
+	s.mu.Unlock()
+
+	if opened {
+		s.publish(model, health)
+	}
+}
+
+// recordFailureLocked counts a failure and reports whether the backend was (re-)opened
+func (s *State) recordFailureLocked(model string, policy Policy, shared int) bool {
+	now := time.Now()
+	var trip bool
+	if policy.ErrorRate > 0 {
+		trip = s.recordOutcomeLocked(model, policy, now, true)
+	} else {
+		if policy.Window > 0 && !s.unavailableModels[model] && now.Sub(s.lastFailure[model]) > policy.Window {
+			s.failureCounts[model] = 0
+		}
+		s.failureCounts[model] = max(s.failureCounts[model]+1, shared)
+		trip = s.failureCounts[model] >= policy.Threshold
+	}
+	s.lastFailure[model] = now
+	// A failed probe re-opens the backend whatever the failure count or rate
+	if !trip && !s.probing[model] {
+		return false
+	}
+
+	switch {
+	case !s.unavailableModels[model]:
+		s.cooldowns[model] = policy.Cooldown
+	case s.probing[model]:
+		next := 2 * s.cooldowns[model]
+		if policy.MaxCooldown > 0 {
+			next = min(next, policy.MaxCooldown)
+		}
+		s.cooldowns[model] = next
+	default:
+		// Late failure of a request sent before the backend became unavailable
+		return false
 	}
+	s.unavailableModels[model] = true
+	s.openedAt[model] = now
+	delete(s.probing, model)
+	return true
+}
+
+// recordOutcomeLocked adds a request to the backend's rolling sample, dropping requests
+// beyond the sample size or older than the window, and reports whether the share of
+// failures in the sample exceeds the policy error rate
+func (s *State) recordOutcomeLocked(model string, policy Policy, now time.Time, failed bool) bool {
+	sample := append(s.outcomes[model], outcome{at: now, failed: failed})
+	start := 0
+	if policy.RateRequests > 0 {
+		start = max(len(sample)-policy.RateRequests, 0)
+	}
+	for policy.RateWindow > 0 && start < len(sample) && now.Sub(sample[start].at) > policy.RateWindow {
+		start++
+	}
+	sample = sample[start:]
+	s.outcomes[model] = sample
+
+	failures := 0
+	for _, o := range sample {
+		if o.failed {
+			failures++
+		}
+	}
+	return len(sample) >= policy.RateMinRequests && float64(failures) > policy.ErrorRate*float64(len(sample))
+}
+
+// RecordSuccess records a successful request to a backend. A backend out of rotation
+// (e.g. after a successful probe) is reset as by ResetModel. Under the error-rate policy
+// the success otherwise joins the rolling sample, so earlier failures still count;
+// without it the failure count is reset.
+func (s *State) RecordSuccess(model string, policy Policy) {
+	if policy.ErrorRate <= 0 {
+		s.ResetModel(model)
+		return
+	}
+	s.mu.Lock()
+	failed := s.unavailableModels[model]
+	if failed {
+		s.resetLocked(model)
+	} else {
+		s.recordOutcomeLocked(model, policy, time.Now(), false)
+	}
+	s.mu.Unlock()
+
+	if failed {
+		s.clearShared(model)
+	}
+}
+
+// Suspend takes a backend out of rotation for d without counting a failure (e.g. when
+// it is rate limited); afterwards it receives a half-open probe like any failed backend.
+func (s *State) Suspend(model string, d time.Duration) {
+	now := time.Now()
+	s.mu.Lock()
+	s.unavailableModels[model] = true
+	s.openedAt[model] = now
+	s.cooldowns[model] = d
+	delete(s.probing, model)
+	s.mu.Unlock()
+
+	s.publish(model, Health{OpenedAt: now, Cooldown: d})
+}
+
+// Disable takes a backend out of rotation until it is reset (e.g. bad credentials)
+func (s *State) Disable(model string) {
+	s.Suspend(model, 0)
 }
 
 // IsAvailable checks if a model is available
@@ -48,30 +198,166 @@ func (s *State) IsAvailable(model string, threshold int) bool {
 	return s.failureCounts[model] < threshold
 }
 
-// ResetModel resets a model's failure count
-func (s *State) ResetModel(model string) {
+// Allow reports whether a request may be sent to a backend (circuit breaker).
+// An unavailable backend becomes half-open once its cooldown has elapsed and lets a
+// single probe request through per cooldown window: ResetModel after a successful probe
+// makes it available again, while RecordFailure re-opens it with a longer cooldown.
+func (s *State) Allow(model string, policy Policy) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	delete(s.failureCounts, model)
-	delete(s.unavailableModels, model)
+	if !s.admitsLocked(model, policy) {
+		return false
+	}
+	if s.unavailableModels[model] {
+		s.openedAt[model] = time.Now()
+		s.probing[model] = true
+	}
+	return true
+}
+
+// Admits reports whether Allow would let a request through to a backend, without taking
+// the probe of a half-open backend
+func (s *State) Admits(model string, policy Policy) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.admitsLocked(model, policy)
+}
+
+// admitsLocked reports whether a request may be sent to a backend
+func (s *State) admitsLocked(model string, policy Policy) bool {
+	if !s.unavailableModels[model] {
+		// Under the error-rate policy failures are sampled, not counted
+		return policy.ErrorRate > 0 || s.failureCounts[model] < policy.Threshold
+	}
+	cooldown := s.cooldowns[model]
+	return cooldown > 0 && time.Since(s.openedAt[model]) >= cooldown
+}
+
+// RetryAfter returns how long until an unavailable backend is probed again (0 when it
+// is available or due). ok is false when the backend does not recover on its own.
+func (s *State) RetryAfter(model string) (wait time.Duration, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.unavailableModels[model] {
+		return 0, true
+	}
+	cooldown := s.cooldowns[model]
+	if cooldown <= 0 {
+		return 0, false
+	}
+	return max(cooldown-time.Since(s.openedAt[model]), 0), true
+}
+
+// Circuit breaker states reported by Circuit
+const (
+	CircuitClosed   = "closed"    // In rotation
+	CircuitOpen     = "open"      // Out of rotation until its cooldown elapses
+	CircuitHalfOpen = "half_open" // Cooldown elapsed or probe outstanding
+)
+
+// Circuit returns the circuit breaker state of a backend without probing it
+func (s *State) Circuit(model string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.circuitLocked(model)
+}
+
+// circuitLocked returns the circuit breaker state of a backend
+func (s *State) circuitLocked(model string) string {
+	if !s.unavailableModels[model] {
+		return CircuitClosed
+	}
+	cooldown := s.cooldowns[model]
+	if s.probing[model] || (cooldown > 0 && time.Since(s.openedAt[model]) >= cooldown) {
+		return CircuitHalfOpen
+	}
+	return CircuitOpen
+}
+
+// Snapshot describes what is known about a backend's failures
+type Snapshot struct {
+	Circuit        string
+	Failures       int           // Failures counted in the current window
+	LastFailure    time.Time     // Zero when it has not failed since its last reset
+	OpenedAt       time.Time     // When it was taken out of rotation or last probed, zero when in rotation
+	Cooldown       time.Duration // Current progressive cooldown, 0 when in rotation or not recovering on its own
+	Probing        bool          // A half-open probe request is outstanding
+	Requests       int           // Requests in the rolling sample (error-rate policy)
+	FailedRequests int           // Failed requests in the rolling sample
+}
+
+// Snapshot returns what is known about a backend's failures, without probing it
+func (s *State) Snapshot(model string) Snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snap := Snapshot{
+		Circuit:     s.circuitLocked(model),
+		Failures:    s.failureCounts[model],
+		LastFailure: s.lastFailure[model],
+		Probing:     s.probing[model],
+		Requests:    len(s.outcomes[model]),
+	}
+	if s.unavailableModels[model] {
+		snap.OpenedAt = s.openedAt[model]
+		snap.Cooldown = s.cooldowns[model]
+	}
+	for _, o := range s.outcomes[model] {
+		if o.failed {
+			snap.FailedRequests++
+		}
+	}
+	return snap
 }
 
-// GetProgressiveTimeout returns the current progressive timeout
-func (s *State) GetProgressiveTimeout() int {
+// Failures returns the failures counted against a backend in its current window
+func (s *State) Failures(model string) int {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.currentTimeout
+	return s.failureCounts[model]
 }
 
-// IncrementTimeout doubles the timeout (up to max)
-func (s *State) IncrementTimeout(max int) {
+// SetEnabled takes a backend out of rotation or puts it back. Unlike Disable this is not
+// failure tracking: a disabled backend stays out whatever its failures, and ResetModel
+// does not enable it.
+func (s *State) SetEnabled(model string, enabled bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.currentTimeout *= 2
-	if s.currentTimeout > max {
-		s.currentTimeout = max
+	if enabled {
+		delete(s.disabled, model)
+	} else {
+		s.disabled[model] = true
 	}
-	s.cycle++
+}
+
+// Enabled reports whether a backend is in rotation as far as SetEnabled is concerned
+func (s *State) Enabled(model string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return !s.disabled[model]
+}
+
+// ResetModel resets a model's failure count, also in the store when it had failed
+func (s *State) ResetModel(model string) {
+	s.mu.Lock()
+	failed := s.failureCounts[model] > 0 || s.unavailableModels[model]
+	s.resetLocked(model)
+	s.mu.Unlock()
+
+	if failed {
+		s.clearShared(model)
+	}
+}
+
+// resetLocked forgets everything known about a backend's failures
+func (s *State) resetLocked(model string) {
+	delete(s.shared, model)
+	delete(s.failureCounts, model)
+	delete(s.unavailableModels, model)
+	delete(s.lastFailure, model)
+	delete(s.openedAt, model)
+	delete(s.cooldowns, model)
+	delete(s.probing, model)
+	delete(s.outcomes, model)
 }
 
 // NextRoundRobin returns the next index for round-robin selection for a model
@@ -99,6 +385,86 @@ func (s *State) GetRandomIndex(total int) int {
 	return s.rand.Intn(total)
 }
 
+// GetWeightedIndex returns an index chosen with probability proportional to its weight.
+// Non-positive weights are treated as 1.
+func (s *State) GetWeightedIndex(weights []int) int {
+	if len(weights) <= 1 {
+		return 0
+	}
+	total := 0
+	for _, w := range weights {
+		total += max(w, 1)
+	}
+	s.mu.Lock()
+	n := s.rand.Intn(total)
+	s.mu.Unlock()
+	for i, w := range weights {
+		n -= max(w, 1)
+		if n < 0 {
+			return i
+		}
+	}
+	return len(weights) - 1
+}
+
+// SetWeights replaces the runtime weight overrides of a model's backends. Backends
+// without an override keep their configured weight.
+func (s *State) SetWeights(model string, weights map[string]int) {
+	overrides := make(map[string]int, len(weights))
+	for backend, w := range weights {
+		overrides[backend] = w
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.weights[model] = overrides
+}
+
+// Weights returns a copy of the runtime weight overrides of a model, nil if there are none
+func (s *State) Weights(model string) map[string]int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.weights[model] == nil {
+		return nil
+	}
+	weights := make(map[string]int, len(s.weights[model]))
+	for backend, w := range s.weights[model] {
+		weights[backend] = w
+	}
+	return weights
+}
+
+// ClearWeights drops the runtime weight overrides of a model
+func (s *State) ClearWeights(model string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.weights, model)
+}
+
+// AcquireInFlight records the start of a request to a provider
+func (s *State) AcquireInFlight(provider string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight[provider]++
+}
+
+// ReleaseInFlight records the end of a request to a provider
+func (s *State) ReleaseInFlight(provider string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.inFlight[provider] <= 1 {
+		delete(s.inFlight, provider)
+		return
+	}
+	s.inFlight[provider]--
+}
+
+// InFlight returns the number of requests currently in flight to a provider
+func (s *State) InFlight(provider string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.inFlight[provider]
+}
+
 // ResetRoundRobin resets the round-robin index for a model
 func (s *State) ResetRoundRobin(model string) {
 	s.mu.Lock()
@@ -3,43 +3,26 @@ package state
 import (
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestNew(t *testing.T) {
-	tests := []struct {
-		name           string
-		initialTimeout int
-		wantTimeout    int
-	}{
-		{"zero initial timeout", 0, 0},
-		{"positive initial timeout", 1000, 1000},
-		{"large initial timeout", 300000, 300000},
-	}
+	s := New()
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			s := New(tt.initialTimeout)
-
-			if s == nil {
-				t.Fatal("New() returned nil")
-			}
-
-			if s.failureCounts == nil {
-				t.Error("failureCounts map not initialized")
-			}
+	if s == nil {
+		t.Fatal("New() returned nil")
+	}
 
-			if s.unavailableModels == nil {
-				t.Error("unavailableModels map not initialized")
-			}
+	if s.failureCounts == nil {
+		t.Error("failureCounts map not initialized")
+	}
 
-			if s.currentTimeout != tt.wantTimeout {
-				t.Errorf("currentTimeout = %d, want %d", s.currentTimeout, tt.wantTimeout)
-			}
+	if s.unavailableModels == nil {
+		t.Error("unavailableModels map not initialized")
+	}
 
-			if s.cycle != 0 {
-				t.Errorf("cycle = %d, want 0", s.cycle)
-			}
-		})
+	if s.cooldowns == nil {
+		t.Error("cooldowns map not initialized")
 	}
 }
 
@@ -88,10 +71,10 @@ func TestRecordFailure(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := New(1000)
+			s := New()
 
 			for i := 0; i < tt.numFailures; i++ {
-				s.RecordFailure(tt.model, tt.threshold)
+				s.RecordFailure(tt.model, Policy{Threshold: tt.threshold})
 			}
 
 			if s.IsAvailable(tt.model, tt.threshold) != tt.wantAvailable {
@@ -110,12 +93,12 @@ func TestRecordFailure(t *testing.T) {
 }
 
 func TestRecordFailureMultipleModels(t *testing.T) {
-	s := New(1000)
+	s := New()
 
-	s.RecordFailure("model-a", 2)
-	s.RecordFailure("model-a", 2)
-	s.RecordFailure("model-b", 3)
-	s.RecordFailure("model-c", 2)
+	s.RecordFailure("model-a", Policy{Threshold: 2})
+	s.RecordFailure("model-a", Policy{Threshold: 2})
+	s.RecordFailure("model-b", Policy{Threshold: 3})
+	s.RecordFailure("model-c", Policy{Threshold: 2})
 
 	if s.IsAvailable("model-a", 2) {
 		t.Error("model-a should be unavailable after 2 failures (threshold 2)")
@@ -129,7 +112,7 @@ func TestRecordFailureMultipleModels(t *testing.T) {
 		t.Error("model-c should be available (only 1 failure, threshold 2)")
 	}
 
-	s.RecordFailure("model-c", 2)
+	s.RecordFailure("model-c", Policy{Threshold: 2})
 	if s.IsAvailable("model-c", 2) {
 		t.Error("model-c should be unavailable after 2 failures (threshold 2)")
 	}
@@ -153,8 +136,8 @@ func TestIsAvailable(t *testing.T) {
 		{
 			name: "model with failures below threshold",
 			setup: func(s *State) {
-				s.RecordFailure("model-a", 3)
-				s.RecordFailure("model-a", 3)
+				s.RecordFailure("model-a", Policy{Threshold: 3})
+				s.RecordFailure("model-a", Policy{Threshold: 3})
 			},
 			model:     "model-a",
 			threshold: 3,
@@ -163,9 +146,9 @@ func TestIsAvailable(t *testing.T) {
 		{
 			name: "model at failure threshold",
 			setup: func(s *State) {
-				s.RecordFailure("model-a", 3)
-				s.RecordFailure("model-a", 3)
-				s.RecordFailure("model-a", 3)
+				s.RecordFailure("model-a", Policy{Threshold: 3})
+				s.RecordFailure("model-a", Policy{Threshold: 3})
+				s.RecordFailure("model-a", Policy{Threshold: 3})
 			},
 			model:     "model-a",
 			threshold: 3,
@@ -186,7 +169,7 @@ func TestIsAvailable(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := New(1000)
+			s := New()
 			tt.setup(s)
 
 			got := s.IsAvailable(tt.model, tt.threshold)
@@ -208,8 +191,8 @@ func TestResetModel(t *testing.T) {
 		{
 			name: "reset model with failures",
 			setup: func(s *State) {
-				s.RecordFailure("model-a", 3)
-				s.RecordFailure("model-a", 3)
+				s.RecordFailure("model-a", Policy{Threshold: 3})
+				s.RecordFailure("model-a", Policy{Threshold: 3})
 			},
 			model:         "model-a",
 			wantAvailable: true,
@@ -218,9 +201,9 @@ func TestResetModel(t *testing.T) {
 		{
 			name: "reset unavailable model",
 			setup: func(s *State) {
-				s.RecordFailure("model-a", 3)
-				s.RecordFailure("model-a", 3)
-				s.RecordFailure("model-a", 3)
+				s.RecordFailure("model-a", Policy{Threshold: 3})
+				s.RecordFailure("model-a", Policy{Threshold: 3})
+				s.RecordFailure("model-a", Policy{Threshold: 3})
 			},
 			model:         "model-a",
 			wantAvailable: true,
@@ -229,7 +212,7 @@ func TestResetModel(t *testing.T) {
 		{
 			name: "reset non-existent model",
 			setup: func(s *State) {
-				s.RecordFailure("model-a", 3)
+				s.RecordFailure("model-a", Policy{Threshold: 3})
 			},
 			model:         "model-b",
 			wantAvailable: true,
@@ -239,7 +222,7 @@ func TestResetModel(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := New(1000)
+			s := New()
 			tt.setup(s)
 
 			s.ResetModel(tt.model)
@@ -259,129 +242,8 @@ func TestResetModel(t *testing.T) {
 	}
 }
 
-func TestGetProgressiveTimeout(t *testing.T) {
-	tests := []struct {
-		name           string
-		initialTimeout int
-		setup          func(*State)
-		want           int
-	}{
-		{
-			name:           "initial timeout",
-			initialTimeout: 1000,
-			setup:          func(s *State) {},
-			want:           1000,
-		},
-		{
-			name:           "after increment",
-			initialTimeout: 1000,
-			setup: func(s *State) {
-				s.IncrementTimeout(10000)
-			},
-			want: 2000,
-		},
-		{
-			name:           "after multiple increments",
-			initialTimeout: 1000,
-			setup: func(s *State) {
-				s.IncrementTimeout(10000)
-				s.IncrementTimeout(10000)
-				s.IncrementTimeout(10000)
-			},
-			want: 8000,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			s := New(tt.initialTimeout)
-			tt.setup(s)
-
-			got := s.GetProgressiveTimeout()
-			if got != tt.want {
-				t.Errorf("GetProgressiveTimeout() = %d, want %d", got, tt.want)
-			}
-		})
-	}
-}
-
-func TestIncrementTimeout(t *testing.T) {
-	tests := []struct {
-		name           string
-		initialTimeout int
-		increments     int
-		maxTimeout     int
-		wantTimeout    int
-		wantCycle      int
-	}{
-		{
-			name:           "single increment",
-			initialTimeout: 1000,
-			increments:     1,
-			maxTimeout:     10000,
-			wantTimeout:    2000,
-			wantCycle:      1,
-		},
-		{
-			name:           "double reaches max",
-			initialTimeout: 5000,
-			increments:     1,
-			maxTimeout:     10000,
-			wantTimeout:    10000,
-			wantCycle:      1,
-		},
-		{
-			name:           "exceeds max stays at max",
-			initialTimeout: 8000,
-			increments:     1,
-			maxTimeout:     10000,
-			wantTimeout:    10000,
-			wantCycle:      1,
-		},
-		{
-			name:           "multiple increments capped at max",
-			initialTimeout: 1000,
-			increments:     5,
-			maxTimeout:     10000,
-			wantTimeout:    10000,
-			wantCycle:      5,
-		},
-		{
-			name:           "zero timeout stays zero",
-			initialTimeout: 0,
-			increments:     3,
-			maxTimeout:     10000,
-			wantTimeout:    0,
-			wantCycle:      3,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			s := New(tt.initialTimeout)
-
-			for i := 0; i < tt.increments; i++ {
-				s.IncrementTimeout(tt.maxTimeout)
-			}
-
-			got := s.GetProgressiveTimeout()
-			if got != tt.wantTimeout {
-				t.Errorf("currentTimeout = %d, want %d", got, tt.wantTimeout)
-			}
-
-			s.mu.RLock()
-			cycle := s.cycle
-			s.mu.RUnlock()
-
-			if cycle != tt.wantCycle {
-				t.Errorf("cycle = %d, want %d", cycle, tt.wantCycle)
-			}
-		})
-	}
-}
-
 func TestConcurrentAccess(t *testing.T) {
-	s := New(1000)
+	s := New()
 	var wg sync.WaitGroup
 	numGoroutines := 100
 	opsPerGoroutine := 100
@@ -396,7 +258,7 @@ func TestConcurrentAccess(t *testing.T) {
 			switch idx % 5 {
 			case 0:
 				for j := 0; j < opsPerGoroutine; j++ {
-					s.RecordFailure(model, 10000)
+					s.RecordFailure(model, Policy{Threshold: 10000})
 				}
 			case 1:
 				for j := 0; j < opsPerGoroutine; j++ {
@@ -404,11 +266,11 @@ func TestConcurrentAccess(t *testing.T) {
 				}
 			case 2:
 				for j := 0; j < opsPerGoroutine; j++ {
-					s.GetProgressiveTimeout()
+					s.Allow(model, Policy{Threshold: 10000, Cooldown: time.Millisecond})
 				}
 			case 3:
 				for j := 0; j < opsPerGoroutine; j++ {
-					s.IncrementTimeout(300000)
+					s.RetryAfter(model)
 				}
 			case 4:
 				for j := 0; j < opsPerGoroutine; j++ {
@@ -429,7 +291,7 @@ func TestConcurrentAccess(t *testing.T) {
 }
 
 func TestConcurrentMixedOperations(t *testing.T) {
-	s := New(1000)
+	s := New()
 	var wg sync.WaitGroup
 	models := []string{"model-a", "model-b", "model-c"}
 
@@ -439,10 +301,10 @@ func TestConcurrentMixedOperations(t *testing.T) {
 		go func(idx int) {
 			defer wg.Done()
 			model := models[idx%len(models)]
-			s.RecordFailure(model, 5)
+			s.RecordFailure(model, Policy{Threshold: 5})
 			s.IsAvailable(model, 5)
-			s.GetProgressiveTimeout()
-			s.IncrementTimeout(300000)
+			s.Allow(model, Policy{Threshold: 5})
+			s.RetryAfter(model)
 			s.ResetModel(model)
 		}(i)
 	}
@@ -452,14 +314,14 @@ func TestConcurrentMixedOperations(t *testing.T) {
 
 func TestStateIntegration(t *testing.T) {
 	// Integration test simulating real usage
-	s := New(10000)
+	s := New()
 
 	// Record some failures
 	providers := []string{"ollama", "zen", "claude"}
 	threshold := 3
 
 	for _, provider := range providers {
-		s.RecordFailure(provider, threshold)
+		s.RecordFailure(provider, Policy{Threshold: threshold})
 	}
 
 	// All should still be available
@@ -470,8 +332,8 @@ func TestStateIntegration(t *testing.T) {
 	}
 
 	// Push ollama over threshold
-	s.RecordFailure("ollama", threshold)
-	s.RecordFailure("ollama", threshold)
+	s.RecordFailure("ollama", Policy{Threshold: threshold})
+	s.RecordFailure("ollama", Policy{Threshold: threshold})
 
 	// ollama should now be unavailable
 	if s.IsAvailable("ollama", threshold) {
@@ -483,15 +345,6 @@ func TestStateIntegration(t *testing.T) {
 		t.Error("zen should still be available")
 	}
 
-	// Increment timeout due to failures
-	initialTimeout := s.GetProgressiveTimeout()
-	s.IncrementTimeout(300000)
-	newTimeout := s.GetProgressiveTimeout()
-
-	if newTimeout != initialTimeout*2 {
-		t.Errorf("Timeout should have doubled from %d to %d, got %d", initialTimeout, initialTimeout*2, newTimeout)
-	}
-
 	// Reset ollama
 	s.ResetModel("ollama")
 
@@ -499,15 +352,6 @@ func TestStateIntegration(t *testing.T) {
 	if !s.IsAvailable("ollama", threshold) {
 		t.Error("ollama should be available after reset")
 	}
-
-	// Check timeout is properly capped
-	for i := 0; i < 20; i++ {
-		s.IncrementTimeout(300000)
-	}
-
-	if s.GetProgressiveTimeout() != 300000 {
-		t.Errorf("Timeout should be capped at max 300000, got %d", s.GetProgressiveTimeout())
-	}
 }
 
 // BenchmarkIsAvailable benchmarks the IsAvailable method
@@ -516,11 +360,11 @@ func BenchmarkIsAvailable(b *testing.B) {
 	threshold := 3
 
 	b.Run("available model", func(b *testing.B) {
-		s := New(10000)
+		s := New()
 		// Pre-populate with some failures but below threshold
 		for _, model := range models {
-			s.RecordFailure(model, threshold)
-			s.RecordFailure(model, threshold)
+			s.RecordFailure(model, Policy{Threshold: threshold})
+			s.RecordFailure(model, Policy{Threshold: threshold})
 		}
 
 		b.ResetTimer()
@@ -530,12 +374,12 @@ func BenchmarkIsAvailable(b *testing.B) {
 	})
 
 	b.Run("unavailable model", func(b *testing.B) {
-		s := New(10000)
+		s := New()
 		// Pre-populate with failures at threshold
 		for _, model := range models {
-			s.RecordFailure(model, threshold)
-			s.RecordFailure(model, threshold)
-			s.RecordFailure(model, threshold)
+			s.RecordFailure(model, Policy{Threshold: threshold})
+			s.RecordFailure(model, Policy{Threshold: threshold})
+			s.RecordFailure(model, Policy{Threshold: threshold})
 		}
 
 		b.ResetTimer()
@@ -545,7 +389,7 @@ func BenchmarkIsAvailable(b *testing.B) {
 	})
 
 	b.Run("new model", func(b *testing.B) {
-		s := New(10000)
+		s := New()
 
 		b.ResetTimer()
 		for i := 0; i < b.N; i++ {
@@ -556,12 +400,12 @@ func BenchmarkIsAvailable(b *testing.B) {
 
 // BenchmarkRecordFailure benchmarks the RecordFailure method
 func BenchmarkRecordFailure(b *testing.B) {
-	s := New(10000)
+	s := New()
 	threshold := 3
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		s.RecordFailure("benchmark-model", threshold)
+		s.RecordFailure("benchmark-model", Policy{Threshold: threshold})
 	}
 }
 
@@ -569,7 +413,7 @@ func BenchmarkRecordFailure(b *testing.B) {
 func BenchmarkNew(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_ = New(10000)
+		_ = New()
 	}
 }
 
@@ -603,7 +447,7 @@ func TestNextRoundRobin(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := New(1000)
+			s := New()
 
 			for i, wantIdx := range tt.callSequence {
 				gotIdx := s.NextRoundRobin("test-model", tt.total)
@@ -616,7 +460,7 @@ func TestNextRoundRobin(t *testing.T) {
 }
 
 func TestNextRoundRobinMultipleModels(t *testing.T) {
-	s := New(1000)
+	s := New()
 
 	// Each model should maintain its own round-robin state
 	// First call for model-a should return 0
@@ -656,7 +500,7 @@ func TestGetRandomIndex(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := New(1000)
+			s := New()
 
 			// Run multiple times to ensure it stays in bounds
 			for i := 0; i < 100; i++ {
@@ -669,8 +513,151 @@ func TestGetRandomIndex(t *testing.T) {
 	}
 }
 
+func TestGetWeightedIndex(t *testing.T) {
+	s := New()
+
+	if idx := s.GetWeightedIndex([]int{5}); idx != 0 {
+		t.Errorf("GetWeightedIndex() with one entry = %d, want 0", idx)
+	}
+
+	counts := make([]int, 3)
+	for i := 0; i < 3000; i++ {
+		idx := s.GetWeightedIndex([]int{1, 0, 8})
+		if idx < 0 || idx >= 3 {
+			t.Fatalf("GetWeightedIndex() = %d, want in range [0, 3)", idx)
+		}
+		counts[idx]++
+	}
+
+	// Weight 8 should dominate weights 1 and 0 (treated as 1)
+	if counts[2] < counts[0]*3 || counts[2] < counts[1]*3 {
+		t.Errorf("GetWeightedIndex() distribution = %v, want index 2 heavily favoured", counts)
+	}
+}
+
+func TestInFlight(t *testing.T) {
+	s := New()
+
+	s.AcquireInFlight("provider-a")
+	s.AcquireInFlight("provider-a")
+	s.AcquireInFlight("provider-b")
+	if got := s.InFlight("provider-a"); got != 2 {
+		t.Errorf("InFlight(provider-a) = %d, want 2", got)
+	}
+
+	s.ReleaseInFlight("provider-a")
+	s.ReleaseInFlight("provider-a")
+	s.ReleaseInFlight("provider-a") // extra release must not go negative
+	if got := s.InFlight("provider-a"); got != 0 {
+		t.Errorf("InFlight(provider-a) after release = %d, want 0", got)
+	}
+	if got := s.InFlight("provider-b"); got != 1 {
+		t.Errorf("InFlight(provider-b) = %d, want 1", got)
+	}
+}
+
+func TestWeights(t *testing.T) {
+	s := New()
+	if got := s.Weights("chat"); got != nil {
+		t.Errorf("Weights() before set = %v, want nil", got)
+	}
+
+	in := map[string]int{"a/m": 95, "b/m": 5}
+	s.SetWeights("chat", in)
+	in["a/m"] = 0 // the caller's map is not retained
+	got := s.Weights("chat")
+	if got["a/m"] != 95 || got["b/m"] != 5 {
+		t.Errorf("Weights() = %v, want a/m:95 b/m:5", got)
+	}
+	got["b/m"] = 50 // nor is the returned copy shared
+	if s.Weights("chat")["b/m"] != 5 {
+		t.Error("Weights() returned the internal map")
+	}
+
+	s.ClearWeights("chat")
+	if got := s.Weights("chat"); got != nil {
+		t.Errorf("Weights() after clear = %v, want nil", got)
+	}
+}
+
+func TestSetEnabled(t *testing.T) {
+	s := New()
+	policy := Policy{Threshold: 2}
+	if !s.Enabled("a/m") {
+		t.Fatal("Enabled() = false before SetEnabled, want true")
+	}
+
+	s.SetEnabled("a/m", false)
+	s.RecordFailure("a/m", policy)
+	if s.Enabled("a/m") {
+		t.Error("Enabled() = true after SetEnabled(false)")
+	}
+	if got := s.Failures("a/m"); got != 1 {
+		t.Errorf("Failures() = %d, want 1", got)
+	}
+
+	// Resetting failures keeps the backend disabled
+	s.ResetModel("a/m")
+	if s.Enabled("a/m") {
+		t.Error("Enabled() = true after ResetModel, want false")
+	}
+	if got := s.Failures("a/m"); got != 0 {
+		t.Errorf("Failures() after reset = %d, want 0", got)
+	}
+	if !s.Enabled("b/m") {
+		t.Error("Enabled(b/m) = false, want true")
+	}
+
+	s.SetEnabled("a/m", true)
+	if !s.Enabled("a/m") {
+		t.Error("Enabled() = false after SetEnabled(true)")
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	s := New()
+	policy := Policy{Threshold: 2, Cooldown: time.Minute, MaxCooldown: 10 * time.Minute}
+	if got := s.Snapshot("a/m"); got != (Snapshot{Circuit: CircuitClosed}) {
+		t.Errorf("Snapshot() of an unknown backend = %+v", got)
+	}
+
+	s.RecordFailure("a/m", policy)
+	snap := s.Snapshot("a/m")
+	if snap.Circuit != CircuitClosed || snap.Failures != 1 || snap.LastFailure.IsZero() || !snap.OpenedAt.IsZero() {
+		t.Errorf("Snapshot() after one failure = %+v", snap)
+	}
+
+	s.RecordFailure("a/m", policy)
+	snap = s.Snapshot("a/m")
+	if snap.Circuit != CircuitOpen || snap.Failures != 2 || snap.OpenedAt.IsZero() || snap.Cooldown != time.Minute {
+		t.Errorf("Snapshot() once open = %+v", snap)
+	}
+
+	// A failed probe doubles the cooldown
+	s.mu.Lock()
+	s.openedAt["a/m"] = time.Now().Add(-2 * time.Minute)
+	s.mu.Unlock()
+	if !s.Allow("a/m", policy) {
+		t.Fatal("Allow() = false after the cooldown, want a probe")
+	}
+	if snap := s.Snapshot("a/m"); snap.Circuit != CircuitHalfOpen || !snap.Probing {
+		t.Errorf("Snapshot() while probing = %+v", snap)
+	}
+	s.RecordFailure("a/m", policy)
+	if snap := s.Snapshot("a/m"); snap.Cooldown != 2*time.Minute || snap.Probing {
+		t.Errorf("Snapshot() after a failed probe = %+v, want a 2m cooldown", snap)
+	}
+
+	rate := Policy{ErrorRate: 0.9, RateRequests: 10}
+	s.RecordSuccess("b/m", rate)
+	s.RecordFailure("b/m", rate)
+	if snap := s.Snapshot("b/m"); snap.Requests != 2 || snap.FailedRequests != 1 {
+		t.Errorf("Snapshot() under the error-rate policy = %+v, want 1 of 2 failed", snap)
+	}
+}
+
 func TestResetRoundRobin(t *testing.T) {
-	s := New(1000)
+	s := New()
 
 	// Advance round-robin state
 	_ = s.NextRoundRobin("model-a", 3) // returns 0, stores 1
@@ -685,3 +672,205 @@ func TestResetRoundRobin(t *testing.T) {
 		t.Errorf("After reset, NextRoundRobin() = %d, want 0", idx)
 	}
 }
+
+func TestAllow_HalfOpenRecovery(t *testing.T) {
+	const cooldown = 20 * time.Millisecond
+	policy := Policy{Threshold: 1, Cooldown: cooldown, MaxCooldown: 4 * cooldown}
+	s := New()
+
+	if !s.Allow("provider-a", policy) {
+		t.Fatal("Allow() = false for a healthy provider")
+	}
+
+	if got := s.Circuit("provider-a"); got != CircuitClosed {
+		t.Errorf("Circuit() = %q for a healthy provider, want %q", got, CircuitClosed)
+	}
+
+	s.RecordFailure("provider-a", policy)
+	if s.Allow("provider-a", policy) {
+		t.Error("Allow() = true while the circuit is open")
+	}
+	if got := s.Circuit("provider-a"); got != CircuitOpen {
+		t.Errorf("Circuit() = %q while the circuit is open, want %q", got, CircuitOpen)
+	}
+
+	time.Sleep(cooldown)
+	if got := s.Circuit("provider-a"); got != CircuitHalfOpen {
+		t.Errorf("Circuit() = %q after cooldown, want %q", got, CircuitHalfOpen)
+	}
+	// Looking does not take the probe
+	if !s.Admits("provider-a", policy) || !s.Admits("provider-a", policy) {
+		t.Fatal("Admits() = false after cooldown")
+	}
+	if !s.Allow("provider-a", policy) {
+		t.Fatal("Allow() = false after cooldown, want a probe request")
+	}
+	if s.Admits("provider-a", policy) {
+		t.Error("Admits() = true while the probe is outstanding")
+	}
+	if s.Allow("provider-a", policy) {
+		t.Error("Allow() = true for a second request while the probe is outstanding")
+	}
+
+	// Failed probe re-opens the circuit with a doubled cooldown
+	s.RecordFailure("provider-a", policy)
+	time.Sleep(cooldown)
+	if s.Allow("provider-a", policy) {
+		t.Error("Allow() = true before the doubled cooldown elapsed")
+	}
+
+	// Successful probe closes the circuit
+	time.Sleep(cooldown)
+	if !s.Allow("provider-a", policy) {
+		t.Fatal("Allow() = false after the doubled cooldown")
+	}
+	s.ResetModel("provider-a")
+	if !s.Allow("provider-a", policy) || !s.Allow("provider-a", policy) {
+		t.Error("Allow() = false after a successful probe")
+	}
+}
+
+func TestAllow_NoCooldownStaysOpen(t *testing.T) {
+	s := New()
+	s.RecordFailure("provider-a", Policy{Threshold: 1})
+	time.Sleep(5 * time.Millisecond)
+	if s.Allow("provider-a", Policy{Threshold: 1}) {
+		t.Error("Allow() = true with recovery disabled")
+	}
+	if _, ok := s.RetryAfter("provider-a"); ok {
+		t.Error("RetryAfter() ok = true for a provider that never recovers")
+	}
+}
+
+func TestRecordFailure_ProgressiveCooldownPerBackend(t *testing.T) {
+	policy := Policy{Threshold: 1, Cooldown: time.Second, MaxCooldown: 3 * time.Second}
+	s := New()
+
+	s.RecordFailure("backend-a", policy)
+	for i := 0; i < 3; i++ {
+		// Force a probe and fail it
+		s.mu.Lock()
+		s.openedAt["backend-a"] = time.Now().Add(-time.Hour)
+		s.mu.Unlock()
+		if !s.Allow("backend-a", policy) {
+			t.Fatalf("probe %d not allowed", i)
+		}
+		s.RecordFailure("backend-a", policy)
+	}
+
+	s.mu.RLock()
+	cooldown := s.cooldowns["backend-a"]
+	s.mu.RUnlock()
+	if cooldown != 3*time.Second {
+		t.Errorf("cooldown after repeated failed probes = %v, want capped 3s", cooldown)
+	}
+
+	// Other backends are unaffected
+	if wait, ok := s.RetryAfter("backend-b"); !ok || wait != 0 {
+		t.Errorf("RetryAfter(backend-b) = %v, %v; want 0, true", wait, ok)
+	}
+	if wait, ok := s.RetryAfter("backend-a"); !ok || wait <= 2*time.Second {
+		t.Errorf("RetryAfter(backend-a) = %v, %v; want about 3s", wait, ok)
+	}
+}
+
+func TestRecordFailure_Window(t *testing.T) {
+	policy := Policy{Threshold: 2, Window: 10 * time.Millisecond}
+	s := New()
+
+	s.RecordFailure("backend-a", policy)
+	time.Sleep(20 * time.Millisecond)
+	s.RecordFailure("backend-a", policy)
+	if !s.IsAvailable("backend-a", policy.Threshold) {
+		t.Error("failures outside the window should not accumulate")
+	}
+
+	s.RecordFailure("backend-a", policy)
+	if s.IsAvailable("backend-a", policy.Threshold) {
+		t.Error("two failures within the window should reach the threshold")
+	}
+}
+
+func TestSuspendAndDisable(t *testing.T) {
+	policy := Policy{Threshold: 3, Cooldown: time.Hour}
+	s := New()
+
+	s.Suspend("backend-a", 10*time.Millisecond)
+	if s.Allow("backend-a", policy) {
+		t.Error("Allow() = true while suspended")
+	}
+	if wait, ok := s.RetryAfter("backend-a"); !ok || wait > 10*time.Millisecond {
+		t.Errorf("RetryAfter() = %v, %v; want at most the suspension", wait, ok)
+	}
+	time.Sleep(15 * time.Millisecond)
+	if !s.Allow("backend-a", policy) {
+		t.Error("Allow() = false after the suspension elapsed")
+	}
+
+	s.Disable("backend-b")
+	if s.Allow("backend-b", policy) {
+		t.Error("Allow() = true for a disabled backend")
+	}
+	if _, ok := s.RetryAfter("backend-b"); ok {
+		t.Error("RetryAfter() ok = true for a disabled backend")
+	}
+}
+
+func TestRecordFailure_ErrorRate(t *testing.T) {
+	policy := Policy{Threshold: 1, Cooldown: time.Hour, ErrorRate: 0.5, RateRequests: 10, RateMinRequests: 4, RateWindow: time.Minute}
+	s := New()
+
+	// Scattered failures on a busy backend stay below the rate
+	for i := 0; i < 20; i++ {
+		if i%3 == 0 {
+			s.RecordFailure("backend-a", policy)
+		} else {
+			s.RecordSuccess("backend-a", policy)
+		}
+	}
+	if !s.Allow("backend-a", policy) {
+		t.Fatal("Allow() = false with a third of requests failing")
+	}
+
+	// Too few requests in the sample to judge
+	s.RecordFailure("backend-b", policy)
+	s.RecordFailure("backend-b", policy)
+	if !s.Allow("backend-b", policy) {
+		t.Error("Allow() = false below min requests")
+	}
+	s.RecordSuccess("backend-b", policy)
+	s.RecordFailure("backend-b", policy)
+	if s.Allow("backend-b", policy) {
+		t.Error("Allow() = true with 3 of 4 requests failing")
+	}
+
+	// A successful probe closes the circuit and starts a fresh sample
+	s.mu.Lock()
+	s.openedAt["backend-b"] = time.Now().Add(-2 * time.Hour)
+	s.mu.Unlock()
+	if !s.Allow("backend-b", policy) {
+		t.Fatal("probe not allowed after cooldown")
+	}
+	s.RecordSuccess("backend-b", policy)
+	s.RecordFailure("backend-b", policy)
+	if !s.Allow("backend-b", policy) {
+		t.Error("failures from before the probe still count")
+	}
+}
+
+func TestRecordFailure_ErrorRateWindow(t *testing.T) {
+	policy := Policy{ErrorRate: 0.5, RateRequests: 20, RateMinRequests: 2, RateWindow: 10 * time.Millisecond}
+	s := New()
+
+	s.RecordFailure("backend-a", policy)
+	time.Sleep(20 * time.Millisecond)
+	s.RecordSuccess("backend-a", policy)
+	s.RecordFailure("backend-a", policy)
+	if !s.Allow("backend-a", policy) {
+		t.Error("a failure outside the window should leave the sample")
+	}
+	s.RecordFailure("backend-a", policy)
+	if s.Allow("backend-a", policy) {
+		t.Error("two of three requests failing within the window should trip")
+	}
+}
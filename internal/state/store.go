@@ -0,0 +1,150 @@
+// Package state manages failure tracking and model availability
+package state
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	applogger "github.com/macedot/openmodel/internal/logger"
+)
+
+// storeTimeout bounds each store call made while handling a request
+const storeTimeout = 500 * time.Millisecond
+
+// Store shares backend health and counters between openmodel instances. Keys are
+// relative; implementations namespace them.
+type Store interface {
+	// Incr increments a counter and returns its new value. The counter expires ttl after
+	// its last increment (0 keeps it until deleted).
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	// Delete removes counters
+	Delete(ctx context.Context, keys ...string) error
+	// SetHealth publishes that a backend is out of rotation
+	SetHealth(ctx context.Context, backend string, h Health) error
+	// ClearHealth removes a backend's published health after it recovered
+	ClearHealth(ctx context.Context, backend string) error
+	// Health returns every published backend health
+	Health(ctx context.Context) (map[string]Health, error)
+}
+
+// Health describes an unavailable backend
+type Health struct {
+	OpenedAt time.Time     // When the backend was taken out of rotation
+	Cooldown time.Duration // How long until it is probed again
+}
+
+// SetStore shares failure counts and cooldowns through store. It must be called before
+// the state is used.
+func (s *State) SetStore(store Store) {
+	s.store = store
+}
+
+// Store returns the shared store, or nil when state is local to this instance
+func (s *State) Store() Store {
+	return s.store
+}
+
+// failuresKey is the shared counter of a backend's recent failures
+func failuresKey(model string) string {
+	return "failures:" + model
+}
+
+// countSharedFailure adds a failure to the shared counter and returns the cluster-wide
+// count, or 0 without a store (or when it cannot be reached)
+func (s *State) countSharedFailure(model string, window time.Duration) int {
+	if s.store == nil {
+		return 0
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	n, err := s.store.Incr(ctx, failuresKey(model), window)
+	if err != nil {
+		applogger.Warn("state_store_failed", "op", "incr", "backend", model, "error", err.Error())
+		return 0
+	}
+	return int(n)
+}
+
+// publish makes an open circuit visible to other instances. Backends disabled until
+// reset (no cooldown) stay local, so a restart with fixed configuration clears them.
+func (s *State) publish(model string, h Health) {
+	if s.store == nil || h.Cooldown <= 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	if err := s.store.SetHealth(ctx, model, h); err != nil {
+		applogger.Warn("state_store_failed", "op", "set_health", "backend", model, "error", err.Error())
+		return
+	}
+	s.mu.Lock()
+	s.shared[model] = time.Now()
+	s.mu.Unlock()
+}
+
+// clearShared tells other instances a backend recovered
+func (s *State) clearShared(model string) {
+	if s.store == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	if err := s.store.ClearHealth(ctx, model); err != nil {
+		applogger.Warn("state_store_failed", "op", "clear_health", "backend", model, "error", err.Error())
+	}
+	if err := s.store.Delete(ctx, failuresKey(model)); err != nil {
+		applogger.Warn("state_store_failed", "op", "delete", "backend", model, "error", err.Error())
+	}
+}
+
+// Sync pulls backend health published by other instances: newer open circuits are
+// adopted, and backends that disappeared from the store are considered recovered.
+func (s *State) Sync(ctx context.Context) error {
+	if s.store == nil {
+		return nil
+	}
+	fetchedAt := time.Now()
+	remote, err := s.store.Health(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch shared state: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for model, h := range remote {
+		s.shared[model] = fetchedAt
+		if s.unavailableModels[model] && !h.OpenedAt.After(s.openedAt[model]) {
+			continue
+		}
+		s.unavailableModels[model] = true
+		s.openedAt[model] = h.OpenedAt
+		s.cooldowns[model] = h.Cooldown
+		delete(s.probing, model)
+	}
+	for model, seen := range s.shared {
+		if _, ok := remote[model]; !ok && seen.Before(fetchedAt) {
+			s.resetLocked(model)
+		}
+	}
+	return nil
+}
+
+// RunSync calls Sync every interval until ctx is cancelled
+func (s *State) RunSync(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		syncCtx, cancel := context.WithTimeout(ctx, storeTimeout)
+		if err := s.Sync(syncCtx); err != nil && ctx.Err() == nil {
+			applogger.Warn("state_sync_failed", "error", err.Error())
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
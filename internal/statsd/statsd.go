@@ -0,0 +1,201 @@
+// Package statsd pushes metrics to a StatsD or DogStatsD agent over UDP
+package statsd
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	applogger "github.com/macedot/openmodel/internal/logger"
+)
+
+// maxPacketSize keeps a packet of metric lines within an Ethernet MTU once the IP and
+// UDP headers are added
+const maxPacketSize = 1432
+
+// Metric types of the line protocol
+const (
+	typeCount     = "c"
+	typeGauge     = "g"
+	typeTiming    = "ms"
+	typeHistogram = "h"
+)
+
+// Config holds the settings of a client
+type Config struct {
+	Address       string        // host:port of the agent
+	Prefix        string        // Prepended to every metric name, e.g. "openmodel."
+	Tags          []string      // DogStatsD tags added to every metric, e.g. "env:prod"
+	DogStatsD     bool          // Send tags the DogStatsD way; plain StatsD gets tag values appended to names
+	FlushInterval time.Duration // How often buffered metrics are sent
+	Collect       func()        // Called before each flush, e.g. to send the current gauges
+}
+
+// Tag is a tag of a metric, such as the backend it counts
+type Tag struct {
+	Key   string
+	Value string
+}
+
+// Client buffers metric lines and sends them in packets once a packet is full or the
+// flush interval has passed. Sending never blocks or fails the caller: metrics are lost
+// while the agent is unreachable. Its methods do nothing on a nil client.
+type Client struct {
+	cfg  Config
+	conn net.Conn
+
+	mu  sync.Mutex
+	buf []byte
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// New connects to the agent and starts the flush loop
+func New(cfg Config) (*Client, error) {
+	conn, err := net.Dial("udp", cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to statsd agent: %w", err)
+	}
+	c := &Client{
+		cfg:  cfg,
+		conn: conn,
+		buf:  make([]byte, 0, maxPacketSize),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go c.loop()
+	return c, nil
+}
+
+// Count adds value to a counter
+func (c *Client) Count(name string, value float64, tags ...Tag) {
+	c.send(name, value, typeCount, tags)
+}
+
+// Gauge sets a gauge
+func (c *Client) Gauge(name string, value float64, tags ...Tag) {
+	c.send(name, value, typeGauge, tags)
+}
+
+// Timing records a duration
+func (c *Client) Timing(name string, d time.Duration, tags ...Tag) {
+	c.send(name, float64(d)/float64(time.Millisecond), typeTiming, tags)
+}
+
+// Histogram records a value in a histogram
+func (c *Client) Histogram(name string, value float64, tags ...Tag) {
+	c.send(name, value, typeHistogram, tags)
+}
+
+// Close sends the metrics buffered and closes the connection
+func (c *Client) Close() error {
+	if c == nil {
+		return nil
+	}
+	c.stopOnce.Do(func() { close(c.stop) })
+	<-c.done
+	return c.conn.Close()
+}
+
+// loop flushes the buffer every flush interval until the client is closed
+func (c *Client) loop() {
+	defer close(c.done)
+	ticker := time.NewTicker(c.cfg.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.stop:
+			c.collectAndFlush()
+			return
+		}
+		c.collectAndFlush()
+	}
+}
+
+// collectAndFlush collects the metrics sent on each flush and sends the buffer
+func (c *Client) collectAndFlush() {
+	if c.cfg.Collect != nil {
+		c.cfg.Collect()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.flushLocked()
+}
+
+// send buffers the line of a metric, sending the buffer first when the line does not fit
+func (c *Client) send(name string, value float64, kind string, tags []Tag) {
+	if c == nil {
+		return
+	}
+	line := c.format(name, value, kind, tags)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.buf) > 0 && len(c.buf)+1+len(line) > maxPacketSize {
+		c.flushLocked()
+	}
+	if len(c.buf) > 0 {
+		c.buf = append(c.buf, '\n')
+	}
+	c.buf = append(c.buf, line...)
+}
+
+// flushLocked sends the buffer; c.mu must be held
+func (c *Client) flushLocked() {
+	if len(c.buf) == 0 {
+		return
+	}
+	if _, err := c.conn.Write(c.buf); err != nil {
+		applogger.Debug("statsd_send_failed", "address", c.cfg.Address, "error", err)
+	}
+	c.buf = c.buf[:0]
+}
+
+// format formats a metric in the line protocol: name:value|type, followed by |#tags for
+// DogStatsD
+func (c *Client) format(name string, value float64, kind string, tags []Tag) string {
+	var b strings.Builder
+	b.WriteString(c.cfg.Prefix)
+	b.WriteString(nameEscaper.Replace(name))
+	if !c.cfg.DogStatsD {
+		for _, tag := range tags {
+			b.WriteByte('.')
+			b.WriteString(pathEscaper.Replace(tag.Value))
+		}
+	}
+	b.WriteByte(':')
+	b.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	b.WriteByte('|')
+	b.WriteString(kind)
+	if c.cfg.DogStatsD && len(c.cfg.Tags)+len(tags) > 0 {
+		b.WriteString("|#")
+		for i, tag := range c.cfg.Tags {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(tagEscaper.Replace(tag))
+		}
+		for i, tag := range tags {
+			if i > 0 || len(c.cfg.Tags) > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(tagEscaper.Replace(tag.Key) + ":" + tagEscaper.Replace(tag.Value))
+		}
+	}
+	return b.String()
+}
+
+var (
+	// nameEscaper replaces the characters of the line protocol in names
+	nameEscaper = strings.NewReplacer(":", "_", "|", "_", "@", "_", "#", "_", ",", "_", "\n", "_", " ", "_")
+	// tagEscaper replaces the characters of the line protocol in DogStatsD tags
+	tagEscaper = strings.NewReplacer("|", "_", ",", "_", "#", "_", "\n", "_")
+	// pathEscaper replaces the characters of tag values that would split or break the
+	// name they are appended to, such as the "/" of "provider/model"
+	pathEscaper = strings.NewReplacer(".", "_", "/", "_", ":", "_", "|", "_", "@", "_", "#", "_", ",", "_", "\n", "_", " ", "_")
+)
@@ -0,0 +1,126 @@
+package statsd
+
+import (
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listen starts a UDP agent and returns its address and the lines it receives
+func listen(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	lines := make(chan string, 100)
+	go func() {
+		buf := make([]byte, 65536)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			for _, line := range strings.Split(string(buf[:n]), "\n") {
+				lines <- line
+			}
+		}
+	}()
+	return conn.LocalAddr().String(), lines
+}
+
+func receive(t *testing.T, lines <-chan string, n int) []string {
+	t.Helper()
+	var got []string
+	for range n {
+		select {
+		case line := <-lines:
+			got = append(got, line)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %d of %d lines: %v", len(got), n, got)
+		}
+	}
+	return got
+}
+
+func TestClient(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want []string
+	}{
+		{
+			name: "dogstatsd",
+			cfg:  Config{Prefix: "openmodel.", Tags: []string{"env:prod"}, DogStatsD: true},
+			want: []string{
+				"openmodel.requests:1|c|#env:prod,endpoint:/v1/chat/completions,status:200",
+				"openmodel.backend_request_duration:1500|ms|#env:prod,backend:openai/gpt-4o",
+				"openmodel.in_flight:3|g|#env:prod",
+				"openmodel.size:0.5|h|#env:prod,backend:a_b",
+			},
+		},
+		{
+			name: "statsd",
+			cfg:  Config{Prefix: "openmodel.", Tags: []string{"env:prod"}},
+			want: []string{
+				"openmodel.requests._v1_chat_completions.200:1|c",
+				"openmodel.backend_request_duration.openai_gpt-4o:1500|ms",
+				"openmodel.in_flight:3|g",
+				"openmodel.size.a_b:0.5|h",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, lines := listen(t)
+			tt.cfg.Address = addr
+			tt.cfg.FlushInterval = time.Hour
+			c, err := New(tt.cfg)
+			require.NoError(t, err)
+
+			c.Count("requests", 1, Tag{"endpoint", "/v1/chat/completions"}, Tag{"status", "200"})
+			c.Timing("backend_request_duration", 1500*time.Millisecond, Tag{"backend", "openai/gpt-4o"})
+			c.Gauge("in_flight", 3)
+			c.Histogram("size", 0.5, Tag{"backend", "a,b"})
+			// Closing sends what is buffered
+			require.NoError(t, c.Close())
+			assert.Equal(t, tt.want, receive(t, lines, len(tt.want)))
+		})
+	}
+}
+
+func TestClient_Flush(t *testing.T) {
+	addr, lines := listen(t)
+	var client atomic.Pointer[Client]
+	c, err := New(Config{Address: addr, FlushInterval: 10 * time.Millisecond, Collect: func() {
+		client.Load().Gauge("in_flight", 2)
+	}})
+	require.NoError(t, err)
+	defer c.Close()
+	client.Store(c)
+
+	// Lines beyond a packet are sent at once, the rest and the collected gauge on the
+	// next flush
+	for range 200 {
+		c.Count("requests", 1)
+	}
+	counts, gauges := 0, 0
+	for counts < 200 || gauges == 0 {
+		switch line := receive(t, lines, 1)[0]; line {
+		case "requests:1|c":
+			counts++
+		case "in_flight:2|g":
+			gauges++
+		default:
+			t.Fatalf("unexpected line %q", line)
+		}
+	}
+
+	var nilClient *Client
+	nilClient.Count("requests", 1)
+	assert.NoError(t, nilClient.Close())
+}
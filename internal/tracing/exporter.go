@@ -0,0 +1,257 @@
+// Package tracing records OpenTelemetry spans of requests, propagates them with the W3C
+// traceparent header and exports them to a collector over OTLP/HTTP
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	applogger "github.com/macedot/openmodel/internal/logger"
+)
+
+// Export batching: spans are sent once a batch is full or the interval has passed. Spans
+// beyond the queue size are dropped rather than slowing requests down.
+const (
+	exportBatchSize = 512
+	exportInterval  = 5 * time.Second
+	exportQueueSize = 4096
+	exportTimeout   = 10 * time.Second
+)
+
+// scopeName names the instrumentation scope of the spans
+const scopeName = "github.com/macedot/openmodel"
+
+// exporter sends ended spans to an OTLP/HTTP collector in the JSON encoding
+type exporter struct {
+	endpoint    string
+	headers     map[string]string
+	serviceName string
+	client      *http.Client
+
+	queue    chan otlpSpan
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// newExporter creates an exporter and starts its export loop
+func newExporter(cfg Config) *exporter {
+	e := &exporter{
+		endpoint:    cfg.Endpoint,
+		headers:     cfg.Headers,
+		serviceName: cfg.ServiceName,
+		client:      &http.Client{Timeout: exportTimeout},
+		queue:       make(chan otlpSpan, exportQueueSize),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go e.loop()
+	return e
+}
+
+// enqueue queues a span for export, dropping it when the queue is full
+func (e *exporter) enqueue(span otlpSpan) {
+	select {
+	case e.queue <- span:
+	default:
+		applogger.Debug("trace_span_dropped", "span", span.Name)
+	}
+}
+
+// loop exports queued spans in batches until the exporter is shut down
+func (e *exporter) loop() {
+	defer close(e.done)
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+	var batch []otlpSpan
+	send := func() {
+		if len(batch) > 0 {
+			e.export(batch)
+			batch = nil
+		}
+	}
+	drain := func() {
+		for {
+			select {
+			case span := <-e.queue:
+				batch = append(batch, span)
+			default:
+				return
+			}
+		}
+	}
+	for {
+		select {
+		case span := <-e.queue:
+			batch = append(batch, span)
+			if len(batch) >= exportBatchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case <-e.stop:
+			drain()
+			send()
+			return
+		}
+	}
+}
+
+// shutdown exports the queued spans and stops the export loop
+func (e *exporter) shutdown(ctx context.Context) error {
+	e.stopOnce.Do(func() { close(e.stop) })
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// export sends a batch of spans. Failures are logged: spans are not retried.
+func (e *exporter) export(spans []otlpSpan) {
+	body, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpAttribute{stringAttribute("service.name", e.serviceName)}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: scopeName}, Spans: spans}},
+	}}})
+	if err == nil {
+		err = e.post(body)
+	}
+	if err != nil {
+		applogger.Warn("trace_export_failed", "endpoint", e.endpoint, "spans", len(spans), "error", err.Error())
+	}
+}
+
+// post sends an export request to the collector
+func (e *exporter) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// OTLP/HTTP JSON encoding of an export request (opentelemetry-proto's
+// ExportTraceServiceRequest). Ids are hex and timestamps decimal strings of nanoseconds.
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              SpanKind        `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		Events            []otlpEvent     `json:"events,omitempty"`
+		Status            otlpStatus      `json:"status"`
+	}
+	otlpEvent struct {
+		TimeUnixNano string `json:"timeUnixNano"`
+		Name         string `json:"name"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"` // 0 unset, 2 error
+		Message string `json:"message,omitempty"`
+	}
+	otlpAttribute struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+	}
+)
+
+// statusCodeError is the OTLP status code of failed spans
+const statusCodeError = 2
+
+func stringAttribute(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: &value}}
+}
+
+// otlpAttributeOf encodes an attribute set with SetAttribute
+func otlpAttributeOf(a attribute) otlpAttribute {
+	switch v := a.value.(type) {
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		return otlpAttribute{Key: a.key, Value: otlpValue{IntValue: &s}}
+	case float64:
+		return otlpAttribute{Key: a.key, Value: otlpValue{DoubleValue: &v}}
+	case bool:
+		return otlpAttribute{Key: a.key, Value: otlpValue{BoolValue: &v}}
+	default:
+		return stringAttribute(a.key, fmt.Sprint(v))
+	}
+}
+
+// unixNano formats a time as OTLP expects
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// otlp encodes the span as ended at end. The caller must hold s.mu.
+func (s *Span) otlp(end time.Time) otlpSpan {
+	span := otlpSpan{
+		TraceID:           hex.EncodeToString(s.context.TraceID[:]),
+		SpanID:            hex.EncodeToString(s.context.SpanID[:]),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: unixNano(s.start),
+		EndTimeUnixNano:   unixNano(end),
+	}
+	if s.parent != (SpanID{}) {
+		span.ParentSpanID = hex.EncodeToString(s.parent[:])
+	}
+	for _, a := range s.attributes {
+		span.Attributes = append(span.Attributes, otlpAttributeOf(a))
+	}
+	for _, ev := range s.events {
+		span.Events = append(span.Events, otlpEvent{TimeUnixNano: unixNano(ev.at), Name: ev.name})
+	}
+	if s.failed {
+		span.Status = otlpStatus{Code: statusCodeError, Message: s.message}
+	}
+	return span
+}
@@ -0,0 +1,271 @@
+// Package tracing records OpenTelemetry spans of requests, propagates them with the W3C
+// traceparent header and exports them to a collector over OTLP/HTTP
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	mathrand "math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HeaderTraceparent is the W3C Trace Context header carrying the trace and parent span
+const HeaderTraceparent = "traceparent"
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+// SpanContext is the part of a span propagated to other services
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid reports whether the trace and span ids are set
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Traceparent returns the traceparent header value of the span context
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + flags
+}
+
+// ParseTraceparent parses a traceparent header value, "00-<trace id>-<span id>-<flags>"
+func ParseTraceparent(value string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return SpanContext{}, false
+	}
+	var sc SpanContext
+	var flags [1]byte
+	if !decodeHex(sc.TraceID[:], parts[1]) || !decodeHex(sc.SpanID[:], parts[2]) || !decodeHex(flags[:], parts[3]) {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, sc.IsValid()
+}
+
+// decodeHex decodes lowercase hex of exactly len(dst) bytes
+func decodeHex(dst []byte, s string) bool {
+	if len(s) != 2*len(dst) || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+// SpanKind says what a span stands for, as in OTLP
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1 // An operation within the server, e.g. routing
+	SpanKindServer   SpanKind = 2 // A request served
+	SpanKindClient   SpanKind = 3 // A request to a backend
+)
+
+// Config configures a tracer
+type Config struct {
+	Endpoint    string            // OTLP/HTTP traces URL, e.g. http://localhost:4318/v1/traces
+	Headers     map[string]string // Extra headers of export requests
+	ServiceName string            // service.name resource attribute
+	SampleRatio float64           // Share of new traces recorded, from 0 to 1
+}
+
+// Tracer starts spans and exports those that are sampled. A nil tracer starts no spans.
+type Tracer struct {
+	sampleRatio float64
+	exporter    *exporter
+}
+
+// New creates a tracer exporting to cfg.Endpoint and starts its exporter
+func New(cfg Config) *Tracer {
+	return &Tracer{sampleRatio: cfg.SampleRatio, exporter: newExporter(cfg)}
+}
+
+// Start starts a span as a child of the span in ctx, or of a remote parent set with
+// ContextWithRemoteParent, and returns a context holding it. Without either it starts a
+// trace, sampled by the tracer's ratio.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	span := &Span{tracer: t, name: name, kind: kind, start: time.Now()}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.context.TraceID = parent.context.TraceID
+		span.context.Sampled = parent.context.Sampled
+		span.parent = parent.context.SpanID
+	} else if remote, ok := ctx.Value(remoteParentKey{}).(SpanContext); ok && remote.IsValid() {
+		span.context.TraceID = remote.TraceID
+		span.context.Sampled = remote.Sampled
+		span.parent = remote.SpanID
+	} else {
+		rand.Read(span.context.TraceID[:])
+		span.context.Sampled = t.sampleRatio >= 1 || mathrand.Float64() < t.sampleRatio
+	}
+	rand.Read(span.context.SpanID[:])
+	return ContextWithSpan(ctx, span), span
+}
+
+// Shutdown exports the spans still queued, waiting until ctx is done at most
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	return t.exporter.shutdown(ctx)
+}
+
+type (
+	spanKey         struct{}
+	remoteParentKey struct{}
+)
+
+// ContextWithSpan returns a context holding span as the current span
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the current span of ctx, nil when there is none
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// ContextWithRemoteParent returns a context whose next span continues the trace of
+// another service, e.g. from a request's traceparent header
+func ContextWithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteParentKey{}, sc)
+}
+
+// Traceparent returns the traceparent header value propagating the current span of ctx,
+// "" when there is none
+func Traceparent(ctx context.Context) string {
+	span := SpanFromContext(ctx)
+	if span == nil {
+		return ""
+	}
+	return span.context.Traceparent()
+}
+
+// Span is an operation of a trace. Its methods do nothing on a nil span, so code can
+// record spans whether or not tracing is enabled.
+type Span struct {
+	tracer  *Tracer
+	context SpanContext
+	parent  SpanID
+	kind    SpanKind
+	start   time.Time
+
+	mu         sync.Mutex
+	name       string
+	attributes []attribute
+	events     []event
+	failed     bool
+	message    string
+	ended      bool
+}
+
+// attribute is a key and a string, int64, float64 or bool value
+type attribute struct {
+	key   string
+	value any
+}
+
+// event is a point in time within a span
+type event struct {
+	name string
+	at   time.Time
+}
+
+// SpanContext returns the span's context, the zero value for a nil span
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.context
+}
+
+// SetName renames the span
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.name = name
+}
+
+// SetAttribute sets an attribute. Values other than strings, integers, floats and bools
+// are recorded as text.
+func (s *Span) SetAttribute(key string, value any) {
+	if s == nil {
+		return
+	}
+	switch v := value.(type) {
+	case string, int64, float64, bool:
+	case int:
+		value = int64(v)
+	default:
+		value = fmt.Sprint(v)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.attributes {
+		if s.attributes[i].key == key {
+			s.attributes[i].value = value
+			return
+		}
+	}
+	s.attributes = append(s.attributes, attribute{key: key, value: value})
+}
+
+// AddEvent records that something happened at this time
+func (s *Span) AddEvent(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event{name: name, at: time.Now()})
+}
+
+// SetError marks the span as failed with err; a nil err changes nothing
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed = true
+	s.message = err.Error()
+}
+
+// End ends the span and queues it for export when it is sampled. Later calls do nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	data := s.otlp(time.Now())
+	s.mu.Unlock()
+	if s.context.Sampled {
+		s.tracer.exporter.enqueue(data)
+	}
+}
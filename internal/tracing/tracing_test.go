@@ -0,0 +1,116 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		wantOK      bool
+		wantSampled bool
+	}{
+		{name: "sampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", wantOK: true, wantSampled: true},
+		{name: "not sampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", wantOK: true},
+		{name: "future version with more fields", value: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", wantOK: true, wantSampled: true},
+		{name: "zero trace id", value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{name: "uppercase", value: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"},
+		{name: "short span id", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902-01"},
+		{name: "invalid version", value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{name: "empty", value: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, ok := ParseTraceparent(tt.value)
+			assert.Equal(t, tt.wantOK, ok)
+			if ok {
+				assert.Equal(t, tt.wantSampled, sc.Sampled)
+				if tt.value[:2] == "00" {
+					assert.Equal(t, tt.value, sc.Traceparent())
+				}
+			}
+		})
+	}
+}
+
+// collector records the OTLP export requests it receives
+type collector struct {
+	mu       sync.Mutex
+	requests []otlpRequest
+	headers  http.Header
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req otlpRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, req)
+	c.headers = r.Header.Clone()
+}
+
+func TestTracer_ExportsSpans(t *testing.T) {
+	coll := &collector{}
+	srv := httptest.NewServer(coll)
+	defer srv.Close()
+	tracer := New(Config{Endpoint: srv.URL + "/v1/traces", Headers: map[string]string{"X-Api-Key": "k"}, ServiceName: "openmodel", SampleRatio: 1})
+
+	remote, ok := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.True(t, ok)
+	ctx, root := tracer.Start(ContextWithRemoteParent(context.Background(), remote), "POST /v1/chat/completions", SpanKindServer)
+	root.SetAttribute("http.response.status_code", 200)
+	childCtx, child := tracer.Start(ctx, "backend ollama/llama3", SpanKindClient)
+	child.AddEvent("first_token")
+	child.SetError(errors.New("upstream ended before completion"))
+	assert.Equal(t, child.SpanContext().Traceparent(), Traceparent(childCtx))
+	child.End()
+	child.End()
+	root.End()
+
+	_, unsampled := tracer.Start(ContextWithRemoteParent(context.Background(), SpanContext{TraceID: remote.TraceID, SpanID: remote.SpanID}), "unsampled", SpanKindServer)
+	unsampled.End()
+
+	require.NoError(t, tracer.Shutdown(context.Background()))
+	coll.mu.Lock()
+	defer coll.mu.Unlock()
+	require.Len(t, coll.requests, 1)
+	assert.Equal(t, "k", coll.headers.Get("X-Api-Key"))
+	rs := coll.requests[0].ResourceSpans[0]
+	assert.Equal(t, "service.name", rs.Resource.Attributes[0].Key)
+	spans := rs.ScopeSpans[0].Spans
+	require.Len(t, spans, 2, "unsampled spans are not exported")
+
+	backend, server := spans[0], spans[1]
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", server.ParentSpanID)
+	assert.Equal(t, SpanKindServer, server.Kind)
+	assert.Equal(t, "200", *server.Attributes[0].Value.IntValue)
+	assert.Equal(t, server.TraceID, backend.TraceID)
+	assert.Equal(t, server.SpanID, backend.ParentSpanID)
+	assert.Equal(t, statusCodeError, backend.Status.Code)
+	assert.Equal(t, "first_token", backend.Events[0].Name)
+}
+
+func TestTracer_Nil(t *testing.T) {
+	var tracer *Tracer
+	ctx, span := tracer.Start(context.Background(), "noop", SpanKindInternal)
+	assert.Nil(t, span)
+	span.SetAttribute("key", "value")
+	span.SetError(errors.New("failed"))
+	span.End()
+	assert.Empty(t, Traceparent(ctx))
+	assert.NoError(t, tracer.Shutdown(context.Background()))
+}
@@ -0,0 +1,274 @@
+// Package usage accounts for the tokens and cost of requests, adding them up by day, model,
+// backend, API key and tenant in a SQLite database
+package usage
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // Registers the "sqlite" database/sql driver
+)
+
+// DayLayout is the format of days, which are UTC
+const DayLayout = "2006-01-02"
+
+// Columns a report can be grouped by
+const (
+	ColumnDay     = "day"
+	ColumnModel   = "model"
+	ColumnBackend = "backend"
+	ColumnAPIKey  = "api_key"
+	ColumnTenant  = "tenant"
+)
+
+// Columns lists the columns a report can be grouped by, in report order
+var Columns = []string{ColumnDay, ColumnModel, ColumnBackend, ColumnAPIKey, ColumnTenant}
+
+const schema = `CREATE TABLE IF NOT EXISTS usage (
+	day               TEXT    NOT NULL,
+	model             TEXT    NOT NULL,
+	backend           TEXT    NOT NULL,
+	api_key           TEXT    NOT NULL,
+	requests          INTEGER NOT NULL DEFAULT 0,
+	prompt_tokens     INTEGER NOT NULL DEFAULT 0,
+	completion_tokens INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (day, model, backend, api_key)
+)`
+
+// migrations upgrade the schema of databases created by earlier versions. The database's
+// user_version counts those applied.
+var migrations = []string{
+	`ALTER TABLE usage ADD COLUMN cost REAL NOT NULL DEFAULT 0`,
+	// The tenant joins the primary key, so the table is rebuilt
+	`BEGIN;
+CREATE TABLE usage_tenants (
+	day               TEXT    NOT NULL,
+	model             TEXT    NOT NULL,
+	backend           TEXT    NOT NULL,
+	api_key           TEXT    NOT NULL,
+	tenant            TEXT    NOT NULL DEFAULT '',
+	requests          INTEGER NOT NULL DEFAULT 0,
+	prompt_tokens     INTEGER NOT NULL DEFAULT 0,
+	completion_tokens INTEGER NOT NULL DEFAULT 0,
+	cost              REAL    NOT NULL DEFAULT 0,
+	PRIMARY KEY (day, model, backend, api_key, tenant)
+);
+INSERT INTO usage_tenants (day, model, backend, api_key, requests, prompt_tokens, completion_tokens, cost)
+	SELECT day, model, backend, api_key, requests, prompt_tokens, completion_tokens, cost FROM usage;
+DROP TABLE usage;
+ALTER TABLE usage_tenants RENAME TO usage;
+COMMIT`,
+}
+
+const upsert = `INSERT INTO usage (day, model, backend, api_key, tenant, requests, prompt_tokens, completion_tokens, cost)
+VALUES (?, ?, ?, ?, ?, 1, ?, ?, ?)
+ON CONFLICT (day, model, backend, api_key, tenant) DO UPDATE SET
+	requests = requests + 1,
+	prompt_tokens = prompt_tokens + excluded.prompt_tokens,
+	completion_tokens = completion_tokens + excluded.completion_tokens,
+	cost = cost + excluded.cost`
+
+// Record is the usage of one day, model, backend, API key and tenant, or the sum over the columns
+// a report is not grouped by, which are then empty
+type Record struct {
+	Day              string  `json:"day,omitempty"`
+	Model            string  `json:"model,omitempty"`
+	Backend          string  `json:"backend,omitempty"`
+	APIKey           string  `json:"api_key,omitempty"`
+	Tenant           string  `json:"tenant,omitempty"`
+	Requests         int64   `json:"requests"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	Cost             float64 `json:"cost"` // From the configured pricing, 0 for unpriced backends
+}
+
+// Filter selects the usage a report covers. Empty fields match everything.
+type Filter struct {
+	From    string   // First day, inclusive
+	To      string   // Last day, inclusive
+	Model   string   // Model requested
+	Backend string   // Backend that served, "provider/model"
+	APIKey  string   // API key id, see KeyID
+	Tenant  string   // Tenant name
+	GroupBy []string // Columns kept apart, from Columns; all of them when empty
+}
+
+// Store keeps usage in a SQLite database. Its methods do nothing on a nil store, so
+// callers can record usage whether or not accounting is enabled.
+type Store struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+// Open opens the database at path, creating it and its directory if needed
+func Open(path string) (*Store, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create usage database directory: %w", err)
+		}
+	}
+	// WAL keeps reports from blocking the writes of requests being served
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=synchronous(NORMAL)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open usage database: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create usage table: %w", err)
+	}
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db, now: time.Now}, nil
+}
+
+// migrate applies the migrations the database has not had yet
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("failed to read usage schema version: %w", err)
+	}
+	for i := version; i < len(migrations); i++ {
+		if _, err := db.Exec(migrations[i]); err != nil {
+			return fmt.Errorf("failed to upgrade usage schema to version %d: %w", i+1, err)
+		}
+		if _, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			return fmt.Errorf("failed to upgrade usage schema to version %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	if s == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// Add accounts for a request to model served by backend for the API key with the given id
+// and the tenant, both empty when the request had none
+func (s *Store) Add(ctx context.Context, model, backend, apiKey, tenant string, promptTokens, completionTokens int, cost float64) error {
+	if s == nil {
+		return nil
+	}
+	day := s.now().UTC().Format(DayLayout)
+	if _, err := s.db.ExecContext(ctx, upsert, day, model, backend, apiKey, tenant, promptTokens, completionTokens, cost); err != nil {
+		return fmt.Errorf("failed to record usage: %w", err)
+	}
+	return nil
+}
+
+// Query reports the usage matching f, ordered by its group columns
+func (s *Store) Query(ctx context.Context, f Filter) ([]Record, error) {
+	if s == nil {
+		return nil, nil
+	}
+	groupBy := f.GroupBy
+	if len(groupBy) == 0 {
+		groupBy = Columns
+	}
+	for _, col := range groupBy {
+		if !slices.Contains(Columns, col) {
+			return nil, fmt.Errorf("unknown group column %q", col)
+		}
+	}
+	// Columns not grouped by are summed over and reported empty
+	var selects, groups []string
+	for _, col := range Columns {
+		if slices.Contains(groupBy, col) {
+			selects = append(selects, col)
+			groups = append(groups, col)
+		} else {
+			selects = append(selects, "''")
+		}
+	}
+
+	var where []string
+	var args []any
+	for _, cond := range []struct {
+		clause string
+		value  string
+	}{
+		{"day >= ?", f.From},
+		{"day <= ?", f.To},
+		{"model = ?", f.Model},
+		{"backend = ?", f.Backend},
+		{"api_key = ?", f.APIKey},
+		{"tenant = ?", f.Tenant},
+	} {
+		if cond.value != "" {
+			where = append(where, cond.clause)
+			args = append(args, cond.value)
+		}
+	}
+
+	query := "SELECT " + strings.Join(selects, ", ") +
+		", SUM(requests), SUM(prompt_tokens), SUM(completion_tokens), SUM(cost) FROM usage"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " GROUP BY " + strings.Join(groups, ", ") + " ORDER BY " + strings.Join(groups, ", ")
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage: %w", err)
+	}
+	defer rows.Close()
+	records := []Record{}
+	for rows.Next() {
+		var r Record
+		if err := rows.Scan(&r.Day, &r.Model, &r.Backend, &r.APIKey, &r.Tenant, &r.Requests, &r.PromptTokens, &r.CompletionTokens, &r.Cost); err != nil {
+			return nil, fmt.Errorf("failed to read usage: %w", err)
+		}
+		r.TotalTokens = r.PromptTokens + r.CompletionTokens
+		records = append(records, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read usage: %w", err)
+	}
+	return records, nil
+}
+
+// KeyID identifies an API key without storing it: the first 16 hex digits of its SHA-256.
+// Requests without a key have the empty id.
+func KeyID(apiKey string) string {
+	if apiKey == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:8])
+}
+
+// WriteCSV writes records as CSV with a header row
+func WriteCSV(w io.Writer, records []Record) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"day", "model", "backend", "api_key", "tenant", "requests", "prompt_tokens", "completion_tokens", "total_tokens", "cost"})
+	for _, r := range records {
+		cw.Write([]string{
+			r.Day, r.Model, r.Backend, r.APIKey, r.Tenant,
+			strconv.FormatInt(r.Requests, 10),
+			strconv.FormatInt(r.PromptTokens, 10),
+			strconv.FormatInt(r.CompletionTokens, 10),
+			strconv.FormatInt(r.TotalTokens, 10),
+			strconv.FormatFloat(r.Cost, 'f', -1, 64),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,134 @@
+package usage
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "usage.db")
+	store, err := Open(path)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	day := time.Date(2026, 3, 1, 23, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return day }
+	require.NoError(t, store.Add(ctx, "gpt-4", "openai/gpt-4", "k1", "team-a", 10, 5, 0.25))
+	require.NoError(t, store.Add(ctx, "gpt-4", "openai/gpt-4", "k1", "team-a", 20, 5, 0.5))
+	require.NoError(t, store.Add(ctx, "gpt-4", "azure/gpt-4o", "k2", "team-b", 1, 1, 0))
+	day = day.Add(2 * time.Hour)
+	require.NoError(t, store.Add(ctx, "gpt-4", "openai/gpt-4", "", "", 7, 3, 0.25))
+	require.NoError(t, store.Close())
+
+	// Usage persists across restarts
+	store, err = Open(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []Record
+	}{
+		{
+			name:   "all columns",
+			filter: Filter{},
+			want: []Record{
+				{Day: "2026-03-01", Model: "gpt-4", Backend: "azure/gpt-4o", APIKey: "k2", Tenant: "team-b", Requests: 1, PromptTokens: 1, CompletionTokens: 1, TotalTokens: 2},
+				{Day: "2026-03-01", Model: "gpt-4", Backend: "openai/gpt-4", APIKey: "k1", Tenant: "team-a", Requests: 2, PromptTokens: 30, CompletionTokens: 10, TotalTokens: 40, Cost: 0.75},
+				{Day: "2026-03-02", Model: "gpt-4", Backend: "openai/gpt-4", Requests: 1, PromptTokens: 7, CompletionTokens: 3, TotalTokens: 10, Cost: 0.25},
+			},
+		},
+		{
+			name:   "grouped by backend",
+			filter: Filter{GroupBy: []string{ColumnBackend}},
+			want: []Record{
+				{Backend: "azure/gpt-4o", Requests: 1, PromptTokens: 1, CompletionTokens: 1, TotalTokens: 2},
+				{Backend: "openai/gpt-4", Requests: 3, PromptTokens: 37, CompletionTokens: 13, TotalTokens: 50, Cost: 1},
+			},
+		},
+		{
+			name:   "day range and key",
+			filter: Filter{From: "2026-03-01", To: "2026-03-01", APIKey: "k1", GroupBy: []string{ColumnDay}},
+			want:   []Record{{Day: "2026-03-01", Requests: 2, PromptTokens: 30, CompletionTokens: 10, TotalTokens: 40, Cost: 0.75}},
+		},
+		{
+			name:   "tenant",
+			filter: Filter{Tenant: "team-b", GroupBy: []string{ColumnTenant}},
+			want:   []Record{{Tenant: "team-b", Requests: 1, PromptTokens: 1, CompletionTokens: 1, TotalTokens: 2}},
+		},
+		{
+			name:   "no match",
+			filter: Filter{Model: "claude"},
+			want:   []Record{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := store.Query(ctx, tt.filter)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, records)
+		})
+	}
+
+	_, err = store.Query(ctx, Filter{GroupBy: []string{"provider"}})
+	assert.Error(t, err)
+}
+
+func TestOpen_UpgradesSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.db")
+	store, err := Open(path)
+	require.NoError(t, err)
+	// A database of the first schema version, before usage had a cost or a tenant
+	_, err = store.db.Exec("DROP TABLE usage")
+	require.NoError(t, err)
+	_, err = store.db.Exec(schema)
+	require.NoError(t, err)
+	_, err = store.db.Exec("INSERT INTO usage VALUES ('2026-03-01', 'gpt-4', 'openai/gpt-4', '', 1, 10, 5)")
+	require.NoError(t, err)
+	_, err = store.db.Exec("PRAGMA user_version = 0")
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	store, err = Open(path)
+	require.NoError(t, err)
+	defer store.Close()
+	records, err := store.Query(context.Background(), Filter{})
+	require.NoError(t, err)
+	assert.Equal(t, []Record{{Day: "2026-03-01", Model: "gpt-4", Backend: "openai/gpt-4", Requests: 1, PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}}, records)
+
+	// The upgraded table accounts for tenants apart
+	require.NoError(t, store.Add(context.Background(), "gpt-4", "openai/gpt-4", "", "team-a", 1, 1, 0))
+	records, err = store.Query(context.Background(), Filter{GroupBy: []string{ColumnTenant}})
+	require.NoError(t, err)
+	assert.Len(t, records, 2)
+}
+
+func TestStore_Nil(t *testing.T) {
+	var store *Store
+	assert.NoError(t, store.Add(context.Background(), "gpt-4", "openai/gpt-4", "", "", 1, 1, 0))
+	records, err := store.Query(context.Background(), Filter{})
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+	assert.NoError(t, store.Close())
+}
+
+func TestKeyID(t *testing.T) {
+	assert.Empty(t, KeyID(""))
+	assert.Len(t, KeyID("sk-secret"), 16)
+	assert.Equal(t, KeyID("sk-secret"), KeyID("sk-secret"))
+	assert.NotEqual(t, KeyID("sk-secret"), KeyID("sk-other"))
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteCSV(&buf, []Record{{Day: "2026-03-01", Model: "gpt-4", Backend: "openai/gpt-4", Requests: 2, PromptTokens: 30, CompletionTokens: 10, TotalTokens: 40, Cost: 0.75}}))
+	assert.Equal(t, "day,model,backend,api_key,tenant,requests,prompt_tokens,completion_tokens,total_tokens,cost\n"+
+		"2026-03-01,gpt-4,openai/gpt-4,,,2,30,10,40,0.75\n", buf.String())
+}
@@ -0,0 +1,10 @@
+// Package openmodel holds the repository files built into the binary
+package openmodel
+
+import _ "embed"
+
+// ConfigSchema is the JSON schema of the configuration file (openmodel.schema.json).
+// Configs are validated against it unless their $schema names another one.
+//
+//go:embed openmodel.schema.json
+var ConfigSchema []byte